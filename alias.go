@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// depAliases maps repository URLs to the alias they are installed under,
+// for the lock file in use (see registerAliases). An override from a profile
+// may instead map to the URL of the entry it replaces.
+var depAliases = make(map[string]string)
+
+// aliasPattern matches valid aliases. Dots aren't allowed so an alias can never
+// be mistaken for, or collide with, a host directory like .deps/github.com.
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// registerAliases makes getDepPath install the aliased dependencies of
+// lockFile under .deps/<alias>
+func registerAliases(lockFile *LockFile) {
+	depAliases = make(map[string]string)
+	for repoURL, dep := range lockFile.Dependencies {
+		if dep.Alias != "" {
+			depAliases[repoURL] = dep.Alias
+		}
+	}
+
+	// An override from another repository installs where the entry it
+	// replaces does, which may be under the entry's URL rather than an alias
+	if applied := lockFile.profile; applied != nil {
+		for key, baseKey := range applied.overridden {
+			base := applied.bases[baseKey]
+			if base.Alias != "" {
+				depAliases[baseKey] = base.Alias
+			}
+			if _, aliased := depAliases[key]; !aliased && key != baseKey {
+				depAliases[key] = baseKey
+				if base.Alias != "" {
+					depAliases[key] = base.Alias
+				}
+			}
+		}
+	}
+}
+
+// validateAlias checks that alias can name a dependency and its directory
+func validateAlias(alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("invalid alias %q (use letters, digits, - and _)", alias)
+	}
+	return nil
+}
+
+// checkAlias checks that repoURL can take alias in lockFile: it must be valid
+// and not already used by another dependency. An empty alias is always fine.
+func checkAlias(lockFile *LockFile, repoURL, alias string) error {
+	if alias == "" {
+		return nil
+	}
+	if err := validateAlias(alias); err != nil {
+		return err
+	}
+	for otherURL, dep := range lockFile.Dependencies {
+		if otherURL != repoURL && dep.Alias == alias {
+			return fmt.Errorf("alias %s is already used by %s", alias, otherURL)
+		}
+	}
+	return nil
+}
+
+// resolveAlias returns the repository URL a command-line argument refers to:
+// the dependency with that alias if there is one, otherwise name itself
+func resolveAlias(lockFile *LockFile, name string) string {
+	if _, exists := lockFile.Dependencies[name]; exists {
+		return name
+	}
+	for repoURL, dep := range lockFile.Dependencies {
+		if dep.Alias == name {
+			return repoURL
+		}
+	}
+	return name
+}
+
+// setAlias gives the dependency at repoURL a new alias (or none when alias is
+// empty), moving its installed directory to match
+func setAlias(lockFile *LockFile, repoURL, alias string) error {
+	dep, exists := lockFile.Dependencies[repoURL]
+	if !exists {
+		return fmt.Errorf("dependency %s not found in .deps.lock", repoURL)
+	}
+	if err := checkAlias(lockFile, repoURL, alias); err != nil {
+		return err
+	}
+
+	oldPath, newPath := getDepPath(repoURL), depPathFor(repoURL, alias)
+	if oldPath != newPath {
+		if _, err := os.Stat(oldPath); err == nil {
+			if _, err := os.Stat(newPath); err == nil {
+				return fmt.Errorf("%s already exists", newPath)
+			}
+			if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+				return err
+			}
+			if err := os.Rename(oldPath, newPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	dep.Alias = alias
+	lockFile.Dependencies[repoURL] = dep
+	registerAliases(lockFile)
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testAliasLockFile() *LockFile {
+	return &LockFile{Dependencies: map[string]Dependency{
+		"github.com/someorg/really-long-repo-name": {Ref: "main", SHA: "75ccf94d605a05fe24817fc2f166f6f2959d5cea", Alias: "jsonlib"},
+		"github.com/user/other":                    {Ref: "main", SHA: "75ccf94d605a05fe24817fc2f166f6f2959d5cea"},
+	}}
+}
+
+func TestResolveAlias(t *testing.T) {
+	lockFile := testAliasLockFile()
+	tests := map[string]string{
+		"jsonlib":               "github.com/someorg/really-long-repo-name",
+		"github.com/user/other": "github.com/user/other",
+		"unknown":               "unknown",
+	}
+	for name, want := range tests {
+		if got := resolveAlias(lockFile, name); got != want {
+			t.Errorf("resolveAlias(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCheckAlias(t *testing.T) {
+	lockFile := testAliasLockFile()
+	tests := []struct {
+		repoURL, alias string
+		wantErr        string
+	}{
+		{"github.com/user/other", "", ""},
+		{"github.com/user/other", "other_lib-2", ""},
+		{"github.com/someorg/really-long-repo-name", "jsonlib", ""},
+		{"github.com/user/other", "jsonlib", "already used by github.com/someorg/really-long-repo-name"},
+		{"github.com/user/other", "github.com", "invalid alias"},
+		{"github.com/user/other", "../up", "invalid alias"},
+		{"github.com/user/other", "-flag", "invalid alias"},
+	}
+	for _, tt := range tests {
+		err := checkAlias(lockFile, tt.repoURL, tt.alias)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("checkAlias(%q, %q) = %v", tt.repoURL, tt.alias, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("checkAlias(%q, %q) = %v, want %q", tt.repoURL, tt.alias, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSetAlias_MovesInstall(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	defer func() { depAliases = make(map[string]string) }()
+
+	lockFile := testAliasLockFile()
+	registerAliases(lockFile)
+	if got := getDepPath("github.com/someorg/really-long-repo-name"); got != filepath.Join(".deps", "jsonlib") {
+		t.Errorf("getDepPath = %q", got)
+	}
+
+	os.MkdirAll(filepath.Join(".deps", "github.com", "user", "other"), 0755)
+	os.WriteFile(filepath.Join(".deps", "github.com", "user", "other", "lib.h"), []byte("x"), 0644)
+
+	if err := setAlias(lockFile, "github.com/user/other", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if lockFile.Dependencies["github.com/user/other"].Alias != "other" {
+		t.Error("alias not recorded in the lock entry")
+	}
+	if _, err := os.Stat(filepath.Join(".deps", "other", "lib.h")); err != nil {
+		t.Errorf("install not moved: %v", err)
+	}
+
+	if err := setAlias(lockFile, "github.com/user/other", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(".deps", "github.com", "user", "other", "lib.h")); err != nil {
+		t.Errorf("install not moved back: %v", err)
+	}
+
+	if err := setAlias(lockFile, "github.com/user/missing", "x"); err == nil {
+		t.Error("expected an error for a dependency that isn't locked")
+	}
+}
+
+func TestRenameDependency_KeepsAliasDirectory(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	defer func() { depAliases = make(map[string]string) }()
+
+	lockFile := testAliasLockFile()
+	registerAliases(lockFile)
+	os.MkdirAll(filepath.Join(".deps", "jsonlib"), 0755)
+
+	if err := renameDependency(lockFile, "github.com/someorg/really-long-repo-name", "github.com/neworg/repo"); err != nil {
+		t.Fatal(err)
+	}
+	if got := getDepPath("github.com/neworg/repo"); got != filepath.Join(".deps", "jsonlib") {
+		t.Errorf("getDepPath after rename = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(".deps", "jsonlib")); err != nil {
+		t.Errorf("aliased install moved: %v", err)
+	}
+}
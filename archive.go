@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Archives are recognized by their first bytes rather than by a name or a
+// Content-Type, which mirrors and proxies don't always get right. Gzip and
+// bzip2 are decompressed in process; xz and zstd, which the standard library
+// can't read, go through the xz and zstd commands when they are installed.
+const (
+	formatGzip  = "gzip"
+	formatBzip2 = "bzip2"
+	formatXz    = "xz"
+	formatZstd  = "zstd"
+	formatTar   = "tar" // uncompressed
+	formatZip   = "zip"
+)
+
+// errUnknownArchive is returned for content that is no archive deps knows,
+// like an HTML error page from a proxy
+var errUnknownArchive = errors.New("not a recognized archive (expected zip, or a tar that is uncompressed or compressed with gzip, bzip2, xz or zstd)")
+
+// detectArchive returns the format of the archive r starts with, without
+// consuming anything
+func detectArchive(r *bufio.Reader) (string, error) {
+	// A tar header has its magic at offset 257
+	head, err := r.Peek(262)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", err
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return formatGzip, nil
+	case bytes.HasPrefix(head, []byte("BZh")):
+		return formatBzip2, nil
+	case bytes.HasPrefix(head, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return formatXz, nil
+	case bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return formatZstd, nil
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return formatZip, nil
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return formatTar, nil
+	}
+	return "", errUnknownArchive
+}
+
+// openTarStream returns the uncompressed tar stream of r, whichever way it
+// is compressed. Closing it reports whether decompression succeeded.
+func openTarStream(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	format, err := detectArchive(br)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case formatGzip:
+		return gzip.NewReader(br)
+	case formatBzip2:
+		return io.NopCloser(bzip2.NewReader(br)), nil
+	case formatXz:
+		return decompressCommand(br, "xz", ".tar.xz")
+	case formatZstd:
+		return decompressCommand(br, "zstd", ".tar.zst")
+	case formatTar:
+		return io.NopCloser(br), nil
+	}
+	return nil, fmt.Errorf("expected a tar archive, got a %s archive", format)
+}
+
+// decompressCommand decompresses r, a kind of archive that ext names in
+// messages, through the command name
+func decompressCommand(r io.Reader, name, ext string) (io.ReadCloser, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("extracting a %s archive needs the %s command, which isn't installed", ext, name)
+	}
+	cmd := exec.CommandContext(runContext, path, "-dc")
+	cmd.Stdin = r
+	out := &commandOutput{cmd: cmd}
+	cmd.Stderr = &out.stderr
+	if out.stdout, err = cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// commandOutput reads what a command writes, and waits for it on Close
+type commandOutput struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+}
+
+func (c *commandOutput) Read(p []byte) (int, error) {
+	return c.stdout.Read(p)
+}
+
+func (c *commandOutput) Close() error {
+	io.Copy(io.Discard, c.stdout)
+	if err := c.cmd.Wait(); err != nil {
+		if msg := strings.TrimSpace(c.stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %s", c.cmd.Args[0], msg)
+		}
+		return fmt.Errorf("%s: %v", c.cmd.Args[0], err)
+	}
+	return nil
+}
+
+// extractArchive extracts subdir of the archive read from r into destPath,
+// as extractTarballSubdir does for tarballs. Zip archives, which need
+// random access, are spooled to a temporary file first, and have their
+// single root directory stripped as GitHub's tarballs do.
+func extractArchive(r io.Reader, destPath, subdir string) error {
+	br := bufio.NewReader(r)
+	format, err := detectArchive(br)
+	if err != nil {
+		return err
+	}
+	if format != formatZip {
+		return extractTarballSubdir(br, destPath, subdir)
+	}
+
+	tmpFile, err := createTemp("", "deps-archive-*.zip")
+	if err != nil {
+		return err
+	}
+	defer removeTemp(tmpFile.Name())
+	defer tmpFile.Close()
+	if _, err := io.Copy(tmpFile, br); err != nil {
+		return err
+	}
+	return extractZip(tmpFile.Name(), destPath, subdir, true)
+}
+
+// extractWholeArchive extracts all of the archive read from r into destPath,
+// in any format extractArchive recognizes, without stripping a root
+// directory: an archive from a plain URL has whatever layout it was made with
+func extractWholeArchive(r io.Reader, destPath string) error {
+	br := bufio.NewReader(r)
+	format, err := detectArchive(br)
+	if err != nil {
+		return err
+	}
+	if format != formatZip {
+		return extractTar(br, destPath, "", false)
+	}
+
+	tmpFile, err := createTemp("", "deps-archive-*.zip")
+	if err != nil {
+		return err
+	}
+	defer removeTemp(tmpFile.Name())
+	defer tmpFile.Close()
+	if _, err := io.Copy(tmpFile, br); err != nil {
+		return err
+	}
+	return extractZip(tmpFile.Name(), destPath, "", false)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// compressWith compresses data with a command like "xz -c", skipping the
+// test if it isn't installed
+func compressWith(t *testing.T, data []byte, name string) []byte {
+	t.Helper()
+	if _, err := exec.LookPath(name); err != nil {
+		t.Skipf("%s isn't installed", name)
+	}
+	cmd := exec.Command(name, "-c")
+	cmd.Stdin = bytes.NewReader(data)
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestExtractArchive_Formats(t *testing.T) {
+	files := map[string]string{"src/a.c": "int a;"}
+	gz := makeTarGz(t, "repo-abc1234/", files).Bytes()
+	gzr, err := gzip.NewReader(bytes.NewReader(gz))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, _ := io.ReadAll(gzr)
+
+	archives := map[string]func(t *testing.T) []byte{
+		"gzip":  func(t *testing.T) []byte { return gz },
+		"tar":   func(t *testing.T) []byte { return plain },
+		"zip":   func(t *testing.T) []byte { return makeZip(t, map[string]string{"repo-abc1234/src/a.c": "int a;"}) },
+		"bzip2": func(t *testing.T) []byte { return compressWith(t, plain, "bzip2") },
+		"xz":    func(t *testing.T) []byte { return compressWith(t, plain, "xz") },
+		"zstd":  func(t *testing.T) []byte { return compressWith(t, plain, "zstd") },
+	}
+	for format, archive := range archives {
+		t.Run(format, func(t *testing.T) {
+			cleanup := withTempDir(t)
+			defer cleanup()
+
+			if err := extractArchive(bytes.NewReader(archive(t)), "dest", ""); err != nil {
+				t.Fatalf("extractArchive error: %v", err)
+			}
+			if data, _ := os.ReadFile(filepath.Join("dest", "src", "a.c")); string(data) != "int a;" {
+				t.Errorf("src/a.c = %q", data)
+			}
+		})
+	}
+}
+
+func TestExtractArchive_Unknown(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	err := extractArchive(strings.NewReader("<html>Proxy error</html>"), "dest", "")
+	if !errors.Is(err, errUnknownArchive) {
+		t.Errorf("err = %v, want errUnknownArchive", err)
+	}
+	if !zipballFallback(err) {
+		t.Error("a response that isn't an archive should fall back to the zipball")
+	}
+}
+
+func TestExtractWholeArchive(t *testing.T) {
+	var plain bytes.Buffer
+	tw := tar.NewWriter(&plain)
+	for name, content := range map[string]string{"./bin/tool": "#!/bin/sh", "README": "read me"} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0755, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+
+	archives := map[string][]byte{
+		"tar": plain.Bytes(),
+		"zip": makeZip(t, map[string]string{"bin/tool": "#!/bin/sh", "README": "read me"}),
+	}
+	for format, archive := range archives {
+		t.Run(format, func(t *testing.T) {
+			cleanup := withTempDir(t)
+			defer cleanup()
+
+			// Nothing is taken for a root directory to strip
+			if err := extractWholeArchive(bytes.NewReader(archive), "dest"); err != nil {
+				t.Fatalf("extractWholeArchive error: %v", err)
+			}
+			for name, want := range map[string]string{"bin/tool": "#!/bin/sh", "README": "read me"} {
+				if data, _ := os.ReadFile(filepath.Join("dest", filepath.FromSlash(name))); string(data) != want {
+					t.Errorf("%s = %q, want %q", name, data, want)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractArchive_MissingCommand(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	t.Setenv("PATH", "")
+
+	xz := append([]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, make([]byte, 512)...)
+	err := extractArchive(bytes.NewReader(xz), "dest", "")
+	if err == nil || !strings.Contains(err.Error(), "needs the xz command, which isn't installed") {
+		t.Errorf("err = %v, want one saying xz isn't installed", err)
+	}
+}
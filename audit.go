@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// deps audit looks up every locked commit in OSV (osv.dev), whose advisories
+// for a repository record the commits each vulnerability was introduced and
+// fixed in. Asking by commit rather than by version works for branches and
+// bare SHAs as well as tags, and needs no mapping to a package ecosystem.
+
+// osvAPIBaseURL is the OSV API
+var osvAPIBaseURL = "https://api.osv.dev"
+
+// osvBatchSize is the most queries OSV takes in one batch
+const osvBatchSize = 1000
+
+// vulnerability is a known vulnerability of a dependency, as reported
+type vulnerability struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases,omitempty"`
+	Summary  string   `json:"summary,omitempty"`
+	Severity string   `json:"severity"`
+	Fixed    []string `json:"fixed,omitempty"` // commits or versions that fix it
+}
+
+// osvVuln is the subset of an OSV vulnerability record we use
+type osvVuln struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases"`
+	Summary  string   `json:"summary"`
+	Severity []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity"`
+	Affected []struct {
+		Ranges []struct {
+			Type   string              `json:"type"`
+			Repo   string              `json:"repo"`
+			Events []map[string]string `json:"events"`
+		} `json:"ranges"`
+	} `json:"affected"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+// auditDependencies returns the vulnerabilities OSV knows of for each locked
+// commit of lockFile, by URL. Dependencies without any are left out, as are
+// URL sources, which have no commit to look up.
+func auditDependencies(lockFile *LockFile) (map[string][]vulnerability, error) {
+	var repoURLs []string
+	for _, repoURL := range sortedKeys(lockFile.Dependencies) {
+		if !isURLSource(repoURL) {
+			repoURLs = append(repoURLs, repoURL)
+		}
+	}
+	ids := make(map[string][]string)
+	for start := 0; start < len(repoURLs); start += osvBatchSize {
+		batch := repoURLs[start:min(start+osvBatchSize, len(repoURLs))]
+		shas := make([]string, len(batch))
+		for i, repoURL := range batch {
+			shas[i] = lockFile.Dependencies[repoURL].SHA
+		}
+		found, err := queryOSVCommits(shas)
+		if err != nil {
+			return nil, err
+		}
+		for i, repoURL := range batch {
+			if len(found[i]) > 0 {
+				ids[repoURL] = found[i]
+			}
+		}
+	}
+
+	// A vulnerability affecting several dependencies is fetched once
+	records := make(map[string]osvVuln)
+	findings := make(map[string][]vulnerability)
+	for _, repoURL := range repoURLs {
+		for _, id := range ids[repoURL] {
+			record, ok := records[id]
+			if !ok {
+				var err error
+				if record, err = getOSVVuln(id); err != nil {
+					return nil, fmt.Errorf("%s: %v", id, err)
+				}
+				records[id] = record
+			}
+			findings[repoURL] = append(findings[repoURL], record.vulnerability(repoURL))
+		}
+	}
+	return findings, nil
+}
+
+// vulnerability summarizes the record for the dependency at repoURL. Fixes
+// in the git ranges of other repositories, like forks, are left out.
+func (v osvVuln) vulnerability(repoURL string) vulnerability {
+	found := vulnerability{ID: v.ID, Aliases: v.Aliases, Summary: v.Summary, Severity: v.severity()}
+	remote, _ := splitSubdir(repoURL)
+	seen := make(map[string]bool)
+	for _, affected := range v.Affected {
+		for _, r := range affected.Ranges {
+			if r.Type == "GIT" && r.Repo != "" && !strings.EqualFold(osvRepoKey(r.Repo), remote) {
+				continue
+			}
+			for _, event := range r.Events {
+				if fixed := event["fixed"]; fixed != "" && !seen[fixed] {
+					seen[fixed] = true
+					found.Fixed = append(found.Fixed, fixed)
+				}
+			}
+		}
+	}
+	return found
+}
+
+// severity is the record's severity rating, like "HIGH", or failing that
+// its CVSS vector, or "unknown"
+func (v osvVuln) severity() string {
+	if v.DatabaseSpecific.Severity != "" {
+		return strings.ToUpper(v.DatabaseSpecific.Severity)
+	}
+	for _, severity := range v.Severity {
+		if severity.Score != "" {
+			return severity.Score
+		}
+	}
+	return "unknown"
+}
+
+// osvRepoKey returns a repository URL in an OSV range, like
+// "https://github.com/owner/repo.git" or "git@github.com:owner/repo", as a
+// lock key writes it, so it can be compared with a dependency's. Azure DevOps
+// URLs on the older org.visualstudio.com host are moved to dev.azure.com.
+func osvRepoKey(repoURL string) string {
+	rest, found := "", false
+	for _, prefix := range []string{"https://", "http://", "git://", "ssh://"} {
+		if rest, found = strings.CutPrefix(repoURL, prefix); found {
+			break
+		}
+	}
+	if !found {
+		// scp-like SSH syntax, user@host:path
+		rest = strings.Replace(repoURL, ":", "/", 1)
+	}
+	host, path, _ := strings.Cut(rest, "/")
+	if _, after, found := strings.Cut(host, "@"); found {
+		host = after
+	}
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = unescaped
+	}
+	path = strings.TrimSuffix(strings.TrimSuffix(path, "/"), ".git")
+	if org, found := strings.CutSuffix(strings.ToLower(host), ".visualstudio.com"); found {
+		host, path = "dev.azure.com", org+"/"+strings.TrimPrefix(path, "DefaultCollection/")
+	}
+	return host + "/" + path
+}
+
+// osvQuery asks OSV about one commit, starting at the page of results that
+// PageToken names
+type osvQuery struct {
+	Commit    string `json:"commit"`
+	PageToken string `json:"page_token,omitempty"`
+}
+
+// osvBatchResult is OSV's answer to one query of a batch. A commit with more
+// vulnerabilities than fit in one page has NextPageToken set.
+type osvBatchResult struct {
+	Vulns []struct {
+		ID string `json:"id"`
+	} `json:"vulns"`
+	NextPageToken string `json:"next_page_token"`
+}
+
+// queryOSVCommits returns the IDs of the vulnerabilities of each commit.
+// Commits with more than a page of them are asked about again, with the
+// token of their next page, until every page has been read.
+func queryOSVCommits(shas []string) ([][]string, error) {
+	ids := make([][]string, len(shas))
+	queries := make([]osvQuery, len(shas))
+	pending := make([]int, len(shas)) // indexes of the commits still to read
+	for i, sha := range shas {
+		queries[i] = osvQuery{Commit: sha}
+		pending[i] = i
+	}
+	for len(pending) > 0 {
+		batch := make([]osvQuery, len(pending))
+		for j, i := range pending {
+			batch[j] = queries[i]
+		}
+		results, err := queryOSVBatch(batch)
+		if err != nil {
+			return nil, err
+		}
+		var next []int
+		for j, result := range results {
+			i := pending[j]
+			for _, vuln := range result.Vulns {
+				ids[i] = append(ids[i], vuln.ID)
+			}
+			if result.NextPageToken == "" {
+				continue
+			}
+			if result.NextPageToken == queries[i].PageToken {
+				return nil, fmt.Errorf("OSV returned the same page of results twice for %s", shas[i])
+			}
+			queries[i].PageToken = result.NextPageToken
+			next = append(next, i)
+		}
+		pending = next
+	}
+	return ids, nil
+}
+
+// queryOSVBatch sends queries to OSV in one batch, returning a result for
+// each in order
+func queryOSVBatch(queries []osvQuery) ([]osvBatchResult, error) {
+	body, err := json.Marshal(struct {
+		Queries []osvQuery `json:"queries"`
+	}{queries})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Post(osvAPIBaseURL+"/v1/querybatch", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, &statusError{Service: "OSV", StatusCode: resp.StatusCode}
+	}
+
+	var response struct {
+		Results []osvBatchResult `json:"results"`
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Results) != len(queries) {
+		return nil, fmt.Errorf("OSV returned %d results for %d queries", len(response.Results), len(queries))
+	}
+	return response.Results, nil
+}
+
+// getOSVVuln fetches the OSV record of the vulnerability id
+func getOSVVuln(id string) (osvVuln, error) {
+	resp, err := httpClient.Get(osvAPIBaseURL + "/v1/vulns/" + id)
+	if err != nil {
+		return osvVuln{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return osvVuln{}, &statusError{Service: "OSV", StatusCode: resp.StatusCode}
+	}
+
+	var record osvVuln
+	if err := json.NewDecoder(resp.Body).Decode(&record); err != nil {
+		return osvVuln{}, err
+	}
+	return record, nil
+}
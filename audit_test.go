@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAuditDependencies(t *testing.T) {
+	const vulnerable = "1111111111111111111111111111111111111111"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/querybatch", func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Queries []struct {
+				Commit string `json:"commit"`
+			} `json:"queries"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		var results []map[string]any
+		for _, query := range request.Queries {
+			result := map[string]any{}
+			if query.Commit == vulnerable {
+				result["vulns"] = []map[string]string{{"id": "GHSA-aaaa"}, {"id": "OSV-2024-1"}}
+			}
+			results = append(results, result)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"results": results})
+	})
+	mux.HandleFunc("/v1/vulns/GHSA-aaaa", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "GHSA-aaaa", "summary": "Buffer overflow", "database_specific": {"severity": "high"},
+			"affected": [{"ranges": [
+				{"type": "GIT", "repo": "https://github.com/user/lib", "events": [{"introduced": "0"}, {"fixed": "2222222222222222222222222222222222222222"}]},
+				{"type": "GIT", "repo": "https://github.com/fork/lib", "events": [{"introduced": "0"}, {"fixed": "3333333333333333333333333333333333333333"}]},
+				{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "1.2.4"}]}
+			]}]}`))
+	})
+	mux.HandleFunc("/v1/vulns/OSV-2024-1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "OSV-2024-1", "severity": [{"type": "CVSS_V3", "score": "CVSS:3.1/AV:N"}]}`))
+	})
+	restore := testGitHubServer(t, mux)
+	defer restore()
+	origBase := osvAPIBaseURL
+	osvAPIBaseURL = githubAPIBaseURL
+	defer func() { osvAPIBaseURL = origBase }()
+
+	findings, err := auditDependencies(&LockFile{Dependencies: map[string]Dependency{
+		"github.com/user/lib":  {Ref: "v1.2.3", SHA: vulnerable},
+		"github.com/user/safe": {Ref: "main", SHA: "4444444444444444444444444444444444444444"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 {
+		t.Fatalf("findings = %+v, want only github.com/user/lib", findings)
+	}
+	vulns := findings["github.com/user/lib"]
+	if len(vulns) != 2 {
+		t.Fatalf("vulnerabilities = %+v", vulns)
+	}
+	if vulns[0].ID != "GHSA-aaaa" || vulns[0].Severity != "HIGH" || vulns[0].Summary != "Buffer overflow" {
+		t.Errorf("vulnerabilities[0] = %+v", vulns[0])
+	}
+	if len(vulns[0].Fixed) != 2 || vulns[0].Fixed[0] != "2222222222222222222222222222222222222222" || vulns[0].Fixed[1] != "1.2.4" {
+		t.Errorf("fixed = %v, want the fix in this repository and the release", vulns[0].Fixed)
+	}
+	if vulns[1].Severity != "CVSS:3.1/AV:N" || len(vulns[1].Fixed) != 0 {
+		t.Errorf("vulnerabilities[1] = %+v", vulns[1])
+	}
+}
+
+func TestAuditDependencies_Error(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/querybatch", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	restore := testGitHubServer(t, mux)
+	defer restore()
+	origBase := osvAPIBaseURL
+	osvAPIBaseURL = githubAPIBaseURL
+	defer func() { osvAPIBaseURL = origBase }()
+
+	_, err := auditDependencies(&LockFile{Dependencies: map[string]Dependency{
+		"github.com/user/lib": {Ref: "main", SHA: "1111111111111111111111111111111111111111"},
+	}})
+	if err == nil || exitCodeFor(err) != exitNetwork {
+		t.Errorf("err = %v, want a network error", err)
+	}
+}
+
+func TestAuditDependencies_Paginated(t *testing.T) {
+	const vulnerable = "1111111111111111111111111111111111111111"
+	var batches [][]string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/querybatch", func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Queries []struct {
+				Commit    string `json:"commit"`
+				PageToken string `json:"page_token"`
+			} `json:"queries"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		var batch []string
+		var results []map[string]any
+		for _, query := range request.Queries {
+			batch = append(batch, query.Commit+"@"+query.PageToken)
+			result := map[string]any{}
+			switch {
+			case query.Commit != vulnerable:
+			case query.PageToken == "":
+				result["vulns"] = []map[string]string{{"id": "GHSA-aaaa"}}
+				result["next_page_token"] = "page-2"
+			case query.PageToken == "page-2":
+				result["vulns"] = []map[string]string{{"id": "GHSA-bbbb"}}
+			}
+			results = append(results, result)
+		}
+		batches = append(batches, batch)
+		json.NewEncoder(w).Encode(map[string]any{"results": results})
+	})
+	mux.HandleFunc("/v1/vulns/", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"id": strings.TrimPrefix(r.URL.Path, "/v1/vulns/")})
+	})
+	restore := testGitHubServer(t, mux)
+	defer restore()
+	origBase := osvAPIBaseURL
+	osvAPIBaseURL = githubAPIBaseURL
+	defer func() { osvAPIBaseURL = origBase }()
+
+	findings, err := auditDependencies(&LockFile{Dependencies: map[string]Dependency{
+		"github.com/user/lib":  {Ref: "v1.2.3", SHA: vulnerable},
+		"github.com/user/safe": {Ref: "main", SHA: "4444444444444444444444444444444444444444"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vulns := findings["github.com/user/lib"]
+	if len(vulns) != 2 || vulns[0].ID != "GHSA-aaaa" || vulns[1].ID != "GHSA-bbbb" {
+		t.Errorf("vulnerabilities = %+v, want both pages", vulns)
+	}
+	// Only the commit with another page is asked about again
+	if len(batches) != 2 || len(batches[1]) != 1 || batches[1][0] != vulnerable+"@page-2" {
+		t.Errorf("batches = %v", batches)
+	}
+}
+
+func TestAuditDependencies_Azure(t *testing.T) {
+	const vulnerable = "1111111111111111111111111111111111111111"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/querybatch", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": [{"vulns": [{"id": "OSV-2024-2"}]}]}`))
+	})
+	mux.HandleFunc("/v1/vulns/OSV-2024-2", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "OSV-2024-2", "affected": [{"ranges": [
+			{"type": "GIT", "repo": "https://dev.azure.com/org/My%20Project/_git/lib", "events": [{"introduced": "0"}, {"fixed": "2222222222222222222222222222222222222222"}]},
+			{"type": "GIT", "repo": "https://github.com/org/lib", "events": [{"introduced": "0"}, {"fixed": "3333333333333333333333333333333333333333"}]}
+		]}]}`))
+	})
+	restore := testGitHubServer(t, mux)
+	defer restore()
+	origBase := osvAPIBaseURL
+	osvAPIBaseURL = githubAPIBaseURL
+	defer func() { osvAPIBaseURL = origBase }()
+
+	repoURL := "dev.azure.com/org/My Project/_git/lib//src"
+	findings, err := auditDependencies(&LockFile{Dependencies: map[string]Dependency{
+		repoURL: {Ref: "main", SHA: vulnerable},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vulns := findings[repoURL]
+	if len(vulns) != 1 || len(vulns[0].Fixed) != 1 || vulns[0].Fixed[0] != "2222222222222222222222222222222222222222" {
+		t.Errorf("vulnerabilities = %+v, want only the fix in the Azure DevOps repository", vulns)
+	}
+}
+
+func TestOSVRepoKey(t *testing.T) {
+	tests := map[string]string{
+		"https://github.com/owner/repo":                           "github.com/owner/repo",
+		"https://github.com/owner/repo.git/":                      "github.com/owner/repo",
+		"git://github.com/owner/repo":                             "github.com/owner/repo",
+		"git@github.com:owner/repo.git":                           "github.com/owner/repo",
+		"https://org@dev.azure.com/org/My%20Project/_git/lib":     "dev.azure.com/org/My Project/_git/lib",
+		"https://org.visualstudio.com/Project/_git/lib":           "dev.azure.com/org/Project/_git/lib",
+		"https://org.visualstudio.com/DefaultCollection/P/_git/r": "dev.azure.com/org/P/_git/r",
+	}
+	for repoURL, want := range tests {
+		if got := osvRepoKey(repoURL); got != want {
+			t.Errorf("osvRepoKey(%q) = %q, want %q", repoURL, got, want)
+		}
+	}
+}
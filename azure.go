@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var azureAPIBaseURL = "https://dev.azure.com"
+
+const azureAPIVersion = "7.0"
+
+type AzureRepo struct {
+	DefaultBranch string `json:"defaultBranch"`
+}
+
+type AzureRefs struct {
+	Value []AzureRef `json:"value"`
+}
+
+type AzureRef struct {
+	Name           string `json:"name"`
+	ObjectID       string `json:"objectId"`
+	PeeledObjectID string `json:"peeledObjectId"`
+}
+
+func isAzureURL(url string) bool {
+	return strings.HasPrefix(url, "dev.azure.com/")
+}
+
+// parseAzureURL parses a dev.azure.com/org/project/_git/repo URL, ignoring
+// any "//subdir" suffix or "#name" entry name
+func parseAzureURL(url string) (org, project, repo string, err error) {
+	url, subdir := splitSubdir(url)
+	if err := validateSubdir(subdir); err != nil {
+		return "", "", "", err
+	}
+
+	re := regexp.MustCompile(`^dev\.azure\.com/([^/]+)/([^/]+)/_git/([^/]+)/?$`)
+	matches := re.FindStringSubmatch(url)
+	if len(matches) != 4 {
+		return "", "", "", fmt.Errorf("invalid Azure DevOps URL format")
+	}
+	return matches[1], matches[2], matches[3], nil
+}
+
+func azureRepoAPIURL(org, project, repo string) string {
+	return fmt.Sprintf("%s/%s/%s/_apis/git/repositories/%s", azureAPIBaseURL, url.PathEscape(org), url.PathEscape(project), url.PathEscape(repo))
+}
+
+// azureGet performs an authenticated GET against the Azure DevOps API.
+// DEPS_AZURE_TOKEN holds a personal access token for private projects.
+func azureGet(apiURL string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv("DEPS_AZURE_TOKEN"); token != "" {
+		req.SetBasicAuth("", token)
+	}
+	return httpClient.Do(req)
+}
+
+func azureGetJSON(apiURL string, v interface{}) error {
+	resp, err := azureGet(apiURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return &statusError{Service: "Azure DevOps API", StatusCode: resp.StatusCode}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+func getAzureRepoInfo(org, project, repo string) (AzureRepo, error) {
+	var repoInfo AzureRepo
+	err := azureGetJSON(fmt.Sprintf("%s?api-version=%s", azureRepoAPIURL(org, project, repo), azureAPIVersion), &repoInfo)
+	return repoInfo, err
+}
+
+func resolveAzureRef(org, project, repo, ref string) (sha, resolvedRef string, err error) {
+	if ref == "" {
+		repoInfo, err := getAzureRepoInfo(org, project, repo)
+		if err != nil {
+			return "", "", err
+		}
+		branch := strings.TrimPrefix(repoInfo.DefaultBranch, "refs/heads/")
+		if branch == "" {
+			return "", "", fmt.Errorf("could not determine default branch")
+		}
+		sha, err = getAzureRefSHA(org, project, repo, "heads/"+branch)
+		if err != nil {
+			return "", "", err
+		}
+		return sha, branch, nil
+	}
+
+	if isFullSHA(ref) {
+		return ref, ref, nil
+	}
+
+	// Try as a branch first, then as a tag
+	if sha, err = getAzureRefSHA(org, project, repo, "heads/"+ref); err == nil {
+		return sha, ref, nil
+	}
+	if sha, err = getAzureRefSHA(org, project, repo, "tags/"+ref); err == nil {
+		return sha, ref, nil
+	}
+
+	return "", "", fmt.Errorf("could not resolve ref '%s' as branch or tag", ref)
+}
+
+// getAzureRefSHA returns the commit SHA for a ref like "heads/main" or
+// "tags/v1.0.0", peeling annotated tags
+func getAzureRefSHA(org, project, repo, name string) (string, error) {
+	apiURL := fmt.Sprintf("%s/refs?filter=%s&peelTags=true&api-version=%s",
+		azureRepoAPIURL(org, project, repo), url.QueryEscape(name), azureAPIVersion)
+
+	var refs AzureRefs
+	err := azureGetJSON(apiURL, &refs)
+	if err != nil {
+		return "", err
+	}
+
+	// The filter is a prefix match, so look for the exact ref
+	for _, ref := range refs.Value {
+		if ref.Name != "refs/"+name {
+			continue
+		}
+		if ref.PeeledObjectID != "" {
+			return ref.PeeledObjectID, nil
+		}
+		return ref.ObjectID, nil
+	}
+
+	return "", fmt.Errorf("ref %s not found", name)
+}
+
+// listAzureTags returns all tags of a repo with the commits they point to
+func listAzureTags(org, project, repo string) ([]tagInfo, error) {
+	return listAzureRefs(org, project, repo, "tags/")
+}
+
+// listAzureBranches returns all branches of a repo with their head commits
+func listAzureBranches(org, project, repo string) ([]tagInfo, error) {
+	return listAzureRefs(org, project, repo, "heads/")
+}
+
+// listAzureRefs returns the refs under prefix (e.g. "tags/"), peeling
+// annotated tags
+func listAzureRefs(org, project, repo, prefix string) ([]tagInfo, error) {
+	apiURL := fmt.Sprintf("%s/refs?filter=%s&peelTags=true&api-version=%s", azureRepoAPIURL(org, project, repo), url.QueryEscape(prefix), azureAPIVersion)
+
+	var refs AzureRefs
+	err := azureGetJSON(apiURL, &refs)
+	if err != nil {
+		return nil, err
+	}
+
+	var named []tagInfo
+	for _, ref := range refs.Value {
+		sha := ref.ObjectID
+		if ref.PeeledObjectID != "" {
+			sha = ref.PeeledObjectID
+		}
+		named = append(named, tagInfo{Name: strings.TrimPrefix(ref.Name, "refs/"+prefix), SHA: sha})
+	}
+	return named, nil
+}
+
+// azureArchiveURL returns the API URL of the zip archive of a repo at sha
+func azureArchiveURL(org, project, repo, sha string) string {
+	return fmt.Sprintf("%s/items?path=/&versionDescriptor.version=%s&versionDescriptor.versionType=commit&$format=zip&download=true&api-version=%s",
+		azureRepoAPIURL(org, project, repo), sha, azureAPIVersion)
+}
+
+// downloadAzureRepo downloads the zip archive of the repo at sha and extracts
+// it into the dependency directory, returning the SHA-256 of the archive
+func downloadAzureRepo(org, project, repo, sha, repoURL string) (string, error) {
+	err := os.MkdirAll(depsDir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := azureGet(azureArchiveURL(org, project, repo, sha))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", &statusError{Service: "Azure DevOps API", StatusCode: resp.StatusCode}
+	}
+
+	// Zip extraction needs random access, so spool the archive to disk
+	tmpFile, err := createTemp("", "deps-azure-*.zip")
+	if err != nil {
+		return "", err
+	}
+	defer removeTemp(tmpFile.Name())
+	defer tmpFile.Close()
+
+	p := startProgress(org+"/"+repo, resp.ContentLength)
+	defer p.finish()
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmpFile, hasher), p.reader(resp.Body))
+	if err != nil {
+		return "", err
+	}
+
+	depPath := getDepPath(repoURL)
+	_, subdir := splitSubdir(repoURL)
+	err = extractZip(tmpFile.Name(), depPath, subdir, false)
+	if err != nil {
+		return "", err
+	}
+
+	infof("Downloaded to %s\n", depPath)
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testAzureServer creates a mock Azure DevOps API server and configures the
+// package globals to use it. Returns a cleanup function that must be deferred.
+func testAzureServer(t *testing.T, handler http.Handler) func() {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+
+	origClient := httpClient
+	origBase := azureAPIBaseURL
+
+	httpClient = srv.Client()
+	azureAPIBaseURL = srv.URL
+
+	return func() {
+		srv.Close()
+		httpClient = origClient
+		azureAPIBaseURL = origBase
+	}
+}
+
+// makeZip creates an in-memory zip archive with the given files
+func makeZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+// --- parseAzureURL tests ---
+
+func TestParseAzureURL_Valid(t *testing.T) {
+	org, project, repo, err := parseAzureURL("dev.azure.com/myorg/My Project/_git/my-repo//src")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if org != "myorg" || project != "My Project" || repo != "my-repo" {
+		t.Errorf("got %q %q %q", org, project, repo)
+	}
+}
+
+func TestParseAzureURL_Invalid(t *testing.T) {
+	tests := []string{
+		"dev.azure.com/myorg/project/repo",
+		"dev.azure.com/myorg/_git/repo",
+		"github.com/user/repo",
+	}
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			if _, _, _, err := parseAzureURL(input); err == nil {
+				t.Errorf("expected error for %q, got nil", input)
+			}
+		})
+	}
+}
+
+// --- resolveAzureRef tests ---
+
+func azureRefsHandler(refs string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, refs)
+	}
+}
+
+func TestResolveAzureRef_DefaultBranch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/org/proj/_apis/git/repositories/repo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"defaultBranch":"refs/heads/main"}`)
+	})
+	mux.HandleFunc("/org/proj/_apis/git/repositories/repo/refs", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("filter") != "heads/main" {
+			w.WriteHeader(404)
+			return
+		}
+		fmt.Fprint(w, `{"value":[{"name":"refs/heads/main","objectId":"abc123def456abc123def456abc123def456abc1"}]}`)
+	})
+
+	cleanup := testAzureServer(t, mux)
+	defer cleanup()
+
+	sha, ref, err := resolveAzureRef("org", "proj", "repo", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ref != "main" || sha != "abc123def456abc123def456abc123def456abc1" {
+		t.Errorf("got (%q, %q)", sha, ref)
+	}
+}
+
+func TestResolveAzureRef_ExactMatchAndPeeledTag(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/org/proj/_apis/git/repositories/repo/refs", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("filter") {
+		case "heads/v1":
+			// Prefix match returns a similarly named branch only
+			fmt.Fprint(w, `{"value":[{"name":"refs/heads/v1-maintenance","objectId":"1111222233334444555566667777888899990000"}]}`)
+		case "tags/v1":
+			fmt.Fprint(w, `{"value":[{"name":"refs/tags/v1","objectId":"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa","peeledObjectId":"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}]}`)
+		}
+	})
+
+	cleanup := testAzureServer(t, mux)
+	defer cleanup()
+
+	sha, ref, err := resolveAzureRef("org", "proj", "repo", "v1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ref != "v1" || sha != "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb" {
+		t.Errorf("got (%q, %q), want peeled tag commit", sha, ref)
+	}
+}
+
+func TestResolveAzureRef_NotFound(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/org/proj/_apis/git/repositories/repo/refs", azureRefsHandler(`{"value":[]}`))
+
+	cleanup := testAzureServer(t, mux)
+	defer cleanup()
+
+	if _, _, err := resolveAzureRef("org", "proj", "repo", "nope"); err == nil {
+		t.Error("expected error for unknown ref, got nil")
+	}
+}
+
+func TestListAzureBranches(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/org/proj/_apis/git/repositories/repo/refs", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("filter") != "heads/" {
+			t.Errorf("filter = %q, want heads/", r.URL.Query().Get("filter"))
+		}
+		fmt.Fprint(w, `{"value":[{"name":"refs/heads/main","objectId":"1111222233334444555566667777888899990000"}]}`)
+	})
+
+	cleanup := testAzureServer(t, mux)
+	defer cleanup()
+
+	branches, err := listAzureBranches("org", "proj", "repo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(branches) != 1 || branches[0].Name != "main" {
+		t.Errorf("branches = %+v", branches)
+	}
+}
+
+func TestAzureGet_UsesToken(t *testing.T) {
+	t.Setenv("DEPS_AZURE_TOKEN", "secret")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/org/proj/_apis/git/repositories/repo/refs", func(w http.ResponseWriter, r *http.Request) {
+		if _, pass, ok := r.BasicAuth(); !ok || pass != "secret" {
+			w.WriteHeader(401)
+			return
+		}
+		fmt.Fprint(w, `{"value":[{"name":"refs/heads/main","objectId":"abc123def456abc123def456abc123def456abc1"}]}`)
+	})
+
+	cleanup := testAzureServer(t, mux)
+	defer cleanup()
+
+	if _, err := getAzureRefSHA("org", "proj", "repo", "heads/main"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// --- downloadAzureRepo tests ---
+
+func TestDownloadAzureRepo(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	sha := "abc123def456abc123def456abc123def456abc1"
+	archive := makeZip(t, map[string]string{
+		"README.md":  "# Azure",
+		"src/lib.cs": "class Lib {}",
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/org/proj/_apis/git/repositories/repo/items", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("versionDescriptor.version") != sha {
+			w.WriteHeader(404)
+			return
+		}
+		w.Write(archive)
+	})
+
+	restore := testAzureServer(t, mux)
+	defer restore()
+
+	repoURL := "dev.azure.com/org/proj/_git/repo"
+	hash, err := fetchDependency(repoURL, Dependency{Ref: "main", SHA: sha})
+	if err != nil {
+		t.Fatalf("fetchDependency error: %v", err)
+	}
+	if hash == "" {
+		t.Error("expected archive hash")
+	}
+
+	data, err := os.ReadFile(filepath.Join(getDepPath(repoURL), "src", "lib.cs"))
+	if err != nil {
+		t.Fatalf("extracted file not found: %v", err)
+	}
+	if string(data) != "class Lib {}" {
+		t.Errorf("content = %q", string(data))
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bandwidth is shared by every download, so together they stay under
+// --max-rate however many run at once. It is nil when there is no limit.
+var bandwidth *bandwidthLimiter
+
+// bandwidthLimiter spaces out reads to average rate bytes per second
+type bandwidthLimiter struct {
+	mu   sync.Mutex
+	rate float64
+	next time.Time // when what has been read so far is paid for
+}
+
+// take accounts for n bytes read and returns how long to wait before
+// reading more. Time left unused isn't saved up, so a pause doesn't allow a
+// burst afterwards.
+func (l *bandwidthLimiter) take(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	return l.next.Sub(now)
+}
+
+// chunk is how much one read may take, a tenth of a second's worth, so
+// reads stay small enough for the rate to be smooth
+func (l *bandwidthLimiter) chunk() int {
+	return max(1024, int(l.rate/10))
+}
+
+// configureMaxRate limits download bandwidth to rate (--max-rate), or else
+// the max-rate setting (or DEPS_MAX_RATE), like "2M" for 2 MiB a second.
+// Like retries, it wraps the base transport.
+func configureMaxRate(rate string) error {
+	origin := "--max-rate"
+	if rate == "" {
+		rate, origin = configLookup("max-rate")
+	}
+	bandwidth = nil
+	if rate == "" {
+		return nil
+	}
+	limit, err := parseRate(rate)
+	if err != nil {
+		return fmt.Errorf("%v in %s", err, origin)
+	}
+	if limit == 0 {
+		return nil
+	}
+	bandwidth = &bandwidthLimiter{rate: float64(limit)}
+
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client := *httpClient
+	client.Transport = &throttleTransport{base: base}
+	httpClient = &client
+	return nil
+}
+
+// parseRate reads a bandwidth like "500K", "2M" or "2MB/s", in bytes a
+// second; 0 is no limit
+func parseRate(s string) (int64, error) {
+	n, err := parseSize(strings.TrimSuffix(strings.TrimSpace(s), "/s"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid max-rate %q (expected a rate like 500K or 2M, in bytes a second)", s)
+	}
+	return n, nil
+}
+
+func validateMaxRate(rate string) error {
+	_, err := parseRate(rate)
+	return err
+}
+
+// throttleTransport reads response bodies no faster than bandwidth allows
+type throttleTransport struct {
+	base http.RoundTripper
+}
+
+func (t *throttleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && bandwidth != nil {
+		resp.Body = &throttledBody{ReadCloser: resp.Body, limiter: bandwidth}
+	}
+	return resp, err
+}
+
+// throttledBody is a response body read under a bandwidth limit
+type throttledBody struct {
+	io.ReadCloser
+	limiter *bandwidthLimiter
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	if chunk := b.limiter.chunk(); len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		sleep(b.limiter.take(n))
+	}
+	return n, err
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	for input, want := range map[string]int64{"0": 0, "500K": 500 << 10, "2M": 2 << 20, "2MB/s": 2 << 20, "1024": 1024} {
+		got, err := parseRate(input)
+		if err != nil || got != want {
+			t.Errorf("parseRate(%q) = %d, %v; want %d", input, got, err, want)
+		}
+	}
+	if _, err := parseRate("fast"); err == nil {
+		t.Error("parseRate should reject a rate that isn't a size")
+	}
+}
+
+func TestBandwidthLimiter(t *testing.T) {
+	limiter := &bandwidthLimiter{rate: 1000}
+	if d := limiter.take(500); d < 490*time.Millisecond || d > 500*time.Millisecond {
+		t.Errorf("first take = %s, want about 500ms", d)
+	}
+	// Reads that haven't been waited for yet add up
+	if d := limiter.take(500); d < 990*time.Millisecond || d > time.Second {
+		t.Errorf("second take = %s, want about 1s", d)
+	}
+}
+
+func TestConfigureMaxRate(t *testing.T) {
+	origClient := httpClient
+	t.Cleanup(func() {
+		httpClient = origClient
+		bandwidth = nil
+	})
+	// With sleep stubbed out no time passes, so the last wait is how long
+	// everything read should have taken
+	var slept time.Duration
+	origSleep := sleep
+	sleep = func(d time.Duration) { slept = d }
+	t.Cleanup(func() { sleep = origSleep })
+
+	body := bytes.Repeat([]byte("x"), 64<<10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	if err := configureMaxRate("32K"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := httpClient.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || !bytes.Equal(data, body) {
+		t.Fatalf("read %d bytes, %v; want the whole body", len(data), err)
+	}
+	if slept < 1900*time.Millisecond || slept > 2*time.Second {
+		t.Errorf("slept %s, want about 2s for 64K at 32K a second", slept)
+	}
+
+	if err := configureMaxRate("lots"); err == nil || err.Error() != `invalid max-rate "lots" (expected a rate like 500K or 2M, in bytes a second) in --max-rate` {
+		t.Errorf("configureMaxRate(\"lots\") = %v", err)
+	}
+}
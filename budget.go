@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+)
+
+// A size budget is the most a dependency's installed files may add up to,
+// from its max_size in the lock file or, for every dependency without one,
+// the max-dep-size setting. It catches an update, or a mistyped repository,
+// that would bring in far more than expected. Going over fails the install,
+// which puts back the previous one, unless the oversize setting is warn.
+
+// Settings of oversize
+const (
+	oversizeFail = "fail"
+	oversizeWarn = "warn"
+)
+
+// defaultMaxSize is the budget of dependencies without max_size, or 0 for
+// none, and oversizeAction what going over does, set by configureSizeBudget
+var (
+	defaultMaxSize int64
+	oversizeAction = oversizeFail
+)
+
+// configureSizeBudget reads the max-dep-size and oversize settings (or
+// DEPS_MAX_DEP_SIZE and DEPS_OVERSIZE)
+func configureSizeBudget() error {
+	defaultMaxSize, oversizeAction = 0, oversizeFail
+	if value, origin := configLookup("max-dep-size"); value != "" {
+		size, err := parseSize(value)
+		if err != nil {
+			return fmt.Errorf("%v in %s", err, origin)
+		}
+		defaultMaxSize = size
+	}
+	if value, origin := configLookup("oversize"); value != "" {
+		if err := validateOversize(value); err != nil {
+			return fmt.Errorf("%v in %s", err, origin)
+		}
+		oversizeAction = value
+	}
+	return nil
+}
+
+func validateMaxDepSize(size string) error {
+	_, err := parseSize(size)
+	return err
+}
+
+func validateOversize(action string) error {
+	if action != oversizeFail && action != oversizeWarn {
+		return fmt.Errorf("invalid oversize %q (expected fail or warn)", action)
+	}
+	return nil
+}
+
+// sizeBudget returns the budget of dep, or 0 if it has none
+func sizeBudget(dep Dependency) (int64, error) {
+	if dep.MaxSize == "" {
+		return defaultMaxSize, nil
+	}
+	size, err := parseSize(dep.MaxSize)
+	if err != nil {
+		return 0, fmt.Errorf("max_size: %v", err)
+	}
+	return size, nil
+}
+
+// sizeBudgetError is an install that went over its size budget
+type sizeBudgetError struct {
+	Size   int64
+	Budget int64
+}
+
+func (e *sizeBudgetError) Error() string {
+	return fmt.Sprintf("%s installed is over the size budget of %s (raise max_size, or max-dep-size, to allow it)", formatSize(e.Size), formatSize(e.Budget))
+}
+
+// checkSizeBudget measures the files just installed for dep at repoURL
+// against its budget. Over it, that is an error, or with oversize set to
+// warn, a warning.
+func checkSizeBudget(repoURL string, dep Dependency) error {
+	budget, err := sizeBudget(dep)
+	if err != nil || budget == 0 {
+		return err
+	}
+	size, err := dirSize(getDepPath(repoURL))
+	if err != nil {
+		return fmt.Errorf("measuring installed files: %v", err)
+	}
+	if size <= budget {
+		return nil
+	}
+	if oversizeAction == oversizeWarn {
+		warnf("%s %s: %s installed is over its size budget of %s\n", colorize(colorYellow, "!"), repoURL, formatSize(size), formatSize(budget))
+		return nil
+	}
+	return &sizeBudgetError{Size: size, Budget: budget}
+}
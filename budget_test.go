@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckSizeBudget(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	defer func() { defaultMaxSize, oversizeAction = 0, oversizeFail }()
+
+	repoURL := "github.com/user/repo"
+	writeTree(t, filepath.Join(".deps", "github.com", "user", "repo"), map[string]string{"a.txt": "hello", "sub/b.txt": "world!"})
+
+	if err := checkSizeBudget(repoURL, Dependency{}); err != nil {
+		t.Errorf("without a budget: %v", err)
+	}
+	if err := checkSizeBudget(repoURL, Dependency{MaxSize: "11"}); err != nil {
+		t.Errorf("at the budget: %v", err)
+	}
+	var over *sizeBudgetError
+	if err := checkSizeBudget(repoURL, Dependency{MaxSize: "10"}); !errors.As(err, &over) || over.Size != 11 || over.Budget != 10 {
+		t.Errorf("over max_size: err = %v", err)
+	}
+
+	t.Setenv("DEPS_MAX_DEP_SIZE", "8")
+	if err := configureSizeBudget(); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSizeBudget(repoURL, Dependency{}); !errors.As(err, &over) || over.Budget != 8 {
+		t.Errorf("over max-dep-size: err = %v", err)
+	}
+	if err := checkSizeBudget(repoURL, Dependency{MaxSize: "1K"}); err != nil {
+		t.Errorf("max_size should replace max-dep-size: %v", err)
+	}
+
+	t.Setenv("DEPS_OVERSIZE", oversizeWarn)
+	if err := configureSizeBudget(); err != nil {
+		t.Fatal(err)
+	}
+	stdout, _ := captureOutput(t, func() {
+		if err := checkSizeBudget(repoURL, Dependency{}); err != nil {
+			t.Errorf("with oversize warn: %v", err)
+		}
+	})
+	if !strings.Contains(stdout, "over its size budget") {
+		t.Error("expected a warning")
+	}
+
+	t.Setenv("DEPS_OVERSIZE", "ignore")
+	if err := configureSizeBudget(); err == nil {
+		t.Error("expected an error for an invalid oversize")
+	}
+}
+
+func TestValidateDependency_MaxSize(t *testing.T) {
+	dep := Dependency{Ref: "main", SHA: "1111111111111111111111111111111111111111", MaxSize: "lots"}
+	if problems := validateDependency("github.com/owner/repo", dep); len(problems) != 1 {
+		t.Errorf("problems = %q, want one for max_size", problems)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// downloadCache installs dependencies from the extracted trees kept in the
+// user's cache directory, so projects and branches that lock the same commit
+// share one download. It is set by configureDownloadCache.
+var downloadCache bool
+
+// How files are copied out of the download cache
+const (
+	linkAuto     = "auto"     // reflink where the filesystem can, otherwise copy
+	linkReflink  = "reflink"  // copy-on-write clones, failing where unsupported
+	linkHardlink = "hardlink" // share files with the cache; edits change it too
+	linkCopy     = "copy"
+)
+
+// cacheLinkMode is the cache-link setting
+var cacheLinkMode = linkAuto
+
+// configureDownloadCache turns the download cache on unless the
+// download-cache setting is off, linking files out of it as cache-link says
+func configureDownloadCache() error {
+	downloadCache = configValue("download-cache") == "" || configBool("download-cache")
+	cacheLinkMode = linkAuto
+	if value, origin := configLookup("cache-link"); value != "" {
+		if err := validateCacheLink(value); err != nil {
+			return fmt.Errorf("%v in %s", err, origin)
+		}
+		cacheLinkMode = value
+	}
+	return nil
+}
+
+func validateCacheLink(mode string) error {
+	switch mode {
+	case linkAuto, linkReflink, linkHardlink, linkCopy:
+		return nil
+	}
+	return fmt.Errorf("invalid cache-link %q (use %s, %s, %s or %s)", mode, linkAuto, linkReflink, linkHardlink, linkCopy)
+}
+
+// cacheDir returns the root of deps's caches: the cache-dir setting (or
+// DEPS_CACHE_DIR) if set, otherwise a "deps" directory in the user's cache
+// directory
+func cacheDir() (string, error) {
+	if dir := configValue("cache-dir"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "deps"), nil
+}
+
+// cachedTree describes a cache entry, in the tree.json beside its files
+type cachedTree struct {
+	Repo       string `json:"repo"`
+	SHA        string `json:"sha"`
+	Transport  string `json:"transport,omitempty"`
+	Submodules bool   `json:"submodules,omitempty"`
+	LFS        bool   `json:"lfs,omitempty"`
+	Hash       string `json:"hash"`
+	// Mtimes is set when the files have the archive's modification times
+	// rather than when they were installed, as preserve-mtime needs
+	Mtimes bool `json:"mtimes,omitempty"`
+}
+
+// treeCacheEntry returns the cache directory for dep's files at dep.SHA.
+// Entries are named by a hash of everything that decides what gets
+// downloaded, so the entry names of one repository never nest.
+func treeCacheEntry(repoURL string, dep Dependency) (string, cachedTree, error) {
+	root, err := cacheDir()
+	if err != nil {
+		return "", cachedTree{}, err
+	}
+	repo, _ := splitEntryName(repoURL)
+	meta := cachedTree{Repo: repo, SHA: dep.SHA, Transport: dep.Transport, Submodules: dep.Submodules, LFS: dep.LFS}
+	key := sha256.Sum256([]byte(fmt.Sprintf("%s\n%s\n%s\n%t\n%t", meta.Repo, meta.SHA, meta.Transport, meta.Submodules, meta.LFS)))
+	name := hex.EncodeToString(key[:])
+	return filepath.Join(root, "trees", name[:2], name), meta, nil
+}
+
+// fetchDependencyFilesCached is fetchDependencyFiles, served from the download
+// cache when it has dep's commit and adding to it when it doesn't
+func fetchDependencyFilesCached(repoURL string, dep Dependency) (string, error) {
+	if !downloadCache || dep.SHA == "" {
+		return fetchDependencyFiles(repoURL, dep)
+	}
+	entry, meta, err := treeCacheEntry(repoURL, dep)
+	if err != nil {
+		debugf("Not using the download cache: %v\n", err)
+		return fetchDependencyFiles(repoURL, dep)
+	}
+
+	// A hook could rewrite hardlinked files in place, and the cache with them
+	hardlinks := cacheLinkMode == linkHardlink && dep.PostInstall == ""
+	rememberProject()
+	depPath := getDepPath(repoURL)
+	if hash, ok := restoreCachedTree(entry, depPath, dep, hardlinks); ok {
+		infof("Installed %s from the cache\n", depPath)
+		return hash, nil
+	}
+
+	hash, err := fetchDependencyFiles(repoURL, dep)
+	if err != nil || (dep.Hash != "" && hash != dep.Hash) {
+		return hash, err
+	}
+	meta.Hash = hash
+	meta.Mtimes = preserveMtime
+	if err := storeCachedTree(entry, depPath, meta, hardlinks); err != nil {
+		warnf("Warning: couldn't add %s to the download cache: %v\n", repoURL, err)
+	}
+	return hash, nil
+}
+
+// restoreCachedTree recreates the cache entry's files at dest and returns the
+// archive hash recorded with them. An entry that is missing, or whose hash
+// isn't the one dep expects, is a miss.
+func restoreCachedTree(entry, dest string, dep Dependency, hardlinks bool) (string, bool) {
+	data, err := os.ReadFile(filepath.Join(entry, "tree.json"))
+	if err != nil {
+		return "", false
+	}
+	var meta cachedTree
+	if json.Unmarshal(data, &meta) != nil || meta.SHA != dep.SHA || (dep.Hash != "" && meta.Hash != dep.Hash) {
+		return "", false
+	}
+	if preserveMtime && !meta.Mtimes {
+		return "", false
+	}
+
+	tmp, err := makeExtractDir(dest)
+	if err != nil {
+		return "", false
+	}
+	defer removeTemp(tmp)
+	files := filepath.Join(tmp, "files")
+	if err := linkTree(filepath.Join(entry, "files"), files, hardlinks); err != nil {
+		debugf("Couldn't install from the cache: %v\n", err)
+		return "", false
+	}
+	if err := replaceDir(files, dest); err != nil {
+		debugf("Couldn't install from the cache: %v\n", err)
+		return "", false
+	}
+	// The modification time of tree.json is when the entry was last used
+	now := time.Now()
+	os.Chtimes(filepath.Join(entry, "tree.json"), now, now)
+	return meta.Hash, true
+}
+
+// storeCachedTree copies the files at src into a cache entry. They are
+// written to a temporary directory first, so an interrupted store leaves no
+// partial entry behind.
+func storeCachedTree(entry, src string, meta cachedTree, hardlinks bool) error {
+	if err := os.MkdirAll(filepath.Dir(entry), 0755); err != nil {
+		return err
+	}
+	tmp, err := mkdirTemp(filepath.Dir(entry), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer removeTemp(tmp)
+
+	if err := linkTree(src, filepath.Join(tmp, "files"), hardlinks); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "tree.json"), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	os.RemoveAll(entry)
+	return renameIntoPlace(tmp, entry)
+}
+
+// evictCachedTree removes dep's cache entry, for files that didn't match the
+// lock file once installed
+func evictCachedTree(repoURL string, dep Dependency) {
+	if !downloadCache {
+		return
+	}
+	if entry, _, err := treeCacheEntry(repoURL, dep); err == nil {
+		os.RemoveAll(entry)
+	}
+}
+
+// linkTree recreates the tree at src under dst. Directories and symlinks are
+// made anew; files are hardlinked if hardlinks is set, otherwise cloned or
+// copied as cacheLinkMode says. With preserveMtime, they keep src's
+// modification times.
+func linkTree(src, dst string, hardlinks bool) error {
+	var dirs []extractedDir
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			dirs = append(dirs, extractedDir{Path: target, Mode: info.Mode().Perm(), ModTime: info.ModTime()})
+			return os.MkdirAll(target, 0700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			if err := linkFile(path, target, info.Mode().Perm(), hardlinks); err != nil {
+				return err
+			}
+			return setModTime(target, info.ModTime())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return finishDirs(dirs)
+}
+
+// linkFile makes dst a hardlink, clone or copy of src
+func linkFile(src, dst string, mode fs.FileMode, hardlink bool) error {
+	if hardlink && os.Link(src, dst) == nil {
+		return nil
+	}
+	if cacheLinkMode == linkAuto || cacheLinkMode == linkReflink {
+		err := reflinkFile(src, dst, mode)
+		if err == nil || cacheLinkMode == linkReflink {
+			return err
+		}
+	}
+	return copyFile(src, dst, mode)
+}
+
+// copyFile copies src to a new file dst with mode
+func copyFile(src, dst string, mode fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		// The mode given to OpenFile is masked by the umask
+		err = out.Chmod(mode)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// withDownloadCache turns the download cache on in a temporary directory
+func withDownloadCache(t *testing.T, mode string) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("DEPS_CACHE_DIR", dir)
+	t.Setenv("DEPS_CACHE_LINK", mode)
+	projectRemembered = false
+	t.Cleanup(func() { downloadCache, cacheLinkMode, projectRemembered = false, linkAuto, false })
+	if err := configureDownloadCache(); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// cachedTarballServer serves one tarball, counting the downloads
+func cachedTarballServer(t *testing.T, sha string) (*int, func()) {
+	t.Helper()
+	tarball := makeTarGz(t, "repo-abc123d/", map[string]string{"lib.h": "// lib", "src/a.c": "int a;"}).Bytes()
+	downloads := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/repo/tarball/"+sha, func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write(tarball)
+	})
+	return &downloads, testGitHubServer(t, mux)
+}
+
+func TestDownloadCache(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	withDownloadCache(t, linkCopy)
+
+	sha := "abc123def456abc123def456abc123def456abc1"
+	downloads, restore := cachedTarballServer(t, sha)
+	defer restore()
+
+	repoURL := "github.com/testowner/repo"
+	dep, err := installDependency(repoURL, Dependency{Ref: "main", SHA: sha})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Another project, or another checkout, installs from the cache
+	os.RemoveAll(depsDir)
+	again, err := installDependency(repoURL, Dependency{Ref: "main", SHA: sha})
+	if err != nil {
+		t.Fatalf("reinstall error: %v", err)
+	}
+	if *downloads != 1 {
+		t.Errorf("downloads = %d, want 1", *downloads)
+	}
+	if again.Hash != dep.Hash || again.TreeHash != dep.TreeHash {
+		t.Errorf("cached install = %+v, want the hashes of %+v", again, dep)
+	}
+	if data, _ := os.ReadFile(filepath.Join(getDepPath(repoURL), "src", "a.c")); string(data) != "int a;" {
+		t.Errorf("src/a.c = %q", data)
+	}
+
+	// Rearranging files happens after the cache, so it doesn't change it
+	os.RemoveAll(depsDir)
+	if _, err := installDependency(repoURL, Dependency{Ref: "main", SHA: sha, Strip: 1}); err != nil {
+		t.Fatalf("install with strip: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(getDepPath(repoURL), "a.c")); err != nil || *downloads != 1 {
+		t.Errorf("expected a.c stripped from the cached tree without downloading (%v, %d downloads)", err, *downloads)
+	}
+}
+
+func TestDownloadCache_Mismatch(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	withDownloadCache(t, linkCopy)
+
+	sha := "abc123def456abc123def456abc123def456abc1"
+	downloads, restore := cachedTarballServer(t, sha)
+	defer restore()
+
+	repoURL := "github.com/testowner/repo"
+	dep, err := installDependency(repoURL, Dependency{Ref: "main", SHA: sha})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, _, _ := treeCacheEntry(repoURL, dep)
+	os.WriteFile(filepath.Join(entry, "files", "lib.h"), []byte("// tampered"), 0644)
+
+	os.RemoveAll(depsDir)
+	if _, err := installDependency(repoURL, dep); exitCodeFor(err) != exitIntegrity {
+		t.Fatalf("err = %v, want a tree hash mismatch", err)
+	}
+	if _, err := os.Stat(entry); !os.IsNotExist(err) {
+		t.Error("the mismatched cache entry should have been removed")
+	}
+	if _, err := installDependency(repoURL, dep); err != nil || *downloads != 2 {
+		t.Errorf("err = %v, downloads = %d, want a fresh download", err, *downloads)
+	}
+}
+
+func TestDownloadCache_Hardlink(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	withDownloadCache(t, linkHardlink)
+
+	sha := "abc123def456abc123def456abc123def456abc1"
+	_, restore := cachedTarballServer(t, sha)
+	defer restore()
+
+	repoURL := "github.com/testowner/repo"
+	dep, err := installDependency(repoURL, Dependency{Ref: "main", SHA: sha})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, _, _ := treeCacheEntry(repoURL, dep)
+	cached, _ := os.Stat(filepath.Join(entry, "files", "lib.h"))
+
+	os.RemoveAll(depsDir)
+	if _, err := installDependency(repoURL, dep); err != nil {
+		t.Fatal(err)
+	}
+	installed, _ := os.Stat(filepath.Join(getDepPath(repoURL), "lib.h"))
+	if !os.SameFile(cached, installed) {
+		t.Error("expected lib.h to be hardlinked from the cache")
+	}
+
+	// A hook could edit files in place, so it gets copies
+	os.RemoveAll(depsDir)
+	if _, ok := restoreCachedTree(entry, getDepPath(repoURL), dep, false); !ok {
+		t.Fatal("expected a cache hit")
+	}
+	installed, _ = os.Stat(filepath.Join(getDepPath(repoURL), "lib.h"))
+	if os.SameFile(cached, installed) {
+		t.Error("expected a copy of lib.h")
+	}
+}
+
+func TestConfigureDownloadCache(t *testing.T) {
+	t.Cleanup(func() { downloadCache, cacheLinkMode = false, linkAuto })
+	withConfig(t, nil, nil)
+
+	if err := configureDownloadCache(); err != nil || !downloadCache {
+		t.Errorf("downloadCache = %v, err = %v, want it on by default", downloadCache, err)
+	}
+	t.Setenv("DEPS_DOWNLOAD_CACHE", "0")
+	if err := configureDownloadCache(); err != nil || downloadCache {
+		t.Errorf("downloadCache = %v, err = %v, want DEPS_DOWNLOAD_CACHE=0 to turn it off", downloadCache, err)
+	}
+	t.Setenv("DEPS_CACHE_LINK", "symlink")
+	if err := configureDownloadCache(); err == nil {
+		t.Error("expected an error for an unknown cache-link")
+	}
+}
+
+func TestCacheGC(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	withDownloadCache(t, linkCopy)
+
+	sha := "abc123def456abc123def456abc123def456abc1"
+	_, restore := cachedTarballServer(t, sha)
+	defer restore()
+
+	repoURL := "github.com/testowner/repo"
+	dep, err := installDependency(repoURL, Dependency{Ref: "main", SHA: sha})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saveLockFile(&LockFile{Dependencies: map[string]Dependency{repoURL: dep}}); err != nil {
+		t.Fatal(err)
+	}
+	kept, _, _ := treeCacheEntry(repoURL, dep)
+
+	// An entry no project locks any more
+	old := dep
+	old.SHA = "0000000000000000000000000000000000000000"
+	unused, meta, _ := treeCacheEntry(repoURL, old)
+	if err := storeCachedTree(unused, getDepPath(repoURL), meta, false); err != nil {
+		t.Fatal(err)
+	}
+	lastMonth := time.Now().Add(-30 * 24 * time.Hour)
+	os.Chtimes(filepath.Join(unused, "tree.json"), lastMonth, lastMonth)
+
+	entries, _, err := listCacheEntries()
+	if err != nil || len(entries) != 2 || entries[0].Path != unused {
+		t.Fatalf("entries = %+v, err = %v, want the unused entry first", entries, err)
+	}
+	referenced, projects, err := referencedCacheEntries()
+	if err != nil || len(projects) != 1 || !referenced[kept] || referenced[unused] {
+		t.Fatalf("referenced = %v, projects = %v, err = %v", referenced, projects, err)
+	}
+
+	now := time.Now()
+	for _, tt := range []struct {
+		policy cacheGCPolicy
+		want   int
+	}{
+		{cacheGCPolicy{}, 1},
+		{cacheGCPolicy{MaxAge: 7 * 24 * time.Hour}, 1},
+		{cacheGCPolicy{MaxAge: 60 * 24 * time.Hour}, 0},
+		{cacheGCPolicy{MaxSize: 1 << 30}, 0},
+		{cacheGCPolicy{MaxSize: 1}, 1}, // the locked entry stays even over the limit
+	} {
+		garbage := selectGarbage(entries, referenced, tt.policy, now)
+		if len(garbage) != tt.want || (len(garbage) == 1 && garbage[0].Path != unused) {
+			t.Errorf("policy %+v removes %+v, want %d unused entries", tt.policy, garbage, tt.want)
+		}
+	}
+
+	// A project whose lock file is gone no longer keeps anything
+	os.Remove(lockFilePath())
+	if referenced, projects, _ := referencedCacheEntries(); len(referenced) != 0 || len(projects) != 0 {
+		t.Errorf("referenced = %v, projects = %v, want neither once the lock file is deleted", referenced, projects)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{"512": 512, "500M": 500 << 20, "2G": 2 << 30, "1.5GB": 3 << 29, "10KiB": 10 << 10}
+	for in, want := range tests {
+		if got, err := parseSize(in); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "lots", "-1G", "2X"} {
+		if _, err := parseSize(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+	if d, err := parseAge("30d"); err != nil || d != 30*24*time.Hour {
+		t.Errorf("parseAge(30d) = %v, %v", d, err)
+	}
+	if _, err := parseAge("a month"); err == nil {
+		t.Error("expected an error for an unparseable age")
+	}
+}
+
+func TestDownloadCache_PreserveMtime(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	withDownloadCache(t, linkCopy)
+	t.Cleanup(func() { preserveMtime = false })
+
+	sha := "abc123def456abc123def456abc123def456abc1"
+	downloads, restore := cachedTarballServer(t, sha)
+	defer restore()
+
+	repoURL := "github.com/testowner/repo"
+	dep, err := installDependency(repoURL, Dependency{Ref: "main", SHA: sha})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The entry has install times, so it can't serve preserve-mtime
+	preserveMtime = true
+	os.RemoveAll(depsDir)
+	if _, err := installDependency(repoURL, dep); err != nil || *downloads != 2 {
+		t.Fatalf("err = %v, downloads = %d, want a fresh download", err, *downloads)
+	}
+	entry, _, _ := treeCacheEntry(repoURL, dep)
+	cached, _ := os.Stat(filepath.Join(entry, "files", "lib.h"))
+
+	os.RemoveAll(depsDir)
+	if _, err := installDependency(repoURL, dep); err != nil || *downloads != 2 {
+		t.Fatalf("err = %v, downloads = %d, want the entry stored with archive times used", err, *downloads)
+	}
+	installed, _ := os.Stat(filepath.Join(getDepPath(repoURL), "lib.h"))
+	if !installed.ModTime().Equal(cached.ModTime()) {
+		t.Errorf("lib.h mtime = %v, want the cached %v", installed.ModTime(), cached.ModTime())
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// projectRemembered is set once the lock file in use is in the cache's list
+// of projects
+var projectRemembered bool
+
+// projectMu makes parallel installs remember the project once
+var projectMu sync.Mutex
+
+// projectsFile lists the lock files of every project that has installed from
+// the download cache, one absolute path per line. Cache entries none of them
+// lock are garbage.
+func projectsFile() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "projects"), nil
+}
+
+// knownProjects reads the list of projects using the cache
+func knownProjects() ([]string, error) {
+	path, err := projectsFile()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var projects []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			projects = append(projects, line)
+		}
+	}
+	return projects, scanner.Err()
+}
+
+// writeKnownProjects replaces the list of projects using the cache
+func writeKnownProjects(projects []string) error {
+	path, err := projectsFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	var out strings.Builder
+	for _, project := range projects {
+		out.WriteString(project + "\n")
+	}
+	return os.WriteFile(path, []byte(out.String()), 0644)
+}
+
+// rememberProject adds the lock file in use to the list of projects, so that
+// cache gc keeps what it locks
+func rememberProject() {
+	projectMu.Lock()
+	defer projectMu.Unlock()
+	if projectRemembered {
+		return
+	}
+	projectRemembered = true
+	lockPath, err := filepath.Abs(lockFilePath())
+	if err != nil {
+		return
+	}
+	projects, err := knownProjects()
+	if err != nil {
+		debugf("Couldn't read the cache's projects: %v\n", err)
+		return
+	}
+	for _, project := range projects {
+		if project == lockPath {
+			return
+		}
+	}
+	if err := writeKnownProjects(append(projects, lockPath)); err != nil {
+		debugf("Couldn't record %s in the cache's projects: %v\n", lockPath, err)
+	}
+}
+
+// cacheEntry is one tree in the download cache
+type cacheEntry struct {
+	Path     string
+	Meta     cachedTree
+	Size     int64
+	LastUsed time.Time
+}
+
+// listCacheEntries returns the download cache's entries, least recently used
+// first. Directories left by interrupted stores are returned as stray once
+// they are an hour old, so one being written now is left alone.
+func listCacheEntries() (entries []cacheEntry, stray []string, err error) {
+	root, err := cacheDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	dirs, err := filepath.Glob(filepath.Join(root, "trees", "*", "*"))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, dir := range dirs {
+		info, err := os.Stat(filepath.Join(dir, "tree.json"))
+		var meta cachedTree
+		if err == nil {
+			var data []byte
+			if data, err = os.ReadFile(filepath.Join(dir, "tree.json")); err == nil {
+				err = json.Unmarshal(data, &meta)
+			}
+		}
+		if err != nil {
+			if dirInfo, statErr := os.Stat(dir); statErr == nil && time.Since(dirInfo.ModTime()) > time.Hour {
+				stray = append(stray, dir)
+			}
+			continue
+		}
+		size, _ := dirSize(filepath.Join(dir, "files"))
+		entries = append(entries, cacheEntry{Path: dir, Meta: meta, Size: size, LastUsed: info.ModTime()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].LastUsed.Before(entries[j].LastUsed) })
+	return entries, stray, nil
+}
+
+// referencedCacheEntries returns the entries, and the trees in the store,
+// locked by the known projects, and the projects whose lock files still exist.
+// A lock file that exists but can't be read is an error, since what it locks
+// can't be kept.
+func referencedCacheEntries() (map[string]bool, []string, error) {
+	projects, err := knownProjects()
+	if err != nil {
+		return nil, nil, err
+	}
+	referenced := make(map[string]bool)
+	var live []string
+	for _, project := range projects {
+		lockFile, _, err := readLockFileAt(project)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading %s: %v", project, err)
+		}
+		live = append(live, project)
+
+		reference := func(repoURL string, dep Dependency) {
+			if entry, _, err := treeCacheEntry(repoURL, dep); err == nil {
+				referenced[entry] = true
+			}
+			if dir, err := storeTreeDir(dep.TreeHash); err == nil {
+				referenced[dir] = true
+			}
+		}
+		for repoURL, dep := range lockFile.Dependencies {
+			reference(repoURL, dep)
+		}
+		for _, overrides := range lockFile.Profiles {
+			for baseKey, override := range overrides {
+				key := baseKey
+				if override.Repo != "" {
+					key = override.Repo
+				}
+				reference(key, override.Dependency)
+			}
+		}
+	}
+	return referenced, live, nil
+}
+
+// cacheGCPolicy says which unreferenced entries cache gc removes: those
+// unused for longer than MaxAge, then the least recently used until the cache
+// is no bigger than MaxSize. Zero values don't limit, so with neither set
+// every unreferenced entry goes.
+type cacheGCPolicy struct {
+	MaxAge  time.Duration
+	MaxSize int64
+}
+
+// selectGarbage returns the entries policy removes. Entries in referenced
+// are always kept.
+func selectGarbage(entries []cacheEntry, referenced map[string]bool, policy cacheGCPolicy, now time.Time) []cacheEntry {
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+
+	var garbage []cacheEntry
+	for _, entry := range entries {
+		if referenced[entry.Path] {
+			continue
+		}
+		old := policy.MaxAge > 0 && now.Sub(entry.LastUsed) > policy.MaxAge
+		big := policy.MaxSize > 0 && total > policy.MaxSize
+		if old || big || (policy.MaxAge == 0 && policy.MaxSize == 0) {
+			garbage = append(garbage, entry)
+			total -= entry.Size
+		}
+	}
+	return garbage
+}
+
+// selectStoreGarbage returns the trees in the store that cache gc removes:
+// those in no known project's lock file, and with MaxAge, unused for longer
+// than it. MaxSize only limits the download cache, since the store's trees
+// share their files, so with just MaxSize every tree is kept.
+func selectStoreGarbage(trees []storedTree, referenced map[string]bool, policy cacheGCPolicy, now time.Time) (garbage, kept []storedTree) {
+	for _, tree := range trees {
+		remove := policy.MaxSize == 0
+		if policy.MaxAge > 0 {
+			remove = now.Sub(tree.LastUsed) > policy.MaxAge
+		}
+		if remove && !referenced[tree.Path] {
+			garbage = append(garbage, tree)
+		} else {
+			kept = append(kept, tree)
+		}
+	}
+	return garbage, kept
+}
+
+// parseSize reads a size like "500M", "2G" or "1.5GB", in binary units as
+// formatSize prints them. A plain number is bytes.
+func parseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+	multiplier := int64(1)
+	if i := strings.IndexAny(value, "KMGT"); i >= 0 && i == len(value)-1 {
+		multiplier = int64(1) << (10 * (strings.IndexByte("KMGT", value[i]) + 1))
+		value = value[:i]
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (expected a size like 500M or 2G)", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// parseAge reads a duration like "720h", also taking days as in "30d"
+func parseAge(s string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(s, "d"); found {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q (expected a duration like 30d or 12h)", s)
+	}
+	return d, nil
+}
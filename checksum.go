@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fileSum is the checksum of one file in an installed dependency
+type fileSum struct {
+	Path string // slash-separated, relative to the dependency directory
+	Mode string // "l" for symlinks, "-" otherwise
+	Hash string // SHA-256 of the content, or of the link target for symlinks
+}
+
+func (f fileSum) String() string {
+	return fmt.Sprintf("%s %s %s", f.Hash, f.Mode, f.Path)
+}
+
+// hashTreeFiles checksums every file under dir, sorted by path. Directories
+// only count through the files they contain, and .git directories are
+// skipped. A dir that links into the store is followed.
+func hashTreeFiles(dir string) ([]fileSum, error) {
+	dir = resolveInstallDir(dir)
+	var sums []fileSum
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		sum := fileSum{Path: filepath.ToSlash(rel), Mode: "-"}
+
+		h := sha256.New()
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			sum.Mode = "l"
+			io.WriteString(h, filepath.ToSlash(target))
+		case d.Type().IsRegular():
+			if err := hashFileInto(h, path); err != nil {
+				return err
+			}
+		default:
+			// Devices, sockets and the like never come from an archive
+			return nil
+		}
+
+		sum.Hash = hex.EncodeToString(h.Sum(nil))
+		sums = append(sums, sum)
+		return nil
+	})
+	// Walk order puts "a/b" before "a.txt"; plain string order is what
+	// .deps.sums uses
+	sort.Slice(sums, func(i, j int) bool { return sums[i].Path < sums[j].Path })
+	return sums, err
+}
+
+// hashFile returns the SHA-256 of the file at path, as hashTreeFiles has it
+func hashFile(path string) (string, error) {
+	h := sha256.New()
+	if err := hashFileInto(h, path); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashFileInto writes the content of the file at path to h
+func hashFileInto(h io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(h, f)
+	return err
+}
+
+// hashTree returns a SHA-256 over the paths and contents of every file under
+// dir, so it only depends on what was extracted and not on how the archive
+// was compressed. Permission bits are left out as Windows doesn't keep them.
+func hashTree(dir string) (string, error) {
+	sums, err := hashTreeFiles(dir)
+	if err != nil {
+		return "", err
+	}
+	return treeHashOf(sums), nil
+}
+
+// treeHashOf combines file checksums into a tree hash
+func treeHashOf(sums []fileSum) string {
+	var lines strings.Builder
+	for _, sum := range sums {
+		lines.WriteString(sum.String())
+		lines.WriteByte('\n')
+	}
+	h := sha256.Sum256([]byte(lines.String()))
+	return hex.EncodeToString(h[:])
+}
+
+// checksumError reports a download that doesn't match its lock entry
+type checksumError struct {
+	What     string // "hash" (the archive) or "tree hash" (the extracted files)
+	Expected string
+	Got      string
+}
+
+func (e *checksumError) Error() string {
+	return fmt.Sprintf("%s mismatch (expected %s, got %s)", e.What, abbreviate(e.Expected), abbreviate(e.Got))
+}
+
+// abbreviate shortens a hex digest for messages
+func abbreviate(digest string) string {
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
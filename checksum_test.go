@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHashTree(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	files := map[string]string{"README.md": "hello", "src/main.c": "int main() {}"}
+	writeTree(t, a, files)
+	writeTree(t, b, files)
+	// Empty directories and .git don't count
+	os.MkdirAll(filepath.Join(b, "empty"), 0755)
+	writeTree(t, b, map[string]string{".git/HEAD": "ref: refs/heads/main"})
+
+	hashA, err := hashTree(a)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hashB, _ := hashTree(b)
+	if hashA != hashB {
+		t.Errorf("identical trees hash differently: %s vs %s", hashA, hashB)
+	}
+
+	writeTree(t, b, map[string]string{"src/main.c": "int main() { return 1; }"})
+	if changed, _ := hashTree(b); changed == hashA {
+		t.Error("changing a file should change the tree hash")
+	}
+}
+
+func TestHashTreeFiles_Order(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"b.txt": "b", "a/z.txt": "z", "a.txt": "a"})
+
+	sums, err := hashTreeFiles(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var paths []string
+	for _, sum := range sums {
+		paths = append(paths, sum.Path)
+	}
+	want := []string{"a.txt", "a/z.txt", "b.txt"}
+	if len(paths) != len(want) {
+		t.Fatalf("paths = %v, want %v", paths, want)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Errorf("paths = %v, want %v", paths, want)
+			break
+		}
+	}
+}
+
+func TestInstallDependency_Checksums(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	sha := "abc123def456abc123def456abc123def456abc1"
+	tarball := makeTarGz(t, "repo-abc123d/", map[string]string{"lib.h": "// lib"}).Bytes()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/repo/tarball/"+sha, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tarball)
+	})
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	repoURL := "github.com/testowner/repo"
+	dep, err := installDependency(repoURL, Dependency{Ref: "main", SHA: sha})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dep.Hash == "" || dep.TreeHash == "" {
+		t.Fatalf("expected both hashes to be recorded, got %+v", dep)
+	}
+	sums, err := loadSums()
+	if err != nil || sums[repoURL].SHA != sha || len(sums[repoURL].Files) != 1 {
+		t.Errorf("expected %s to list lib.h, got %+v (%v)", sumsFilePath(), sums[repoURL], err)
+	}
+
+	// Reinstalling with the recorded hashes succeeds
+	os.RemoveAll(getDepPath(repoURL))
+	if _, err := installDependency(repoURL, dep); err != nil {
+		t.Fatalf("reinstall error: %v", err)
+	}
+
+	// A tree hash that doesn't match fails and removes the download
+	os.RemoveAll(getDepPath(repoURL))
+	dep.TreeHash = "0000000000000000000000000000000000000000000000000000000000000000"
+	_, err = installDependency(repoURL, dep)
+	var mismatch *checksumError
+	if !errors.As(err, &mismatch) || mismatch.What != "tree hash" {
+		t.Fatalf("expected tree hash mismatch, got %v", err)
+	}
+	if _, err := os.Stat(getDepPath(repoURL)); !os.IsNotExist(err) {
+		t.Error("mismatched download should have been removed")
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Everything an install writes goes somewhere temporary first: archives are
+// spooled to temporary files, extracted into a directory beside the
+// dependency's, and the previous install is moved aside until the new one has
+// been checked. Those paths are registered here while they exist, so that
+// exiting early, on a second Ctrl-C or once an interrupt has stopped the
+// command, removes them and puts back what was set aside. Either way .deps is
+// left as it was before the install or as it is after, never in between.
+
+var (
+	// partialMu guards the maps below, and is held by renames that move
+	// something into place, so exitAfterCleanup never runs halfway through one
+	partialMu sync.Mutex
+	// tempPaths are removed on exit
+	tempPaths = make(map[string]bool)
+	// setAside maps a dependency being installed to its previous install,
+	// or "" if there wasn't one, which is put back on exit
+	setAside = make(map[string]string)
+)
+
+// trackTemp registers path to be removed if deps exits before removeTemp
+func trackTemp(path string) {
+	partialMu.Lock()
+	defer partialMu.Unlock()
+	tempPaths[path] = true
+}
+
+// removeTemp removes path, a temporary file or directory, and stops tracking it
+func removeTemp(path string) {
+	os.RemoveAll(path)
+	partialMu.Lock()
+	defer partialMu.Unlock()
+	delete(tempPaths, path)
+}
+
+// createTemp is os.CreateTemp for a file removed on exit
+func createTemp(dir, pattern string) (*os.File, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err == nil {
+		trackTemp(f.Name())
+	}
+	return f, err
+}
+
+// mkdirTemp is os.MkdirTemp for a directory removed on exit
+func mkdirTemp(dir, pattern string) (string, error) {
+	path, err := os.MkdirTemp(dir, pattern)
+	if err == nil {
+		trackTemp(path)
+	}
+	return path, err
+}
+
+// renameIntoPlace renames a temporary path into place where exiting can't
+// interrupt it
+func renameIntoPlace(tmp, path string) error {
+	partialMu.Lock()
+	defer partialMu.Unlock()
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	delete(tempPaths, tmp)
+	return nil
+}
+
+// pendingInstall is an install of a dependency under way, with the previous
+// install set aside
+type pendingInstall struct {
+	depPath  string
+	dir      string // the temporary directory holding the previous install
+	previous string // the previous install, or "" if there was none
+}
+
+// beginInstall moves the install at depPath aside for a new one. The new one
+// is then either kept with commit or, with rollback, replaced by the previous
+// one again, which is also what happens if deps exits before either.
+func beginInstall(depPath string) (*pendingInstall, error) {
+	dir, err := makeExtractDir(depPath)
+	if err != nil {
+		return nil, err
+	}
+	install := &pendingInstall{depPath: depPath, dir: dir, previous: filepath.Join(dir, "previous")}
+
+	partialMu.Lock()
+	defer partialMu.Unlock()
+	if err := os.Rename(depPath, install.previous); err != nil {
+		if !os.IsNotExist(err) {
+			os.RemoveAll(dir)
+			delete(tempPaths, dir)
+			return nil, err
+		}
+		install.previous = ""
+	}
+	setAside[depPath] = install.previous
+	return install, nil
+}
+
+// commit keeps the new install, removing the previous one
+func (install *pendingInstall) commit() {
+	partialMu.Lock()
+	delete(setAside, install.depPath)
+	partialMu.Unlock()
+	removeTemp(install.dir)
+}
+
+// rollback removes whatever has been installed and puts the previous install
+// back
+func (install *pendingInstall) rollback() {
+	partialMu.Lock()
+	restored := restoreSetAside(install.depPath, install.previous)
+	delete(setAside, install.depPath)
+	partialMu.Unlock()
+	if restored {
+		removeTemp(install.dir)
+	}
+}
+
+// restoreSetAside replaces depPath with its previous install, reporting
+// whether that worked. If it didn't, the previous install is left where it
+// is rather than removed. partialMu must be held.
+func restoreSetAside(depPath, previous string) bool {
+	os.RemoveAll(depPath)
+	if previous == "" {
+		return true
+	}
+	if err := os.Rename(previous, depPath); err != nil {
+		errorf("Error: couldn't restore %s, its previous files are in %s: %v\n", depPath, previous, err)
+		delete(tempPaths, filepath.Dir(previous))
+		return false
+	}
+	return true
+}
+
+// exitAfterCleanup puts back every install under way and removes every
+// temporary path, then exits with code. It keeps partialMu, so nothing is
+// moved into place meanwhile.
+func exitAfterCleanup(code int) {
+	partialMu.Lock()
+	for depPath, previous := range setAside {
+		restoreSetAside(depPath, previous)
+	}
+	for path := range tempPaths {
+		os.RemoveAll(path)
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// completionCommand is a command as shell completion offers it
+type completionCommand struct {
+	Name        string
+	Description string
+	Flags       []string
+	// Args is what its arguments complete to: "deps" for the dependencies
+	// of the lock file, "tasks" for its tasks, or nothing
+	Args string
+}
+
+// Argument completions of a command
+const (
+	completeDeps  = "deps"
+	completeTasks = "tasks"
+)
+
+// Shells deps completion writes scripts for (bash, fish and powershell are
+// shared with deps env)
+const shellZsh = "zsh"
+
+// completionShells are the shells deps completion supports
+var completionShells = []string{shellBash, shellZsh, shellFish, shellPowerShell}
+
+// completionCommands are the commands and their flags, as in showUsage
+var completionCommands = []completionCommand{
+	{Name: "init", Description: "Create the lock file", Flags: []string{"backfill", "gitignore", "toml"}},
+	{Name: "get", Description: "Add a dependency", Flags: []string{"ssh", "submodules", "lfs", "pre", "tag-prefix", "no-prompt", "policy", "as", "add", "post-install", "replace", "strip", "rename", "only", "exclude", "max-size", "soft"}},
+	{Name: "check", Description: "Check dependency status", Flags: []string{"dirty"}},
+	{Name: "list", Description: "List dependencies", Flags: []string{"format"}},
+	{Name: "status", Description: "Summarize what's installed, missing, dirty and outdated", Flags: []string{"offline"}},
+	{Name: "stats", Description: "Show disk usage of dependencies and the cache"},
+	{Name: "licenses", Description: "List the license of each dependency", Flags: []string{"offline"}},
+	{Name: "sbom", Description: "Print an SBOM of the dependencies", Flags: []string{"format", "offline"}},
+	{Name: "tree", Description: "Show dependencies and their submodules"},
+	{Name: "why", Description: "Show which dependencies pull a repository in", Args: completeDeps},
+	{Name: "conflicts", Description: "Show submodules pinned at different commits", Flags: []string{"strategy", "override", "unset"}},
+	{Name: "graph", Description: "Export the dependency graph", Flags: []string{"format"}},
+	{Name: "doctor", Description: "Diagnose common problems"},
+	{Name: "exec", Description: "Run a command with DEPS_* variables set"},
+	{Name: "env", Description: "Print exports of the DEPS_* variables", Flags: []string{"shell"}},
+	{Name: "run", Description: "Run a task from the lock file", Args: completeTasks},
+	{Name: "install", Description: "Install missing dependencies", Flags: []string{"frozen", "soft"}},
+	{Name: "update", Description: "Update dependencies", Flags: []string{"follow-renames", updatePatch, updateMinor, updateMajor, "interactive"}, Args: completeDeps},
+	{Name: "verify", Description: "Check installed files against their checksums", Args: completeDeps},
+	{Name: "audit", Description: "Check locked commits for known vulnerabilities", Args: completeDeps},
+	{Name: "resolve", Description: "Show what a ref resolves to", Flags: []string{"ssh", "pre", "tag-prefix"}},
+	{Name: "tags", Description: "List tags or branches", Flags: []string{"branches", "semver", "tag-prefix", "limit", "ssh"}, Args: completeDeps},
+	{Name: "info", Description: "Show repository details", Args: completeDeps},
+	{Name: "search", Description: "Search GitHub for repositories", Flags: []string{"limit", "urls"}},
+	{Name: "pin", Description: "Freeze a dependency at its locked SHA", Args: completeDeps},
+	{Name: "unpin", Description: "Let updates move a pinned dependency", Args: completeDeps},
+	{Name: "policy", Description: "Set the update policy of a dependency", Args: completeDeps},
+	{Name: "remove", Description: "Remove a dependency", Args: completeDeps},
+	{Name: "sync", Description: "Make .deps match the lock file"},
+	{Name: "prune", Description: "Remove what the lock file doesn't reference"},
+	{Name: "alias", Description: "Name a dependency", Args: completeDeps},
+	{Name: "validate", Description: "Check the lock file for problems"},
+	{Name: "fmt", Description: "Rewrite the lock file in canonical form", Flags: []string{"check"}},
+	{Name: "migrate", Description: "Upgrade or convert the lock file", Flags: []string{"toml", "json"}},
+	{Name: "lock-merge", Description: "Merge lock files (a git merge driver)"},
+	{Name: "mode", Description: "Show or set whether .deps is ignored or committed"},
+	{Name: "completion", Description: "Print a shell completion script"},
+	{Name: "cache", Description: "Show or clean up the download cache", Flags: []string{"max-age", "max-size"}},
+	{Name: "config", Description: "Show and save settings", Flags: []string{"project", "show-origin"}},
+	{Name: "self-update", Description: "Replace this binary with the latest release", Flags: []string{"force"}},
+	{Name: "version", Description: "Show version"},
+	{Name: "help", Description: "Show help"},
+}
+
+// globalFlags are the flags extractGlobalFlags takes anywhere on the command
+// line, and globalValueFlags those of them followed by a value
+var (
+	globalFlags      = []string{"ca-bundle", "insecure-skip-verify", "mirror", "wait-on-rate-limit", "retries", "timeout", "request-timeout", "max-rate", "jobs", "resolver", "lockfile", "allow-hooks", "no-dedup", "profile", "quiet", "verbose", "json", "color", "dry-run"}
+	globalValueFlags = []string{"ca-bundle", "mirror", "retries", "timeout", "request-timeout", "max-rate", "jobs", "resolver", "lockfile", "profile", "color"}
+)
+
+// completionScript returns the completion script for shell. The scripts
+// only know the commands and flags; dependencies and tasks are listed by
+// running deps completion --deps or --tasks, which read the lock file in
+// the current directory without using the network.
+func completionScript(shell string) (string, error) {
+	switch shell {
+	case shellBash:
+		return bashCompletion(), nil
+	case shellZsh:
+		return zshCompletion(), nil
+	case shellFish:
+		return fishCompletion(), nil
+	case shellPowerShell:
+		return powerShellCompletion(), nil
+	}
+	return "", fmt.Errorf("unknown shell %q (use %s)", shell, strings.Join(completionShells, ", "))
+}
+
+// completionNames returns the dependency keys and aliases of lockFile, or
+// its task names, for deps completion --deps and --tasks
+func completionNames(lockFile *LockFile, what string) []string {
+	if what == completeTasks {
+		return taskNames(lockFile)
+	}
+	var names []string
+	for repoURL, dep := range lockFile.Dependencies {
+		names = append(names, repoURL)
+		if dep.Alias != "" {
+			names = append(names, dep.Alias)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dashed returns flags with -- in front, separated by spaces
+func dashed(flags []string) string {
+	words := make([]string, len(flags))
+	for i, flag := range flags {
+		words[i] = "--" + flag
+	}
+	return strings.Join(words, " ")
+}
+
+// commandNames returns the names of the commands, separated by sep, that
+// have the given argument completion, or all of them for ""
+func commandNames(args, sep string) string {
+	var names []string
+	for _, command := range completionCommands {
+		if args == "" || command.Args == args {
+			names = append(names, command.Name)
+		}
+	}
+	return strings.Join(names, sep)
+}
+
+func bashCompletion() string {
+	var b strings.Builder
+	b.WriteString("# bash completion for deps; load it with: source <(deps completion bash)\n")
+	b.WriteString("_deps() {\n")
+	b.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\" cmd=\"\" words=\"\" i\n")
+	b.WriteString("    for ((i = 1; i < COMP_CWORD; i++)); do\n")
+	b.WriteString("        case \"${COMP_WORDS[i]}\" in\n")
+	fmt.Fprintf(&b, "        %s) ((i++)) ;;\n", strings.ReplaceAll(dashed(globalValueFlags), " ", "|"))
+	b.WriteString("        -*) ;;\n")
+	b.WriteString("        *) cmd=\"${COMP_WORDS[i]}\"; break ;;\n")
+	b.WriteString("        esac\n")
+	b.WriteString("    done\n\n")
+	b.WriteString("    case \"$cur\" in\n")
+	b.WriteString("    -*)\n")
+	b.WriteString("        case \"$cmd\" in\n")
+	for _, command := range completionCommands {
+		if len(command.Flags) > 0 {
+			fmt.Fprintf(&b, "        %s) words=\"%s\" ;;\n", command.Name, dashed(command.Flags))
+		}
+	}
+	b.WriteString("        esac\n")
+	fmt.Fprintf(&b, "        words=\"$words %s\"\n", dashed(globalFlags))
+	b.WriteString("        ;;\n")
+	b.WriteString("    *)\n")
+	b.WriteString("        case \"$cmd\" in\n")
+	fmt.Fprintf(&b, "        \"\") words=\"%s\" ;;\n", commandNames("", " "))
+	fmt.Fprintf(&b, "        %s) words=\"$(deps completion --deps 2>/dev/null)\" ;;\n", commandNames(completeDeps, "|"))
+	fmt.Fprintf(&b, "        %s) words=\"$(deps completion --tasks 2>/dev/null)\" ;;\n", commandNames(completeTasks, "|"))
+	fmt.Fprintf(&b, "        completion) words=\"%s\" ;;\n", strings.Join(completionShells, " "))
+	b.WriteString("        esac\n")
+	b.WriteString("        ;;\n")
+	b.WriteString("    esac\n")
+	b.WriteString("    COMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n")
+	b.WriteString("}\n")
+	b.WriteString("complete -o default -F _deps deps\n")
+	return b.String()
+}
+
+func zshCompletion() string {
+	var b strings.Builder
+	b.WriteString("#compdef deps\n")
+	b.WriteString("# zsh completion for deps; load it with: source <(deps completion zsh)\n")
+	b.WriteString("_deps() {\n")
+	b.WriteString("    local cmd=\"\" i\n")
+	b.WriteString("    for ((i = 2; i < CURRENT; i++)); do\n")
+	b.WriteString("        case \"${words[i]}\" in\n")
+	fmt.Fprintf(&b, "        %s) ((i++)) ;;\n", strings.ReplaceAll(dashed(globalValueFlags), " ", "|"))
+	b.WriteString("        -*) ;;\n")
+	b.WriteString("        *) cmd=\"${words[i]}\"; break ;;\n")
+	b.WriteString("        esac\n")
+	b.WriteString("    done\n\n")
+	b.WriteString("    local -a candidates\n")
+	b.WriteString("    if [[ \"${words[CURRENT]}\" == -* ]]; then\n")
+	b.WriteString("        case \"$cmd\" in\n")
+	for _, command := range completionCommands {
+		if len(command.Flags) > 0 {
+			fmt.Fprintf(&b, "        %s) candidates=(%s) ;;\n", command.Name, dashed(command.Flags))
+		}
+	}
+	b.WriteString("        esac\n")
+	fmt.Fprintf(&b, "        candidates+=(%s)\n", dashed(globalFlags))
+	b.WriteString("        compadd -- $candidates\n")
+	b.WriteString("        return\n")
+	b.WriteString("    fi\n\n")
+	b.WriteString("    case \"$cmd\" in\n")
+	b.WriteString("    \"\")\n")
+	b.WriteString("        candidates=(\n")
+	for _, command := range completionCommands {
+		fmt.Fprintf(&b, "            %s\n", posixQuote(command.Name+":"+command.Description))
+	}
+	b.WriteString("        )\n")
+	b.WriteString("        _describe command candidates\n")
+	b.WriteString("        ;;\n")
+	fmt.Fprintf(&b, "    %s) compadd -- ${(f)\"$(deps completion --deps 2>/dev/null)\"} ;;\n", commandNames(completeDeps, "|"))
+	fmt.Fprintf(&b, "    %s) compadd -- ${(f)\"$(deps completion --tasks 2>/dev/null)\"} ;;\n", commandNames(completeTasks, "|"))
+	fmt.Fprintf(&b, "    completion) compadd -- %s ;;\n", strings.Join(completionShells, " "))
+	b.WriteString("    *) _files ;;\n")
+	b.WriteString("    esac\n")
+	b.WriteString("}\n")
+	b.WriteString("compdef _deps deps\n")
+	return b.String()
+}
+
+func fishCompletion() string {
+	var b strings.Builder
+	b.WriteString("# fish completion for deps; load it with: deps completion fish | source\n")
+	b.WriteString("complete -c deps -f\n")
+	for _, command := range completionCommands {
+		fmt.Fprintf(&b, "complete -c deps -n __fish_use_subcommand -a %s -d %s\n", command.Name, fishQuote(command.Description))
+	}
+	for _, command := range completionCommands {
+		for _, flag := range command.Flags {
+			fmt.Fprintf(&b, "complete -c deps -n '__fish_seen_subcommand_from %s' -l %s\n", command.Name, flag)
+		}
+	}
+	for _, flag := range globalFlags {
+		requires := ""
+		for _, valueFlag := range globalValueFlags {
+			if flag == valueFlag {
+				requires = " -r"
+			}
+		}
+		fmt.Fprintf(&b, "complete -c deps -l %s%s\n", flag, requires)
+	}
+	fmt.Fprintf(&b, "complete -c deps -n '__fish_seen_subcommand_from %s' -a '(deps completion --deps 2>/dev/null)'\n", commandNames(completeDeps, " "))
+	fmt.Fprintf(&b, "complete -c deps -n '__fish_seen_subcommand_from %s' -a '(deps completion --tasks 2>/dev/null)'\n", commandNames(completeTasks, " "))
+	fmt.Fprintf(&b, "complete -c deps -n '__fish_seen_subcommand_from completion' -a '%s'\n", strings.Join(completionShells, " "))
+	b.WriteString("complete -c deps -n '__fish_seen_subcommand_from exec validate fmt lock-merge' -F\n")
+	return b.String()
+}
+
+func powerShellCompletion() string {
+	quoted := func(words []string) string {
+		for i, word := range words {
+			words[i] = powerShellQuote(word)
+		}
+		return strings.Join(words, ", ")
+	}
+	dashedList := func(flags []string) []string {
+		return strings.Fields(dashed(flags))
+	}
+
+	var b strings.Builder
+	b.WriteString("# PowerShell completion for deps; load it with: deps completion powershell | Out-String | Invoke-Expression\n")
+	b.WriteString("Register-ArgumentCompleter -Native -CommandName deps -ScriptBlock {\n")
+	b.WriteString("    param($wordToComplete, $commandAst, $cursorPosition)\n")
+	b.WriteString("    $commands = [ordered]@{\n")
+	for _, command := range completionCommands {
+		fmt.Fprintf(&b, "        %s = %s\n", powerShellQuote(command.Name), powerShellQuote(command.Description))
+	}
+	b.WriteString("    }\n")
+	b.WriteString("    $flags = @{\n")
+	for _, command := range completionCommands {
+		if len(command.Flags) > 0 {
+			fmt.Fprintf(&b, "        %s = @(%s)\n", powerShellQuote(command.Name), quoted(dashedList(command.Flags)))
+		}
+	}
+	b.WriteString("    }\n")
+	fmt.Fprintf(&b, "    $globalFlags = @(%s)\n", quoted(dashedList(globalFlags)))
+	fmt.Fprintf(&b, "    $valueFlags = @(%s)\n", quoted(dashedList(globalValueFlags)))
+	fmt.Fprintf(&b, "    $depCommands = @(%s)\n", quoted(strings.Split(commandNames(completeDeps, " "), " ")))
+	fmt.Fprintf(&b, "    $taskCommands = @(%s)\n\n", quoted(strings.Split(commandNames(completeTasks, " "), " ")))
+	b.WriteString("    $command = ''\n")
+	b.WriteString("    $elements = @($commandAst.CommandElements | Select-Object -Skip 1)\n")
+	b.WriteString("    for ($i = 0; $i -lt $elements.Count; $i++) {\n")
+	b.WriteString("        if ($elements[$i].Extent.EndOffset -ge $cursorPosition) { break }\n")
+	b.WriteString("        $word = $elements[$i].ToString()\n")
+	b.WriteString("        if ($valueFlags -contains $word) { $i++; continue }\n")
+	b.WriteString("        if ($word.StartsWith('-')) { continue }\n")
+	b.WriteString("        $command = $word\n")
+	b.WriteString("        break\n")
+	b.WriteString("    }\n\n")
+	b.WriteString("    if ($wordToComplete.StartsWith('-')) {\n")
+	b.WriteString("        $candidates = @($flags[$command]) + $globalFlags\n")
+	b.WriteString("    } elseif ($command -eq '') {\n")
+	b.WriteString("        $commands.Keys | Where-Object { $_ -like \"$wordToComplete*\" } | ForEach-Object {\n")
+	b.WriteString("            [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $commands[$_])\n")
+	b.WriteString("        }\n")
+	b.WriteString("        return\n")
+	b.WriteString("    } elseif ($depCommands -contains $command) {\n")
+	b.WriteString("        $candidates = @(deps completion --deps 2>$null)\n")
+	b.WriteString("    } elseif ($taskCommands -contains $command) {\n")
+	b.WriteString("        $candidates = @(deps completion --tasks 2>$null)\n")
+	b.WriteString("    } elseif ($command -eq 'completion') {\n")
+	fmt.Fprintf(&b, "        $candidates = @(%s)\n", quoted(append([]string(nil), completionShells...)))
+	b.WriteString("    } else {\n")
+	b.WriteString("        return\n")
+	b.WriteString("    }\n")
+	b.WriteString("    $candidates | Where-Object { $_ -and $_ -like \"$wordToComplete*\" } | ForEach-Object {\n")
+	b.WriteString("        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)\n")
+	b.WriteString("    }\n")
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompletionScript(t *testing.T) {
+	for _, shell := range completionShells {
+		script, err := completionScript(shell)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", shell, err)
+		}
+		for _, want := range []string{"lock-merge", "follow-renames", "lockfile", "deps completion --deps"} {
+			if !strings.Contains(script, want) {
+				t.Errorf("%s script doesn't contain %q", shell, want)
+			}
+		}
+	}
+	if _, err := completionScript("tcsh"); err == nil {
+		t.Error("expected an error for an unknown shell")
+	}
+}
+
+func TestCompletionNames(t *testing.T) {
+	lockFile := &LockFile{
+		Dependencies: map[string]Dependency{
+			"github.com/user/repo": {Alias: "repo"},
+			"github.com/user/lib":  {},
+		},
+		Tasks: map[string]string{"test": "go test ./...", "build": "make"},
+	}
+	if got, want := completionNames(lockFile, completeDeps), []string{"github.com/user/lib", "github.com/user/repo", "repo"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("deps = %q, want %q", got, want)
+	}
+	if got, want := completionNames(lockFile, completeTasks), []string{"build", "test"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tasks = %q, want %q", got, want)
+	}
+}
+
+// TestBashCompletion runs the bash script, with deps itself stubbed out
+func TestBashCompletion(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available")
+	}
+
+	tests := []struct {
+		words string
+		want  string
+	}{
+		{"deps upd", "update"},
+		{"deps --lockfile other.lock ver", "verify version"},
+		{"deps update --fol", "--follow-renames"},
+		{"deps update --dry", "--dry-run"},
+		{"deps remove git", "github.com/user/repo"},
+		{"deps run te", "test"},
+		{"deps completion fi", "fish"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.words, func(t *testing.T) {
+			program := bashCompletion() + `
+deps() {
+    case "$2" in
+    --deps) echo github.com/user/repo ;;
+    --tasks) echo test ;;
+    esac
+}
+COMP_WORDS=(` + tt.words + `)
+COMP_CWORD=$((${#COMP_WORDS[@]} - 1))
+_deps
+echo "${COMPREPLY[*]}"
+`
+			out, err := exec.Command(bash, "-c", program).CombinedOutput()
+			if err != nil {
+				t.Fatalf("bash failed: %v\n%s", err, out)
+			}
+			if got := strings.TrimSpace(string(out)); got != tt.want {
+				t.Errorf("completions = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCompletionCommands keeps completion in step with the usage text
+func TestCompletionCommands(t *testing.T) {
+	usage, _ := captureOutput(t, showUsage)
+	known := make(map[string]bool)
+	for _, command := range completionCommands {
+		known[command.Name] = true
+	}
+	for _, line := range strings.Split(usage, "\n") {
+		fields := strings.Fields(line)
+		if strings.HasPrefix(line, "  deps ") && !known[fields[1]] {
+			t.Errorf("deps %s has no completion", fields[1])
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// projectConfigFile holds settings for one project, in the directory deps
+// runs in. It takes precedence over the user's config file.
+const projectConfigFile = ".deps.yml"
+
+// configSetting is a setting that can be kept in a config file instead of
+// an environment variable. Settings are looked up in order of precedence:
+// the command line flag, if there is one, then the environment variable, the
+// project's .deps.yml and the user's config file.
+type configSetting struct {
+	Name        string
+	Env         string
+	Description string
+	Validate    func(value string) error
+	// UserOnly settings would let a cloned repository weaken security
+	// checks, so .deps.yml can't set them
+	UserOnly bool
+	// ValidateProject further limits what .deps.yml can set, for settings
+	// a cloned repository could otherwise aim outside itself
+	ValidateProject func(value string) error
+}
+
+var configSettings = []configSetting{
+	{Name: "host", Env: "DEPS_HOST", Description: "host of dependencies given as owner/repo (default github.com)", Validate: validateConfigHost},
+	{Name: "token-file", Env: "DEPS_TOKEN_FILE", Description: "file holding a GitHub token, used when GITHUB_TOKEN isn't set"},
+	{Name: "cache-dir", Env: "DEPS_CACHE_DIR", Description: "where downloads and API responses are cached"},
+	{Name: "download-cache", Env: "DEPS_DOWNLOAD_CACHE", Description: "share downloaded dependencies between projects (default true)", Validate: validateConfigBool},
+	{Name: "cache-link", Env: "DEPS_CACHE_LINK", Description: "how files leave the download cache: auto, reflink, hardlink or copy", Validate: validateCacheLink},
+	{Name: "http-cache", Env: "DEPS_HTTP_CACHE", Description: "cache API responses on disk (default true)", Validate: validateConfigBool},
+	{Name: "color", Env: "DEPS_COLOR", Description: "color output: auto, always or never", Validate: validateConfigColor},
+	{Name: "quiet", Env: "DEPS_QUIET", Description: "print only errors", Validate: validateConfigBool},
+	{Name: "verbose", Env: "DEPS_VERBOSE", Description: "log HTTP requests and extracted files", Validate: validateConfigBool},
+	{Name: "layout", Env: "DEPS_LAYOUT", Description: "how dependencies are laid out in dir: nested (default) or flat", Validate: validateLayout},
+	{Name: "dedup", Env: "DEPS_DEDUP", Description: "hardlink installed files identical to ones of other dependencies (on unless false)", Validate: validateConfigBool},
+	{Name: "store", Env: "DEPS_STORE", Description: "install dependencies as links into a content-addressed store shared by every project", Validate: validateConfigBool},
+	{Name: "preserve-mtime", Env: "DEPS_PRESERVE_MTIME", Description: "give files the modification times recorded in the archive", Validate: validateConfigBool},
+	{Name: "mode", Env: "DEPS_MODE", Description: "whether dir is kept out of git (ignored) or committed (vendored)", Validate: validateMode},
+	{Name: "dir", Env: "DEPS_DIR", Description: "directory dependencies are installed in (default .deps)", Validate: validateDepsDir, ValidateProject: validateProjectDepsDir},
+	{Name: "lockfile", Env: "DEPS_LOCKFILE", Description: "lock file to use instead of .deps.lock"},
+	{Name: "profile", Env: "DEPS_PROFILE", Description: "profile whose overrides replace dependencies"},
+	{Name: "resolver", Env: "DEPS_RESOLVER", Description: "how refs are resolved: api or git", Validate: validateResolver},
+	{Name: "retries", Env: "DEPS_RETRIES", Description: "times a failed request is retried (default 3)", Validate: validateRetries},
+	{Name: "max-rate", Env: "DEPS_MAX_RATE", Description: "most bytes a second to download, like 2M, shared by all downloads", Validate: validateMaxRate},
+	{Name: "jobs", Env: "DEPS_JOBS", Description: "dependencies installed, or resolved, at once (default the number of CPUs to install and 8 to resolve)", Validate: validateJobs},
+	{Name: "max-dep-size", Env: "DEPS_MAX_DEP_SIZE", Description: "size budget of dependencies without max_size in the lock file, like 500M", Validate: validateMaxDepSize},
+	{Name: "oversize", Env: "DEPS_OVERSIZE", Description: "what an install over its size budget does: fail (the default) or warn", Validate: validateOversize},
+	{Name: "allowed-licenses", Env: "DEPS_ALLOWED_LICENSES", Description: "comma-separated SPDX identifiers of the only licenses dependencies may have", Validate: validateLicenseList},
+	{Name: "denied-licenses", Env: "DEPS_DENIED_LICENSES", Description: "comma-separated SPDX identifiers of licenses dependencies may not have", Validate: validateLicenseList},
+	{Name: "wait-on-rate-limit", Env: "DEPS_WAIT_ON_RATE_LIMIT", Description: "wait for rate limits to reset", Validate: validateConfigBool},
+	{Name: "mirrors", Env: "DEPS_MIRRORS", Description: "comma-separated from=to mirror rules", Validate: validateMirrors},
+	{Name: "ca-bundle", Env: "DEPS_CA_BUNDLE", Description: "extra CA certificates to trust", UserOnly: true},
+	{Name: "insecure-skip-verify", Env: "DEPS_INSECURE_SKIP_VERIFY", Description: "don't verify TLS certificates", Validate: validateConfigBool, UserOnly: true},
+	{Name: "allow-hooks", Env: "DEPS_ALLOW_HOOKS", Description: "run post-install hooks without asking", Validate: validateConfigBool, UserOnly: true},
+}
+
+// userConfig and projectConfig are the settings read by loadConfig
+var userConfig, projectConfig map[string]string
+
+// findSetting returns the setting called name
+func findSetting(name string) (configSetting, error) {
+	for _, setting := range configSettings {
+		if setting.Name == name {
+			return setting, nil
+		}
+	}
+	return configSetting{}, fmt.Errorf("unknown setting %q", name)
+}
+
+// userConfigFile is the user's config file, ~/.config/deps/config on Linux
+func userConfigFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "deps", "config"), nil
+}
+
+// loadConfig reads the user's and the project's config files. Either may be
+// missing.
+func loadConfig() error {
+	userConfig, projectConfig = nil, nil
+	if path, err := userConfigFile(); err == nil {
+		if userConfig, err = readConfigFile(path, false); err != nil {
+			return err
+		}
+	}
+	var err error
+	projectConfig, err = readConfigFile(projectConfigFile, true)
+	return err
+}
+
+// configValue returns setting name from its environment variable, the
+// project's config file or the user's, in that order
+func configValue(name string) string {
+	value, _ := configLookup(name)
+	return value
+}
+
+// configBool reports whether the boolean setting name is on
+func configBool(name string) bool {
+	on, _ := parseConfigBool(configValue(name))
+	return on
+}
+
+// configLookup returns setting name and where it came from: its environment
+// variable or the config file it was read from. Both are empty when the
+// setting isn't set.
+func configLookup(name string) (value, origin string) {
+	if setting, err := findSetting(name); err == nil {
+		if value := os.Getenv(setting.Env); value != "" {
+			return value, setting.Env
+		}
+	}
+	if value, ok := projectConfig[name]; ok {
+		return value, projectConfigFile
+	}
+	if value, ok := userConfig[name]; ok {
+		path, _ := userConfigFile()
+		return value, path
+	}
+	return "", ""
+}
+
+// readConfigFile reads a config file, returning no settings if it doesn't
+// exist
+func readConfigFile(path string, project bool) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	settings, err := parseConfig(data, project)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return settings, nil
+}
+
+// checkConfigValue reports whether setting can be saved as value, in the
+// project's config file or the user's
+func checkConfigValue(setting configSetting, value string, project bool) error {
+	if project && setting.UserOnly {
+		return fmt.Errorf("%s can only be set in the user config file", setting.Name)
+	}
+	if setting.Validate != nil {
+		if err := setting.Validate(value); err != nil {
+			return err
+		}
+	}
+	if project && setting.ValidateProject != nil {
+		return setting.ValidateProject(value)
+	}
+	return nil
+}
+
+// parseConfig parses "name: value" lines, the flat subset of YAML config
+// files are written in. Blank lines and "#" comments are skipped.
+func parseConfig(data []byte, project bool) (map[string]string, error) {
+	settings := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, err := parseConfigLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		setting, err := findSetting(name)
+		if err == nil {
+			err = checkConfigValue(setting, value, project)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		settings[name] = value
+	}
+	return settings, scanner.Err()
+}
+
+// parseConfigLine splits a "name: value" line, unquoting the value
+func parseConfigLine(line string) (name, value string, err error) {
+	name, value, found := strings.Cut(line, ":")
+	if !found {
+		return "", "", fmt.Errorf("expected name: value, got %q", line)
+	}
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+	switch {
+	case strings.HasPrefix(value, `"`):
+		value, err = strconv.Unquote(value)
+		if err != nil {
+			return "", "", fmt.Errorf("%s: invalid quoted value", name)
+		}
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", "", fmt.Errorf("%s: invalid quoted value", name)
+		}
+		value = strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	default:
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+	}
+	return name, value, nil
+}
+
+// formatConfigLine writes a "name: value" line, quoting values YAML would
+// read differently
+func formatConfigLine(name, value string) string {
+	if value == "" || strings.ContainsAny(value, "#:\"'") || strings.TrimSpace(value) != value {
+		value = strconv.Quote(value)
+	}
+	return name + ": " + value
+}
+
+// writeConfigValue sets name to value in the config file at path, or removes
+// it when value is empty. Other lines, comments included, are kept as they
+// are.
+func writeConfigValue(path, name, value string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var lines []string
+	written := false
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if lineName, _, err := parseConfigLine(line); err != nil || lineName != name {
+			continue
+		}
+		if value == "" || written {
+			lines = slices.Delete(lines, i, i+1)
+			i--
+			continue
+		}
+		lines[i] = formatConfigLine(name, value)
+		written = true
+	}
+	if value != "" && !written {
+		lines = append(lines, formatConfigLine(name, value))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	out := strings.Join(lines, "\n")
+	if out != "" {
+		out += "\n"
+	}
+	return os.WriteFile(path, []byte(out), 0644)
+}
+
+func validateConfigHost(host string) error {
+	if strings.ContainsAny(host, "/:@") || !strings.Contains(host, ".") {
+		return fmt.Errorf("invalid host %q (give a host name such as github.com)", host)
+	}
+	return nil
+}
+
+// parseConfigBool reads a boolean setting, which is 1 or true when on. Unset
+// settings are off.
+func parseConfigBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "1", "true":
+		return true, nil
+	case "", "0", "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q (use true or false)", value)
+}
+
+func validateConfigBool(value string) error {
+	_, err := parseConfigBool(value)
+	return err
+}
+
+func validateRetries(value string) error {
+	if n, err := strconv.Atoi(value); err != nil || n < 0 {
+		return fmt.Errorf("invalid retries %q (expected a count of 0 or more)", value)
+	}
+	return nil
+}
+
+func validateResolver(name string) error {
+	if name != resolverAPI && name != resolverGit {
+		return fmt.Errorf("invalid resolver %q (use %s or %s)", name, resolverAPI, resolverGit)
+	}
+	return nil
+}
+
+func validateMirrors(value string) error {
+	_, err := parseMirrorRules([]string{value})
+	return err
+}
+
+func validateConfigColor(mode string) error {
+	if !slices.Contains([]string{colorAuto, colorAlways, colorNever}, mode) {
+		return fmt.Errorf("invalid color %q (use %s, %s or %s)", mode, colorAuto, colorAlways, colorNever)
+	}
+	return nil
+}
+
+// expandRepoShorthand puts the host setting in front of a repository given
+// as owner/repo. URLs that start with a host, and aliases, are returned as
+// they are.
+func expandRepoShorthand(repoURL string) string {
+	first, _, found := strings.Cut(repoURL, "/")
+	if !found || strings.ContainsAny(first, ".:@") {
+		return repoURL
+	}
+	host := configValue("host")
+	if host == "" {
+		host = "github.com"
+	}
+	return strings.ToLower(host) + "/" + repoURL
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// withConfig replaces the loaded config files for the duration of a test
+func withConfig(t *testing.T, user, project map[string]string) {
+	t.Helper()
+	origUser, origProject := userConfig, projectConfig
+	userConfig, projectConfig = user, project
+	t.Cleanup(func() { userConfig, projectConfig = origUser, origProject })
+}
+
+func TestParseConfig(t *testing.T) {
+	data := []byte(`# deps settings
+host: github.com
+token-file: "/home/me/my token"
+cache-dir: /tmp/cache # shared with CI
+
+color: 'never'
+`)
+	got, err := parseConfig(data, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"host": "github.com", "token-file": "/home/me/my token", "cache-dir": "/tmp/cache", "color": "never"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("settings = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"colour: never\n", "host github.com\n", "token-file: \"unterminated\n"} {
+		if _, err := parseConfig([]byte(bad), false); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestWriteConfigValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deps", "config")
+
+	for _, step := range []struct{ name, value string }{
+		{"host", "github.com"},
+		{"color", "never"},
+		{"host", "dev.azure.com"},
+		{"color", ""},
+		{"token-file", "/home/me/my #token"},
+	} {
+		if err := writeConfigValue(path, step.name, step.value); err != nil {
+			t.Fatalf("writing %s: %v", step.name, err)
+		}
+	}
+	settings, err := readConfigFile(path, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := map[string]string{"host": "dev.azure.com", "token-file": "/home/me/my #token"}; !reflect.DeepEqual(settings, want) {
+		t.Errorf("settings = %v, want %v", settings, want)
+	}
+}
+
+func TestWriteConfigValue_KeepsComments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".deps.yml")
+	os.WriteFile(path, []byte("# shared with the team\nhost: github.com\n"), 0644)
+
+	if err := writeConfigValue(path, "host", "dev.azure.com"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if want := "# shared with the team\nhost: dev.azure.com\n"; string(data) != want {
+		t.Errorf("file = %q, want %q", data, want)
+	}
+}
+
+func TestConfigValue_Precedence(t *testing.T) {
+	withConfig(t, map[string]string{"host": "user.example.com", "color": "always"}, map[string]string{"host": "project.example.com"})
+	t.Setenv("DEPS_COLOR", "never")
+
+	if got := configValue("host"); got != "project.example.com" {
+		t.Errorf("host = %q, want the project's", got)
+	}
+	if got := configValue("color"); got != "never" {
+		t.Errorf("color = %q, want DEPS_COLOR's", got)
+	}
+	if got := configValue("cache-dir"); got != "" {
+		t.Errorf("cache-dir = %q, want it unset", got)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	withConfig(t, nil, nil)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(t.TempDir(), "xdg"))
+	t.Setenv("HOME", t.TempDir())
+
+	userFile, _ := userConfigFile()
+	writeConfigValue(userFile, "cache-dir", "/tmp/cache")
+	os.WriteFile(projectConfigFile, []byte("color: never\n"), 0644)
+
+	if err := loadConfig(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if configValue("cache-dir") != "/tmp/cache" || configValue("color") != "never" {
+		t.Errorf("user = %v, project = %v", userConfig, projectConfig)
+	}
+
+	os.WriteFile(projectConfigFile, []byte("colour: never\n"), 0644)
+	if err := loadConfig(); err == nil {
+		t.Error("expected an error for an unknown setting")
+	}
+}
+
+func TestLoadConfig_ProjectDir(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	withConfig(t, nil, nil)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(t.TempDir(), "xdg"))
+	t.Setenv("HOME", t.TempDir())
+	outside := t.TempDir()
+	os.Symlink(outside, "vendor")
+
+	os.WriteFile(projectConfigFile, []byte("dir: third_party/deps\n"), 0644)
+	if err := loadConfig(); err != nil {
+		t.Errorf("dir inside the project: %v", err)
+	}
+	for _, dir := range []string{outside, "../elsewhere", "vendor/deps"} {
+		os.WriteFile(projectConfigFile, []byte("dir: "+dir+"\n"), 0644)
+		if err := loadConfig(); err == nil {
+			t.Errorf("expected an error for dir %s in %s", dir, projectConfigFile)
+		}
+	}
+
+	// Only the project's file is limited
+	userFile, _ := userConfigFile()
+	os.Remove(projectConfigFile)
+	writeConfigValue(userFile, "dir", outside)
+	if err := loadConfig(); err != nil {
+		t.Errorf("dir outside the project in the user config: %v", err)
+	}
+}
+
+func TestExpandRepoShorthand(t *testing.T) {
+	withConfig(t, nil, nil)
+	tests := map[string]string{
+		"user/repo":                 "github.com/user/repo",
+		"user/repo//docs":           "github.com/user/repo//docs",
+		"github.com/user/repo":      "github.com/user/repo",
+		"git@github.com:user/repo":  "git@github.com:user/repo",
+		"https://github.com/u/repo": "https://github.com/u/repo",
+		"repo":                      "repo",
+	}
+	for in, want := range tests {
+		if got := expandRepoShorthand(in); got != want {
+			t.Errorf("expandRepoShorthand(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	withConfig(t, map[string]string{"host": "dev.azure.com"}, nil)
+	if got := expandRepoShorthand("org/project/_git/repo"); got != "dev.azure.com/org/project/_git/repo" {
+		t.Errorf("with host setting: got %q", got)
+	}
+}
+
+func TestGitHubToken_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(path, []byte("from-file\n"), 0600)
+	withConfig(t, map[string]string{"token-file": path}, nil)
+
+	t.Setenv("GITHUB_TOKEN", "")
+	if token, err := githubToken(); err != nil || token != "from-file" {
+		t.Errorf("token = %q, err = %v, want the file's", token, err)
+	}
+	t.Setenv("GITHUB_TOKEN", "from-env")
+	if token, _ := githubToken(); token != "from-env" {
+		t.Errorf("token = %q, want GITHUB_TOKEN to win", token)
+	}
+
+	t.Setenv("GITHUB_TOKEN", "")
+	withConfig(t, map[string]string{"token-file": filepath.Join(t.TempDir(), "missing")}, nil)
+	if _, err := githubToken(); err == nil {
+		t.Error("expected an error for a missing token file")
+	}
+}
+
+func TestParseConfig_Project(t *testing.T) {
+	if _, err := parseConfig([]byte("resolver: git\nretries: 5\n"), true); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, bad := range []string{"allow-hooks: true\n", "insecure-skip-verify: 1\n", "ca-bundle: certs.pem\n"} {
+		if _, err := parseConfig([]byte(bad), true); err == nil {
+			t.Errorf("expected .deps.yml to refuse %q", bad)
+		}
+		if _, err := parseConfig([]byte(bad), false); err != nil {
+			t.Errorf("user config: unexpected error for %q: %v", bad, err)
+		}
+	}
+	for _, bad := range []string{"retries: -1\n", "resolver: svn\n", "quiet: maybe\n", "mirrors: nonsense\n"} {
+		if _, err := parseConfig([]byte(bad), false); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+// TestConfig_Layers checks that settings reach the commands: flags win over
+// the environment, which wins over .deps.yml, which wins over the user's file
+func TestConfig_Layers(t *testing.T) {
+	t.Cleanup(func() {
+		configureLockFile("")
+		configureHooks(false)
+	})
+
+	withConfig(t, map[string]string{"lockfile": "user.lock", "allow-hooks": "true"}, map[string]string{"lockfile": "project.lock"})
+	configureLockFile("")
+	if lockFileOverride != "project.lock" {
+		t.Errorf("lockfile = %q, want the project's", lockFileOverride)
+	}
+	t.Setenv("DEPS_LOCKFILE", "env.lock")
+	configureLockFile("")
+	if lockFileOverride != "env.lock" {
+		t.Errorf("lockfile = %q, want DEPS_LOCKFILE's", lockFileOverride)
+	}
+	configureLockFile("flag.lock")
+	if lockFileOverride != "flag.lock" {
+		t.Errorf("lockfile = %q, want --lockfile's", lockFileOverride)
+	}
+
+	configureHooks(false)
+	if !allowHooks {
+		t.Error("allow-hooks: true in the user config should allow hooks")
+	}
+	t.Setenv("DEPS_ALLOW_HOOKS", "0")
+	configureHooks(false)
+	if allowHooks {
+		t.Error("DEPS_ALLOW_HOOKS=0 should win over the user config")
+	}
+}
+
+func TestConfigureRetries_Setting(t *testing.T) {
+	origClient, origRetries := httpClient, maxRetries
+	defer func() { httpClient, maxRetries = origClient, origRetries }()
+
+	withConfig(t, nil, map[string]string{"retries": "7"})
+	if err := configureRetries(-1); err != nil || maxRetries != 7 {
+		t.Errorf("maxRetries = %d, err = %v, want 7 from .deps.yml", maxRetries, err)
+	}
+	t.Setenv("DEPS_RETRIES", "lots")
+	if err := configureRetries(-1); err == nil || !strings.Contains(err.Error(), "DEPS_RETRIES") {
+		t.Errorf("err = %v, want it to name DEPS_RETRIES", err)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// dedupFiles hardlinks files installed in one dependency to identical files
+// installed in the others, unless --no-dedup or the dedup setting turns it
+// off. It is set by configureDedup.
+var dedupFiles bool
+
+// configureDedup turns deduplication on unless disable is set (--no-dedup)
+// or the dedup setting is off
+func configureDedup(disable bool) {
+	dedupFiles = !disable && (configValue("dedup") == "" || configBool("dedup"))
+}
+
+// dedupDependency replaces the files just installed for repoURL with
+// hardlinks to identical files of the other installed dependencies, going by
+// the checksums in .deps.sums. A file of another dependency is checked
+// before it is linked, so one edited since it was installed isn't spread.
+// Files must also agree on their permission bits, and with preserveMtime on
+// their modification times, since links share them. Dependencies installed
+// from the store already share their files, so they are left alone.
+func dedupDependency(repoURL string, files []fileSum) {
+	depPath := getDepPath(repoURL)
+	if !dedupFiles || resolveInstallDir(depPath) != depPath {
+		return
+	}
+	sumsMu.Lock()
+	sums, err := loadSums()
+	sumsMu.Unlock()
+	if err != nil {
+		debugf("Not deduplicating %s: %v\n", repoURL, err)
+		return
+	}
+	candidates := make(map[string][]string)
+	for otherURL, other := range sums {
+		otherPath := getDepPath(otherURL)
+		if otherURL == repoURL || resolveInstallDir(otherPath) != otherPath {
+			continue
+		}
+		for _, file := range other.Files {
+			if file.Mode == "-" {
+				candidates[file.Hash] = append(candidates[file.Hash], filepath.Join(otherPath, filepath.FromSlash(file.Path)))
+			}
+		}
+	}
+
+	linked, saved := 0, int64(0)
+	checked := make(map[string]bool)
+	for _, file := range files {
+		if file.Mode != "-" {
+			continue
+		}
+		path := filepath.Join(depPath, filepath.FromSlash(file.Path))
+		for _, candidate := range candidates[file.Hash] {
+			size, ok, err := linkIdentical(path, candidate, file.Hash, checked)
+			if err != nil {
+				debugf("Couldn't link %s to %s: %v\n", path, candidate, err)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			if size > 0 {
+				linked++
+				saved += size
+				debugf("  linked %s to %s\n", path, candidate)
+			}
+			break
+		}
+	}
+	if linked > 0 {
+		infof("Linked %d files of %s to identical ones in other dependencies, saving %s\n", linked, repoURL, formatSize(saved))
+	}
+}
+
+// linkIdentical replaces path with a hardlink to candidate, if candidate
+// still has hash and the same mode, and reports whether it matched and how
+// many bytes linking saved: none when path already is candidate. checked
+// remembers the candidates whose content was verified.
+func linkIdentical(path, candidate, hash string, checked map[string]bool) (int64, bool, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, false, err
+	}
+	candidateInfo, err := os.Lstat(candidate)
+	if err != nil || !candidateInfo.Mode().IsRegular() {
+		return 0, false, nil
+	}
+	if os.SameFile(info, candidateInfo) {
+		return 0, true, nil
+	}
+	if info.Mode().Perm() != candidateInfo.Mode().Perm() || info.Size() != candidateInfo.Size() ||
+		(preserveMtime && !info.ModTime().Equal(candidateInfo.ModTime())) {
+		return 0, false, nil
+	}
+	if !checked[candidate] {
+		if got, err := hashFile(candidate); err != nil || got != hash {
+			return 0, false, nil
+		}
+		checked[candidate] = true
+	}
+
+	tmp := fmt.Sprintf("%s.dedup-%d", path, os.Getpid())
+	os.Remove(tmp)
+	trackTemp(tmp)
+	if err := os.Link(candidate, tmp); err != nil {
+		removeTemp(tmp)
+		return 0, false, err
+	}
+	if err := renameIntoPlace(tmp, path); err != nil {
+		removeTemp(tmp)
+		return 0, false, err
+	}
+	return info.Size(), true, nil
+}
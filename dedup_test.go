@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDedupDependency(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	t.Cleanup(func() { dedupFiles = false })
+	dedupFiles = true
+
+	install := func(repoURL string, files map[string]string) []fileSum {
+		writeTree(t, getDepPath(repoURL), files)
+		sums, err := hashTreeFiles(getDepPath(repoURL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := recordSums(repoURL, "abc123def456abc123def456abc123def456abc1", sums); err != nil {
+			t.Fatal(err)
+		}
+		return sums
+	}
+	install("github.com/owner/a", map[string]string{"LICENSE": "MIT", "edited.txt": "original", "run.sh": "echo", "a.c": "int a;"})
+	os.WriteFile(filepath.Join(getDepPath("github.com/owner/a"), "edited.txt"), []byte("changed!"), 0644)
+	os.Chmod(filepath.Join(getDepPath("github.com/owner/a"), "run.sh"), 0755)
+
+	files := install("github.com/owner/b", map[string]string{"LICENSE": "MIT", "edited.txt": "original", "run.sh": "echo", "b.c": "int b;"})
+	dedupDependency("github.com/owner/b", files)
+
+	same := func(name string) bool {
+		a, _ := os.Stat(filepath.Join(getDepPath("github.com/owner/a"), name))
+		b, _ := os.Stat(filepath.Join(getDepPath("github.com/owner/b"), name))
+		return a != nil && b != nil && os.SameFile(a, b)
+	}
+	if !same("LICENSE") {
+		t.Error("LICENSE should be linked between the dependencies")
+	}
+	if same("edited.txt") {
+		t.Error("edited.txt changed in a since it was installed, and shouldn't be linked")
+	}
+	if same("run.sh") {
+		t.Error("run.sh has another mode in a, and shouldn't be linked")
+	}
+	if data, _ := os.ReadFile(filepath.Join(getDepPath("github.com/owner/b"), "edited.txt")); string(data) != "original" {
+		t.Errorf("b's edited.txt = %q, want its own content", data)
+	}
+
+	// Turned off, nothing is linked
+	dedupFiles = false
+	files = install("github.com/owner/c", map[string]string{"LICENSE": "MIT"})
+	dedupDependency("github.com/owner/c", files)
+	a, _ := os.Stat(filepath.Join(getDepPath("github.com/owner/a"), "LICENSE"))
+	c, _ := os.Stat(filepath.Join(getDepPath("github.com/owner/c"), "LICENSE"))
+	if os.SameFile(a, c) {
+		t.Error("with dedup off, LICENSE shouldn't be linked")
+	}
+}
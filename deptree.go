@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// depNode is a dependency in the dependency graph and the repositories it
+// pulls in. Dependencies only pull in their git submodules, since lock
+// entries never refer to each other.
+type depNode struct {
+	Repo     string // the lock entry, or github.com/owner/repo for a submodule
+	Ref      string // empty for submodules, which are pinned by their parent
+	SHA      string
+	Path     string // for submodules, where it is installed inside the top-level dependency
+	Children []depNode
+}
+
+// dependencyTree returns the dependencies of lockFile, sorted by URL, with
+// the submodules installed with them. Submodules are found offline from the
+// installed .gitmodules files, so only installed dependencies fetched with
+// submodules have children, and submodules of a subdirectory install, whose
+// .gitmodules lives outside it, aren't known.
+func dependencyTree(lockFile *LockFile) []depNode {
+	var nodes []depNode
+	for _, repoURL := range sortedKeys(lockFile.Dependencies) {
+		dep := lockFile.Dependencies[repoURL]
+		node := depNode{Repo: repoURL, Ref: dep.Ref, SHA: dep.SHA}
+		base, subdir := splitSubdir(repoURL)
+		if owner, repo, err := parseGitHubURL(base); err == nil && dep.Submodules && subdir == "" {
+			node.Children = submoduleNodes(owner, repo, getDepPath(repoURL), "", 0)
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// submoduleNodes returns the submodules installed in dir, a checkout of
+// owner/repo at relPath inside its top-level dependency
+func submoduleNodes(owner, repo, dir, relPath string, depth int) []depNode {
+	if depth >= maxSubmoduleDepth {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ".gitmodules"))
+	if err != nil {
+		return nil
+	}
+
+	var nodes []depNode
+	for _, sub := range parseGitmodules(string(data)) {
+		if sub.Path == "" || sub.URL == "" || validateSubdir(sub.Path) != nil {
+			continue
+		}
+		subOwner, subRepo, err := submoduleGitHubRepo(owner, repo, sub.URL)
+		if err != nil {
+			continue
+		}
+		subDir := filepath.Join(dir, filepath.FromSlash(sub.Path))
+		if entries, err := os.ReadDir(subDir); err != nil || len(entries) == 0 {
+			// Not downloaded
+			continue
+		}
+		subPath := path.Join(relPath, sub.Path)
+		nodes = append(nodes, depNode{
+			Repo:     "github.com/" + subOwner + "/" + subRepo,
+			Path:     subPath,
+			Children: submoduleNodes(subOwner, subRepo, subDir, subPath, depth+1),
+		})
+	}
+	return nodes
+}
+
+// matchesRepo reports whether the graph node is the repository target, a
+// lock key or a repository URL in any form normalizeRepoURL accepts. A
+// subdirectory or named entry matches its whole repository.
+func (node depNode) matchesRepo(target string) bool {
+	target = normalizeRepoURL(target)
+	base, _ := splitSubdir(node.Repo)
+	return node.Repo == target || base == target
+}
+
+// findDependents returns every path through the graph from a top-level
+// dependency to target, each starting with the dependency that pulls it in
+func findDependents(nodes []depNode, target string) [][]depNode {
+	var paths [][]depNode
+	var walk func(node depNode, trail []depNode)
+	walk = func(node depNode, trail []depNode) {
+		trail = append(append([]depNode(nil), trail...), node)
+		if node.matchesRepo(target) {
+			paths = append(paths, trail)
+		}
+		for _, child := range node.Children {
+			walk(child, trail)
+		}
+	}
+	for _, node := range nodes {
+		walk(node, nil)
+	}
+	return paths
+}
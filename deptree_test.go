@@ -0,0 +1,55 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDependencyTree(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	lockFile := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/user/app":   {Ref: "main", SHA: "1111111111111111111111111111111111111111", Submodules: true},
+		"github.com/user/plain": {Ref: "main", SHA: "2222222222222222222222222222222222222222"},
+	}}
+	app := filepath.Join(".deps", "github.com", "user", "app")
+	writeTree(t, app, map[string]string{
+		".gitmodules": "[submodule \"lib\"]\n\tpath = vendor/lib\n\turl = https://github.com/other/lib.git\n" +
+			"[submodule \"empty\"]\n\tpath = vendor/empty\n\turl = ../empty\n",
+		"vendor/lib/.gitmodules": "[submodule \"deep\"]\n\tpath = deep\n\turl = git@github.com:deep/dep.git\n",
+		"vendor/lib/lib.c":       "lib",
+		"vendor/lib/deep/dep.c":  "dep",
+	})
+	// A submodule GitHub left empty because it wasn't downloaded
+	writeTree(t, filepath.Join(app, "vendor", "empty"), map[string]string{})
+	// Without submodules: true, .gitmodules isn't followed
+	writeTree(t, filepath.Join(".deps", "github.com", "user", "plain"), map[string]string{
+		".gitmodules": "[submodule \"x\"]\n\tpath = x\n\turl = https://github.com/x/x\n",
+		"x/x.c":       "x",
+	})
+
+	nodes := dependencyTree(lockFile)
+	if len(nodes) != 2 || nodes[0].Repo != "github.com/user/app" || len(nodes[1].Children) != 0 {
+		t.Fatalf("nodes = %+v", nodes)
+	}
+	children := nodes[0].Children
+	if len(children) != 1 || children[0].Repo != "github.com/other/lib" || children[0].Path != "vendor/lib" {
+		t.Fatalf("app children = %+v", children)
+	}
+	deep := children[0].Children
+	if len(deep) != 1 || deep[0].Repo != "github.com/deep/dep" || deep[0].Path != "vendor/lib/deep" {
+		t.Errorf("lib children = %+v", deep)
+	}
+
+	paths := findDependents(nodes, "https://github.com/deep/dep.git")
+	if len(paths) != 1 || len(paths[0]) != 3 || paths[0][0].Repo != "github.com/user/app" {
+		t.Errorf("findDependents = %+v", paths)
+	}
+	if paths := findDependents(nodes, "github.com/user/plain"); len(paths) != 1 || len(paths[0]) != 1 {
+		t.Errorf("direct dependency paths = %+v", paths)
+	}
+	if paths := findDependents(nodes, "github.com/x/x"); len(paths) != 0 {
+		t.Errorf("unfollowed submodule found: %+v", paths)
+	}
+}
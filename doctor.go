@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// doctorCheck is the outcome of one deps doctor check
+type doctorCheck struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+// Outcomes of a check: only failures make deps doctor exit non-zero
+const (
+	doctorOK   = "ok"
+	doctorWarn = "warn"
+	doctorFail = "fail"
+)
+
+// Thresholds for the network checks
+const (
+	maxClockSkew        = 5 * time.Minute
+	tokenExpiryWarning  = 7 * 24 * time.Hour
+	unauthenticatedRate = 60
+)
+
+// selfOwner and selfRepo are where deps releases are published
+const (
+	selfOwner = "moomerman"
+	selfRepo  = "deps"
+)
+
+// proxyVariables are where Go's HTTP client takes its proxies from
+var proxyVariables = []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"}
+
+// runDoctorChecks runs every check, those that need the network last
+func runDoctorChecks() []doctorCheck {
+	checks := []doctorCheck{lockFileCheck(), depsDirCheck(), proxyCheck()}
+	checks = append(checks, githubChecks()...)
+	return append(checks, versionCheck())
+}
+
+// lockFileCheck reports whether the lock file in use parses and validates
+func lockFileCheck() doctorCheck {
+	check := doctorCheck{Name: "Lock file"}
+	path := lockFilePath()
+	data, err := readLockData()
+	switch {
+	case err != nil:
+		check.Status, check.Detail = doctorFail, fmt.Sprintf("can't read %s: %v", path, err)
+	case data == nil:
+		check.Status, check.Detail = doctorWarn, fmt.Sprintf("no %s here (run 'deps init')", path)
+	default:
+		var summary statusSummary
+		lockFileState(&summary, path, data)
+		check.Status, check.Detail = doctorOK, fmt.Sprintf("%s is valid", path)
+		if summary.Problems > 0 {
+			check.Status, check.Detail = doctorFail, fmt.Sprintf("%s has %d problems (run 'deps validate %s')", path, summary.Problems, path)
+		}
+	}
+	return check
+}
+
+// depsDirCheck reports whether dependencies can be installed into .deps,
+// or into the directory it would be created in if it doesn't exist yet
+func depsDirCheck() doctorCheck {
+	check := doctorCheck{Name: depsDir + " directory"}
+	dir := depsDir
+	info, err := os.Stat(dir)
+	for os.IsNotExist(err) && filepath.Dir(dir) != dir {
+		dir = filepath.Dir(dir)
+		info, err = os.Stat(dir)
+	}
+	switch {
+	case err != nil:
+		check.Status, check.Detail = doctorFail, err.Error()
+		return check
+	case !info.IsDir():
+		check.Status, check.Detail = doctorFail, dir+" exists but isn't a directory"
+		return check
+	}
+
+	probe, err := os.CreateTemp(dir, ".deps-doctor-*")
+	if err != nil {
+		check.Status, check.Detail = doctorFail, fmt.Sprintf("%s isn't writable: %v", dir, err)
+		return check
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	check.Status, check.Detail = doctorOK, depsDir+" is writable"
+	if dir != depsDir {
+		check.Detail = depsDir + " doesn't exist yet, and can be created"
+	}
+	return check
+}
+
+// proxyCheck reports proxy settings Go's HTTP client would reject, which
+// it does by failing every request
+func proxyCheck() doctorCheck {
+	check := doctorCheck{Name: "Proxy"}
+	var used []string
+	for _, name := range proxyVariables {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		if err := validateProxyURL(value); err != nil {
+			check.Status, check.Detail = doctorFail, fmt.Sprintf("%s: %v", name, err)
+			return check
+		}
+		used = append(used, name+"="+value)
+	}
+
+	check.Status, check.Detail = doctorOK, "none configured"
+	if len(used) > 0 {
+		check.Detail = strings.Join(used, ", ")
+	}
+	return check
+}
+
+// validateProxyURL parses a proxy setting the way net/http does: a bare
+// host:port means http, and only http, https and socks5 proxies work
+func validateProxyURL(value string) error {
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+	proxyURL, err := url.Parse(value)
+	if err != nil || proxyURL.Host == "" {
+		return fmt.Errorf("invalid proxy address %q", value)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return nil
+	}
+	return fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+}
+
+// gitHubRateLimit is the subset of the rate limit API response we use
+type gitHubRateLimit struct {
+	Resources struct {
+		Core struct {
+			Limit     int   `json:"limit"`
+			Remaining int   `json:"remaining"`
+			Reset     int64 `json:"reset"`
+		} `json:"core"`
+	} `json:"resources"`
+}
+
+// githubChecks checks the token, rate limit and clock against one request
+// to the rate limit API, which doesn't itself count against the limit
+func githubChecks() []doctorCheck {
+	token := doctorCheck{Name: "GitHub token"}
+	rate := doctorCheck{Name: "Rate limit"}
+	clock := doctorCheck{Name: "Clock"}
+
+	resp, err := httpClient.Get(githubAPIBaseURL + "/rate_limit")
+	if err != nil {
+		detail := fmt.Sprintf("can't reach GitHub: %v", err)
+		if proxy := proxyCheck(); proxy.Status == doctorOK && proxy.Detail != "none configured" {
+			detail += " (through " + proxy.Detail + ")"
+		}
+		return []doctorCheck{{Name: "GitHub", Status: doctorFail, Detail: detail}}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return []doctorCheck{{Name: "GitHub", Status: doctorFail, Detail: fmt.Sprintf("reading the response: %v", err)}}
+	}
+
+	clock.Status, clock.Detail = doctorOK, "in sync with GitHub"
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err != nil {
+		clock.Status, clock.Detail = doctorWarn, "GitHub sent no usable Date header to compare with"
+	} else if skew := time.Since(date); skew > maxClockSkew || skew < -maxClockSkew {
+		clock.Status, clock.Detail = doctorFail, fmt.Sprintf("%s off GitHub's clock; rate limit resets and signed download URLs will be wrong", skew.Round(time.Second))
+	}
+
+	configured, tokenErr := githubToken()
+	authenticated := configured != ""
+	switch {
+	case tokenErr != nil:
+		token.Status, token.Detail = doctorFail, tokenErr.Error()
+	case resp.StatusCode == http.StatusUnauthorized:
+		token.Status, token.Detail = doctorFail, "GITHUB_TOKEN was rejected; it is invalid, revoked or expired"
+		return []doctorCheck{token, clock}
+	case !authenticated:
+		token.Status, token.Detail = doctorWarn, fmt.Sprintf("GITHUB_TOKEN isn't set; GitHub allows %d requests an hour without one", unauthenticatedRate)
+	default:
+		token.Status, token.Detail = doctorOK, "GITHUB_TOKEN is accepted"
+		if expiry, err := time.Parse("2006-01-02 15:04:05 MST", resp.Header.Get("GitHub-Authentication-Token-Expiration")); err == nil {
+			token.Detail += fmt.Sprintf(", expires %s", expiry.Format("2006-01-02"))
+			if time.Until(expiry) < tokenExpiryWarning {
+				token.Status = doctorWarn
+			}
+		}
+	}
+
+	var limits gitHubRateLimit
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(body, &limits) != nil {
+		rate.Status, rate.Detail = doctorFail, githubAPIError(resp).Error()
+		return []doctorCheck{token, rate, clock}
+	}
+	core := limits.Resources.Core
+	rate.Status, rate.Detail = doctorOK, fmt.Sprintf("%d of %d requests left", core.Remaining, core.Limit)
+	if core.Remaining == 0 {
+		rate.Status = doctorFail
+		rate.Detail = (&rateLimitError{Reset: time.Unix(core.Reset, 0), Authenticated: authenticated}).Error()
+	} else if core.Remaining < core.Limit/10 {
+		rate.Status = doctorWarn
+		rate.Detail += fmt.Sprintf(", resets at %s", time.Unix(core.Reset, 0).Local().Format("15:04:05"))
+	}
+	return []doctorCheck{token, rate, clock}
+}
+
+// versionCheck compares this binary with the latest deps release
+func versionCheck() doctorCheck {
+	check := doctorCheck{Name: "deps version"}
+	current, ok := parseSemver(version)
+	if !ok {
+		check.Status, check.Detail = doctorOK, fmt.Sprintf("%s build, not compared with releases", version)
+		return check
+	}
+	tag, err := getLatestReleaseTag(selfOwner, selfRepo)
+	if err != nil {
+		check.Status, check.Detail = doctorWarn, fmt.Sprintf("couldn't look up the latest release: %v", err)
+		return check
+	}
+	latest, ok := parseSemver(tag)
+
+	check.Status, check.Detail = doctorOK, fmt.Sprintf("%s is the latest release", version)
+	if ok && compareSemver(latest, current) > 0 {
+		check.Status, check.Detail = doctorWarn, fmt.Sprintf("%s is installed, %s is available", version, tag)
+	}
+	return check
+}
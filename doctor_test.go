@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockFileCheck(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	if check := lockFileCheck(); check.Status != doctorWarn {
+		t.Errorf("without a lock file: %+v, want a warning", check)
+	}
+
+	os.WriteFile(jsonLockFile, []byte(`{"version": 1, "dependencies": {}}`+"\n"), 0644)
+	if check := lockFileCheck(); check.Status != doctorOK {
+		t.Errorf("valid lock file: %+v", check)
+	}
+
+	os.WriteFile(jsonLockFile, []byte(`{"dependencies": {"github.com/a/b": {"ref": "main", "sha": "nope"}}}`), 0644)
+	if check := lockFileCheck(); check.Status != doctorFail || !strings.Contains(check.Detail, "deps validate") {
+		t.Errorf("invalid lock file: %+v, want a failure pointing at deps validate", check)
+	}
+}
+
+func TestDepsDirCheck(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	if check := depsDirCheck(); check.Status != doctorOK || !strings.Contains(check.Detail, "doesn't exist yet") {
+		t.Errorf("without .deps: %+v", check)
+	}
+	os.Mkdir(".deps", 0755)
+	if check := depsDirCheck(); check.Status != doctorOK {
+		t.Errorf("writable .deps: %+v", check)
+	}
+	if entries, _ := os.ReadDir(".deps"); len(entries) != 0 {
+		t.Errorf("check left %d files in .deps", len(entries))
+	}
+	os.Remove(".deps")
+	os.WriteFile(".deps", nil, 0644)
+	if check := depsDirCheck(); check.Status != doctorFail {
+		t.Errorf(".deps file: %+v, want a failure", check)
+	}
+}
+
+func TestValidateProxyURL(t *testing.T) {
+	for value, valid := range map[string]bool{
+		"http://proxy.example.com:3128": true,
+		"proxy.example.com:3128":        true,
+		"socks5://localhost:1080":       true,
+		"ftp://proxy.example.com":       false,
+		"http://":                       false,
+	} {
+		if err := validateProxyURL(value); (err == nil) != valid {
+			t.Errorf("validateProxyURL(%q) = %v, want valid %v", value, err, valid)
+		}
+	}
+}
+
+func TestGitHubChecks(t *testing.T) {
+	reset := time.Now().Add(30 * time.Minute).Unix()
+	var status, remaining int
+	var date time.Time
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rate_limit", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", date.UTC().Format(http.TimeFormat))
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"resources": {"core": {"limit": 5000, "remaining": %d, "reset": %d}}}`, remaining, reset)
+	})
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	byName := func() map[string]doctorCheck {
+		checks := make(map[string]doctorCheck)
+		for _, check := range githubChecks() {
+			checks[check.Name] = check
+		}
+		return checks
+	}
+
+	t.Setenv("GITHUB_TOKEN", "")
+	status, remaining, date = 200, 4000, time.Now()
+	checks := byName()
+	if checks["GitHub token"].Status != doctorWarn || checks["Rate limit"].Status != doctorOK || checks["Clock"].Status != doctorOK {
+		t.Errorf("unauthenticated: %+v", checks)
+	}
+
+	t.Setenv("GITHUB_TOKEN", "secret")
+	status, remaining, date = 200, 0, time.Now().Add(-time.Hour)
+	checks = byName()
+	if checks["GitHub token"].Status != doctorOK || checks["Rate limit"].Status != doctorFail || checks["Clock"].Status != doctorFail {
+		t.Errorf("exhausted limit and skewed clock: %+v", checks)
+	}
+
+	status, date = 401, time.Now()
+	checks = byName()
+	if checks["GitHub token"].Status != doctorFail {
+		t.Errorf("rejected token: %+v", checks)
+	}
+}
+
+func TestVersionCheck(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/moomerman/deps/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"tag_name": "v1.3.0"}`))
+	})
+	restore := testGitHubServer(t, mux)
+	defer restore()
+	defer func(v string) { version = v }(version)
+
+	for v, want := range map[string]string{"dev": doctorOK, "v1.3.0": doctorOK, "v1.2.9": doctorWarn} {
+		version = v
+		if check := versionCheck(); check.Status != want {
+			t.Errorf("version %s: %+v, want %s", v, check, want)
+		}
+	}
+}
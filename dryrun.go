@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// dryRun is set by --dry-run: commands report what they would download,
+// write and delete, and do none of it
+var dryRun bool
+
+// dryRunCommands are the commands that support --dry-run
+var dryRunCommands = []string{"get", "install", "update", "remove", "prune", "self-update", "cache"}
+
+// configureDryRun makes command a dry run when enabled. Other commands
+// would go ahead and make their changes, so they refuse it instead.
+func configureDryRun(enabled bool, command string) error {
+	if enabled && !slices.Contains(dryRunCommands, command) {
+		return fmt.Errorf("--dry-run only works with deps %s", strings.Join(dryRunCommands, ", "))
+	}
+	dryRun = enabled
+	return nil
+}
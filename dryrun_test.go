@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigureDryRun(t *testing.T) {
+	defer func() { dryRun = false }()
+
+	for _, command := range dryRunCommands {
+		if err := configureDryRun(true, command); err != nil {
+			t.Errorf("%s: unexpected error: %v", command, err)
+		}
+	}
+	if err := configureDryRun(true, "sync"); err == nil {
+		t.Error("expected an error for deps sync --dry-run")
+	}
+	if err := configureDryRun(false, "sync"); err != nil || dryRun {
+		t.Errorf("without --dry-run: err = %v, dryRun = %v", err, dryRun)
+	}
+}
+
+func TestInstallDependencies_DryRun(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	resetResults(t)
+	dryRun = true
+	defer func() { dryRun = false }()
+
+	requested := false
+	restore := testGitHubServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer restore()
+
+	present := filepath.Join(".deps", "github.com", "testowner", "present")
+	writeTree(t, present, map[string]string{"README.md": "# Present"})
+	lockFile := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/testowner/missing": {Ref: "main", SHA: "abc1234567"},
+		"github.com/testowner/present": {Ref: "main", SHA: "def1234567"},
+	}}
+
+	stdout, _ := captureOutput(t, func() {
+		installDependencies(lockFile, func(repoURL string, dep Dependency) string {
+			return "installed for another profile"
+		})
+	})
+
+	if requested {
+		t.Error("a dry run made a request")
+	}
+	if _, err := os.Stat(getDepPath("github.com/testowner/missing")); !os.IsNotExist(err) {
+		t.Errorf("a dry run installed github.com/testowner/missing (%v)", err)
+	}
+	if _, err := os.Stat(filepath.Join(present, "README.md")); err != nil {
+		t.Errorf("a dry run removed github.com/testowner/present: %v", err)
+	}
+	for _, want := range []string{
+		"Would download github.com/testowner/missing@main (abc12345) into " + getDepPath("github.com/testowner/missing"),
+		"Would reinstall github.com/testowner/present: installed for another profile",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("output %q doesn't contain %q", stdout, want)
+		}
+	}
+}
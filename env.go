@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Shells deps env writes for. bash covers any POSIX shell.
+const (
+	shellBash       = "bash"
+	shellFish       = "fish"
+	shellPowerShell = "powershell"
+)
+
+// defaultShell guesses the shell deps env is evaluated by: PowerShell on
+// Windows, fish if it is the login shell, and otherwise a POSIX shell
+func defaultShell() string {
+	if runtime.GOOS == "windows" {
+		return shellPowerShell
+	}
+	if filepath.Base(os.Getenv("SHELL")) == shellFish {
+		return shellFish
+	}
+	return shellBash
+}
+
+// dependencyBinDirs returns the absolute paths of the bin directories of
+// the installed dependencies of lockFile, sorted by URL, for PATH
+func dependencyBinDirs(lockFile *LockFile) ([]string, error) {
+	var dirs []string
+	for _, repoURL := range sortedKeys(lockFile.Dependencies) {
+		dir := filepath.Join(getDepPath(repoURL), "bin")
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, abs)
+	}
+	return dirs, nil
+}
+
+// prependPath returns the PATH value with dirs in front of current
+func prependPath(dirs []string, current string) string {
+	if current == "" {
+		return strings.Join(dirs, string(os.PathListSeparator))
+	}
+	return strings.Join(append(append([]string(nil), dirs...), current), string(os.PathListSeparator))
+}
+
+// shellExports renders env, a list of NAME=value, and dirs to put in front
+// of PATH as statements for shell, one per line
+func shellExports(shell string, env []string, dirs []string) (string, error) {
+	var b strings.Builder
+	for _, entry := range env {
+		name, value, _ := strings.Cut(entry, "=")
+		switch shell {
+		case shellBash:
+			fmt.Fprintf(&b, "export %s=%s\n", name, posixQuote(value))
+		case shellFish:
+			fmt.Fprintf(&b, "set -gx %s %s\n", name, fishQuote(value))
+		case shellPowerShell:
+			fmt.Fprintf(&b, "$env:%s = %s\n", name, powerShellQuote(value))
+		default:
+			return "", fmt.Errorf("unknown shell %q (use %s, %s or %s)", shell, shellBash, shellFish, shellPowerShell)
+		}
+	}
+	if len(dirs) == 0 {
+		return b.String(), nil
+	}
+
+	separator := string(os.PathListSeparator)
+	switch shell {
+	case shellBash:
+		fmt.Fprintf(&b, "export PATH=%s%s\"$PATH\"\n", posixQuote(strings.Join(dirs, separator)), separator)
+	case shellFish:
+		// fish keeps PATH as a list
+		quoted := make([]string, len(dirs))
+		for i, dir := range dirs {
+			quoted[i] = fishQuote(dir)
+		}
+		fmt.Fprintf(&b, "set -gx PATH %s $PATH\n", strings.Join(quoted, " "))
+	case shellPowerShell:
+		fmt.Fprintf(&b, "$env:PATH = %s + $env:PATH\n", powerShellQuote(strings.Join(dirs, separator)+separator))
+	}
+	return b.String(), nil
+}
+
+// posixQuote single-quotes s, closing the quotes around any ' in it
+func posixQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// fishQuote single-quotes s; fish allows \' and \\ inside single quotes
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
+
+// powerShellQuote single-quotes s, doubling any ' in it
+func powerShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShellExports(t *testing.T) {
+	env := []string{"DEPS_GITHUB_COM_USER_REPO=/home/o'neil/.deps/repo"}
+	dirs := []string{"/home/o'neil/.deps/repo/bin"}
+	sep := string(os.PathListSeparator)
+
+	tests := map[string]string{
+		shellBash:       "export DEPS_GITHUB_COM_USER_REPO='/home/o'\\''neil/.deps/repo'\nexport PATH='/home/o'\\''neil/.deps/repo/bin'" + sep + "\"$PATH\"\n",
+		shellFish:       "set -gx DEPS_GITHUB_COM_USER_REPO '/home/o\\'neil/.deps/repo'\nset -gx PATH '/home/o\\'neil/.deps/repo/bin' $PATH\n",
+		shellPowerShell: "$env:DEPS_GITHUB_COM_USER_REPO = '/home/o''neil/.deps/repo'\n$env:PATH = '/home/o''neil/.deps/repo/bin" + sep + "' + $env:PATH\n",
+	}
+	for shell, want := range tests {
+		got, err := shellExports(shell, env, dirs)
+		if err != nil {
+			t.Fatalf("shellExports(%s) error: %v", shell, err)
+		}
+		if got != want {
+			t.Errorf("shellExports(%s) =\n%s\nwant\n%s", shell, got, want)
+		}
+	}
+
+	if got, _ := shellExports(shellBash, env, nil); strings.Contains(got, "PATH") {
+		t.Errorf("PATH set without bin directories:\n%s", got)
+	}
+	if _, err := shellExports("tcsh", env, dirs); err == nil {
+		t.Error("expected an error for an unknown shell")
+	}
+}
+
+func TestDependencyBinDirs(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	dir, _ := os.Getwd()
+
+	writeTree(t, ".deps/github.com/user/tool", map[string]string{"bin/tool": "#!/bin/sh"})
+	writeTree(t, ".deps/github.com/user/lib", map[string]string{"lib.h": ""})
+	lockFile := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/user/lib":     {Ref: "main"},
+		"github.com/user/tool":    {Ref: "main"},
+		"github.com/user/missing": {Ref: "main"},
+	}}
+
+	dirs, err := dependencyBinDirs(lockFile)
+	if err != nil {
+		t.Fatalf("dependencyBinDirs error: %v", err)
+	}
+	want := []string{filepath.Join(dir, ".deps", "github.com", "user", "tool", "bin")}
+	if !reflect.DeepEqual(dirs, want) {
+		t.Errorf("dirs = %v, want %v", dirs, want)
+	}
+}
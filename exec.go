@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// envVarName returns the environment variable deps exec sets to where the
+// dependency at repoURL is installed: DEPS_ and the lock key in upper case,
+// with every run of other characters as one underscore, like
+// DEPS_GITHUB_COM_USER_REPO
+func envVarName(repoURL string) string {
+	var b strings.Builder
+	b.WriteString("DEPS")
+	separated := false
+	for _, r := range repoURL {
+		switch {
+		case r >= 'a' && r <= 'z':
+			r -= 'a' - 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		default:
+			separated = true
+			continue
+		}
+		if separated || b.Len() == len("DEPS") {
+			b.WriteByte('_')
+			separated = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// dependencyEnv returns NAME=path for every dependency of lockFile, sorted,
+// with absolute paths so they work from any directory. Two keys that only
+// differ in punctuation would share a name, which is an error.
+func dependencyEnv(lockFile *LockFile) ([]string, error) {
+	owners := make(map[string]string)
+	var env []string
+	for _, repoURL := range sortedKeys(lockFile.Dependencies) {
+		name := envVarName(repoURL)
+		if other, taken := owners[name]; taken {
+			return nil, fmt.Errorf("%s and %s would both be %s", other, repoURL, name)
+		}
+		owners[name] = repoURL
+
+		path, err := filepath.Abs(getDepPath(repoURL))
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, name+"="+path)
+	}
+	sort.Strings(env)
+	return env, nil
+}
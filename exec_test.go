@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEnvVarName(t *testing.T) {
+	tests := map[string]string{
+		"github.com/user/repo":                  "DEPS_GITHUB_COM_USER_REPO",
+		"github.com/User/my-repo.go":            "DEPS_GITHUB_COM_USER_MY_REPO_GO",
+		"github.com/org/monorepo//packages/foo": "DEPS_GITHUB_COM_ORG_MONOREPO_PACKAGES_FOO",
+		"github.com/user/repo#fork":             "DEPS_GITHUB_COM_USER_REPO_FORK",
+		"dev.azure.com/org/project/_git/repo":   "DEPS_DEV_AZURE_COM_ORG_PROJECT_GIT_REPO",
+	}
+	for repoURL, want := range tests {
+		if got := envVarName(repoURL); got != want {
+			t.Errorf("envVarName(%q) = %q, want %q", repoURL, got, want)
+		}
+	}
+}
+
+func TestDependencyEnv(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	defer func() { depAliases = make(map[string]string) }()
+	dir, _ := os.Getwd()
+
+	depAliases["github.com/user/lib"] = "lib"
+	lockFile := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/user/repo": {Ref: "main", SHA: "abc123def456abc123def456abc123def456abc1"},
+		"github.com/user/lib":  {Ref: "main", SHA: "abc123def456abc123def456abc123def456abc1", Alias: "lib"},
+	}}
+	env, err := dependencyEnv(lockFile)
+	if err != nil {
+		t.Fatalf("dependencyEnv error: %v", err)
+	}
+	want := []string{
+		"DEPS_GITHUB_COM_USER_LIB=" + filepath.Join(dir, ".deps", "lib"),
+		"DEPS_GITHUB_COM_USER_REPO=" + filepath.Join(dir, ".deps", "github.com", "user", "repo"),
+	}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("env = %v, want %v", env, want)
+	}
+
+	lockFile.Dependencies["github.com/user/re-po"] = Dependency{Ref: "main"}
+	lockFile.Dependencies["github.com/user/re_po"] = Dependency{Ref: "main"}
+	if _, err := dependencyEnv(lockFile); err == nil {
+		t.Error("expected an error for keys sharing a variable name")
+	}
+}
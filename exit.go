@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// Exit codes, so that CI can tell kinds of failure apart. An interrupted or
+// timed out command exits with 130.
+const (
+	exitOK         = 0
+	exitUsage      = 1 // bad arguments, and failures that fit nothing below
+	exitMissing    = 2 // dependencies that aren't installed
+	exitNetwork    = 3 // a host couldn't be reached or refused the request
+	exitIntegrity  = 4 // files that don't match what the lock file records
+	exitVulnerable = 5 // dependencies with known vulnerabilities (deps audit)
+)
+
+// exitCode is the code the running command exits with once it has finished
+// with every dependency
+var exitCode = exitOK
+
+// setExitCode records a failure. Higher codes win, so that one integrity
+// failure isn't hidden behind any number of network errors.
+func setExitCode(code int) {
+	exitCode = max(exitCode, code)
+}
+
+// exitWithCode exits with the code recorded by setExitCode, if there is one
+func exitWithCode() {
+	if exitCode != exitOK {
+		os.Exit(exitCode)
+	}
+}
+
+// statusError is an HTTP response other than the one a request expected
+type statusError struct {
+	Service    string
+	StatusCode int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s returned status %d", e.Service, e.StatusCode)
+}
+
+// exitCodeFor returns the exit code for a command that failed with err
+func exitCodeFor(err error) int {
+	var mismatch *checksumError
+	var rateLimit *rateLimitError
+	var status *statusError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errNotInstalled):
+		return exitMissing
+	case errors.As(err, &mismatch):
+		return exitIntegrity
+	case errors.As(err, &rateLimit), errors.As(err, &status), errors.As(err, &netErr):
+		return exitNetwork
+	}
+	return exitUsage
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExitCodeFor(t *testing.T) {
+	mux := http.NewServeMux()
+	restore := testGitHubServer(t, mux)
+	unreachable := githubAPIBaseURL
+	restore()
+	_, netErr := http.Get(unreachable)
+	if netErr == nil {
+		t.Fatal("expected an error from a closed server")
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"other", errors.New("invalid constraint"), exitUsage},
+		{"not installed", fmt.Errorf("github.com/user/repo: %w", errNotInstalled), exitMissing},
+		{"connection refused", fmt.Errorf("resolving ref main: %w", netErr), exitNetwork},
+		{"status", fmt.Errorf("listing tags: %w", &statusError{Service: "GitHub API", StatusCode: 401}), exitNetwork},
+		{"rate limit", &rateLimitError{Reset: time.Now()}, exitNetwork},
+		{"checksum", fmt.Errorf("submodule lib: %w", &checksumError{What: "hash", Expected: "aa", Got: "bb"}), exitIntegrity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCodeFor(tt.err); got != tt.want {
+				t.Errorf("exitCodeFor(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetExitCode(t *testing.T) {
+	defer func() { exitCode = exitOK }()
+
+	setExitCode(exitMissing)
+	setExitCode(exitIntegrity)
+	setExitCode(exitNetwork)
+	if exitCode != exitIntegrity {
+		t.Errorf("exitCode = %d, want %d", exitCode, exitIntegrity)
+	}
+}
+
+func TestGitHubAPIError_Status(t *testing.T) {
+	err := githubAPIError(&http.Response{StatusCode: http.StatusNotFound, Header: http.Header{}})
+	if err.Error() != "GitHub API returned status 404" {
+		t.Errorf("error = %q", err)
+	}
+	if exitCodeFor(err) != exitNetwork {
+		t.Errorf("exitCodeFor(%v) = %d, want %d", err, exitCodeFor(err), exitNetwork)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// validateGlob checks that pattern is a valid include or exclude glob
+func validateGlob(pattern string) error {
+	if pattern == "" || strings.HasPrefix(pattern, "/") {
+		return fmt.Errorf("invalid pattern %q (patterns are relative to the dependency)", pattern)
+	}
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchGlob reports whether the slash-separated path name, or any directory
+// it is in, matches pattern. Segments match as in path.Match, and a "**"
+// segment matches any number of directories, so "docs" and "docs/**" both
+// match everything under docs.
+func matchGlob(pattern, name string) bool {
+	patternSegments := strings.Split(pattern, "/")
+	nameSegments := strings.Split(name, "/")
+	for i := 1; i <= len(nameSegments); i++ {
+		if matchSegments(patternSegments, nameSegments[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	matched, _ := path.Match(pattern[0], name[0])
+	return matched && matchSegments(pattern[1:], name[1:])
+}
+
+// keepFile reports whether a file passes the only and exclude patterns of a
+// dependency: it must match one of only (if there are any) and none of exclude
+func keepFile(name string, only, exclude []string) bool {
+	if len(only) > 0 {
+		included := false
+		for _, pattern := range only {
+			included = included || matchGlob(pattern, name)
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, pattern := range exclude {
+		if matchGlob(pattern, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterTree removes the files under dir that don't pass only and exclude,
+// and the directories left empty
+func filterTree(dir string, only, exclude []string) error {
+	var dirs []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" && p != dir {
+				return filepath.SkipDir
+			}
+			if p != dir {
+				dirs = append(dirs, p)
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if keepFile(filepath.ToSlash(rel), only, exclude) {
+			return nil
+		}
+		return os.Remove(p)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Deepest first, so parents are empty by the time they're reached
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if entries, err := os.ReadDir(dirs[i]); err == nil && len(entries) == 0 {
+			os.Remove(dirs[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"src/**", "src/a.c", true},
+		{"src/**", "src/lib/a.c", true},
+		{"src/**", "srcs/a.c", false},
+		{"LICENSE", "LICENSE", true},
+		{"LICENSE", "docs/LICENSE", false},
+		{"docs", "docs/guide/intro.md", true},
+		{"**/*.md", "README.md", true},
+		{"**/*.md", "docs/guide/intro.md", true},
+		{"**/*.md", "docs/guide/intro.txt", false},
+		{"test/**/*_test.go", "test/a/b/x_test.go", true},
+		{"*.h", "include/x.h", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateGlob(t *testing.T) {
+	for _, pattern := range []string{"src/**", "LICENSE", "**/*.[ch]"} {
+		if err := validateGlob(pattern); err != nil {
+			t.Errorf("validateGlob(%q) = %v", pattern, err)
+		}
+	}
+	for _, pattern := range []string{"", "/abs", "src/[", "a\\"} {
+		if err := validateGlob(pattern); err == nil {
+			t.Errorf("validateGlob(%q) accepted an invalid pattern", pattern)
+		}
+	}
+}
+
+func TestFilterTree(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"LICENSE":           "MIT",
+		"README.md":         "readme",
+		"src/a.c":           "a",
+		"src/docs/notes.md": "notes",
+		"docs/guide.md":     "guide",
+		"test/a_test.c":     "test",
+		".git/config":       "git",
+	})
+
+	if err := filterTree(dir, []string{"src/**", "LICENSE"}, []string{"**/docs/**"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var kept []string
+	filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && p != dir {
+			rel, _ := filepath.Rel(dir, p)
+			kept = append(kept, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	want := ".git .git/config LICENSE src src/a.c"
+	if got := strings.Join(kept, " "); got != want {
+		t.Errorf("kept %q, want %q", got, want)
+	}
+}
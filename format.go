@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// normalizeRepoURL rewrites the ways a repository URL is commonly written
+// to the form deps uses: no scheme or "git@" prefix, a lowercase host and no
+// trailing ".git" or "/". Owner and repository names keep their case since
+// they name the directory under .deps.
+func normalizeRepoURL(url string) string {
+	url = strings.TrimSpace(url)
+	for _, prefix := range []string{"https://", "http://", "ssh://git@", "git@"} {
+		url = strings.TrimPrefix(url, prefix)
+	}
+	// scp-style SSH URLs: github.com:user/repo
+	if host, rest, found := strings.Cut(url, ":"); found && !strings.Contains(host, "/") {
+		url = host + "/" + rest
+	}
+
+	url, name := splitEntryName(url)
+	repoURL, subdir := splitSubdir(url)
+	repoURL = strings.TrimSuffix(strings.TrimSuffix(repoURL, "/"), ".git")
+	if host, rest, found := strings.Cut(repoURL, "/"); found {
+		repoURL = strings.ToLower(host) + "/" + rest
+	}
+	return joinEntryName(joinSubdir(repoURL, subdir), name)
+}
+
+// normalizeLockFile rewrites the dependency URLs of lockFile with
+// normalizeRepoURL, carrying TOML comments over to the new keys. It fails if
+// two entries turn out to be the same dependency.
+func normalizeLockFile(lockFile *LockFile) error {
+	deps := make(map[string]Dependency, len(lockFile.Dependencies))
+	for _, repoURL := range sortedKeys(lockFile.Dependencies) {
+		normalized := normalizeRepoURL(repoURL)
+		if _, exists := deps[normalized]; exists {
+			return fmt.Errorf("%s and another entry are both %s; remove one", repoURL, normalized)
+		}
+		deps[normalized] = lockFile.Dependencies[repoURL]
+		if normalized != repoURL {
+			renameTOMLComments(lockFile.comments, []string{"dependencies"}, repoURL, normalized)
+		}
+	}
+	lockFile.Dependencies = deps
+
+	for name, overrides := range lockFile.Profiles {
+		repoURLs := make([]string, 0, len(overrides))
+		for repoURL := range overrides {
+			repoURLs = append(repoURLs, repoURL)
+		}
+		sort.Strings(repoURLs)
+
+		normalizedOverrides := make(map[string]ProfileOverride, len(overrides))
+		for _, repoURL := range repoURLs {
+			normalized := normalizeRepoURL(repoURL)
+			if _, exists := normalizedOverrides[normalized]; exists {
+				return fmt.Errorf("profile %s overrides %s twice; remove one", name, normalized)
+			}
+			override := overrides[repoURL]
+			if override.Repo != "" {
+				override.Repo = normalizeRepoURL(override.Repo)
+			}
+			normalizedOverrides[normalized] = override
+			if normalized != repoURL {
+				renameTOMLComments(lockFile.comments, []string{"profiles", name}, repoURL, normalized)
+			}
+		}
+		lockFile.Profiles[name] = normalizedOverrides
+	}
+	return nil
+}
+
+// renameTOMLComments moves the comments of a dependency table in table, and
+// of its keys, from one repository URL to another
+func renameTOMLComments(comments map[string]tomlComment, table []string, from, to string) {
+	oldPrefix := tomlKeyPath(append(append([]string(nil), table...), from))
+	newPrefix := tomlKeyPath(append(append([]string(nil), table...), to))
+	moved := make(map[string]tomlComment)
+	for key, comment := range comments {
+		rest, found := strings.CutPrefix(key, oldPrefix)
+		if found && (rest == "" || rest[0] == '.') {
+			delete(comments, key)
+			moved[newPrefix+rest] = comment
+		}
+	}
+	for key, comment := range moved {
+		comments[key] = comment
+	}
+}
+
+// formatLockData returns the canonical form of the lock file data read from
+// path, in the format its name implies
+func formatLockData(path string, data []byte) ([]byte, error) {
+	var lockFile *LockFile
+	var err error
+	if isTOMLLockFile(path) {
+		lockFile, _, err = parseTOMLLockFile(data)
+	} else {
+		lockFile, _, err = parseLockFile(data)
+	}
+	if err == nil {
+		err = normalizeLockFile(lockFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	marshal := marshalLockFile
+	if isTOMLLockFile(path) {
+		marshal = marshalTOMLLockFile
+	}
+	lockFile.Version = lockFileVersion
+	return marshal(lockFile)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeRepoURL(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"github.com/user/repo", "github.com/user/repo"},
+		{"https://github.com/user/repo.git", "github.com/user/repo"},
+		{"http://github.com/user/repo/", "github.com/user/repo"},
+		{"git@github.com:user/repo.git", "github.com/user/repo"},
+		{"ssh://git@github.com/user/repo", "github.com/user/repo"},
+		{"GitHub.com/User/Repo", "github.com/User/Repo"},
+		{" github.com/user/repo ", "github.com/user/repo"},
+		{"https://github.com/user/repo.git//pkg/sub/", "github.com/user/repo//pkg/sub"},
+		{"https://dev.azure.com/org/project/_git/repo", "dev.azure.com/org/project/_git/repo"},
+		{"https://github.com/user/repo.git#repo-v1", "github.com/user/repo#repo-v1"},
+	}
+	for _, tt := range tests {
+		if got := normalizeRepoURL(tt.input); got != tt.want {
+			t.Errorf("normalizeRepoURL(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeLockFile(t *testing.T) {
+	lockFile, _, err := parseTOMLLockFile([]byte(`version = 1
+
+# Needed for the Windows build
+[dependencies."https://github.com/user/repo.git"]
+ref = "main" # tracks the fork
+sha = "75ccf94d605a05fe24817fc2f166f6f2959d5cea"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := normalizeLockFile(lockFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := lockFile.Dependencies["github.com/user/repo"]; !exists || len(lockFile.Dependencies) != 1 {
+		t.Errorf("dependencies = %v", lockFile.Dependencies)
+	}
+
+	data, err := marshalTOMLLockFile(lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Needed for the Windows build\n[dependencies.\"github.com/user/repo\"]\nref = \"main\" # tracks the fork\n"
+	if !strings.Contains(string(data), want) {
+		t.Errorf("comments didn't follow the renamed entry:\n%s", data)
+	}
+}
+
+func TestNormalizeLockFile_Duplicates(t *testing.T) {
+	lockFile := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/user/repo":                 {Ref: "main", SHA: "75ccf94d605a05fe24817fc2f166f6f2959d5cea"},
+		"https://github.com/user/repo.git":     {Ref: "v1", SHA: "75ccf94d605a05fe24817fc2f166f6f2959d5cea"},
+		"https://github.com/user/other.git//x": {Ref: "v1", SHA: "75ccf94d605a05fe24817fc2f166f6f2959d5cea"},
+	}}
+
+	err := normalizeLockFile(lockFile)
+	if err == nil || !strings.Contains(err.Error(), "both github.com/user/repo") {
+		t.Errorf("expected a duplicate error, got %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Transports a dependency can be fetched over
+const (
+	transportHTTPS = ""
+	transportSSH   = "ssh"
+)
+
+// gitCommand is the git binary used for SSH fetching
+var gitCommand = "git"
+
+// sshRemoteURL returns the SSH remote of the repository at repoURL, like
+// git@github.com:owner/repo.git or, for Azure DevOps,
+// git@ssh.dev.azure.com:v3/org/project/repo. Mirror rules apply to it as
+// host/path, so github.com=git.example.com/github fetches from
+// ssh://git@git.example.com/github/owner/repo.git instead.
+func sshRemoteURL(repoURL string) (string, error) {
+	var host, remotePath string
+	if isAzureURL(repoURL) {
+		org, project, repo, err := parseAzureURL(repoURL)
+		if err != nil {
+			return "", fmt.Errorf("parsing URL: %v", err)
+		}
+		host, remotePath = "ssh.dev.azure.com", fmt.Sprintf("v3/%s/%s/%s", url.PathEscape(org), url.PathEscape(project), url.PathEscape(repo))
+	} else {
+		owner, repo, err := parseGitHubURL(repoURL)
+		if err != nil {
+			return "", fmt.Errorf("parsing URL: %v", err)
+		}
+		host, remotePath = "github.com", owner+"/"+repo+".git"
+	}
+
+	canonical := &url.URL{Scheme: "ssh", Host: host, Path: "/" + remotePath}
+	remote, err := rewriteURL(mirrorRules, canonical)
+	if err != nil {
+		return "", err
+	}
+	if remote == canonical {
+		return "git@" + host + ":" + remotePath, nil
+	}
+	if remote.Scheme == "ssh" && remote.User == nil {
+		remote.User = url.User("git")
+	}
+	return remote.String(), nil
+}
+
+func resolveRefSSH(repoURL, ref string) (sha, resolvedRef string, err error) {
+	remote, err := sshRemoteURL(repoURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	if ref == "" {
+		// Ask the remote which branch HEAD points to
+		out, err := runGit("", "ls-remote", "--symref", "--", remote, "HEAD")
+		if err != nil {
+			return "", "", err
+		}
+		return resolveFromRefs(parseLsRemote(out), "")
+	}
+
+	if isFullSHA(ref) {
+		return ref, ref, nil
+	}
+
+	out, err := runGit("", "ls-remote", "--", remote, "refs/heads/"+ref, "refs/tags/"+ref, "refs/tags/"+ref+"^{}")
+	if err != nil {
+		return "", "", err
+	}
+	return resolveFromRefs(parseLsRemote(out), ref)
+}
+
+// resolveFromRefs resolves ref against a map of ref name to SHA as returned
+// by parseLsRemote. An empty ref resolves to the branch HEAD points to.
+func resolveFromRefs(refs map[string]string, ref string) (sha, resolvedRef string, err error) {
+	if ref == "" {
+		branch := strings.TrimPrefix(refs["symref:HEAD"], "refs/heads/")
+		if branch == "" || refs["HEAD"] == "" {
+			return "", "", fmt.Errorf("could not determine default branch")
+		}
+		return refs["HEAD"], branch, nil
+	}
+
+	// Branches take precedence over tags, matching resolveRef
+	if sha := refs["refs/heads/"+ref]; sha != "" {
+		return sha, ref, nil
+	}
+	// Prefer the peeled commit for annotated tags
+	if sha := refs["refs/tags/"+ref+"^{}"]; sha != "" {
+		return sha, ref, nil
+	}
+	if sha := refs["refs/tags/"+ref]; sha != "" {
+		return sha, ref, nil
+	}
+
+	return "", "", fmt.Errorf("could not resolve ref '%s' as branch or tag", ref)
+}
+
+// listTagsSSH lists tags over SSH, preferring peeled commits for annotated tags
+func listTagsSSH(repoURL string) ([]tagInfo, error) {
+	remote, err := sshRemoteURL(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	out, err := runGit("", "ls-remote", "--tags", "--", remote)
+	if err != nil {
+		return nil, err
+	}
+	return tagsFromRefs(parseLsRemote(out)), nil
+}
+
+// listBranchesSSH lists branches over SSH
+func listBranchesSSH(repoURL string) ([]tagInfo, error) {
+	remote, err := sshRemoteURL(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	out, err := runGit("", "ls-remote", "--heads", "--", remote)
+	if err != nil {
+		return nil, err
+	}
+	return namedRefs(parseLsRemote(out), "refs/heads/"), nil
+}
+
+// tagsFromRefs extracts tags from a map of ref name to SHA, using the
+// peeled "^{}" entry for annotated tags
+func tagsFromRefs(refs map[string]string) []tagInfo {
+	return namedRefs(refs, "refs/tags/")
+}
+
+// namedRefs returns the refs under prefix sorted by name, with the prefix
+// removed and peeled "^{}" entries preferred
+func namedRefs(refs map[string]string, prefix string) []tagInfo {
+	var named []tagInfo
+	for name, sha := range refs {
+		if !strings.HasPrefix(name, prefix) || strings.HasSuffix(name, "^{}") {
+			continue
+		}
+		if peeled, ok := refs[name+"^{}"]; ok {
+			sha = peeled
+		}
+		named = append(named, tagInfo{Name: strings.TrimPrefix(name, prefix), SHA: sha})
+	}
+	sort.Slice(named, func(i, j int) bool { return named[i].Name < named[j].Name })
+	return named
+}
+
+// parseLsRemote parses `git ls-remote` output into a map of ref name to SHA.
+// Symbolic refs reported by --symref are stored as "symref:<name>" -> target.
+func parseLsRemote(output string) map[string]string {
+	refs := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 3 && fields[0] == "ref:":
+			// ref: refs/heads/main	HEAD
+			refs["symref:"+fields[2]] = fields[1]
+		case len(fields) == 2:
+			refs[fields[1]] = fields[0]
+		}
+	}
+	return refs
+}
+
+// downloadRepoSSH fetches the repository at repoURL at sha over SSH and
+// installs it, or its subdirectory, through the regular extraction path. The
+// archive git produces differs from one git version to the next, so unlike
+// a tarball's it has no hash worth recording: the returned hash is always
+// empty, and the tree hash is what checks the files.
+func downloadRepoSSH(repoURL, sha string) (string, error) {
+	// sha comes from the lock file, and goes on git's command line
+	if !isFullSHA(sha) {
+		return "", fmt.Errorf("invalid commit SHA %q (expected 40 hex characters)", sha)
+	}
+	remote, err := sshRemoteURL(repoURL)
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(depsDir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	// Fetch just the pinned commit into a scratch repository
+	tmpDir, err := mkdirTemp("", "deps-git-*")
+	if err != nil {
+		return "", err
+	}
+	defer removeTemp(tmpDir)
+
+	if _, err := runGit(tmpDir, "init", "-q"); err != nil {
+		return "", err
+	}
+	if _, err := runGit(tmpDir, "fetch", "-q", "--depth", "1", "--", remote, sha); err != nil {
+		return "", err
+	}
+
+	// Produce a tarball with the same layout GitHub uses so it can go
+	// through the regular extraction path
+	baseURL, subdir := splitSubdir(repoURL)
+	name := path.Base(baseURL)
+	prefix := fmt.Sprintf("%s-%s/", name, sha[:7])
+	cmd := exec.CommandContext(runContext, gitCommand, "archive", "--format=tar", "--prefix="+prefix, "FETCH_HEAD")
+	cmd.Dir = tmpDir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	_, label, _ := strings.Cut(baseURL, "/")
+	p := startProgress(label, -1)
+	defer p.finish()
+	reader := p.reader(stdout)
+
+	depPath := getDepPath(repoURL)
+	err = extractTarballSubdir(reader, depPath, subdir)
+	if err != nil {
+		cmd.Wait()
+		return "", err
+	}
+	// Drain anything after the tar end marker so git archive can exit
+	io.Copy(io.Discard, reader)
+	if err := cmd.Wait(); err != nil {
+		return "", fmt.Errorf("git archive: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	infof("Downloaded to %s\n", depPath)
+	return "", nil
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(runContext, gitCommand, args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
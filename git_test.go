@@ -0,0 +1,188 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// --- parseLsRemote tests ---
+
+func TestParseLsRemote(t *testing.T) {
+	output := "ref: refs/heads/main\tHEAD\n" +
+		"abc123def456abc123def456abc123def456abc1\tHEAD\n" +
+		"1111222233334444555566667777888899990000\trefs/heads/develop\n" +
+		"aabbccdd00112233aabbccdd00112233aabbccdd\trefs/tags/v1.0.0\n" +
+		"deadbeef12345678deadbeef12345678deadbeef\trefs/tags/v1.0.0^{}\n"
+
+	refs := parseLsRemote(output)
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"symref:HEAD", "refs/heads/main"},
+		{"HEAD", "abc123def456abc123def456abc123def456abc1"},
+		{"refs/heads/develop", "1111222233334444555566667777888899990000"},
+		{"refs/tags/v1.0.0", "aabbccdd00112233aabbccdd00112233aabbccdd"},
+		{"refs/tags/v1.0.0^{}", "deadbeef12345678deadbeef12345678deadbeef"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := refs[tt.name]; got != tt.want {
+				t.Errorf("refs[%q] = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLsRemote_Empty(t *testing.T) {
+	refs := parseLsRemote("")
+	if len(refs) != 0 {
+		t.Errorf("expected no refs, got %v", refs)
+	}
+}
+
+func TestSSHRemoteURL(t *testing.T) {
+	tests := map[string]string{
+		"github.com/user/repo":                        "git@github.com:user/repo.git",
+		"github.com/user/repo//pkg#v1":                "git@github.com:user/repo.git",
+		"dev.azure.com/org/My Project/_git/repo//pkg": "git@ssh.dev.azure.com:v3/org/My%20Project/repo",
+	}
+	for repoURL, want := range tests {
+		if got, err := sshRemoteURL(repoURL); err != nil || got != want {
+			t.Errorf("sshRemoteURL(%q) = %q, %v, want %q", repoURL, got, err, want)
+		}
+	}
+}
+
+func TestSSHRemoteURL_Mirror(t *testing.T) {
+	defer func() { mirrorRules = nil }()
+	mirrorRules = []mirrorRule{
+		{From: "github.com/vendored", To: "file:///srv/git"},
+		{From: "github.com", To: "git.example.com/github"},
+	}
+	tests := map[string]string{
+		"github.com/user/repo":     "ssh://git@git.example.com/github/user/repo.git",
+		"github.com/vendored/repo": "file:///srv/git/repo.git",
+		"dev.azure.com/o/p/_git/r": "git@ssh.dev.azure.com:v3/o/p/r",
+	}
+	for repoURL, want := range tests {
+		if got, err := sshRemoteURL(repoURL); err != nil || got != want {
+			t.Errorf("sshRemoteURL(%q) = %q, %v, want %q", repoURL, got, err, want)
+		}
+	}
+}
+
+func TestResolveRefSSH_FullSHA(t *testing.T) {
+	sha := "abcdef1234567890abcdef1234567890abcdef12"
+	gotSHA, gotRef, err := resolveRefSSH("github.com/owner/repo", sha)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotSHA != sha || gotRef != sha {
+		t.Errorf("resolveRefSSH = (%q, %q), want (%q, %q)", gotSHA, gotRef, sha, sha)
+	}
+}
+
+func TestDownloadRepoSSH_InvalidSHA(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	defer func(orig string) { gitCommand = orig }(gitCommand)
+	gitCommand = "git-must-not-run"
+
+	for _, sha := range []string{"", "abc", "--upload-pack=touch pwned", strings.Repeat("g", 40)} {
+		_, err := downloadRepoSSH("github.com/owner/repo", sha)
+		if err == nil || !strings.Contains(err.Error(), "invalid commit SHA") {
+			t.Errorf("downloadRepoSSH(%q) error = %v, want an invalid commit SHA error", sha, err)
+		}
+	}
+}
+
+// TestInstallDependency_SSH fetches through a mirror rule pointing at a
+// local repository, as git would from an SSH remote
+func TestInstallDependency_SSH(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	cleanup := withTempDir(t)
+	defer cleanup()
+	defer func() { mirrorRules = nil }()
+
+	remotes, err := filepath.Abs("remotes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, filepath.Join("work", "pkg"), map[string]string{"lib.h": "// lib"})
+	git := func(dir string, args ...string) string {
+		t.Helper()
+		out, err := runGit(dir, append([]string{"-c", "user.name=deps", "-c", "user.email=deps@example.com"}, args...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(out)
+	}
+	git("work", "init", "-q")
+	git("work", "add", ".")
+	git("work", "commit", "-q", "-m", "initial")
+	git("", "clone", "-q", "--bare", "work", filepath.Join(remotes, "owner", "repo.git"))
+	sha := git("work", "rev-parse", "HEAD")
+	mirrorRules = []mirrorRule{{From: "github.com", To: "file://" + filepath.ToSlash(remotes)}}
+
+	repoURL := "github.com/owner/repo//pkg"
+	dep := Dependency{Ref: "main", SHA: sha, Transport: transportSSH, Hash: strings.Repeat("0", 64)}
+	installed, err := installDependency(repoURL, dep)
+	if err != nil {
+		t.Fatalf("installDependency: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(getDepPath(repoURL), "lib.h")); string(data) != "// lib" {
+		t.Errorf("lib.h = %q", data)
+	}
+	if installed.Hash != "" || installed.TreeHash == "" {
+		t.Errorf("hashes = %q, %q, want no hash and a tree hash", installed.Hash, installed.TreeHash)
+	}
+
+	installed.TreeHash = strings.Repeat("0", 64)
+	if _, err := installDependency(repoURL, installed); err == nil {
+		t.Error("expected a tree hash mismatch")
+	}
+}
+
+func TestTagsFromRefs(t *testing.T) {
+	refs := map[string]string{
+		"refs/heads/main":     "1111111111111111111111111111111111111111",
+		"refs/tags/v1.0.0":    "2222222222222222222222222222222222222222",
+		"refs/tags/v1.1.0":    "3333333333333333333333333333333333333333",
+		"refs/tags/v1.1.0^{}": "4444444444444444444444444444444444444444",
+	}
+
+	tags := tagsFromRefs(refs)
+	want := []tagInfo{
+		{Name: "v1.0.0", SHA: "2222222222222222222222222222222222222222"},
+		{Name: "v1.1.0", SHA: "4444444444444444444444444444444444444444"},
+	}
+	if len(tags) != len(want) {
+		t.Fatalf("got %d tags, want %d: %+v", len(tags), len(want), tags)
+	}
+	for i := range want {
+		if tags[i] != want[i] {
+			t.Errorf("tag %d = %+v, want %+v", i, tags[i], want[i])
+		}
+	}
+}
+
+func TestNamedRefs_Branches(t *testing.T) {
+	refs := map[string]string{
+		"refs/heads/main":        "1111111111111111111111111111111111111111",
+		"refs/heads/feature/foo": "2222222222222222222222222222222222222222",
+		"refs/tags/v1.0.0":       "3333333333333333333333333333333333333333",
+	}
+
+	branches := namedRefs(refs, "refs/heads/")
+	if len(branches) != 2 || branches[0].Name != "feature/foo" || branches[1].Name != "main" {
+		t.Errorf("branches = %+v", branches)
+	}
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
 	"regexp"
 	"strings"
 )
@@ -12,8 +16,84 @@ import (
 var httpClient = http.DefaultClient
 var githubAPIBaseURL = "https://api.github.com"
 
+// configureHTTPClient sets up httpClient to honor
+// HTTP_PROXY/HTTPS_PROXY/NO_PROXY and to trust an extra CA bundle, for use
+// behind corporate TLS-intercepting proxies. Empty arguments fall back to the
+// ca-bundle and insecure-skip-verify settings.
+func configureHTTPClient(caBundle string, insecureSkipVerify bool) error {
+	if caBundle == "" {
+		caBundle = configValue("ca-bundle")
+	}
+	if !insecureSkipVerify {
+		insecureSkipVerify = configBool("insecure-skip-verify")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.ResponseHeaderTimeout = requestTimeout
+
+	if caBundle != "" || insecureSkipVerify {
+		tlsConfig := &tls.Config{}
+
+		if caBundle != "" {
+			pem, err := os.ReadFile(caBundle)
+			if err != nil {
+				return fmt.Errorf("reading CA bundle: %v", err)
+			}
+			// Add to the system pool rather than replacing it
+			pool, err := x509.SystemCertPool()
+			if err != nil || pool == nil {
+				pool = x509.NewCertPool()
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("no certificates found in CA bundle %s", caBundle)
+			}
+			tlsConfig.RootCAs = pool
+		}
+
+		if insecureSkipVerify {
+			fmt.Fprintln(os.Stderr, "Warning: TLS certificate verification is disabled")
+			tlsConfig.InsecureSkipVerify = true
+		}
+
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	httpClient = &http.Client{Transport: transport}
+	return nil
+}
+
 type GitHubRepo struct {
 	DefaultBranch string `json:"default_branch"`
+	FullName      string `json:"full_name"`
+	Description   string `json:"description"`
+	Archived      bool   `json:"archived"`
+	License       *struct {
+		SPDXID string `json:"spdx_id"`
+		Name   string `json:"name"`
+	} `json:"license"`
+}
+
+// licenseName returns the SPDX identifier of the repository's license, or its
+// name if it has none
+func (r GitHubRepo) licenseName() string {
+	if r.License == nil {
+		return ""
+	}
+	if r.License.SPDXID == "" || r.License.SPDXID == "NOASSERTION" {
+		return r.License.Name
+	}
+	return r.License.SPDXID
+}
+
+type GitHubSearchResult struct {
+	TotalCount int `json:"total_count"`
+	Items      []struct {
+		FullName        string `json:"full_name"`
+		Description     string `json:"description"`
+		StargazersCount int    `json:"stargazers_count"`
+		Archived        bool   `json:"archived"`
+	} `json:"items"`
 }
 
 type GitHubBranch struct {
@@ -24,13 +104,94 @@ type GitHubCommit struct {
 	SHA string `json:"sha"`
 }
 
+type GitHubTag struct {
+	Name   string       `json:"name"`
+	Commit GitHubCommit `json:"commit"`
+}
+
+type GitHubRelease struct {
+	TagName    string               `json:"tag_name"`
+	Draft      bool                 `json:"draft"`
+	Prerelease bool                 `json:"prerelease"`
+	Assets     []GitHubReleaseAsset `json:"assets"`
+}
+
+type GitHubReleaseAsset struct {
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+	Digest             string `json:"digest"`
+}
+
+type GitHubComparison struct {
+	HTMLURL      string `json:"html_url"`
+	Status       string `json:"status"`
+	TotalCommits int    `json:"total_commits"`
+	Commits      []struct {
+		SHA    string `json:"sha"`
+		Commit struct {
+			Message string `json:"message"`
+		} `json:"commit"`
+	} `json:"commits"`
+}
+
 type GitHubRef struct {
 	Object struct {
 		SHA string `json:"sha"`
 	} `json:"object"`
 }
 
+// splitSubdir splits a "github.com/owner/repo//path/to/dir" URL into the repo
+// URL and the subdirectory within it. subdir is empty for whole-repo URLs.
+// Any "#name" entry name is dropped. A URL source has no subdirectory.
+func splitSubdir(url string) (repoURL, subdir string) {
+	url, _ = splitEntryName(url)
+	if isURLSource(url) {
+		return url, ""
+	}
+	repoURL, subdir, _ = strings.Cut(url, "//")
+	return repoURL, strings.Trim(subdir, "/")
+}
+
+// splitEntryName splits a "github.com/owner/repo#name" lock key into the
+// URL and the name that tells apart several entries for the same repository,
+// e.g. v1 and v2 side by side. name is empty for the usual single entry.
+func splitEntryName(key string) (url, name string) {
+	url, name, _ = strings.Cut(key, "#")
+	return url, name
+}
+
+// joinEntryName is the inverse of splitEntryName
+func joinEntryName(url, name string) string {
+	if name == "" {
+		return url
+	}
+	return url + "#" + name
+}
+
+// relocateKey returns a lock key with its repository replaced by repoURL,
+// keeping any subdirectory and entry name, for repos that have moved
+func relocateKey(key, repoURL string) string {
+	url, name := splitEntryName(key)
+	_, subdir := splitSubdir(url)
+	return joinEntryName(joinSubdir(repoURL, subdir), name)
+}
+
+// joinSubdir is the inverse of splitSubdir
+func joinSubdir(repoURL, subdir string) string {
+	if subdir == "" {
+		return repoURL
+	}
+	return repoURL + "//" + subdir
+}
+
+// parseGitHubURL parses the owner and repo from a github.com URL, ignoring any
+// "//subdir" suffix or "#name" entry name
 func parseGitHubURL(url string) (owner, repo string, err error) {
+	url, subdir := splitSubdir(url)
+	if err := validateSubdir(subdir); err != nil {
+		return "", "", err
+	}
+
 	// Handle github.com/owner/repo format
 	re := regexp.MustCompile(`^github\.com/([^/]+)/([^/]+)/?$`)
 	matches := re.FindStringSubmatch(url)
@@ -40,15 +201,67 @@ func parseGitHubURL(url string) (owner, repo string, err error) {
 	return matches[1], matches[2], nil
 }
 
+func validateSubdir(subdir string) error {
+	for _, part := range strings.Split(subdir, "/") {
+		if part == "." || part == ".." || (part == "" && subdir != "") {
+			return fmt.Errorf("invalid subdirectory %q", subdir)
+		}
+	}
+	return nil
+}
+
+// parseGitHubSpec splits a "url[@ref]" spec. A repository's own path never
+// contains "@", so without a subdirectory everything after the first "@" is
+// the ref; this keeps refs like "feature/foo" or "users/me@work" intact. A
+// subdirectory can contain "@", like packages/@scope/foo, so after one the
+// ref follows the last "@" that doesn't start a path segment, and a ref with
+// an "@" of its own has to be quoted. The ref may be wrapped in single or
+// double quotes.
 func parseGitHubSpec(spec string) (repoURL, ref string, err error) {
-	parts := strings.Split(spec, "@")
-	if len(parts) == 1 {
-		return parts[0], "", nil
+	at := strings.Index(spec, "@")
+	if subdir := strings.Index(spec, "//"); at >= 0 && subdir >= 0 && subdir < at {
+		at = lastRefSeparator(spec, subdir)
 	}
-	if len(parts) == 2 {
-		return parts[0], parts[1], nil
+	if at < 0 {
+		return spec, "", nil
+	}
+	repoURL, ref = spec[:at], spec[at+1:]
+
+	if len(ref) >= 2 && (ref[0] == '"' || ref[0] == '\'') && ref[len(ref)-1] == ref[0] {
+		ref = ref[1 : len(ref)-1]
+	}
+
+	if ref == "" {
+		return "", "", fmt.Errorf("invalid spec format: empty ref after @")
 	}
-	return "", "", fmt.Errorf("invalid spec format")
+	return repoURL, ref, nil
+}
+
+// lastRefSeparator returns the index of the "@" that starts the ref in a
+// spec whose subdirectory starts at subdir, or -1 if it has no ref. A quoted
+// ref starts at the "@" before its opening quote.
+func lastRefSeparator(spec string, subdir int) int {
+	if q := spec[len(spec)-1]; q == '"' || q == '\'' {
+		if at := strings.LastIndex(spec[:len(spec)-1], "@"+string(q)); at > subdir {
+			return at
+		}
+	}
+	for at := len(spec) - 1; at > subdir; at-- {
+		if spec[at] == '@' && spec[at-1] != '/' {
+			return at
+		}
+	}
+	return -1
+}
+
+// escapeRefPath escapes each "/"-separated segment of a ref for use in a URL
+// path, so characters like "#", "%" or "?" in branch names survive intact
+func escapeRefPath(ref string) string {
+	segments := strings.Split(ref, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
 }
 
 func resolveRef(owner, repo, ref string) (sha, resolvedRef string, err error) {
@@ -58,62 +271,164 @@ func resolveRef(owner, repo, ref string) (sha, resolvedRef string, err error) {
 	}
 
 	// Check if it's already a commit SHA (40 hex characters)
-	if matched, _ := regexp.MatchString("^[a-f0-9]{40}$", ref); matched {
+	if isFullSHA(ref) {
 		return ref, ref, nil
 	}
 
-	// Try as a branch first
+	// Use the result of a batched lookup if there was one
+	if sha, ok := batchedRefs[refCacheKey(owner, repo, ref)]; ok {
+		return sha, ref, nil
+	}
+
+	// Try as a branch first. A rate limit would hide whether the ref exists,
+	// so report it rather than falling through.
 	sha, resolvedRef, err = getBranchCommitSHA(owner, repo, ref)
 	if err == nil {
 		return sha, resolvedRef, nil
 	}
+	if isRateLimited(err) {
+		return "", "", err
+	}
 
 	// Try as a tag
 	sha, err = getTagCommitSHA(owner, repo, ref)
 	if err == nil {
 		return sha, ref, nil
 	}
+	if isRateLimited(err) {
+		return "", "", err
+	}
+
+	// Try as an abbreviated commit SHA, pinning the full SHA
+	if isShortSHA(ref) {
+		sha, err = getCommitSHA(owner, repo, ref)
+		if err != nil {
+			return "", "", err
+		}
+		return sha, sha, nil
+	}
 
 	return "", "", fmt.Errorf("could not resolve ref '%s' as branch or tag", ref)
 }
 
-func getLatestCommitSHA(owner, repo string) (sha, defaultBranch string, err error) {
-	// First get the default branch
+var (
+	fullSHAPattern  = regexp.MustCompile("^[a-f0-9]{40}$")
+	shortSHAPattern = regexp.MustCompile("^[a-f0-9]{4,39}$")
+)
+
+func isFullSHA(ref string) bool {
+	return fullSHAPattern.MatchString(ref)
+}
+
+// isShortSHA reports whether ref looks like an abbreviated commit SHA
+func isShortSHA(ref string) bool {
+	return shortSHAPattern.MatchString(ref)
+}
+
+// getCommitSHA expands an abbreviated commit SHA to the full SHA. GitHub
+// answers 422 when the prefix matches no commit or more than one.
+func getCommitSHA(owner, repo, shortSHA string) (string, error) {
+	commitURL := fmt.Sprintf("%s/repos/%s/%s/commits/%s", githubAPIBaseURL, owner, repo, shortSHA)
+	resp, err := httpClient.Get(commitURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if _, limited := rateLimitReset(resp); limited {
+		return "", githubAPIError(resp)
+	}
+	if resp.StatusCode != 200 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(body, &apiErr)
+		if strings.Contains(strings.ToLower(apiErr.Message), "ambiguous") {
+			return "", fmt.Errorf("short SHA '%s' is ambiguous, use more characters", shortSHA)
+		}
+		return "", fmt.Errorf("could not resolve ref '%s' as branch, tag or commit", shortSHA)
+	}
+
+	var commit GitHubCommit
+	err = json.Unmarshal(body, &commit)
+	if err != nil {
+		return "", err
+	}
+
+	if !isFullSHA(commit.SHA) || !strings.HasPrefix(commit.SHA, shortSHA) {
+		return "", fmt.Errorf("unexpected commit SHA %q for '%s'", commit.SHA, shortSHA)
+	}
+
+	return commit.SHA, nil
+}
+
+func getRepoInfo(owner, repo string) (GitHubRepo, error) {
 	repoURL := fmt.Sprintf("%s/repos/%s/%s", githubAPIBaseURL, owner, repo)
 	resp, err := httpClient.Get(repoURL)
 	if err != nil {
-		return "", "", err
+		return GitHubRepo{}, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return "", "", fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
+		return GitHubRepo{}, githubAPIError(resp)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", "", err
+		return GitHubRepo{}, err
 	}
 
 	var repoInfo GitHubRepo
 	err = json.Unmarshal(body, &repoInfo)
+	if err != nil {
+		return GitHubRepo{}, err
+	}
+
+	return repoInfo, nil
+}
+
+// getRenamedURL returns the canonical github.com URL for a repo that has been
+// renamed or transferred, or "" if it still lives at owner/repo. GitHub
+// redirects requests for the old name, so the repo info reports the new one.
+func getRenamedURL(owner, repo string) (string, error) {
+	repoInfo, err := getRepoInfo(owner, repo)
+	if err != nil {
+		return "", err
+	}
+
+	if repoInfo.FullName == "" || strings.EqualFold(repoInfo.FullName, owner+"/"+repo) {
+		return "", nil
+	}
+
+	return "github.com/" + repoInfo.FullName, nil
+}
+
+func getLatestCommitSHA(owner, repo string) (sha, defaultBranch string, err error) {
+	// First get the default branch
+	repoInfo, err := getRepoInfo(owner, repo)
 	if err != nil {
 		return "", "", err
 	}
 
 	// Now get the latest commit from the default branch
-	branchURL := fmt.Sprintf("%s/repos/%s/%s/branches/%s", githubAPIBaseURL, owner, repo, repoInfo.DefaultBranch)
-	resp, err = httpClient.Get(branchURL)
+	branchURL := fmt.Sprintf("%s/repos/%s/%s/branches/%s", githubAPIBaseURL, owner, repo, escapeRefPath(repoInfo.DefaultBranch))
+	resp, err := httpClient.Get(branchURL)
 	if err != nil {
 		return "", "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return "", "", fmt.Errorf("GitHub API returned status %d for branch", resp.StatusCode)
+		return "", "", fmt.Errorf("fetching default branch: %v", githubAPIError(resp))
 	}
 
-	body, err = io.ReadAll(resp.Body)
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return "", "", err
 	}
@@ -128,13 +443,16 @@ func getLatestCommitSHA(owner, repo string) (sha, defaultBranch string, err erro
 }
 
 func getBranchCommitSHA(owner, repo, branch string) (sha, resolvedRef string, err error) {
-	branchURL := fmt.Sprintf("%s/repos/%s/%s/branches/%s", githubAPIBaseURL, owner, repo, branch)
+	branchURL := fmt.Sprintf("%s/repos/%s/%s/branches/%s", githubAPIBaseURL, owner, repo, escapeRefPath(branch))
 	resp, err := httpClient.Get(branchURL)
 	if err != nil {
 		return "", "", err
 	}
 	defer resp.Body.Close()
 
+	if _, limited := rateLimitReset(resp); limited {
+		return "", "", githubAPIError(resp)
+	}
 	if resp.StatusCode != 200 {
 		return "", "", fmt.Errorf("branch not found")
 	}
@@ -154,13 +472,16 @@ func getBranchCommitSHA(owner, repo, branch string) (sha, resolvedRef string, er
 }
 
 func getTagCommitSHA(owner, repo, tag string) (string, error) {
-	tagURL := fmt.Sprintf("%s/repos/%s/%s/git/refs/tags/%s", githubAPIBaseURL, owner, repo, tag)
+	tagURL := fmt.Sprintf("%s/repos/%s/%s/git/refs/tags/%s", githubAPIBaseURL, owner, repo, escapeRefPath(tag))
 	resp, err := httpClient.Get(tagURL)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
+	if _, limited := rateLimitReset(resp); limited {
+		return "", githubAPIError(resp)
+	}
 	if resp.StatusCode != 200 {
 		return "", fmt.Errorf("tag not found")
 	}
@@ -178,3 +499,162 @@ func getTagCommitSHA(owner, repo, tag string) (string, error) {
 
 	return refInfo.Object.SHA, nil
 }
+
+// searchRepos searches GitHub repositories, best match first
+func searchRepos(query string, limit int) (GitHubSearchResult, error) {
+	searchURL := fmt.Sprintf("%s/search/repositories?q=%s&per_page=%d", githubAPIBaseURL, url.QueryEscape(query), limit)
+	resp, err := httpClient.Get(searchURL)
+	if err != nil {
+		return GitHubSearchResult{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return GitHubSearchResult{}, githubAPIError(resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return GitHubSearchResult{}, err
+	}
+
+	var result GitHubSearchResult
+	err = json.Unmarshal(body, &result)
+	if err != nil {
+		return GitHubSearchResult{}, err
+	}
+
+	return result, nil
+}
+
+// compareCommits compares base and head of owner/repo. Commits are listed
+// oldest first, and GitHub returns at most 250 of them.
+func compareCommits(owner, repo, base, head string) (GitHubComparison, error) {
+	compareURL := fmt.Sprintf("%s/repos/%s/%s/compare/%s...%s", githubAPIBaseURL, owner, repo, base, head)
+	resp, err := httpClient.Get(compareURL)
+	if err != nil {
+		return GitHubComparison{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return GitHubComparison{}, githubAPIError(resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return GitHubComparison{}, err
+	}
+
+	var comparison GitHubComparison
+	err = json.Unmarshal(body, &comparison)
+	if err != nil {
+		return GitHubComparison{}, err
+	}
+
+	return comparison, nil
+}
+
+// githubTarballURL returns the API URL of the tarball of owner/repo at sha
+func githubTarballURL(owner, repo, sha string) string {
+	return fmt.Sprintf("%s/repos/%s/%s/tarball/%s", githubAPIBaseURL, owner, repo, sha)
+}
+
+// githubZipballURL returns the API URL of the zipball of owner/repo at sha
+func githubZipballURL(owner, repo, sha string) string {
+	return fmt.Sprintf("%s/repos/%s/%s/zipball/%s", githubAPIBaseURL, owner, repo, sha)
+}
+
+// githubTagsPerPage is the page size used when listing tags
+const githubTagsPerPage = 100
+
+// listTags returns all tags of a repo with the commits they point to
+func listTags(owner, repo string) ([]tagInfo, error) {
+	return listNamedCommits(owner, repo, "tags")
+}
+
+// listBranches returns all branches of a repo with their head commits
+func listBranches(owner, repo string) ([]tagInfo, error) {
+	return listNamedCommits(owner, repo, "branches")
+}
+
+// listNamedCommits pages through the tags or branches endpoint, which both
+// return names with the commit they point to
+func listNamedCommits(owner, repo, kind string) ([]tagInfo, error) {
+	var refs []tagInfo
+	for page := 1; ; page++ {
+		listURL := fmt.Sprintf("%s/repos/%s/%s/%s?per_page=%d&page=%d", githubAPIBaseURL, owner, repo, kind, githubTagsPerPage, page)
+		resp, err := httpClient.Get(listURL)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != 200 {
+			return nil, githubAPIError(resp)
+		}
+
+		var pageRefs []GitHubTag
+		err = json.Unmarshal(body, &pageRefs)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ref := range pageRefs {
+			refs = append(refs, tagInfo{Name: ref.Name, SHA: ref.Commit.SHA})
+		}
+
+		if len(pageRefs) < githubTagsPerPage {
+			return refs, nil
+		}
+	}
+}
+
+// getLatestReleaseTag returns the tag of the latest published release. GitHub
+// excludes drafts and pre-releases from the latest release.
+func getLatestReleaseTag(owner, repo string) (string, error) {
+	release, err := getLatestRelease(owner, repo)
+	if err != nil {
+		return "", err
+	}
+	return release.TagName, nil
+}
+
+// getLatestRelease returns the latest published release, with its assets
+func getLatestRelease(owner, repo string) (*GitHubRelease, error) {
+	releaseURL := fmt.Sprintf("%s/repos/%s/%s/releases/latest", githubAPIBaseURL, owner, repo)
+	resp, err := httpClient.Get(releaseURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return nil, fmt.Errorf("no published releases")
+	}
+	if resp.StatusCode != 200 {
+		return nil, githubAPIError(resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var release GitHubRelease
+	err = json.Unmarshal(body, &release)
+	if err != nil {
+		return nil, err
+	}
+
+	if release.TagName == "" {
+		return nil, fmt.Errorf("latest release has no tag")
+	}
+
+	return &release, nil
+}
@@ -2,8 +2,13 @@ package main
 
 import (
 	"encoding/json"
+	"encoding/pem"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -24,6 +29,9 @@ func TestParseGitHubURL_Valid(t *testing.T) {
 		{"github.com/user/repo.with.dots", "user", "repo.with.dots"},
 		{"github.com/user/repo-with-dashes", "user", "repo-with-dashes"},
 		{"github.com/user/repo_with_underscores", "user", "repo_with_underscores"},
+		{"github.com/org/monorepo//packages/foo", "org", "monorepo"},
+		{"github.com/user/repo#v1", "user", "repo"},
+		{"github.com/org/monorepo//packages/foo#foo-v1", "org", "monorepo"},
 	}
 
 	for _, tt := range tests {
@@ -53,6 +61,8 @@ func TestParseGitHubURL_Invalid(t *testing.T) {
 		"https://github.com/user/repo",
 		"github.com/user/repo/extra",
 		"github.com/user/repo/extra/path",
+		"github.com/user/repo//../escape",
+		"github.com/user/repo//a//b",
 		"not-a-url",
 	}
 
@@ -66,6 +76,71 @@ func TestParseGitHubURL_Invalid(t *testing.T) {
 	}
 }
 
+// --- splitSubdir tests ---
+
+func TestSplitSubdir(t *testing.T) {
+	tests := []struct {
+		input      string
+		wantURL    string
+		wantSubdir string
+	}{
+		{"github.com/user/repo", "github.com/user/repo", ""},
+		{"github.com/org/monorepo//packages/foo", "github.com/org/monorepo", "packages/foo"},
+		{"github.com/org/monorepo//packages/foo/", "github.com/org/monorepo", "packages/foo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			url, subdir := splitSubdir(tt.input)
+			if url != tt.wantURL {
+				t.Errorf("url = %q, want %q", url, tt.wantURL)
+			}
+			if subdir != tt.wantSubdir {
+				t.Errorf("subdir = %q, want %q", subdir, tt.wantSubdir)
+			}
+			if got := joinSubdir(url, subdir); got != strings.TrimSuffix(tt.input, "/") {
+				t.Errorf("joinSubdir = %q, want %q", got, strings.TrimSuffix(tt.input, "/"))
+			}
+		})
+	}
+}
+
+func TestSplitEntryName(t *testing.T) {
+	tests := []struct {
+		key      string
+		wantURL  string
+		wantName string
+	}{
+		{"github.com/user/repo", "github.com/user/repo", ""},
+		{"github.com/user/repo#lib-v1", "github.com/user/repo", "lib-v1"},
+		{"github.com/org/monorepo//packages/foo#foo-v1", "github.com/org/monorepo//packages/foo", "foo-v1"},
+	}
+
+	for _, tt := range tests {
+		url, name := splitEntryName(tt.key)
+		if url != tt.wantURL || name != tt.wantName {
+			t.Errorf("splitEntryName(%q) = %q, %q, want %q, %q", tt.key, url, name, tt.wantURL, tt.wantName)
+		}
+		if got := joinEntryName(url, name); got != tt.key {
+			t.Errorf("joinEntryName = %q, want %q", got, tt.key)
+		}
+	}
+}
+
+func TestRelocateKey(t *testing.T) {
+	tests := map[string]string{
+		"github.com/old/repo":                 "github.com/new/repo",
+		"github.com/old/repo//pkg/foo":        "github.com/new/repo//pkg/foo",
+		"github.com/old/repo//pkg/foo#foo-v1": "github.com/new/repo//pkg/foo#foo-v1",
+		"github.com/old/repo#lib-v1":          "github.com/new/repo#lib-v1",
+	}
+	for key, want := range tests {
+		if got := relocateKey(key, "github.com/new/repo"); got != want {
+			t.Errorf("relocateKey(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
 // --- parseGitHubSpec tests ---
 
 func TestParseGitHubSpec_Valid(t *testing.T) {
@@ -79,6 +154,7 @@ func TestParseGitHubSpec_Valid(t *testing.T) {
 		{"github.com/user/repo@v1.0.0", "github.com/user/repo", "v1.0.0"},
 		{"github.com/user/repo@abc123", "github.com/user/repo", "abc123"},
 		{"github.com/user/repo@feature/branch", "github.com/user/repo", "feature/branch"},
+		{"github.com/org/monorepo//packages/foo@v1.0.0", "github.com/org/monorepo//packages/foo", "v1.0.0"},
 	}
 
 	for _, tt := range tests {
@@ -97,10 +173,86 @@ func TestParseGitHubSpec_Valid(t *testing.T) {
 	}
 }
 
-func TestParseGitHubSpec_TooManyAtSigns(t *testing.T) {
-	_, _, err := parseGitHubSpec("github.com/user/repo@v1@extra")
+func TestParseGitHubSpec_RefContainingAt(t *testing.T) {
+	url, ref, err := parseGitHubSpec("github.com/user/repo@users/me@work")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if url != "github.com/user/repo" {
+		t.Errorf("url = %q, want %q", url, "github.com/user/repo")
+	}
+	if ref != "users/me@work" {
+		t.Errorf("ref = %q, want %q", ref, "users/me@work")
+	}
+}
+
+func TestParseGitHubSpec_SubdirContainingAt(t *testing.T) {
+	tests := []struct {
+		input   string
+		wantURL string
+		wantRef string
+	}{
+		{"github.com/org/mono//packages/@scope/foo@v1.2.3", "github.com/org/mono//packages/@scope/foo", "v1.2.3"},
+		{"github.com/org/mono//packages/@scope/foo", "github.com/org/mono//packages/@scope/foo", ""},
+		{`github.com/org/mono//packages/@scope/foo@"users/me@work"`, "github.com/org/mono//packages/@scope/foo", "users/me@work"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			url, ref, err := parseGitHubSpec(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if url != tt.wantURL {
+				t.Errorf("url = %q, want %q", url, tt.wantURL)
+			}
+			if ref != tt.wantRef {
+				t.Errorf("ref = %q, want %q", ref, tt.wantRef)
+			}
+		})
+	}
+}
+
+func TestParseGitHubSpec_QuotedRef(t *testing.T) {
+	for _, spec := range []string{`github.com/user/repo@"release/1.x#hotfix"`, `github.com/user/repo@'release/1.x#hotfix'`} {
+		_, ref, err := parseGitHubSpec(spec)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", spec, err)
+		}
+		if ref != "release/1.x#hotfix" {
+			t.Errorf("ref = %q, want %q", ref, "release/1.x#hotfix")
+		}
+	}
+}
+
+func TestParseGitHubSpec_EmptyRef(t *testing.T) {
+	_, _, err := parseGitHubSpec("github.com/user/repo@")
 	if err == nil {
-		t.Error("expected error for multiple @ signs, got nil")
+		t.Error("expected error for empty ref, got nil")
+	}
+}
+
+func TestGetBranchCommitSHA_EscapesRef(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/branches/feature/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/repos/testowner/testrepo/branches/feature/50%25-off%23two" {
+			w.WriteHeader(404)
+			return
+		}
+		json.NewEncoder(w).Encode(GitHubBranch{
+			Commit: GitHubCommit{SHA: "deadbeef12345678deadbeef12345678deadbeef"},
+		})
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+
+	sha, _, err := getBranchCommitSHA("testowner", "testrepo", "feature/50%-off#two")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sha != "deadbeef12345678deadbeef12345678deadbeef" {
+		t.Errorf("sha = %q", sha)
 	}
 }
 
@@ -372,3 +524,377 @@ func TestResolveRef_NeitherBranchNorTag(t *testing.T) {
 		t.Error("expected error when ref is neither branch nor tag, got nil")
 	}
 }
+
+func TestResolveRef_ShortSHA(t *testing.T) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/repos/testowner/testrepo/branches/abc1234", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	})
+	mux.HandleFunc("/repos/testowner/testrepo/git/refs/tags/abc1234", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	})
+	mux.HandleFunc("/repos/testowner/testrepo/commits/abc1234", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(GitHubCommit{SHA: "abc1234500112233aabbccdd00112233aabbccdd"})
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+
+	sha, ref, err := resolveRef("testowner", "testrepo", "abc1234")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sha != "abc1234500112233aabbccdd00112233aabbccdd" {
+		t.Errorf("sha = %q", sha)
+	}
+	if ref != sha {
+		t.Errorf("ref = %q, want the full SHA %q", ref, sha)
+	}
+}
+
+func TestResolveRef_ShortSHA_Ambiguous(t *testing.T) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/repos/testowner/testrepo/branches/abcd", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	})
+	mux.HandleFunc("/repos/testowner/testrepo/git/refs/tags/abcd", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	})
+	mux.HandleFunc("/repos/testowner/testrepo/commits/abcd", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(422)
+		w.Write([]byte(`{"message":"The short SHA abcd is ambiguous."}`))
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+
+	_, _, err := resolveRef("testowner", "testrepo", "abcd")
+	if err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("expected ambiguous error, got %v", err)
+	}
+}
+
+func TestResolveRef_HexBranchPreferredOverShortSHA(t *testing.T) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/repos/testowner/testrepo/branches/cafe", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(GitHubBranch{
+			Commit: GitHubCommit{SHA: "1111111111111111111111111111111111111111"},
+		})
+	})
+	mux.HandleFunc("/repos/testowner/testrepo/commits/cafe", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("commits API should not be queried when a branch matches")
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+
+	_, ref, err := resolveRef("testowner", "testrepo", "cafe")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ref != "cafe" {
+		t.Errorf("ref = %q, want %q", ref, "cafe")
+	}
+}
+
+func TestIsShortSHA(t *testing.T) {
+	tests := map[string]bool{
+		"abc1234": true,
+		"abc":     false,
+		"v1.0.0":  false,
+		"ABC1234": false,
+		"abc1234500112233aabbccdd00112233aabbccdd": false,
+	}
+	for ref, want := range tests {
+		if got := isShortSHA(ref); got != want {
+			t.Errorf("isShortSHA(%q) = %v, want %v", ref, got, want)
+		}
+	}
+}
+
+// --- configureHTTPClient tests ---
+
+// restoreHTTPClient restores httpClient after a test reconfigures it
+func restoreHTTPClient(t *testing.T) {
+	t.Helper()
+	orig := httpClient
+	t.Cleanup(func() { httpClient = orig })
+}
+
+func TestConfigureHTTPClient_CABundle(t *testing.T) {
+	restoreHTTPClient(t)
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	// Without the server's certificate the request must fail
+	err := configureHTTPClient("", false)
+	if err != nil {
+		t.Fatalf("configureHTTPClient error: %v", err)
+	}
+	if _, err := httpClient.Get(srv.URL); err == nil {
+		t.Fatal("expected certificate error without CA bundle")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err = configureHTTPClient(caFile, false)
+	if err != nil {
+		t.Fatalf("configureHTTPClient error: %v", err)
+	}
+	resp, err := httpClient.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request with CA bundle failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestConfigureHTTPClient_InsecureSkipVerify(t *testing.T) {
+	restoreHTTPClient(t)
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	err := configureHTTPClient("", true)
+	if err != nil {
+		t.Fatalf("configureHTTPClient error: %v", err)
+	}
+	resp, err := httpClient.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request with verification disabled failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestConfigureHTTPClient_InvalidBundle(t *testing.T) {
+	restoreHTTPClient(t)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, []byte("not a certificate"), 0644)
+
+	if err := configureHTTPClient(caFile, false); err == nil {
+		t.Error("expected error for bundle without certificates, got nil")
+	}
+}
+
+// --- getRenamedURL tests ---
+
+func TestGetRenamedURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		fullName string
+		want     string
+	}{
+		{"unchanged", "testowner/testrepo", ""},
+		{"case only", "TestOwner/TestRepo", ""},
+		{"renamed", "testowner/newname", "github.com/testowner/newname"},
+		{"transferred", "neworg/testrepo", "github.com/neworg/testrepo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/repos/testowner/testrepo", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(GitHubRepo{DefaultBranch: "main", FullName: tt.fullName})
+			})
+
+			cleanup := testGitHubServer(t, mux)
+			defer cleanup()
+
+			got, err := getRenamedURL("testowner", "testrepo")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("getRenamedURL = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRenamedURL_FollowsRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/oldowner/oldrepo", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/repositories/42", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/repositories/42", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(GitHubRepo{DefaultBranch: "main", FullName: "newowner/newrepo"})
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+
+	got, err := getRenamedURL("oldowner", "oldrepo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "github.com/newowner/newrepo" {
+		t.Errorf("getRenamedURL = %q, want %q", got, "github.com/newowner/newrepo")
+	}
+}
+
+// --- listTags tests ---
+
+func TestListTags_Paginates(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/tags", func(w http.ResponseWriter, r *http.Request) {
+		var page []GitHubTag
+		switch r.URL.Query().Get("page") {
+		case "1":
+			for i := 0; i < githubTagsPerPage; i++ {
+				page = append(page, GitHubTag{Name: "v0.0." + strconv.Itoa(i)})
+			}
+		case "2":
+			page = append(page, GitHubTag{Name: "v1.0.0", Commit: GitHubCommit{SHA: "abc"}})
+		}
+		json.NewEncoder(w).Encode(page)
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+
+	tags, err := listTags("testowner", "testrepo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tags) != githubTagsPerPage+1 {
+		t.Fatalf("got %d tags, want %d", len(tags), githubTagsPerPage+1)
+	}
+	last := tags[len(tags)-1]
+	if last.Name != "v1.0.0" || last.SHA != "abc" {
+		t.Errorf("last tag = %+v", last)
+	}
+}
+
+func TestListBranches(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/branches", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]GitHubTag{
+			{Name: "main", Commit: GitHubCommit{SHA: "abc"}},
+			{Name: "feature/foo", Commit: GitHubCommit{SHA: "def"}},
+		})
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+
+	branches, err := listBranches("testowner", "testrepo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(branches) != 2 || branches[1].Name != "feature/foo" || branches[1].SHA != "def" {
+		t.Errorf("branches = %+v", branches)
+	}
+}
+
+// --- searchRepos tests ---
+
+func TestSearchRepos(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search/repositories", func(w http.ResponseWriter, r *http.Request) {
+		if q := r.URL.Query().Get("q"); q != "sokol odin" {
+			t.Errorf("q = %q, want %q", q, "sokol odin")
+		}
+		if n := r.URL.Query().Get("per_page"); n != "5" {
+			t.Errorf("per_page = %q, want 5", n)
+		}
+		w.Write([]byte(`{"total_count":12,"items":[{"full_name":"floooh/sokol-odin","description":"Odin bindings","stargazers_count":300}]}`))
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+
+	result, err := searchRepos("sokol odin", 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.TotalCount != 12 || len(result.Items) != 1 || result.Items[0].FullName != "floooh/sokol-odin" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestCompareCommits(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/compare/aaaa...bbbb", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"html_url":"https://github.com/testowner/testrepo/compare/aaaa...bbbb","status":"ahead","total_commits":2,` +
+			`"commits":[{"sha":"1111111111","commit":{"message":"Fix parser\n\nDetails"}},{"sha":"2222222222","commit":{"message":"Add option"}}]}`))
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+
+	comparison, err := compareCommits("testowner", "testrepo", "aaaa", "bbbb")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if comparison.Status != "ahead" || comparison.TotalCommits != 2 || len(comparison.Commits) != 2 {
+		t.Errorf("comparison = %+v", comparison)
+	}
+	if comparison.Commits[0].Commit.Message != "Fix parser\n\nDetails" {
+		t.Errorf("first commit message = %q", comparison.Commits[0].Commit.Message)
+	}
+}
+
+// --- getLatestReleaseTag tests ---
+
+func TestGetLatestReleaseTag(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(GitHubRelease{TagName: "v2.1.0"})
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+
+	tag, err := getLatestReleaseTag("testowner", "testrepo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tag != "v2.1.0" {
+		t.Errorf("tag = %q, want %q", tag, "v2.1.0")
+	}
+}
+
+func TestGetLatestReleaseTag_NoReleases(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+
+	if _, err := getLatestReleaseTag("testowner", "testrepo"); err == nil {
+		t.Error("expected error when there are no releases, got nil")
+	}
+}
+
+func TestResolveRef_LatestRelease(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(GitHubRelease{TagName: "v2.1.0"})
+	})
+	mux.HandleFunc("/repos/testowner/testrepo/git/refs/tags/v2.1.0", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"object":{"sha":"2100000000000000000000000000000000000000"}}`))
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+
+	sha, ref, err := resolveDependency("github.com/testowner/testrepo", Dependency{Ref: "latest-release"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ref != "v2.1.0" || sha != "2100000000000000000000000000000000000000" {
+		t.Errorf("got (%q, %q), want v2.1.0", sha, ref)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// depGraph is the dependency graph deps graph exports: the lock entries,
+// the submodules they pull in at each pinned commit, and which pulls in
+// which. A submodule two dependencies pin at the same commit is one node.
+type depGraph struct {
+	Nodes []graphNode `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+}
+
+type graphNode struct {
+	ID     string `json:"id"`
+	Repo   string `json:"repo"`
+	Ref    string `json:"ref,omitempty"` // only lock entries track a ref
+	SHA    string `json:"sha"`
+	Direct bool   `json:"direct"`
+	// Conflict marks a repository the graph has at more than one commit
+	Conflict bool `json:"conflict"`
+}
+
+type graphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Path string `json:"path,omitempty"` // where a submodule is installed in its dependency
+}
+
+// Graph formats
+const (
+	graphDOT     = "dot"
+	graphMermaid = "mermaid"
+	graphJSON    = "json"
+)
+
+// buildGraph returns the graph of the dependencies of lockFile and the
+// submodules of pins, as collectSubmodulePins looks them up. Submodule
+// nodes are identified by repo@sha, lock entries by their key.
+func buildGraph(lockFile *LockFile, pins []submodulePin) depGraph {
+	var graph depGraph
+	versions := make(map[string]map[string]bool)
+	addVersion := func(repo, sha string) {
+		if versions[repo] == nil {
+			versions[repo] = make(map[string]bool)
+		}
+		versions[repo][sha] = true
+	}
+
+	for _, repoURL := range sortedKeys(lockFile.Dependencies) {
+		dep := lockFile.Dependencies[repoURL]
+		base, _ := splitSubdir(repoURL)
+		base, _ = splitEntryName(base)
+		graph.Nodes = append(graph.Nodes, graphNode{ID: repoURL, Repo: base, Ref: dep.Ref, SHA: dep.SHA, Direct: true})
+		addVersion(base, dep.SHA)
+	}
+
+	seen := make(map[string]bool)
+	for i, pin := range pins {
+		id := pin.Repo + "@" + pin.SHA
+		if !seen[id] {
+			seen[id] = true
+			graph.Nodes = append(graph.Nodes, graphNode{ID: id, Repo: pin.Repo, SHA: pin.SHA})
+			addVersion(pin.Repo, pin.SHA)
+		}
+
+		// A nested submodule hangs off the closest submodule it is installed in
+		from, closest := pin.Parent, ""
+		for _, other := range pins[:i] {
+			if other.Parent == pin.Parent && strings.HasPrefix(pin.Path, other.Path+"/") && len(other.Path) > len(closest) {
+				from, closest = other.Repo+"@"+other.SHA, other.Path
+			}
+		}
+		graph.Edges = append(graph.Edges, graphEdge{From: from, To: id, Path: pin.Path})
+	}
+
+	for i, node := range graph.Nodes {
+		graph.Nodes[i].Conflict = len(versions[node.Repo]) > 1
+	}
+	sort.SliceStable(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].From != graph.Edges[j].From {
+			return graph.Edges[i].From < graph.Edges[j].From
+		}
+		return graph.Edges[i].Path < graph.Edges[j].Path
+	})
+	return graph
+}
+
+// label is how a node is shown: the repository and its version
+func (node graphNode) label() string {
+	version := abbreviateSHA(node.SHA)
+	if node.Ref != "" && node.Ref != node.SHA {
+		version = fmt.Sprintf("%s (%s)", node.Ref, abbreviateSHA(node.SHA))
+	}
+	title := node.ID
+	if !node.Direct {
+		title = node.Repo
+	}
+	return title + "\n" + version
+}
+
+// abbreviateSHA shortens a commit SHA the way deps prints them elsewhere
+func abbreviateSHA(sha string) string {
+	if len(sha) > 8 {
+		return sha[:8]
+	}
+	return sha
+}
+
+// renderDOT renders the graph for Graphviz, with conflicting nodes in red
+func renderDOT(graph depGraph) string {
+	var b strings.Builder
+	b.WriteString("digraph deps {\n  rankdir=LR;\n  node [shape=box];\n")
+	for _, node := range graph.Nodes {
+		attrs := fmt.Sprintf("label=%s", dotQuote(node.label()))
+		if node.Conflict {
+			attrs += ", color=red, fontcolor=red"
+		}
+		fmt.Fprintf(&b, "  %s [%s];\n", dotQuote(node.ID), attrs)
+	}
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(&b, "  %s -> %s [label=%s];\n", dotQuote(edge.From), dotQuote(edge.To), dotQuote(edge.Path))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotQuote quotes s as a DOT string, with newlines as line breaks
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + strings.ReplaceAll(s, "\n", `\n`) + `"`
+}
+
+// renderMermaid renders the graph as a Mermaid flowchart, which Markdown
+// on GitHub draws. Mermaid IDs can't hold URLs, so nodes are numbered.
+func renderMermaid(graph depGraph) string {
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+	ids := make(map[string]string)
+	conflicts := false
+	for i, node := range graph.Nodes {
+		ids[node.ID] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(&b, "  %s[%s]", ids[node.ID], mermaidQuote(node.label()))
+		if node.Conflict {
+			b.WriteString(":::conflict")
+			conflicts = true
+		}
+		b.WriteString("\n")
+	}
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(&b, "  %s -->|%s| %s\n", ids[edge.From], mermaidQuote(edge.Path), ids[edge.To])
+	}
+	if conflicts {
+		b.WriteString("  classDef conflict stroke:#d00,stroke-width:2px,color:#d00\n")
+	}
+	return b.String()
+}
+
+// mermaidQuote quotes s as Mermaid text, with newlines as line breaks
+func mermaidQuote(s string) string {
+	s = strings.ReplaceAll(s, `"`, "#quot;")
+	return `"` + strings.ReplaceAll(s, "\n", "<br/>") + `"`
+}
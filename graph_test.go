@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func graphLockFile() *LockFile {
+	return &LockFile{Dependencies: map[string]Dependency{
+		"github.com/a/app":  {Ref: "main", SHA: "abc123def456abc123def456abc123def456abc1", Submodules: true},
+		"github.com/b/tool": {Ref: "v1.0.0", SHA: "def456abc123def456abc123def456abc123def4", Submodules: true},
+	}}
+}
+
+var graphPins = []submodulePin{
+	{Parent: "github.com/a/app", Path: "vendor/lib", Repo: "github.com/other/lib", SHA: libV1SHA},
+	{Parent: "github.com/a/app", Path: "vendor/lib/deep", Repo: "github.com/deep/dep", SHA: libV1SHA},
+	{Parent: "github.com/b/tool", Path: "third_party/lib", Repo: "github.com/other/lib", SHA: libV2SHA},
+	{Parent: "github.com/b/tool", Path: "third_party/dep", Repo: "github.com/deep/dep", SHA: libV1SHA},
+}
+
+func TestBuildGraph(t *testing.T) {
+	graph := buildGraph(graphLockFile(), graphPins)
+
+	var ids []string
+	conflicts := make(map[string]bool)
+	for _, node := range graph.Nodes {
+		ids = append(ids, node.ID)
+		conflicts[node.ID] = node.Conflict
+	}
+	wantIDs := []string{
+		"github.com/a/app",
+		"github.com/b/tool",
+		"github.com/other/lib@" + libV1SHA,
+		"github.com/deep/dep@" + libV1SHA,
+		"github.com/other/lib@" + libV2SHA,
+	}
+	if !reflect.DeepEqual(ids, wantIDs) {
+		t.Errorf("nodes = %v, want %v (one node per repository and commit)", ids, wantIDs)
+	}
+	if !conflicts["github.com/other/lib@"+libV1SHA] || !conflicts["github.com/other/lib@"+libV2SHA] || conflicts["github.com/deep/dep@"+libV1SHA] {
+		t.Errorf("conflicts = %v, want only github.com/other/lib marked", conflicts)
+	}
+
+	wantEdges := []graphEdge{
+		{From: "github.com/a/app", To: "github.com/other/lib@" + libV1SHA, Path: "vendor/lib"},
+		{From: "github.com/b/tool", To: "github.com/deep/dep@" + libV1SHA, Path: "third_party/dep"},
+		{From: "github.com/b/tool", To: "github.com/other/lib@" + libV2SHA, Path: "third_party/lib"},
+		{From: "github.com/other/lib@" + libV1SHA, To: "github.com/deep/dep@" + libV1SHA, Path: "vendor/lib/deep"},
+	}
+	if !reflect.DeepEqual(graph.Edges, wantEdges) {
+		t.Errorf("edges = %+v, want %+v", graph.Edges, wantEdges)
+	}
+}
+
+func TestRenderDOT(t *testing.T) {
+	out := renderDOT(buildGraph(graphLockFile(), graphPins))
+	for _, want := range []string{
+		"digraph deps {",
+		`"github.com/b/tool" [label="github.com/b/tool\nv1.0.0 (def456ab)"];`,
+		`"github.com/other/lib@` + libV2SHA + `" [label="github.com/other/lib\n22222222", color=red, fontcolor=red];`,
+		`"github.com/a/app" -> "github.com/other/lib@` + libV1SHA + `" [label="vendor/lib"];`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("DOT output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRenderMermaid(t *testing.T) {
+	out := renderMermaid(buildGraph(graphLockFile(), graphPins))
+	for _, want := range []string{
+		"graph LR\n",
+		`  n0["github.com/a/app<br/>main (abc123de)"]` + "\n",
+		`  n2["github.com/other/lib<br/>11111111"]:::conflict` + "\n",
+		`  n0 -->|"vendor/lib"| n2` + "\n",
+		"classDef conflict",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Mermaid output missing %q:\n%s", want, out)
+		}
+	}
+
+	// Without conflicts there is nothing to style
+	if out := renderMermaid(buildGraph(graphLockFile(), graphPins[:2])); strings.Contains(out, "classDef") {
+		t.Errorf("Mermaid output without conflicts has a conflict class:\n%s", out)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// graphQLBatchSize is how many repositories are looked up per GraphQL query
+const graphQLBatchSize = 50
+
+// batchedRefs holds commit SHAs resolved ahead of time by prefetchRefs, keyed
+// by refCacheKey. resolveRef consults it before calling the REST API.
+var batchedRefs = map[string]string{}
+
+func refCacheKey(owner, repo, ref string) string {
+	return owner + "/" + repo + "@" + ref
+}
+
+// refLookup is a branch or tag of a repo to resolve in a batch
+type refLookup struct {
+	Owner, Repo, Ref string
+}
+
+type graphQLRef struct {
+	Target struct {
+		OID string `json:"oid"`
+	} `json:"target"`
+}
+
+type graphQLResponse struct {
+	Data map[string]*struct {
+		Branch *graphQLRef `json:"branch"`
+		Tag    *graphQLRef `json:"tag"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// prefetchRefs resolves the refs of all GitHub dependencies fetched over HTTPS
+// with a few GraphQL queries instead of several REST calls each. The GraphQL
+// API requires authentication, so this only happens when GITHUB_TOKEN is set
+// and the API resolver is in use; anything it can't resolve falls back to the
+// REST API.
+func prefetchRefs(lockFile *LockFile) {
+	token, _ := githubToken()
+	if token == "" || refResolver != resolverAPI {
+		return
+	}
+
+	var lookups []refLookup
+	seen := make(map[string]bool)
+	for _, repoURL := range sortedKeys(lockFile.Dependencies) {
+		dep := lockFile.Dependencies[repoURL]
+		// Constraints and keywords need the full tag list; SHAs need no lookup
+		if dep.Transport != transportHTTPS || dep.frozen() || dep.Constraint != "" || dep.Ref == "" || isFullSHA(dep.Ref) {
+			continue
+		}
+		owner, repo, err := parseGitHubURL(repoURL)
+		if err != nil {
+			continue
+		}
+		key := refCacheKey(owner, repo, dep.Ref)
+		if !seen[key] {
+			seen[key] = true
+			lookups = append(lookups, refLookup{Owner: owner, Repo: repo, Ref: dep.Ref})
+		}
+	}
+
+	for start := 0; start < len(lookups); start += graphQLBatchSize {
+		end := start + graphQLBatchSize
+		if end > len(lookups) {
+			end = len(lookups)
+		}
+		resolved, err := resolveRefsGraphQL(token, lookups[start:end])
+		if err != nil {
+			warnf("%s Batch ref lookup failed, resolving individually: %v\n", colorize(colorYellow, "!"), err)
+			return
+		}
+		for key, sha := range resolved {
+			batchedRefs[key] = sha
+		}
+	}
+}
+
+// buildRefsQuery builds a query looking up each ref as both a branch and a
+// tag, aliasing each repository by its index
+func buildRefsQuery(lookups []refLookup) string {
+	quote := func(s string) string {
+		b, _ := json.Marshal(s)
+		return string(b)
+	}
+
+	var query strings.Builder
+	query.WriteString("query {\n")
+	for i, l := range lookups {
+		fmt.Fprintf(&query, "  r%d: repository(owner: %s, name: %s) {\n", i, quote(l.Owner), quote(l.Repo))
+		fmt.Fprintf(&query, "    branch: ref(qualifiedName: %s) { target { oid } }\n", quote("refs/heads/"+l.Ref))
+		fmt.Fprintf(&query, "    tag: ref(qualifiedName: %s) { target { oid } }\n", quote("refs/tags/"+l.Ref))
+		query.WriteString("  }\n")
+	}
+	query.WriteString("}\n")
+	return query.String()
+}
+
+// resolveRefsGraphQL resolves lookups in one query, returning commit SHAs by
+// refCacheKey. Branches take precedence over tags, matching resolveRef, and
+// tags resolve to the object they point to, as the REST refs API does.
+func resolveRefsGraphQL(token string, lookups []refLookup) (map[string]string, error) {
+	body, err := json.Marshal(map[string]string{"query": buildRefsQuery(lookups)})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", githubAPIBaseURL+"/graphql", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		if _, limited := rateLimitReset(resp); limited {
+			return nil, githubAPIError(resp)
+		}
+		return nil, &statusError{Service: "GitHub GraphQL API", StatusCode: resp.StatusCode}
+	}
+
+	var result graphQLResponse
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return nil, err
+	}
+	// Missing repositories are reported as errors alongside partial data
+	if result.Data == nil && len(result.Errors) > 0 {
+		return nil, fmt.Errorf("GitHub GraphQL API: %s", result.Errors[0].Message)
+	}
+
+	resolved := make(map[string]string)
+	for i, l := range lookups {
+		repo := result.Data[fmt.Sprintf("r%d", i)]
+		if repo == nil {
+			continue
+		}
+		var sha string
+		switch {
+		case repo.Branch != nil:
+			sha = repo.Branch.Target.OID
+		case repo.Tag != nil:
+			sha = repo.Tag.Target.OID
+		}
+		if sha != "" {
+			resolved[refCacheKey(l.Owner, l.Repo, l.Ref)] = sha
+		}
+	}
+	return resolved, nil
+}
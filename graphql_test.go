@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// resetBatchedRefs clears batchedRefs for the duration of a test
+func resetBatchedRefs(t *testing.T) {
+	t.Helper()
+	orig := batchedRefs
+	batchedRefs = map[string]string{}
+	t.Cleanup(func() { batchedRefs = orig })
+}
+
+func TestBuildRefsQuery(t *testing.T) {
+	query := buildRefsQuery([]refLookup{
+		{Owner: "a", Repo: "one", Ref: "main"},
+		{Owner: "b", Repo: "two", Ref: `we"ird`},
+	})
+
+	for _, want := range []string{
+		`r0: repository(owner: "a", name: "one")`,
+		`branch: ref(qualifiedName: "refs/heads/main")`,
+		`r1: repository(owner: "b", name: "two")`,
+		`tag: ref(qualifiedName: "refs/tags/we\"ird")`,
+	} {
+		if !strings.Contains(query, want) {
+			t.Errorf("query missing %q:\n%s", want, query)
+		}
+	}
+}
+
+func TestPrefetchRefs(t *testing.T) {
+	resetBatchedRefs(t)
+	t.Setenv("GITHUB_TOKEN", "secret")
+
+	requests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		var body struct {
+			Query string `json:"query"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if strings.Contains(body.Query, "pinned") || strings.Contains(body.Query, "constrained") {
+			t.Errorf("query should skip pinned and constraint deps:\n%s", body.Query)
+		}
+		fmt.Fprint(w, `{"data":{
+			"r0":{"branch":{"target":{"oid":"1111111111111111111111111111111111111111"}},"tag":null},
+			"r1":{"branch":null,"tag":{"target":{"oid":"2222222222222222222222222222222222222222"}}},
+			"r2":null
+		}}`)
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+
+	lf := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/a/one":         {Ref: "main"},
+		"github.com/b/two":         {Ref: "v1.0.0"},
+		"github.com/c/gone":        {Ref: "main"},
+		"github.com/d/pinned":      {Ref: "main", Pinned: true},
+		"github.com/e/constrained": {Ref: "v1.0.0", Constraint: "^1"},
+		"github.com/f/ssh":         {Ref: "main", Transport: transportSSH},
+	}}
+
+	prefetchRefs(lf)
+
+	if requests != 1 {
+		t.Errorf("got %d GraphQL requests, want 1", requests)
+	}
+	want := map[string]string{
+		"a/one@main":   "1111111111111111111111111111111111111111",
+		"b/two@v1.0.0": "2222222222222222222222222222222222222222",
+	}
+	if len(batchedRefs) != len(want) {
+		t.Errorf("batchedRefs = %v, want %v", batchedRefs, want)
+	}
+	for key, sha := range want {
+		if batchedRefs[key] != sha {
+			t.Errorf("batchedRefs[%s] = %q, want %q", key, batchedRefs[key], sha)
+		}
+	}
+}
+
+func TestPrefetchRefs_NoToken(t *testing.T) {
+	resetBatchedRefs(t)
+	t.Setenv("GITHUB_TOKEN", "")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("GraphQL should not be used without a token")
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+
+	prefetchRefs(&LockFile{Dependencies: map[string]Dependency{"github.com/a/one": {Ref: "main"}}})
+}
+
+func TestResolveRef_UsesBatchedRefs(t *testing.T) {
+	resetBatchedRefs(t)
+	batchedRefs[refCacheKey("testowner", "testrepo", "main")] = "3333333333333333333333333333333333333333"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected REST request: %s", r.URL.Path)
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+
+	sha, ref, err := resolveRef("testowner", "testrepo", "main")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sha != "3333333333333333333333333333333333333333" || ref != "main" {
+		t.Errorf("got (%q, %q)", sha, ref)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+)
+
+// allowHooks runs post-install hooks without asking
+var allowHooks bool
+
+// configureHooks allows post-install hooks to run unattended when allow is set
+// (--allow-hooks) or the allow-hooks setting is on. Otherwise each hook is
+// confirmed on the terminal, and skipped when there is none to ask on.
+func configureHooks(allow bool) {
+	allowHooks = allow || configBool("allow-hooks")
+}
+
+// hookCommand runs command through the platform's shell
+func hookCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(runContext, "cmd", "/C", command)
+	}
+	return exec.CommandContext(runContext, "sh", "-c", command)
+}
+
+// hookPrompt keeps parallel installs asking about one hook at a time
+var hookPrompt sync.Mutex
+
+// confirmHook asks whether to run the post-install hook command of repoURL
+func confirmHook(repoURL, command string) bool {
+	hookPrompt.Lock()
+	defer hookPrompt.Unlock()
+	return confirm(fmt.Sprintf("%s has a post-install hook: %s\nRun it?", repoURL, command))
+}
+
+// runPostInstall runs the post-install hook of dep, if it has one and it is
+// allowed to, with the installed directory as working directory. It reports
+// whether the hook ran. A hook is arbitrary code from the lock file, so the
+// command is always shown before it runs.
+func runPostInstall(repoURL string, dep Dependency) (bool, error) {
+	if dep.PostInstall == "" {
+		return false, nil
+	}
+	if !allowHooks && !confirmHook(repoURL, dep.PostInstall) {
+		warnf("%s Skipped the post-install hook of %s (pass --allow-hooks to run it)\n", colorize(colorYellow, "!"), repoURL)
+		return false, nil
+	}
+
+	infof("Running post-install hook for %s: %s\n", repoURL, dep.PostInstall)
+	cmd := hookCommand(dep.PostInstall)
+	cmd.Dir = getDepPath(repoURL)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "DEPS_REPO="+repoURL, "DEPS_REF="+dep.Ref, "DEPS_SHA="+dep.SHA)
+	err := cmd.Run()
+	if err != nil {
+		return true, fmt.Errorf("post-install hook %q: %v", dep.PostInstall, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestRunPostInstall(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands use sh")
+	}
+	cleanup := withTempDir(t)
+	defer cleanup()
+	defer func() { allowHooks = false }()
+
+	repoURL := "github.com/user/repo"
+	depPath := getDepPath(repoURL)
+	os.MkdirAll(depPath, 0755)
+	dep := Dependency{Ref: "main", SHA: "75ccf94d605a05fe24817fc2f166f6f2959d5cea", PostInstall: `echo "$DEPS_REPO@$DEPS_SHA" > generated.txt`}
+
+	// Without --allow-hooks or a terminal to ask on, hooks are skipped
+	allowHooks = false
+	ran, err := runPostInstall(repoURL, dep)
+	if ran || err != nil {
+		t.Errorf("unattended hook: ran = %v, err = %v", ran, err)
+	}
+	if _, err := os.Stat(filepath.Join(depPath, "generated.txt")); !os.IsNotExist(err) {
+		t.Error("hook ran without being allowed")
+	}
+
+	allowHooks = true
+	ran, err = runPostInstall(repoURL, dep)
+	if !ran || err != nil {
+		t.Fatalf("allowed hook: ran = %v, err = %v", ran, err)
+	}
+	data, err := os.ReadFile(filepath.Join(depPath, "generated.txt"))
+	if err != nil || strings.TrimSpace(string(data)) != repoURL+"@"+dep.SHA {
+		t.Errorf("generated.txt = %q, %v", data, err)
+	}
+
+	dep.PostInstall = "exit 3"
+	if _, err := runPostInstall(repoURL, dep); err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("failing hook error = %v", err)
+	}
+
+	if ran, err := runPostInstall(repoURL, Dependency{}); ran || err != nil {
+		t.Errorf("no hook: ran = %v, err = %v", ran, err)
+	}
+}
+
+func TestConfigureHooks(t *testing.T) {
+	defer func() { allowHooks = false }()
+
+	t.Setenv("DEPS_ALLOW_HOOKS", "")
+	configureHooks(false)
+	if allowHooks {
+		t.Error("hooks allowed by default")
+	}
+	configureHooks(true)
+	if !allowHooks {
+		t.Error("--allow-hooks didn't allow hooks")
+	}
+	t.Setenv("DEPS_ALLOW_HOOKS", "1")
+	configureHooks(false)
+	if !allowHooks {
+		t.Error("DEPS_ALLOW_HOOKS=1 didn't allow hooks")
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cachedResponse is a GitHub API response stored on disk with its ETag
+type cachedResponse struct {
+	URL         string `json:"url"`
+	ETag        string `json:"etag"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body"`
+}
+
+// cacheTransport makes GitHub API GET requests conditional on the ETag of the
+// last response for the same URL, and serves the stored body on 304 Not
+// Modified. GitHub doesn't count 304s against the rate limit.
+type cacheTransport struct {
+	dir  string
+	base http.RoundTripper
+}
+
+// cacheable reports whether req is a metadata request worth caching. Archive
+// downloads are large and addressed by commit, so they are left alone.
+func cacheable(req *http.Request) bool {
+	api, err := url.Parse(githubAPIBaseURL)
+	if err != nil || req.Method != "GET" || req.URL.Host != api.Host {
+		return false
+	}
+	return !strings.Contains(req.URL.Path, "/tarball/") && !strings.Contains(req.URL.Path, "/zipball/")
+}
+
+// cachePath returns the cache file for req. The Authorization header is part
+// of the key since private repositories answer differently per token.
+func (t *cacheTransport) cachePath(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.URL.String() + "\n" + req.Header.Get("Authorization") + "\n" + req.Header.Get("Accept")))
+	return filepath.Join(t.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !cacheable(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	path := t.cachePath(req)
+	var cached cachedResponse
+	if data, err := os.ReadFile(path); err == nil && json.Unmarshal(data, &cached) == nil && cached.ETag != "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.ETag)
+	} else {
+		cached = cachedResponse{}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached.ETag != "" {
+		resp.Body.Close()
+		resp.StatusCode = http.StatusOK
+		resp.Status = "200 OK"
+		resp.Header.Set("Content-Type", cached.ContentType)
+		resp.Body = io.NopCloser(bytes.NewReader(cached.Body))
+		resp.ContentLength = int64(len(cached.Body))
+		return resp, nil
+	}
+
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	// Failing to write the cache shouldn't fail the request. The entry is
+	// renamed into place, as parallel lookups may be reading it.
+	data, err := json.Marshal(cachedResponse{URL: req.URL.String(), ETag: etag, ContentType: resp.Header.Get("Content-Type"), Body: body})
+	if err == nil && os.MkdirAll(t.dir, 0755) == nil {
+		if tmp, err := createTemp(t.dir, ".tmp-"); err == nil {
+			_, err = tmp.Write(data)
+			if closeErr := tmp.Close(); err == nil {
+				err = closeErr
+			}
+			if err == nil {
+				err = renameIntoPlace(tmp.Name(), path)
+			}
+			if err != nil {
+				removeTemp(tmp.Name())
+			}
+		}
+	}
+
+	return resp, nil
+}
+
+// httpCacheDir returns where API responses are cached, under cacheDir
+func httpCacheDir() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "http"), nil
+}
+
+// configureHTTPCache wraps httpClient with the on-disk API response cache,
+// unless the http-cache setting (or DEPS_HTTP_CACHE) is off. It must run before
+// configureGitHubAuth so the cache sees the Authorization header it keys
+// entries by.
+func configureHTTPCache() {
+	if configValue("http-cache") != "" && !configBool("http-cache") {
+		return
+	}
+	dir, err := httpCacheDir()
+	if err != nil {
+		return
+	}
+
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client := *httpClient
+	client.Transport = &cacheTransport{dir: dir, base: base}
+	httpClient = &client
+}
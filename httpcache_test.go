@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheTransport_ConditionalRequests(t *testing.T) {
+	requests, notModified := 0, 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, `{"default_branch":"main"}`)
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+	httpClient = &http.Client{Transport: &cacheTransport{dir: t.TempDir(), base: httpClient.Transport}}
+
+	for i := 0; i < 2; i++ {
+		info, err := getRepoInfo("testowner", "testrepo")
+		if err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i, err)
+		}
+		if info.DefaultBranch != "main" {
+			t.Errorf("request %d: default branch = %q, want main", i, info.DefaultBranch)
+		}
+	}
+
+	if requests != 2 || notModified != 1 {
+		t.Errorf("got %d requests, %d conditional; want 2 and 1", requests, notModified)
+	}
+}
+
+func TestCacheTransport_SkipsArchives(t *testing.T) {
+	dir := t.TempDir()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/tarball/abc", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"tar"`)
+		fmt.Fprint(w, "archive")
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+	httpClient = &http.Client{Transport: &cacheTransport{dir: dir, base: httpClient.Transport}}
+
+	resp, err := httpClient.Get(githubTarballURL("testowner", "testrepo", "abc"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("archive response should not be cached, found %d entries", len(entries))
+	}
+}
+
+func TestHTTPCacheDir(t *testing.T) {
+	cacheDir := t.TempDir()
+	t.Setenv("DEPS_CACHE_DIR", cacheDir)
+	dir, err := httpCacheDir()
+	if err != nil || dir != filepath.Join(cacheDir, "http") {
+		t.Errorf("httpCacheDir = %q, %v", dir, err)
+	}
+}
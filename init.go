@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// findInstalledDeps lists the repository URLs with a directory under .deps,
+// e.g. "github.com/user/repo" for .deps/github.com/user/repo, and
+// "github.com/user/repo//pkg" for .deps/github.com/user/repo%2F%2Fpkg. In the
+// flat layout subdirectory dependencies can't be told apart from other
+// repositories, so only whole ones are found.
+func findInstalledDeps() ([]string, error) {
+	if depsLayout == layoutFlat {
+		return findInstalledFlatDeps()
+	}
+	var repoURLs []string
+	patterns := []string{
+		filepath.Join(depsDir, "github.com", "*", "*"),
+		filepath.Join(depsDir, "dev.azure.com", "*", "*", "_git", "*"),
+	}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			if info, err := os.Stat(match); err != nil || !info.IsDir() {
+				continue
+			}
+			rel, err := filepath.Rel(depsDir, match)
+			if err != nil {
+				return nil, err
+			}
+			segments := strings.Split(filepath.ToSlash(rel), "/")
+			for i, segment := range segments {
+				segments[i] = unescapePathSegment(segment)
+			}
+			repoURLs = append(repoURLs, strings.Join(segments, "/"))
+		}
+	}
+	return repoURLs, nil
+}
+
+// findInstalledFlatDeps is findInstalledDeps for the flat layout, where only
+// GitHub repositories, as owner__repo, can be told apart
+func findInstalledFlatDeps() ([]string, error) {
+	entries, err := os.ReadDir(depsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var repoURLs []string
+	for _, entry := range entries {
+		// Split before unescaping, since a part can have an escaped "__"
+		parts := strings.Split(entry.Name(), flatSeparator)
+		if !entry.IsDir() || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			continue
+		}
+		repoURLs = append(repoURLs, "github.com/"+unescapePathSegment(parts[0])+"/"+unescapePathSegment(parts[1]))
+	}
+	return repoURLs, nil
+}
+
+// backfillDependency works out a lock entry for a dependency that is already
+// installed. A git checkout records its current commit and the branch or tag
+// it is on. Anything else is assumed to be at the tip of the default branch,
+// since extracted tarballs don't say which commit they came from; verified
+// reports which of the two it was.
+func backfillDependency(repoURL string) (dep Dependency, verified bool, err error) {
+	depPath := getDepPath(repoURL)
+	if _, err := os.Stat(filepath.Join(depPath, ".git")); err == nil {
+		out, err := runGit(depPath, "rev-parse", "HEAD")
+		if err != nil {
+			return Dependency{}, false, err
+		}
+		dep.SHA = strings.TrimSpace(out)
+		dep.Ref = dep.SHA
+		if branch, err := runGit(depPath, "symbolic-ref", "--short", "-q", "HEAD"); err == nil && strings.TrimSpace(branch) != "" {
+			dep.Ref = strings.TrimSpace(branch)
+		} else if tag, err := runGit(depPath, "describe", "--tags", "--exact-match"); err == nil {
+			dep.Ref = strings.TrimSpace(tag)
+		}
+		return dep, true, nil
+	}
+
+	sha, resolvedRef, err := resolveDependencyRef(repoURL, transportHTTPS, "")
+	if err != nil {
+		return Dependency{}, false, err
+	}
+	return Dependency{Ref: resolvedRef, SHA: sha}, false, nil
+}
+
+// gitignoreHasDeps reports whether .gitignore already ignores .deps
+func gitignoreHasDeps() bool {
+	data, err := os.ReadFile(".gitignore")
+	if err != nil {
+		return false
+	}
+	dir := filepath.ToSlash(depsDir)
+	for _, line := range strings.Split(string(data), "\n") {
+		switch strings.TrimSpace(line) {
+		case dir, dir + "/", "/" + dir, "/" + dir + "/":
+			return true
+		}
+	}
+	return false
+}
+
+// addDepsToGitignore appends .deps/ to .gitignore, creating it if needed
+func addDepsToGitignore() error {
+	data, err := os.ReadFile(".gitignore")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	entry := filepath.ToSlash(depsDir) + "/\n"
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		entry = "\n" + entry
+	}
+
+	f, err := os.OpenFile(".gitignore", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(entry)
+	return err
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindInstalledDeps(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	for _, dir := range []string{
+		".deps/github.com/user/repo/src",
+		".deps/github.com/user/repo%2F%2Fpkg",
+		".deps/github.com/other/lib",
+		".deps/dev.azure.com/org/project/_git/tools",
+	} {
+		os.MkdirAll(filepath.FromSlash(dir), 0755)
+	}
+	os.WriteFile(filepath.Join(".deps", "github.com", "user", "stray.txt"), nil, 0644)
+
+	got, err := findInstalledDeps()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"github.com/other/lib", "github.com/user/repo", "github.com/user/repo//pkg", "dev.azure.com/org/project/_git/tools"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findInstalledDeps() = %v, want %v", got, want)
+	}
+}
+
+func TestFindInstalledDeps_Flat(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	t.Cleanup(func() { depsLayout = layoutNested })
+	depsLayout = layoutFlat
+
+	for _, key := range []string{"github.com/user/repo", "github.com/a/b__c", "github.com/a/b//c"} {
+		os.MkdirAll(getDepPath(key), 0755)
+	}
+
+	got, err := findInstalledDeps()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// a__b__c could be a subdirectory of anything, so it isn't listed
+	want := []string{"github.com/a/b__c", "github.com/user/repo"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findInstalledDeps() = %v, want %v", got, want)
+	}
+}
+
+func TestBackfillDependency_DefaultBranch(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"default_branch":"main"}`)
+	})
+	mux.HandleFunc("/repos/testowner/testrepo/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"commit":{"sha":"abc123def456abc123def456abc123def456abc1"}}`)
+	})
+	serverCleanup := testGitHubServer(t, mux)
+	defer serverCleanup()
+
+	repoURL := "github.com/testowner/testrepo"
+	os.MkdirAll(getDepPath(repoURL), 0755)
+
+	dep, verified, err := backfillDependency(repoURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if verified {
+		t.Error("a directory without .git can't be verified")
+	}
+	if dep.Ref != "main" || dep.SHA != "abc123def456abc123def456abc123def456abc1" {
+		t.Errorf("dep = %+v, want main at abc123", dep)
+	}
+}
+
+func TestAddDepsToGitignore(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	if gitignoreHasDeps() {
+		t.Error("no .gitignore should not ignore .deps")
+	}
+
+	os.WriteFile(".gitignore", []byte("node_modules"), 0644)
+	if err := addDepsToGitignore(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, _ := os.ReadFile(".gitignore")
+	if string(data) != "node_modules\n.deps/\n" {
+		t.Errorf(".gitignore = %q", data)
+	}
+	if !gitignoreHasDeps() {
+		t.Error("expected .deps/ to be ignored after adding it")
+	}
+}
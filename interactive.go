@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Keys understood by the update selector
+const (
+	keyCtrlC  = 0x03
+	keyEnter  = '\r'
+	keyEscape = 0x1b
+)
+
+// rawTerminal switches the terminal on stdin to unbuffered, unechoed input so
+// single key presses can be read. Ctrl-C arrives as a byte rather than a
+// signal. It relies on stty, so it fails on Windows and the caller should
+// fall back to line input.
+func rawTerminal() (restore func(), err error) {
+	stty := func(args ...string) (string, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = os.Stdin
+		out, err := cmd.Output()
+		return strings.TrimSpace(string(out)), err
+	}
+
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("-icanon", "-echo", "-isig", "min", "1"); err != nil {
+		return nil, err
+	}
+	return func() { stty(saved) }, nil
+}
+
+// chooseUpdates lets the user pick which of the available updates to apply,
+// with single key presses when the terminal allows it
+func chooseUpdates(updates []availableUpdate) ([]availableUpdate, error) {
+	restore, err := rawTerminal()
+	if err != nil {
+		return selectUpdatesByNumber(os.Stdin, os.Stdout, updates)
+	}
+	defer restore()
+	return selectUpdates(os.Stdin, os.Stdout, updates)
+}
+
+// updateLine describes an available update in the selector
+func updateLine(update availableUpdate) string {
+	return fmt.Sprintf("%s  %s (%s) → %s (%s)", update.RepoURL, update.Current.Ref, update.Current.SHA[:8], update.LatestRef, update.Latest.SHA[:8])
+}
+
+// selectUpdates shows a checklist of updates read from key presses on in:
+// up/down (or k/j) move, space toggles, "a" toggles all, enter confirms and
+// q, escape or Ctrl-C cancels. Nothing is selected to begin with.
+func selectUpdates(in io.Reader, out io.Writer, updates []availableUpdate) ([]availableUpdate, error) {
+	selected := make([]bool, len(updates))
+	cursor := 0
+
+	render := func(redraw bool) {
+		if redraw {
+			fmt.Fprintf(out, "\x1b[%dA", len(updates))
+		}
+		for i, update := range updates {
+			pointer, box := " ", "[ ]"
+			if i == cursor {
+				pointer = colorize(colorYellow, ">")
+			}
+			if selected[i] {
+				box = colorize(colorGreen, "[x]")
+			}
+			fmt.Fprintf(out, "\r\x1b[K%s %s %s\n", pointer, box, updateLine(update))
+		}
+	}
+
+	fmt.Fprintln(out, "Select updates to apply (↑/↓ move, space toggle, a all, enter apply, q cancel):")
+	render(false)
+
+	r := bufio.NewReader(in)
+	for {
+		key, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		switch key {
+		case keyEscape:
+			// Arrow keys arrive as ESC [ A and ESC [ B; a lone escape cancels
+			if r.Buffered() < 2 {
+				return nil, nil
+			}
+			seq := make([]byte, 2)
+			io.ReadFull(r, seq)
+			switch string(seq) {
+			case "[A":
+				cursor = (cursor + len(updates) - 1) % len(updates)
+			case "[B":
+				cursor = (cursor + 1) % len(updates)
+			}
+		case 'k':
+			cursor = (cursor + len(updates) - 1) % len(updates)
+		case 'j':
+			cursor = (cursor + 1) % len(updates)
+		case ' ':
+			selected[cursor] = !selected[cursor]
+		case 'a':
+			all := true
+			for _, s := range selected {
+				all = all && s
+			}
+			for i := range selected {
+				selected[i] = !all
+			}
+		case keyEnter, '\n':
+			var chosen []availableUpdate
+			for i, update := range updates {
+				if selected[i] {
+					chosen = append(chosen, update)
+				}
+			}
+			return chosen, nil
+		case 'q', keyCtrlC:
+			return nil, nil
+		default:
+			continue
+		}
+		render(true)
+	}
+}
+
+// selectUpdatesByNumber is the line-based fallback for terminals without raw
+// input: it lists the updates and reads the numbers to apply, or "a" for all
+func selectUpdatesByNumber(in io.Reader, out io.Writer, updates []availableUpdate) ([]availableUpdate, error) {
+	for i, update := range updates {
+		fmt.Fprintf(out, "%3d) %s\n", i+1, updateLine(update))
+	}
+	fmt.Fprint(out, "Updates to apply (e.g. 1 3, a for all, nothing to cancel): ")
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "a" {
+		return updates, nil
+	}
+
+	selected := make([]bool, len(updates))
+	for _, field := range strings.FieldsFunc(answer, func(r rune) bool { return r == ' ' || r == ',' }) {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 1 || n > len(updates) {
+			return nil, fmt.Errorf("no update %s", field)
+		}
+		selected[n-1] = true
+	}
+
+	var chosen []availableUpdate
+	for i, update := range updates {
+		if selected[i] {
+			chosen = append(chosen, update)
+		}
+	}
+	return chosen, nil
+}
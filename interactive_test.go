@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testUpdates() []availableUpdate {
+	var updates []availableUpdate
+	for _, name := range []string{"a", "b", "c"} {
+		updates = append(updates, availableUpdate{
+			RepoURL:   "github.com/testowner/" + name,
+			Current:   Dependency{Ref: "main", SHA: "1111111111111111111111111111111111111111"},
+			Latest:    Dependency{Ref: "main", SHA: "2222222222222222222222222222222222222222"},
+			LatestRef: "main",
+		})
+	}
+	return updates
+}
+
+func chosenURLs(updates []availableUpdate) string {
+	var urls []string
+	for _, update := range updates {
+		urls = append(urls, strings.TrimPrefix(update.RepoURL, "github.com/testowner/"))
+	}
+	return strings.Join(urls, ",")
+}
+
+func TestSelectUpdates(t *testing.T) {
+	tests := []struct {
+		name string
+		keys string
+		want string
+	}{
+		{"nothing selected", "\r", ""},
+		{"toggle first", " \r", "a"},
+		{"move with j and arrows", "j \x1b[B \r", "b,c"},
+		{"wrap upwards", "\x1b[A \r", "c"},
+		{"toggle all", "a\r", "a,b,c"},
+		{"toggle all off again", " aa\r", ""},
+		{"toggle twice", "  \r", ""},
+		{"cancel", "  q", ""},
+		{"ctrl-c", " \x03", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			chosen, err := selectUpdates(strings.NewReader(tt.keys), &out, testUpdates())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := chosenURLs(chosen); got != tt.want {
+				t.Errorf("chosen = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectUpdates_EOF(t *testing.T) {
+	var out bytes.Buffer
+	if _, err := selectUpdates(strings.NewReader(" "), &out, testUpdates()); err == nil {
+		t.Error("expected error when input ends without a choice, got nil")
+	}
+}
+
+func TestSelectUpdatesByNumber(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"\n", "", false},
+		{"3 1\n", "a,c", false},
+		{"1,2,2\n", "a,b", false},
+		{"a\n", "a,b,c", false},
+		{"4\n", "", true},
+		{"x\n", "", true},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		chosen, err := selectUpdatesByNumber(strings.NewReader(tt.input), &out, testUpdates())
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got := chosenURLs(chosen); got != tt.want {
+			t.Errorf("%q: chosen = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// runContext is cancelled when the user presses Ctrl-C or the overall
+// --timeout expires. Every HTTP request and git command runs under it.
+var runContext = context.Background()
+
+// defaultRequestTimeout bounds how long a single request waits for a response
+const defaultRequestTimeout = 60 * time.Second
+
+// requestTimeout is applied to each request by configureHTTPClient
+var requestTimeout = defaultRequestTimeout
+
+// sleep waits for d, returning early if runContext is cancelled. It is
+// replaced in tests.
+var sleep = func(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-runContext.Done():
+	}
+}
+
+// configureContext sets up runContext to be cancelled on SIGINT or SIGTERM
+// and, if timeout is non-zero, after timeout. A second signal exits
+// immediately, after putting back what the installs under way set aside. The
+// returned function releases the context's resources.
+func configureContext(timeout time.Duration) context.CancelFunc {
+	ctx, cancelSignal := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancelSignal()
+		<-signals
+		exitAfterCleanup(130)
+	}()
+	stop := func() {
+		signal.Stop(signals)
+		cancelSignal()
+	}
+
+	cancel := stop
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		cancel = func() {
+			cancelTimeout()
+			stop()
+		}
+	}
+	runContext = ctx
+	return cancel
+}
+
+// exitIfInterrupted exits once runContext has been cancelled, so commands
+// stop rather than failing on every remaining dependency
+func exitIfInterrupted() {
+	switch runContext.Err() {
+	case nil:
+		return
+	case context.DeadlineExceeded:
+		errorf("%s Timed out\n", colorize(colorRed, "✗"))
+	default:
+		errorf("%s Interrupted\n", colorize(colorRed, "✗"))
+	}
+	exitAfterCleanup(130)
+}
+
+// contextTransport runs requests under runContext so they are aborted when
+// it is cancelled
+type contextTransport struct {
+	base http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Context() == context.Background() {
+		req = req.WithContext(runContext)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// configureContextTransport wraps httpClient so requests follow runContext.
+// It runs after the other transports so they all see the context.
+func configureContextTransport() {
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client := *httpClient
+	client.Transport = &contextTransport{base: base}
+	httpClient = &client
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useRunContext replaces runContext for the duration of a test
+func useRunContext(t *testing.T, ctx context.Context) {
+	t.Helper()
+	orig := runContext
+	runContext = ctx
+	t.Cleanup(func() { runContext = orig })
+}
+
+func TestContextTransport_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	useRunContext(t, ctx)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo", func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		<-r.Context().Done()
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+	httpClient = &http.Client{Transport: &contextTransport{base: httpClient.Transport}}
+
+	if _, err := getRepoInfo("testowner", "testrepo"); err == nil {
+		t.Error("expected error once the run context is cancelled, got nil")
+	}
+}
+
+func TestSleep_ReturnsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	useRunContext(t, ctx)
+	cancel()
+
+	start := time.Now()
+	sleep(time.Minute)
+	if time.Since(start) > time.Second {
+		t.Error("sleep should return early once the run context is cancelled")
+	}
+}
+
+func TestFetchDependency_KeepsPreviousInstall(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/tarball/abc", func(w http.ResponseWriter, r *http.Request) {
+		// Not a gzip stream, so extraction fails
+		w.Write([]byte("not a tarball"))
+	})
+
+	serverCleanup := testGitHubServer(t, mux)
+	defer serverCleanup()
+
+	repoURL := "github.com/testowner/testrepo"
+	os.MkdirAll(getDepPath(repoURL), 0755)
+	os.WriteFile(filepath.Join(getDepPath(repoURL), "lib.h"), []byte("// installed"), 0644)
+
+	if _, err := fetchDependency(repoURL, Dependency{SHA: "abc"}); err == nil {
+		t.Fatal("expected error for invalid tarball, got nil")
+	}
+	if data, _ := os.ReadFile(filepath.Join(getDepPath(repoURL), "lib.h")); string(data) != "// installed" {
+		t.Errorf("lib.h = %q, want the previous install kept", data)
+	}
+	if leftover, _ := filepath.Glob(filepath.Join(filepath.Dir(getDepPath(repoURL)), ".*")); len(leftover) != 0 {
+		t.Errorf("extraction left %v behind", leftover)
+	}
+}
+
+func TestInstallDependency_RestoresPreviousInstall(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	sha := "abc123def456abc123def456abc123def456abc1"
+	_, restore := cachedTarballServer(t, sha)
+	defer restore()
+
+	repoURL := "github.com/testowner/repo"
+	depPath := getDepPath(repoURL)
+	os.MkdirAll(depPath, 0755)
+	os.WriteFile(filepath.Join(depPath, "lib.h"), []byte("// installed"), 0644)
+
+	// The download is complete but doesn't match the lock file
+	if _, err := installDependency(repoURL, Dependency{SHA: sha, TreeHash: "0000"}); err == nil {
+		t.Fatal("expected a tree hash mismatch, got nil")
+	}
+	if data, _ := os.ReadFile(filepath.Join(depPath, "lib.h")); string(data) != "// installed" {
+		t.Errorf("lib.h = %q, want the previous install put back", data)
+	}
+	if _, err := os.Stat(filepath.Join(depPath, "src")); !os.IsNotExist(err) {
+		t.Error("the rejected download was left in place")
+	}
+	if leftover, _ := filepath.Glob(filepath.Join(filepath.Dir(depPath), ".*")); len(leftover) != 0 {
+		t.Errorf("install left %v behind", leftover)
+	}
+	if len(setAside) != 0 || len(tempPaths) != 0 {
+		t.Errorf("still tracking %v and %v", setAside, tempPaths)
+	}
+}
+
+func TestPendingInstall(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	depPath := filepath.Join(".deps", "github.com", "testowner", "repo")
+
+	// With nothing installed before, a rollback leaves nothing
+	install, err := beginInstall(depPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, depPath, map[string]string{"new.h": "// new"})
+	install.rollback()
+	if _, err := os.Stat(depPath); !os.IsNotExist(err) {
+		t.Errorf("rollback left %s, want nothing as before", depPath)
+	}
+
+	// A commit keeps the new install over the previous one
+	writeTree(t, depPath, map[string]string{"old.h": "// old"})
+	if install, err = beginInstall(depPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(depPath); !os.IsNotExist(err) {
+		t.Error("the previous install should be set aside")
+	}
+	writeTree(t, depPath, map[string]string{"new.h": "// new"})
+	install.commit()
+	if _, err := os.Stat(filepath.Join(depPath, "new.h")); err != nil {
+		t.Errorf("commit lost the new install: %v", err)
+	}
+	if leftover, _ := filepath.Glob(filepath.Join(filepath.Dir(depPath), ".*")); len(leftover) != 0 {
+		t.Errorf("commit left %v behind", leftover)
+	}
+}
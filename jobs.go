@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultResolveJobs is how many refs are resolved at once by default. It is
+// more than there usually are CPUs, as resolving mostly waits on the network.
+const defaultResolveJobs = 8
+
+// installJobs is how many dependencies are downloaded and extracted at once,
+// and resolveJobs how many are resolved at once by check and update, set by
+// configureJobs
+var (
+	installJobs = runtime.NumCPU()
+	resolveJobs = defaultResolveJobs
+)
+
+// concurrentJobs is set while jobs run in parallel, when progress lines,
+// which are one per terminal, aren't shown
+var concurrentJobs bool
+
+// configureJobs sets installJobs and resolveJobs to jobs (-j or --jobs) if
+// it is above 0, otherwise to the jobs setting (or DEPS_JOBS). Without
+// either they keep their defaults, the number of CPUs and
+// defaultResolveJobs.
+func configureJobs(jobs int) error {
+	installJobs, resolveJobs = runtime.NumCPU(), defaultResolveJobs
+	if jobs <= 0 {
+		value, origin := configLookup("jobs")
+		if value == "" {
+			return nil
+		}
+		n, err := parseJobs(value)
+		if err != nil {
+			return fmt.Errorf("%v in %s", err, origin)
+		}
+		jobs = n
+	}
+	installJobs, resolveJobs = jobs, jobs
+	return nil
+}
+
+// parseJobs reads a number of jobs, which must be at least 1
+func parseJobs(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid jobs %q (expected a number of at least 1)", s)
+	}
+	return n, nil
+}
+
+func validateJobs(jobs string) error {
+	_, err := parseJobs(jobs)
+	return err
+}
+
+// installGroups splits the dependencies at paths, by index, into groups that
+// can be installed alongside each other. Dependencies installed one inside the
+// other, like a repository and a subdirectory dependency on it, are in the
+// same group, since installing the outer one replaces the inner one's
+// directory too. Groups and their members keep the order of paths.
+func installGroups(paths []string) [][]int {
+	label := make([]int, len(paths))
+	for i, path := range paths {
+		label[i] = i
+		for j := 0; j < i; j++ {
+			if !pathsNest(path, paths[j]) || label[j] == label[i] {
+				continue
+			}
+			// Everything in j's group joins i's, which is the earlier one
+			from, to := max(label[i], label[j]), min(label[i], label[j])
+			for k := 0; k <= i; k++ {
+				if label[k] == from {
+					label[k] = to
+				}
+			}
+		}
+	}
+
+	var groups [][]int
+	index := make(map[int]int)
+	for i := range paths {
+		g, ok := index[label[i]]
+		if !ok {
+			g = len(groups)
+			index[label[i]] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups
+}
+
+// pathsNest reports whether a and b are the same directory or one is inside
+// the other
+func pathsNest(a, b string) bool {
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	sep := string(filepath.Separator)
+	return a == b || strings.HasPrefix(a, b+sep) || strings.HasPrefix(b, a+sep)
+}
+
+// separateGroups returns n groups of one, for jobs that don't depend on each
+// other
+func separateGroups(n int) [][]int {
+	groups := make([][]int, n)
+	for i := range groups {
+		groups[i] = []int{i}
+	}
+	return groups
+}
+
+// runJobs calls do for every index in groups, running up to jobs groups at
+// once and the members of each group one after another. Nothing more is
+// started once runContext is cancelled.
+func runJobs(jobs int, groups [][]int, do func(i int)) {
+	workers := min(jobs, len(groups))
+	if workers <= 1 {
+		for _, group := range groups {
+			for _, i := range group {
+				if runContext.Err() != nil {
+					return
+				}
+				do(i)
+			}
+		}
+		return
+	}
+
+	concurrentJobs = true
+	defer func() { concurrentJobs = false }()
+
+	work := make(chan []int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range work {
+				for _, i := range group {
+					if runContext.Err() != nil {
+						break
+					}
+					do(i)
+				}
+			}
+		}()
+	}
+	for _, group := range groups {
+		if runContext.Err() != nil {
+			break
+		}
+		work <- group
+	}
+	close(work)
+	wg.Wait()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInstallGroups(t *testing.T) {
+	paths := []string{
+		filepath.Join(".deps", "github.com", "a", "lib"),
+		filepath.Join(".deps", "github.com", "a", "lib", "sub"),
+		filepath.Join(".deps", "github.com", "a", "library"),
+		filepath.Join(".deps", "github.com", "b", "lib"),
+	}
+	want := [][]int{{0, 1}, {2}, {3}}
+	if got := installGroups(paths); !reflect.DeepEqual(got, want) {
+		t.Errorf("installGroups = %v, want %v", got, want)
+	}
+
+	// A path inside two earlier ones joins their groups
+	paths = []string{filepath.Join("x", "a"), filepath.Join("y"), filepath.Join("x")}
+	want = [][]int{{0, 2}, {1}}
+	if got := installGroups(paths); !reflect.DeepEqual(got, want) {
+		t.Errorf("installGroups = %v, want %v", got, want)
+	}
+}
+
+func TestConfigureJobs(t *testing.T) {
+	origInstall, origResolve := installJobs, resolveJobs
+	t.Cleanup(func() { installJobs, resolveJobs = origInstall, origResolve })
+
+	if err := configureJobs(0); err != nil || resolveJobs != defaultResolveJobs {
+		t.Errorf("configureJobs(0) = %v, resolveJobs %d", err, resolveJobs)
+	}
+	t.Setenv("DEPS_JOBS", "3")
+	if err := configureJobs(0); err != nil || installJobs != 3 || resolveJobs != 3 {
+		t.Errorf("configureJobs from env = %v, installJobs %d, resolveJobs %d", err, installJobs, resolveJobs)
+	}
+	if err := configureJobs(5); err != nil || installJobs != 5 {
+		t.Errorf("configureJobs(5) = %v, installJobs %d", err, installJobs)
+	}
+	t.Setenv("DEPS_JOBS", "none")
+	if err := configureJobs(0); err == nil {
+		t.Error("configureJobs should reject DEPS_JOBS=none")
+	}
+}
+
+func TestRunJobs(t *testing.T) {
+	var mu sync.Mutex
+	running, most := 0, 0
+	var order []int
+	done := make([]bool, 6)
+	// 0 and 1 are one group, which runs in order
+	runJobs(3, [][]int{{0, 1}, {2}, {3}, {4}, {5}}, func(i int) {
+		mu.Lock()
+		running++
+		most = max(most, running)
+		if i < 2 {
+			order = append(order, i)
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		done[i] = true
+		mu.Unlock()
+	})
+	if most > 3 {
+		t.Errorf("%d jobs ran at once, want at most 3", most)
+	}
+	if !reflect.DeepEqual(order, []int{0, 1}) {
+		t.Errorf("group ran in order %v", order)
+	}
+	for i, ok := range done {
+		if !ok {
+			t.Errorf("job %d didn't run", i)
+		}
+	}
+}
+
+func TestExtractGlobalFlags_Jobs(t *testing.T) {
+	for _, args := range [][]string{{"install", "-j", "4"}, {"-j4", "install"}, {"install", "--jobs=4"}} {
+		globalOptions = options{}
+		rest, err := extractGlobalFlags(args)
+		if err != nil || globalOptions.Jobs != 4 || !reflect.DeepEqual(rest, []string{"install"}) {
+			t.Errorf("extractGlobalFlags(%q) = %q, %v with jobs %d", args, rest, err, globalOptions.Jobs)
+		}
+	}
+	globalOptions = options{}
+	if _, err := extractGlobalFlags([]string{"install", "-j", "0"}); err == nil {
+		t.Error("-j 0 should be rejected")
+	}
+}
+
+func TestInstallDependencies_Parallel(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	orig := installJobs
+	installJobs = 4
+	t.Cleanup(func() { installJobs = orig })
+
+	mux := http.NewServeMux()
+	lockFile := &LockFile{Dependencies: map[string]Dependency{}}
+	for i := 0; i < 8; i++ {
+		repo := fmt.Sprintf("repo%d", i)
+		tarball := makeTarGz(t, repo+"-abc1234/", map[string]string{"lib.h": "// " + repo, "sub/lib.h": "// sub"}).Bytes()
+		mux.HandleFunc("/repos/testowner/"+repo+"/tarball/abc1234567", func(w http.ResponseWriter, r *http.Request) {
+			w.Write(tarball)
+		})
+		lockFile.Dependencies["github.com/testowner/"+repo] = Dependency{Ref: "main", SHA: "abc1234567"}
+	}
+	// A subdirectory dependency is installed inside repo0's directory
+	lockFile.Dependencies["github.com/testowner/repo0//sub"] = Dependency{Ref: "main", SHA: "abc1234567"}
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	var failed bool
+	out, _ := captureOutput(t, func() {
+		_, failed = installDependencies(lockFile, func(string, Dependency) string { return "" })
+	})
+	if failed {
+		t.Fatalf("installDependencies failed:\n%s", out)
+	}
+
+	sums, err := loadSums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for repoURL, dep := range lockFile.Dependencies {
+		if dep.TreeHash == "" {
+			t.Errorf("%s: no tree hash recorded", repoURL)
+		}
+		if _, ok := sums[repoURL]; !ok {
+			t.Errorf("%s: no checksums recorded", repoURL)
+		}
+		if _, err := os.Stat(filepath.Join(getDepPath(repoURL), "lib.h")); err != nil {
+			t.Errorf("%s: %v", repoURL, err)
+		}
+	}
+}
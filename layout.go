@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// In the default nested layout, dependencies are installed under depsDir at
+// their lock key, a directory per "/"-separated segment of the repository,
+// with any "#name" kept on the last one. A subdirectory dependency's "//path"
+// is also kept on the repository's segment, its slashes escaped, so that
+// github.com/org/repo//pkg installs beside github.com/org/repo rather than
+// inside it, where the two would overwrite each other. Segments are escaped
+// so that the same layout works on every platform: characters Windows
+// doesn't allow in file names (and "%" itself) become %XX, as do trailing
+// dots and spaces and segments that are "." or "..", and device names
+// Windows reserves, like CON or aux.c, have their last letter escaped. The
+// keys of GitHub and Azure DevOps repositories need none of this, so their
+// paths are the key itself. A URL source installs under a directory for its
+// host, the rest of its URL escaped as one name.
+
+// The ways dependencies can be laid out under depsDir
+const (
+	layoutNested = "nested" // .deps/github.com/owner/repo, as described above
+	layoutFlat   = "flat"   // .deps/owner__repo, for tools that want one level
+)
+
+// flatSeparator joins the parts of a key in the flat layout
+const flatSeparator = "__"
+
+// depsLayout is the layout setting
+var depsLayout = layoutNested
+
+// configureLayout reads the layout setting (or DEPS_LAYOUT)
+func configureLayout() error {
+	depsLayout = layoutNested
+	if value, origin := configLookup("layout"); value != "" {
+		if err := validateLayout(value); err != nil {
+			return fmt.Errorf("%v in %s", err, origin)
+		}
+		depsLayout = value
+	}
+	return nil
+}
+
+func validateLayout(layout string) error {
+	if layout != layoutNested && layout != layoutFlat {
+		return fmt.Errorf("invalid layout %q (use %s or %s)", layout, layoutNested, layoutFlat)
+	}
+	return nil
+}
+
+// layoutPath returns the path under depsDir for a lock key or alias
+func layoutPath(key string) string {
+	if isURLSource(key) {
+		return urlSourcePath(key)
+	}
+	if depsLayout == layoutFlat && strings.Contains(key, "/") {
+		return flatName(key)
+	}
+	repo, subdir, _ := strings.Cut(key, "//")
+	var segments []string
+	for _, segment := range strings.Split(repo, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if subdir != "" && len(segments) > 0 {
+		segments[len(segments)-1] += "//" + subdir
+	}
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(escapePathSegment(segment), "/", "%2F")
+	}
+	return filepath.Join(segments...)
+}
+
+// urlSourcePath is layoutPath for a URL source: a directory for its host, or
+// in the flat layout a prefix, with the rest of the URL escaped as one name,
+// so that one URL never installs inside another
+func urlSourcePath(key string) string {
+	rawURL, name := splitEntryName(key)
+	_, rest, _ := strings.Cut(rawURL, "://")
+	host, rest, _ := strings.Cut(rest, "/")
+	rest = joinEntryName(rest, name)
+	escape := func(s string) string { return strings.ReplaceAll(escapePathSegment(s), "/", "%2F") }
+	if depsLayout == layoutFlat {
+		return escape(host + flatSeparator + rest)
+	}
+	return filepath.Join(escape(host), escape(rest))
+}
+
+// flatName is the one directory name the flat layout gives a lock key: the
+// owner and repository of a GitHub key, or the organization, project and
+// repository of an Azure DevOps one, and then the path of a subdirectory
+// dependency, each escaped like a segment and joined by "__", with any
+// "#name" at the end. A part that starts or ends with "_" or contains "__"
+// has its underscores escaped too, so github.com/a/b__c and github.com/a/b//c
+// don't both install in a__b__c.
+func flatName(key string) string {
+	repoURL, subdir := splitSubdir(key)
+	_, name := splitEntryName(key)
+	parts := strings.Split(repoURL, "/")[1:]
+	if isAzureURL(repoURL) {
+		parts = slices.DeleteFunc(parts, func(part string) bool { return part == "_git" })
+	}
+	if subdir != "" {
+		parts = append(parts, strings.Split(subdir, "/")...)
+	}
+	for i, part := range parts {
+		part = escapePathSegment(part)
+		if strings.HasPrefix(part, "_") || strings.HasSuffix(part, "_") || strings.Contains(part, flatSeparator) {
+			part = strings.ReplaceAll(part, "_", "%5F")
+		}
+		parts[i] = part
+	}
+	return joinEntryName(strings.Join(parts, flatSeparator), name)
+}
+
+// escapePathSegment escapes one segment of a lock key as a file name
+func escapePathSegment(segment string) string {
+	if segment == "." || segment == ".." {
+		return strings.Repeat("%2E", len(segment))
+	}
+	var b strings.Builder
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		last := i == len(segment)-1
+		if c < 0x20 || strings.IndexByte(`<>:"\|?*%`, c) >= 0 || (last && (c == '.' || c == ' ')) {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	escaped := b.String()
+	if isReservedName(escaped) {
+		base, ext, _ := strings.Cut(escaped, ".")
+		escaped = fmt.Sprintf("%s%%%02X", base[:len(base)-1], base[len(base)-1])
+		if ext != "" {
+			escaped += "." + ext
+		}
+	}
+	return escaped
+}
+
+// unescapePathSegment is the inverse of escapePathSegment
+func unescapePathSegment(segment string) string {
+	if unescaped, err := url.PathUnescape(segment); err == nil {
+		return unescaped
+	}
+	return segment
+}
+
+// isReservedName reports whether Windows reserves name for a device, with or
+// without an extension
+func isReservedName(name string) bool {
+	base, _, _ := strings.Cut(name, ".")
+	switch strings.ToUpper(strings.TrimRight(base, " ")) {
+	case "CON", "PRN", "AUX", "NUL":
+		return true
+	}
+	base = strings.ToUpper(base)
+	return len(base) == 4 && (strings.HasPrefix(base, "COM") || strings.HasPrefix(base, "LPT")) && base[3] >= '0' && base[3] <= '9'
+}
+
+// windowsSafeName reports whether every segment of the slash-separated name
+// can be created on Windows
+func windowsSafeName(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "" {
+			continue
+		}
+		for i := 0; i < len(segment); i++ {
+			if c := segment[i]; c < 0x20 || strings.IndexByte(`<>:"\|?*`, c) >= 0 {
+				return false
+			}
+		}
+		if strings.HasSuffix(segment, ".") || strings.HasSuffix(segment, " ") || isReservedName(segment) {
+			return false
+		}
+	}
+	return true
+}
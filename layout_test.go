@@ -0,0 +1,110 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLayoutPath(t *testing.T) {
+	tests := map[string]string{
+		"github.com/owner/repo":                    "github.com/owner/repo",
+		"github.com/owner/repo#v1":                 "github.com/owner/repo#v1",
+		"github.com/org/monorepo//packages/foo":    "github.com/org/monorepo%2F%2Fpackages%2Ffoo",
+		"github.com/org/monorepo//packages/foo#v1": "github.com/org/monorepo%2F%2Fpackages%2Ffoo#v1",
+		"dev.azure.com/org/My Project/_git/r":      "dev.azure.com/org/My Project/_git/r",
+		"github.com/owner/con":                     "github.com/owner/co%6E",
+		"github.com/owner/aux.c":                   "github.com/owner/au%78.c",
+		"github.com/owner/COM1":                    "github.com/owner/COM%31",
+		"github.com/owner/con//x":                  "github.com/owner/con%2F%2Fx",
+		"github.com/owner/repo//a:b|c?":            "github.com/owner/repo%2F%2Fa%3Ab%7Cc%3F",
+		"github.com/owner/repo//trailing.":         "github.com/owner/repo%2F%2Ftrailing%2E",
+		"github.com/owner/repo//100%":              "github.com/owner/repo%2F%2F100%25",
+		"github.com/owner/../../etc":               "github.com/owner/%2E%2E/%2E%2E/etc",
+		"console/contrib":                          "console/contrib",
+		"https://example.com/dl/lib-1.0.tar.gz":    "example.com/dl%2Flib-1.0.tar.gz",
+		"https://example.com:8080/a.zip?v=2#old":   "example.com%3A8080/a.zip%3Fv=2#old",
+	}
+	for key, want := range tests {
+		if got := layoutPath(key); got != filepath.FromSlash(want) {
+			t.Errorf("layoutPath(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestUnescapePathSegment(t *testing.T) {
+	for _, segment := range []string{"repo", "con", "aux.c", "a:b", "100%", "..", "trailing.", "My Project"} {
+		if got := unescapePathSegment(escapePathSegment(segment)); got != segment {
+			t.Errorf("round trip of %q = %q", segment, got)
+		}
+	}
+}
+
+func TestWindowsSafeName(t *testing.T) {
+	for _, name := range []string{"src/main.c", "docs/My File.md", "lib/console.h", "100%.txt"} {
+		if !windowsSafeName(name) {
+			t.Errorf("windowsSafeName(%q) = false, want true", name)
+		}
+	}
+	for _, name := range []string{"drivers/aux.c", "nul", "a:b", "file.", "dir /x", "LPT9.txt", "what?"} {
+		if windowsSafeName(name) {
+			t.Errorf("windowsSafeName(%q) = true, want false", name)
+		}
+	}
+}
+
+func TestLayoutPath_Flat(t *testing.T) {
+	t.Cleanup(func() { depsLayout = layoutNested })
+	depsLayout = layoutFlat
+
+	tests := map[string]string{
+		"github.com/owner/repo":                 "owner__repo",
+		"github.com/owner/repo#v1":              "owner__repo#v1",
+		"github.com/org/monorepo//packages/foo": "org__monorepo__packages__foo",
+		"dev.azure.com/org/My Project/_git/r":   "org__My Project__r",
+		"github.com/owner/a:b":                  "owner__a%3Ab",
+		"github.com/owner/my_repo":              "owner__my_repo",
+		"github.com/a/b__c":                     "a__b%5F%5Fc",
+		"github.com/a/b//c":                     "a__b__c",
+		"github.com/a_/b":                       "a%5F__b",
+		"github.com/a/_b":                       "a__%5Fb",
+		"https://example.com/dl/lib.tar.gz":     "example.com__dl%2Flib.tar.gz",
+		"my-alias":                              "my-alias",
+	}
+	for key, want := range tests {
+		if got := layoutPath(key); got != want {
+			t.Errorf("layoutPath(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestConfigureLayout(t *testing.T) {
+	t.Cleanup(func() { depsLayout = layoutNested })
+	withConfig(t, nil, nil)
+
+	t.Setenv("DEPS_LAYOUT", "flat")
+	if err := configureLayout(); err != nil || depsLayout != layoutFlat {
+		t.Errorf("configureLayout() = %v, layout %q, want flat", err, depsLayout)
+	}
+	t.Setenv("DEPS_LAYOUT", "shallow")
+	if err := configureLayout(); err == nil || !strings.Contains(err.Error(), "DEPS_LAYOUT") {
+		t.Errorf("configureLayout() = %v, want an error naming DEPS_LAYOUT", err)
+	}
+}
+
+func TestValidateLockData_FlatCollision(t *testing.T) {
+	t.Cleanup(func() { depsLayout = layoutNested })
+	depsLayout = layoutFlat
+
+	data := `{
+  "version": 1,
+  "dependencies": {
+    "github.com/a/b": {"ref": "main", "sha": "75ccf94d605a05fe24817fc2f166f6f2959d5cea"},
+    "github.com/other/lib": {"ref": "main", "sha": "75ccf94d605a05fe24817fc2f166f6f2959d5cea", "alias": "a__b"}
+  }
+}`
+	problems := validateLockData([]byte(data))
+	if len(problems) != 1 || !strings.Contains(problems[0], "would be installed in "+filepath.Join(".deps", "a__b")) {
+		t.Errorf("problems = %v, want one about both installing in a__b", problems)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var githubLFSBaseURL = "https://github.com"
+
+// lfsPointerMaxSize is the largest file considered as a possible LFS pointer
+const lfsPointerMaxSize = 1024
+
+type lfsPointer struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+type lfsBatchRequest struct {
+	Operation string       `json:"operation"`
+	Transfers []string     `json:"transfers"`
+	Objects   []lfsPointer `json:"objects"`
+}
+
+type lfsBatchResponse struct {
+	Objects []struct {
+		OID     string `json:"oid"`
+		Size    int64  `json:"size"`
+		Actions struct {
+			Download struct {
+				Href   string            `json:"href"`
+				Header map[string]string `json:"header"`
+			} `json:"download"`
+		} `json:"actions"`
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"objects"`
+}
+
+// parseLFSPointer parses a Git LFS pointer file, returning false if data is
+// not one
+func parseLFSPointer(data []byte) (lfsPointer, bool) {
+	if !bytes.HasPrefix(data, []byte("version https://git-lfs.github.com/spec/")) {
+		return lfsPointer{}, false
+	}
+
+	var pointer lfsPointer
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "oid":
+			pointer.OID = strings.TrimPrefix(value, "sha256:")
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return lfsPointer{}, false
+			}
+			pointer.Size = size
+		}
+	}
+
+	if len(pointer.OID) != 64 {
+		return lfsPointer{}, false
+	}
+	return pointer, true
+}
+
+// findLFSPointers walks root and returns the LFS pointer files in it, by path
+func findLFSPointers(root string) (map[string]lfsPointer, error) {
+	pointers := make(map[string]lfsPointer)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Size() > lfsPointerMaxSize {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if pointer, ok := parseLFSPointer(data); ok {
+			pointers[path] = pointer
+		}
+		return nil
+	})
+	return pointers, err
+}
+
+// resolveLFSPointers replaces LFS pointer files in an installed dependency
+// with the real objects, fetched through the LFS batch API
+func resolveLFSPointers(owner, repo, repoURL string) error {
+	pointers, err := findLFSPointers(getDepPath(repoURL))
+	if err != nil {
+		return err
+	}
+	if len(pointers) == 0 {
+		return nil
+	}
+
+	batch := lfsBatchRequest{Operation: "download", Transfers: []string{"basic"}}
+	seen := make(map[string]bool)
+	for _, pointer := range pointers {
+		if !seen[pointer.OID] {
+			seen[pointer.OID] = true
+			batch.Objects = append(batch.Objects, pointer)
+		}
+	}
+
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	batchURL := fmt.Sprintf("%s/%s/%s.git/info/lfs/objects/batch", githubLFSBaseURL, owner, repo)
+	req, err := http.NewRequest("POST", batchURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.git-lfs+json")
+	req.Header.Set("Content-Type", "application/vnd.git-lfs+json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return &statusError{Service: "LFS batch API", StatusCode: resp.StatusCode}
+	}
+
+	var batchResp lfsBatchResponse
+	err = json.NewDecoder(resp.Body).Decode(&batchResp)
+	if err != nil {
+		return err
+	}
+
+	// Download each object once, then copy it over every pointer to it
+	downloaded := make(map[string]string)
+	for _, obj := range batchResp.Objects {
+		if obj.Error != nil {
+			return fmt.Errorf("LFS object %s: %s", obj.OID[:12], obj.Error.Message)
+		}
+
+		tmpFile, err := downloadLFSObject(obj.OID, obj.Actions.Download.Href, obj.Actions.Download.Header)
+		if err != nil {
+			return fmt.Errorf("LFS object %s: %w", obj.OID[:12], err)
+		}
+		defer removeTemp(tmpFile)
+		downloaded[obj.OID] = tmpFile
+	}
+
+	for path, pointer := range pointers {
+		tmpFile, ok := downloaded[pointer.OID]
+		if !ok {
+			return fmt.Errorf("LFS object %s missing from batch response", pointer.OID[:12])
+		}
+		err = copyFileContents(tmpFile, path)
+		if err != nil {
+			return err
+		}
+	}
+
+	infof("  Resolved %d LFS files\n", len(pointers))
+	return nil
+}
+
+// downloadLFSObject downloads an LFS object to a temp file, verifying its
+// SHA-256 against the oid, and returns the temp file path
+func downloadLFSObject(oid, href string, header map[string]string) (string, error) {
+	req, err := http.NewRequest("GET", href, nil)
+	if err != nil {
+		return "", err
+	}
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", &statusError{Service: "download", StatusCode: resp.StatusCode}
+	}
+
+	f, err := createTemp("", "deps-lfs-*")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, hasher), resp.Body)
+	if err != nil {
+		removeTemp(f.Name())
+		return "", err
+	}
+
+	if hex.EncodeToString(hasher.Sum(nil)) != oid {
+		removeTemp(f.Name())
+		return "", fmt.Errorf("checksum mismatch")
+	}
+
+	return f.Name(), nil
+}
+
+// copyFileContents overwrites dst with the contents of src, keeping dst's mode
+func copyFileContents(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
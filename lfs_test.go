@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// --- parseLFSPointer tests ---
+
+func TestParseLFSPointer(t *testing.T) {
+	oid := "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+	data := "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 12345\n"
+
+	pointer, ok := parseLFSPointer([]byte(data))
+	if !ok {
+		t.Fatal("expected pointer to be detected")
+	}
+	if pointer.OID != oid {
+		t.Errorf("oid = %q, want %q", pointer.OID, oid)
+	}
+	if pointer.Size != 12345 {
+		t.Errorf("size = %d, want %d", pointer.Size, 12345)
+	}
+}
+
+func TestParseLFSPointer_NotPointer(t *testing.T) {
+	tests := []string{
+		"package main",
+		"version https://git-lfs.github.com/spec/v1\noid sha256:short\nsize 1\n",
+		"version https://git-lfs.github.com/spec/v1\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\nsize nope\n",
+	}
+	for _, data := range tests {
+		if _, ok := parseLFSPointer([]byte(data)); ok {
+			t.Errorf("parseLFSPointer(%q) detected a pointer", data)
+		}
+	}
+}
+
+// --- resolveLFSPointers tests ---
+
+func TestResolveLFSPointers(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	content := []byte("real binary content")
+	sum := sha256.Sum256(content)
+	oid := hex.EncodeToString(sum[:])
+
+	repoURL := "github.com/testowner/testrepo"
+	depPath := getDepPath(repoURL)
+	os.MkdirAll(filepath.Join(depPath, "assets"), 0755)
+	pointer := fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, len(content))
+	os.WriteFile(filepath.Join(depPath, "assets", "image.png"), []byte(pointer), 0644)
+	os.WriteFile(filepath.Join(depPath, "README.md"), []byte("# Readme"), 0644)
+
+	var srvURL string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/testowner/testrepo.git/info/lfs/objects/batch", func(w http.ResponseWriter, r *http.Request) {
+		var req lfsBatchRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Objects) != 1 || req.Objects[0].OID != oid {
+			w.WriteHeader(400)
+			return
+		}
+		fmt.Fprintf(w, `{"objects":[{"oid":"%s","size":%d,"actions":{"download":{"href":"%s/objects/%s","header":{"Authorization":"token"}}}}]}`,
+			oid, len(content), srvURL, oid)
+	})
+	mux.HandleFunc("/objects/"+oid, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token" {
+			w.WriteHeader(401)
+			return
+		}
+		w.Write(content)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	srvURL = srv.URL
+
+	origClient := httpClient
+	origBase := githubLFSBaseURL
+	httpClient = srv.Client()
+	githubLFSBaseURL = srv.URL
+	defer func() {
+		httpClient = origClient
+		githubLFSBaseURL = origBase
+	}()
+
+	err := resolveLFSPointers("testowner", "testrepo", repoURL)
+	if err != nil {
+		t.Fatalf("resolveLFSPointers error: %v", err)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(depPath, "assets", "image.png"))
+	if string(data) != string(content) {
+		t.Errorf("content = %q, want %q", string(data), string(content))
+	}
+	data, _ = os.ReadFile(filepath.Join(depPath, "README.md"))
+	if string(data) != "# Readme" {
+		t.Errorf("non-pointer file was modified: %q", string(data))
+	}
+}
+
+func TestDownloadLFSObject_ChecksumMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tampered"))
+	}))
+	defer srv.Close()
+
+	origClient := httpClient
+	httpClient = srv.Client()
+	defer func() { httpClient = origClient }()
+
+	oid := "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+	if _, err := downloadLFSObject(oid, srv.URL, nil); err == nil {
+		t.Error("expected checksum mismatch error, got nil")
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// deps licenses reports the license of every dependency. A license file in
+// the installed files is read first, as it describes exactly what was
+// installed, including the subdirectory of a repo//path dependency that
+// carries its own. Failing that, GitHub is asked which license it detects in
+// the repository at the locked commit.
+
+// Where a dependency's license was found
+const (
+	licenseFromFile   = "file"
+	licenseFromGitHub = "github"
+)
+
+// dependencyLicense is the license of one dependency, for deps licenses
+type dependencyLicense struct {
+	Repo    string `json:"repo"`
+	Ref     string `json:"ref"`
+	SHA     string `json:"sha"`
+	License string `json:"license"`          // its SPDX identifier or name, or "" if unknown
+	File    string `json:"file,omitempty"`   // the license file, as found in the dependency
+	Source  string `json:"source,omitempty"` // licenseFromFile or licenseFromGitHub
+	Error   string `json:"error,omitempty"`
+
+	err error // what Error says, for the exit code
+}
+
+// licenseFilePrefixes are how the names of license files start, lowercased
+var licenseFilePrefixes = []string{"license", "licence", "copying", "unlicense"}
+
+// licensePatterns recognize licenses by phrases their text contains, all of
+// which must appear, after lowercasing and collapsing whitespace. The first
+// match wins, so licenses whose text contains another's come first.
+var licensePatterns = []struct {
+	SPDXID  string
+	Phrases []string
+}{
+	{"AGPL-3.0", []string{"gnu affero general public license", "version 3"}},
+	{"LGPL-3.0", []string{"gnu lesser general public license", "version 3"}},
+	{"LGPL-2.1", []string{"gnu lesser general public license", "version 2.1"}},
+	{"GPL-3.0", []string{"gnu general public license", "version 3"}},
+	{"GPL-2.0", []string{"gnu general public license", "version 2"}},
+	{"Apache-2.0", []string{"apache license", "version 2.0"}},
+	{"MPL-2.0", []string{"mozilla public license", "2.0"}},
+	{"BSL-1.0", []string{"boost software license - version 1.0"}},
+	{"Unlicense", []string{"this is free and unencumbered software released into the public domain"}},
+	{"ISC", []string{"permission to use, copy, modify, and", "distribute this software for any purpose with or without fee is hereby granted"}},
+	{"MIT", []string{"permission is hereby granted, free of charge"}},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "neither the name"}},
+	{"BSD-2-Clause", []string{"redistribution and use in source and binary forms"}},
+}
+
+// collectLicenses finds the license of each dependency of lockFile, in
+// lock file order. With offline only the installed files are read. A
+// dependency whose lookup failed has its Error set.
+func collectLicenses(lockFile *LockFile, offline bool) []dependencyLicense {
+	repoURLs := sortedKeys(lockFile.Dependencies)
+	licenses := make([]dependencyLicense, len(repoURLs))
+	runJobs(resolveJobs, separateGroups(len(repoURLs)), func(i int) {
+		licenses[i] = detectLicense(repoURLs[i], lockFile.Dependencies[repoURLs[i]], offline)
+	})
+	return licenses
+}
+
+// detectLicense finds the license of the dependency dep at repoURL
+func detectLicense(repoURL string, dep Dependency, offline bool) dependencyLicense {
+	found := dependencyLicense{Repo: repoURL, Ref: dep.Ref, SHA: dep.SHA}
+	file, spdxID, err := findLicenseFile(getDepPath(repoURL))
+	if err != nil && !os.IsNotExist(err) {
+		found.Error, found.err = err.Error(), err
+		return found
+	}
+	found.File = file
+	if spdxID != "" {
+		found.License, found.Source = spdxID, licenseFromFile
+		return found
+	}
+
+	// Only GitHub detects licenses; elsewhere an unrecognized file is all
+	owner, repo, err := parseGitHubURL(repoURL)
+	if offline || err != nil {
+		return found
+	}
+	license, path, err := getRepoLicense(owner, repo, dep.SHA)
+	if err != nil {
+		found.Error, found.err = err.Error(), err
+		return found
+	}
+	if license != "" {
+		found.License, found.Source = license, licenseFromGitHub
+		if found.File == "" {
+			found.File = path
+		}
+	}
+	return found
+}
+
+// findLicenseFile looks for a license file at the top of dir, returning its
+// name and the license its text is recognized as, if any. Files that are
+// recognized win over ones that aren't, then shorter names, so LICENSE is
+// preferred to LICENSE-THIRD-PARTY.
+func findLicenseFile(dir string) (file, spdxID string, err error) {
+	dir = resolveInstallDir(dir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", err
+	}
+	var names []string
+	for _, entry := range entries {
+		name := strings.ToLower(entry.Name())
+		for _, prefix := range licenseFilePrefixes {
+			if strings.HasPrefix(name, prefix) && !entry.IsDir() {
+				names = append(names, entry.Name())
+				break
+			}
+		}
+	}
+	sort.SliceStable(names, func(i, j int) bool { return len(names[i]) < len(names[j]) })
+
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return "", "", err
+		}
+		if id := identifyLicense(string(data)); id != "" {
+			return name, id, nil
+		}
+	}
+	if len(names) > 0 {
+		return names[0], "", nil
+	}
+	return "", "", nil
+}
+
+// identifyLicense returns the SPDX identifier of the license text, or "" if
+// it isn't one of licensePatterns
+func identifyLicense(text string) string {
+	text = strings.Join(strings.Fields(strings.ToLower(text)), " ")
+	for _, pattern := range licensePatterns {
+		matches := true
+		for _, phrase := range pattern.Phrases {
+			if !strings.Contains(text, phrase) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return pattern.SPDXID
+		}
+	}
+	return ""
+}
+
+// getRepoLicense asks GitHub for the license of owner/repo at ref, returning
+// its SPDX identifier (or name, when GitHub can't tell which license it is)
+// and the path of the file it found it in. A repository without a license
+// isn't an error: both are "".
+func getRepoLicense(owner, repo, ref string) (license, path string, err error) {
+	licenseURL := fmt.Sprintf("%s/repos/%s/%s/license?ref=%s", githubAPIBaseURL, owner, repo, url.QueryEscape(ref))
+	resp, err := httpClient.Get(licenseURL)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return "", "", nil
+	}
+	if resp.StatusCode != 200 {
+		return "", "", githubAPIError(resp)
+	}
+
+	var content struct {
+		Path    string `json:"path"`
+		License struct {
+			SPDXID string `json:"spdx_id"`
+			Name   string `json:"name"`
+		} `json:"license"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&content); err != nil {
+		return "", "", err
+	}
+	license = content.License.SPDXID
+	if license == "" || license == "NOASSERTION" {
+		license = content.License.Name
+	}
+	return license, content.Path, nil
+}
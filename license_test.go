@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestIdentifyLicense(t *testing.T) {
+	tests := map[string]string{
+		"MIT License\n\nPermission is hereby granted,\nfree of charge, to any person":                    "MIT",
+		"Apache License\n  Version 2.0, January 2004":                                                    "Apache-2.0",
+		"Redistribution and use in source and binary forms ... Neither the name of the copyright holder": "BSD-3-Clause",
+		"Redistribution and use in source and binary forms, with or without modification":                "BSD-2-Clause",
+		"GNU LESSER GENERAL PUBLIC LICENSE\nVersion 3, 29 June 2007 ... GNU General Public License":      "LGPL-3.0",
+		"GNU GENERAL PUBLIC LICENSE\nVersion 2, June 1991":                                               "GPL-2.0",
+		"Copyright (c) 2024 Someone. All rights reserved.":                                               "",
+	}
+	for text, want := range tests {
+		if got := identifyLicense(text); got != want {
+			t.Errorf("identifyLicense(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestFindLicenseFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"LICENSE":             "Copyright (c) 2024 Someone",
+		"LICENSE-MIT":         "Permission is hereby granted, free of charge, to any person",
+		"LICENSES/Apache.txt": "Apache License Version 2.0",
+		"README.md":           "MIT licensed",
+	})
+	file, spdxID, err := findLicenseFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file != "LICENSE-MIT" || spdxID != "MIT" {
+		t.Errorf("findLicenseFile = %q, %q, want the recognized LICENSE-MIT", file, spdxID)
+	}
+}
+
+func TestCollectLicenses(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/user/remote/license", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ref") != "2222222222222222222222222222222222222222" {
+			t.Errorf("ref = %q, want the locked SHA", r.URL.Query().Get("ref"))
+		}
+		json.NewEncoder(w).Encode(map[string]any{"path": "COPYING", "license": map[string]string{"spdx_id": "GPL-3.0", "name": "GNU General Public License v3.0"}})
+	})
+	mux.HandleFunc("/repos/user/none/license", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	lockFile := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/user/local":  {Ref: "v1.0.0", SHA: "1111111111111111111111111111111111111111"},
+		"github.com/user/remote": {Ref: "main", SHA: "2222222222222222222222222222222222222222"},
+		"github.com/user/none":   {Ref: "main", SHA: "3333333333333333333333333333333333333333"},
+	}}
+	writeTree(t, filepath.Join(".deps", "github.com", "user", "local"), map[string]string{"LICENSE": "Apache License, Version 2.0"})
+
+	want := map[string]dependencyLicense{
+		"github.com/user/local":  {License: "Apache-2.0", File: "LICENSE", Source: licenseFromFile},
+		"github.com/user/remote": {License: "GPL-3.0", File: "COPYING", Source: licenseFromGitHub},
+		"github.com/user/none":   {},
+	}
+	for _, got := range collectLicenses(lockFile, false) {
+		w := want[got.Repo]
+		if got.License != w.License || got.File != w.File || got.Source != w.Source || got.Error != "" {
+			t.Errorf("%s: %+v, want %+v", got.Repo, got, w)
+		}
+	}
+
+	for _, got := range collectLicenses(lockFile, true) {
+		if got.Repo == "github.com/user/remote" && got.License != "" {
+			t.Errorf("offline: %+v, want no license without the API", got)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A license policy limits which licenses dependencies may have, as SPDX
+// identifiers in the allowed-licenses and denied-licenses settings, usually
+// set for the whole project. A dependency is checked as it is installed,
+// like its size budget, and one that breaks the policy fails the install,
+// which puts back the previous one, unless --soft only asks for a warning.
+// With an allow list, a dependency whose license can't be determined breaks
+// the policy too, since nothing shows it is allowed.
+
+var (
+	// allowedLicenses and deniedLicenses are the policy, set by
+	// configureLicensePolicy
+	allowedLicenses []string
+	deniedLicenses  []string
+
+	// softLicensePolicy is set by --soft: breaking the policy warns instead
+	softLicensePolicy bool
+)
+
+// spdxIDPattern is what an SPDX license identifier looks like
+var spdxIDPattern = regexp.MustCompile(`^[A-Za-z0-9.+-]+$`)
+
+// configureLicensePolicy reads the allowed-licenses and denied-licenses
+// settings (or DEPS_ALLOWED_LICENSES and DEPS_DENIED_LICENSES)
+func configureLicensePolicy() error {
+	allowedLicenses, deniedLicenses = nil, nil
+	for _, setting := range []struct {
+		name     string
+		licenses *[]string
+	}{{"allowed-licenses", &allowedLicenses}, {"denied-licenses", &deniedLicenses}} {
+		value, origin := configLookup(setting.name)
+		if value == "" {
+			continue
+		}
+		licenses, err := parseLicenseList(value)
+		if err != nil {
+			return fmt.Errorf("%v in %s", err, origin)
+		}
+		*setting.licenses = licenses
+	}
+	return nil
+}
+
+// parseLicenseList reads a comma-separated list of SPDX identifiers
+func parseLicenseList(value string) ([]string, error) {
+	var licenses []string
+	for _, license := range strings.Split(value, ",") {
+		license = strings.TrimSpace(license)
+		if !spdxIDPattern.MatchString(license) {
+			return nil, fmt.Errorf("invalid license %q (expected a comma-separated list of SPDX identifiers, like MIT,Apache-2.0)", license)
+		}
+		licenses = append(licenses, license)
+	}
+	return licenses, nil
+}
+
+func validateLicenseList(value string) error {
+	_, err := parseLicenseList(value)
+	return err
+}
+
+// licensePolicyError is a dependency whose license breaks the policy
+type licensePolicyError struct {
+	License string // "" if it couldn't be determined
+	Denied  bool   // whether it is denied, rather than not allowed
+}
+
+func (e *licensePolicyError) Error() string {
+	switch {
+	case e.License == "":
+		return "its license couldn't be determined, and allowed-licenses only allows known ones"
+	case e.Denied:
+		return fmt.Sprintf("its license %s is in denied-licenses", e.License)
+	}
+	return fmt.Sprintf("its license %s isn't in allowed-licenses", e.License)
+}
+
+// licenseAllowed checks license, an SPDX identifier or "", against the policy
+func licenseAllowed(license string) error {
+	if containsFold(deniedLicenses, license) {
+		return &licensePolicyError{License: license, Denied: true}
+	}
+	if len(allowedLicenses) > 0 && !containsFold(allowedLicenses, license) {
+		return &licensePolicyError{License: license}
+	}
+	return nil
+}
+
+// containsFold reports whether licenses has license, ignoring case
+func containsFold(licenses []string, license string) bool {
+	for _, l := range licenses {
+		if license != "" && strings.EqualFold(l, license) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLicensePolicy finds the license of the files just installed for dep
+// at repoURL, as deps licenses does, and checks it against the policy. With
+// --soft, breaking it is a warning rather than an error.
+func checkLicensePolicy(repoURL string, dep Dependency) error {
+	if len(allowedLicenses) == 0 && len(deniedLicenses) == 0 {
+		return nil
+	}
+	found := detectLicense(repoURL, dep, false)
+	err := licenseAllowed(found.License)
+	if found.err != nil {
+		err = fmt.Errorf("finding its license: %w", found.err)
+	}
+	if err != nil && softLicensePolicy {
+		warnf("%s %s: %v\n", colorize(colorYellow, "!"), repoURL, err)
+		return nil
+	}
+	return err
+}
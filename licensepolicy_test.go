@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckLicensePolicy(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	defer func() { allowedLicenses, deniedLicenses, softLicensePolicy = nil, nil, false }()
+
+	writeTree(t, filepath.Join(".deps", "github.com", "user", "mit"), map[string]string{"LICENSE": "Permission is hereby granted, free of charge, to any person"})
+	writeTree(t, filepath.Join(".deps", "github.com", "user", "gpl"), map[string]string{"COPYING": "GNU GENERAL PUBLIC LICENSE Version 3"})
+
+	if err := checkLicensePolicy("github.com/user/gpl", Dependency{}); err != nil {
+		t.Errorf("without a policy: %v", err)
+	}
+
+	t.Setenv("DEPS_DENIED_LICENSES", "gpl-3.0, AGPL-3.0")
+	if err := configureLicensePolicy(); err != nil {
+		t.Fatal(err)
+	}
+	var broken *licensePolicyError
+	if err := checkLicensePolicy("github.com/user/gpl", Dependency{}); !errors.As(err, &broken) || !broken.Denied || broken.License != "GPL-3.0" {
+		t.Errorf("denied license: err = %v", err)
+	}
+	if err := checkLicensePolicy("github.com/user/mit", Dependency{}); err != nil {
+		t.Errorf("license not denied: %v", err)
+	}
+
+	t.Setenv("DEPS_DENIED_LICENSES", "")
+	t.Setenv("DEPS_ALLOWED_LICENSES", "Apache-2.0")
+	if err := configureLicensePolicy(); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkLicensePolicy("github.com/user/mit", Dependency{}); !errors.As(err, &broken) || broken.Denied {
+		t.Errorf("license not allowed: err = %v", err)
+	}
+	if err := licenseAllowed(""); !errors.As(err, &broken) || broken.License != "" {
+		t.Errorf("unknown license with an allow list: err = %v", err)
+	}
+
+	softLicensePolicy = true
+	stdout, _ := captureOutput(t, func() {
+		if err := checkLicensePolicy("github.com/user/mit", Dependency{}); err != nil {
+			t.Errorf("with --soft: %v", err)
+		}
+	})
+	if !strings.Contains(stdout, "isn't in allowed-licenses") {
+		t.Errorf("expected a warning, got %q", stdout)
+	}
+
+	t.Setenv("DEPS_ALLOWED_LICENSES", "MIT,Apache 2")
+	if err := configureLicensePolicy(); err == nil {
+		t.Error("expected an error for an invalid identifier")
+	}
+}
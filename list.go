@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// listEntry describes one dependency for deps list. The field names are
+// what --format templates use.
+type listEntry struct {
+	Repo   string `json:"repo"`
+	Alias  string `json:"alias,omitempty"`
+	Ref    string `json:"ref"`
+	SHA    string `json:"sha"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Status string `json:"status"`
+}
+
+// Statuses of a listed dependency, decided without the network or re-hashing
+// files: whether it is installed, and if .deps.sums says it's the locked commit
+const (
+	listInstalled = "installed"
+	listMissing   = "missing"
+	listStale     = "stale"
+	listPinned    = "pinned"
+)
+
+// listDependencies describes the dependencies of lockFile, sorted by URL
+func listDependencies(lockFile *LockFile, sums map[string]depSums) ([]listEntry, error) {
+	var entries []listEntry
+	for _, repoURL := range sortedKeys(lockFile.Dependencies) {
+		dep := lockFile.Dependencies[repoURL]
+		entry := listEntry{
+			Repo:   repoURL,
+			Alias:  dep.Alias,
+			Ref:    dep.Ref,
+			SHA:    dep.SHA,
+			Path:   filepath.ToSlash(getDepPath(repoURL)),
+			Status: listInstalled,
+		}
+
+		size, err := dirSize(getDepPath(repoURL))
+		switch {
+		case os.IsNotExist(err):
+			entry.Status = listMissing
+		case err != nil:
+			return nil, fmt.Errorf("%s: %v", repoURL, err)
+		default:
+			entry.Size = size
+			if recorded, exists := sums[repoURL]; exists && recorded.SHA != dep.SHA {
+				entry.Status = listStale
+			} else if dep.frozen() {
+				entry.Status = listPinned
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// dirSize returns the total size of the files under dir
+func dirSize(dir string) (int64, error) {
+	size, _, err := treeUsage(dir)
+	return size, err
+}
+
+// treeUsage returns the total size and the number of the files under dir, or
+// under what it links to for a dependency installed from the store
+func treeUsage(dir string) (size int64, files int, err error) {
+	if _, err := os.Stat(dir); err != nil {
+		return 0, 0, err
+	}
+	dir = resolveInstallDir(dir)
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+			files++
+		}
+		return nil
+	})
+	return size, files, err
+}
+
+// formatSize renders a byte count for people, like "1.5 MB"
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, exp := float64(size)/unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "KMGT"[exp])
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListDependencies(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	defer func() { depAliases = make(map[string]string) }()
+
+	lockFile := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/user/installed": {Ref: "main", SHA: "1111111111111111111111111111111111111111"},
+		"github.com/user/missing":   {Ref: "main", SHA: "2222222222222222222222222222222222222222"},
+		"github.com/user/stale":     {Ref: "main", SHA: "3333333333333333333333333333333333333333", Alias: "stale"},
+		"github.com/user/pinned":    {Ref: "v1.0.0", SHA: "4444444444444444444444444444444444444444", Pinned: true},
+	}}
+	registerAliases(lockFile)
+	writeTree(t, filepath.Join(".deps", "github.com", "user", "installed"), map[string]string{"a.txt": "hello", "sub/b.txt": "world!"})
+	writeTree(t, filepath.Join(".deps", "stale"), map[string]string{"a.txt": "x"})
+	writeTree(t, filepath.Join(".deps", "github.com", "user", "pinned"), map[string]string{"a.txt": "x"})
+	sums := map[string]depSums{"github.com/user/stale": {SHA: "5555555555555555555555555555555555555555"}}
+
+	entries, err := listDependencies(lockFile, sums)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []listEntry{
+		{Repo: "github.com/user/installed", Ref: "main", SHA: "1111111111111111111111111111111111111111", Path: ".deps/github.com/user/installed", Size: 11, Status: listInstalled},
+		{Repo: "github.com/user/missing", Ref: "main", SHA: "2222222222222222222222222222222222222222", Path: ".deps/github.com/user/missing", Status: listMissing},
+		{Repo: "github.com/user/pinned", Ref: "v1.0.0", SHA: "4444444444444444444444444444444444444444", Path: ".deps/github.com/user/pinned", Size: 1, Status: listPinned},
+		{Repo: "github.com/user/stale", Alias: "stale", Ref: "main", SHA: "3333333333333333333333333333333333333333", Path: ".deps/stale", Size: 1, Status: listStale},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("entries = %+v", entries)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entries[%d] = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{
+		0:           "0 B",
+		1023:        "1023 B",
+		1536:        "1.5 KB",
+		5 << 20:     "5.0 MB",
+		3 << 30:     "3.0 GB",
+		int64(2e13): "18.2 TB",
+	}
+	for size, want := range tests {
+		if got := formatSize(size); got != want {
+			t.Errorf("formatSize(%d) = %q, want %q", size, got, want)
+		}
+	}
+}
+
+func TestDirSize_Missing(t *testing.T) {
+	if _, err := dirSize(filepath.Join(t.TempDir(), "nope")); !os.IsNotExist(err) {
+		t.Errorf("dirSize of a missing directory = %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// lockConflict is a dependency both sides of a merge changed incompatibly
+type lockConflict struct {
+	RepoURL string
+	Reason  string
+}
+
+// parseLockData parses JSON or TOML lock file data, telling them apart by
+// content since git merge drivers are handed temporary file names. Empty
+// data, as git passes for a missing merge base, is an empty lock file.
+func parseLockData(data []byte) (lockFile *LockFile, isTOML bool, err error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return &LockFile{Dependencies: make(map[string]Dependency)}, false, nil
+	}
+	if trimmed[0] != '{' {
+		lockFile, _, err = parseTOMLLockFile(data)
+		return lockFile, true, err
+	}
+	lockFile, _, err = parseLockFile(data)
+	return lockFile, false, err
+}
+
+// mergeLockFiles merges the dependencies of ours and theirs relative to
+// base, entry by entry. Entries changed on one side take that change; entries
+// both sides moved to different pins keep the newest (see newerPin) or are a
+// conflict, in which case ours is kept.
+func mergeLockFiles(base, ours, theirs *LockFile) (*LockFile, []lockConflict) {
+	merged := &LockFile{
+		Dependencies: make(map[string]Dependency),
+		comments:     ours.comments,
+	}
+	var conflicts []lockConflict
+
+	repoURLs := make(map[string]Dependency)
+	for _, deps := range []map[string]Dependency{base.Dependencies, ours.Dependencies, theirs.Dependencies} {
+		for repoURL, dep := range deps {
+			repoURLs[repoURL] = dep
+		}
+	}
+
+	for _, repoURL := range sortedKeys(repoURLs) {
+		baseDep, inBase := base.Dependencies[repoURL]
+		ourDep, inOurs := ours.Dependencies[repoURL]
+		theirDep, inTheirs := theirs.Dependencies[repoURL]
+		oursChanged := inOurs != inBase || !reflect.DeepEqual(ourDep, baseDep)
+		theirsChanged := inTheirs != inBase || !reflect.DeepEqual(theirDep, baseDep)
+
+		switch {
+		case !theirsChanged || (inOurs == inTheirs && reflect.DeepEqual(ourDep, theirDep)):
+			if inOurs {
+				merged.Dependencies[repoURL] = ourDep
+			}
+		case !oursChanged:
+			if inTheirs {
+				merged.Dependencies[repoURL] = theirDep
+			}
+		case !inOurs || !inTheirs:
+			reason := "removed on our side but changed on theirs"
+			if inOurs {
+				reason = "changed on our side but removed on theirs"
+				merged.Dependencies[repoURL] = ourDep
+			}
+			conflicts = append(conflicts, lockConflict{RepoURL: repoURL, Reason: reason})
+		default:
+			dep, ok := newerPin(ourDep, theirDep)
+			if !ok {
+				conflicts = append(conflicts, lockConflict{
+					RepoURL: repoURL,
+					Reason:  fmt.Sprintf("ours is %s (%s), theirs is %s (%s)", ourDep.Ref, abbreviate(ourDep.SHA), theirDep.Ref, abbreviate(theirDep.SHA)),
+				})
+				dep = ourDep
+			}
+			merged.Dependencies[repoURL] = dep
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, lockFile := range []*LockFile{base, ours, theirs} {
+		for name := range lockFile.Profiles {
+			names[name] = true
+		}
+	}
+	for name := range names {
+		overrides, profileConflicts := mergeOverrides(base.Profiles[name], ours.Profiles[name], theirs.Profiles[name])
+		for _, conflict := range profileConflicts {
+			conflict.RepoURL = fmt.Sprintf("%s (profile %s)", conflict.RepoURL, name)
+			conflicts = append(conflicts, conflict)
+		}
+		if len(overrides) > 0 {
+			if merged.Profiles == nil {
+				merged.Profiles = make(map[string]map[string]ProfileOverride)
+			}
+			merged.Profiles[name] = overrides
+		}
+	}
+
+	tasks, taskConflicts := mergeTasks(base.Tasks, ours.Tasks, theirs.Tasks)
+	conflicts = append(conflicts, taskConflicts...)
+	if len(tasks) > 0 {
+		merged.Tasks = tasks
+	}
+
+	// The strategy and overrides are chosen like profile overrides; what was
+	// resolved describes our installed copies, so it follows ours
+	merged.Resolution = ours.Resolution
+	if !reflect.DeepEqual(resolutionSettings(theirs), resolutionSettings(base)) && !reflect.DeepEqual(resolutionSettings(theirs), resolutionSettings(ours)) {
+		if reflect.DeepEqual(resolutionSettings(ours), resolutionSettings(base)) {
+			merged.Resolution = resolutionSettings(theirs)
+			if merged.Resolution != nil && ours.Resolution != nil {
+				merged.Resolution.Resolved = ours.Resolution.Resolved
+			}
+		} else {
+			conflicts = append(conflicts, lockConflict{RepoURL: "resolution", Reason: "both sides changed the submodule resolution"})
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].RepoURL < conflicts[j].RepoURL })
+	return merged, conflicts
+}
+
+// mergeTasks merges the tasks of a lock file, where like overrides two
+// different changes to one task conflict
+func mergeTasks(base, ours, theirs map[string]string) (map[string]string, []lockConflict) {
+	merged := make(map[string]string)
+	var conflicts []lockConflict
+	names := make(map[string]bool)
+	for _, tasks := range []map[string]string{base, ours, theirs} {
+		for name := range tasks {
+			names[name] = true
+		}
+	}
+
+	for name := range names {
+		baseTask, inBase := base[name]
+		ourTask, inOurs := ours[name]
+		theirTask, inTheirs := theirs[name]
+		oursChanged := inOurs != inBase || ourTask != baseTask
+		theirsChanged := inTheirs != inBase || theirTask != baseTask
+
+		switch {
+		case !theirsChanged || (inOurs == inTheirs && ourTask == theirTask):
+			if inOurs {
+				merged[name] = ourTask
+			}
+		case !oursChanged:
+			if inTheirs {
+				merged[name] = theirTask
+			}
+		default:
+			if inOurs {
+				merged[name] = ourTask
+			}
+			conflicts = append(conflicts, lockConflict{RepoURL: "task " + name, Reason: "the task changed differently on both sides"})
+		}
+	}
+	return merged, conflicts
+}
+
+// resolutionSettings returns the parts of a lock file's resolution people
+// choose, leaving out what deps recorded
+func resolutionSettings(lockFile *LockFile) *Resolution {
+	if lockFile.Resolution == nil {
+		return nil
+	}
+	settings := *lockFile.Resolution
+	settings.Resolved = nil
+	if settings.Strategy == "" && len(settings.Overrides) == 0 {
+		return nil
+	}
+	return &settings
+}
+
+// mergeOverrides merges the overrides of one profile. Overrides are chosen
+// deliberately, so unlike dependencies, two different changes always conflict.
+func mergeOverrides(base, ours, theirs map[string]ProfileOverride) (map[string]ProfileOverride, []lockConflict) {
+	merged := make(map[string]ProfileOverride)
+	var conflicts []lockConflict
+	keys := make(map[string]bool)
+	for _, overrides := range []map[string]ProfileOverride{base, ours, theirs} {
+		for key := range overrides {
+			keys[key] = true
+		}
+	}
+
+	for key := range keys {
+		baseOverride, inBase := base[key]
+		ourOverride, inOurs := ours[key]
+		theirOverride, inTheirs := theirs[key]
+		oursChanged := inOurs != inBase || !reflect.DeepEqual(ourOverride, baseOverride)
+		theirsChanged := inTheirs != inBase || !reflect.DeepEqual(theirOverride, baseOverride)
+
+		switch {
+		case !theirsChanged || (inOurs == inTheirs && reflect.DeepEqual(ourOverride, theirOverride)):
+			if inOurs {
+				merged[key] = ourOverride
+			}
+		case !oursChanged:
+			if inTheirs {
+				merged[key] = theirOverride
+			}
+		default:
+			if inOurs {
+				merged[key] = ourOverride
+			}
+			conflicts = append(conflicts, lockConflict{RepoURL: key, Reason: "the override changed differently on both sides"})
+		}
+	}
+	return merged, conflicts
+}
+
+// newerPin picks between two entries for the same dependency that both sides
+// of a merge changed. Entries for the same commit with the same settings only
+// differ in metadata, so the more recently resolved one wins. Otherwise the
+// entries must differ only in where they are pinned: the higher version wins
+// for tags, and the more recent resolution for anything else.
+func newerPin(ours, theirs Dependency) (Dependency, bool) {
+	settings := func(dep Dependency) Dependency {
+		return Dependency{
+			Transport:   dep.Transport,
+			Submodules:  dep.Submodules,
+			LFS:         dep.LFS,
+			Constraint:  dep.Constraint,
+			Pre:         dep.Pre,
+			TagPrefix:   dep.TagPrefix,
+			Pinned:      dep.Pinned,
+			Policy:      dep.Policy,
+			Strip:       dep.Strip,
+			Rename:      dep.Rename,
+			Only:        dep.Only,
+			Exclude:     dep.Exclude,
+			MaxSize:     dep.MaxSize,
+			PostInstall: dep.PostInstall,
+			Alias:       dep.Alias,
+		}
+	}
+	if !reflect.DeepEqual(settings(ours), settings(theirs)) {
+		return Dependency{}, false
+	}
+
+	if ours.SHA != theirs.SHA {
+		ourVersion, ourOK := parseSemver(strings.TrimPrefix(ours.Ref, ours.TagPrefix))
+		theirVersion, theirOK := parseSemver(strings.TrimPrefix(theirs.Ref, theirs.TagPrefix))
+		if ourOK && theirOK {
+			switch compareSemver(ourVersion, theirVersion) {
+			case 1:
+				return ours, true
+			case -1:
+				return theirs, true
+			}
+			return Dependency{}, false
+		}
+	}
+
+	ourTime, ourOK := resolvedTime(ours)
+	theirTime, theirOK := resolvedTime(theirs)
+	switch {
+	case !ourOK || !theirOK:
+		if ours.SHA == theirs.SHA && ours.Ref == theirs.Ref {
+			return ours, true
+		}
+		return Dependency{}, false
+	case theirTime.After(ourTime):
+		return theirs, true
+	}
+	return ours, true
+}
+
+// resolvedTime returns when a lock entry was resolved, if it says
+func resolvedTime(dep Dependency) (time.Time, bool) {
+	if dep.Metadata == nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, dep.Metadata.ResolvedAt)
+	return t, err == nil
+}
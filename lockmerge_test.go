@@ -0,0 +1,128 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeLockFiles(t *testing.T) {
+	dep := func(ref, sha string) Dependency {
+		return Dependency{Ref: ref, SHA: sha}
+	}
+	base := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/user/unchanged":    dep("main", "1111111111111111111111111111111111111111"),
+		"github.com/user/ours-changed": dep("main", "1111111111111111111111111111111111111111"),
+		"github.com/user/theirs-gone":  dep("main", "1111111111111111111111111111111111111111"),
+		"github.com/user/both-tags":    dep("v1.0.0", "1111111111111111111111111111111111111111"),
+		"github.com/user/both-branch":  dep("main", "1111111111111111111111111111111111111111"),
+		"github.com/user/edit-delete":  dep("main", "1111111111111111111111111111111111111111"),
+	}}
+	ours := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/user/unchanged":    dep("main", "1111111111111111111111111111111111111111"),
+		"github.com/user/ours-changed": dep("main", "2222222222222222222222222222222222222222"),
+		"github.com/user/theirs-gone":  dep("main", "1111111111111111111111111111111111111111"),
+		"github.com/user/both-tags":    dep("v1.2.0", "2222222222222222222222222222222222222222"),
+		"github.com/user/both-branch":  dep("main", "2222222222222222222222222222222222222222"),
+		"github.com/user/edit-delete":  dep("main", "2222222222222222222222222222222222222222"),
+		"github.com/user/ours-new":     dep("main", "1111111111111111111111111111111111111111"),
+	}}
+	theirs := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/user/unchanged":    dep("main", "1111111111111111111111111111111111111111"),
+		"github.com/user/ours-changed": dep("main", "1111111111111111111111111111111111111111"),
+		"github.com/user/both-tags":    dep("v1.1.0", "3333333333333333333333333333333333333333"),
+		"github.com/user/both-branch":  dep("main", "3333333333333333333333333333333333333333"),
+		"github.com/user/theirs-new":   dep("main", "3333333333333333333333333333333333333333"),
+	}}
+
+	merged, conflicts := mergeLockFiles(base, ours, theirs)
+
+	want := map[string]Dependency{
+		"github.com/user/unchanged":    dep("main", "1111111111111111111111111111111111111111"),
+		"github.com/user/ours-changed": dep("main", "2222222222222222222222222222222222222222"),
+		"github.com/user/both-tags":    dep("v1.2.0", "2222222222222222222222222222222222222222"),
+		"github.com/user/both-branch":  dep("main", "2222222222222222222222222222222222222222"),
+		"github.com/user/edit-delete":  dep("main", "2222222222222222222222222222222222222222"),
+		"github.com/user/ours-new":     dep("main", "1111111111111111111111111111111111111111"),
+		"github.com/user/theirs-new":   dep("main", "3333333333333333333333333333333333333333"),
+	}
+	if !reflect.DeepEqual(merged.Dependencies, want) {
+		t.Errorf("merged = %+v\nwant %+v", merged.Dependencies, want)
+	}
+
+	wantConflicts := []lockConflict{
+		{RepoURL: "github.com/user/both-branch", Reason: "ours is main (222222222222), theirs is main (333333333333)"},
+		{RepoURL: "github.com/user/edit-delete", Reason: "changed on our side but removed on theirs"},
+	}
+	if !reflect.DeepEqual(conflicts, wantConflicts) {
+		t.Errorf("conflicts = %+v, want %+v", conflicts, wantConflicts)
+	}
+}
+
+func TestMergeTasks(t *testing.T) {
+	base := map[string]string{"build": "make", "test": "make test", "lint": "vet"}
+	ours := map[string]string{"build": "make all", "test": "make test", "lint": "vet ./..."}
+	theirs := map[string]string{"build": "make", "test": "go test", "lint": "golint", "docs": "mkdocs"}
+
+	merged, conflicts := mergeTasks(base, ours, theirs)
+	want := map[string]string{"build": "make all", "test": "go test", "lint": "vet ./...", "docs": "mkdocs"}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("merged = %v, want %v", merged, want)
+	}
+	if len(conflicts) != 1 || conflicts[0].RepoURL != "task lint" {
+		t.Errorf("conflicts = %+v, want the lint task", conflicts)
+	}
+}
+
+func TestNewerPin(t *testing.T) {
+	at := func(ref, sha, resolvedAt string) Dependency {
+		return Dependency{Ref: ref, SHA: sha, Metadata: &DependencyMetadata{ResolvedAt: resolvedAt}}
+	}
+	older := at("main", "1111111111111111111111111111111111111111", "2026-01-01T00:00:00Z")
+	newer := at("main", "2222222222222222222222222222222222222222", "2026-02-01T00:00:00Z")
+
+	tests := []struct {
+		name         string
+		ours, theirs Dependency
+		want         Dependency
+		wantConflict bool
+	}{
+		{"newer resolution wins", older, newer, newer, false},
+		{"newer resolution wins either way", newer, older, newer, false},
+		{"higher tag wins", at("v2.0.0", "2222222222222222222222222222222222222222", "2026-01-01T00:00:00Z"), at("v1.9.0", "1111111111111111111111111111111111111111", "2026-02-01T00:00:00Z"), at("v2.0.0", "2222222222222222222222222222222222222222", "2026-01-01T00:00:00Z"), false},
+		{"same tag at different commits", Dependency{Ref: "v1.0.0", SHA: "1111111111111111111111111111111111111111"}, Dependency{Ref: "v1.0.0", SHA: "2222222222222222222222222222222222222222"}, Dependency{}, true},
+		{"same commit, metadata only", Dependency{Ref: "main", SHA: "1111111111111111111111111111111111111111"}, Dependency{Ref: "main", SHA: "1111111111111111111111111111111111111111", Metadata: &DependencyMetadata{License: "MIT"}}, Dependency{Ref: "main", SHA: "1111111111111111111111111111111111111111"}, false},
+		{"different settings", Dependency{Ref: "main", SHA: "1111111111111111111111111111111111111111", Pinned: true}, newer, Dependency{}, true},
+		{"different post-install hooks", Dependency{Ref: "main", SHA: "1111111111111111111111111111111111111111", PostInstall: "make"}, Dependency{Ref: "main", SHA: "1111111111111111111111111111111111111111", PostInstall: "make install"}, Dependency{}, true},
+		{"post-install hook changed with the pin", older, Dependency{Ref: "main", SHA: newer.SHA, PostInstall: "make", Metadata: newer.Metadata}, Dependency{}, true},
+		{"different aliases", Dependency{Ref: "main", SHA: "1111111111111111111111111111111111111111", Alias: "lib"}, Dependency{Ref: "main", SHA: "1111111111111111111111111111111111111111", Alias: "mylib", Metadata: newer.Metadata}, Dependency{}, true},
+		{"alias changed with the pin", older, Dependency{Ref: "main", SHA: newer.SHA, Alias: "lib", Metadata: newer.Metadata}, Dependency{}, true},
+		{"no resolution times", Dependency{Ref: "main", SHA: "1111111111111111111111111111111111111111"}, Dependency{Ref: "main", SHA: "2222222222222222222222222222222222222222"}, Dependency{}, true},
+	}
+	for _, tt := range tests {
+		got, ok := newerPin(tt.ours, tt.theirs)
+		if ok == tt.wantConflict {
+			t.Errorf("%s: ok = %v", tt.name, ok)
+			continue
+		}
+		if ok && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseLockData(t *testing.T) {
+	lockFile, isTOML, err := parseLockData(nil)
+	if err != nil || isTOML || len(lockFile.Dependencies) != 0 {
+		t.Errorf("empty data = %+v, %v, %v", lockFile, isTOML, err)
+	}
+
+	lockFile, isTOML, err = parseLockData([]byte(testTOMLLock))
+	if err != nil || !isTOML || len(lockFile.Dependencies) != 2 {
+		t.Errorf("TOML data = %+v, %v, %v", lockFile, isTOML, err)
+	}
+
+	lockFile, isTOML, err = parseLockData([]byte(`{"dependencies": {"github.com/user/repo": {"ref": "main", "sha": "1111111111111111111111111111111111111111"}}}`))
+	if err != nil || isTOML || len(lockFile.Dependencies) != 1 {
+		t.Errorf("JSON data = %+v, %v, %v", lockFile, isTOML, err)
+	}
+}
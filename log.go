@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// logLevel is how much deps reports while it works
+type logLevel int
+
+// Levels, from quietest. Errors are always shown.
+const (
+	levelError logLevel = iota
+	levelInfo
+	levelDebug
+)
+
+// currentLogLevel is set by -q/--quiet and -v/--verbose
+var currentLogLevel = levelInfo
+
+// configureLogging sets the log level: quiet (-q or the quiet setting) shows
+// only errors, verbose (-v or the verbose setting) adds HTTP requests and
+// extraction details. Asking for both is an error. With json (--json), stdout
+// is kept for the JSON report and everything is logged to stderr.
+func configureLogging(quiet, verbose, json bool) error {
+	jsonOutput = json
+	quiet = quiet || configBool("quiet")
+	verbose = verbose || configBool("verbose")
+	switch {
+	case quiet && verbose:
+		return fmt.Errorf("--quiet and --verbose can't be used together")
+	case quiet:
+		currentLogLevel = levelError
+	case verbose:
+		currentLogLevel = levelDebug
+	default:
+		currentLogLevel = levelInfo
+	}
+	return nil
+}
+
+// logOutput is where errors, warnings and progress are printed
+func logOutput() *os.File {
+	if jsonOutput {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// errorf reports a failure. It is shown at every level.
+func errorf(format string, args ...any) {
+	clearProgress()
+	fmt.Fprintf(logOutput(), format, args...)
+}
+
+// warnf reports something the user should know about but that didn't stop
+// the command. Like infof, it is hidden by --quiet.
+func warnf(format string, args ...any) {
+	if currentLogLevel >= levelInfo {
+		clearProgress()
+		fmt.Fprintf(logOutput(), format, args...)
+	}
+}
+
+// infof reports progress and results
+func infof(format string, args ...any) {
+	if currentLogLevel >= levelInfo {
+		clearProgress()
+		fmt.Fprintf(logOutput(), format, args...)
+	}
+}
+
+// debugf reports details for --verbose. They go to stderr so they never mix
+// with output meant for other programs.
+func debugf(format string, args ...any) {
+	if currentLogLevel >= levelDebug {
+		fmt.Fprintf(os.Stderr, format, args...)
+	}
+}
+
+// loggingTransport logs every request httpClient makes at the debug level
+type loggingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		debugf("%s %s: %v (%s)\n", req.Method, req.URL.Redacted(), err, elapsed)
+		return resp, err
+	}
+	debugf("%s %s: %s (%s)\n", req.Method, req.URL.Redacted(), resp.Status, elapsed)
+	return resp, nil
+}
+
+// configureLoggingTransport wraps httpClient so requests are logged with
+// -v. It runs first, so each retry is logged with the URL it went to after
+// mirroring, and answers from the HTTP cache aren't logged at all.
+func configureLoggingTransport() {
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client := *httpClient
+	client.Transport = &loggingTransport{base: base}
+	httpClient = &client
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// captureOutput returns what fn writes to stdout and stderr
+func captureOutput(t *testing.T, fn func()) (stdout, stderr string) {
+	t.Helper()
+	capture := func(file **os.File) func() string {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		original := *file
+		*file = w
+		return func() string {
+			w.Close()
+			*file = original
+			data, _ := io.ReadAll(r)
+			return string(data)
+		}
+	}
+	restoreStdout := capture(&os.Stdout)
+	restoreStderr := capture(&os.Stderr)
+	fn()
+	return restoreStdout(), restoreStderr()
+}
+
+func TestConfigureLogging(t *testing.T) {
+	defer func() { currentLogLevel = levelInfo }()
+	t.Setenv("DEPS_QUIET", "")
+	t.Setenv("DEPS_VERBOSE", "")
+
+	tests := []struct {
+		name           string
+		quiet, verbose bool
+		env            string
+		want           logLevel
+	}{
+		{"default", false, false, "", levelInfo},
+		{"quiet", true, false, "", levelError},
+		{"verbose", false, true, "", levelDebug},
+		{"verbose from the environment", false, false, "DEPS_VERBOSE", levelDebug},
+		{"quiet from the environment", false, false, "DEPS_QUIET", levelError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv(tt.env, "1")
+			}
+			if err := configureLogging(tt.quiet, tt.verbose, false); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if currentLogLevel != tt.want {
+				t.Errorf("level = %d, want %d", currentLogLevel, tt.want)
+			}
+		})
+	}
+
+	if err := configureLogging(true, true, false); err == nil {
+		t.Error("expected an error for --quiet with --verbose")
+	}
+}
+
+func TestLogLevels(t *testing.T) {
+	defer func() { currentLogLevel = levelInfo }()
+	logAll := func() {
+		errorf("error\n")
+		warnf("warning\n")
+		infof("info\n")
+		debugf("debug\n")
+	}
+
+	tests := []struct {
+		level      logLevel
+		wantStdout string
+		wantStderr string
+	}{
+		{levelError, "error\n", ""},
+		{levelInfo, "error\nwarning\ninfo\n", ""},
+		{levelDebug, "error\nwarning\ninfo\n", "debug\n"},
+	}
+	for _, tt := range tests {
+		currentLogLevel = tt.level
+		stdout, stderr := captureOutput(t, logAll)
+		if stdout != tt.wantStdout {
+			t.Errorf("level %d: stdout = %q, want %q", tt.level, stdout, tt.wantStdout)
+		}
+		if stderr != tt.wantStderr {
+			t.Errorf("level %d: stderr = %q, want %q", tt.level, stderr, tt.wantStderr)
+		}
+	}
+}
+
+func TestExtractGlobalFlags_QuietVerbose(t *testing.T) {
+	tests := []struct {
+		name                   string
+		args                   []string
+		wantRest               []string
+		wantQuiet, wantVerbose bool
+	}{
+		{"short quiet", []string{"-q", "install"}, []string{"install"}, true, false},
+		{"short verbose", []string{"-v", "install"}, []string{"install"}, false, true},
+		{"long forms", []string{"install", "--quiet"}, []string{"install"}, true, false},
+		{"lone -v is the version", []string{"-v"}, []string{"-v"}, false, false},
+		{"short forms after the command are kept", []string{"exec", "ls", "-v"}, []string{"exec", "ls", "-v"}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetGlobalOptions(t)
+
+			rest, err := extractGlobalFlags(tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(rest, tt.wantRest) {
+				t.Errorf("rest = %q, want %q", rest, tt.wantRest)
+			}
+			if globalOptions.Quiet != tt.wantQuiet || globalOptions.Verbose != tt.wantVerbose {
+				t.Errorf("quiet, verbose = %v, %v, want %v, %v", globalOptions.Quiet, globalOptions.Verbose, tt.wantQuiet, tt.wantVerbose)
+			}
+		})
+	}
+}
+
+func TestLoggingTransport(t *testing.T) {
+	defer func() { currentLogLevel = levelInfo }()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	restore := testGitHubServer(t, mux)
+	defer restore()
+	configureLoggingTransport()
+
+	currentLogLevel = levelDebug
+	_, stderr := captureOutput(t, func() {
+		resp, err := httpClient.Get(githubAPIBaseURL + "/repos/testowner/testrepo")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+	})
+	if !strings.Contains(stderr, "GET "+githubAPIBaseURL+"/repos/testowner/testrepo: 404 Not Found") {
+		t.Errorf("stderr = %q, want the request logged", stderr)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// installRoot returns the directory dependencies are installed under, which
+// on Windows is made absolute to allow long paths
+func installRoot(dir string) string {
+	return dir
+}
@@ -0,0 +1,13 @@
+package main
+
+import "path/filepath"
+
+// installRoot returns dir as an absolute path. The os package gives paths
+// longer than Windows's 260 characters the \\?\ prefix that lifts the limit,
+// but only if they are absolute, and dependencies nest deep enough to need it.
+func installRoot(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		return abs
+	}
+	return dir
+}
@@ -1,259 +1,3329 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
 )
 
 var version = "dev" // Set by build flags
 
+// globalOptions holds flags accepted by every command
+var globalOptions options
+
+type options struct {
+	CABundle           string
+	InsecureSkipVerify bool
+	Mirrors            []string
+	Resolver           string
+	WaitOnRateLimit    bool
+	Retries            int // -1 when not given
+	Timeout            time.Duration
+	RequestTimeout     time.Duration
+	MaxRate            string
+	Jobs               int // 0 when not given
+	LockFile           string
+	AllowHooks         bool
+	NoDedup            bool
+	Profile            string
+	Quiet              bool
+	Verbose            bool
+	JSON               bool
+	Color              string
+	DryRun             bool
+}
+
 func main() {
-	if len(os.Args) < 2 {
+	globalOptions.Retries = -1
+	args, err := extractGlobalFlags(os.Args[1:])
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(args) < 1 {
+		showUsage()
+		os.Exit(1)
+	}
+
+	err = loadConfig()
+	if err != nil {
+		errorf("Error reading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = configureLogging(globalOptions.Quiet, globalOptions.Verbose, globalOptions.JSON)
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = configureColor(globalOptions.Color)
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	stop := configureContext(globalOptions.Timeout)
+	defer stop()
+
+	if globalOptions.RequestTimeout > 0 {
+		requestTimeout = globalOptions.RequestTimeout
+	}
+	err = configureHTTPClient(globalOptions.CABundle, globalOptions.InsecureSkipVerify)
+	if err != nil {
+		errorf("Error configuring HTTP client: %v\n", err)
+		os.Exit(1)
+	}
+	configureLoggingTransport()
+
+	err = configureMaxRate(globalOptions.MaxRate)
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = configureRetries(globalOptions.Retries)
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	configureHTTPCache()
+	configureGitHubAuth(globalOptions.WaitOnRateLimit)
+
+	err = configureMirrors(globalOptions.Mirrors)
+	if err != nil {
+		errorf("Error configuring mirrors: %v\n", err)
+		os.Exit(1)
+	}
+
+	configureContextTransport()
+
+	err = configureResolver(globalOptions.Resolver)
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	configureLockFile(globalOptions.LockFile)
+	err = configureDepsDir()
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	err = configureLayout()
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	err = configureDownloadCache()
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	configurePreserveMtime()
+	configureStore()
+	configureHooks(globalOptions.AllowHooks)
+	configureDedup(globalOptions.NoDedup)
+	configureProfile(globalOptions.Profile)
+	err = configureJobs(globalOptions.Jobs)
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	err = configureSizeBudget()
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	err = configureLicensePolicy()
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	command := args[0]
+	err = configureDryRun(globalOptions.DryRun, command)
+	if err == nil {
+		err = configureJSONOutput(command)
+	}
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	switch command {
+	case "version", "--version", "-v":
+		fmt.Printf("deps %s\n", version)
+		return
+	case "help", "--help", "-h":
+		showUsage()
+		return
+	case "init":
+		handleInit(args[1:])
+	case "get":
+		handleGet(args[1:])
+	case "check":
+		handleCheck(args[1:])
+	case "list":
+		handleList(args[1:])
+	case "status":
+		handleStatus(args[1:])
+	case "stats":
+		handleStats(args[1:])
+	case "licenses":
+		handleLicenses(args[1:])
+	case "sbom":
+		handleSBOM(args[1:])
+	case "mode":
+		handleMode(args[1:])
+	case "prune":
+		handlePrune(args[1:])
+	case "sync":
+		handleSync(args[1:])
+	case "tree":
+		handleTree(args[1:])
+	case "why":
+		handleWhy(args[1:])
+	case "conflicts":
+		handleConflicts(args[1:])
+	case "graph":
+		handleGraph(args[1:])
+	case "doctor":
+		handleDoctor(args[1:])
+	case "self-update":
+		handleSelfUpdate(args[1:])
+	case "config":
+		handleConfig(args[1:])
+	case "cache":
+		handleCache(args[1:])
+	case "exec":
+		handleExec(args[1:])
+	case "env":
+		handleEnv(args[1:])
+	case "run":
+		handleRun(args[1:])
+	case "install":
+		handleInstall(args[1:])
+	case "update":
+		handleUpdate(args[1:])
+	case "resolve":
+		handleResolve(args[1:])
+	case "tags":
+		handleTags(args[1:])
+	case "info":
+		handleInfo(args[1:])
+	case "search":
+		handleSearch(args[1:])
+	case "pin":
+		handlePin(args[1:], true)
+	case "unpin":
+		handlePin(args[1:], false)
+	case "policy":
+		handlePolicy(args[1:])
+	case "remove":
+		handleRemove(args[1:])
+	case "alias":
+		handleAlias(args[1:])
+	case "migrate":
+		handleMigrate(args[1:])
+	case "audit":
+		handleAudit(args[1:])
+	case "verify":
+		handleVerify(args[1:])
+	case "validate":
+		handleValidate(args[1:])
+	case "fmt":
+		handleFmt(args[1:])
+	case "lock-merge":
+		handleLockMerge(args[1:])
+	case "completion":
+		handleCompletion(args[1:])
+	default:
+		fmt.Printf("Unknown command: %s\n", command)
 		showUsage()
 		os.Exit(1)
 	}
+}
+
+func showUsage() {
+	fmt.Printf("deps %s - Language agnostic dependency manager\n\n", version)
+	fmt.Println("Usage:")
+	fmt.Println("  deps init [--toml]                    Create .deps.lock (or .deps.toml), adopting anything already in .deps")
+	fmt.Println("  deps get github.com/user/repo[@ref]   Add a dependency")
+	fmt.Println("  deps check                            Check dependency status")
+	fmt.Println("  deps list [--json | --format <tmpl>]  List dependencies with their install path, size and status")
+	fmt.Println("  deps status [--offline]               Summarize what's installed, missing, dirty and outdated")
+	fmt.Println("  deps stats                            Show disk usage per dependency, largest first, and of .deps and the cache")
+	fmt.Println("  deps licenses [--offline]             List the license of each dependency")
+	fmt.Println("  deps sbom [--format <f>]              Print an SBOM of the dependencies (spdx or cyclonedx)")
+	fmt.Println("  deps tree                             Show the dependencies and the submodules they pull in")
+	fmt.Println("  deps why github.com/user/repo         Show which dependencies pull a repository in")
+	fmt.Println("  deps conflicts [--strategy <name>]    Show submodules pinned at different commits and how they resolve")
+	fmt.Println("  deps graph [--format <format>]        Export the dependency graph as DOT, Mermaid or JSON")
+	fmt.Println("  deps doctor                           Diagnose tokens, rate limits, proxies, the lock file and .deps")
+	fmt.Println("  deps exec -- <command> [args...]      Run a command with DEPS_* variables set to dependency paths")
+	fmt.Println("  deps env [--shell <shell>]            Print exports of the DEPS_* variables, for eval")
+	fmt.Println("  deps run [task]                       Run a task from the lock file, or list them")
+	fmt.Println("  deps install                          Install missing dependencies")
+	fmt.Println("  deps update [github.com/user/repo]    Update dependencies")
+	fmt.Println("  deps verify [github.com/user/repo]    Check installed files against their recorded checksums")
+	fmt.Println("  deps audit [github.com/user/repo]     Check locked commits for known vulnerabilities (OSV)")
+	fmt.Println("  deps resolve github.com/user/repo@ref Show what a ref resolves to, without downloading")
+	fmt.Println("  deps tags github.com/user/repo        List tags (or --branches) to choose a ref from")
+	fmt.Println("  deps info github.com/user/repo        Show repository details and what's locked")
+	fmt.Println("  deps search <query>                   Search GitHub for repositories")
+	fmt.Println("  deps pin github.com/user/repo         Freeze a dependency at its locked SHA")
+	fmt.Println("  deps unpin github.com/user/repo       Let updates move a pinned dependency again")
+	fmt.Println("  deps policy github.com/user/repo <p>  Set the update policy (frozen, follow-branch, semver-range, auto)")
+	fmt.Println("  deps remove github.com/user/repo      Remove a dependency and its installed files")
+	fmt.Println("  deps sync                             Install, reinstall and prune until .deps matches the lock file")
+	fmt.Println("  deps prune [--dry-run]                Remove anything in .deps the lock file doesn't reference")
+	fmt.Println("  deps alias github.com/user/repo <a>   Name a dependency <a>, installed in .deps/<a> (no name removes it)")
+	fmt.Println("  deps validate [file]                  Check .deps.lock for malformed or unknown entries")
+	fmt.Println("  deps fmt [--check] [file]             Rewrite the lock file in canonical form")
+	fmt.Println("  deps migrate [--toml | --json]        Upgrade the lock file to the current format, or convert it")
+	fmt.Println("  deps lock-merge base ours theirs      Merge lock files entry by entry (a git merge driver)")
+	fmt.Println("  deps mode [ignored | vendored]        Show or set whether .deps is kept out of git or committed")
+	fmt.Println("  deps completion <shell>               Print completions for bash, zsh, fish or powershell")
+	fmt.Println("  deps config [get <name>]              Show settings from DEPS_* variables and config files")
+	fmt.Println("  deps config set [--project] <n> <v>   Save a setting, such as host, token-file or color")
+	fmt.Println("  deps config unset [--project] <name>  Remove a saved setting")
+	fmt.Println("  deps cache info                       Show what the download cache holds and which projects use it")
+	fmt.Println("  deps cache gc [--max-age <d>]         Remove cache entries no project locks (also --max-size <size>)")
+	fmt.Println("  deps self-update [--force]            Replace this binary with the latest release")
+	fmt.Println("  deps version                          Show version")
+	fmt.Println("  deps help                             Show this help")
+	fmt.Println()
+	fmt.Println("Get options:")
+	fmt.Println("  --ssh                                 Fetch over git+SSH instead of HTTPS")
+	fmt.Println("  --submodules                          Download git submodules at their pinned SHAs")
+	fmt.Println("  --lfs                                 Replace Git LFS pointer files with their content")
+	fmt.Println("  --pre                                 Allow pre-release tags for constraints and @latest")
+	fmt.Println("  --tag-prefix <prefix>                 Only resolve versions from tags like <prefix>v1.2.3")
+	fmt.Println("  --no-prompt                           Pin the default branch without offering a ref picker")
+	fmt.Println("  --policy <policy>                     Declare how updates may move it (frozen, follow-branch, semver-range)")
+	fmt.Println("  --as <alias>                          Name it <alias> in commands and install it in .deps/<alias>")
+	fmt.Println("  --add                                 With --as, add another entry for a repo that's already locked")
+	fmt.Println("  --post-install <command>              Run <command> in the dependency's directory after each download")
+	fmt.Println("  --strip <n>                           Remove <n> more leading directories from every file")
+	fmt.Println("  --rename <from>=<to>                  Move a file or directory on extraction (repeatable; <to> . for the root)")
+	fmt.Println("  --replace <dep>                       With --profile, lock the repository in place of <dep>, e.g. a fork")
+	fmt.Println("  --only <glob>, --exclude <glob>       Keep only, or remove, matching files (repeatable, e.g. 'src/**')")
+	fmt.Println("  --max-size <size>                     Fail installs whose files add up to more than <size>, e.g. 500M")
+	fmt.Println("  --soft                                Only warn if its license breaks allowed-licenses or denied-licenses")
+	fmt.Println("  --url                                 Lock the archive at a URL, pinned by its hash, instead of a repository")
+	fmt.Println()
+	fmt.Println("Check options:")
+	fmt.Println("  --dirty                               Also flag dependencies whose installed files were edited")
+	fmt.Println()
+	fmt.Println("Install options:")
+	fmt.Println("  --frozen                              Fail unless .deps.lock pins and verifies every dependency (for CI)")
+	fmt.Println("  --soft                                Only warn about licenses that break the license policy")
+	fmt.Println()
+	fmt.Println("Update options:")
+	fmt.Println("  --follow-renames                      Rewrite renamed repos to their new location without asking")
+	fmt.Println("  --patch, --minor, --major             Move tag-pinned dependencies to newer tags within that range")
+	fmt.Println("  --dry-run                             Report available updates without downloading or changing .deps.lock")
+	fmt.Println("  --interactive                         Choose which of the available updates to apply")
+	fmt.Println()
+	fmt.Println("Global options:")
+	fmt.Println("  --ca-bundle <file>                    Trust the CA certificates in <file> (or DEPS_CA_BUNDLE)")
+	fmt.Println("  --insecure-skip-verify                Skip TLS certificate verification (or DEPS_INSECURE_SKIP_VERIFY=1)")
+	fmt.Println("  --mirror <from>=<to>                  Fetch from a mirror instead of a host (or DEPS_MIRRORS)")
+	fmt.Println("  --wait-on-rate-limit                  Wait for the GitHub API rate limit to reset and retry")
+	fmt.Println("  --retries <n>                         Retry transient network failures n times (default 3, or DEPS_RETRIES)")
+	fmt.Println("  --timeout <duration>                  Give up on the whole command after this long (e.g. 10m)")
+	fmt.Println("  --request-timeout <duration>          Give up on a request with no response after this long (default 60s)")
+	fmt.Println("  --max-rate <rate>                     Download at most this many bytes a second, e.g. 2M (or DEPS_MAX_RATE)")
+	fmt.Println("  -j, --jobs <n>                        Install or resolve n dependencies at once (or DEPS_JOBS)")
+	fmt.Println("  --resolver api|git                    Resolve refs with the REST API or git smart HTTP (or DEPS_RESOLVER)")
+	fmt.Println("  --lockfile <file>                     Use <file> instead of .deps.lock (or DEPS_LOCKFILE)")
+	fmt.Println("  --allow-hooks                         Run post-install hooks without asking (or DEPS_ALLOW_HOOKS=1)")
+	fmt.Println("  --no-dedup                            Don't hardlink files identical to ones of other dependencies (or DEPS_DEDUP=0)")
+	fmt.Println("  --profile <name>                      Use the overrides of profile <name> from the lock file (or DEPS_PROFILE)")
+	fmt.Println("  -q, --quiet                           Only print errors (or DEPS_QUIET=1)")
+	fmt.Println("  -v, --verbose                         Also log HTTP requests and extraction details (or DEPS_VERBOSE=1)")
+	fmt.Println("  --json                                Print JSON from check, install, update, audit, list, stats, licenses, resolve, tags, info and search")
+	fmt.Println("  --dry-run                             Show what get, install, update, remove or prune would change, changing nothing")
+	fmt.Println("  --color auto|always|never             Color output on a terminal (default), always or never (NO_COLOR=1 for never)")
+}
+
+// isInteractive reports whether stdin is a terminal we can prompt on
+func isInteractive() bool {
+	return isatty(os.Stdin)
+}
+
+// maxRefChoices limits how many tags and branches the ref picker offers
+const maxRefChoices = 10
+
+// pickRef offers the newest tags and some branches of a repository and lets
+// the user choose one. It returns "" for the default branch.
+func pickRef(repoURL string, dep Dependency) (string, error) {
+	tags, err := listDependencyTags(repoURL, dep.Transport)
+	if err != nil {
+		return "", fmt.Errorf("listing tags: %w", err)
+	}
+	branches, err := listDependencyBranches(repoURL, dep.Transport)
+	if err != nil {
+		return "", fmt.Errorf("listing branches: %w", err)
+	}
+
+	var versions []tagInfo
+	for _, tag := range tags {
+		v, ok := parseSemver(strings.TrimPrefix(tag.Name, dep.TagPrefix))
+		if strings.HasPrefix(tag.Name, dep.TagPrefix) && ok && (v.Pre == "" || dep.Pre) {
+			versions = append(versions, tag)
+		}
+	}
+	sortTagsBySemver(versions, dep.TagPrefix)
+
+	return chooseRef(os.Stdin, os.Stdout, versions, branches)
+}
+
+// chooseRef prints a numbered menu of tags and branches and reads the
+// choice. Entering nothing picks the default branch; anything that isn't a
+// menu number is taken as a ref name.
+func chooseRef(in io.Reader, out io.Writer, tags, branches []tagInfo) (string, error) {
+	var choices []string
+	fmt.Fprintln(out, "  0) default branch (latest commit)")
+	for _, group := range []struct {
+		title string
+		refs  []tagInfo
+	}{{"Tags", tags}, {"Branches", branches}} {
+		if len(group.refs) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "%s:\n", group.title)
+		for i, ref := range group.refs {
+			if i == maxRefChoices {
+				fmt.Fprintf(out, "     ... %d more\n", len(group.refs)-maxRefChoices)
+				break
+			}
+			choices = append(choices, ref.Name)
+			fmt.Fprintf(out, "%3d) %s\n", len(choices), ref.Name)
+		}
+	}
+
+	fmt.Fprint(out, "Choose a ref [0]: ")
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	answer = strings.TrimSpace(answer)
+
+	if answer == "" || answer == "0" {
+		return "", nil
+	}
+	if n, err := strconv.Atoi(answer); err == nil {
+		if n < 1 || n > len(choices) {
+			return "", fmt.Errorf("no choice %d", n)
+		}
+		return choices[n-1], nil
+	}
+	return answer, nil
+}
+
+// confirm asks a yes/no question on stdin, defaulting to no when stdin
+// is not interactive
+func confirm(question string) bool {
+	if !isInteractive() {
+		return false
+	}
+
+	fmt.Printf("%s [y/N] ", question)
+	var answer string
+	fmt.Scanln(&answer)
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// extractGlobalFlags removes global options from args, wherever they appear
+// before a "--" terminator, and records them in globalOptions
+func extractGlobalFlags(args []string) ([]string, error) {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		// The short forms only count before the command, where they can't
+		// be a flag of the command, and a lone -v still prints the version
+		if len(rest) == 0 && (arg == "-q" || arg == "-v") && i+1 < len(args) {
+			globalOptions.Quiet = globalOptions.Quiet || arg == "-q"
+			globalOptions.Verbose = globalOptions.Verbose || arg == "-v"
+			continue
+		}
+		// -j is short for --jobs, anywhere, and takes its value either way,
+		// as in -j 8 or -j8
+		if jobs, ok := strings.CutPrefix(arg, "-j"); ok && (jobs == "" || jobs[0] >= '0' && jobs[0] <= '9') {
+			if jobs == "" {
+				if i+1 >= len(args) {
+					return nil, fmt.Errorf("flag -j requires a value")
+				}
+				i++
+				jobs = args[i]
+			}
+			n, err := parseJobs(jobs)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -j %q", jobs)
+			}
+			globalOptions.Jobs = n
+			continue
+		}
+		if !strings.HasPrefix(arg, "--") {
+			rest = append(rest, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+
+		// takeValue returns the value of "--name=value" or "--name value"
+		takeValue := func() (string, error) {
+			if hasValue {
+				return value, nil
+			}
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("flag --%s requires a value", name)
+			}
+			i++
+			return args[i], nil
+		}
+
+		var err error
+		switch name {
+		case "ca-bundle":
+			globalOptions.CABundle, err = takeValue()
+		case "mirror":
+			var mirror string
+			mirror, err = takeValue()
+			globalOptions.Mirrors = append(globalOptions.Mirrors, mirror)
+		case "insecure-skip-verify":
+			globalOptions.InsecureSkipVerify = !hasValue || value == "true"
+		case "allow-hooks":
+			globalOptions.AllowHooks = !hasValue || value == "true"
+		case "max-rate":
+			globalOptions.MaxRate, err = takeValue()
+		case "jobs":
+			var jobs string
+			jobs, err = takeValue()
+			if err == nil {
+				globalOptions.Jobs, err = parseJobs(jobs)
+				if err != nil {
+					err = fmt.Errorf("invalid --jobs %q", jobs)
+				}
+			}
+		case "no-dedup":
+			globalOptions.NoDedup = !hasValue || value == "true"
+		case "dry-run":
+			globalOptions.DryRun = !hasValue || value == "true"
+		case "quiet":
+			globalOptions.Quiet = !hasValue || value == "true"
+		case "verbose":
+			globalOptions.Verbose = !hasValue || value == "true"
+		case "json":
+			// deps migrate --json names the format to convert to
+			if len(rest) > 0 && rest[0] == "migrate" {
+				rest = append(rest, arg)
+				break
+			}
+			globalOptions.JSON = !hasValue || value == "true"
+		case "wait-on-rate-limit":
+			globalOptions.WaitOnRateLimit = !hasValue || value == "true"
+		case "retries":
+			var retries string
+			retries, err = takeValue()
+			if err == nil {
+				globalOptions.Retries, err = strconv.Atoi(retries)
+				if err != nil || globalOptions.Retries < 0 {
+					err = fmt.Errorf("invalid --retries %q", retries)
+				}
+			}
+		case "timeout", "request-timeout":
+			var timeout string
+			timeout, err = takeValue()
+			if err == nil {
+				var d time.Duration
+				d, err = time.ParseDuration(timeout)
+				if err != nil || d <= 0 {
+					err = fmt.Errorf("invalid --%s %q (expected a duration like 30s or 5m)", name, timeout)
+				} else if name == "timeout" {
+					globalOptions.Timeout = d
+				} else {
+					globalOptions.RequestTimeout = d
+				}
+			}
+		case "resolver":
+			globalOptions.Resolver, err = takeValue()
+		case "color":
+			globalOptions.Color, err = takeValue()
+		case "lockfile":
+			globalOptions.LockFile, err = takeValue()
+		case "profile":
+			globalOptions.Profile, err = takeValue()
+		default:
+			rest = append(rest, arg)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rest, nil
+}
+
+// stringsFlag is a flag that can be repeated, collecting every value
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// parseFlags parses fs from args, allowing flags to appear before or after
+// positional arguments, and returns the positional arguments
+func parseFlags(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// handleInit creates .deps.lock, optionally backfilling entries for
+// dependencies already in .deps and adding .deps/ to .gitignore
+func handleInit(args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	backfill := fs.Bool("backfill", false, "add dependencies found in .deps without asking")
+	gitignore := fs.Bool("gitignore", false, "add .deps/ to .gitignore without asking")
+	toml := fs.Bool("toml", false, "create .deps.toml, which allows comments, instead of .deps.lock")
+	positional := parseFlags(fs, args)
+	if len(positional) != 0 {
+		fmt.Println("Usage: deps init [--backfill] [--gitignore] [--toml]")
+		os.Exit(1)
+	}
+
+	path, taken := jsonLockFile, []string{jsonLockFile, tomlLockFile}
+	if lockFileOverride != "" {
+		path, taken = lockFileOverride, []string{lockFileOverride}
+	}
+	if *toml {
+		path = convertedLockFilePath(path, true)
+		taken = append(taken, path)
+	}
+	for _, existing := range taken {
+		if _, err := os.Stat(existing); err == nil {
+			errorf("Error: %s already exists\n", existing)
+			os.Exit(1)
+		}
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			errorf("Error: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+	}
+
+	lockFile := &LockFile{Dependencies: make(map[string]Dependency)}
+
+	installed, err := findInstalledDeps()
+	if err != nil {
+		errorf("Error scanning .deps: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	if len(installed) > 0 {
+		infof("Found %d dependencies in .deps:\n", len(installed))
+		for _, repoURL := range installed {
+			infof("  %s\n", repoURL)
+		}
+		if *backfill || confirm(fmt.Sprintf("Add them to %s?", path)) {
+			for _, repoURL := range installed {
+				dep, verified, err := backfillDependency(repoURL)
+				if err != nil {
+					errorf("%s %s: %v\n", colorize(colorRed, "✗"), repoURL, err)
+					exitIfInterrupted()
+					continue
+				}
+				lockFile.Dependencies[repoURL] = dep
+				if verified {
+					infof("%s Added %s@%s (%s) from its git checkout\n", colorize(colorGreen, "✓"), repoURL, dep.Ref, dep.SHA[:8])
+				} else {
+					warnf("%s Added %s@%s (%s) - assumed to be the default branch; reinstall it to be sure\n", colorize(colorYellow, "!"), repoURL, dep.Ref, dep.SHA[:8])
+				}
+			}
+		}
+	}
+
+	err = writeLockFileAt(path, lockFile)
+	if err != nil {
+		errorf("Error saving lock file: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	infof("%s Created %s with %d dependencies\n", colorize(colorGreen, "✓"), path, len(lockFile.Dependencies))
+
+	if projectMode() != modeVendored && !gitignoreHasDeps() && (*gitignore || confirm("Add .deps/ to .gitignore?")) {
+		err = addDepsToGitignore()
+		if err != nil {
+			errorf("Error updating .gitignore: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+		infof("%s Added .deps/ to .gitignore\n", colorize(colorGreen, "✓"))
+	}
+}
+
+func handleGet(args []string) {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	ssh := fs.Bool("ssh", false, "fetch over git+SSH instead of HTTPS")
+	submodules := fs.Bool("submodules", false, "download git submodules at their pinned SHAs")
+	lfs := fs.Bool("lfs", false, "replace Git LFS pointer files with their content")
+	pre := fs.Bool("pre", false, "allow pre-release tags for constraints and latest")
+	tagPrefix := fs.String("tag-prefix", "", "only resolve versions from tags with this prefix")
+	noPrompt := fs.Bool("no-prompt", false, "don't offer a ref picker when no ref is given")
+	policy := fs.String("policy", "", "update policy: frozen, follow-branch or semver-range")
+	alias := fs.String("as", "", "short name for the dependency, also its directory under .deps")
+	add := fs.Bool("add", false, "add another entry for an already locked repository, named by --as")
+	postInstall := fs.String("post-install", "", "shell command to run in the dependency's directory after each download")
+	replace := fs.String("replace", "", "with --profile, lock this repository in place of the given dependency")
+	strip := fs.Int("strip", 0, "remove this many more leading directories from every file")
+	maxSize := fs.String("max-size", "", "fail installs whose files add up to more than this, like 500M")
+	soft := fs.Bool("soft", false, "only warn when the dependency's license breaks the license policy")
+	urlSource := fs.Bool("url", false, "lock an archive downloaded from a URL, pinned by its hash, rather than a repository")
+	var rename, only, exclude stringsFlag
+	fs.Var(&rename, "rename", "move a file or directory, as from=to (repeatable; to . for the root)")
+	fs.Var(&only, "only", "keep only files matching this glob (repeatable)")
+	fs.Var(&exclude, "exclude", "remove files matching this glob (repeatable)")
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 || (*add && *alias == "") {
+		fmt.Println("Usage: deps get [--ssh] [--submodules] [--lfs] [--pre] [--tag-prefix <prefix>] [--no-prompt] [--policy <policy>] [--as <alias> [--add]] [--post-install <command>] [--replace <dep>] [--strip <n>] [--rename <from>=<to>]... [--only <glob>]... [--exclude <glob>]... [--max-size <size>] [--soft] github.com/user/repo[@ref] | --url <url>")
+		os.Exit(1)
+	}
+	var renames map[string]string
+	for _, spec := range rename {
+		from, to, ok := strings.Cut(spec, "=")
+		if !ok {
+			errorf("Error: --rename %q is not from=to\n", spec)
+			os.Exit(1)
+		}
+		if renames == nil {
+			renames = make(map[string]string)
+		}
+		renames[from] = to
+	}
+	if problems := validateTransforms(Dependency{Strip: *strip, Rename: renames}); len(problems) > 0 {
+		errorf("Error: %s\n", strings.Join(problems, "; "))
+		os.Exit(1)
+	}
+	for _, pattern := range append(append([]string(nil), only...), exclude...) {
+		if err := validateGlob(pattern); err != nil {
+			errorf("Error: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+	}
+	if *maxSize != "" {
+		if _, err := parseSize(*maxSize); err != nil {
+			errorf("Error: --max-size: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	softLicensePolicy = *soft
+	repoSpec := positional[0]
+
+	transport := transportHTTPS
+	if *ssh {
+		transport = transportSSH
+	}
+
+	// Parse GitHub URL and ref, or the URL of a URL source, which is all
+	// there is to one: the options for resolving and fetching a repository
+	// don't apply
+	var repoURL, ref string
+	var err error
+	if *urlSource {
+		if *ssh || *submodules || *lfs || *pre || *tagPrefix != "" || *policy != "" {
+			errorf("Error: --url can't be used with --ssh, --submodules, --lfs, --pre, --tag-prefix or --policy\n")
+			os.Exit(1)
+		}
+		repoURL, err = urlSourceKey(repoSpec)
+	} else {
+		repoURL, ref, err = parseGitHubSpec(repoSpec)
+		repoURL = expandRepoShorthand(repoURL)
+	}
+	if err != nil {
+		errorf("Error parsing spec: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	err = validateRepoURL(repoURL)
+	if err == nil && isURLSource(repoURL) && !*urlSource {
+		err = fmt.Errorf("%s is a URL, not a repository (use --url to lock the archive it downloads)", repoURL)
+	}
+	if err != nil {
+		errorf("Error parsing URL: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	// A second entry for the same repository is keyed by its alias
+	if _, name := splitEntryName(repoURL); name != "" && *alias == "" {
+		*alias = name
+	}
+	if *add {
+		repoURL = joinEntryName(repoURL, *alias)
+		if _, exists := loadLockFile().Dependencies[repoURL]; exists {
+			errorf("Error: %s is already in the lock file\n", repoURL)
+			os.Exit(1)
+		}
+	}
+
+	// Offer a choice of refs rather than silently pinning the default branch
+	if ref == "" && !*urlSource && !*noPrompt && isInteractive() {
+		ref, err = pickRef(repoURL, Dependency{Transport: transport, Pre: *pre, TagPrefix: *tagPrefix})
+		if err != nil {
+			errorf("Error choosing ref: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+	}
+
+	infof("Fetching %s", repoURL)
+	if ref != "" {
+		infof("@%s", ref)
+	}
+	infof("...\n")
+
+	dep := newDependency(ref)
+	dep.Transport = transport
+	dep.Submodules = *submodules
+	dep.LFS = *lfs
+	dep.Pre = *pre
+	dep.TagPrefix = *tagPrefix
+	dep.PostInstall = *postInstall
+	dep.Strip = *strip
+	dep.Rename = renames
+	dep.Only = only
+	dep.Exclude = exclude
+	dep.MaxSize = *maxSize
+
+	// Resolve ref to commit SHA. A URL source is pinned by the hash of its
+	// download instead, once it is installed.
+	label := repoURL
+	if !*urlSource {
+		sha, resolvedRef, err := resolveDependency(repoURL, dep)
+		if err != nil {
+			errorf("Error resolving ref: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+
+		infof("Resolved to %s@%s\n", resolvedRef, sha[:8])
+		label = fmt.Sprintf("%s@%s (%s)", repoURL, resolvedRef, sha[:8])
+
+		// Pin the resolved ref for the default branch, keywords like "latest"
+		// and abbreviated SHAs
+		dep.SHA = sha
+		dep.Metadata = resolveMetadata(repoURL, dep, resolvedRef)
+		if dep.Ref == "" || isRefKeyword(dep.Ref) || isFullSHA(resolvedRef) {
+			dep.Ref = resolvedRef
+		}
+
+		dep, err = withPolicy(dep, *policy)
+		if err != nil {
+			errorf("Error: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+	}
+
+	// Load or create lock file, keeping any alias the dependency already has.
+	// With a profile active, changes to a locked dependency, or a replacement
+	// for one, are recorded as overrides in the profile.
+	lockFile := loadProfileLockFile(true)
+	if activeProfile != "" {
+		replaces := repoURL
+		if *replace != "" {
+			replaces = resolveAlias(lockFile, *replace)
+		}
+		if _, exists := lockFile.Dependencies[replaces]; exists || *replace != "" {
+			err = overrideInProfile(lockFile, repoURL, replaces)
+		}
+	} else if *replace != "" {
+		err = fmt.Errorf("--replace needs a profile to record the replacement in (use --profile)")
+	}
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	dep.Alias = lockFile.Dependencies[repoURL].Alias
+	if baseKey := profileBaseKey(lockFile, repoURL); baseKey != repoURL {
+		dep.Alias = lockFile.profile.bases[baseKey].Alias
+	}
+	if *alias != "" && *alias != dep.Alias {
+		if _, exists := lockFile.Dependencies[repoURL]; exists && !dryRun {
+			// Moves the existing installation
+			err = setAlias(lockFile, repoURL, *alias)
+		} else {
+			err = checkAlias(lockFile, repoURL, *alias)
+			depAliases[repoURL] = *alias
+		}
+		dep.Alias = *alias
+	}
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	// Submodules are resolved together with those of the other dependencies
+	lockFile.Dependencies[repoURL] = dep
+	resolved, err := planSubmodules(lockFile)
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	if dryRun {
+		infof("Would download %s into %s\n", label, getDepPath(repoURL))
+		for _, other := range sortedKeys(lockFile.Dependencies) {
+			if reason, changed := resolved[other]; changed && other != repoURL {
+				infof("Would reinstall %s: %s\n", other, reason)
+			}
+		}
+		infof("Would write %s\n", lockFilePath())
+		return
+	}
+
+	// Download and extract
+	dep, err = installDependency(repoURL, dep)
+	if err != nil {
+		errorf("Error downloading repo: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	lockFile.Dependencies[repoURL] = dep
+	reinstallResolved(lockFile, resolved, repoURL)
+
+	// Save lock file
+	err = saveLockFile(lockFile)
+	if err != nil {
+		errorf("Error saving lock file: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	if *urlSource {
+		label = describeDep(repoURL, dep)
+	}
+	infof("%s Added %s\n", colorize(colorGreen, "✓"), label)
+}
+
+// handleResolve prints what a spec resolves to without downloading anything
+// or touching the lock file
+func handleResolve(args []string) {
+	fs := flag.NewFlagSet("resolve", flag.ExitOnError)
+	ssh := fs.Bool("ssh", false, "resolve over git+SSH instead of HTTPS")
+	pre := fs.Bool("pre", false, "allow pre-release tags for constraints and latest")
+	tagPrefix := fs.String("tag-prefix", "", "only resolve versions from tags with this prefix")
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 {
+		fmt.Println("Usage: deps resolve [--ssh] [--pre] [--tag-prefix <prefix>] github.com/user/repo[@ref]")
+		os.Exit(1)
+	}
+
+	repoURL, ref, err := parseGitHubSpec(positional[0])
+	if err != nil {
+		errorf("Error parsing spec: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	repoURL = expandRepoShorthand(repoURL)
+
+	err = validateRepoURL(repoURL)
+	if err != nil {
+		errorf("Error parsing URL: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	dep := newDependency(ref)
+	if *ssh {
+		dep.Transport = transportSSH
+	}
+	dep.Pre = *pre
+	dep.TagPrefix = *tagPrefix
+
+	sha, resolvedRef, err := resolveDependency(repoURL, dep)
+	if err != nil {
+		errorf("Error resolving ref: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	kind, err := refKind(repoURL, dep, resolvedRef)
+	if err != nil {
+		errorf("Error resolving ref: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	archive, err := archiveURL(repoURL, dep, sha)
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	if jsonOutput {
+		printJSON(resolveReport{Repo: repoURL, Ref: resolvedRef, Kind: kind, SHA: sha, Archive: archive})
+		return
+	}
+	fmt.Printf("Repository: %s\n", repoURL)
+	fmt.Printf("Ref:        %s (%s)\n", resolvedRef, kind)
+	fmt.Printf("SHA:        %s\n", sha)
+	fmt.Printf("Archive:    %s\n", archive)
+}
+
+// handleTags lists the tags or branches of a repository
+func handleTags(args []string) {
+	fs := flag.NewFlagSet("tags", flag.ExitOnError)
+	branches := fs.Bool("branches", false, "list branches instead of tags")
+	bySemver := fs.Bool("semver", false, "sort tags by descending semver version")
+	tagPrefix := fs.String("tag-prefix", "", "only list tags with this prefix")
+	limit := fs.Int("limit", 0, "show at most this many entries")
+	ssh := fs.Bool("ssh", false, "list over git+SSH instead of HTTPS")
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 {
+		fmt.Println("Usage: deps tags [--branches] [--semver] [--tag-prefix <prefix>] [--limit <n>] [--ssh] github.com/user/repo")
+		os.Exit(1)
+	}
+	repoURL := positional[0]
+
+	err := validateRepoURL(repoURL)
+	if err != nil {
+		errorf("Error parsing URL: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	transport := transportHTTPS
+	if *ssh {
+		transport = transportSSH
+	}
+
+	var refs []tagInfo
+	if *branches {
+		refs, err = listDependencyBranches(repoURL, transport)
+	} else {
+		refs, err = listDependencyTags(repoURL, transport)
+	}
+	if err != nil {
+		errorf("Error listing refs: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	var filtered []tagInfo
+	for _, ref := range refs {
+		if strings.HasPrefix(ref.Name, *tagPrefix) {
+			filtered = append(filtered, ref)
+		}
+	}
+	if *bySemver {
+		sortTagsBySemver(filtered, *tagPrefix)
+	}
+	if *limit > 0 && len(filtered) > *limit {
+		filtered = filtered[:*limit]
+	}
+
+	if jsonOutput {
+		listed := []tagReport{}
+		for _, ref := range filtered {
+			listed = append(listed, tagReport{Name: ref.Name, SHA: ref.SHA})
+		}
+		printJSON(listed)
+		return
+	}
+	for _, ref := range filtered {
+		fmt.Printf("%s  %s\n", ref.SHA[:8], ref.Name)
+	}
+}
+
+// handleInfo shows details of a repository and, if it is a dependency, what
+// is locked and where it is installed
+func handleInfo(args []string) {
+	if len(args) != 1 {
+		fmt.Println("Usage: deps info github.com/user/repo")
+		os.Exit(1)
+	}
+	repoURL := args[0]
+
+	err := validateRepoURL(repoURL)
+	if err != nil {
+		errorf("Error parsing URL: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	details, err := getRepoDetails(repoURL)
+	if err != nil {
+		errorf("Error fetching repository details: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	dep, exists := loadLockFile().Dependencies[repoURL]
+	depPath := getDepPath(repoURL)
+	_, statErr := os.Stat(depPath)
+
+	if jsonOutput {
+		report := infoReport{
+			Repo:          repoURL,
+			Description:   details.Description,
+			DefaultBranch: details.DefaultBranch,
+			LatestRelease: details.LatestRelease,
+			License:       details.License,
+			Archived:      details.Archived,
+		}
+		if exists {
+			report.Locked = &lockedInfo{Ref: dep.Ref, SHA: dep.SHA, Constraint: dep.Constraint, Policy: dep.Policy, Pinned: dep.Pinned, Path: depPath, Installed: statErr == nil}
+		}
+		printJSON(report)
+		return
+	}
+
+	orNone := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+
+	fmt.Println(repoURL)
+	if details.Description != "" {
+		fmt.Printf("  %s\n", details.Description)
+	}
+	fmt.Println()
+	fmt.Printf("Default branch: %s\n", orNone(details.DefaultBranch))
+	fmt.Printf("Latest release: %s\n", orNone(details.LatestRelease))
+	fmt.Printf("License:        %s\n", orNone(details.License))
+	if details.Archived {
+		fmt.Printf("Archived:       %s\n", colorize(colorYellow, "yes"))
+	} else {
+		fmt.Println("Archived:       no")
+	}
+
+	if !exists {
+		fmt.Println("Locked:         - (not in .deps.lock)")
+		return
+	}
+
+	locked := fmt.Sprintf("%s (%s)", dep.Ref, dep.SHA[:8])
+	if dep.Constraint != "" {
+		locked += ", tracking " + dep.Constraint
+	}
+	if dep.Policy != "" {
+		locked += ", policy " + dep.Policy
+	}
+	if dep.Pinned {
+		locked += ", pinned"
+	}
+	fmt.Printf("Locked:         %s\n", locked)
+
+	if statErr == nil {
+		fmt.Printf("Path:           %s\n", depPath)
+	} else {
+		fmt.Printf("Path:           %s (not installed)\n", depPath)
+	}
+}
+
+// handleSearch searches GitHub for repositories. With --urls only the
+// repository URLs are printed, so results can be piped into `deps get`.
+func handleSearch(args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	limit := fs.Int("limit", 10, "show at most this many results")
+	urlsOnly := fs.Bool("urls", false, "print only repository URLs")
+	positional := parseFlags(fs, args)
+	if len(positional) == 0 || *limit < 1 {
+		fmt.Println("Usage: deps search [--limit <n>] [--urls] <query>")
+		os.Exit(1)
+	}
+
+	result, err := searchRepos(strings.Join(positional, " "), *limit)
+	if err != nil {
+		errorf("Error searching: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	if jsonOutput {
+		report := searchReport{TotalCount: result.TotalCount, Repositories: []searchResult{}}
+		for _, item := range result.Items {
+			report.Repositories = append(report.Repositories, searchResult{Repo: "github.com/" + item.FullName, Description: item.Description, Stars: item.StargazersCount, Archived: item.Archived})
+		}
+		printJSON(report)
+		return
+	}
+
+	for _, item := range result.Items {
+		repoURL := "github.com/" + item.FullName
+		if *urlsOnly {
+			fmt.Println(repoURL)
+			continue
+		}
+		fmt.Printf("%s  ★ %d", repoURL, item.StargazersCount)
+		if item.Archived {
+			fmt.Printf(" %s", colorize(colorYellow, "(archived)"))
+		}
+		fmt.Println()
+		if item.Description != "" {
+			fmt.Printf("  %s\n", item.Description)
+		}
+	}
+
+	if !*urlsOnly && len(result.Items) < result.TotalCount {
+		fmt.Printf("\nShowing %d of %d results\n", len(result.Items), result.TotalCount)
+	}
+}
+
+// handleList prints what is locked and installed, without using the network
+func handleList(args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	format := fs.String("format", "", "print each dependency with a Go template, e.g. '{{.Repo}} {{.SHA}}'")
+	positional := parseFlags(fs, args)
+	if len(positional) != 0 || (jsonOutput && *format != "") {
+		fmt.Println("Usage: deps list [--json | --format <template>]")
+		os.Exit(1)
+	}
+
+	var tmpl *template.Template
+	if *format != "" {
+		var err error
+		tmpl, err = template.New("format").Parse(*format)
+		if err != nil {
+			errorf("Error: invalid --format: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+	}
+
+	lockFile := loadLockFile()
+	sums, err := loadSums()
+	if err != nil {
+		errorf("Error reading %s: %v\n", sumsFilePath(), err)
+		os.Exit(exitCodeFor(err))
+	}
+	entries, err := listDependencies(lockFile, sums)
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	switch {
+	case jsonOutput:
+		if entries == nil {
+			entries = []listEntry{}
+		}
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			errorf("Error: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+		fmt.Println(string(data))
+	case tmpl != nil:
+		for _, entry := range entries {
+			if err := tmpl.Execute(os.Stdout, entry); err != nil {
+				errorf("\nError: %v\n", err)
+				os.Exit(exitCodeFor(err))
+			}
+			fmt.Println()
+		}
+	case len(entries) == 0:
+		fmt.Printf("No dependencies found in %s\n", lockFilePath())
+	default:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "REPOSITORY\tREF\tSHA\tPATH\tSIZE\tSTATUS")
+		for _, entry := range entries {
+			size := "-"
+			if entry.Status != listMissing {
+				size = formatSize(entry.Size)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Repo, entry.Ref, abbreviate(entry.SHA), entry.Path, size, entry.Status)
+		}
+		w.Flush()
+	}
+}
+
+// handleStats prints how much space each installed dependency takes, largest
+// first, and the totals of .deps and the cache
+func handleStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	positional := parseFlags(fs, args)
+	if len(positional) != 0 {
+		fmt.Println("Usage: deps stats [--json]")
+		os.Exit(1)
+	}
+
+	stats, err := collectStats(loadLockFile())
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	if jsonOutput {
+		data, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			errorf("Error: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	if len(stats.Dependencies) > 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SIZE\tFILES\tREPOSITORY\tPATH")
+		for _, entry := range stats.Dependencies {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", formatSize(entry.Size), entry.Files, entry.Repo, entry.Path)
+		}
+		w.Flush()
+		fmt.Println()
+	}
+	var depsSize int64
+	files := 0
+	for _, entry := range stats.Dependencies {
+		depsSize += entry.Size
+		files += entry.Files
+	}
+	fmt.Printf("Dependencies:  %d (%s, %d files)\n", len(stats.Dependencies), formatSize(depsSize), files)
+	if stats.Missing > 0 {
+		fmt.Printf("Missing:       %d - run 'deps install' to install them\n", stats.Missing)
+	}
+	if stats.OtherPaths > 0 {
+		fmt.Printf("Unreferenced:  %d paths (%s) - run 'deps prune' to remove them\n", stats.OtherPaths, formatSize(stats.Other))
+	}
+	fmt.Printf("%-15s%s\n", depsDir+":", formatSize(stats.Total))
+	fmt.Printf("Cache:         %d entries (%s), API cache %s, store %s\n", stats.Cache.Entries, formatSize(stats.Cache.Trees), formatSize(stats.Cache.HTTP), formatSize(stats.Cache.Store))
+}
+
+// handleLicenses lists the license of every dependency
+func handleLicenses(args []string) {
+	fs := flag.NewFlagSet("licenses", flag.ExitOnError)
+	offline := fs.Bool("offline", false, "only read the installed license files")
+	positional := parseFlags(fs, args)
+	if len(positional) != 0 {
+		fmt.Println("Usage: deps licenses [--offline] [--json]")
+		os.Exit(1)
+	}
+
+	lockFile := loadLockFile()
+	licenses := collectLicenses(lockFile, *offline)
+	for _, license := range licenses {
+		if license.err != nil {
+			setExitCode(exitCodeFor(license.err))
+		}
+	}
+	if jsonOutput {
+		data, err := json.MarshalIndent(licenses, "", "  ")
+		if err != nil {
+			errorf("Error: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+		fmt.Println(string(data))
+		exitWithCode()
+		return
+	}
+	if len(licenses) == 0 {
+		infof("No dependencies found in .deps.lock\n")
+		return
+	}
+
+	counts := make(map[string]int)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LICENSE\tREPOSITORY\tREF\tFILE")
+	for _, license := range licenses {
+		name := license.License
+		if name == "" {
+			name = "unknown"
+		}
+		shown := name
+		if license.Error != "" {
+			shown = "error"
+		}
+		file := license.File
+		if file == "" {
+			file = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", shown, license.Repo, license.Ref, file)
+		if license.Error == "" {
+			counts[name]++
+		}
+	}
+	w.Flush()
+
+	var summary []string
+	for name, n := range counts {
+		summary = append(summary, fmt.Sprintf("%s %d", name, n))
+	}
+	sort.Strings(summary)
+	if len(summary) > 0 {
+		fmt.Printf("\n%s\n", strings.Join(summary, ", "))
+	}
+	for _, license := range licenses {
+		if license.Error != "" {
+			errorf("%s %s: %s\n", colorize(colorRed, "✗"), license.Repo, license.Error)
+		}
+	}
+	exitWithCode()
+}
+
+// handleSBOM prints a software bill of materials of the locked dependencies
+func handleSBOM(args []string) {
+	fs := flag.NewFlagSet("sbom", flag.ExitOnError)
+	format := fs.String("format", sbomSPDX, "SBOM format: spdx or cyclonedx")
+	offline := fs.Bool("offline", false, "only read licenses from the installed files")
+	positional := parseFlags(fs, args)
+	if len(positional) != 0 || (*format != sbomSPDX && *format != sbomCycloneDX) {
+		fmt.Println("Usage: deps sbom [--format spdx|cyclonedx] [--offline]")
+		os.Exit(1)
+	}
+
+	lockFile := loadLockFile()
+	packages := sbomPackages(lockFile, *offline)
+	var document any
+	if *format == sbomCycloneDX {
+		document = buildCycloneDX(sbomProjectName(), packages, time.Now())
+	} else {
+		document = buildSPDX(sbomProjectName(), packages, time.Now())
+	}
+	data, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	fmt.Println(string(data))
+}
+
+// handleMode shows whether the project ignores or commits .deps, or switches
+// between the two
+func handleMode(args []string) {
+	fs := flag.NewFlagSet("mode", flag.ExitOnError)
+	positional := parseFlags(fs, args)
+	if len(positional) > 1 || (len(positional) == 1 && validateMode(positional[0]) != nil) {
+		fmt.Println("Usage: deps mode [ignored | vendored]")
+		os.Exit(1)
+	}
+
+	dir := filepath.ToSlash(depsDir)
+	if len(positional) == 0 {
+		mode, origin := configLookup("mode")
+		if mode == "" {
+			fmt.Printf("No mode set, so %s isn't managed - choose one with 'deps mode ignored' or 'deps mode vendored'\n", dir)
+			return
+		}
+		fmt.Printf("%s (from %s)\n", mode, origin)
+		return
+	}
+
+	mode := positional[0]
+	if err := writeConfigValue(projectConfigFile, "mode", mode); err != nil {
+		errorf("Error writing %s: %v\n", projectConfigFile, err)
+		os.Exit(1)
+	}
+	infof("%s Set mode to %s in %s\n", colorize(colorGreen, "✓"), mode, projectConfigFile)
+	if env := os.Getenv("DEPS_MODE"); env != "" && env != mode {
+		warnf("Warning: DEPS_MODE is set and takes precedence\n")
+	}
+
+	switch mode {
+	case modeIgnored:
+		if !gitignoreHasDeps() {
+			if err := addDepsToGitignore(); err != nil {
+				errorf("Error updating .gitignore: %v\n", err)
+				os.Exit(exitCodeFor(err))
+			}
+			infof("%s Added %s/ to .gitignore\n", colorize(colorGreen, "✓"), dir)
+		}
+		infof("\nIf %s is committed, stop tracking it with: git rm -r --cached %s\n", dir, dir)
+	case modeVendored:
+		removed, err := removeDepsFromGitignore()
+		if err != nil {
+			errorf("Error updating .gitignore: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+		if removed {
+			infof("%s Removed %s/ from .gitignore\n", colorize(colorGreen, "✓"), dir)
+		}
+		// Links into the store lead out of the project, so they can't be
+		// committed
+		lockFile := loadLockFile()
+		failed := false
+		for _, repoURL := range sortedKeys(lockFile.Dependencies) {
+			depPath := getDepPath(repoURL)
+			if resolveInstallDir(depPath) == depPath {
+				continue
+			}
+			if err := unlinkFromStore(depPath); err != nil {
+				errorf("%s Error copying %s out of the store: %v\n", colorize(colorRed, "✗"), depPath, err)
+				failed = true
+				continue
+			}
+			infof("%s Copied %s out of the store\n", colorize(colorGreen, "✓"), depPath)
+		}
+		if failed {
+			os.Exit(1)
+		}
+		infof("\nCommit it with: git add %s %s\n", dir, sumsFilePath())
+	}
+}
+
+// handleTree prints the dependency graph: each dependency with the
+// submodules installed with it
+func handleTree(args []string) {
+	fs := flag.NewFlagSet("tree", flag.ExitOnError)
+	positional := parseFlags(fs, args)
+	if len(positional) != 0 {
+		fmt.Println("Usage: deps tree")
+		os.Exit(1)
+	}
+
+	lockFile := loadLockFile()
+	if len(lockFile.Dependencies) == 0 {
+		fmt.Printf("No dependencies found in %s\n", lockFilePath())
+		return
+	}
+
+	var printChildren func(nodes []depNode, prefix string)
+	printChildren = func(nodes []depNode, prefix string) {
+		for i, node := range nodes {
+			branch, indent := "├── ", "│   "
+			if i == len(nodes)-1 {
+				branch, indent = "└── ", "    "
+			}
+			fmt.Printf("%s%s%s (%s)\n", prefix, branch, node.Repo, node.Path)
+			printChildren(node.Children, prefix+indent)
+		}
+	}
+	for _, node := range dependencyTree(lockFile) {
+		fmt.Printf("%s@%s (%s)\n", node.Repo, node.Ref, abbreviate(node.SHA))
+		printChildren(node.Children, "")
+	}
+}
+
+// handleWhy explains why a repository is in .deps: as a dependency itself,
+// or as a submodule of one
+func handleWhy(args []string) {
+	fs := flag.NewFlagSet("why", flag.ExitOnError)
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 {
+		fmt.Println("Usage: deps why github.com/user/repo")
+		os.Exit(1)
+	}
+
+	lockFile := loadLockFile()
+	target := resolveAlias(lockFile, positional[0])
+	paths := findDependents(dependencyTree(lockFile), target)
+	if len(paths) == 0 {
+		errorf("%s %s isn't a dependency in %s, or an installed submodule of one\n", colorize(colorRed, "✗"), target, lockFilePath())
+		os.Exit(1)
+	}
+
+	for _, trail := range paths {
+		if len(trail) == 1 {
+			fmt.Printf("%s is a direct dependency in %s (%s)\n", trail[0].Repo, lockFilePath(), trail[0].Ref)
+			continue
+		}
+		steps := []string{trail[0].Repo}
+		for _, node := range trail[1:] {
+			steps = append(steps, fmt.Sprintf("%s (%s)", node.Repo, node.Path))
+		}
+		fmt.Println(strings.Join(steps, " → "))
+	}
+}
+
+// handleRun runs a task of the lock file, exiting with its status, or
+// lists the tasks when none is named
+func handleRun(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	positional := parseFlags(fs, args)
+	if len(positional) > 1 {
+		fmt.Println("Usage: deps run [task]")
+		os.Exit(1)
+	}
+
+	lockFile := loadLockFile()
+	if len(positional) == 0 {
+		if len(lockFile.Tasks) == 0 {
+			fmt.Printf("No tasks in %s\n", lockFilePath())
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, name := range taskNames(lockFile) {
+			fmt.Fprintf(w, "%s\t%s\n", name, lockFile.Tasks[name])
+		}
+		w.Flush()
+		return
+	}
+
+	err := runTask(lockFile, positional[0])
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		errorf("%s %v\n", colorize(colorRed, "✗"), err)
+		os.Exit(exitCodeFor(err))
+	}
+}
+
+// handleEnv prints the variables deps exec sets as statements for a shell
+// to evaluate
+func handleEnv(args []string) {
+	fs := flag.NewFlagSet("env", flag.ExitOnError)
+	shell := fs.String("shell", defaultShell(), "shell to write for: bash (any POSIX shell), fish or powershell")
+	positional := parseFlags(fs, args)
+	if len(positional) != 0 {
+		fmt.Println("Usage: deps env [--shell bash|fish|powershell]")
+		os.Exit(1)
+	}
+
+	// Errors go to stderr, since stdout is evaluated
+	lockFile := loadLockFile()
+	env, err := dependencyEnv(lockFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	dirs, err := dependencyBinDirs(lockFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	exports, err := shellExports(*shell, env, dirs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Print(exports)
+}
+
+// handleExec runs a command with an environment variable for each
+// dependency (see envVarName) holding its absolute install path, and the
+// bin directories of dependencies on PATH, exiting with the command's status
+func handleExec(args []string) {
+	fs := flag.NewFlagSet("exec", flag.ExitOnError)
+	// The command's own flags aren't ours, so parsing stops at it
+	fs.Parse(args)
+	command := fs.Args()
+	if len(command) == 0 {
+		fmt.Println("Usage: deps exec -- <command> [args...]")
+		os.Exit(1)
+	}
+
+	lockFile := loadLockFile()
+	env, err := dependencyEnv(lockFile)
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	for _, repoURL := range sortedKeys(lockFile.Dependencies) {
+		if _, err := os.Stat(getDepPath(repoURL)); err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s isn't installed (run 'deps install')\n", colorize(colorYellow, "!"), repoURL)
+		}
+	}
+	// Set in our own environment too, so the command itself is looked up there
+	dirs, err := dependencyBinDirs(lockFile)
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	if len(dirs) > 0 {
+		os.Setenv("PATH", prependPath(dirs, os.Getenv("PATH")))
+	}
+
+	// Not bound to runContext: the command gets Ctrl-C from the terminal
+	// and decides itself how to stop
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), env...)
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// handleDoctor runs checks for the usual reasons deps fails, and exits
+// non-zero if any of them failed
+func handleDoctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	positional := parseFlags(fs, args)
+	if len(positional) != 0 {
+		fmt.Println("Usage: deps doctor")
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, check := range runDoctorChecks() {
+		logf, mark := infof, colorize(colorGreen, "✓")
+		switch check.Status {
+		case doctorWarn:
+			logf, mark = warnf, colorize(colorYellow, "!")
+		case doctorFail:
+			logf, mark = errorf, colorize(colorRed, "✗")
+			failed = true
+		}
+		logf("%s %s: %s\n", mark, check.Name, check.Detail)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// handleConfig shows and saves settings. They are saved in the user's config
+// file, or with --project in the project's .deps.yml.
+func handleConfig(args []string) {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	project := fs.Bool("project", false, "save in the project's "+projectConfigFile+" instead of the user's config file")
+	showOrigin := fs.Bool("show-origin", false, "show the variable or file each setting comes from")
+	positional := parseFlags(fs, args)
+	action := "list"
+	if len(positional) > 0 {
+		action, positional = positional[0], positional[1:]
+	}
+	want := map[string]int{"list": 0, "get": 1, "set": 2, "unset": 1}
+	if n, ok := want[action]; !ok || len(positional) != n {
+		fmt.Println("Usage: deps config [list [--show-origin] | get <name> | set [--project] <name> <value> | unset [--project] <name>]")
+		os.Exit(1)
+	}
+
+	if action == "list" {
+		for _, setting := range configSettings {
+			value, origin := configLookup(setting.Name)
+			switch {
+			case value == "":
+			case *showOrigin:
+				fmt.Printf("%s  # %s\n", formatConfigLine(setting.Name, value), origin)
+			default:
+				fmt.Println(formatConfigLine(setting.Name, value))
+			}
+		}
+		return
+	}
+
+	setting, err := findSetting(positional[0])
+	if err != nil {
+		names := make([]string, len(configSettings))
+		for i, setting := range configSettings {
+			names[i] = setting.Name
+		}
+		errorf("Error: %v (settings are %s)\n", err, strings.Join(names, ", "))
+		os.Exit(1)
+	}
+	if action == "get" {
+		if value := configValue(setting.Name); value != "" {
+			fmt.Println(value)
+		}
+		return
+	}
+
+	value := ""
+	if action == "set" {
+		value = positional[1]
+		if err := checkConfigValue(setting, value, *project); err != nil {
+			errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	path := projectConfigFile
+	if !*project {
+		if path, err = userConfigFile(); err != nil {
+			errorf("Error finding the user config file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := writeConfigValue(path, setting.Name, value); err != nil {
+		errorf("Error writing %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	if value == "" {
+		infof("Removed %s from %s\n", setting.Name, path)
+	} else {
+		infof("Set %s to %s in %s\n", setting.Name, value, path)
+	}
+	if os.Getenv(setting.Env) != "" {
+		warnf("Warning: %s is set and takes precedence\n", setting.Env)
+	}
+}
+
+// handleCache shows and cleans up the download cache
+func handleCache(args []string) {
+	fs := flag.NewFlagSet("cache", flag.ExitOnError)
+	maxAge := fs.String("max-age", "", "only remove entries unused for longer than this, like 30d")
+	maxSize := fs.String("max-size", "", "remove unused entries, least recently used first, until the cache is this small")
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 || (positional[0] != "info" && positional[0] != "gc") || (positional[0] == "info" && (*maxAge != "" || *maxSize != "")) {
+		fmt.Println("Usage: deps cache info | gc [--max-age <duration>] [--max-size <size>]")
+		os.Exit(1)
+	}
+
+	var policy cacheGCPolicy
+	var err error
+	if *maxAge != "" {
+		if policy.MaxAge, err = parseAge(*maxAge); err != nil {
+			errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *maxSize != "" {
+		if policy.MaxSize, err = parseSize(*maxSize); err != nil {
+			errorf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	entries, stray, err := listCacheEntries()
+	if err != nil {
+		errorf("Error reading the download cache: %v\n", err)
+		os.Exit(1)
+	}
+	referenced, projects, err := referencedCacheEntries()
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	trees, strayTrees, err := listStoreTrees()
+	if err != nil {
+		errorf("Error reading the store: %v\n", err)
+		os.Exit(1)
+	}
+
+	if positional[0] == "info" {
+		dir, _ := cacheDir()
+		var total, used int64
+		usedCount := 0
+		for _, entry := range entries {
+			total += entry.Size
+			if referenced[entry.Path] {
+				used += entry.Size
+				usedCount++
+			}
+		}
+		httpDir, _ := httpCacheDir()
+		httpSize, _ := dirSize(httpDir)
+		state := "on"
+		if !downloadCache {
+			state = "off"
+		}
+		fmt.Printf("Location:   %s\n", filepath.Join(dir, "trees"))
+		fmt.Printf("Cache:      %s (cache-link %s)\n", state, cacheLinkMode)
+		fmt.Printf("Entries:    %d (%s)\n", len(entries), formatSize(total))
+		fmt.Printf("In use:     %d (%s) by %d projects\n", usedCount, formatSize(used), len(projects))
+		fmt.Printf("Unused:     %d (%s) - run 'deps cache gc' to remove them\n", len(entries)-usedCount, formatSize(total-used))
+		fmt.Printf("API cache:  %s\n", formatSize(httpSize))
+		if objects, _, err := listStoreObjects(trees); err == nil && (contentStore || len(trees) > 0) {
+			var storeSize int64
+			storeUsed := 0
+			for _, object := range objects {
+				storeSize += object.Size
+			}
+			for _, tree := range trees {
+				if referenced[tree.Path] {
+					storeUsed++
+				}
+			}
+			state = "on"
+			if !contentStore {
+				state = "off"
+			}
+			fmt.Printf("Store:      %s, %d trees (%d in use) sharing %d files (%s)\n", state, len(trees), storeUsed, len(objects), formatSize(storeSize))
+		}
+		return
+	}
+
+	now := time.Now()
+	garbage := selectGarbage(entries, referenced, policy, now)
+	garbageTrees, keptTrees := selectStoreGarbage(trees, referenced, policy, now)
+	objects, usedObjects, err := listStoreObjects(keptTrees)
+	if err != nil {
+		errorf("Error reading the store: %v\n", err)
+		os.Exit(1)
+	}
+	var garbageObjects []storeObject
+	for _, object := range objects {
+		if !usedObjects[object.Path] {
+			garbageObjects = append(garbageObjects, object)
+		}
+	}
+	if len(garbage) == 0 && len(stray) == 0 && len(garbageTrees) == 0 && len(strayTrees) == 0 && len(garbageObjects) == 0 {
+		infof("%s Nothing to remove from the cache\n", colorize(colorGreen, "✓"))
+		return
+	}
+	var total int64
+	failed := false
+	for _, entry := range garbage {
+		name := entry.Meta.Repo + "@" + entry.Meta.SHA[:min(7, len(entry.Meta.SHA))]
+		if dryRun {
+			infof("Would remove %s, last used %s (%s)\n", name, entry.LastUsed.Format(time.DateOnly), formatSize(entry.Size))
+			total += entry.Size
+			continue
+		}
+		if err := os.RemoveAll(entry.Path); err != nil {
+			errorf("%s Error removing %s: %v\n", colorize(colorRed, "✗"), name, err)
+			failed = true
+			continue
+		}
+		infof("Removed %s (%s)\n", name, formatSize(entry.Size))
+		total += entry.Size
+	}
+	for _, tree := range garbageTrees {
+		name := tree.Manifest.Repo + "@" + tree.Manifest.SHA[:min(7, len(tree.Manifest.SHA))]
+		if dryRun {
+			infof("Would remove %s from the store, last used %s\n", name, tree.LastUsed.Format(time.DateOnly))
+			continue
+		}
+		if err := os.RemoveAll(tree.Path); err != nil {
+			errorf("%s Error removing %s from the store: %v\n", colorize(colorRed, "✗"), name, err)
+			failed = true
+			continue
+		}
+		infof("Removed %s from the store\n", name)
+	}
+	// A file goes once no tree that is kept uses it
+	var objectsSize int64
+	for _, object := range garbageObjects {
+		if !dryRun {
+			if err := os.Remove(object.Path); err != nil {
+				errorf("%s Error removing %s: %v\n", colorize(colorRed, "✗"), object.Path, err)
+				failed = true
+				continue
+			}
+		}
+		objectsSize += object.Size
+	}
+	total += objectsSize
+	if len(garbageObjects) > 0 {
+		verb := "Removed"
+		if dryRun {
+			verb = "Would remove"
+		}
+		infof("%s %d files from the store (%s)\n", verb, len(garbageObjects), formatSize(objectsSize))
+	}
+	if dryRun {
+		counted := fmt.Sprintf("%d entries", len(garbage))
+		if len(garbageTrees) > 0 {
+			counted += fmt.Sprintf(", %d store trees", len(garbageTrees))
+		}
+		infof("\n%s, %s - run 'deps cache gc' without --dry-run to remove them\n", counted, formatSize(total))
+		return
+	}
+	// Interrupted stores, and projects whose lock files are gone
+	for _, dir := range append(stray, strayTrees...) {
+		os.RemoveAll(dir)
+	}
+	if err := writeKnownProjects(projects); err != nil {
+		warnf("Warning: couldn't update the cache's projects: %v\n", err)
+	}
+	if failed {
+		os.Exit(1)
+	}
+	infof("\n%s Freed %s\n", colorize(colorGreen, "✓"), formatSize(total))
+}
+
+// handleSelfUpdate replaces the running binary with the latest release.
+// Development builds have no version to compare, so they need --force.
+func handleSelfUpdate(args []string) {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	force := fs.Bool("force", false, "Install the latest release even if it isn't newer")
+	positional := parseFlags(fs, args)
+	if len(positional) != 0 {
+		fmt.Println("Usage: deps self-update [--force]")
+		os.Exit(1)
+	}
+
+	release, err := getLatestRelease(selfOwner, selfRepo)
+	if err != nil {
+		errorf("Error looking up the latest release: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	if !*force {
+		current, ok := parseSemver(version)
+		if !ok {
+			errorf("Error: this is a %s build; use --force to replace it with %s\n", version, release.TagName)
+			os.Exit(1)
+		}
+		if latest, ok := parseSemver(release.TagName); ok && compareSemver(latest, current) <= 0 {
+			infof("deps %s is the latest release\n", version)
+			return
+		}
+	}
+
+	target, err := currentExecutable()
+	if err != nil {
+		errorf("Error finding the deps executable: %v\n", err)
+		os.Exit(1)
+	}
+	if dryRun {
+		infof("Would replace %s (%s) with %s\n", target, version, release.TagName)
+		return
+	}
+
+	infof("Updating deps %s to %s...\n", version, release.TagName)
+	if err := selfUpdate(release, target); err != nil {
+		errorf("Error updating %s: %v\n", target, err)
+		os.Exit(exitCodeFor(err))
+	}
+	infof("%s Updated %s to %s\n", colorize(colorGreen, "✓"), target, release.TagName)
+}
+
+// handleCompletion prints the completion script for a shell. --deps and
+// --tasks are what the scripts run to list names from the lock file.
+func handleCompletion(args []string) {
+	fs := flag.NewFlagSet("completion", flag.ExitOnError)
+	deps := fs.Bool("deps", false, "list the dependencies and aliases of the lock file")
+	tasks := fs.Bool("tasks", false, "list the tasks of the lock file")
+	positional := parseFlags(fs, args)
+	if *deps || *tasks {
+		// Completion must never fail loudly, so a missing or broken lock
+		// file lists nothing
+		lockFile, err := readLockFile()
+		if err != nil {
+			return
+		}
+		what := completeDeps
+		if *tasks {
+			what = completeTasks
+		}
+		for _, name := range completionNames(lockFile, what) {
+			fmt.Println(name)
+		}
+		return
+	}
+	if len(positional) != 1 {
+		fmt.Println("Usage: deps completion bash|zsh|fish|powershell")
+		os.Exit(1)
+	}
+
+	script, err := completionScript(positional[0])
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Print(script)
+}
+
+// handleGraph prints the dependency graph, with the commit of every
+// dependency and submodule, in a format other tools render
+func handleGraph(args []string) {
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	format := fs.String("format", graphDOT, "output format: dot, mermaid or json")
+	positional := parseFlags(fs, args)
+	if len(positional) != 0 || (*format != graphDOT && *format != graphMermaid && *format != graphJSON) {
+		fmt.Println("Usage: deps graph [--format dot|mermaid|json]")
+		os.Exit(1)
+	}
+
+	lockFile := loadLockFile()
+	pins, err := collectSubmodulePins(lockFile)
+	if err != nil {
+		errorf("Error looking up submodules: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	graph := buildGraph(lockFile, pins)
+
+	switch *format {
+	case graphJSON:
+		data, err := json.MarshalIndent(graph, "", "  ")
+		if err != nil {
+			errorf("Error: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+		fmt.Println(string(data))
+	case graphMermaid:
+		fmt.Print(renderMermaid(graph))
+	default:
+		fmt.Print(renderDOT(graph))
+	}
+}
+
+// handleConflicts lists the repositories the dependencies pull in as
+// submodules at different commits, and records how they are resolved
+func handleConflicts(args []string) {
+	fs := flag.NewFlagSet("conflicts", flag.ExitOnError)
+	strategy := fs.String("strategy", "", "record how conflicts are resolved: fail, highest-tag or pinned")
+	var overrides, unset stringsFlag
+	fs.Var(&overrides, "override", "install a submodule repository at a commit, as github.com/owner/repo@sha (repeatable)")
+	fs.Var(&unset, "unset", "remove the override of a submodule repository (repeatable)")
+	positional := parseFlags(fs, args)
+	if len(positional) != 0 {
+		fmt.Println("Usage: deps conflicts [--strategy fail|highest-tag|pinned] [--override github.com/owner/repo@sha]... [--unset github.com/owner/repo]...")
+		os.Exit(1)
+	}
+
+	lockFile := loadLockFile()
+	changed := *strategy != "" || len(overrides) > 0 || len(unset) > 0
+	resolution := Resolution{}
+	if lockFile.Resolution != nil {
+		resolution = *lockFile.Resolution
+	}
+	if changed {
+		if *strategy != "" {
+			resolution.Strategy = *strategy
+		}
+		if resolution.Strategy == strategyPinned {
+			resolution.Strategy = ""
+		}
+		updated := make(map[string]string)
+		for repo, sha := range resolution.Overrides {
+			updated[repo] = sha
+		}
+		for _, spec := range overrides {
+			repo, sha, ok := strings.Cut(spec, "@")
+			if !ok {
+				errorf("Error: --override %q is not github.com/owner/repo@sha\n", spec)
+				os.Exit(1)
+			}
+			updated[normalizeRepoURL(repo)] = sha
+		}
+		for _, repo := range unset {
+			delete(updated, normalizeRepoURL(repo))
+		}
+		resolution.Overrides = nil
+		if len(updated) > 0 {
+			resolution.Overrides = updated
+		}
+		if problems := validateResolution(resolution); len(problems) > 0 {
+			errorf("Error: %s\n", strings.Join(problems, "; "))
+			os.Exit(1)
+		}
+	}
+
+	pins, err := collectSubmodulePins(lockFile)
+	if err != nil {
+		errorf("Error looking up submodules: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	plan, conflicts, err := resolveSubmodules(pins, &resolution)
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	repos := make([]string, 0, len(plan))
+	for repo := range plan {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	for _, repo := range repos {
+		how := "highest tag"
+		if _, overridden := resolution.Overrides[repo]; overridden {
+			how = "override"
+		}
+		infof("%s %s → %s (%s)\n", colorize(colorGreen, "✓"), repo, plan[repo][:8], how)
+	}
+	logf, mark := warnf, colorize(colorYellow, "!")
+	if resolution.Strategy == strategyFail {
+		logf, mark = errorf, colorize(colorRed, "✗")
+	}
+	for _, conflict := range conflicts {
+		logf("%s %s\n", mark, conflict)
+	}
+	if len(plan) == 0 && len(conflicts) == 0 {
+		infof("%s No submodule is pinned at different commits\n", colorize(colorGreen, "✓"))
+	}
+
+	if changed {
+		lockFile.Resolution = &resolution
+		if resolution.Strategy == "" && len(resolution.Overrides) == 0 && len(resolution.Resolved) == 0 {
+			lockFile.Resolution = nil
+		}
+		if err := saveLockFile(lockFile); err != nil {
+			errorf("Error saving lock file: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+		infof("\nRecorded the resolution in %s - run 'deps install' to apply it\n", lockFilePath())
+	}
+	if len(conflicts) > 0 && resolution.Strategy == strategyFail {
+		os.Exit(1)
+	}
+}
+
+// removePaths removes paths, or with dryRun only lists them, reporting the
+// space freed and whether any removal failed
+func removePaths(paths []string, dryRun bool) (total int64, failed bool) {
+	for _, path := range paths {
+		size := pathSize(path)
+		if dryRun {
+			infof("Would remove %s (%s)\n", path, formatSize(size))
+			total += size
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			errorf("%s Error removing %s: %v\n", colorize(colorRed, "✗"), path, err)
+			failed = true
+			continue
+		}
+		infof("Removed %s (%s)\n", path, formatSize(size))
+		total += size
+	}
+	return total, failed
+}
+
+// handleSync makes .deps match the lock file: missing dependencies are
+// installed, those installed at another commit are reinstalled and anything
+// the lock file doesn't reference is removed
+func handleSync(args []string) {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	positional := parseFlags(fs, args)
+	if len(positional) != 0 {
+		fmt.Println("Usage: deps sync")
+		os.Exit(1)
+	}
+
+	lockFile, err := readLockFile()
+	if err != nil {
+		// Without a lock file everything would look unreferenced
+		errorf("Error: deps sync needs a readable lock file: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	sums, err := loadSums()
+	if err != nil {
+		errorf("Error reading %s: %v\n", sumsFilePath(), err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	infof("Syncing %d dependencies:\n\n", len(lockFile.Dependencies))
+	lockFileUpdated, failed := installDependencies(lockFile, func(repoURL string, dep Dependency) string {
+		return syncReason(lockFile, repoURL, dep, sums)
+	})
+	if lockFileUpdated {
+		if err := saveLockFile(lockFile); err != nil {
+			errorf("Error saving lock file: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+	}
+	exitIfInterrupted()
+
+	// Only prune once every dependency is where it belongs
+	if !failed {
+		unreferenced, err := findUnreferenced(lockFile)
+		if err != nil {
+			errorf("Error: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+		if len(unreferenced) > 0 {
+			infof("\n")
+			_, failed = removePaths(unreferenced, false)
+		}
+	}
+
+	if failed {
+		errorf("\n%s Sync failed\n", colorize(colorRed, "✗"))
+		setExitCode(exitUsage)
+		exitWithCode()
+	}
+	infof("\n%s .deps matches %s\n", colorize(colorGreen, "✓"), lockFilePath())
+}
+
+// handleStatus prints a one-screen summary of the dependencies and the lock
+// file, quick enough to run habitually
+func handleStatus(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	offline := fs.Bool("offline", false, "don't look up whether dependencies are outdated")
+	positional := parseFlags(fs, args)
+	if len(positional) != 0 {
+		fmt.Println("Usage: deps status [--offline]")
+		os.Exit(1)
+	}
+
+	path := lockFilePath()
+	data, err := readLockData()
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	if data == nil {
+		infof("No %s - run 'deps init' or 'deps get' to start one\n", path)
+		return
+	}
+
+	lockFile := loadLockFile()
+	sums, err := loadSums()
+	if err != nil {
+		errorf("Error reading %s: %v\n", sumsFilePath(), err)
+		os.Exit(exitCodeFor(err))
+	}
+	summary, err := summarizeStatus(lockFile, sums, *offline)
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	lockFileState(&summary, path, data)
+
+	infof("%s: %d dependencies", path, summary.Total)
+	if summary.Frozen > 0 {
+		infof(", %d frozen", summary.Frozen)
+	}
+	if activeProfile != "" {
+		infof(", profile %s", activeProfile)
+	}
+	infof("\n\n")
+
+	line := func(color, symbol string, count int, label, hint string) {
+		infof("%s\n", strings.TrimRight(fmt.Sprintf("  %s %3d %-32s %s", colorize(color, symbol), count, label, hint), " "))
+	}
+	line(colorGreen, "✓", summary.Installed, "installed", "")
+	if summary.Missing > 0 {
+		line(colorRed, "✗", summary.Missing, "missing", "run 'deps install'")
+	}
+	if summary.Stale > 0 {
+		line(colorYellow, "!", summary.Stale, "installed from another commit", "run 'deps list' to see which")
+	}
+	if summary.Dirty > 0 {
+		line(colorRed, "✗", summary.Dirty, "modified locally", "run 'deps verify' for details")
+	}
+	if summary.Outdated > 0 {
+		line(colorYellow, "⬆", summary.Outdated, "outdated", "run 'deps update'")
+	}
+	if summary.Unchecked > 0 && *offline {
+		line(colorYellow, "?", summary.Unchecked, "not checked for updates", "(--offline)")
+	} else if summary.Unchecked > 0 {
+		line(colorYellow, "?", summary.Unchecked, "couldn't be checked for updates", "run 'deps check' for details")
+	}
+	if summary.Unreferenced > 0 {
+		line(colorYellow, "!", summary.Unreferenced, "unreferenced paths in .deps", "run 'deps prune'")
+	}
+
+	infof("\n")
+	switch {
+	case summary.Problems > 0:
+		errorf("  %s lock file has %d problems - run 'deps validate'\n", colorize(colorRed, "✗"), summary.Problems)
+	case summary.Version < lockFileVersion:
+		warnf("  %s lock file is format version %d - run 'deps migrate'\n", colorize(colorYellow, "!"), summary.Version)
+	case !summary.Formatted:
+		warnf("  %s lock file isn't formatted - run 'deps fmt'\n", colorize(colorYellow, "!"))
+	default:
+		infof("  %s lock file is valid and formatted\n", colorize(colorGreen, "✓"))
+	}
+	if len(sums) == 0 && summary.Installed > 0 {
+		warnf("  %s no %s to verify installed files against - reinstall to record it\n", colorize(colorYellow, "!"), sumsFilePath())
+	}
+}
+
+// handlePrune removes what is in .deps but not in the lock file
+func handlePrune(args []string) {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	positional := parseFlags(fs, args)
+	if len(positional) != 0 {
+		fmt.Println("Usage: deps prune [--dry-run]")
+		os.Exit(1)
+	}
+
+	lockFile, err := readLockFile()
+	if err != nil {
+		// Without a lock file everything would look unreferenced
+		errorf("Error: deps prune needs a readable lock file: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	unreferenced, err := findUnreferenced(lockFile)
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	if len(unreferenced) == 0 {
+		infof("%s Nothing to prune\n", colorize(colorGreen, "✓"))
+		return
+	}
+
+	total, failed := removePaths(unreferenced, dryRun)
+	if dryRun {
+		infof("\n%d paths, %s - run 'deps prune' to remove them\n", len(unreferenced), formatSize(total))
+		return
+	}
+	if failed {
+		os.Exit(1)
+	}
+	infof("\n%s Pruned %s\n", colorize(colorGreen, "✓"), formatSize(total))
+}
+
+func handleCheck(args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	dirty := fs.Bool("dirty", false, "also re-hash installed files to find local modifications")
+	positional := parseFlags(fs, args)
+	if len(positional) != 0 {
+		fmt.Println("Usage: deps check [--dirty]")
+		os.Exit(1)
+	}
+
+	lockFile := loadLockFile()
+
+	if len(lockFile.Dependencies) == 0 {
+		infof("No dependencies found in .deps.lock\n")
+		printReport("check", true)
+		return
+	}
+
+	infof("Checking %d dependencies:\n\n", len(lockFile.Dependencies))
+	prefetchRefs(lockFile)
+
+	// Committed files have to be what the lock file says, so vendored mode
+	// always checks them
+	vendored := projectMode() == modeVendored
+	var sums map[string]depSums
+	if *dirty || vendored {
+		var err error
+		sums, err = loadSums()
+		if err != nil {
+			errorf("Error reading %s: %v\n", sumsFilePath(), err)
+			os.Exit(exitCodeFor(err))
+		}
+	}
+
+	// Check several at once, then report in order
+	repoURLs := sortedKeys(lockFile.Dependencies)
+	checks := make([]refCheck, len(repoURLs))
+	runJobs(resolveJobs, separateGroups(len(repoURLs)), func(i int) {
+		checks[i].result, checks[i].err = checkDependency(repoURLs[i], lockFile.Dependencies[repoURLs[i]])
+	})
+	exitIfInterrupted()
+
+	allGood := true
+	for i, repoURL := range repoURLs {
+		dep := lockFile.Dependencies[repoURL]
+		result, err := checks[i].result, checks[i].err
+		if err != nil {
+			errorf("%s %s: ERROR - %v\n", colorize(colorRed, "✗"), repoURL, err)
+			exitIfInterrupted()
+			setExitCode(exitCodeFor(err))
+			failure := resultFor(repoURL, dep, resultError)
+			failure.Error = err.Error()
+			recordResult(failure)
+			allGood = false
+			continue
+		}
+		recorded := resultFor(repoURL, dep, result.Status)
+		recorded.MovedTo = result.RenamedTo
+		if result.Status == "update_available" {
+			recorded.LatestSHA = result.LatestSHA
+		}
+
+		switch result.Status {
+		case "ok":
+			infof("%s %s\n", colorize(colorGreen, "✓"), describeDep(repoURL, dep))
+		case "missing":
+			errorf("%s %s: MISSING - run 'deps install'\n", colorize(colorRed, "✗"), repoURL)
+			setExitCode(exitMissing)
+			allGood = false
+		case "update_available":
+			warnf("%s %s@%s — update available (%s → %s)\n", colorize(colorYellow, "⬆"), repoURL, dep.Ref, dep.SHA[:8], result.LatestSHA[:8])
+		case "pinned":
+			infof("%s %s@%s (%s) - %s\n", colorize(colorGreen, "✓"), repoURL, dep.Ref, dep.SHA[:8], dep.frozenLabel())
+		}
+
+		if result.RenamedTo != "" {
+			warnf("  %s repository has moved to %s - run 'deps update' to rewrite the lock entry\n", colorize(colorYellow, "!"), result.RenamedTo)
+			allGood = false
+		}
+
+		if (*dirty || vendored) && result.Status != "missing" {
+			verified, err := verifyDependency(repoURL, dep, sums)
+			switch {
+			case err != nil && vendored:
+				errorf("  %s can't tell if it matches the lock file: %v\n", colorize(colorRed, "✗"), err)
+				setExitCode(exitIntegrity)
+				allGood = false
+			case err != nil:
+				warnf("  %s can't tell if it was modified: %v\n", colorize(colorYellow, "!"), err)
+			case !verified.ok():
+				errorf("  %s DIRTY - %d modified, %d missing, %d extra files; run 'deps verify' for details\n", colorize(colorRed, "✗"), len(verified.Modified), len(verified.Missing), len(verified.Extra))
+				recorded.Dirty = true
+				setExitCode(exitIntegrity)
+				allGood = false
+			}
+		}
+		recordResult(recorded)
+	}
+	if vendored {
+		problems, err := vendoredProblems(lockFile)
+		if err != nil {
+			errorf("Error: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+		for _, problem := range problems {
+			errorf("%s %s\n", colorize(colorRed, "✗"), problem)
+			setExitCode(exitIntegrity)
+			allGood = false
+		}
+	}
+	printReport("check", allGood)
+
+	if allGood {
+		infof("\n%s All dependencies are up to date\n", colorize(colorGreen, "✓"))
+	} else {
+		errorf("\n%s Some dependencies need attention\n", colorize(colorRed, "✗"))
+	}
+	exitWithCode()
+}
+
+// refCheck is the outcome of checkDependency
+type refCheck struct {
+	result CheckResult
+	err    error
+}
+
+// handlePin pins or unpins a dependency at its locked SHA
+func handlePin(args []string, pinned bool) {
+	command := "unpin"
+	if pinned {
+		command = "pin"
+	}
+	if len(args) != 1 {
+		fmt.Printf("Usage: deps %s github.com/user/repo\n", command)
+		os.Exit(1)
+	}
+	lockFile := loadLockFile()
+	repoURL := resolveAlias(lockFile, args[0])
+	err := setPinned(lockFile, repoURL, pinned)
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	err = saveLockFile(lockFile)
+	if err != nil {
+		errorf("Error saving lock file: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	dep := lockFile.Dependencies[repoURL]
+	if pinned {
+		infof("%s Pinned %s at %s\n", colorize(colorGreen, "✓"), repoURL, dep.SHA[:8])
+	} else {
+		infof("%s Unpinned %s, tracking %s again\n", colorize(colorGreen, "✓"), repoURL, dep.refSpec())
+	}
+}
+
+// handleRemove deletes dependencies from the lock file along with their
+// installed files
+func handleRemove(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: deps remove github.com/user/repo|alias...")
+		os.Exit(1)
+	}
+
+	lockFile := loadLockFile()
+	for _, arg := range args {
+		repoURL := resolveAlias(lockFile, arg)
+		depPath := getDepPath(repoURL)
+		if dryRun {
+			if _, exists := lockFile.Dependencies[repoURL]; !exists {
+				errorf("Error: dependency %s not found in .deps.lock\n", repoURL)
+				os.Exit(1)
+			}
+			infof("Would remove %s (and %s)\n", repoURL, depPath)
+			continue
+		}
+		err := removeDependency(lockFile, repoURL)
+		if err != nil {
+			errorf("Error: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+		infof("%s Removed %s (and %s)\n", colorize(colorGreen, "✓"), repoURL, depPath)
+	}
+	if dryRun {
+		infof("Would write %s\n", lockFilePath())
+		return
+	}
+
+	err := saveLockFile(lockFile)
+	if err != nil {
+		errorf("Error saving lock file: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+}
+
+// handleAlias gives a dependency a short name, or removes it
+func handleAlias(args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Println("Usage: deps alias github.com/user/repo [alias]")
+		os.Exit(1)
+	}
 
-	command := os.Args[1]
+	lockFile := loadLockFile()
+	repoURL, alias := resolveAlias(lockFile, args[0]), ""
+	if len(args) == 2 {
+		alias = args[1]
+	}
+	err := setAlias(lockFile, repoURL, alias)
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
 
-	switch command {
-	case "version", "--version", "-v":
-		fmt.Printf("deps %s\n", version)
+	err = saveLockFile(lockFile)
+	if err != nil {
+		errorf("Error saving lock file: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	if alias == "" {
+		infof("%s Removed the alias of %s, now installed in %s\n", colorize(colorGreen, "✓"), repoURL, getDepPath(repoURL))
 		return
-	case "help", "--help", "-h":
-		showUsage()
+	}
+	infof("%s %s is now %s, installed in %s\n", colorize(colorGreen, "✓"), repoURL, alias, getDepPath(repoURL))
+}
+
+// handlePolicy sets the update policy of a dependency
+func handlePolicy(args []string) {
+	if len(args) != 2 {
+		fmt.Printf("Usage: deps policy github.com/user/repo %s|%s|%s|%s\n", policyFrozen, policyFollowBranch, policySemverRange, policyAuto)
+		os.Exit(1)
+	}
+	lockFile := loadLockFile()
+	repoURL, policy := resolveAlias(lockFile, args[0]), args[1]
+	err := setPolicy(lockFile, repoURL, policy)
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	err = saveLockFile(lockFile)
+	if err != nil {
+		errorf("Error saving lock file: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	dep := lockFile.Dependencies[repoURL]
+	switch dep.Policy {
+	case "":
+		infof("%s Cleared the update policy of %s\n", colorize(colorGreen, "✓"), repoURL)
+	case policySemverRange:
+		infof("%s %s now follows %s\n", colorize(colorGreen, "✓"), repoURL, dep.Constraint)
+	case policyFollowBranch:
+		infof("%s %s now follows branch %s\n", colorize(colorGreen, "✓"), repoURL, dep.Ref)
+	default:
+		infof("%s %s is now frozen at %s\n", colorize(colorGreen, "✓"), repoURL, dep.SHA[:8])
+	}
+}
+
+// handleVerify re-hashes installed dependencies and reports every file that
+// was modified, removed or added since installation. It exits non-zero if
+// anything doesn't match.
+func handleVerify(args []string) {
+	lockFile := loadLockFile()
+	if len(lockFile.Dependencies) == 0 {
+		infof("No dependencies found in .deps.lock\n")
 		return
-	case "get":
-		if len(os.Args) < 3 {
-			fmt.Println("Usage: deps get github.com/user/repo[@ref]")
-			os.Exit(1)
+	}
+
+	var repoURLs []string
+	for _, arg := range args {
+		repoURLs = append(repoURLs, resolveAlias(lockFile, arg))
+	}
+	if len(repoURLs) == 0 {
+		repoURLs = sortedKeys(lockFile.Dependencies)
+	}
+
+	sums, err := loadSums()
+	if err != nil {
+		errorf("Error reading %s: %v\n", sumsFilePath(), err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	for _, repoURL := range repoURLs {
+		dep, exists := lockFile.Dependencies[repoURL]
+		if !exists {
+			errorf("%s %s: not in .deps.lock\n", colorize(colorRed, "✗"), repoURL)
+			setExitCode(exitUsage)
+			continue
 		}
-		handleGet(os.Args[2])
-	case "check":
-		handleCheck()
-	case "install":
-		handleInstall()
-	case "update":
-		var repoURL string
-		if len(os.Args) >= 3 {
-			repoURL = os.Args[2]
+
+		result, err := verifyDependency(repoURL, dep, sums)
+		if err != nil {
+			errorf("%s %s: %v\n", colorize(colorRed, "✗"), repoURL, err)
+			setExitCode(exitCodeFor(err))
+			continue
+		}
+		if result.ok() {
+			infof("%s %s - %d files verified\n", colorize(colorGreen, "✓"), describeDep(repoURL, dep), result.Checked)
+			continue
+		}
+
+		setExitCode(exitIntegrity)
+		errorf("%s %s: %d modified, %d missing, %d extra\n", colorize(colorRed, "✗"), repoURL, len(result.Modified), len(result.Missing), len(result.Extra))
+		for _, group := range []struct {
+			label string
+			paths []string
+		}{{"modified", result.Modified}, {"missing", result.Missing}, {"extra", result.Extra}} {
+			for _, path := range group.paths {
+				infof("    %-9s %s\n", group.label+":", path)
+			}
 		}
-		handleUpdate(repoURL)
-	default:
-		fmt.Printf("Unknown command: %s\n", command)
-		showUsage()
-		os.Exit(1)
 	}
-}
 
-func showUsage() {
-	fmt.Printf("deps %s - Language agnostic dependency manager\n\n", version)
-	fmt.Println("Usage:")
-	fmt.Println("  deps get github.com/user/repo[@ref]   Add a dependency")
-	fmt.Println("  deps check                            Check dependency status")
-	fmt.Println("  deps install                          Install missing dependencies")
-	fmt.Println("  deps update [github.com/user/repo]    Update dependencies")
-	fmt.Println("  deps version                          Show version")
-	fmt.Println("  deps help                             Show this help")
+	if exitCode != exitOK {
+		errorf("\n%s Some dependencies don't match their checksums - reinstall them\n", colorize(colorRed, "✗"))
+		exitWithCode()
+	}
+	infof("\n%s All dependencies verified\n", colorize(colorGreen, "✓"))
 }
 
-func handleGet(repoSpec string) {
-	// Parse GitHub URL and ref
-	repoURL, ref, err := parseGitHubSpec(repoSpec)
+// handleAudit looks up the locked commit of every dependency, or of those
+// given, in OSV and lists the known vulnerabilities of each
+func handleAudit(args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	positional := parseFlags(fs, args)
+
+	lockFile := loadLockFile()
+	if len(lockFile.Dependencies) == 0 {
+		infof("No dependencies found in .deps.lock\n")
+		printReport("audit", true)
+		return
+	}
+
+	audited := &LockFile{Dependencies: make(map[string]Dependency)}
+	for _, arg := range positional {
+		repoURL := resolveAlias(lockFile, arg)
+		dep, exists := lockFile.Dependencies[repoURL]
+		if !exists {
+			errorf("Error: %s is not in .deps.lock\n", repoURL)
+			os.Exit(1)
+		}
+		audited.Dependencies[repoURL] = dep
+	}
+	if len(positional) == 0 {
+		audited = lockFile
+	}
+
+	findings, err := auditDependencies(audited)
 	if err != nil {
-		fmt.Printf("Error parsing spec: %v\n", err)
+		errorf("Error querying OSV: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	for _, repoURL := range sortedKeys(audited.Dependencies) {
+		dep := audited.Dependencies[repoURL]
+		if isURLSource(repoURL) {
+			recordResult(resultFor(repoURL, dep, resultNotAudited))
+			warnf("%s %s - a URL source, which OSV can't look up\n", colorize(colorYellow, "!"), repoURL)
+			continue
+		}
+		vulns := findings[repoURL]
+		if len(vulns) == 0 {
+			recordResult(resultFor(repoURL, dep, resultNoKnownVulns))
+			infof("%s %s@%s (%s)\n", colorize(colorGreen, "✓"), repoURL, dep.Ref, dep.SHA[:8])
+			continue
+		}
+
+		result := resultFor(repoURL, dep, resultVulnerable)
+		result.Vulnerabilities = vulns
+		recordResult(result)
+		errorf("%s %s@%s (%s) - known vulnerabilities: %d\n", colorize(colorRed, "✗"), repoURL, dep.Ref, dep.SHA[:8], len(vulns))
+		for _, vuln := range vulns {
+			infof("    %s  %s  %s\n", vuln.ID, vuln.Severity, vuln.Summary)
+			var fixed []string
+			for _, fix := range vuln.Fixed {
+				if isFullSHA(fix) {
+					fix = fix[:8]
+				}
+				fixed = append(fixed, fix)
+			}
+			if len(fixed) > 0 {
+				infof("        fixed in %s\n", strings.Join(fixed, ", "))
+			} else {
+				infof("        no fix released\n")
+			}
+		}
+	}
+
+	if len(findings) > 0 {
+		setExitCode(exitVulnerable)
+		printReport("audit", false)
+		errorf("\n%s %d of %d dependencies have known vulnerabilities - update them past the fixes\n", colorize(colorRed, "✗"), len(findings), len(audited.Dependencies))
+		exitWithCode()
+	}
+	printReport("audit", true)
+	infof("\n%s No known vulnerabilities\n", colorize(colorGreen, "✓"))
+}
+
+// handleValidate checks a lock file (the one in use by default) for
+// structural problems without touching the network
+func handleValidate(args []string) {
+	if len(args) > 1 {
+		fmt.Println("Usage: deps validate [path/to/.deps.lock]")
 		os.Exit(1)
 	}
+	path := lockFilePath()
+	if len(args) == 1 {
+		path = args[0]
+	}
 
-	owner, repo, err := parseGitHubURL(repoURL)
+	data, err := os.ReadFile(path)
 	if err != nil {
-		fmt.Printf("Error parsing URL: %v\n", err)
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	var problems []string
+	if isTOMLLockFile(path) {
+		problems = validateTOMLLockData(data)
+	} else {
+		problems = validateLockData(data)
+	}
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			errorf("%s %s\n", colorize(colorRed, "✗"), problem)
+		}
+		errorf("\n%s %s has %d problems\n", colorize(colorRed, "✗"), path, len(problems))
 		os.Exit(1)
 	}
+	infof("%s %s is valid\n", colorize(colorGreen, "✓"), path)
+}
 
-	fmt.Printf("Fetching %s", repoURL)
-	if ref != "" {
-		fmt.Printf("@%s", ref)
+// handleFmt rewrites a lock file (the one in use by default) in canonical
+// form, or with --check only reports whether it already is
+func handleFmt(args []string) {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := fs.Bool("check", false, "report whether the lock file is formatted without changing it")
+	positional := parseFlags(fs, args)
+	if len(positional) > 1 {
+		fmt.Println("Usage: deps fmt [--check] [path/to/.deps.lock]")
+		os.Exit(1)
+	}
+	path := lockFilePath()
+	if len(positional) == 1 {
+		path = positional[0]
 	}
-	fmt.Println("...")
 
-	// Resolve ref to commit SHA
-	sha, resolvedRef, err := resolveRef(owner, repo, ref)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	formatted, err := formatLockData(path, data)
 	if err != nil {
-		fmt.Printf("Error resolving ref: %v\n", err)
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+
+	if bytes.Equal(data, formatted) {
+		infof("%s %s is formatted\n", colorize(colorGreen, "✓"), path)
+		return
+	}
+	if *check {
+		errorf("%s %s is not formatted - run 'deps fmt'\n", colorize(colorRed, "✗"), path)
 		os.Exit(1)
 	}
+	err = os.WriteFile(path, formatted, 0644)
+	if err != nil {
+		errorf("Error saving lock file: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	infof("%s Formatted %s\n", colorize(colorGreen, "✓"), path)
+}
 
-	fmt.Printf("Resolved to %s@%s\n", resolvedRef, sha[:8])
+// handleMigrate rewrites the lock file in the current format version, or
+// converts it between JSON and TOML
+func handleMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	toTOML := fs.Bool("toml", false, "convert .deps.lock to .deps.toml")
+	toJSON := fs.Bool("json", false, "convert .deps.toml to .deps.lock")
+	positional := parseFlags(fs, args)
+	if len(positional) != 0 || (*toTOML && *toJSON) {
+		fmt.Println("Usage: deps migrate [--toml | --json]")
+		os.Exit(1)
+	}
 
-	// Download and extract
-	hash, err := downloadRepo(owner, repo, sha, repoURL)
+	path := lockFilePath()
+	lockFile, from, err := readLockFileAt(path)
 	if err != nil {
-		fmt.Printf("Error downloading repo: %v\n", err)
-		os.Exit(1)
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
 	}
 
-	// Load or create lock file
-	lockFile := loadLockFile()
+	target := path
+	switch {
+	case *toTOML:
+		target = convertedLockFilePath(path, true)
+	case *toJSON:
+		target = convertedLockFilePath(path, false)
+	}
+	if target == path && from == lockFileVersion {
+		infof("%s %s is already format version %d\n", colorize(colorGreen, "✓"), path, lockFileVersion)
+		return
+	}
+	if target != path {
+		if _, err := os.Stat(target); err == nil {
+			errorf("Error: %s already exists\n", target)
+			os.Exit(1)
+		}
+	}
 
-	// Add/update dependency
-	originalRef := ref
-	if originalRef == "" {
-		originalRef = resolvedRef
+	err = writeLockFileAt(target, lockFile)
+	if err != nil {
+		errorf("Error saving lock file: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	if target != path {
+		if err := os.Remove(path); err != nil {
+			errorf("Error removing %s: %v\n", path, err)
+			os.Exit(exitCodeFor(err))
+		}
+		infof("%s Converted %s to %s\n", colorize(colorGreen, "✓"), path, target)
+		return
 	}
+	infof("%s Migrated %s from format version %d to %d\n", colorize(colorGreen, "✓"), path, from, lockFileVersion)
+}
 
-	lockFile.Dependencies[repoURL] = Dependency{
-		Ref:  originalRef,
-		SHA:  sha,
-		Hash: hash,
+// handleLockMerge is a git merge driver for lock files: it merges theirs
+// into ours relative to base, writes the result to ours and exits non-zero
+// if any entry conflicts, leaving ours in place for those entries
+func handleLockMerge(args []string) {
+	if len(args) != 3 {
+		fmt.Println("Usage: deps lock-merge <base> <ours> <theirs>")
+		os.Exit(1)
 	}
 
-	// Save lock file
-	err = saveLockFile(lockFile)
+	var lockFiles [3]*LockFile
+	var isTOML bool
+	for i, path := range args {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errorf("Error: %v\n", err)
+			os.Exit(exitCodeFor(err))
+		}
+		lockFile, toml, err := parseLockData(data)
+		if err != nil {
+			errorf("Error parsing %s: %v\n", path, err)
+			os.Exit(exitCodeFor(err))
+		}
+		lockFiles[i] = lockFile
+		if i == 1 {
+			isTOML = toml
+		}
+	}
+
+	merged, conflicts := mergeLockFiles(lockFiles[0], lockFiles[1], lockFiles[2])
+
+	// Keep the format of our side, whatever the temporary file is called
+	marshal := marshalLockFile
+	if isTOML {
+		marshal = marshalTOMLLockFile
+	}
+	merged.Version = lockFileVersion
+	data, err := marshal(merged)
 	if err != nil {
-		fmt.Printf("Error saving lock file: %v\n", err)
-		os.Exit(1)
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	err = os.WriteFile(args[1], data, 0644)
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
 	}
 
-	fmt.Printf("%s Added %s@%s (%s)\n", colorize(colorGreen, "✓"), repoURL, resolvedRef, sha[:8])
+	if len(conflicts) > 0 {
+		for _, conflict := range conflicts {
+			errorf("%s %s: %s\n", colorize(colorRed, "✗"), conflict.RepoURL, conflict.Reason)
+		}
+		errorf("%d lock file conflicts; our side was kept for them - run 'deps get' to choose and then mark the file resolved\n", len(conflicts))
+		os.Exit(1)
+	}
 }
 
-func handleCheck() {
+func handleInstall(args []string) {
+	fs := flag.NewFlagSet("install", flag.ExitOnError)
+	frozen := fs.Bool("frozen", false, "fail unless .deps.lock pins and verifies every dependency")
+	soft := fs.Bool("soft", false, "only warn about dependencies whose licenses break the license policy")
+	positional := parseFlags(fs, args)
+	if len(positional) != 0 {
+		fmt.Println("Usage: deps install [--frozen] [--soft]")
+		os.Exit(1)
+	}
+	softLicensePolicy = *soft
+
 	lockFile := loadLockFile()
+	if *frozen {
+		var err error
+		lockFile, err = readLockFile()
+		if err != nil {
+			errorf("%s --frozen needs a valid .deps.lock: %v\n", colorize(colorRed, "✗"), err)
+			os.Exit(exitCodeFor(err))
+		}
+		if problems := checkFrozen(lockFile); len(problems) > 0 {
+			for _, problem := range problems {
+				errorf("%s %v\n", colorize(colorRed, "✗"), problem)
+			}
+			errorf("\n%s .deps.lock isn't frozen - run 'deps install' or 'deps update' and commit the result\n", colorize(colorRed, "✗"))
+			os.Exit(exitIntegrity)
+		}
+	}
 
 	if len(lockFile.Dependencies) == 0 {
-		fmt.Println("No dependencies found in .deps.lock")
+		infof("No dependencies found in .deps.lock\n")
+		printReport("install", true)
 		return
 	}
 
-	fmt.Printf("Checking %d dependencies:\n\n", len(lockFile.Dependencies))
+	infof("Installing %d dependencies:\n\n", len(lockFile.Dependencies))
 
-	allGood := true
-	for repoURL, dep := range lockFile.Dependencies {
-		result, err := checkDependency(repoURL, dep)
+	// Profiles install different commits in the same directories, so which
+	// one is there comes from the checksums recorded at install
+	var sums map[string]depSums
+	if len(lockFile.Profiles) > 0 {
+		var err error
+		sums, err = loadSums()
 		if err != nil {
-			fmt.Printf("%s %s: ERROR - %v\n", colorize(colorRed, "✗"), repoURL, err)
-			allGood = false
-			continue
+			errorf("Error reading %s: %v\n", sumsFilePath(), err)
+			os.Exit(exitCodeFor(err))
 		}
+	}
+	lockFileUpdated, failed := installDependencies(lockFile, func(repoURL string, dep Dependency) string {
+		if installedForOtherProfile(lockFile, repoURL, dep, sums) {
+			return "installed for another profile"
+		}
+		return ""
+	})
 
-		switch result.Status {
-		case "ok":
-			fmt.Printf("%s %s@%s (%s)\n", colorize(colorGreen, "✓"), repoURL, dep.Ref, dep.SHA[:8])
-		case "missing":
-			fmt.Printf("%s %s: MISSING - run 'deps install'\n", colorize(colorRed, "✗"), repoURL)
-			allGood = false
-		case "update_available":
-			fmt.Printf("%s %s@%s — update available (%s → %s)\n", colorize(colorYellow, "⬆"), repoURL, dep.Ref, dep.SHA[:8], result.LatestSHA[:8])
+	// A frozen install never writes the lock file, and nor does a dry run
+	if lockFileUpdated && !*frozen && !dryRun {
+		err := saveLockFile(lockFile)
+		if err != nil {
+			errorf("Error saving lock file: %v\n", err)
+			os.Exit(exitCodeFor(err))
 		}
 	}
+	exitIfInterrupted()
+	printReport("install", !failed)
 
-	if allGood {
-		fmt.Printf("\n%s All dependencies are up to date\n", colorize(colorGreen, "✓"))
-	} else {
-		fmt.Printf("\n%s Some dependencies need attention\n", colorize(colorRed, "✗"))
+	if failed {
+		errorf("\n%s Installation failed\n", colorize(colorRed, "✗"))
+		setExitCode(exitUsage)
+		exitWithCode()
 	}
-}
-
-func handleInstall() {
-	lockFile := loadLockFile()
-
-	if len(lockFile.Dependencies) == 0 {
-		fmt.Println("No dependencies found in .deps.lock")
+	if dryRun {
+		infof("\nDry run: nothing downloaded and %s unchanged\n", lockFilePath())
 		return
 	}
+	infof("\n%s Installation complete\n", colorize(colorGreen, "✓"))
+}
 
-	fmt.Printf("Installing %d dependencies:\n\n", len(lockFile.Dependencies))
-
-	lockFileUpdated := false
+// installDependencies installs the dependencies of lockFile that aren't
+// installed, and those that are but for which reinstall gives a reason,
+// reporting whether the lock file gained hashes and whether any failed.
+// Installed directories are otherwise trusted as they are, except that
+// those whose submodules resolve to other commits are reinstalled.
+func installDependencies(lockFile *LockFile, reinstall func(repoURL string, dep Dependency) string) (lockFileUpdated, failed bool) {
+	resolved, err := planSubmodules(lockFile)
+	if err != nil {
+		errorf("%s %v\n", colorize(colorRed, "✗"), err)
+		setExitCode(exitCodeFor(err))
+		return false, true
+	}
+	lockFileUpdated = len(resolved) > 0
 
-	for repoURL, dep := range lockFile.Dependencies {
+	var pending []pendingResult
+	for _, repoURL := range sortedKeys(lockFile.Dependencies) {
+		dep := lockFile.Dependencies[repoURL]
+		// The tree hash covers the submodules, now from other commits
+		if _, changed := resolved[repoURL]; changed {
+			dep.TreeHash = ""
+			lockFile.Dependencies[repoURL] = dep
+		}
+		result := resultFor(repoURL, dep, resultInstalled)
 		// Use a lightweight check (directory existence only) for install
 		depPath := getDepPath(repoURL)
 		if _, err := os.Stat(depPath); err == nil {
-			fmt.Printf("%s %s@%s (%s) - already installed\n", colorize(colorGreen, "✓"), repoURL, dep.Ref, dep.SHA[:8])
+			reason := reinstall(repoURL, dep)
+			if reason == "" {
+				reason = resolved[repoURL]
+			}
+			if reason == "" {
+				infof("%s %s - already installed\n", colorize(colorGreen, "✓"), describeDep(repoURL, dep))
+				recordResult(resultFor(repoURL, dep, resultAlreadyInstalled))
+				continue
+			}
+			result.Reason = reason
+			if dryRun {
+				infof("Would reinstall %s: %s\n", repoURL, reason)
+				continue
+			}
+			infof("Reinstalling %s: %s\n", repoURL, reason)
+			if err := os.RemoveAll(depPath); err != nil {
+				errorf("%s Error removing %s: %v\n", colorize(colorRed, "✗"), depPath, err)
+				result.Status, result.Error = resultError, err.Error()
+				recordResult(result)
+				failed = true
+				continue
+			}
+		}
+
+		if dryRun {
+			infof("Would download %s into %s\n", describeDep(repoURL, dep), depPath)
 			continue
 		}
+		pending = append(pending, pendingResult{repoURL: repoURL, dep: dep, result: result})
+	}
 
-		fmt.Printf("Installing %s@%s (%s)...\n", repoURL, dep.Ref, dep.SHA[:8])
+	// Download and extract on up to installJobs at once, then record the
+	// outcomes in order
+	installPending(pending, func(p *pendingResult) {
+		infof("Installing %s...\n", describeDep(p.repoURL, p.dep))
+		p.installed, p.err = installDependency(p.repoURL, p.dep)
 
-		owner, repo, err := parseGitHubURL(repoURL)
-		if err != nil {
-			fmt.Printf("%s Error parsing URL %s: %v\n", colorize(colorRed, "✗"), repoURL, err)
-			continue
+		var mismatch *checksumError
+		switch {
+		case errors.As(p.err, &mismatch):
+			errorf("%s %s: %v - the download doesn't match .deps.lock and was removed\n", colorize(colorRed, "✗"), p.repoURL, p.err)
+		case p.err != nil:
+			errorf("%s Error downloading %s: %v\n", colorize(colorRed, "✗"), p.repoURL, p.err)
+		default:
+			infof("%s Installed %s\n", colorize(colorGreen, "✓"), describeDep(p.repoURL, p.installed))
 		}
+	})
 
-		hash, err := downloadRepo(owner, repo, dep.SHA, repoURL)
-		if err != nil {
-			fmt.Printf("%s Error downloading %s: %v\n", colorize(colorRed, "✗"), repoURL, err)
+	for _, p := range pending {
+		if !p.done {
+			continue
+		}
+		result := p.result
+		if p.err != nil {
+			result.Status, result.Error = resultError, p.err.Error()
+			recordResult(result)
+			setExitCode(exitCodeFor(p.err))
+			failed = true
 			continue
 		}
 
-		// Verify hash if one is recorded in the lock file
-		if dep.Hash != "" {
-			if hash != dep.Hash {
-				// Hash mismatch — remove the downloaded content
-				os.RemoveAll(depPath)
-				fmt.Printf("%s %s: hash mismatch (expected %s, got %s)\n", colorize(colorRed, "✗"), repoURL, dep.Hash[:12], hash[:12])
-				continue
-			}
-		} else {
-			// No hash in lock file — record the one we just computed
-			dep.Hash = hash
-			lockFile.Dependencies[repoURL] = dep
+		// Record any hashes the lock file didn't have yet
+		if p.installed.Hash != p.dep.Hash || p.installed.TreeHash != p.dep.TreeHash {
+			lockFile.Dependencies[p.repoURL] = p.installed
 			lockFileUpdated = true
 		}
+		recordResult(result)
+	}
+	return lockFileUpdated, failed
+}
+
+// pendingResult is a dependency installDependencies installs, and how that
+// went
+type pendingResult struct {
+	repoURL   string
+	dep       Dependency
+	result    depResult
+	installed Dependency
+	err       error
+	done      bool // the install was started, and not skipped once interrupted
+}
 
-		fmt.Printf("%s Installed %s@%s (%s)\n", colorize(colorGreen, "✓"), repoURL, dep.Ref, dep.SHA[:8])
+// installPending calls install for each of pending, several at once as
+// runJobs does, and marks those it was called for as done
+func installPending(pending []pendingResult, install func(p *pendingResult)) {
+	paths := make([]string, len(pending))
+	for i, p := range pending {
+		paths[i] = getDepPath(p.repoURL)
 	}
+	runJobs(installJobs, installGroups(paths), func(i int) {
+		install(&pending[i])
+		pending[i].done = true
+	})
+}
 
-	if lockFileUpdated {
-		err := saveLockFile(lockFile)
-		if err != nil {
-			fmt.Printf("Error saving lock file: %v\n", err)
-			os.Exit(1)
+// reinstallResolved reinstalls the installed dependencies, other than
+// except, whose submodules planSubmodules moved to other commits. Failures
+// are reported and leave the dependency uninstalled.
+func reinstallResolved(lockFile *LockFile, resolved map[string]string, except string) {
+	var pending []pendingResult
+	for _, repoURL := range sortedKeys(lockFile.Dependencies) {
+		reason, changed := resolved[repoURL]
+		if !changed || repoURL == except {
+			continue
+		}
+		// The tree hash covers the submodules, now from other commits
+		dep := lockFile.Dependencies[repoURL]
+		dep.TreeHash = ""
+		lockFile.Dependencies[repoURL] = dep
+		depPath := getDepPath(repoURL)
+		if _, err := os.Stat(depPath); err != nil {
+			continue
+		}
+
+		infof("Reinstalling %s: %s\n", repoURL, reason)
+		if err := os.RemoveAll(depPath); err != nil {
+			errorf("%s Error removing %s: %v\n", colorize(colorRed, "✗"), depPath, err)
+			continue
 		}
+		pending = append(pending, pendingResult{repoURL: repoURL, dep: dep})
 	}
 
-	fmt.Printf("\n%s Installation complete\n", colorize(colorGreen, "✓"))
+	installPending(pending, func(p *pendingResult) {
+		p.installed, p.err = installDependency(p.repoURL, p.dep)
+		if p.err != nil {
+			errorf("%s Error downloading %s: %v\n", colorize(colorRed, "✗"), p.repoURL, p.err)
+		}
+	})
+
+	for _, p := range pending {
+		switch {
+		case p.err != nil:
+			setExitCode(exitCodeFor(p.err))
+		case p.done:
+			lockFile.Dependencies[p.repoURL] = p.installed
+		}
+	}
 }
 
-func handleUpdate(specificRepo string) {
+func handleUpdate(args []string) {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	followRenames := fs.Bool("follow-renames", false, "rewrite renamed repos without asking")
+	patch := fs.Bool(updatePatch, false, "move tag-pinned dependencies to newer patch versions")
+	minor := fs.Bool(updateMinor, false, "move tag-pinned dependencies to newer minor versions")
+	major := fs.Bool(updateMajor, false, "move tag-pinned dependencies to any newer version")
+	interactive := fs.Bool("interactive", false, "choose which available updates to apply")
+	positional := parseFlags(fs, args)
+	if len(positional) > 1 {
+		fmt.Println("Usage: deps update [--dry-run|--interactive] [--follow-renames] [--patch|--minor|--major] [github.com/user/repo]")
+		os.Exit(1)
+	}
+	if *interactive && (dryRun || len(positional) == 1) {
+		errorf("Error: --interactive updates all dependencies and can't be combined with --dry-run\n")
+		os.Exit(1)
+	}
+	if *interactive && jsonOutput {
+		errorf("Error: --interactive can't be combined with --json\n")
+		os.Exit(1)
+	}
+	if *interactive && !isInteractive() {
+		errorf("Error: --interactive needs a terminal\n")
+		os.Exit(1)
+	}
+
+	level := ""
+	levels := 0
+	if *patch {
+		level, levels = updatePatch, levels+1
+	}
+	if *minor {
+		level, levels = updateMinor, levels+1
+	}
+	if *major {
+		level, levels = updateMajor, levels+1
+	}
+	if levels > 1 {
+		errorf("Error: only one of --patch, --minor and --major may be given\n")
+		os.Exit(1)
+	}
+
 	lockFile := loadLockFile()
 
 	if len(lockFile.Dependencies) == 0 {
-		fmt.Println("No dependencies found in .deps.lock")
+		infof("No dependencies found in .deps.lock\n")
+		printReport("update", true)
 		return
 	}
 
+	acceptRename := func(newURL string) bool {
+		if dryRun {
+			return false
+		}
+		return *followRenames || confirm(fmt.Sprintf("Rewrite lock entry to %s?", newURL))
+	}
+
 	updated := false
 
-	if specificRepo != "" {
+	if len(positional) == 1 {
 		// Update specific repo
-		dep, exists := lockFile.Dependencies[specificRepo]
-		if !exists {
-			fmt.Printf("Dependency %s not found in .deps.lock\n", specificRepo)
+		specificRepo := resolveAlias(lockFile, positional[0])
+		if _, exists := lockFile.Dependencies[specificRepo]; !exists {
+			errorf("Dependency %s not found in .deps.lock\n", specificRepo)
 			os.Exit(1)
 		}
-		updated = updateDependency(specificRepo, dep, lockFile)
+		repoURL, renamed := followRename(specificRepo, lockFile, acceptRename)
+		updated = updateDependency(repoURL, lockFile.Dependencies[repoURL], lockFile, level, dryRun) || renamed
 	} else {
 		// Update all dependencies
-		fmt.Printf("Checking for updates to %d dependencies:\n\n", len(lockFile.Dependencies))
-		for repoURL, dep := range lockFile.Dependencies {
-			if updateDependency(repoURL, dep, lockFile) {
+		infof("Checking for updates to %d dependencies:\n\n", len(lockFile.Dependencies))
+		prefetchRefs(lockFile)
+
+		// Look up renames and resolve refs several at once, then go through
+		// the results in order
+		repoURLs := sortedKeys(lockFile.Dependencies)
+		renames := make([]string, len(repoURLs))
+		resolutions := make([]refResolution, len(repoURLs))
+		runJobs(resolveJobs, separateGroups(len(repoURLs)), func(i int) {
+			dep := lockFile.Dependencies[repoURLs[i]]
+			renames[i] = renamedKey(repoURLs[i], dep)
+			resolutions[i] = resolveUpdateOf(repoURLs[i], dep, level)
+		})
+
+		var available []availableUpdate
+		for i, repoURL := range repoURLs {
+			if runContext.Err() != nil {
+				// Keep the updates that completed before the interruption
+				break
+			}
+			repoURL, renamed := applyRename(repoURL, renames[i], lockFile, acceptRename)
+			updated = updated || renamed
+			update, ok := reportUpdate(repoURL, lockFile.Dependencies[repoURL], level, resolutions[i])
+			switch {
+			case !ok:
+			case *interactive:
+				available = append(available, update)
+			case dryRun || applyUpdate(update, lockFile):
 				updated = true
 			}
 		}
-		if !updated {
-			fmt.Printf("\n%s All dependencies are up to date\n", colorize(colorGreen, "✓"))
+		if len(available) > 0 && runContext.Err() == nil {
+			infof("\n")
+			chosen, err := chooseUpdates(available)
+			if err != nil {
+				errorf("Error: %v\n", err)
+				os.Exit(exitCodeFor(err))
+			}
+			if len(chosen) == 0 {
+				infof("No updates selected\n")
+			}
+			for _, update := range chosen {
+				if applyUpdate(update, lockFile) {
+					updated = true
+				}
+				if runContext.Err() != nil {
+					break
+				}
+			}
+		}
+		if !updated && len(available) == 0 {
+			infof("\n%s All dependencies are up to date\n", colorize(colorGreen, "✓"))
+		}
+	}
+
+	if dryRun {
+		if updated {
+			warnf("\n%s Updates available; dry run, nothing downloaded and .deps.lock unchanged\n", colorize(colorYellow, "⬆"))
 		}
+		exitIfInterrupted()
+		printReport("update", !resultsFailed())
+		exitWithCode()
+		return
 	}
 
 	// Only save lock file if something was actually updated
 	if updated {
 		err := saveLockFile(lockFile)
 		if err != nil {
-			fmt.Printf("Error saving lock file: %v\n", err)
-			os.Exit(1)
+			errorf("Error saving lock file: %v\n", err)
+			os.Exit(exitCodeFor(err))
 		}
 	}
+	exitIfInterrupted()
+	printReport("update", !resultsFailed())
+	exitWithCode()
 }
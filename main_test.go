@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// --- extractGlobalFlags tests ---
+
+// resetGlobalOptions clears globalOptions for the duration of a test
+func resetGlobalOptions(t *testing.T) {
+	t.Helper()
+	orig := globalOptions
+	globalOptions = options{}
+	t.Cleanup(func() { globalOptions = orig })
+}
+
+func TestExtractGlobalFlags(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		wantRest     []string
+		wantCABundle string
+		wantInsecure bool
+	}{
+		{"no flags", []string{"install"}, []string{"install"}, "", false},
+		{"before command", []string{"--insecure-skip-verify", "install"}, []string{"install"}, "", true},
+		{"after command", []string{"install", "--ca-bundle", "ca.pem"}, []string{"install"}, "ca.pem", false},
+		{"equals form", []string{"--ca-bundle=ca.pem", "check"}, []string{"check"}, "ca.pem", false},
+		{"command flags kept", []string{"get", "--ssh", "github.com/user/repo"}, []string{"get", "--ssh", "github.com/user/repo"}, "", false},
+		{"stops at terminator", []string{"get", "--", "--insecure-skip-verify"}, []string{"get", "--", "--insecure-skip-verify"}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetGlobalOptions(t)
+
+			rest, err := extractGlobalFlags(tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(rest, tt.wantRest) {
+				t.Errorf("rest = %q, want %q", rest, tt.wantRest)
+			}
+			if globalOptions.CABundle != tt.wantCABundle {
+				t.Errorf("CABundle = %q, want %q", globalOptions.CABundle, tt.wantCABundle)
+			}
+			if globalOptions.InsecureSkipVerify != tt.wantInsecure {
+				t.Errorf("InsecureSkipVerify = %v, want %v", globalOptions.InsecureSkipVerify, tt.wantInsecure)
+			}
+		})
+	}
+}
+
+func TestExtractGlobalFlags_MissingValue(t *testing.T) {
+	resetGlobalOptions(t)
+
+	_, err := extractGlobalFlags([]string{"install", "--ca-bundle"})
+	if err == nil {
+		t.Error("expected error for missing flag value, got nil")
+	}
+}
+
+// --- chooseRef tests ---
+
+func TestChooseRef(t *testing.T) {
+	tags := []tagInfo{{Name: "v1.2.0"}, {Name: "v1.1.0"}}
+	branches := []tagInfo{{Name: "main"}, {Name: "develop"}}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"\n", ""},
+		{"0\n", ""},
+		{"1\n", "v1.2.0"},
+		{"4\n", "develop"},
+		{"feature/foo\n", "feature/foo"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		got, err := chooseRef(strings.NewReader(tt.input), &out, tags, branches)
+		if err != nil {
+			t.Fatalf("chooseRef(%q) error: %v", tt.input, err)
+		}
+		if got != tt.want {
+			t.Errorf("chooseRef(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+		if !strings.Contains(out.String(), "3) main") {
+			t.Errorf("menu missing branches:\n%s", out.String())
+		}
+	}
+
+	for _, input := range []string{"9\n", "00\n", "-1\n"} {
+		if _, err := chooseRef(strings.NewReader(input), &bytes.Buffer{}, tags, branches); err == nil {
+			t.Errorf("chooseRef(%q): expected error for out of range choice, got nil", input)
+		}
+	}
+}
+
+func TestChooseRef_LimitsChoices(t *testing.T) {
+	var tags []tagInfo
+	for i := 0; i < maxRefChoices+5; i++ {
+		tags = append(tags, tagInfo{Name: "v1.0." + string(rune('a'+i))})
+	}
+
+	var out bytes.Buffer
+	if _, err := chooseRef(strings.NewReader("\n"), &out, tags, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "... 5 more") {
+		t.Errorf("expected truncated menu, got:\n%s", out.String())
+	}
+}
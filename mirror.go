@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// mirrorRule rewrites fetch URLs whose host and path start with From so they
+// start with To instead, keeping the original scheme unless To includes one.
+type mirrorRule struct {
+	From string
+	To   string
+}
+
+// parseMirrorRules parses "from=to" rules, each entry optionally holding
+// several comma-separated rules as used by DEPS_MIRRORS
+func parseMirrorRules(specs []string) ([]mirrorRule, error) {
+	var rules []mirrorRule
+	for _, spec := range specs {
+		for _, entry := range strings.Split(spec, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			from, to, ok := strings.Cut(entry, "=")
+			from = strings.TrimSuffix(strings.TrimSpace(from), "/")
+			to = strings.TrimSuffix(strings.TrimSpace(to), "/")
+			if !ok || from == "" || to == "" {
+				return nil, fmt.Errorf("invalid mirror %q (expected from=to)", entry)
+			}
+			rules = append(rules, mirrorRule{From: from, To: to})
+		}
+	}
+	return rules, nil
+}
+
+// rewriteURL applies the first matching rule to u, or returns u if none match
+func rewriteURL(rules []mirrorRule, u *url.URL) (*url.URL, error) {
+	hostPath := u.Host + u.Path
+	for _, rule := range rules {
+		if hostPath != rule.From && !strings.HasPrefix(hostPath, rule.From+"/") {
+			continue
+		}
+
+		target := rule.To
+		if !strings.Contains(target, "://") {
+			target = u.Scheme + "://" + target
+		}
+		rewritten, err := url.Parse(target + strings.TrimPrefix(hostPath, rule.From))
+		if err != nil {
+			return nil, fmt.Errorf("invalid mirror target %q: %v", rule.To, err)
+		}
+		rewritten.RawQuery = u.RawQuery
+		return rewritten, nil
+	}
+	return u, nil
+}
+
+// mirrorRules are the rules configureMirrors set up, which SSH remotes, not
+// fetched over httpClient, apply themselves
+var mirrorRules []mirrorRule
+
+// mirrorTransport rewrites request URLs according to mirror rules before
+// handing them to the underlying transport
+type mirrorTransport struct {
+	rules []mirrorRule
+	base  http.RoundTripper
+}
+
+func (t *mirrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, err := rewriteURL(t.rules, req.URL)
+	if err != nil {
+		return nil, err
+	}
+	if u != req.URL {
+		req = req.Clone(req.Context())
+		req.URL = u
+		req.Host = u.Host
+	}
+	return t.base.RoundTrip(req)
+}
+
+// configureMirrors wraps httpClient so fetches go to mirrors instead of the
+// canonical hosts. The lock file keeps canonical URLs. Rules from the mirrors
+// setting (or DEPS_MIRRORS) apply after those given on the command line.
+func configureMirrors(specs []string) error {
+	if value := configValue("mirrors"); value != "" {
+		specs = append(specs, value)
+	}
+	rules, err := parseMirrorRules(specs)
+	if err != nil {
+		return err
+	}
+	mirrorRules = rules
+	if len(rules) == 0 {
+		return nil
+	}
+
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client := *httpClient
+	client.Transport = &mirrorTransport{rules: rules, base: base}
+	httpClient = &client
+	return nil
+}
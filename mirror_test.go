@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// --- parseMirrorRules tests ---
+
+func TestParseMirrorRules(t *testing.T) {
+	rules, err := parseMirrorRules([]string{
+		"api.github.com=artifactory.mycorp.com/github-remote/",
+		"a.example.com=b.example.com, c.example.com=http://d.example.com",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []mirrorRule{
+		{From: "api.github.com", To: "artifactory.mycorp.com/github-remote"},
+		{From: "a.example.com", To: "b.example.com"},
+		{From: "c.example.com", To: "http://d.example.com"},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("got %d rules, want %d", len(rules), len(want))
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, rules[i], want[i])
+		}
+	}
+}
+
+func TestParseMirrorRules_Invalid(t *testing.T) {
+	tests := []string{"no-equals", "=to", "from="}
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			if _, err := parseMirrorRules([]string{input}); err == nil {
+				t.Errorf("expected error for %q, got nil", input)
+			}
+		})
+	}
+}
+
+// --- rewriteURL tests ---
+
+func TestRewriteURL(t *testing.T) {
+	rules := []mirrorRule{
+		{From: "api.github.com", To: "artifactory.mycorp.com/github-remote"},
+		{From: "example.com/prefix", To: "http://mirror.local"},
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"https://api.github.com/repos/user/repo/tarball/abc", "https://artifactory.mycorp.com/github-remote/repos/user/repo/tarball/abc"},
+		{"https://api.github.com/repos/user/repo?page=2", "https://artifactory.mycorp.com/github-remote/repos/user/repo?page=2"},
+		{"https://example.com/prefix/file", "http://mirror.local/file"},
+		{"https://example.com/prefixed/file", "https://example.com/prefixed/file"},
+		{"https://api.github.com.evil.com/repos", "https://api.github.com.evil.com/repos"},
+		{"https://other.com/repos", "https://other.com/repos"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			u, _ := url.Parse(tt.input)
+			got, err := rewriteURL(rules, u)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("rewriteURL(%q) = %q, want %q", tt.input, got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigureMirrors_RewritesRequests(t *testing.T) {
+	restoreHTTPClient(t)
+	t.Setenv("DEPS_MIRRORS", "")
+
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+	}))
+	defer srv.Close()
+
+	httpClient = srv.Client()
+	mirror := strings.TrimPrefix(srv.URL, "http://") + "/github-remote"
+	if err := configureMirrors([]string{"api.github.com=" + mirror}); err != nil {
+		t.Fatalf("configureMirrors error: %v", err)
+	}
+
+	resp, err := httpClient.Get("http://api.github.com/repos/user/repo")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if gotPath != "/github-remote/repos/user/repo" {
+		t.Errorf("mirror received path %q, want %q", gotPath, "/github-remote/repos/user/repo")
+	}
+}
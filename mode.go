@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A project either leaves .deps out of version control, and reinstalls it
+// from the lock file, or commits it, so a checkout builds without deps. The
+// mode setting makes the choice explicit: in ignored mode deps keeps .deps
+// in .gitignore, and in vendored mode it keeps it out, installs plain files
+// rather than links into the user's store, and deps check fails unless
+// .deps holds exactly what the lock file locks. Without the setting nothing
+// is managed, as before. deps mode switches between them.
+
+// Settings of mode
+const (
+	modeIgnored  = "ignored"
+	modeVendored = "vendored"
+)
+
+func validateMode(mode string) error {
+	if mode != modeIgnored && mode != modeVendored {
+		return fmt.Errorf("invalid mode %q (expected ignored or vendored)", mode)
+	}
+	return nil
+}
+
+// projectMode returns the mode setting (or DEPS_MODE), or "" if the project
+// hasn't chosen one
+func projectMode() string {
+	return configValue("mode")
+}
+
+// gitignoreOnce makes ensureGitignored check .gitignore once per command,
+// however many dependencies are installed
+var gitignoreOnce sync.Once
+
+// ensureGitignored adds .deps to .gitignore in ignored mode, before anything
+// is installed there
+func ensureGitignored() {
+	gitignoreOnce.Do(func() {
+		if projectMode() != modeIgnored || gitignoreHasDeps() {
+			return
+		}
+		if err := addDepsToGitignore(); err != nil {
+			warnf("Warning: couldn't add %s/ to .gitignore: %v\n", filepath.ToSlash(depsDir), err)
+			return
+		}
+		infof("Added %s/ to .gitignore\n", filepath.ToSlash(depsDir))
+	})
+}
+
+// removeDepsFromGitignore removes the lines of .gitignore that ignore .deps,
+// as gitignoreHasDeps recognizes them, reporting whether there were any
+func removeDepsFromGitignore() (bool, error) {
+	data, err := os.ReadFile(".gitignore")
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	dir := filepath.ToSlash(depsDir)
+	var kept []string
+	removed := false
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		switch strings.TrimSpace(line) {
+		case dir, dir + "/", "/" + dir, "/" + dir + "/":
+			removed = true
+		default:
+			kept = append(kept, line)
+		}
+	}
+	if !removed {
+		return false, nil
+	}
+	return true, os.WriteFile(".gitignore", []byte(strings.Join(kept, "")), 0644)
+}
+
+// unlinkFromStore replaces depPath, a link into the store, with a copy of
+// the files it links to, which can be committed
+func unlinkFromStore(depPath string) error {
+	src := resolveInstallDir(depPath)
+	if src == depPath {
+		return nil
+	}
+	tmp, err := makeExtractDir(depPath)
+	if err != nil {
+		return err
+	}
+	defer removeTemp(tmp)
+	if err := linkTree(src, tmp, false); err != nil {
+		return err
+	}
+	return replaceDir(tmp, depPath)
+}
+
+// vendoredProblems is what deps check reports in vendored mode besides the
+// dependencies themselves: paths in .deps the lock file doesn't reference,
+// which would be committed too, and .gitignore keeping .deps out
+func vendoredProblems(lockFile *LockFile) ([]string, error) {
+	var problems []string
+	unreferenced, err := findUnreferenced(lockFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range unreferenced {
+		problems = append(problems, fmt.Sprintf("%s isn't in the lock file - run 'deps prune'", filepath.ToSlash(path)))
+	}
+	if gitignoreHasDeps() {
+		problems = append(problems, fmt.Sprintf(".gitignore ignores %s/, so it isn't committed - run 'deps mode vendored'", filepath.ToSlash(depsDir)))
+	}
+	return problems, nil
+}
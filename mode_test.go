@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestEnsureGitignored(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	defer func() { gitignoreOnce = sync.Once{} }()
+
+	gitignoreOnce = sync.Once{}
+	captureOutput(t, ensureGitignored)
+	if _, err := os.Stat(".gitignore"); !os.IsNotExist(err) {
+		t.Fatalf("without a mode .gitignore should be left alone: %v", err)
+	}
+
+	t.Setenv("DEPS_MODE", modeIgnored)
+	gitignoreOnce = sync.Once{}
+	os.WriteFile(".gitignore", []byte("bin/"), 0644)
+	captureOutput(t, ensureGitignored)
+	captureOutput(t, ensureGitignored)
+	if data, _ := os.ReadFile(".gitignore"); string(data) != "bin/\n.deps/\n" {
+		t.Errorf(".gitignore = %q", data)
+	}
+}
+
+func TestRemoveDepsFromGitignore(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	if removed, err := removeDepsFromGitignore(); removed || err != nil {
+		t.Errorf("without .gitignore: %v, %v", removed, err)
+	}
+	os.WriteFile(".gitignore", []byte("bin/\n/.deps/\n# keep\n.deps\n*.log"), 0644)
+	removed, err := removeDepsFromGitignore()
+	if !removed || err != nil {
+		t.Fatalf("removed = %v, %v", removed, err)
+	}
+	if data, _ := os.ReadFile(".gitignore"); string(data) != "bin/\n# keep\n*.log" {
+		t.Errorf(".gitignore = %q", data)
+	}
+	if gitignoreHasDeps() {
+		t.Error(".deps is still ignored")
+	}
+}
+
+func TestVendoredProblems(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	lockFile := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/user/repo": {Ref: "main", SHA: "1111111111111111111111111111111111111111"},
+	}}
+	writeTree(t, filepath.Join(".deps", "github.com", "user", "repo"), map[string]string{"a.txt": "a"})
+	if problems, err := vendoredProblems(lockFile); err != nil || len(problems) != 0 {
+		t.Errorf("problems = %q, %v", problems, err)
+	}
+
+	writeTree(t, filepath.Join(".deps", "github.com", "user", "old"), map[string]string{"a.txt": "a"})
+	os.WriteFile(".gitignore", []byte(".deps/\n"), 0644)
+	if problems, err := vendoredProblems(lockFile); err != nil || len(problems) != 2 {
+		t.Errorf("problems = %q, %v; want the unreferenced path and .gitignore", problems, err)
+	}
+}
+
+func TestUseStore_Vendored(t *testing.T) {
+	defer func() { contentStore = false }()
+	contentStore = true
+	if !useStore(Dependency{}) {
+		t.Fatal("the store should be used")
+	}
+	t.Setenv("DEPS_MODE", modeVendored)
+	if useStore(Dependency{}) {
+		t.Error("vendored dependencies shouldn't be links into the store")
+	}
+}
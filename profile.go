@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+)
+
+// activeProfile is the profile given with --profile or the profile setting
+var activeProfile string
+
+// configureProfile makes commands use the overrides of the named profile, or
+// of the profile setting (or DEPS_PROFILE) when name is empty
+func configureProfile(name string) {
+	if name == "" {
+		name = configValue("profile")
+	}
+	activeProfile = name
+}
+
+// ProfileOverride replaces a dependency while its profile is active. It is a
+// complete lock entry, optionally fetched from another repository such as a
+// fork; either way it is installed where the entry it replaces would be.
+type ProfileOverride struct {
+	Repo string `json:"repo,omitempty"`
+	Dependency
+}
+
+// profileError is returned for a profile the lock file doesn't define
+type profileError struct {
+	Name string
+}
+
+func (e *profileError) Error() string {
+	return fmt.Sprintf("the lock file has no profile %q", e.Name)
+}
+
+// appliedProfile records how applyProfile changed a lock file, so that
+// saving it can put every entry back where it came from
+type appliedProfile struct {
+	name string
+	// overridden maps the key each override is locked under to the key of
+	// the entry it replaces
+	overridden map[string]string
+	// bases holds the replaced entries by their own key
+	bases map[string]Dependency
+}
+
+// applyProfile replaces the dependencies of lockFile with the overrides of
+// the named profile, so every command resolves, installs and updates them
+// instead. An override with a repo is locked under that URL.
+func applyProfile(lockFile *LockFile, name string) error {
+	if name == "" {
+		return nil
+	}
+	overrides, exists := lockFile.Profiles[name]
+	if !exists {
+		return &profileError{Name: name}
+	}
+
+	applied := &appliedProfile{name: name, overridden: make(map[string]string), bases: make(map[string]Dependency)}
+	for baseKey, override := range overrides {
+		if _, exists := lockFile.Dependencies[baseKey]; !exists {
+			return fmt.Errorf("profile %s overrides %s, which isn't in the lock file", name, baseKey)
+		}
+		key := baseKey
+		if override.Repo != "" {
+			key = override.Repo
+		}
+		if _, exists := lockFile.Dependencies[key]; exists && key != baseKey {
+			return fmt.Errorf("profile %s replaces %s with %s, which is already in the lock file", name, baseKey, key)
+		}
+		if other, exists := applied.overridden[key]; exists {
+			return fmt.Errorf("profile %s replaces both %s and %s with %s", name, other, baseKey, key)
+		}
+		applied.overridden[key] = baseKey
+	}
+
+	for _, baseKey := range applied.overridden {
+		applied.bases[baseKey] = lockFile.Dependencies[baseKey]
+		delete(lockFile.Dependencies, baseKey)
+	}
+	for key, baseKey := range applied.overridden {
+		dep := overrides[baseKey].Dependency
+		dep.Alias = applied.bases[baseKey].Alias
+		lockFile.Dependencies[key] = dep
+	}
+	lockFile.profile = applied
+	return nil
+}
+
+// overrideInProfile makes key, locked or about to be, an override in the
+// active profile of the entry at replaces (usually key itself), so that
+// saving lockFile records it in the profile instead of the entry
+func overrideInProfile(lockFile *LockFile, key, replaces string) error {
+	applied := lockFile.profile
+	if applied == nil {
+		return fmt.Errorf("no profile is active (use --profile)")
+	}
+	if baseKey, exists := applied.overridden[key]; exists && baseKey == replaces {
+		return nil
+	}
+
+	base, exists := lockFile.Dependencies[replaces]
+	if _, overridden := applied.overridden[replaces]; !exists || overridden {
+		return fmt.Errorf("%s isn't an entry of the lock file that profile %s can override", replaces, applied.name)
+	}
+	if _, exists := lockFile.Dependencies[key]; exists && key != replaces {
+		return fmt.Errorf("%s is already in the lock file", key)
+	}
+	applied.overridden[key] = replaces
+	applied.bases[replaces] = base
+	if key != replaces {
+		delete(lockFile.Dependencies, replaces)
+	}
+	registerAliases(lockFile)
+	return nil
+}
+
+// unapplyProfile returns a copy of lockFile with the overrides of the active
+// profile moved back into its profiles and the entries they replaced
+// restored. Overrides that were removed take the entry they replaced with
+// them.
+func unapplyProfile(lockFile *LockFile) *LockFile {
+	applied := lockFile.profile
+	if applied == nil {
+		return lockFile
+	}
+
+	saved := *lockFile
+	saved.profile = nil
+	saved.Dependencies = make(map[string]Dependency, len(lockFile.Dependencies))
+	for key, dep := range lockFile.Dependencies {
+		saved.Dependencies[key] = dep
+	}
+	saved.Profiles = make(map[string]map[string]ProfileOverride, len(lockFile.Profiles))
+	for name, overrides := range lockFile.Profiles {
+		saved.Profiles[name] = overrides
+	}
+
+	overrides := make(map[string]ProfileOverride)
+	for key, baseKey := range applied.overridden {
+		dep, exists := saved.Dependencies[key]
+		if !exists {
+			continue
+		}
+		base := applied.bases[baseKey]
+		base.Alias = dep.Alias
+		delete(saved.Dependencies, key)
+		saved.Dependencies[baseKey] = base
+
+		override := ProfileOverride{Dependency: dep}
+		override.Alias = ""
+		if key != baseKey {
+			override.Repo = key
+		}
+		overrides[baseKey] = override
+	}
+	saved.Profiles[applied.name] = overrides
+	if len(overrides) == 0 {
+		delete(saved.Profiles, applied.name)
+	}
+	return &saved
+}
+
+// profileBaseKey returns the key of the entry that the entry at key replaces
+// in the active profile, or key itself
+func profileBaseKey(lockFile *LockFile, key string) string {
+	if lockFile.profile != nil {
+		if baseKey, exists := lockFile.profile.overridden[key]; exists {
+			return baseKey
+		}
+	}
+	return key
+}
+
+// sharedInstallKeys returns the other keys that the entry at key is locked
+// under in some profile, and whether any profile overrides it at all. They
+// all install into the same directory.
+func sharedInstallKeys(lockFile *LockFile, key string) ([]string, bool) {
+	baseKey := profileBaseKey(lockFile, key)
+	overridden := baseKey != key
+	var keys []string
+	if baseKey != key {
+		keys = append(keys, baseKey)
+	}
+	for _, overrides := range lockFile.Profiles {
+		override, exists := overrides[baseKey]
+		if !exists {
+			continue
+		}
+		overridden = true
+		if override.Repo != "" && override.Repo != key {
+			keys = append(keys, override.Repo)
+		}
+	}
+	return keys, overridden
+}
+
+// installedForOtherProfile reports whether the directory of an entry that
+// profiles override may hold another profile's version of it. .deps.sums
+// says which commit was last installed there under which key.
+func installedForOtherProfile(lockFile *LockFile, key string, dep Dependency, sums map[string]depSums) bool {
+	if _, overridden := sharedInstallKeys(lockFile, key); !overridden {
+		return false
+	}
+	recorded, exists := sums[key]
+	return !exists || recorded.SHA != dep.SHA
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testProfileLock = `{
+  "version": 1,
+  "dependencies": {
+    "github.com/user/lib": {"ref": "v1.0.0", "sha": "1111111111111111111111111111111111111111", "alias": "lib"},
+    "github.com/user/tool": {"ref": "main", "sha": "2222222222222222222222222222222222222222"},
+    "github.com/user/other": {"ref": "main", "sha": "3333333333333333333333333333333333333333"}
+  },
+  "profiles": {
+    "staging": {
+      "github.com/user/lib": {"ref": "v2.0.0-rc1", "sha": "4444444444444444444444444444444444444444"},
+      "github.com/user/tool": {"repo": "github.com/me/tool", "ref": "fix", "sha": "5555555555555555555555555555555555555555"}
+    }
+  }
+}
+`
+
+func TestApplyProfile(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	defer func() { activeProfile = ""; depAliases = make(map[string]string) }()
+	os.WriteFile(".deps.lock", []byte(testProfileLock), 0644)
+
+	activeProfile = "staging"
+	lockFile, err := readLockFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dep := lockFile.Dependencies["github.com/user/lib"]; dep.Ref != "v2.0.0-rc1" || dep.Alias != "lib" {
+		t.Errorf("lib = %+v, want the override with the entry's alias", dep)
+	}
+	if _, exists := lockFile.Dependencies["github.com/user/tool"]; exists {
+		t.Error("the replaced entry is still locked")
+	}
+	if dep := lockFile.Dependencies["github.com/me/tool"]; dep.Ref != "fix" {
+		t.Errorf("fork = %+v", dep)
+	}
+	if got := getDepPath("github.com/me/tool"); got != filepath.Join(".deps", "github.com", "user", "tool") {
+		t.Errorf("fork installs in %s, want the replaced entry's directory", got)
+	}
+	if got := getDepPath("github.com/user/lib"); got != filepath.Join(".deps", "lib") {
+		t.Errorf("override installs in %s", got)
+	}
+
+	// Saving puts the overrides back in the profile
+	dep := lockFile.Dependencies["github.com/me/tool"]
+	dep.SHA = "6666666666666666666666666666666666666666"
+	lockFile.Dependencies["github.com/me/tool"] = dep
+	if err := saveLockFile(lockFile); err != nil {
+		t.Fatal(err)
+	}
+	saved, _, err := readLockFileAt(".deps.lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := saved.Dependencies["github.com/user/tool"].SHA; got != "2222222222222222222222222222222222222222" {
+		t.Errorf("base entry sha = %s, want it unchanged", got)
+	}
+	override := saved.Profiles["staging"]["github.com/user/tool"]
+	if override.Repo != "github.com/me/tool" || override.SHA != "6666666666666666666666666666666666666666" {
+		t.Errorf("saved override = %+v", override)
+	}
+	if override := saved.Profiles["staging"]["github.com/user/lib"]; override.Alias != "" {
+		t.Errorf("override saved with the entry's alias: %+v", override)
+	}
+	if len(saved.Dependencies) != 3 {
+		t.Errorf("saved dependencies = %v", saved.Dependencies)
+	}
+}
+
+func TestApplyProfile_Errors(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	defer func() { activeProfile = "" }()
+	os.WriteFile(".deps.lock", []byte(testProfileLock), 0644)
+
+	activeProfile = "production"
+	if _, err := readLockFile(); err == nil || !strings.Contains(err.Error(), `no profile "production"`) {
+		t.Errorf("unknown profile error = %v", err)
+	}
+
+	// deps get may start a profile
+	lockFile, err := readProfileLockFile(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := overrideInProfile(lockFile, "github.com/user/other", "github.com/user/other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := overrideInProfile(lockFile, "github.com/me/lib", "github.com/user/missing"); err == nil {
+		t.Error("expected an error replacing an entry that isn't locked")
+	}
+	saved := unapplyProfile(lockFile)
+	if _, exists := saved.Profiles["production"]["github.com/user/other"]; !exists {
+		t.Errorf("profiles = %v", saved.Profiles)
+	}
+
+	lockFile, _, _ = parseLockFile([]byte(testProfileLock))
+	fork := lockFile.Profiles["staging"]["github.com/user/tool"]
+	fork.Repo = "github.com/user/other"
+	lockFile.Profiles["staging"]["github.com/user/tool"] = fork
+	if err := applyProfile(lockFile, "staging"); err == nil || !strings.Contains(err.Error(), "already in the lock file") {
+		t.Errorf("replacing with a locked repository: %v", err)
+	}
+}
+
+func TestInstalledForOtherProfile(t *testing.T) {
+	lockFile, _, err := parseLockFile([]byte(testProfileLock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := lockFile.Dependencies["github.com/user/lib"]
+	sums := map[string]depSums{"github.com/user/lib": {SHA: base.SHA}}
+
+	if installedForOtherProfile(lockFile, "github.com/user/lib", base, sums) {
+		t.Error("the locked commit is installed")
+	}
+	override := lockFile.Profiles["staging"]["github.com/user/lib"].Dependency
+	if !installedForOtherProfile(lockFile, "github.com/user/lib", override, sums) {
+		t.Error("another profile's commit is installed")
+	}
+	if !installedForOtherProfile(lockFile, "github.com/user/tool", lockFile.Dependencies["github.com/user/tool"], sums) {
+		t.Error("no record of what is installed")
+	}
+	if installedForOtherProfile(lockFile, "github.com/user/other", lockFile.Dependencies["github.com/user/other"], nil) {
+		t.Error("entries no profile overrides only need their directory")
+	}
+}
+
+func TestRecordSums_DropsSameDirectory(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	defer func() { depAliases = make(map[string]string) }()
+
+	depAliases = map[string]string{"github.com/me/tool": "github.com/user/tool"}
+	files := []fileSum{{Path: "tool.sh", Mode: "-", Hash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"}}
+	if err := recordSums("github.com/user/tool", "2222222222222222222222222222222222222222", files); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordSums("github.com/user/other", "3333333333333333333333333333333333333333", files); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordSums("github.com/me/tool", "5555555555555555555555555555555555555555", files); err != nil {
+		t.Fatal(err)
+	}
+	sums, err := loadSums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := sums["github.com/user/tool"]; exists {
+		t.Error("the replaced entry's checksums were kept")
+	}
+	if _, exists := sums["github.com/user/other"]; !exists {
+		t.Error("an unrelated entry's checksums were dropped")
+	}
+}
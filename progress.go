@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// progressInterval is how often a progress line is redrawn. A download that
+// finishes sooner never shows one.
+const progressInterval = 100 * time.Millisecond
+
+// progressBarWidth is the number of cells in a progress bar
+const progressBarWidth = 24
+
+// progress shows how far the download of one archive has got, bytes received
+// and files extracted, on a line redrawn in place. It is only shown on a
+// terminal at the normal log level, and not while jobs run in parallel:
+// verbose output lists every file instead.
+type progress struct {
+	label string
+	total int64 // bytes expected, from Content-Length, or -1 if unknown
+	bytes int64
+	files int
+	drawn time.Time
+	shown bool // the line is on screen
+}
+
+// activeProgress is the progress line being shown, if any
+var activeProgress *progress
+
+// startProgress starts reporting the download of label, of total bytes
+// (-1 if unknown). It returns nil, which reports nothing, when progress
+// isn't shown.
+func startProgress(label string, total int64) *progress {
+	if currentLogLevel != levelInfo || concurrentJobs || !isatty(logOutput()) {
+		return nil
+	}
+	activeProgress = &progress{label: label, total: total, drawn: time.Now()}
+	return activeProgress
+}
+
+// reader counts what is read from r as downloaded
+func (p *progress) reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &progressReader{r: r, p: p}
+}
+
+// finish removes the progress line
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+	clearProgress()
+	if activeProgress == p {
+		activeProgress = nil
+	}
+}
+
+// noteExtracted counts a file extracted for the download in progress
+func noteExtracted() {
+	if p := activeProgress; p != nil {
+		p.files++
+		p.update()
+	}
+}
+
+// clearProgress takes the progress line off the screen before something else
+// is printed; it is drawn again as the download goes on
+func clearProgress() {
+	if p := activeProgress; p != nil && p.shown {
+		fmt.Fprint(logOutput(), "\r\033[K")
+		p.shown = false
+	}
+}
+
+// update redraws the line if it hasn't been for progressInterval
+func (p *progress) update() {
+	if now := time.Now(); now.Sub(p.drawn) >= progressInterval {
+		p.drawn = now
+		fmt.Fprint(logOutput(), "\r\033[K"+p.line())
+		p.shown = true
+	}
+}
+
+// line renders the progress, like
+// "owner/repo [=========>          ]  45% 12.3 MB / 27.1 MB, 1204 files"
+func (p *progress) line() string {
+	files := fmt.Sprintf("%d files", p.files)
+	if p.files == 1 {
+		files = "1 file"
+	}
+	if p.total <= 0 {
+		return fmt.Sprintf("%s %s, %s", p.label, formatSize(p.bytes), files)
+	}
+	done := min(p.bytes, p.total)
+	cells := int(done * progressBarWidth / p.total)
+	bar := strings.Repeat("=", cells)
+	if cells < progressBarWidth {
+		bar += ">" + strings.Repeat(" ", progressBarWidth-cells-1)
+	}
+	return fmt.Sprintf("%s [%s] %3d%% %s / %s, %s", p.label, bar, done*100/p.total, formatSize(p.bytes), formatSize(p.total), files)
+}
+
+// progressReader counts the bytes read through it
+type progressReader struct {
+	r io.Reader
+	p *progress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.p.bytes += int64(n)
+	r.p.update()
+	return n, err
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressLine(t *testing.T) {
+	tests := []struct {
+		p    progress
+		want string
+	}{
+		{progress{label: "owner/repo", total: 4 << 20, bytes: 1 << 20, files: 12}, "owner/repo [======>                 ]  25% 1.0 MB / 4.0 MB, 12 files"},
+		{progress{label: "owner/repo", total: 1 << 20, bytes: 1 << 20, files: 1}, "owner/repo [========================] 100% 1.0 MB / 1.0 MB, 1 file"},
+		{progress{label: "owner/repo", total: -1, bytes: 2048, files: 3}, "owner/repo 2.0 KB, 3 files"},
+	}
+	for _, tt := range tests {
+		if got := tt.p.line(); got != tt.want {
+			t.Errorf("line() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestProgressReader(t *testing.T) {
+	// Off a terminal nothing is reported, and reads pass straight through
+	if p := startProgress("owner/repo", 10); p != nil {
+		t.Fatal("expected no progress off a terminal")
+	}
+	var p *progress
+	data, _ := io.ReadAll(p.reader(strings.NewReader("hello")))
+	p.finish()
+	if string(data) != "hello" {
+		t.Errorf("read %q through a nil progress", data)
+	}
+
+	counted := &progress{label: "owner/repo", total: 5, drawn: time.Now()}
+	io.ReadAll(counted.reader(strings.NewReader("hello")))
+	if counted.bytes != 5 {
+		t.Errorf("bytes = %d, want 5", counted.bytes)
+	}
+}
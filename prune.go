@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Every lock file installs into the same .deps, so what one doesn't list may
+// belong to another. Installing records the lock file in use in
+// lockFilesRecord, inside .deps, and findUnreferenced keeps whatever any
+// recorded lock file, or the default one, still lists.
+
+// lockFilesRecord lists the lock files that have installed dependencies in
+// depsDir, one path a line
+const lockFilesRecord = ".lockfiles"
+
+// recordLockFileOnce makes recordLockFile write lockFilesRecord once per
+// command, however many dependencies are installed
+var recordLockFileOnce sync.Once
+
+// recordLockFile adds the lock file in use to lockFilesRecord, if it isn't
+// there yet
+func recordLockFile() {
+	recordLockFileOnce.Do(func() {
+		path := filepath.ToSlash(filepath.Clean(lockFilePath()))
+		recorded := readLockFilesRecord()
+		for _, other := range recorded {
+			if sameFile(other, path) {
+				return
+			}
+		}
+		record := filepath.Join(installRoot(depsDir), lockFilesRecord)
+		data := strings.Join(append(recorded, path), "\n") + "\n"
+		err := os.MkdirAll(filepath.Dir(record), 0755)
+		if err == nil {
+			err = os.WriteFile(record, []byte(data), 0644)
+		}
+		if err != nil {
+			warnf("Warning: couldn't record %s in %s: %v\n", path, record, err)
+		}
+	})
+}
+
+// readLockFilesRecord returns the lock files in lockFilesRecord
+func readLockFilesRecord() []string {
+	data, err := os.ReadFile(filepath.Join(installRoot(depsDir), lockFilesRecord))
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths
+}
+
+// sameFile reports whether the paths a and b name the same file, relative
+// to the project or not
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(filepath.FromSlash(a))
+	absB, errB := filepath.Abs(filepath.FromSlash(b))
+	return errA == nil && errB == nil && absA == absB
+}
+
+// otherLockFilePaths returns where the dependencies of lock files other than
+// the one in use are installed: the default lock file, and every one in
+// lockFilesRecord that still exists. One that can't be read is an error,
+// since nothing in .deps could then safely be taken for unreferenced.
+func otherLockFilePaths() ([]string, error) {
+	candidates := append([]string{jsonLockFile, tomlLockFile}, readLockFilesRecord()...)
+	var paths []string
+	seen := map[string]bool{}
+	for _, candidate := range candidates {
+		abs, err := filepath.Abs(filepath.FromSlash(candidate))
+		if err != nil || seen[abs] || sameFile(candidate, lockFilePath()) {
+			continue
+		}
+		seen[abs] = true
+		other, _, err := readLockFileAt(filepath.FromSlash(candidate))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s, which also installs in %s: %v", candidate, depsDir, err)
+		}
+		for key, dep := range other.Dependencies {
+			paths = append(paths, depPathFor(key, dep.Alias))
+		}
+	}
+	return paths, nil
+}
+
+// findUnreferenced returns the files and directories under .deps that no
+// dependency of lockFile, or of another lock file installing there, is
+// installed in, like leftovers of removed or renamed dependencies.
+// Directories that only lead to installed dependencies, like
+// .deps/github.com, are kept, and only the top of each unreferenced tree is
+// returned.
+func findUnreferenced(lockFile *LockFile) ([]string, error) {
+	others, err := otherLockFilePaths()
+	if err != nil {
+		return nil, err
+	}
+	var depPaths []string
+	for repoURL := range lockFile.Dependencies {
+		depPaths = append(depPaths, getDepPath(repoURL))
+	}
+
+	installed := map[string]bool{filepath.Join(installRoot(depsDir), lockFilesRecord): true}
+	parents := make(map[string]bool)
+	for _, path := range append(depPaths, others...) {
+		path = filepath.Clean(path)
+		installed[path] = true
+		for dir := filepath.Dir(path); dir != "." && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+			parents[dir] = true
+		}
+	}
+
+	var unreferenced []string
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			switch {
+			case installed[path]:
+			case parents[path] && entry.IsDir():
+				if err := walk(path); err != nil {
+					return err
+				}
+			default:
+				unreferenced = append(unreferenced, path)
+			}
+		}
+		return nil
+	}
+
+	if err := walk(installRoot(depsDir)); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	sort.Strings(unreferenced)
+	return unreferenced, nil
+}
+
+// pathSize returns the size of a file, or of everything under a directory
+func pathSize(path string) int64 {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0
+	}
+	if !info.IsDir() {
+		return info.Size()
+	}
+	size, _ := dirSize(path)
+	return size
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestFindUnreferenced(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	defer func() { depAliases = make(map[string]string) }()
+
+	lockFile := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/user/repo":           {Ref: "main", SHA: "1111111111111111111111111111111111111111"},
+		"github.com/org/mono//pkg/a":     {Ref: "main", SHA: "2222222222222222222222222222222222222222"},
+		"github.com/user/long-name-repo": {Ref: "main", SHA: "3333333333333333333333333333333333333333", Alias: "lib"},
+	}}
+	registerAliases(lockFile)
+	writeTree(t, ".deps", map[string]string{
+		"github.com/user/repo/a.txt":             "kept",
+		"github.com/user/old/a.txt":              "removed dependency",
+		"github.com/org/mono%2F%2Fpkg%2Fa/a.txt": "kept",
+		"github.com/org/mono%2F%2Fpkg%2Fb/b.txt": "other subdirectory",
+		"github.com/org/mono/pkg/a/a.txt":        "from the old layout",
+		"github.com/user/long-name-repo/a.txt":   "from before the alias",
+		"lib/a.txt":                              "kept",
+		"gitlab.com/x/y/a.txt":                   "unknown host",
+		"notes.txt":                              "stray file",
+	})
+
+	got, err := findUnreferenced(lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(".deps", "github.com", "org", "mono"),
+		filepath.Join(".deps", "github.com", "org", "mono%2F%2Fpkg%2Fb"),
+		filepath.Join(".deps", "github.com", "user", "long-name-repo"),
+		filepath.Join(".deps", "github.com", "user", "old"),
+		filepath.Join(".deps", "gitlab.com"),
+		filepath.Join(".deps", "notes.txt"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findUnreferenced = %v, want %v", got, want)
+	}
+}
+
+func TestFindUnreferenced_DepsDir(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	t.Cleanup(func() { configureDepsDir() })
+	t.Setenv("DEPS_DIR", "third_party")
+	configureDepsDir()
+
+	lockFile := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/user/repo": {Ref: "main", SHA: "1111111111111111111111111111111111111111"},
+	}}
+	writeTree(t, "third_party", map[string]string{
+		"github.com/user/repo/a.txt": "kept",
+		"github.com/user/old/a.txt":  "removed dependency",
+	})
+	writeTree(t, ".deps", map[string]string{"github.com/user/other/a.txt": "not ours to prune"})
+
+	got, err := findUnreferenced(lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join("third_party", "github.com", "user", "old")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("findUnreferenced = %v, want %v", got, want)
+	}
+}
+
+func TestFindUnreferenced_NoDepsDirectory(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	got, err := findUnreferenced(&LockFile{Dependencies: map[string]Dependency{}})
+	if err != nil || len(got) != 0 {
+		t.Errorf("findUnreferenced = %v, %v", got, err)
+	}
+}
+
+func TestFindUnreferenced_OtherLockFiles(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	defer configureLockFile("")
+	recordLockFileOnce = sync.Once{}
+	defer func() { recordLockFileOnce = sync.Once{} }()
+
+	writeTree(t, ".", map[string]string{
+		".deps.lock":       `{"dependencies": {"github.com/a/lib": {"ref": "main", "sha": "1111111111111111111111111111111111111111"}}}`,
+		"tools/.deps.lock": `{"dependencies": {"github.com/b/tool": {"ref": "main", "sha": "2222222222222222222222222222222222222222"}}}`,
+		"ci/.deps.lock":    `{"dependencies": {"github.com/c/ci": {"ref": "main", "sha": "3333333333333333333333333333333333333333"}}}`,
+	})
+	writeTree(t, ".deps", map[string]string{
+		"github.com/a/lib/a.txt":  "main lock file",
+		"github.com/b/tool/a.txt": "tools lock file",
+		"github.com/c/ci/a.txt":   "ci lock file",
+		"github.com/d/old/a.txt":  "removed dependency",
+	})
+
+	// The ci lock file installed here before; the tools one is in use
+	configureLockFile("ci/.deps.lock")
+	recordLockFile()
+	recordLockFileOnce = sync.Once{}
+	configureLockFile("tools/.deps.lock")
+
+	got, err := findUnreferenced(loadLockFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(".deps", "github.com", "d")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("findUnreferenced = %v, want only what no lock file lists", got)
+	}
+
+	// A lock file that is recorded but can't be read stops pruning
+	os.WriteFile(filepath.Join("ci", ".deps.lock"), []byte("{"), 0644)
+	if _, err := findUnreferenced(loadLockFile()); err == nil {
+		t.Error("expected an error for an unreadable lock file")
+	}
+}
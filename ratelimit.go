@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRateLimitWait is the longest --wait-on-rate-limit sleeps before retrying
+const maxRateLimitWait = 15 * time.Minute
+
+// rateLimitError reports that the GitHub API rate limit has been used up
+type rateLimitError struct {
+	Reset         time.Time
+	Authenticated bool
+}
+
+func (e *rateLimitError) Error() string {
+	msg := "GitHub API rate limit exceeded"
+	if !e.Reset.IsZero() {
+		msg += fmt.Sprintf(" (resets at %s, in %s)", e.Reset.Local().Format("15:04:05"), time.Until(e.Reset).Round(time.Second))
+	}
+	if !e.Authenticated {
+		return msg + "; set GITHUB_TOKEN to raise the limit"
+	}
+	return msg + "; use --wait-on-rate-limit to wait for it to reset"
+}
+
+// rateLimitReset returns when the rate limit that rejected resp resets, and
+// whether resp was rejected by a rate limit at all. Both the primary limit
+// (X-RateLimit-*) and secondary limits (Retry-After) are recognised.
+func rateLimitReset(resp *http.Response) (time.Time, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return time.Time{}, false
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Now().Add(time.Duration(seconds) * time.Second), true
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		return time.Time{}, false
+	}
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		return time.Unix(reset, 0), true
+	}
+	return time.Time{}, true
+}
+
+// githubAPIError describes a failed GitHub API response, explaining rate
+// limits rather than just reporting the status
+func githubAPIError(resp *http.Response) error {
+	if reset, limited := rateLimitReset(resp); limited {
+		return &rateLimitError{Reset: reset, Authenticated: resp.Request != nil && resp.Request.Header.Get("Authorization") != ""}
+	}
+	return &statusError{Service: "GitHub API", StatusCode: resp.StatusCode}
+}
+
+// isRateLimited reports whether err was caused by an exhausted rate limit
+func isRateLimited(err error) bool {
+	var rateLimit *rateLimitError
+	return errors.As(err, &rateLimit)
+}
+
+// githubTransport authenticates GitHub API requests with GITHUB_TOKEN and,
+// if wait is set, sleeps until an exhausted rate limit resets and retries
+type githubTransport struct {
+	token string
+	wait  bool
+	base  http.RoundTripper
+}
+
+func (t *githubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	api, err := url.Parse(githubAPIBaseURL)
+	if err != nil || req.URL.Host != api.Host {
+		return t.base.RoundTrip(req)
+	}
+
+	if t.token != "" && req.Header.Get("Authorization") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || !t.wait {
+		return resp, err
+	}
+
+	reset, limited := rateLimitReset(resp)
+	wait := time.Until(reset)
+	if !limited || reset.IsZero() || wait > maxRateLimitWait || (req.Body != nil && req.GetBody == nil) {
+		return resp, nil
+	}
+
+	warnf("GitHub API rate limit exceeded, waiting %s for it to reset...\n", wait.Round(time.Second))
+	resp.Body.Close()
+	sleep(wait)
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+	return t.base.RoundTrip(req)
+}
+
+// githubToken returns GITHUB_TOKEN, or else the token kept in the token-file
+// setting's file
+func githubToken() (string, error) {
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		return token, nil
+	}
+	path := configValue("token-file")
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading token-file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// configureGitHubAuth wraps httpClient so GitHub API requests are authenticated
+// with GITHUB_TOKEN (or the token-file setting) when it is set. With wait,
+// requests that hit the rate limit are retried once it resets (up to
+// maxRateLimitWait away). It must run before configureMirrors so the token
+// isn't sent to mirrors.
+func configureGitHubAuth(wait bool) {
+	if !wait {
+		wait = configBool("wait-on-rate-limit")
+	}
+	token, err := githubToken()
+	if err != nil {
+		warnf("Warning: %v\n", err)
+	}
+	if token == "" && !wait {
+		return
+	}
+
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client := *httpClient
+	client.Transport = &githubTransport{token: token, wait: wait, base: base}
+	httpClient = &client
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rateLimited writes a primary rate limit response resetting after d
+func rateLimited(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set("X-RateLimit-Remaining", "0")
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(d).Unix(), 10))
+	w.WriteHeader(http.StatusForbidden)
+}
+
+func TestRateLimitReset(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		headers     map[string]string
+		wantLimited bool
+	}{
+		{"primary limit", 403, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1700000000"}, true},
+		{"secondary limit", 429, map[string]string{"Retry-After": "30"}, true},
+		{"forbidden", 403, map[string]string{"X-RateLimit-Remaining": "42"}, false},
+		{"not found", 404, map[string]string{"X-RateLimit-Remaining": "0"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			for k, v := range tt.headers {
+				resp.Header.Set(k, v)
+			}
+			if _, limited := rateLimitReset(resp); limited != tt.wantLimited {
+				t.Errorf("limited = %v, want %v", limited, tt.wantLimited)
+			}
+		})
+	}
+}
+
+func TestGithubAPIError_RateLimit(t *testing.T) {
+	resp := &http.Response{StatusCode: 403, Header: http.Header{}, Request: httptest.NewRequest("GET", "/", nil)}
+	resp.Header.Set("X-RateLimit-Remaining", "0")
+	resp.Header.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+
+	err := githubAPIError(resp)
+	if !isRateLimited(err) {
+		t.Fatalf("expected rate limit error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "resets at") || !strings.Contains(err.Error(), "GITHUB_TOKEN") {
+		t.Errorf("error = %q, want reset time and authentication hint", err)
+	}
+
+	resp.Request.Header.Set("Authorization", "Bearer secret")
+	if err := githubAPIError(resp); strings.Contains(err.Error(), "GITHUB_TOKEN") {
+		t.Errorf("authenticated error should not suggest GITHUB_TOKEN: %q", err)
+	}
+}
+
+func TestResolveRef_RateLimited(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		rateLimited(w, time.Hour)
+	})
+	mux.HandleFunc("/repos/testowner/testrepo/git/refs/tags/main", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("tag lookup should not be attempted after a rate limit")
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+
+	_, _, err := resolveRef("testowner", "testrepo", "main")
+	if !isRateLimited(err) {
+		t.Errorf("expected rate limit error, got %v", err)
+	}
+}
+
+func TestGithubTransport(t *testing.T) {
+	origSleep := sleep
+	var slept time.Duration
+	sleep = func(d time.Duration) { slept = d }
+	defer func() { sleep = origSleep }()
+
+	requests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		if requests == 1 {
+			rateLimited(w, time.Minute)
+			return
+		}
+		fmt.Fprint(w, `{"default_branch":"main"}`)
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+	httpClient = &http.Client{Transport: &githubTransport{token: "secret", wait: true, base: httpClient.Transport}}
+
+	info, err := getRepoInfo("testowner", "testrepo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.DefaultBranch != "main" || requests != 2 {
+		t.Errorf("got %+v after %d requests, want retry to succeed", info, requests)
+	}
+	if slept <= 0 || slept > time.Minute {
+		t.Errorf("slept %s, want up to a minute", slept)
+	}
+}
+
+func TestGithubTransport_OtherHostsUntouched(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Error("token should only be sent to the GitHub API")
+		}
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &githubTransport{token: "secret", base: http.DefaultTransport}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+}
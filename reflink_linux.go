@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl, which makes a file share another's blocks
+// until either is written to
+const ficlone = 0x40049409
+
+// reflinkFile clones src to a new file dst with mode, on filesystems such as
+// Btrfs and XFS that support it
+func reflinkFile(src, dst string, mode fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, out.Fd(), ficlone, in.Fd())
+	if errno == 0 {
+		// The mode given to OpenFile is masked by the umask
+		err = out.Chmod(mode)
+	}
+	out.Close()
+	if errno != 0 {
+		os.Remove(dst)
+		return &os.PathError{Op: "reflink", Path: dst, Err: errno}
+	}
+	return err
+}
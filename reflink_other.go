@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// reflinkFile would clone src to dst, but there is no portable way to outside
+// Linux, so callers fall back to copying
+func reflinkFile(src, dst string, mode fs.FileMode) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// jsonOutput is set by --json: the commands in jsonCommands print JSON on
+// stdout, and everything they would otherwise print goes to stderr
+var jsonOutput bool
+
+// jsonCommands are the commands that support --json. check, install, update
+// and audit print a commandReport; the others print what they look up.
+var jsonCommands = []string{"check", "install", "update", "audit", "list", "stats", "licenses", "resolve", "tags", "info", "search"}
+
+// configureJSONOutput refuses --json for commands that would print text
+// where JSON was asked for
+func configureJSONOutput(command string) error {
+	if jsonOutput && !slices.Contains(jsonCommands, command) {
+		return fmt.Errorf("--json only works with deps %s", strings.Join(jsonCommands, ", "))
+	}
+	return nil
+}
+
+// Statuses of a dependency in a report, besides those checkDependency gives
+const (
+	resultAlreadyInstalled = "already_installed"
+	resultInstalled        = "installed"
+	resultUpToDate         = "up_to_date"
+	resultUpdated          = "updated"
+	resultError            = "error"
+	resultVulnerable       = "vulnerable"
+	resultNoKnownVulns     = "no_known_vulnerabilities"
+	resultNotAudited       = "not_audited"
+)
+
+// depResult is what a report says about one dependency
+type depResult struct {
+	Repo      string `json:"repo"`
+	Ref       string `json:"ref"`
+	SHA       string `json:"sha"`
+	Status    string `json:"status"`
+	LatestRef string `json:"latest_ref,omitempty"`
+	LatestSHA string `json:"latest_sha,omitempty"`
+	MovedTo   string `json:"moved_to,omitempty"`
+	Dirty     bool   `json:"dirty,omitempty"`
+	Reason    string `json:"reason,omitempty"` // why it was reinstalled
+	Error     string `json:"error,omitempty"`
+
+	Vulnerabilities []vulnerability `json:"vulnerabilities,omitempty"` // from deps audit
+}
+
+// commandReport is the JSON document a command prints with --json
+type commandReport struct {
+	Command      string      `json:"command"`
+	OK           bool        `json:"ok"`
+	Dependencies []depResult `json:"dependencies"`
+}
+
+// results holds what the running command found for each dependency, by URL
+var results = make(map[string]depResult)
+
+// recordResult records the outcome for a dependency, replacing an earlier
+// one: an update found and then applied reports only that it was updated
+func recordResult(result depResult) {
+	results[result.Repo] = result
+}
+
+// resultsFailed reports whether any recorded result is an error
+func resultsFailed() bool {
+	for _, result := range results {
+		if result.Status == resultError {
+			return true
+		}
+	}
+	return false
+}
+
+// resultFor starts the result for the lock entry of repoURL
+func resultFor(repoURL string, dep Dependency, status string) depResult {
+	return depResult{Repo: repoURL, Ref: dep.Ref, SHA: dep.SHA, Status: status}
+}
+
+// printReport prints the results recorded so far as the report of command,
+// when --json was given
+func printReport(command string, ok bool) {
+	if !jsonOutput {
+		return
+	}
+	report := commandReport{Command: command, OK: ok, Dependencies: []depResult{}}
+	for _, result := range results {
+		report.Dependencies = append(report.Dependencies, result)
+	}
+	sort.Slice(report.Dependencies, func(i, j int) bool {
+		return report.Dependencies[i].Repo < report.Dependencies[j].Repo
+	})
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(data))
+}
+
+// printJSON prints v indented on stdout, for the commands that print what
+// they look up rather than a commandReport
+func printJSON(v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		errorf("Error: %v\n", err)
+		os.Exit(exitCodeFor(err))
+	}
+	fmt.Println(string(data))
+}
+
+// resolveReport is what deps resolve --json prints
+type resolveReport struct {
+	Repo    string `json:"repo"`
+	Ref     string `json:"ref"`
+	Kind    string `json:"kind"` // branch, tag or sha
+	SHA     string `json:"sha"`
+	Archive string `json:"archive"`
+}
+
+// tagReport is one tag or branch deps tags --json lists
+type tagReport struct {
+	Name string `json:"name"`
+	SHA  string `json:"sha"`
+}
+
+// infoReport is what deps info --json prints. Locked is only set for a
+// dependency of the project.
+type infoReport struct {
+	Repo          string      `json:"repo"`
+	Description   string      `json:"description,omitempty"`
+	DefaultBranch string      `json:"default_branch,omitempty"`
+	LatestRelease string      `json:"latest_release,omitempty"`
+	License       string      `json:"license,omitempty"`
+	Archived      bool        `json:"archived"`
+	Locked        *lockedInfo `json:"locked,omitempty"`
+}
+
+// lockedInfo is what is locked of a dependency, and where it is installed
+type lockedInfo struct {
+	Ref        string `json:"ref"`
+	SHA        string `json:"sha"`
+	Constraint string `json:"constraint,omitempty"`
+	Policy     string `json:"policy,omitempty"`
+	Pinned     bool   `json:"pinned,omitempty"`
+	Path       string `json:"path"`
+	Installed  bool   `json:"installed"`
+}
+
+// searchReport is what deps search --json prints
+type searchReport struct {
+	TotalCount   int            `json:"total_count"`
+	Repositories []searchResult `json:"repositories"`
+}
+
+type searchResult struct {
+	Repo        string `json:"repo"`
+	Description string `json:"description,omitempty"`
+	Stars       int    `json:"stars"`
+	Archived    bool   `json:"archived"`
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// resetResults clears the results recorded by an earlier test
+func resetResults(t *testing.T) {
+	t.Helper()
+	results = make(map[string]depResult)
+	t.Cleanup(func() { results = make(map[string]depResult) })
+}
+
+func TestPrintReport(t *testing.T) {
+	resetResults(t)
+	jsonOutput = true
+	defer func() { jsonOutput = false }()
+
+	dep := Dependency{Ref: "main", SHA: "abc1234567"}
+	recordResult(resultFor("github.com/b/lib", dep, "update_available"))
+	recordResult(resultFor("github.com/a/app", dep, resultUpToDate))
+	recordResult(resultFor("github.com/b/lib", dep, resultUpdated))
+
+	stdout, _ := captureOutput(t, func() { printReport("update", true) })
+	var report commandReport
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout, err)
+	}
+	if report.Command != "update" || !report.OK {
+		t.Errorf("report = %+v, want an ok update report", report)
+	}
+	if len(report.Dependencies) != 2 {
+		t.Fatalf("got %d dependencies, want 2", len(report.Dependencies))
+	}
+	if report.Dependencies[0].Repo != "github.com/a/app" || report.Dependencies[1].Status != resultUpdated {
+		t.Errorf("dependencies = %+v, want sorted, with the later result for github.com/b/lib", report.Dependencies)
+	}
+}
+
+func TestPrintReport_NotJSON(t *testing.T) {
+	resetResults(t)
+	stdout, _ := captureOutput(t, func() { printReport("check", true) })
+	if stdout != "" {
+		t.Errorf("printed %q without --json", stdout)
+	}
+}
+
+func TestInstallDependencies_RecordsResults(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	resetResults(t)
+
+	tarball := makeTarGz(t, "repo-abc1234567/", map[string]string{"README.md": "# Repo"})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/repo/tarball/abc1234567", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tarball.Bytes())
+	})
+	mux.HandleFunc("/repos/testowner/broken/tarball/def1234567", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	if err := os.MkdirAll(filepath.Join(".deps", "github.com", "testowner", "present"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	lockFile := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/testowner/repo":    {Ref: "main", SHA: "abc1234567"},
+		"github.com/testowner/broken":  {Ref: "main", SHA: "def1234567"},
+		"github.com/testowner/present": {Ref: "v1.0.0", SHA: "0001234567"},
+	}}
+
+	captureOutput(t, func() {
+		installDependencies(lockFile, func(string, Dependency) string { return "" })
+	})
+
+	want := map[string]string{
+		"github.com/testowner/repo":    resultInstalled,
+		"github.com/testowner/broken":  resultError,
+		"github.com/testowner/present": resultAlreadyInstalled,
+	}
+	for repoURL, status := range want {
+		if got := results[repoURL].Status; got != status {
+			t.Errorf("%s: status = %q, want %q", repoURL, got, status)
+		}
+	}
+	if results["github.com/testowner/broken"].Error == "" {
+		t.Error("the failed install has no error")
+	}
+	if !resultsFailed() {
+		t.Error("resultsFailed() = false, want true")
+	}
+}
+
+func TestConfigureJSONOutput(t *testing.T) {
+	jsonOutput = true
+	defer func() { jsonOutput = false }()
+
+	for _, command := range jsonCommands {
+		if err := configureJSONOutput(command); err != nil {
+			t.Errorf("%s: unexpected error: %v", command, err)
+		}
+	}
+	if err := configureJSONOutput("tree"); err == nil {
+		t.Error("expected an error for deps tree --json")
+	}
+	jsonOutput = false
+	if err := configureJSONOutput("tree"); err != nil {
+		t.Errorf("without --json: unexpected error: %v", err)
+	}
+}
+
+func TestHandleSearch_JSON(t *testing.T) {
+	jsonOutput = true
+	defer func() { jsonOutput = false }()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search/repositories", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"total_count":12,"items":[{"full_name":"floooh/sokol-odin","description":"Odin bindings","stargazers_count":300}]}`))
+	})
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+
+	stdout, _ := captureOutput(t, func() { handleSearch([]string{"sokol"}) })
+	var report searchReport
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout, err)
+	}
+	if report.TotalCount != 12 || len(report.Repositories) != 1 || report.Repositories[0].Repo != "github.com/floooh/sokol-odin" || report.Repositories[0].Stars != 300 {
+		t.Errorf("report = %+v", report)
+	}
+}
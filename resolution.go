@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Resolution says which commit of a repository is installed where the
+// dependencies of a lock file pull it in as submodules pinned at different
+// commits. Without one, submodules aren't compared and each is installed at
+// the commit its parent pins.
+type Resolution struct {
+	// Strategy decides between different pins: fail, highest-tag, or
+	// pinned (the default) to install each at its own pin and only warn
+	Strategy string `json:"strategy,omitempty"`
+	// Overrides install a repository at the given commit wherever it is a
+	// submodule, whatever the strategy
+	Overrides map[string]string `json:"overrides,omitempty"`
+	// Resolved is the commit the installed copies of each conflicting
+	// repository are at, recorded to reinstall dependencies when it changes
+	Resolved map[string]string `json:"resolved,omitempty"`
+}
+
+// Resolution strategies
+const (
+	strategyFail       = "fail"
+	strategyHighestTag = "highest-tag"
+	strategyPinned     = "pinned"
+)
+
+// submodulePin is a submodule a dependency pulls in, and the commit its
+// parent pins it at
+type submodulePin struct {
+	Parent string // the lock entry
+	Path   string // where it is installed inside the dependency
+	Repo   string // github.com/owner/repo
+	SHA    string
+}
+
+// submoduleConflict is a repository pulled in at more than one commit
+type submoduleConflict struct {
+	Repo string
+	Pins []submodulePin
+}
+
+func (c submoduleConflict) String() string {
+	var pins []string
+	for _, pin := range c.Pins {
+		pins = append(pins, fmt.Sprintf("%s pins %s at %s", pin.Parent, abbreviate(pin.SHA), pin.Path))
+	}
+	return fmt.Sprintf("%s: %s", c.Repo, strings.Join(pins, ", "))
+}
+
+// submoduleConflictError is returned when the fail strategy finds conflicts
+type submoduleConflictError struct {
+	Conflicts []submoduleConflict
+}
+
+func (e *submoduleConflictError) Error() string {
+	var lines []string
+	for _, conflict := range e.Conflicts {
+		lines = append(lines, conflict.String())
+	}
+	return fmt.Sprintf("submodules pinned at different commits (set a resolution strategy or override):\n  %s", strings.Join(lines, "\n  "))
+}
+
+// submodulePlan is the commit each repository is installed at wherever it
+// is a submodule, set by planSubmodules and followed by expandSubmodulesAt
+var submodulePlan map[string]string
+
+// collectSubmodulePins looks up the submodules of every dependency of
+// lockFile fetched with them, nested ones included, as the parent commits
+// pin them. Like submodule expansion, this only works over HTTPS on GitHub.
+func collectSubmodulePins(lockFile *LockFile) ([]submodulePin, error) {
+	var pins []submodulePin
+	var walk func(parent, owner, repo, sha, subdir, prefix string, depth int) error
+	walk = func(parent, owner, repo, sha, subdir, prefix string, depth int) error {
+		if depth >= maxSubmoduleDepth {
+			return fmt.Errorf("submodules nested more than %d levels deep", maxSubmoduleDepth)
+		}
+		data, err := getFileContents(owner, repo, sha, ".gitmodules")
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, sub := range parseGitmodules(string(data)) {
+			if sub.Path == "" || sub.URL == "" || validateSubdir(sub.Path) != nil {
+				continue
+			}
+			relPath := sub.Path
+			if subdir != "" {
+				if !strings.HasPrefix(sub.Path, subdir+"/") {
+					continue
+				}
+				relPath = strings.TrimPrefix(sub.Path, subdir+"/")
+			}
+			subOwner, subRepo, err := submoduleGitHubRepo(owner, repo, sub.URL)
+			if err != nil {
+				continue
+			}
+			subSHA, err := getSubmoduleSHA(owner, repo, sha, sub.Path)
+			if err != nil {
+				return fmt.Errorf("submodule %s: %w", sub.Path, err)
+			}
+
+			pin := submodulePin{
+				Parent: parent,
+				Path:   path.Join(prefix, relPath),
+				Repo:   "github.com/" + subOwner + "/" + subRepo,
+				SHA:    subSHA,
+			}
+			pins = append(pins, pin)
+			if err := walk(parent, subOwner, subRepo, subSHA, "", pin.Path, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, repoURL := range sortedKeys(lockFile.Dependencies) {
+		dep := lockFile.Dependencies[repoURL]
+		if !dep.Submodules || dep.Transport == transportSSH || isAzureURL(repoURL) {
+			continue
+		}
+		owner, repo, err := parseGitHubURL(repoURL)
+		if err != nil {
+			continue
+		}
+		_, subdir := splitSubdir(repoURL)
+		if err := walk(repoURL, owner, repo, dep.SHA, subdir, "", 0); err != nil {
+			return nil, fmt.Errorf("%s: %w", repoURL, err)
+		}
+	}
+	return pins, nil
+}
+
+// resolveSubmodules decides the commit of each repository pinned at more
+// than one commit, or overridden, returning the plan and the conflicts the
+// strategy left undecided, sorted by repository
+func resolveSubmodules(pins []submodulePin, resolution *Resolution) (map[string]string, []submoduleConflict, error) {
+	byRepo := make(map[string][]submodulePin)
+	for _, pin := range pins {
+		byRepo[pin.Repo] = append(byRepo[pin.Repo], pin)
+	}
+	repos := make([]string, 0, len(byRepo))
+	for repo := range byRepo {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+
+	plan := make(map[string]string)
+	var conflicts []submoduleConflict
+	for _, repo := range repos {
+		if sha, ok := resolution.Overrides[repo]; ok {
+			plan[repo] = sha
+			continue
+		}
+		var shas []string
+		for _, pin := range byRepo[repo] {
+			if !slices.Contains(shas, pin.SHA) {
+				shas = append(shas, pin.SHA)
+			}
+		}
+		if len(shas) == 1 {
+			continue
+		}
+
+		conflict := submoduleConflict{Repo: repo, Pins: byRepo[repo]}
+		if resolution.Strategy != strategyHighestTag {
+			conflicts = append(conflicts, conflict)
+			continue
+		}
+		sha, err := highestTagged(repo, shas)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", repo, err)
+		}
+		if sha == "" {
+			conflicts = append(conflicts, conflict)
+			continue
+		}
+		plan[repo] = sha
+	}
+	return plan, conflicts, nil
+}
+
+// highestTagged returns which of shas has the highest version tag in repo,
+// or "" if none of them is tagged with a version
+func highestTagged(repo string, shas []string) (string, error) {
+	owner, name, err := parseGitHubURL(repo)
+	if err != nil {
+		return "", err
+	}
+	tags, err := listTags(owner, name)
+	if err != nil {
+		return "", fmt.Errorf("listing tags: %w", err)
+	}
+
+	var best string
+	var bestVersion semver
+	for _, tag := range tags {
+		v, ok := parseSemver(tag.Name)
+		if !ok || !slices.Contains(shas, tag.SHA) {
+			continue
+		}
+		if best == "" || compareSemver(v, bestVersion) > 0 {
+			best, bestVersion = tag.SHA, v
+		}
+	}
+	return best, nil
+}
+
+// planSubmodules decides the commit of every conflicting or overridden
+// submodule of lockFile and records it in the resolution, so
+// expandSubmodulesAt installs them there. It returns the dependencies whose
+// installed submodules the new plan changes, with why. Conflicts are an
+// error with the fail strategy and a warning without one.
+func planSubmodules(lockFile *LockFile) (map[string]string, error) {
+	submodulePlan = nil
+	resolution := lockFile.Resolution
+	if resolution == nil {
+		return nil, nil
+	}
+
+	pins, err := collectSubmodulePins(lockFile)
+	if err != nil {
+		return nil, fmt.Errorf("looking up submodules: %w", err)
+	}
+	plan, conflicts, err := resolveSubmodules(pins, resolution)
+	if err != nil {
+		return nil, err
+	}
+	if len(conflicts) > 0 && resolution.Strategy == strategyFail {
+		return nil, &submoduleConflictError{Conflicts: conflicts}
+	}
+	for _, conflict := range conflicts {
+		warnf("%s Installing each at its own pin: %s\n", colorize(colorYellow, "!"), conflict)
+	}
+
+	reinstall := make(map[string]string)
+	for _, pin := range pins {
+		if plan[pin.Repo] != resolution.Resolved[pin.Repo] {
+			sha := plan[pin.Repo]
+			if sha == "" {
+				sha = pin.SHA
+			}
+			reinstall[pin.Parent] = fmt.Sprintf("submodule %s now resolves to %s", pin.Repo, abbreviate(sha))
+		}
+	}
+
+	submodulePlan = plan
+	resolution.Resolved = nil
+	if len(plan) > 0 {
+		resolution.Resolved = plan
+	} else if resolution.Strategy == "" && len(resolution.Overrides) == 0 {
+		lockFile.Resolution = nil
+	}
+	return reinstall, nil
+}
+
+// validateResolution checks the strategy and commits of a resolution
+func validateResolution(resolution Resolution) []string {
+	var problems []string
+	switch resolution.Strategy {
+	case "", strategyFail, strategyHighestTag, strategyPinned:
+	default:
+		problems = append(problems, fmt.Sprintf("strategy: unknown strategy %q (use %s, %s or %s)", resolution.Strategy, strategyFail, strategyHighestTag, strategyPinned))
+	}
+	for field, shas := range map[string]map[string]string{"overrides": resolution.Overrides, "resolved": resolution.Resolved} {
+		for repo := range shas {
+			if owner, name, err := parseGitHubURL(repo); err != nil || repo != "github.com/"+owner+"/"+name {
+				problems = append(problems, fmt.Sprintf("%s.%s: must be a GitHub repository, github.com/owner/repo", field, repo))
+			}
+			if !isFullSHA(shas[repo]) {
+				problems = append(problems, fmt.Sprintf("%s.%s: must be a full commit SHA", field, repo))
+			}
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
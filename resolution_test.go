@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const (
+	libV1SHA = "1111111111111111111111111111111111111111"
+	libV2SHA = "2222222222222222222222222222222222222222"
+)
+
+// libPins is github.com/other/lib pulled in at two commits
+var libPins = []submodulePin{
+	{Parent: "github.com/a/app", Path: "vendor/lib", Repo: "github.com/other/lib", SHA: libV1SHA},
+	{Parent: "github.com/b/tool", Path: "third_party/lib", Repo: "github.com/other/lib", SHA: libV2SHA},
+	{Parent: "github.com/b/tool", Path: "third_party/log", Repo: "github.com/other/log", SHA: libV1SHA},
+}
+
+// serveParent serves owner/repo at sha, with a submodule of other/lib at subSHA
+func serveParent(mux *http.ServeMux, owner, repo, sha, subPath, subSHA string) {
+	mux.HandleFunc("/repos/"+owner+"/"+repo+"/contents/.gitmodules", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ref") != sha {
+			w.WriteHeader(404)
+			return
+		}
+		fmt.Fprintf(w, "[submodule \"lib\"]\n\tpath = %s\n\turl = https://github.com/other/lib.git\n", subPath)
+	})
+	mux.HandleFunc("/repos/"+owner+"/"+repo+"/contents/"+subPath, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"type":"submodule","sha":"%s"}`, subSHA)
+	})
+}
+
+func serveLibTags(mux *http.ServeMux) {
+	mux.HandleFunc("/repos/other/lib/tags", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]GitHubTag{
+			{Name: "v1.4.0", Commit: GitHubCommit{SHA: libV1SHA}},
+			{Name: "v1.10.0", Commit: GitHubCommit{SHA: libV2SHA}},
+			{Name: "nightly", Commit: GitHubCommit{SHA: "3333333333333333333333333333333333333333"}},
+		})
+	})
+}
+
+func TestCollectSubmodulePins(t *testing.T) {
+	appSHA := "abc123def456abc123def456abc123def456abc1"
+	toolSHA := "def456abc123def456abc123def456abc123def4"
+	mux := http.NewServeMux()
+	serveParent(mux, "a", "app", appSHA, "vendor/lib", libV1SHA)
+	serveParent(mux, "b", "tool", toolSHA, "third_party/lib", libV2SHA)
+	mux.HandleFunc("/repos/other/lib/contents/.gitmodules", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	})
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	lockFile := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/a/app":  {Ref: "main", SHA: appSHA, Submodules: true},
+		"github.com/b/tool": {Ref: "main", SHA: toolSHA, Submodules: true},
+		"github.com/c/none": {Ref: "main", SHA: toolSHA},
+	}}
+	pins, err := collectSubmodulePins(lockFile)
+	if err != nil {
+		t.Fatalf("collectSubmodulePins error: %v", err)
+	}
+	want := libPins[:2]
+	if !reflect.DeepEqual(pins, want) {
+		t.Errorf("pins = %+v, want %+v", pins, want)
+	}
+}
+
+func TestResolveSubmodules(t *testing.T) {
+	mux := http.NewServeMux()
+	serveLibTags(mux)
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	tests := []struct {
+		name       string
+		resolution Resolution
+		plan       map[string]string
+		conflicts  []string
+	}{
+		{name: "pinned", resolution: Resolution{}, plan: map[string]string{}, conflicts: []string{"github.com/other/lib"}},
+		{name: "fail", resolution: Resolution{Strategy: strategyFail}, plan: map[string]string{}, conflicts: []string{"github.com/other/lib"}},
+		{
+			name:       "highest tag",
+			resolution: Resolution{Strategy: strategyHighestTag},
+			plan:       map[string]string{"github.com/other/lib": libV2SHA},
+		},
+		{
+			name:       "override",
+			resolution: Resolution{Strategy: strategyHighestTag, Overrides: map[string]string{"github.com/other/lib": libV1SHA, "github.com/other/log": libV2SHA}},
+			plan:       map[string]string{"github.com/other/lib": libV1SHA, "github.com/other/log": libV2SHA},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, conflicts, err := resolveSubmodules(libPins, &tt.resolution)
+			if err != nil {
+				t.Fatalf("resolveSubmodules error: %v", err)
+			}
+			if !reflect.DeepEqual(plan, tt.plan) {
+				t.Errorf("plan = %v, want %v", plan, tt.plan)
+			}
+			var repos []string
+			for _, conflict := range conflicts {
+				repos = append(repos, conflict.Repo)
+			}
+			if !reflect.DeepEqual(repos, tt.conflicts) {
+				t.Errorf("conflicts = %v, want %v", repos, tt.conflicts)
+			}
+		})
+	}
+}
+
+func TestResolveSubmodules_HighestTagNeedsTags(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/other/lib/tags", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	})
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	plan, conflicts, err := resolveSubmodules(libPins, &Resolution{Strategy: strategyHighestTag})
+	if err != nil {
+		t.Fatalf("resolveSubmodules error: %v", err)
+	}
+	if len(plan) != 0 || len(conflicts) != 1 {
+		t.Errorf("plan = %v, conflicts = %v; want untagged commits left as a conflict", plan, conflicts)
+	}
+}
+
+func TestPlanSubmodules(t *testing.T) {
+	appSHA := "abc123def456abc123def456abc123def456abc1"
+	toolSHA := "def456abc123def456abc123def456abc123def4"
+	mux := http.NewServeMux()
+	serveParent(mux, "a", "app", appSHA, "vendor/lib", libV1SHA)
+	serveParent(mux, "b", "tool", toolSHA, "third_party/lib", libV2SHA)
+	mux.HandleFunc("/repos/other/lib/contents/.gitmodules", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	})
+	serveLibTags(mux)
+	restore := testGitHubServer(t, mux)
+	defer restore()
+	defer func() { submodulePlan = nil }()
+
+	newLockFile := func(resolution *Resolution) *LockFile {
+		return &LockFile{
+			Dependencies: map[string]Dependency{
+				"github.com/a/app":  {Ref: "main", SHA: appSHA, Submodules: true},
+				"github.com/b/tool": {Ref: "main", SHA: toolSHA, Submodules: true},
+			},
+			Resolution: resolution,
+		}
+	}
+
+	// Without a resolution nothing is looked up or planned
+	reinstall, err := planSubmodules(newLockFile(nil))
+	if err != nil || reinstall != nil || submodulePlan != nil {
+		t.Errorf("planSubmodules without resolution = %v, %v (plan %v)", reinstall, err, submodulePlan)
+	}
+
+	_, err = planSubmodules(newLockFile(&Resolution{Strategy: strategyFail}))
+	var conflictErr *submoduleConflictError
+	if !errors.As(err, &conflictErr) || len(conflictErr.Conflicts) != 1 {
+		t.Fatalf("planSubmodules with fail = %v, want a conflict error", err)
+	}
+
+	lockFile := newLockFile(&Resolution{Strategy: strategyHighestTag})
+	reinstall, err = planSubmodules(lockFile)
+	if err != nil {
+		t.Fatalf("planSubmodules error: %v", err)
+	}
+	want := map[string]string{"github.com/other/lib": libV2SHA}
+	if !reflect.DeepEqual(submodulePlan, want) || !reflect.DeepEqual(lockFile.Resolution.Resolved, want) {
+		t.Errorf("plan = %v, resolved = %v, want %v", submodulePlan, lockFile.Resolution.Resolved, want)
+	}
+	if _, ok := reinstall["github.com/a/app"]; !ok || len(reinstall) != 2 {
+		t.Errorf("reinstall = %v, want both dependencies pulling in the newly resolved lib", reinstall)
+	}
+
+	// Once recorded, the same plan reinstalls nothing
+	reinstall, err = planSubmodules(lockFile)
+	if err != nil || len(reinstall) != 0 {
+		t.Errorf("second planSubmodules = %v, %v; want nothing to reinstall", reinstall, err)
+	}
+}
+
+func TestValidateResolution(t *testing.T) {
+	valid := Resolution{Strategy: strategyHighestTag, Overrides: map[string]string{"github.com/other/lib": libV1SHA}}
+	if problems := validateResolution(valid); len(problems) != 0 {
+		t.Errorf("validateResolution(valid) = %v", problems)
+	}
+
+	invalid := Resolution{
+		Strategy:  "newest",
+		Overrides: map[string]string{"github.com/other/lib//src": libV1SHA},
+		Resolved:  map[string]string{"github.com/other/lib": "v1.0.0"},
+	}
+	if problems := validateResolution(invalid); len(problems) != 3 {
+		t.Errorf("validateResolution(invalid) = %v, want 3 problems", problems)
+	}
+}
+
+func TestFetchDependency_FollowsSubmodulePlan(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	defer func() { submodulePlan = nil }()
+
+	parentSHA := "abc123def456abc123def456abc123def456abc1"
+	parentTarball := makeTarGz(t, "app-abc123d/", map[string]string{
+		".gitmodules": "[submodule \"vendor/lib\"]\n\tpath = vendor/lib\n\turl = https://github.com/other/lib.git\n",
+	}).Bytes()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/a/app/tarball/"+parentSHA, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(parentTarball)
+	})
+	serveParent(mux, "a", "app", parentSHA, "vendor/lib", libV1SHA)
+	mux.HandleFunc("/repos/other/lib/tarball/"+libV1SHA, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("downloaded the pinned commit instead of the planned one")
+		w.WriteHeader(404)
+	})
+	mux.HandleFunc("/repos/other/lib/tarball/"+libV2SHA, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(makeTarGz(t, "lib-2222222/", map[string]string{"VERSION": "2"}).Bytes())
+	})
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	submodulePlan = map[string]string{"github.com/other/lib": libV2SHA}
+	repoURL := "github.com/a/app"
+	if _, err := fetchDependency(repoURL, Dependency{Ref: "main", SHA: parentSHA, Submodules: true}); err != nil {
+		t.Fatalf("fetchDependency error: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(getDepPath(repoURL), "vendor", "lib", "VERSION"))
+	if err != nil || string(data) != "2" {
+		t.Errorf("VERSION = %q, %v; want the planned commit installed", data, err)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// downloadResumable downloads url, which messages call label, into out. A
+// download cut off mid-stream is picked up where it stopped with a Range
+// request, conditional on the ETag (or Last-Modified) of the first response so
+// a changed file is fetched whole again; servers that don't do ranges send it
+// all again anyway. Every retry that gets more of the file resets the count, so
+// a flaky connection only gives up after maxRetries attempts in a row that make
+// no progress. Responses other than 200 or 206 become errors from apiError.
+func downloadResumable(url, label string, out *os.File, p *progress, apiError func(*http.Response) error) error {
+	var written int64
+	var validator string
+	for failures := 0; ; {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return err
+		}
+		if written > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", written))
+			if validator != "" {
+				req.Header.Set("If-Range", validator)
+			}
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusPartialContent && written > 0 && contentRangeStart(resp) == written:
+			debugf("Resuming the download of %s at %s\n", label, formatSize(written))
+		case resp.StatusCode == http.StatusOK:
+			if err := restartDownload(out); err != nil {
+				resp.Body.Close()
+				return err
+			}
+			written, validator = 0, rangeValidator(resp)
+			// Resume from where any redirect led, not through it again
+			url = resp.Request.URL.String()
+			if p != nil {
+				p.bytes, p.total = 0, resp.ContentLength
+			}
+		case resp.StatusCode == http.StatusPartialContent:
+			resp.Body.Close()
+			return fmt.Errorf("resuming the download of %s at %d got the range %q", label, written, resp.Header.Get("Content-Range"))
+		default:
+			err := apiError(resp)
+			resp.Body.Close()
+			return err
+		}
+
+		n, err := io.Copy(out, p.reader(resp.Body))
+		resp.Body.Close()
+		written += n
+		if err == nil {
+			return nil
+		}
+		if n > 0 {
+			failures = 0
+		}
+		if !isTransient(err) || failures >= maxRetries {
+			return err
+		}
+		delay := retryDelay(failures)
+		failures++
+		warnf("Download of %s interrupted at %s (%v), resuming in %s...\n", label, formatSize(written), err, delay.Round(100*time.Millisecond))
+		sleep(delay)
+	}
+}
+
+// restartDownload empties out for a download starting over
+func restartDownload(out *os.File) error {
+	if err := out.Truncate(0); err != nil {
+		return err
+	}
+	_, err := out.Seek(0, io.SeekStart)
+	return err
+}
+
+// rangeValidator returns what If-Range can name resp's content by: a strong
+// ETag, or else its Last-Modified time
+func rangeValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+// contentRangeStart returns the offset a 206 response starts at, from a
+// Content-Range like "bytes 1024-2047/4096", or -1
+func contentRangeStart(resp *http.Response) int64 {
+	spec, ok := strings.CutPrefix(resp.Header.Get("Content-Range"), "bytes ")
+	if !ok {
+		return -1
+	}
+	start, _, ok := strings.Cut(spec, "-")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
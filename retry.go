@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// defaultRetries is how many times a failed request is retried by default
+const defaultRetries = 3
+
+// Backoff between retries doubles from retryBaseDelay up to retryMaxDelay,
+// with jitter so parallel clients don't retry in lockstep
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+)
+
+// maxRetries is the number of retries for transient failures, set by
+// configureRetries
+var maxRetries = defaultRetries
+
+// retryDelay returns the jittered backoff before retry number attempt (from 0)
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << attempt
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+	// Somewhere between half and one and a half times the delay
+	return delay/2 + time.Duration(rand.Int63n(int64(delay)))
+}
+
+// isTransient reports whether err is worth retrying: timeouts, connection
+// resets and connections cut off mid-response
+func isTransient(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// retryTransport retries requests that fail transiently or get a 5xx answer
+type retryTransport struct {
+	retries int
+	base    http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+
+		retry := false
+		switch {
+		case err != nil:
+			retry = isTransient(err)
+		case resp.StatusCode >= 500:
+			retry = true
+		}
+		// Requests with a body can only be resent if it can be rewound
+		if !retry || attempt >= t.retries || (req.Body != nil && req.GetBody == nil) || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			resp.Body.Close()
+		}
+		delay := retryDelay(attempt)
+		warnf("Request to %s failed (%s), retrying in %s...\n", req.URL.Host, reason, delay.Round(100*time.Millisecond))
+		sleep(delay)
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// configureRetries wraps httpClient so transient failures are retried. A
+// negative count falls back to the retries setting (or DEPS_RETRIES), then to
+// defaultRetries. It wraps
+// the base transport, so it must run before the other transports are
+// configured.
+func configureRetries(retries int) error {
+	if retries < 0 {
+		retries = defaultRetries
+		if value, origin := configLookup("retries"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid retries %q in %s", value, origin)
+			}
+			retries = n
+		}
+	}
+	maxRetries = retries
+	if retries == 0 {
+		return nil
+	}
+
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client := *httpClient
+	client.Transport = &retryTransport{retries: retries, base: base}
+	httpClient = &client
+	return nil
+}
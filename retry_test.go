@@ -0,0 +1,198 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// noSleep stubs out sleep for the duration of a test
+func noSleep(t *testing.T) {
+	t.Helper()
+	orig := sleep
+	sleep = func(time.Duration) {}
+	t.Cleanup(func() { sleep = orig })
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt := 0; attempt < 10; attempt++ {
+		delay := retryDelay(attempt)
+		if delay < retryBaseDelay/2 || delay > retryMaxDelay*3/2 {
+			t.Errorf("retryDelay(%d) = %s out of range", attempt, delay)
+		}
+	}
+	if retryDelay(100) > retryMaxDelay*3/2 {
+		t.Error("retryDelay should be capped for large attempts")
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	if !isTransient(fmt.Errorf("read: %w", syscall.ECONNRESET)) {
+		t.Error("connection reset should be transient")
+	}
+	if !isTransient(io.ErrUnexpectedEOF) {
+		t.Error("unexpected EOF should be transient")
+	}
+	if isTransient(os.ErrNotExist) {
+		t.Error("not exist should not be transient")
+	}
+}
+
+func TestRetryTransport_5xx(t *testing.T) {
+	noSleep(t)
+
+	requests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, `{"default_branch":"main"}`)
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+	httpClient = &http.Client{Transport: &retryTransport{retries: 3, base: httpClient.Transport}}
+
+	info, err := getRepoInfo("testowner", "testrepo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.DefaultBranch != "main" || requests != 3 {
+		t.Errorf("got %+v after %d requests", info, requests)
+	}
+}
+
+func TestRetryTransport_GivesUp(t *testing.T) {
+	noSleep(t)
+
+	requests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+	httpClient = &http.Client{Transport: &retryTransport{retries: 2, base: httpClient.Transport}}
+
+	if _, err := getRepoInfo("testowner", "testrepo"); err == nil {
+		t.Error("expected error after retries, got nil")
+	}
+	if requests != 3 {
+		t.Errorf("got %d requests, want 3", requests)
+	}
+}
+
+func TestDownloadTarball_RetriesTruncatedBody(t *testing.T) {
+	noSleep(t)
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	content := bytes.Repeat([]byte("x"), 64*1024)
+	tw.WriteHeader(&tar.Header{Name: "repo-abc/file.txt", Mode: 0644, Size: int64(len(content))})
+	tw.Write(content)
+	tw.Close()
+	gz.Close()
+	tarball := buf.Bytes()
+
+	requests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/tarball/abc", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			// Promise the whole archive but cut the connection halfway
+			w.Header().Set("Content-Length", fmt.Sprint(len(tarball)))
+			w.Write(tarball[:len(tarball)/2])
+			return
+		}
+		w.Write(tarball)
+	})
+
+	serverCleanup := testGitHubServer(t, mux)
+	defer serverCleanup()
+
+	dest := filepath.Join(".deps", "out")
+	if _, err := downloadTarball("testowner", "testrepo", "abc", dest, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("got %d requests, want 2", requests)
+	}
+	data, err := os.ReadFile(filepath.Join(dest, "file.txt"))
+	if err != nil || len(data) != len(content) {
+		t.Errorf("extracted file incomplete: %d bytes, %v", len(data), err)
+	}
+}
+
+func TestDownloadTarball_ResumesTruncatedBody(t *testing.T) {
+	noSleep(t)
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	content := bytes.Repeat([]byte("x"), 64*1024)
+	tarball := makeTarGz(t, "repo-abc/", map[string]string{"file.txt": string(content)}).Bytes()
+
+	var ranges []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/tarball/abc", func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", `"abc"`)
+		if len(ranges) == 1 {
+			w.Header().Set("Content-Length", fmt.Sprint(len(tarball)))
+			w.Write(tarball[:len(tarball)/2])
+			return
+		}
+		if r.Header.Get("If-Range") != `"abc"` {
+			t.Errorf("If-Range = %q", r.Header.Get("If-Range"))
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(tarball))
+	})
+
+	serverCleanup := testGitHubServer(t, mux)
+	defer serverCleanup()
+
+	dest := filepath.Join(".deps", "out")
+	if _, err := downloadTarball("testowner", "testrepo", "abc", dest, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ranges) != 2 || ranges[1] != fmt.Sprintf("bytes=%d-", len(tarball)/2) {
+		t.Errorf("got requests with ranges %q, want the second to resume halfway", ranges)
+	}
+	data, err := os.ReadFile(filepath.Join(dest, "file.txt"))
+	if err != nil || !bytes.Equal(data, content) {
+		t.Errorf("extracted file incomplete: %d bytes, %v", len(data), err)
+	}
+}
+
+func TestConfigureRetries(t *testing.T) {
+	restoreHTTPClient(t)
+	orig := maxRetries
+	defer func() { maxRetries = orig }()
+
+	t.Setenv("DEPS_RETRIES", "5")
+	if err := configureRetries(-1); err != nil || maxRetries != 5 {
+		t.Errorf("configureRetries from env = %v, maxRetries %d", err, maxRetries)
+	}
+	if err := configureRetries(0); err != nil || maxRetries != 0 {
+		t.Errorf("configureRetries(0) = %v, maxRetries %d", err, maxRetries)
+	}
+	t.Setenv("DEPS_RETRIES", "many")
+	if err := configureRetries(-1); err == nil {
+		t.Error("expected error for invalid DEPS_RETRIES, got nil")
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// deps sbom describes every locked dependency as a software bill of
+// materials, in SPDX 2.3 or CycloneDX 1.5 JSON, for supply-chain tools that
+// read one or the other. Each dependency is a package with its repository,
+// the ref and commit it is locked at (or for a URL source, its URL), the
+// SHA-256 of its archive, and the license deps licenses finds, all depended
+// on by the project itself.
+
+// Formats of deps sbom
+const (
+	sbomSPDX      = "spdx"
+	sbomCycloneDX = "cyclonedx"
+)
+
+// sbomPackage is what an SBOM records about one dependency
+type sbomPackage struct {
+	Name     string // the lock key, like github.com/owner/repo//subdir
+	Version  string // the locked ref
+	SHA      string
+	Hash     string // SHA-256 of the archive, if recorded
+	TreeHash string
+	Source   string // the repository's URL, or a URL source's own
+	PURL     string // package URL, for GitHub dependencies
+	License  string // SPDX identifier, or "" if unknown or not one
+}
+
+// sbomPackages lists the dependencies of lockFile for an SBOM, in lock file
+// order, with their licenses from collectLicenses
+func sbomPackages(lockFile *LockFile, offline bool) []sbomPackage {
+	licenses := collectLicenses(lockFile, offline)
+	packages := make([]sbomPackage, len(licenses))
+	for i, license := range licenses {
+		if license.Error != "" {
+			// On stderr, so as not to corrupt the SBOM on stdout
+			errorf("Warning: couldn't find the license of %s: %s\n", license.Repo, license.Error)
+		}
+		dep := lockFile.Dependencies[license.Repo]
+		url, _ := splitEntryName(license.Repo)
+		repoURL, subdir := splitSubdir(url)
+		pkg := sbomPackage{
+			Name:     license.Repo,
+			Version:  dep.Ref,
+			SHA:      dep.SHA,
+			Hash:     dep.Hash,
+			TreeHash: dep.TreeHash,
+			Source:   "https://" + repoURL,
+		}
+		if isURLSource(url) {
+			pkg.Source = url
+		}
+		if owner, repo, err := parseGitHubURL(url); err == nil {
+			pkg.PURL = fmt.Sprintf("pkg:github/%s/%s@%s", owner, repo, dep.SHA)
+			if subdir != "" {
+				pkg.PURL += "#" + subdir
+			}
+		}
+		// Only identifiers are valid license expressions, and GitHub gives
+		// the name Other to licenses it can't identify
+		if spdxIDPattern.MatchString(license.License) && license.License != "Other" {
+			pkg.License = license.License
+		}
+		packages[i] = pkg
+	}
+	return packages
+}
+
+// spdxDocument is an SPDX 2.3 document, in its JSON form
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string         `json:"name"`
+	SPDXID           string         `json:"SPDXID"`
+	VersionInfo      string         `json:"versionInfo,omitempty"`
+	DownloadLocation string         `json:"downloadLocation"`
+	FilesAnalyzed    bool           `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum `json:"checksums,omitempty"`
+	LicenseConcluded string         `json:"licenseConcluded"`
+	LicenseDeclared  string         `json:"licenseDeclared"`
+	CopyrightText    string         `json:"copyrightText"`
+	ExternalRefs     []spdxRef      `json:"externalRefs,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// spdxNoAssertion is SPDX for a value that wasn't determined
+const spdxNoAssertion = "NOASSERTION"
+
+// spdxIDChars are the characters an SPDX element ID can't have
+var spdxIDChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// buildSPDX describes packages, the dependencies of the project named
+// project, as an SPDX document created at created
+func buildSPDX(project string, packages []sbomPackage, created time.Time) spdxDocument {
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              project,
+		DocumentNamespace: fmt.Sprintf("https://spdx.org/spdxdocs/%s-%s", spdxIDChars.ReplaceAllString(project, "-"), newUUID()),
+		CreationInfo: spdxCreationInfo{
+			Created:  created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: deps-" + version},
+		},
+		Packages: []spdxPackage{{
+			Name:             project,
+			SPDXID:           "SPDXRef-Project",
+			DownloadLocation: spdxNoAssertion,
+			LicenseConcluded: spdxNoAssertion,
+			LicenseDeclared:  spdxNoAssertion,
+			CopyrightText:    spdxNoAssertion,
+		}},
+		Relationships: []spdxRelationship{{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: "SPDXRef-Project"}},
+	}
+
+	for i, pkg := range packages {
+		// The index keeps IDs unique where names only differ in punctuation
+		id := fmt.Sprintf("SPDXRef-Package-%d-%s", i+1, spdxIDChars.ReplaceAllString(pkg.Name, "-"))
+		entry := spdxPackage{
+			Name:        pkg.Name,
+			SPDXID:      id,
+			VersionInfo: pkg.Version,
+			// A VCS location, as SPDX writes them: git+<url>@<commit>#<path>
+			DownloadLocation: fmt.Sprintf("git+%s@%s", pkg.Source, pkg.SHA),
+			LicenseConcluded: spdxNoAssertion,
+			LicenseDeclared:  spdxNoAssertion,
+			CopyrightText:    spdxNoAssertion,
+		}
+		if _, subdir := splitSubdir(pkg.Name); subdir != "" {
+			entry.DownloadLocation += "#" + subdir
+		}
+		if isURLSource(pkg.Name) {
+			entry.DownloadLocation = pkg.Source
+		}
+		if pkg.License != "" {
+			entry.LicenseDeclared = pkg.License
+		}
+		if pkg.Hash != "" {
+			entry.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: pkg.Hash}}
+		}
+		if pkg.PURL != "" {
+			entry.ExternalRefs = []spdxRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: pkg.PURL}}
+		}
+		doc.Packages = append(doc.Packages, entry)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{SPDXElementID: "SPDXRef-Project", RelationshipType: "DEPENDS_ON", RelatedSPDXElement: id})
+	}
+	return doc
+}
+
+// cycloneDXBOM is a CycloneDX 1.5 BOM, in its JSON form
+type cycloneDXBOM struct {
+	BOMFormat    string                `json:"bomFormat"`
+	SpecVersion  string                `json:"specVersion"`
+	SerialNumber string                `json:"serialNumber"`
+	Version      int                   `json:"version"`
+	Metadata     cycloneDXMetadata     `json:"metadata"`
+	Components   []cycloneDXComponent  `json:"components"`
+	Dependencies []cycloneDXDependency `json:"dependencies"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string `json:"timestamp"`
+	Tools     struct {
+		Components []cycloneDXComponent `json:"components"`
+	} `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXComponent struct {
+	Type               string               `json:"type"`
+	BOMRef             string               `json:"bom-ref,omitempty"`
+	Name               string               `json:"name"`
+	Version            string               `json:"version,omitempty"`
+	PURL               string               `json:"purl,omitempty"`
+	Hashes             []cycloneDXHash      `json:"hashes,omitempty"`
+	Licenses           []cycloneDXLicense   `json:"licenses,omitempty"`
+	ExternalReferences []cycloneDXReference `json:"externalReferences,omitempty"`
+	Properties         []cycloneDXProperty  `json:"properties,omitempty"`
+}
+
+type cycloneDXHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cycloneDXLicense struct {
+	License struct {
+		ID string `json:"id"`
+	} `json:"license"`
+}
+
+type cycloneDXReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cycloneDXDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// buildCycloneDX describes packages, the dependencies of the project named
+// project, as a CycloneDX BOM created at created
+func buildCycloneDX(project string, packages []sbomPackage, created time.Time) cycloneDXBOM {
+	bom := cycloneDXBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + newUUID(),
+		Version:      1,
+		Components:   []cycloneDXComponent{},
+	}
+	bom.Metadata.Timestamp = created.UTC().Format(time.RFC3339)
+	bom.Metadata.Tools.Components = []cycloneDXComponent{{Type: "application", Name: "deps", Version: version}}
+	bom.Metadata.Component = cycloneDXComponent{Type: "application", BOMRef: "project", Name: project}
+
+	root := cycloneDXDependency{Ref: "project", DependsOn: []string{}}
+	for _, pkg := range packages {
+		component := cycloneDXComponent{
+			Type:               "library",
+			BOMRef:             pkg.Name,
+			Name:               pkg.Name,
+			Version:            pkg.Version,
+			PURL:               pkg.PURL,
+			ExternalReferences: []cycloneDXReference{{Type: "vcs", URL: pkg.Source}},
+		}
+		if isURLSource(pkg.Name) {
+			component.ExternalReferences[0].Type = "distribution"
+		}
+		if pkg.SHA != "" {
+			component.Properties = []cycloneDXProperty{{Name: "deps:sha", Value: pkg.SHA}}
+		}
+		if pkg.Hash != "" {
+			component.Hashes = []cycloneDXHash{{Alg: "SHA-256", Content: pkg.Hash}}
+		}
+		if pkg.TreeHash != "" {
+			component.Properties = append(component.Properties, cycloneDXProperty{Name: "deps:tree_hash", Value: pkg.TreeHash})
+		}
+		if pkg.License != "" {
+			var license cycloneDXLicense
+			license.License.ID = pkg.License
+			component.Licenses = []cycloneDXLicense{license}
+		}
+		bom.Components = append(bom.Components, component)
+		bom.Dependencies = append(bom.Dependencies, cycloneDXDependency{Ref: pkg.Name, DependsOn: []string{}})
+		root.DependsOn = append(root.DependsOn, pkg.Name)
+	}
+	bom.Dependencies = append([]cycloneDXDependency{root}, bom.Dependencies...)
+	return bom
+}
+
+// sbomProjectName names the project in an SBOM, after its directory
+func sbomProjectName() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "project"
+	}
+	return filepath.Base(dir)
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testSBOMPackages(t *testing.T) []sbomPackage {
+	t.Helper()
+	cleanup := withTempDir(t)
+	t.Cleanup(cleanup)
+
+	lockFile := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/user/lib":         {Ref: "v1.2.3", SHA: "1111111111111111111111111111111111111111", Hash: "abcd", TreeHash: "ef01"},
+		"github.com/user/mono//pkg/a": {Ref: "main", SHA: "2222222222222222222222222222222222222222"},
+	}}
+	writeTree(t, filepath.Join(".deps", "github.com", "user", "lib"), map[string]string{"LICENSE": "Permission is hereby granted, free of charge, to any person"})
+	return sbomPackages(lockFile, true)
+}
+
+func TestSBOMPackages(t *testing.T) {
+	packages := testSBOMPackages(t)
+	want := []sbomPackage{
+		{Name: "github.com/user/lib", Version: "v1.2.3", SHA: "1111111111111111111111111111111111111111", Hash: "abcd", TreeHash: "ef01",
+			Source: "https://github.com/user/lib", PURL: "pkg:github/user/lib@1111111111111111111111111111111111111111", License: "MIT"},
+		{Name: "github.com/user/mono//pkg/a", Version: "main", SHA: "2222222222222222222222222222222222222222",
+			Source: "https://github.com/user/mono", PURL: "pkg:github/user/mono@2222222222222222222222222222222222222222#pkg/a"},
+	}
+	if len(packages) != len(want) {
+		t.Fatalf("packages = %+v", packages)
+	}
+	for i := range want {
+		if packages[i] != want[i] {
+			t.Errorf("packages[%d] = %+v, want %+v", i, packages[i], want[i])
+		}
+	}
+}
+
+func TestBuildSPDX(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	doc := buildSPDX("myproject", testSBOMPackages(t), created)
+
+	if doc.SPDXVersion != "SPDX-2.3" || doc.CreationInfo.Created != "2024-05-01T12:00:00Z" {
+		t.Errorf("document = %+v", doc)
+	}
+	if len(doc.Packages) != 3 || len(doc.Relationships) != 3 {
+		t.Fatalf("%d packages, %d relationships, want the project and both dependencies", len(doc.Packages), len(doc.Relationships))
+	}
+	lib, mono := doc.Packages[1], doc.Packages[2]
+	if lib.SPDXID != "SPDXRef-Package-1-github.com-user-lib" || lib.LicenseDeclared != "MIT" || lib.Checksums[0].ChecksumValue != "abcd" {
+		t.Errorf("lib = %+v", lib)
+	}
+	if mono.DownloadLocation != "git+https://github.com/user/mono@2222222222222222222222222222222222222222#pkg/a" || mono.LicenseDeclared != spdxNoAssertion || mono.Checksums != nil {
+		t.Errorf("mono = %+v", mono)
+	}
+	if r := doc.Relationships[1]; r.SPDXElementID != "SPDXRef-Project" || r.RelationshipType != "DEPENDS_ON" || r.RelatedSPDXElement != lib.SPDXID {
+		t.Errorf("relationship = %+v", r)
+	}
+}
+
+func TestBuildCycloneDX(t *testing.T) {
+	bom := buildCycloneDX("myproject", testSBOMPackages(t), time.Now())
+
+	if bom.BOMFormat != "CycloneDX" || bom.SpecVersion != "1.5" || len(bom.SerialNumber) != len("urn:uuid:")+36 {
+		t.Errorf("bom = %+v", bom)
+	}
+	if len(bom.Components) != 2 {
+		t.Fatalf("components = %+v", bom.Components)
+	}
+	lib := bom.Components[0]
+	if lib.Licenses[0].License.ID != "MIT" || lib.Hashes[0].Alg != "SHA-256" || len(lib.Properties) != 2 {
+		t.Errorf("lib = %+v", lib)
+	}
+	if mono := bom.Components[1]; mono.Licenses != nil || mono.Hashes != nil {
+		t.Errorf("mono = %+v", mono)
+	}
+	if root := bom.Dependencies[0]; root.Ref != "project" || len(root.DependsOn) != 2 {
+		t.Errorf("project dependencies = %+v", root)
+	}
+}
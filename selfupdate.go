@@ -0,0 +1,198 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// checksumsAsset is the release asset listing the SHA-256 of every archive
+const checksumsAsset = "checksums.txt"
+
+// releaseBinaryName is the binary the release workflow builds for a platform
+func releaseBinaryName(goos, goarch string) string {
+	name := fmt.Sprintf("deps-%s-%s", goos, goarch)
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// releaseArchiveName is the release asset holding the binary for a platform:
+// a zip on Windows and a tarball everywhere else
+func releaseArchiveName(goos, goarch string) string {
+	if goos == "windows" {
+		return fmt.Sprintf("deps-%s-%s.zip", goos, goarch)
+	}
+	return releaseBinaryName(goos, goarch) + ".tar.gz"
+}
+
+// findAsset returns the release asset called name
+func findAsset(release *GitHubRelease, name string) (GitHubReleaseAsset, bool) {
+	for _, asset := range release.Assets {
+		if asset.Name == name {
+			return asset, true
+		}
+	}
+	return GitHubReleaseAsset{}, false
+}
+
+// downloadAsset fetches a release asset into memory
+func downloadAsset(asset GitHubReleaseAsset) ([]byte, error) {
+	resp, err := httpClient.Get(asset.BrowserDownloadURL)
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s: %w", asset.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("downloading %s: %w", asset.Name, &statusError{Service: "GitHub", StatusCode: resp.StatusCode})
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// assetChecksum looks name up in the release's checksums, falling back to
+// the digest GitHub records for each asset for releases published before
+// checksums.txt was
+func assetChecksum(release *GitHubRelease, name string) (string, error) {
+	if asset, ok := findAsset(release, checksumsAsset); ok {
+		data, err := downloadAsset(asset)
+		if err != nil {
+			return "", err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+				return strings.ToLower(fields[0]), nil
+			}
+		}
+		return "", fmt.Errorf("%s doesn't list %s", checksumsAsset, name)
+	}
+	if asset, ok := findAsset(release, name); ok {
+		if digest, found := strings.CutPrefix(asset.Digest, "sha256:"); found {
+			return digest, nil
+		}
+	}
+	return "", fmt.Errorf("release %s has no checksum for %s", release.TagName, name)
+}
+
+// extractReleaseBinary pulls the binary called name out of a release archive
+func extractReleaseBinary(archive []byte, archiveName, name string) ([]byte, error) {
+	if strings.HasSuffix(archiveName, ".zip") {
+		zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if path.Base(f.Name) != name || f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			return io.ReadAll(rc)
+		}
+		return nil, fmt.Errorf("%s doesn't contain %s", archiveName, name)
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s doesn't contain %s", archiveName, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg && path.Base(header.Name) == name {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// selfUpdate downloads this platform's binary from release, checks it
+// against the release's checksum and swaps it in for the executable at
+// target. The new binary is written next to target and renamed over it, so
+// an interrupted update leaves the old binary in place.
+func selfUpdate(release *GitHubRelease, target string) error {
+	archiveName := releaseArchiveName(runtime.GOOS, runtime.GOARCH)
+	asset, ok := findAsset(release, archiveName)
+	if !ok {
+		return fmt.Errorf("release %s has no build for %s/%s", release.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+
+	expected, err := assetChecksum(release, archiveName)
+	if err != nil {
+		return err
+	}
+	archive, err := downloadAsset(asset)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(archive)
+	if got := hex.EncodeToString(sum[:]); got != expected {
+		return fmt.Errorf("%s: %w", archiveName, &checksumError{What: "hash", Expected: expected, Got: got})
+	}
+	debugf("%s matches checksum %s\n", archiveName, abbreviate(expected))
+
+	binary, err := extractReleaseBinary(archive, archiveName, releaseBinaryName(runtime.GOOS, runtime.GOARCH))
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".deps-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+
+	// Windows won't replace a running executable, but it will rename one
+	if runtime.GOOS == "windows" {
+		old := target + ".old"
+		os.Remove(old)
+		if err := os.Rename(target, old); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// currentExecutable is the binary self-update replaces, with symlinks such
+// as a Homebrew shim followed to the real file
+func currentExecutable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
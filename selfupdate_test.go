@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// selfUpdateServer serves a release whose archive holds binary, listed in
+// checksums.txt with the given sum ("" for the archive's real one)
+func selfUpdateServer(t *testing.T, binary, sum string) (*GitHubRelease, func()) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("release archives are zips on Windows")
+	}
+	archiveName := releaseArchiveName(runtime.GOOS, runtime.GOARCH)
+	archive := makeTarGz(t, "", map[string]string{releaseBinaryName(runtime.GOOS, runtime.GOARCH): binary}).Bytes()
+	if sum == "" {
+		digest := sha256.Sum256(archive)
+		sum = hex.EncodeToString(digest[:])
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/download/"+archiveName, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	})
+	mux.HandleFunc("/download/checksums.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0000  deps-other-arch.tar.gz\n" + sum + "  " + archiveName + "\n"))
+	})
+	restore := testGitHubServer(t, mux)
+
+	release := &GitHubRelease{
+		TagName: "v9.0.0",
+		Assets: []GitHubReleaseAsset{
+			{Name: archiveName, BrowserDownloadURL: githubAPIBaseURL + "/download/" + archiveName},
+			{Name: checksumsAsset, BrowserDownloadURL: githubAPIBaseURL + "/download/checksums.txt"},
+		},
+	}
+	return release, restore
+}
+
+func TestSelfUpdate(t *testing.T) {
+	release, restore := selfUpdateServer(t, "new binary", "")
+	defer restore()
+
+	target := filepath.Join(t.TempDir(), "deps")
+	os.WriteFile(target, []byte("old binary"), 0755)
+
+	if err := selfUpdate(release, target); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := os.ReadFile(target)
+	if string(data) != "new binary" {
+		t.Errorf("executable = %q, want the new binary", data)
+	}
+	info, _ := os.Stat(target)
+	if info.Mode().Perm()&0111 == 0 {
+		t.Errorf("executable mode = %v, want it executable", info.Mode())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(target))
+	if len(entries) != 1 {
+		t.Errorf("left %d files beside the executable, want only it", len(entries))
+	}
+}
+
+func TestSelfUpdate_ChecksumMismatch(t *testing.T) {
+	release, restore := selfUpdateServer(t, "tampered binary", strings.Repeat("ab", 32))
+	defer restore()
+
+	target := filepath.Join(t.TempDir(), "deps")
+	os.WriteFile(target, []byte("old binary"), 0755)
+
+	err := selfUpdate(release, target)
+	if exitCodeFor(err) != exitIntegrity {
+		t.Fatalf("err = %v, want a checksum mismatch", err)
+	}
+	data, _ := os.ReadFile(target)
+	if string(data) != "old binary" {
+		t.Errorf("executable = %q, want the old binary untouched", data)
+	}
+}
+
+func TestSelfUpdate_NoBuild(t *testing.T) {
+	release := &GitHubRelease{TagName: "v9.0.0", Assets: []GitHubReleaseAsset{{Name: "deps-plan9-386.tar.gz"}}}
+	if err := selfUpdate(release, filepath.Join(t.TempDir(), "deps")); err == nil {
+		t.Fatal("expected an error for a release without this platform")
+	}
+}
+
+func TestAssetChecksum_Digest(t *testing.T) {
+	release := &GitHubRelease{TagName: "v1.0.0", Assets: []GitHubReleaseAsset{
+		{Name: "deps-linux-amd64.tar.gz", Digest: "sha256:abc123"},
+		{Name: "deps-darwin-arm64.tar.gz"},
+	}}
+	if sum, err := assetChecksum(release, "deps-linux-amd64.tar.gz"); err != nil || sum != "abc123" {
+		t.Errorf("sum = %q, err = %v, want abc123", sum, err)
+	}
+	if _, err := assetChecksum(release, "deps-darwin-arm64.tar.gz"); err == nil {
+		t.Error("expected an error for an asset with no checksum")
+	}
+}
+
+func TestGetLatestRelease_Assets(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/moomerman/deps/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"tag_name": "v2.0.0", "assets": [{"name": "checksums.txt", "browser_download_url": "https://example.com/checksums.txt", "digest": "sha256:ff"}]}`))
+	})
+	defer testGitHubServer(t, mux)()
+
+	release, err := getLatestRelease(selfOwner, selfRepo)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := GitHubReleaseAsset{Name: "checksums.txt", BrowserDownloadURL: "https://example.com/checksums.txt", Digest: "sha256:ff"}
+	if len(release.Assets) != 1 || release.Assets[0] != want {
+		got, _ := json.Marshal(release.Assets)
+		t.Errorf("assets = %s", got)
+	}
+}
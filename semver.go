@@ -0,0 +1,341 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// semver is a parsed semantic version. Build metadata is ignored.
+type semver struct {
+	Major, Minor, Patch int
+	Pre                 string
+}
+
+func (v semver) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// parseSemver parses versions like "v1.2.3", "1.2.3-rc.1" or "1.2" (missing
+// parts are zero)
+func parseSemver(s string) (semver, bool) {
+	v, _, ok := parsePartialSemver(s)
+	return v, ok
+}
+
+// parsePartialSemver parses a version, also reporting how many numeric parts
+// were given so constraints like "^1.4" or "1.x" can be expanded. Wildcard
+// parts ("x", "X", "*") end the version.
+func parsePartialSemver(s string) (v semver, parts int, ok bool) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	s, _, _ = strings.Cut(s, "+")
+	s, v.Pre, _ = strings.Cut(s, "-")
+
+	fields := strings.Split(s, ".")
+	if len(fields) > 3 {
+		return semver{}, 0, false
+	}
+
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, field := range fields {
+		if field == "x" || field == "X" || field == "*" {
+			if v.Pre != "" {
+				return semver{}, 0, false
+			}
+			return v, i, true
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return semver{}, 0, false
+		}
+		*nums[i] = n
+	}
+
+	return v, len(fields), true
+}
+
+// compareSemver returns -1 if a < b, 0 if they are equal and 1 if a > b
+func compareSemver(a, b semver) int {
+	for _, pair := range [][2]int{{a.Major, b.Major}, {a.Minor, b.Minor}, {a.Patch, b.Patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return comparePrerelease(a.Pre, b.Pre)
+}
+
+// comparePrerelease orders pre-release strings per the semver spec; a release
+// (empty pre-release) sorts after any pre-release of the same version
+func comparePrerelease(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		if aParts[i] == bParts[i] {
+			continue
+		}
+		aNum, aErr := strconv.Atoi(aParts[i])
+		bNum, bErr := strconv.Atoi(bParts[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNum < bNum {
+				return -1
+			}
+			return 1
+		case aErr == nil:
+			// Numeric identifiers sort before alphanumeric ones
+			return -1
+		case bErr == nil:
+			return 1
+		case aParts[i] < bParts[i]:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	if len(aParts) < len(bParts) {
+		return -1
+	}
+	if len(aParts) > len(bParts) {
+		return 1
+	}
+	return 0
+}
+
+type comparator struct {
+	Op      string // one of "=", "!=", ">", ">=", "<", "<="
+	Version semver
+}
+
+// versionConstraint is a set of alternatives ("||"), each a set of comparators
+// that must all match
+type versionConstraint [][]comparator
+
+// isConstraint reports whether ref is a version constraint rather than a
+// branch, tag or SHA
+func isConstraint(ref string) bool {
+	if ref == "*" || strings.ContainsAny(ref, "^~<>=, |") {
+		return true
+	}
+	// Wildcard versions like 1.x or 1.2.*
+	_, parts, ok := parsePartialSemver(ref)
+	return ok && parts < 3 && strings.ContainsAny(ref, "xX*")
+}
+
+// parseConstraint parses constraints like "^1.4", "~1.2.3", ">=2, <3",
+// "1.x" or "^1 || ^2"
+func parseConstraint(s string) (versionConstraint, error) {
+	var constraint versionConstraint
+
+	for _, alternative := range strings.Split(s, "||") {
+		var group []comparator
+
+		terms := strings.FieldsFunc(alternative, func(r rune) bool { return r == ',' || r == ' ' })
+		if len(terms) == 0 {
+			return nil, fmt.Errorf("invalid constraint %q", s)
+		}
+
+		for _, term := range terms {
+			comparators, err := parseConstraintTerm(term)
+			if err != nil {
+				return nil, fmt.Errorf("invalid constraint %q: %v", s, err)
+			}
+			group = append(group, comparators...)
+		}
+
+		constraint = append(constraint, group)
+	}
+
+	return constraint, nil
+}
+
+func parseConstraintTerm(term string) ([]comparator, error) {
+	if term == "*" || term == "x" || term == "X" {
+		return nil, nil
+	}
+
+	op := ""
+	for _, candidate := range []string{">=", "<=", "!=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(term, candidate) {
+			op = candidate
+			break
+		}
+	}
+
+	v, parts, ok := parsePartialSemver(strings.TrimPrefix(term, op))
+	if !ok || parts == 0 && op != "" {
+		return nil, fmt.Errorf("invalid version in %q", term)
+	}
+
+	switch op {
+	case "^":
+		// Allow changes that don't modify the left-most non-zero part
+		upper := semver{Major: v.Major + 1}
+		if v.Major == 0 && parts >= 2 {
+			upper = semver{Minor: v.Minor + 1}
+			if v.Minor == 0 && parts == 3 {
+				upper = semver{Patch: v.Patch + 1}
+			}
+		}
+		return []comparator{{">=", v}, {"<", upperBound(upper)}}, nil
+	case "~":
+		// Allow patch changes, or minor changes if only the major was given
+		upper := semver{Major: v.Major, Minor: v.Minor + 1}
+		if parts == 1 {
+			upper = semver{Major: v.Major + 1}
+		}
+		return []comparator{{">=", v}, {"<", upperBound(upper)}}, nil
+	case "", "=":
+		if parts == 3 {
+			return []comparator{{"=", v}}, nil
+		}
+		// Partial versions match the whole range they name
+		return partialRange(v, parts), nil
+	default:
+		return []comparator{{op, v}}, nil
+	}
+}
+
+// upperBound turns an exclusive upper version into the lowest pre-release of
+// it, so that e.g. "<2.0.0" excludes 2.0.0-rc.1 as well as 2.0.0
+func upperBound(v semver) semver {
+	v.Pre = "0"
+	return v
+}
+
+func partialRange(v semver, parts int) []comparator {
+	switch parts {
+	case 0:
+		return nil
+	case 1:
+		return []comparator{{">=", v}, {"<", upperBound(semver{Major: v.Major + 1})}}
+	default:
+		return []comparator{{">=", v}, {"<", upperBound(semver{Major: v.Major, Minor: v.Minor + 1})}}
+	}
+}
+
+// matches reports whether v satisfies the constraint
+func (c versionConstraint) matches(v semver) bool {
+	for _, group := range c {
+		if groupMatches(group, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func groupMatches(group []comparator, v semver) bool {
+	for _, cmp := range group {
+		result := compareSemver(v, cmp.Version)
+		var ok bool
+		switch cmp.Op {
+		case "=":
+			ok = result == 0
+		case "!=":
+			ok = result != 0
+		case ">":
+			ok = result > 0
+		case ">=":
+			ok = result >= 0
+		case "<":
+			ok = result < 0
+		case "<=":
+			ok = result <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Update levels limit how far `deps update` may move a tag-pinned dependency
+const (
+	updatePatch = "patch" // same major and minor version
+	updateMinor = "minor" // same major version
+	updateMajor = "major" // any newer version
+)
+
+// levelConstraint returns a constraint matching v and the newer versions an
+// update at level may move to
+func levelConstraint(v semver, level string) (string, error) {
+	switch level {
+	case updatePatch:
+		return fmt.Sprintf(">=%s, <%s", v, upperBound(semver{Major: v.Major, Minor: v.Minor + 1})), nil
+	case updateMinor:
+		return fmt.Sprintf(">=%s, <%s", v, upperBound(semver{Major: v.Major + 1})), nil
+	case updateMajor:
+		return fmt.Sprintf(">=%s", v), nil
+	default:
+		return "", fmt.Errorf("unknown update level %q", level)
+	}
+}
+
+// tagInfo is a tag (or branch) and the commit it points to
+type tagInfo struct {
+	Name string
+	SHA  string
+}
+
+// selectTag returns the tag with the highest version matching constraint.
+// Only tags starting with prefix are considered, and the prefix is removed
+// before parsing the version. Pre-release versions are only considered when
+// includePre is set.
+func selectTag(tags []tagInfo, constraint versionConstraint, includePre bool, prefix string) (tagInfo, bool) {
+	var best tagInfo
+	var bestVersion semver
+	found := false
+
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag.Name, prefix) {
+			continue
+		}
+		v, ok := parseSemver(strings.TrimPrefix(tag.Name, prefix))
+		if !ok || (v.Pre != "" && !includePre) || !constraint.matches(v) {
+			continue
+		}
+		if !found || compareSemver(v, bestVersion) > 0 {
+			best, bestVersion, found = tag, v, true
+		}
+	}
+
+	return best, found
+}
+
+// sortTagsBySemver orders tags by descending version, after stripping prefix.
+// Tags that aren't versions keep their order after all versioned tags.
+func sortTagsBySemver(tags []tagInfo, prefix string) {
+	version := func(tag tagInfo) (semver, bool) {
+		if !strings.HasPrefix(tag.Name, prefix) {
+			return semver{}, false
+		}
+		return parseSemver(strings.TrimPrefix(tag.Name, prefix))
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		vi, iOK := version(tags[i])
+		vj, jOK := version(tags[j])
+		if iOK != jOK {
+			return iOK
+		}
+		return iOK && compareSemver(vi, vj) > 0
+	})
+}
@@ -0,0 +1,257 @@
+package main
+
+import "testing"
+
+// --- parseSemver tests ---
+
+func TestParseSemver(t *testing.T) {
+	tests := []struct {
+		input string
+		want  semver
+	}{
+		{"1.2.3", semver{1, 2, 3, ""}},
+		{"v1.2.3", semver{1, 2, 3, ""}},
+		{"v1.2", semver{1, 2, 0, ""}},
+		{"2", semver{2, 0, 0, ""}},
+		{"1.0.0-rc.1", semver{1, 0, 0, "rc.1"}},
+		{"1.0.0+build.5", semver{1, 0, 0, ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, ok := parseSemver(tt.input)
+			if !ok {
+				t.Fatalf("parseSemver(%q) failed", tt.input)
+			}
+			if got != tt.want {
+				t.Errorf("parseSemver(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSemver_Invalid(t *testing.T) {
+	for _, input := range []string{"", "main", "1.2.3.4", "v1.a", "release-"} {
+		if _, ok := parseSemver(input); ok {
+			t.Errorf("parseSemver(%q) succeeded, want failure", input)
+		}
+	}
+}
+
+// --- compareSemver tests ---
+
+func TestCompareSemver(t *testing.T) {
+	ordered := []string{
+		"0.9.9",
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.10.0",
+		"2.0.0",
+	}
+
+	for i := 0; i < len(ordered)-1; i++ {
+		a, _ := parseSemver(ordered[i])
+		b, _ := parseSemver(ordered[i+1])
+		if compareSemver(a, b) != -1 {
+			t.Errorf("expected %s < %s", ordered[i], ordered[i+1])
+		}
+		if compareSemver(b, a) != 1 {
+			t.Errorf("expected %s > %s", ordered[i+1], ordered[i])
+		}
+	}
+}
+
+// --- constraint tests ---
+
+func TestIsConstraint(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"^1.4", true},
+		{"~1.2", true},
+		{">=2,<3", true},
+		{"1.x", true},
+		{"*", true},
+		{"^1 || ^2", true},
+		{"v1.2.3", false},
+		{"main", false},
+		{"feature/x-ray", false},
+		{"abc123def456abc123def456abc123def456abc1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := isConstraint(tt.input); got != tt.want {
+				t.Errorf("isConstraint(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConstraintMatches(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{"^1.4", "1.4.0", true},
+		{"^1.4", "1.9.9", true},
+		{"^1.4", "1.3.9", false},
+		{"^1.4", "2.0.0", false},
+		{"^1.4", "2.0.0-rc.1", false},
+		{"^0.4", "0.4.7", true},
+		{"^0.4", "0.5.0", false},
+		{"^0.0.3", "0.0.4", false},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{"~1", "1.9.0", true},
+		{">=2,<3", "2.5.0", true},
+		{">=2,<3", "3.0.0", false},
+		{">=2 <3", "1.9.0", false},
+		{"1.x", "1.7.2", true},
+		{"1.x", "2.0.0", false},
+		{"1.2", "1.2.5", true},
+		{"1.2.3", "1.2.3", true},
+		{"1.2.3", "1.2.4", false},
+		{"*", "9.9.9", true},
+		{"^1 || ^3", "3.1.0", true},
+		{"^1 || ^3", "2.1.0", false},
+		{"!=1.2.3", "1.2.3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.constraint+" "+tt.version, func(t *testing.T) {
+			c, err := parseConstraint(tt.constraint)
+			if err != nil {
+				t.Fatalf("parseConstraint(%q) error: %v", tt.constraint, err)
+			}
+			v, _ := parseSemver(tt.version)
+			if got := c.matches(v); got != tt.want {
+				t.Errorf("%q matches %q = %v, want %v", tt.constraint, tt.version, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseConstraint_Invalid(t *testing.T) {
+	for _, input := range []string{"^", ">=abc", "||", "^1.2.3.4"} {
+		if _, err := parseConstraint(input); err == nil {
+			t.Errorf("parseConstraint(%q) succeeded, want error", input)
+		}
+	}
+}
+
+// --- selectTag tests ---
+
+func TestSelectTag(t *testing.T) {
+	tags := []tagInfo{
+		{Name: "v1.3.0", SHA: "a"},
+		{Name: "v1.4.2", SHA: "b"},
+		{Name: "v1.5.0-beta.1", SHA: "c"},
+		{Name: "v2.0.0", SHA: "d"},
+		{Name: "latest-build", SHA: "e"},
+	}
+
+	c, _ := parseConstraint("^1.4")
+
+	got, ok := selectTag(tags, c, false, "")
+	if !ok || got.Name != "v1.4.2" {
+		t.Errorf("selectTag without pre-releases = %+v, want v1.4.2", got)
+	}
+
+	got, ok = selectTag(tags, c, true, "")
+	if !ok || got.Name != "v1.5.0-beta.1" {
+		t.Errorf("selectTag with pre-releases = %+v, want v1.5.0-beta.1", got)
+	}
+
+	c, _ = parseConstraint("^3")
+	if _, ok := selectTag(tags, c, false, ""); ok {
+		t.Error("expected no tag to match ^3")
+	}
+}
+
+func TestSelectTag_Prefix(t *testing.T) {
+	tags := []tagInfo{
+		{Name: "component/v1.2.3", SHA: "a"},
+		{Name: "component/v1.3.0", SHA: "b"},
+		{Name: "other/v9.0.0", SHA: "c"},
+		{Name: "v5.0.0", SHA: "d"},
+	}
+
+	c, _ := parseConstraint("*")
+
+	got, ok := selectTag(tags, c, false, "component/")
+	if !ok || got.Name != "component/v1.3.0" {
+		t.Errorf("selectTag with prefix = %+v, want component/v1.3.0", got)
+	}
+
+	got, ok = selectTag([]tagInfo{{Name: "release-2024.05", SHA: "e"}, {Name: "release-2023.12", SHA: "f"}}, c, false, "release-")
+	if !ok || got.Name != "release-2024.05" {
+		t.Errorf("selectTag with date tags = %+v, want release-2024.05", got)
+	}
+}
+
+// --- levelConstraint tests ---
+
+func TestLevelConstraint(t *testing.T) {
+	current := semver{Major: 1, Minor: 4, Patch: 2}
+	tests := []struct {
+		level   string
+		version string
+		want    bool
+	}{
+		{updatePatch, "1.4.5", true},
+		{updatePatch, "1.5.0", false},
+		{updateMinor, "1.9.0", true},
+		{updateMinor, "2.0.0-rc.1", false},
+		{updateMinor, "2.0.0", false},
+		{updateMajor, "3.0.0", true},
+		{updateMajor, "1.4.1", false},
+	}
+
+	for _, tt := range tests {
+		s, err := levelConstraint(current, tt.level)
+		if err != nil {
+			t.Fatalf("levelConstraint(%s) error: %v", tt.level, err)
+		}
+		c, err := parseConstraint(s)
+		if err != nil {
+			t.Fatalf("parseConstraint(%q) error: %v", s, err)
+		}
+		v, _ := parseSemver(tt.version)
+		if got := c.matches(v); got != tt.want {
+			t.Errorf("%s update (%s) matches %s = %v, want %v", tt.level, s, tt.version, got, tt.want)
+		}
+	}
+
+	if _, err := levelConstraint(current, "huge"); err == nil {
+		t.Error("expected error for unknown level, got nil")
+	}
+}
+
+func TestSortTagsBySemver(t *testing.T) {
+	tags := []tagInfo{
+		{Name: "nightly"},
+		{Name: "v1.10.0"},
+		{Name: "v1.2.0"},
+		{Name: "stable"},
+		{Name: "v2.0.0-rc.1"},
+	}
+
+	sortTagsBySemver(tags, "")
+
+	want := []string{"v2.0.0-rc.1", "v1.10.0", "v1.2.0", "nightly", "stable"}
+	for i, name := range want {
+		if tags[i].Name != name {
+			t.Errorf("tags[%d] = %q, want %q", i, tags[i].Name, name)
+		}
+	}
+}
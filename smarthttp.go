@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Resolvers used to look up refs of dependencies fetched over HTTPS
+const (
+	resolverAPI = "api" // the host's REST API (default)
+	resolverGit = "git" // git's smart HTTP ref advertisement, like git ls-remote
+)
+
+// refResolver is the resolver in use, set by configureResolver
+var refResolver = resolverAPI
+
+var githubGitBaseURL = "https://github.com"
+
+// configureResolver selects how refs are resolved. An empty name falls back
+// to the resolver setting (or DEPS_RESOLVER), then to the REST API.
+func configureResolver(name string) error {
+	if name == "" {
+		name = configValue("resolver")
+	}
+	switch name {
+	case "", resolverAPI:
+		refResolver = resolverAPI
+	case resolverGit:
+		refResolver = resolverGit
+	default:
+		return fmt.Errorf("unknown resolver %q (expected %s or %s)", name, resolverAPI, resolverGit)
+	}
+	return nil
+}
+
+// gitRemoteURL returns the HTTPS clone URL of the repository at repoURL
+func gitRemoteURL(repoURL string) (string, error) {
+	if isAzureURL(repoURL) {
+		org, project, repo, err := parseAzureURL(repoURL)
+		if err != nil {
+			return "", fmt.Errorf("parsing URL: %v", err)
+		}
+		return fmt.Sprintf("%s/%s/%s/_git/%s", azureAPIBaseURL, url.PathEscape(org), url.PathEscape(project), url.PathEscape(repo)), nil
+	}
+
+	owner, repo, err := parseGitHubURL(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("parsing URL: %v", err)
+	}
+	return fmt.Sprintf("%s/%s/%s.git", githubGitBaseURL, owner, repo), nil
+}
+
+// lsRemoteHTTP fetches the refs the repository at repoURL advertises over
+// smart HTTP, in the same form as parseLsRemote
+func lsRemoteHTTP(repoURL string) (map[string]string, error) {
+	remote, err := gitRemoteURL(repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	refsURL := remote + "/info/refs?service=git-upload-pack"
+	var resp *http.Response
+	if isAzureURL(repoURL) {
+		resp, err = azureGet(refsURL)
+	} else {
+		resp, err = httpClient.Get(refsURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, &statusError{Service: remote, StatusCode: resp.StatusCode}
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseRefAdvertisement(data)
+}
+
+// parseRefAdvertisement parses the pkt-line encoded response of
+// info/refs?service=git-upload-pack. The first ref carries the capabilities,
+// where the default branch is reported as symref=HEAD:refs/heads/<name>.
+func parseRefAdvertisement(data []byte) (map[string]string, error) {
+	refs := make(map[string]string)
+
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("truncated ref advertisement")
+		}
+		length, err := strconv.ParseUint(string(data[:4]), 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pkt-line length %q", data[:4])
+		}
+		if length == 0 {
+			// Flush packet
+			data = data[4:]
+			continue
+		}
+		if length < 4 || int(length) > len(data) {
+			return nil, fmt.Errorf("invalid pkt-line length %d", length)
+		}
+
+		line := strings.TrimSuffix(string(data[4:length]), "\n")
+		data = data[length:]
+
+		if strings.HasPrefix(line, "ERR ") {
+			return nil, fmt.Errorf("remote error: %s", strings.TrimPrefix(line, "ERR "))
+		}
+		if strings.HasPrefix(line, "# service=") {
+			continue
+		}
+
+		line, capabilities, _ := strings.Cut(line, "\x00")
+		for _, capability := range strings.Fields(capabilities) {
+			if symref, ok := strings.CutPrefix(capability, "symref="); ok {
+				name, target, _ := strings.Cut(symref, ":")
+				refs["symref:"+name] = target
+			}
+		}
+
+		sha, name, ok := strings.Cut(line, " ")
+		// An empty repository advertises "capabilities^{}" with a zero ID
+		if ok && name != "capabilities^{}" {
+			refs[name] = sha
+		}
+	}
+
+	return refs, nil
+}
+
+// resolveRefGit resolves ref from the repository's smart HTTP ref advertisement
+func resolveRefGit(repoURL, ref string) (sha, resolvedRef string, err error) {
+	if isFullSHA(ref) {
+		return ref, ref, nil
+	}
+
+	refs, err := lsRemoteHTTP(repoURL)
+	if err != nil {
+		return "", "", err
+	}
+	return resolveFromRefs(refs, ref)
+}
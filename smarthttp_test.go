@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// pktLine encodes s as a git pkt-line
+func pktLine(s string) string {
+	return fmt.Sprintf("%04x%s", len(s)+4, s)
+}
+
+// refAdvertisement builds an info/refs response advertising HEAD -> main
+func refAdvertisement(lines ...string) string {
+	var b strings.Builder
+	b.WriteString(pktLine("# service=git-upload-pack\n"))
+	b.WriteString("0000")
+	for i, line := range lines {
+		if i == 0 {
+			line += "\x00multi_ack symref=HEAD:refs/heads/main agent=git/2.40"
+		}
+		b.WriteString(pktLine(line + "\n"))
+	}
+	b.WriteString("0000")
+	return b.String()
+}
+
+// useResolver switches refResolver for the duration of a test
+func useResolver(t *testing.T, resolver string) {
+	t.Helper()
+	orig := refResolver
+	refResolver = resolver
+	t.Cleanup(func() { refResolver = orig })
+}
+
+// testGitServer points githubGitBaseURL at a test server
+func testGitServer(t *testing.T, mux *http.ServeMux) func() {
+	t.Helper()
+	cleanup := testGitHubServer(t, mux)
+	orig := githubGitBaseURL
+	githubGitBaseURL = githubAPIBaseURL
+	return func() {
+		githubGitBaseURL = orig
+		cleanup()
+	}
+}
+
+func TestParseRefAdvertisement(t *testing.T) {
+	data := refAdvertisement(
+		"1111111111111111111111111111111111111111 HEAD",
+		"1111111111111111111111111111111111111111 refs/heads/main",
+		"2222222222222222222222222222222222222222 refs/tags/v1.0.0",
+		"3333333333333333333333333333333333333333 refs/tags/v1.0.0^{}",
+	)
+
+	refs, err := parseRefAdvertisement([]byte(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{
+		"HEAD":                "1111111111111111111111111111111111111111",
+		"symref:HEAD":         "refs/heads/main",
+		"refs/heads/main":     "1111111111111111111111111111111111111111",
+		"refs/tags/v1.0.0":    "2222222222222222222222222222222222222222",
+		"refs/tags/v1.0.0^{}": "3333333333333333333333333333333333333333",
+	}
+	if len(refs) != len(want) {
+		t.Errorf("refs = %v, want %v", refs, want)
+	}
+	for name, sha := range want {
+		if refs[name] != sha {
+			t.Errorf("refs[%s] = %q, want %q", name, refs[name], sha)
+		}
+	}
+}
+
+func TestParseRefAdvertisement_Errors(t *testing.T) {
+	for _, data := range []string{"00", "zzzz", "00ffshort", pktLine("ERR access denied\n")} {
+		if _, err := parseRefAdvertisement([]byte(data)); err == nil {
+			t.Errorf("expected error for %q, got nil", data)
+		}
+	}
+}
+
+func TestResolveDependency_GitResolver(t *testing.T) {
+	useResolver(t, resolverGit)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/testowner/testrepo.git/info/refs", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("service") != "git-upload-pack" {
+			t.Errorf("service = %q", r.URL.Query().Get("service"))
+		}
+		fmt.Fprint(w, refAdvertisement(
+			"1111111111111111111111111111111111111111 HEAD",
+			"1111111111111111111111111111111111111111 refs/heads/main",
+			"2222222222222222222222222222222222222222 refs/tags/v1.0.0",
+			"3333333333333333333333333333333333333333 refs/tags/v1.0.0^{}",
+			"4444444444444444444444444444444444444444 refs/tags/v1.1.0",
+		))
+	})
+	mux.HandleFunc("/repos/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected REST request: %s", r.URL.Path)
+	})
+
+	cleanup := testGitServer(t, mux)
+	defer cleanup()
+
+	repoURL := "github.com/testowner/testrepo"
+	tests := []struct {
+		dep     Dependency
+		wantSHA string
+		wantRef string
+	}{
+		{Dependency{}, "1111111111111111111111111111111111111111", "main"},
+		{Dependency{Ref: "main"}, "1111111111111111111111111111111111111111", "main"},
+		{Dependency{Ref: "v1.0.0"}, "3333333333333333333333333333333333333333", "v1.0.0"},
+		{Dependency{Constraint: "^1"}, "4444444444444444444444444444444444444444", "v1.1.0"},
+	}
+
+	for _, tt := range tests {
+		sha, ref, err := resolveDependency(repoURL, tt.dep)
+		if err != nil {
+			t.Fatalf("resolveDependency(%+v) error: %v", tt.dep, err)
+		}
+		if sha != tt.wantSHA || ref != tt.wantRef {
+			t.Errorf("resolveDependency(%+v) = (%q, %q), want (%q, %q)", tt.dep, sha, ref, tt.wantSHA, tt.wantRef)
+		}
+	}
+
+	if _, _, err := resolveDependency(repoURL, Dependency{Ref: "nope"}); err == nil {
+		t.Error("expected error for unknown ref, got nil")
+	}
+}
+
+func TestGitRemoteURL(t *testing.T) {
+	got, err := gitRemoteURL("github.com/testowner/testrepo//sub")
+	if err != nil || got != githubGitBaseURL+"/testowner/testrepo.git" {
+		t.Errorf("gitRemoteURL = %q, %v", got, err)
+	}
+	got, err = gitRemoteURL("dev.azure.com/org/my project/_git/repo")
+	if err != nil || got != azureAPIBaseURL+"/org/my%20project/_git/repo" {
+		t.Errorf("Azure gitRemoteURL = %q, %v", got, err)
+	}
+}
+
+func TestConfigureResolver(t *testing.T) {
+	useResolver(t, resolverAPI)
+
+	if err := configureResolver("git"); err != nil || refResolver != resolverGit {
+		t.Errorf("configureResolver(git) = %v, resolver %q", err, refResolver)
+	}
+	t.Setenv("DEPS_RESOLVER", "api")
+	if err := configureResolver(""); err != nil || refResolver != resolverAPI {
+		t.Errorf("configureResolver from env = %v, resolver %q", err, refResolver)
+	}
+	if err := configureResolver("svn"); err == nil {
+		t.Error("expected error for unknown resolver, got nil")
+	}
+}
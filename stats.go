@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// statsEntry is the disk usage of one installed dependency, for deps stats
+type statsEntry struct {
+	Repo  string `json:"repo"`
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	Files int    `json:"files"`
+}
+
+// depsStats is what deps stats reports: the installed dependencies, largest
+// first, what else is in .deps, and what the user's cache holds. Sizes are
+// apparent sizes, so files hardlinked between dependencies count once for
+// each.
+type depsStats struct {
+	Dependencies []statsEntry `json:"dependencies"`
+	Missing      int          `json:"missing"`     // locked dependencies that aren't installed
+	Other        int64        `json:"other"`       // size of the paths deps prune would remove
+	OtherPaths   int          `json:"other_paths"` // how many there are
+	Total        int64        `json:"total"`       // everything in .deps
+	Cache        cacheStats   `json:"cache"`
+}
+
+// cacheStats is the size of each part of the user's cache
+type cacheStats struct {
+	Entries int   `json:"entries"` // trees in the download cache
+	Trees   int64 `json:"trees"`   // their size
+	HTTP    int64 `json:"http"`    // the API response cache
+	Store   int64 `json:"store"`   // objects in the content-addressed store
+}
+
+// collectStats measures what the dependencies of lockFile take up on disk,
+// without using the network
+func collectStats(lockFile *LockFile) (depsStats, error) {
+	stats := depsStats{Dependencies: []statsEntry{}}
+	for _, repoURL := range sortedKeys(lockFile.Dependencies) {
+		depPath := getDepPath(repoURL)
+		size, files, err := treeUsage(depPath)
+		if os.IsNotExist(err) {
+			stats.Missing++
+			continue
+		}
+		if err != nil {
+			return stats, fmt.Errorf("%s: %v", repoURL, err)
+		}
+		stats.Dependencies = append(stats.Dependencies, statsEntry{Repo: repoURL, Path: filepath.ToSlash(depPath), Size: size, Files: files})
+		stats.Total += size
+	}
+	sort.SliceStable(stats.Dependencies, func(i, j int) bool {
+		return stats.Dependencies[i].Size > stats.Dependencies[j].Size
+	})
+
+	unreferenced, err := findUnreferenced(lockFile)
+	if err != nil {
+		return stats, err
+	}
+	for _, path := range unreferenced {
+		stats.Other += pathSize(path)
+	}
+	stats.OtherPaths = len(unreferenced)
+	stats.Total += stats.Other
+
+	// The cache is only reported; one that can't be read counts as empty
+	if entries, _, err := listCacheEntries(); err == nil {
+		stats.Cache.Entries = len(entries)
+		for _, entry := range entries {
+			stats.Cache.Trees += entry.Size
+		}
+	}
+	if dir, err := httpCacheDir(); err == nil {
+		stats.Cache.HTTP, _ = dirSize(dir)
+	}
+	if trees, _, err := listStoreTrees(); err == nil {
+		if objects, _, err := listStoreObjects(trees); err == nil {
+			for _, object := range objects {
+				stats.Cache.Store += object.Size
+			}
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCollectStats(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	t.Setenv("DEPS_CACHE_DIR", t.TempDir())
+
+	lockFile := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/user/small":   {Ref: "main", SHA: "1111111111111111111111111111111111111111"},
+		"github.com/user/large":   {Ref: "main", SHA: "2222222222222222222222222222222222222222"},
+		"github.com/user/missing": {Ref: "main", SHA: "3333333333333333333333333333333333333333"},
+	}}
+	writeTree(t, filepath.Join(".deps", "github.com", "user", "small"), map[string]string{"a.txt": "hi"})
+	writeTree(t, filepath.Join(".deps", "github.com", "user", "large"), map[string]string{"a.txt": "hello", "sub/b.txt": "world!"})
+	writeTree(t, filepath.Join(".deps", "github.com", "user", "removed"), map[string]string{"c.txt": "leftover"})
+
+	stats, err := collectStats(lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []statsEntry{
+		{Repo: "github.com/user/large", Path: ".deps/github.com/user/large", Size: 11, Files: 2},
+		{Repo: "github.com/user/small", Path: ".deps/github.com/user/small", Size: 2, Files: 1},
+	}
+	if len(stats.Dependencies) != len(want) {
+		t.Fatalf("dependencies = %+v", stats.Dependencies)
+	}
+	for i := range want {
+		if stats.Dependencies[i] != want[i] {
+			t.Errorf("dependencies[%d] = %+v, want %+v", i, stats.Dependencies[i], want[i])
+		}
+	}
+	if stats.Missing != 1 || stats.OtherPaths != 1 || stats.Other != 8 || stats.Total != 21 {
+		t.Errorf("missing %d, other %d paths (%d bytes), total %d", stats.Missing, stats.OtherPaths, stats.Other, stats.Total)
+	}
+	if stats.Cache != (cacheStats{}) {
+		t.Errorf("cache = %+v, want it empty", stats.Cache)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"os"
+)
+
+// statusSummary counts the dependencies of a lock file by state, for deps
+// status. A dependency is counted once among installed, missing and stale,
+// and may also be dirty or outdated.
+type statusSummary struct {
+	Total     int
+	Installed int
+	Missing   int
+	Stale     int // installed, but .deps.sums records another commit there
+	Dirty     int // installed files differ from .deps.sums
+	Outdated  int // its ref resolves to a newer commit
+	Unchecked int // couldn't be resolved, or wasn't because of --offline
+	Frozen    int
+
+	// Unreferenced counts the paths under .deps no dependency is installed in
+	Unreferenced int
+
+	// The lock file's state: the format version it was read in, whether
+	// deps fmt would change it and how many problems deps validate finds
+	Version   int
+	Formatted bool
+	Problems  int
+}
+
+// lockFileState fills in the lock file fields of summary from its data
+func lockFileState(summary *statusSummary, path string, data []byte) {
+	var err error
+	if isTOMLLockFile(path) {
+		_, summary.Version, err = parseTOMLLockFile(data)
+		summary.Problems = len(validateTOMLLockData(data))
+	} else {
+		_, summary.Version, err = parseLockFile(data)
+		summary.Problems = len(validateLockData(data))
+	}
+	if err != nil {
+		return
+	}
+	formatted, err := formatLockData(path, data)
+	summary.Formatted = err == nil && bytes.Equal(formatted, data)
+}
+
+// summarizeStatus counts the dependencies of lockFile by state. Only the
+// installed files are read, plus one lookup per dependency to tell whether
+// it is outdated unless offline is set.
+func summarizeStatus(lockFile *LockFile, sums map[string]depSums, offline bool) (statusSummary, error) {
+	summary := statusSummary{Total: len(lockFile.Dependencies)}
+	entries, err := listDependencies(lockFile, sums)
+	if err != nil {
+		return summary, err
+	}
+	if !offline {
+		prefetchRefs(lockFile)
+	}
+
+	for _, entry := range entries {
+		dep := lockFile.Dependencies[entry.Repo]
+		switch entry.Status {
+		case listMissing:
+			summary.Missing++
+		case listStale:
+			summary.Stale++
+		default:
+			summary.Installed++
+			if verified, err := verifyDependency(entry.Repo, dep, sums); err == nil && !verified.ok() {
+				summary.Dirty++
+			}
+		}
+
+		switch {
+		case dep.frozen():
+			summary.Frozen++
+		case offline:
+			summary.Unchecked++
+		default:
+			sha, _, err := resolveDependency(entry.Repo, dep)
+			if err != nil {
+				summary.Unchecked++
+				if runContext.Err() != nil {
+					return summary, runContext.Err()
+				}
+			} else if sha != dep.SHA {
+				summary.Outdated++
+			}
+		}
+	}
+
+	unreferenced, err := findUnreferenced(lockFile)
+	if err != nil {
+		return summary, err
+	}
+	summary.Unreferenced = len(unreferenced)
+	return summary, nil
+}
+
+// readLockData reads the lock file in use, returning nil if there isn't one
+func readLockData() ([]byte, error) {
+	data, err := os.ReadFile(lockFilePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSummarizeStatus_Offline(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	lockFile := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/user/clean":   {Ref: "main", SHA: "1111111111111111111111111111111111111111"},
+		"github.com/user/dirty":   {Ref: "main", SHA: "2222222222222222222222222222222222222222"},
+		"github.com/user/missing": {Ref: "main", SHA: "3333333333333333333333333333333333333333"},
+		"github.com/user/stale":   {Ref: "v1.0.0", SHA: "4444444444444444444444444444444444444444", Pinned: true},
+	}}
+	for _, name := range []string{"clean", "dirty", "stale"} {
+		writeTree(t, filepath.Join(".deps", "github.com", "user", name), map[string]string{"a.txt": "original"})
+	}
+	writeTree(t, filepath.Join(".deps", "github.com", "user", "old"), map[string]string{"a.txt": "leftover"})
+
+	files, err := hashTreeFiles(filepath.Join(".deps", "github.com", "user", "clean"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sums := map[string]depSums{
+		"github.com/user/clean": {SHA: "1111111111111111111111111111111111111111", Files: files},
+		"github.com/user/dirty": {SHA: "2222222222222222222222222222222222222222", Files: files},
+		"github.com/user/stale": {SHA: "5555555555555555555555555555555555555555", Files: files},
+	}
+	writeTree(t, filepath.Join(".deps", "github.com", "user", "dirty"), map[string]string{"a.txt": "edited"})
+
+	summary, err := summarizeStatus(lockFile, sums, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := statusSummary{Total: 4, Installed: 2, Missing: 1, Stale: 1, Dirty: 1, Unchecked: 3, Frozen: 1, Unreferenced: 1}
+	if summary != want {
+		t.Errorf("summary = %+v, want %+v", summary, want)
+	}
+}
+
+func TestLockFileState(t *testing.T) {
+	formatted := "{\n  \"version\": 1,\n  \"dependencies\": {}\n}\n"
+	tests := []struct {
+		data      string
+		version   int
+		formatted bool
+		problems  bool
+	}{
+		{formatted, 1, true, false},
+		{`{"version": 1, "dependencies": {}}`, 1, false, false},
+		{`{"dependencies": {}}`, 0, false, false},
+		{`{"version": 1, "dependencies": {"gitlab.com/x/y": {"ref": "main", "sha": "1"}}}`, 1, false, true},
+	}
+	for _, tt := range tests {
+		var summary statusSummary
+		lockFileState(&summary, ".deps.lock", []byte(tt.data))
+		if summary.Version != tt.version || summary.Formatted != tt.formatted || (summary.Problems > 0) != tt.problems {
+			t.Errorf("lockFileState(%s) = version %d, formatted %v, %d problems", tt.data, summary.Version, summary.Formatted, summary.Problems)
+		}
+	}
+}
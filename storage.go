@@ -2,15 +2,21 @@ package main
 
 import (
 	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
 	"compress/gzip"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"time"
 )
 
 // ANSI color codes
@@ -21,21 +27,55 @@ const (
 	colorYellow = "\033[33m"
 )
 
+// Values of --color
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// colorMode is set by --color or the color setting
+var colorMode = colorAuto
+
+// configureColor sets when output is colored: always, never, or with auto
+// (the default) only on a terminal, unless NO_COLOR is set or TERM is dumb.
+// An empty mode falls back to the color setting.
+func configureColor(mode string) error {
+	if mode == "" {
+		mode = configValue("color")
+	}
+	switch mode {
+	case "":
+		colorMode = colorAuto
+	case colorAuto, colorAlways, colorNever:
+		colorMode = mode
+	default:
+		return fmt.Errorf("invalid color mode %q (use %s, %s or %s)", mode, colorAuto, colorAlways, colorNever)
+	}
+	return nil
+}
+
 // Check if output supports colors
 func supportsColor() bool {
+	switch colorMode {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	}
 	if os.Getenv("NO_COLOR") != "" {
 		return false
 	}
 	if os.Getenv("TERM") == "dumb" {
 		return false
 	}
-	return isatty()
+	return isatty(logOutput())
 }
 
-// Simple TTY check (works on Unix-like systems)
-func isatty() bool {
-	fd := os.Stdout.Fd()
-	return fd == 1 || fd == 2 // stdout or stderr
+// isatty reports whether f is a terminal rather than a pipe or a file
+func isatty(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
 // Colorize text if colors are supported
@@ -47,34 +87,238 @@ func colorize(color, text string) string {
 }
 
 type LockFile struct {
+	// Version is the lock file format version (lockFileVersion when written);
+	// files from before versioning have none and read as 0
+	Version      int                   `json:"version"`
 	Dependencies map[string]Dependency `json:"dependencies"`
+	// Profiles are named sets of overrides, keyed by the dependency each
+	// replaces, that --profile swaps in (see applyProfile)
+	Profiles map[string]map[string]ProfileOverride `json:"profiles,omitempty"`
+	// Resolution decides between submodules pinned at different commits
+	Resolution *Resolution `json:"resolution,omitempty"`
+	// Tasks are shell commands deps run runs by name (see runTask)
+	Tasks map[string]string `json:"tasks,omitempty"`
+
+	// comments are those of a TOML lock file, written back when it is saved
+	comments map[string]tomlComment
+	// profile is how the active profile was applied, undone when saving
+	profile *appliedProfile
+}
+
+// Lock file names: JSON is the default, TOML allows comments
+const (
+	jsonLockFile = ".deps.lock"
+	tomlLockFile = ".deps.toml"
+)
+
+// lockFileOverride is the lock file given by --lockfile or the lockfile setting
+var lockFileOverride string
+
+// configureLockFile uses path, or the lockfile setting when path is empty, as
+// the lock file instead of .deps.lock, so one repository can keep several
+// independent sets of dependencies
+func configureLockFile(path string) {
+	if path == "" {
+		path = configValue("lockfile")
+	}
+	lockFileOverride = path
+}
+
+// lockFilePath returns the lock file in use: the --lockfile one if given,
+// else .deps.toml if there is one and no .deps.lock, otherwise .deps.lock
+func lockFilePath() string {
+	if lockFileOverride != "" {
+		return lockFileOverride
+	}
+	if _, err := os.Stat(jsonLockFile); os.IsNotExist(err) {
+		if _, err := os.Stat(tomlLockFile); err == nil {
+			return tomlLockFile
+		}
+	}
+	return jsonLockFile
+}
+
+// convertedLockFilePath returns where path goes when converted to TOML (or
+// back to JSON): the same name with a .toml (or .lock) extension
+func convertedLockFilePath(path string, toTOML bool) string {
+	ext := ".lock"
+	if toTOML {
+		ext = ".toml"
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ext
+}
+
+// isTOMLLockFile reports whether path is a TOML lock file
+func isTOMLLockFile(path string) bool {
+	return strings.HasSuffix(path, ".toml")
+}
+
+// lockFileVersion is the newest lock file format this binary understands
+const lockFileVersion = 1
+
+// lockFileMigrations upgrade a lock file from version i to i+1. Older files
+// are migrated in memory when read and written back in the current format.
+var lockFileMigrations = []func(*LockFile){
+	// 0 → 1 only adds the version field
+	func(*LockFile) {},
+}
+
+// lockVersionError reports a lock file written by a newer version of deps
+type lockVersionError struct {
+	Version int
+}
+
+func (e *lockVersionError) Error() string {
+	return fmt.Sprintf("the lock file is format version %d, but this deps only understands up to version %d; upgrade deps", e.Version, lockFileVersion)
+}
+
+// migrateLockFile upgrades lockFile to lockFileVersion, returning the version
+// it started at
+func migrateLockFile(lockFile *LockFile) (int, error) {
+	from := lockFile.Version
+	if from > lockFileVersion {
+		return from, &lockVersionError{Version: from}
+	}
+	for v := from; v < lockFileVersion; v++ {
+		lockFileMigrations[v](lockFile)
+	}
+	lockFile.Version = lockFileVersion
+	return from, nil
 }
 
 type Dependency struct {
-	Ref  string `json:"ref"`
-	SHA  string `json:"sha"`
+	// Ref and SHA are empty for a URL source, which Hash pins instead
+	Ref  string `json:"ref,omitempty"`
+	SHA  string `json:"sha,omitempty"`
 	Hash string `json:"hash,omitempty"`
+	// TreeHash is a SHA-256 of the extracted files (see hashTree), verified
+	// on install alongside Hash
+	TreeHash string `json:"tree_hash,omitempty"`
+	// Transport is "ssh" for dependencies fetched over git+SSH, empty for HTTPS
+	Transport string `json:"transport,omitempty"`
+	// Submodules requests that git submodules are downloaded at their pins
+	Submodules bool `json:"submodules,omitempty"`
+	// LFS requests that Git LFS pointer files are replaced with their content
+	LFS bool `json:"lfs,omitempty"`
+	// Constraint is a semver range (e.g. "^1.4") that updates resolve against;
+	// Ref then holds the tag that was selected
+	Constraint string `json:"constraint,omitempty"`
+	// Pre allows pre-release tags when resolving constraints and "latest"
+	Pre bool `json:"pre,omitempty"`
+	// TagPrefix limits version resolution to tags like "component/v1.2.3";
+	// the prefix is stripped before parsing the version
+	TagPrefix string `json:"tag_prefix,omitempty"`
+	// Pinned freezes the dependency at SHA; updates skip it while the ref or
+	// constraint is kept so it can resume tracking when unpinned
+	Pinned bool `json:"pinned,omitempty"`
+	// Strip removes that many more leading directories from every file, and
+	// Rename moves files and directories (see transformPath). Both apply on
+	// extraction, before Only and Exclude.
+	Strip  int               `json:"strip,omitempty"`
+	Rename map[string]string `json:"rename,omitempty"`
+	// Only and Exclude are globs (see matchGlob) selecting which files of the
+	// download are kept; everything else is removed before hashing
+	Only    []string `json:"only,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	// MaxSize is the most the installed files may add up to, like "500M",
+	// in place of the max-dep-size setting (see checkSizeBudget)
+	MaxSize string `json:"max_size,omitempty"`
+	// PostInstall is a shell command run in the installed directory after
+	// each download, once the user allows it (see runPostInstall)
+	PostInstall string `json:"post_install,omitempty"`
+	// Alias is a short name accepted in place of the URL by commands, and the
+	// directory under .deps it is installed in
+	Alias string `json:"alias,omitempty"`
+	// Policy declares how `deps update` may move the dependency (policyFrozen,
+	// policyFollowBranch or policySemverRange); empty infers it from the entry
+	Policy string `json:"policy,omitempty"`
+	// Metadata records how and when the dependency was resolved, for audits
+	// and reports; it plays no part in installing
+	Metadata *DependencyMetadata `json:"metadata,omitempty"`
+}
+
+// DependencyMetadata describes a resolved dependency. Everything is best
+// effort: fields that couldn't be looked up are left empty.
+type DependencyMetadata struct {
+	RefKind     string `json:"ref_kind,omitempty"` // "branch", "tag" or "sha"
+	ResolvedAt  string `json:"resolved_at,omitempty"`
+	License     string `json:"license,omitempty"`
+	Description string `json:"description,omitempty"`
+	TarballURL  string `json:"tarball_url,omitempty"`
+}
+
+// Update policies a dependency can declare
+const (
+	policyFrozen       = "frozen"        // never updated
+	policyFollowBranch = "follow-branch" // tracks the tip of the branch in ref
+	policySemverRange  = "semver-range"  // moves to the highest tag matching constraint
+	policyAuto         = "auto"          // clears the policy
+)
+
+// frozen reports whether updates must leave the dependency at its SHA
+func (dep Dependency) frozen() bool {
+	return dep.Pinned || dep.Policy == policyFrozen
+}
+
+// frozenLabel describes why a frozen dependency isn't updated
+func (dep Dependency) frozenLabel() string {
+	if dep.Pinned {
+		return "pinned"
+	}
+	return policyFrozen
+}
+
+// newDependency returns a dependency tracking ref, treating version
+// constraints like "^1.4" as a constraint whose selected tag is pinned later
+func newDependency(ref string) Dependency {
+	if isConstraint(ref) {
+		return Dependency{Constraint: ref}
+	}
+	return Dependency{Ref: ref}
+}
+
+// refSpec describes what the dependency tracks: its constraint if it has one,
+// otherwise its ref
+func (dep Dependency) refSpec() string {
+	if dep.Constraint != "" {
+		return dep.Constraint
+	}
+	return dep.Ref
 }
 
 type CheckResult struct {
-	Status    string // "ok", "missing", "update_available"
+	Status    string // "ok", "missing", "update_available", "pinned"
 	LatestSHA string // populated when Status == "update_available"
+	RenamedTo string // canonical URL if the repo has been renamed or transferred
 }
 
 func loadLockFile() *LockFile {
-	lockFile := &LockFile{
-		Dependencies: make(map[string]Dependency),
-	}
+	return loadProfileLockFile(false)
+}
 
-	data, err := os.ReadFile(".deps.lock")
-	if err != nil {
+// loadProfileLockFile is loadLockFile, but when create is set the active
+// profile is started if the lock file doesn't have it yet
+func loadProfileLockFile(create bool) *LockFile {
+	lockFile, err := readProfileLockFile(create)
+	if os.IsNotExist(err) {
 		// File doesn't exist, return empty lock file
-		return lockFile
+		return &LockFile{
+			Dependencies: make(map[string]Dependency),
+		}
+	}
+	var versionErr *lockVersionError
+	if errors.As(err, &versionErr) {
+		// Rewriting a newer format would silently drop what it added
+		errorf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	var profileErr *profileError
+	if errors.As(err, &profileErr) {
+		errorf("Error: %v\n", err)
+		os.Exit(1)
 	}
-
-	err = json.Unmarshal(data, lockFile)
 	if err != nil {
-		fmt.Printf("Warning: could not parse existing .deps.lock: %v\n", err)
+		warnf("Warning: could not parse existing %s: %v\n", lockFilePath(), err)
 		return &LockFile{
 			Dependencies: make(map[string]Dependency),
 		}
@@ -83,13 +327,125 @@ func loadLockFile() *LockFile {
 	return lockFile
 }
 
+// readLockFile reads the lock file with the active profile applied,
+// returning an error if it is missing or can't be parsed
+func readLockFile() (*LockFile, error) {
+	return readProfileLockFile(false)
+}
+
+// readProfileLockFile is readLockFile, but when create is set the active
+// profile is started if the lock file doesn't have it yet
+func readProfileLockFile(create bool) (*LockFile, error) {
+	lockFile, _, err := readLockFileAt(lockFilePath())
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := lockFile.Profiles[activeProfile]; create && activeProfile != "" && !exists {
+		if lockFile.Profiles == nil {
+			lockFile.Profiles = make(map[string]map[string]ProfileOverride)
+		}
+		lockFile.Profiles[activeProfile] = make(map[string]ProfileOverride)
+	}
+	if err := applyProfile(lockFile, activeProfile); err != nil {
+		return nil, err
+	}
+	registerAliases(lockFile)
+	return lockFile, nil
+}
+
+// readLockFileAt reads a JSON or TOML lock file, also returning the format
+// version it was written in
+func readLockFileAt(path string) (*LockFile, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if isTOMLLockFile(path) {
+		return parseTOMLLockFile(data)
+	}
+	return parseLockFile(data)
+}
+
+// parseLockFile parses and migrates lock file data, also returning the
+// format version it was written in
+func parseLockFile(data []byte) (*LockFile, int, error) {
+	lockFile := &LockFile{}
+	err := json.Unmarshal(data, lockFile)
+	if err != nil {
+		return nil, 0, err
+	}
+	if lockFile.Dependencies == nil {
+		lockFile.Dependencies = make(map[string]Dependency)
+	}
+	from, err := migrateLockFile(lockFile)
+	if err != nil {
+		return nil, from, err
+	}
+	return lockFile, from, nil
+}
+
+// checkFrozen reports every lock entry that a frozen install couldn't
+// reproduce exactly: entries without a full commit SHA to download, and
+// entries without a hash to verify the download against
+func checkFrozen(lockFile *LockFile) []error {
+	var problems []error
+	for _, repoURL := range sortedKeys(lockFile.Dependencies) {
+		dep := lockFile.Dependencies[repoURL]
+		// A URL source is pinned by the hash of its download alone
+		if isURLSource(repoURL) {
+			if dep.Hash == "" {
+				problems = append(problems, fmt.Errorf("%s: no hash recorded to pin the download", repoURL))
+			}
+			continue
+		}
+		if !isFullSHA(dep.SHA) {
+			problems = append(problems, fmt.Errorf("%s: ref %s is not resolved to a full commit SHA", repoURL, dep.refSpec()))
+			continue
+		}
+		// Subdirectories fetched without their tarball only have a tree hash
+		if dep.Hash == "" && dep.TreeHash == "" {
+			problems = append(problems, fmt.Errorf("%s: no hash or tree_hash recorded to verify the download", repoURL))
+		}
+	}
+	return problems
+}
+
+// saveLockFile writes lockFile, returning the overrides of the active
+// profile to the profile
 func saveLockFile(lockFile *LockFile) error {
-	data, err := json.MarshalIndent(lockFile, "", "  ")
+	return writeLockFileAt(lockFilePath(), unapplyProfile(lockFile))
+}
+
+// writeLockFileAt writes lockFile to path as JSON, or as TOML if path ends
+// in .toml
+func writeLockFileAt(path string, lockFile *LockFile) error {
+	lockFile.Version = lockFileVersion
+	marshal := marshalLockFile
+	if isTOMLLockFile(path) {
+		marshal = marshalTOMLLockFile
+	}
+	data, err := marshal(lockFile)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(".deps.lock", data, 0644)
+	return os.WriteFile(path, data, 0644)
+}
+
+// marshalLockFile renders lockFile canonically, so that the same content
+// always produces the same bytes: two-space indentation, dependencies sorted
+// by URL, fields in declaration order, no HTML escaping and a trailing newline
+func marshalLockFile(lockFile *LockFile) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	// Encode sorts map keys and ends the document with a newline
+	err := enc.Encode(lockFile)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
 func checkDependency(repoURL string, dep Dependency) (CheckResult, error) {
@@ -99,193 +455,1694 @@ func checkDependency(repoURL string, dep Dependency) (CheckResult, error) {
 		return CheckResult{Status: "missing"}, nil
 	}
 
-	// Resolve the current SHA for the tracked ref to detect updates
-	owner, repo, err := parseGitHubURL(repoURL)
-	if err != nil {
-		return CheckResult{}, fmt.Errorf("parsing URL: %v", err)
+	// A URL source has nothing to resolve: its hash is checked on install
+	if isURLSource(repoURL) {
+		return CheckResult{Status: "ok"}, nil
+	}
+	if dep.frozen() {
+		return CheckResult{Status: "pinned"}, nil
 	}
 
-	currentSHA, _, err := resolveRef(owner, repo, dep.Ref)
+	// Resolve the current SHA for the tracked ref to detect updates
+	currentSHA, _, err := resolveDependency(repoURL, dep)
 	if err != nil {
-		return CheckResult{}, fmt.Errorf("resolving ref %s: %v", dep.Ref, err)
+		return CheckResult{}, fmt.Errorf("resolving ref %s: %w", dep.refSpec(), err)
 	}
 
+	result := CheckResult{Status: "ok"}
 	if currentSHA != dep.SHA {
-		return CheckResult{Status: "update_available", LatestSHA: currentSHA}, nil
+		result = CheckResult{Status: "update_available", LatestSHA: currentSHA}
 	}
 
-	return CheckResult{Status: "ok"}, nil
+	// A failed lookup shouldn't fail the check; the ref already resolved
+	result.RenamedTo = renamedKey(repoURL, dep)
+
+	return result, nil
 }
 
-func updateDependency(repoURL string, dep Dependency, lockFile *LockFile) bool {
-	owner, repo, err := parseGitHubURL(repoURL)
-	if err != nil {
-		fmt.Printf("✗ Error parsing URL %s: %v\n", repoURL, err)
-		return false
+// renameDependency moves oldURL's lock entry and installed directory to newURL
+func renameDependency(lockFile *LockFile, oldURL, newURL string) error {
+	if _, exists := lockFile.Dependencies[newURL]; exists {
+		return fmt.Errorf("%s is already in .deps.lock", newURL)
+	}
+
+	// Aliased dependencies stay where they are
+	oldPath := getDepPath(oldURL)
+	if _, err := os.Stat(oldPath); err == nil && depAliases[oldURL] == "" {
+		newPath := getDepPath(newURL)
+		err = os.MkdirAll(filepath.Dir(newPath), 0755)
+		if err != nil {
+			return err
+		}
+		err = os.Rename(oldPath, newPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	lockFile.Dependencies[newURL] = lockFile.Dependencies[oldURL]
+	delete(lockFile.Dependencies, oldURL)
+	registerAliases(lockFile)
+	return nil
+}
+
+// removeDependency deletes a lock entry along with its installed directory
+// and recorded checksums
+func removeDependency(lockFile *LockFile, repoURL string) error {
+	if _, exists := lockFile.Dependencies[repoURL]; !exists {
+		return fmt.Errorf("dependency %s not found in .deps.lock", repoURL)
 	}
 
-	// Resolve current state of the original ref
-	currentSHA, currentRef, err := resolveRef(owner, repo, dep.Ref)
+	err := os.RemoveAll(getDepPath(repoURL))
 	if err != nil {
-		fmt.Printf("%s Error resolving %s@%s: %v\n", colorize(colorRed, "✗"), repoURL, dep.Ref, err)
-		return false
+		return err
+	}
+	sums, err := loadSums()
+	if err != nil {
+		return fmt.Errorf("updating %s: %v", sumsFilePath(), err)
+	}
+	if _, exists := sums[repoURL]; exists {
+		delete(sums, repoURL)
+		if err := saveSums(sums); err != nil {
+			return fmt.Errorf("updating %s: %v", sumsFilePath(), err)
+		}
 	}
 
-	if currentSHA == dep.SHA {
-		fmt.Printf("%s %s@%s (%s) - no update available\n", colorize(colorGreen, "✓"), repoURL, dep.Ref, dep.SHA[:8])
-		return false
+	delete(lockFile.Dependencies, repoURL)
+	registerAliases(lockFile)
+	return nil
+}
+
+// followRename warns when a dependency's repo has been renamed or transferred
+// and, if accepted, rewrites the lock entry to the new location. It returns the
+// URL the dependency is now tracked under and whether the lock file changed.
+func followRename(repoURL string, lockFile *LockFile, accept func(newURL string) bool) (string, bool) {
+	return applyRename(repoURL, renamedKey(repoURL, lockFile.Dependencies[repoURL]), lockFile, accept)
+}
+
+// renamedKey returns the lock key of repoURL under the name GitHub says the
+// repository now has, or "" if it hasn't moved or that can't be told
+func renamedKey(repoURL string, dep Dependency) string {
+	if dep.Transport == transportSSH {
+		return ""
+	}
+	owner, repo, err := parseGitHubURL(repoURL)
+	if err != nil {
+		return ""
 	}
+	newURL, err := getRenamedURL(owner, repo)
+	if err != nil || newURL == "" {
+		return ""
+	}
+	return relocateKey(repoURL, newURL)
+}
 
-	fmt.Printf("Update available for %s:\n", repoURL)
-	fmt.Printf("  Current: %s (%s)\n", dep.SHA[:8], dep.Ref)
-	fmt.Printf("  Latest:  %s (%s)\n", currentSHA[:8], currentRef)
+// applyRename is followRename with the new key, newURL, already looked up by
+// renamedKey
+func applyRename(repoURL, newURL string, lockFile *LockFile, accept func(newURL string) bool) (string, bool) {
+	if newURL == "" {
+		return repoURL, false
+	}
+	warnf("%s %s has moved to %s\n", colorize(colorYellow, "!"), repoURL, newURL)
+	if !accept(newURL) {
+		return repoURL, false
+	}
 
-	// Download updated version
-	hash, err := downloadRepo(owner, repo, currentSHA, repoURL)
+	err := renameDependency(lockFile, repoURL, newURL)
 	if err != nil {
-		fmt.Printf("%s Error downloading update: %v\n", colorize(colorRed, "✗"), err)
-		return false
+		errorf("%s Error renaming %s: %v\n", colorize(colorRed, "✗"), repoURL, err)
+		return repoURL, false
 	}
 
-	// Update lock file entry
-	lockFile.Dependencies[repoURL] = Dependency{
-		Ref:  dep.Ref,
-		SHA:  currentSHA,
-		Hash: hash,
+	infof("%s Renamed %s to %s\n", colorize(colorGreen, "✓"), repoURL, newURL)
+	return newURL, true
+}
+
+// availableUpdate is a newer commit found for a dependency. Latest is the
+// lock entry to record once it has been downloaded.
+type availableUpdate struct {
+	RepoURL   string
+	Current   Dependency
+	Latest    Dependency
+	LatestRef string
+}
+
+// updateDependency moves dep to the newest commit its ref or constraint
+// resolves to. A non-empty level (updatePatch, updateMinor or updateMajor)
+// lets a dependency pinned to a semver tag move to newer tags within it.
+// With dryRun the available update is only reported: nothing is downloaded
+// and lockFile is left alone, but true is still returned.
+func updateDependency(repoURL string, dep Dependency, lockFile *LockFile, level string, dryRun bool) bool {
+	update, ok := findUpdate(repoURL, dep, level)
+	if !ok {
+		return false
+	}
+	if dryRun {
+		return true
 	}
+	return applyUpdate(update, lockFile)
+}
 
-	fmt.Printf("%s Updated %s to %s (%s)\n", colorize(colorGreen, "✓"), repoURL, currentRef, currentSHA[:8])
-	return true
+// refResolution is what resolving a dependency's ref gave
+type refResolution struct {
+	SHA string
+	Ref string
+	Err error
 }
 
-func downloadRepo(owner, repo, sha, repoURL string) (string, error) {
-	// Create .deps directory if it doesn't exist
-	err := os.MkdirAll(".deps", 0755)
-	if err != nil {
-		return "", err
+// findUpdate resolves dep at level and reports whether a newer commit is
+// available, printing what it found
+func findUpdate(repoURL string, dep Dependency, level string) (availableUpdate, bool) {
+	return reportUpdate(repoURL, dep, level, resolveUpdateOf(repoURL, dep, level))
+}
+
+// resolveUpdateOf resolves dep at level as findUpdate does, without printing
+// anything, so that several can be resolved at once. Frozen dependencies
+// and URL sources aren't resolved.
+func resolveUpdateOf(repoURL string, dep Dependency, level string) refResolution {
+	var resolution refResolution
+	if !dep.frozen() && !isURLSource(repoURL) {
+		resolution.SHA, resolution.Ref, resolution.Err = resolveUpdate(repoURL, dep, level)
 	}
+	return resolution
+}
 
-	// Download tarball
-	tarballURL := fmt.Sprintf("%s/repos/%s/%s/tarball/%s", githubAPIBaseURL, owner, repo, sha)
+// reportUpdate is findUpdate with dep already resolved into resolution
+func reportUpdate(repoURL string, dep Dependency, level string, resolution refResolution) (availableUpdate, bool) {
+	if isURLSource(repoURL) {
+		infof("%s %s - a URL source, skipping\n", colorize(colorGreen, "✓"), describeDep(repoURL, dep))
+		recordResult(resultFor(repoURL, dep, "pinned"))
+		return availableUpdate{}, false
+	}
+	if dep.frozen() {
+		infof("%s %s@%s (%s) - %s, skipping\n", colorize(colorGreen, "✓"), repoURL, dep.Ref, dep.SHA[:8], dep.frozenLabel())
+		recordResult(resultFor(repoURL, dep, "pinned"))
+		return availableUpdate{}, false
+	}
 
-	resp, err := httpClient.Get(tarballURL)
+	currentSHA, currentRef, err := resolution.SHA, resolution.Ref, resolution.Err
 	if err != nil {
-		return "", err
+		errorf("%s Error resolving %s@%s: %v\n", colorize(colorRed, "✗"), repoURL, dep.refSpec(), err)
+		setExitCode(exitCodeFor(err))
+		result := resultFor(repoURL, dep, resultError)
+		result.Error = err.Error()
+		recordResult(result)
+		return availableUpdate{}, false
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
+	if currentSHA == dep.SHA {
+		infof("%s %s@%s (%s) - no update available\n", colorize(colorGreen, "✓"), repoURL, dep.Ref, dep.SHA[:8])
+		recordResult(resultFor(repoURL, dep, resultUpToDate))
+		return availableUpdate{}, false
 	}
+	result := resultFor(repoURL, dep, "update_available")
+	result.LatestRef, result.LatestSHA = currentRef, currentSHA
+	recordResult(result)
 
-	// Hash the tarball content as we stream it through
-	hasher := sha256.New()
-	reader := io.TeeReader(resp.Body, hasher)
+	infof("Update available for %s:\n", repoURL)
+	infof("  Current: %s (%s)\n", dep.SHA[:8], dep.Ref)
+	infof("  Latest:  %s (%s)\n", currentSHA[:8], currentRef)
+	printChangelog(repoURL, dep, currentSHA)
 
-	// Extract tarball
-	depPath := getDepPath(repoURL)
-	err = extractTarball(reader, depPath)
+	latest := dep
+	latest.SHA = currentSHA
+	if dep.Constraint != "" || level != "" {
+		latest.Ref = currentRef
+	}
+	return availableUpdate{RepoURL: repoURL, Current: dep, Latest: latest, LatestRef: currentRef}, true
+}
+
+// applyUpdate downloads an available update and records it in lockFile
+func applyUpdate(update availableUpdate, lockFile *LockFile) bool {
+	// The recorded hashes belong to the old commit
+	dep := update.Latest
+	dep.Hash, dep.TreeHash = "", ""
+
+	// Submodules are resolved together with those of the other dependencies
+	previous := lockFile.Dependencies[update.RepoURL]
+	lockFile.Dependencies[update.RepoURL] = dep
+	resolved, err := planSubmodules(lockFile)
+	if err == nil {
+		dep, err = installDependency(update.RepoURL, dep)
+	}
 	if err != nil {
-		return "", err
+		lockFile.Dependencies[update.RepoURL] = previous
+		errorf("%s Error downloading update: %v\n", colorize(colorRed, "✗"), err)
+		setExitCode(exitCodeFor(err))
+		result := resultFor(update.RepoURL, update.Current, resultError)
+		result.LatestRef, result.LatestSHA = update.LatestRef, update.Latest.SHA
+		result.Error = err.Error()
+		recordResult(result)
+		return false
 	}
+	dep.Metadata = resolveMetadata(update.RepoURL, dep, update.LatestRef)
 
-	hash := hex.EncodeToString(hasher.Sum(nil))
+	// Update lock file entry
+	lockFile.Dependencies[update.RepoURL] = dep
 
-	fmt.Printf("Downloaded to %s\n", depPath)
-	return hash, nil
+	infof("%s Updated %s to %s (%s)\n", colorize(colorGreen, "✓"), update.RepoURL, update.LatestRef, dep.SHA[:8])
+	recordResult(depResult{Repo: update.RepoURL, Ref: dep.Ref, SHA: dep.SHA, Status: resultUpdated})
+	reinstallResolved(lockFile, resolved, update.RepoURL)
+	return true
 }
 
-func extractTarball(r io.Reader, destPath string) error {
-	// Remove existing directory
-	os.RemoveAll(destPath)
+// maxChangelogCommits is how many commit subjects an update lists
+const maxChangelogCommits = 20
 
-	// Create destination directory
-	err := os.MkdirAll(destPath, 0755)
+// printChangelog lists the commits between dep.SHA and newSHA, newest first,
+// with a link to the full comparison. Only GitHub HTTPS dependencies have a
+// compare API; a failed lookup is reported but doesn't stop the update.
+func printChangelog(repoURL string, dep Dependency, newSHA string) {
+	if dep.Transport == transportSSH {
+		return
+	}
+	owner, repo, err := parseGitHubURL(repoURL)
 	if err != nil {
-		return err
+		return
 	}
 
-	// Open gzip reader
-	gzr, err := gzip.NewReader(r)
+	comparison, err := compareCommits(owner, repo, dep.SHA, newSHA)
 	if err != nil {
-		return err
+		warnf("  %s Couldn't list changes: %v\n", colorize(colorYellow, "!"), err)
+		return
 	}
-	defer gzr.Close()
 
-	// Open tar reader
-	tr := tar.NewReader(gzr)
+	switch comparison.Status {
+	case "behind":
+		warnf("  %s %s is %d commits behind the locked commit\n", colorize(colorYellow, "!"), newSHA[:8], comparison.TotalCommits)
+	case "diverged":
+		warnf("  %s History has diverged from the locked commit (force-pushed?)\n", colorize(colorYellow, "!"))
+	}
 
-	// Track the root directory name (GitHub adds a prefix like "repo-sha/")
-	var rootDir string
+	if len(comparison.Commits) > 0 {
+		infof("  Changes (%d commits):\n", comparison.TotalCommits)
+	}
+	for i := len(comparison.Commits) - 1; i >= 0 && i >= len(comparison.Commits)-maxChangelogCommits; i-- {
+		commit := comparison.Commits[i]
+		subject, _, _ := strings.Cut(commit.Commit.Message, "\n")
+		infof("    %s %s\n", commit.SHA[:8], subject)
+	}
+	if more := comparison.TotalCommits - min(len(comparison.Commits), maxChangelogCommits); more > 0 {
+		infof("    ... and %d more\n", more)
+	}
+	if comparison.HTMLURL != "" {
+		infof("  %s\n", comparison.HTMLURL)
+	}
+}
 
-	for {
-		header, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
+// setPinned freezes (pinned) or releases a dependency at its locked SHA
+func setPinned(lockFile *LockFile, repoURL string, pinned bool) error {
+	dep, exists := lockFile.Dependencies[repoURL]
+	if !exists {
+		return fmt.Errorf("dependency %s not found in .deps.lock", repoURL)
+	}
+	if isURLSource(repoURL) {
+		return fmt.Errorf("%s is a URL source, which is always pinned by its hash", repoURL)
+	}
+	if dep.Pinned == pinned {
+		if pinned {
+			return fmt.Errorf("%s is already pinned at %s", repoURL, dep.SHA[:8])
 		}
+		return fmt.Errorf("%s is not pinned", repoURL)
+	}
 
-		// Skip pax headers and other non-standard entries
-		if header.Typeflag == tar.TypeXGlobalHeader || header.Name == "pax_global_header" {
-			continue
-		}
+	dep.Pinned = pinned
+	lockFile.Dependencies[repoURL] = dep
+	return nil
+}
 
-		// Detect the root directory from the first real directory entry
-		if rootDir == "" && strings.Contains(header.Name, "/") {
-			parts := strings.Split(header.Name, "/")
-			if len(parts) > 0 && strings.Contains(parts[0], "-") {
-				rootDir = parts[0] + "/"
+// withPolicy returns dep with the update policy applied. A semver-range
+// policy on a dependency pinned to a plain version tag tracks "^" of that
+// version; follow-branch drops any constraint and tracks the branch in ref.
+func withPolicy(dep Dependency, policy string) (Dependency, error) {
+	switch policy {
+	case policyAuto, "":
+		dep.Policy = ""
+		return dep, nil
+	case policyFrozen:
+	case policySemverRange:
+		if dep.Constraint == "" {
+			v, ok := parseSemver(strings.TrimPrefix(dep.Ref, dep.TagPrefix))
+			if !ok || !strings.HasPrefix(dep.Ref, dep.TagPrefix) {
+				return dep, fmt.Errorf("%s policy needs a constraint like ^1.4 or a version tag, not %q", policy, dep.Ref)
 			}
+			dep.Constraint = "^" + v.String()
 		}
-
-		// Skip the root directory entry itself
-		if header.Typeflag == tar.TypeDir && rootDir != "" && header.Name == rootDir[:len(rootDir)-1] {
-			continue
+	case policyFollowBranch:
+		if isRefKeyword(dep.Ref) || isFullSHA(dep.Ref) {
+			return dep, fmt.Errorf("%s policy needs a branch, not %q", policy, dep.Ref)
 		}
+		dep.Constraint = ""
+	default:
+		return dep, fmt.Errorf("unknown policy %q (want %s, %s, %s or %s)", policy, policyFrozen, policyFollowBranch, policySemverRange, policyAuto)
+	}
+	dep.Policy = policy
+	return dep, nil
+}
 
-		// Skip entries that don't start with our detected root directory
-		if rootDir == "" || !strings.HasPrefix(header.Name, rootDir) {
-			continue
-		}
+// setPolicy sets the update policy of a dependency in lockFile
+func setPolicy(lockFile *LockFile, repoURL, policy string) error {
+	dep, exists := lockFile.Dependencies[repoURL]
+	if !exists {
+		return fmt.Errorf("dependency %s not found in .deps.lock", repoURL)
+	}
+	if isURLSource(repoURL) {
+		return fmt.Errorf("%s is a URL source, which is never updated", repoURL)
+	}
+	dep, err := withPolicy(dep, policy)
+	if err != nil {
+		return err
+	}
+	lockFile.Dependencies[repoURL] = dep
+	return nil
+}
 
-		// Remove the root directory prefix to flatten the structure
-		name := strings.TrimPrefix(header.Name, rootDir)
-		if name == "" {
-			continue
+// RepoDetails describes a repository for `deps info`
+type RepoDetails struct {
+	Description   string
+	DefaultBranch string
+	LatestRelease string // empty if the repo has no releases
+	License       string
+	Archived      bool
+}
+
+// getRepoDetails looks up the details of the repository at repoURL. Azure
+// DevOps only reports the default branch.
+func getRepoDetails(repoURL string) (RepoDetails, error) {
+	if isURLSource(repoURL) {
+		return RepoDetails{}, fmt.Errorf("%s is a URL source, not a repository", repoURL)
+	}
+	if isAzureURL(repoURL) {
+		org, project, repo, err := parseAzureURL(repoURL)
+		if err != nil {
+			return RepoDetails{}, fmt.Errorf("parsing URL: %v", err)
+		}
+		repoInfo, err := getAzureRepoInfo(org, project, repo)
+		if err != nil {
+			return RepoDetails{}, err
 		}
+		return RepoDetails{DefaultBranch: strings.TrimPrefix(repoInfo.DefaultBranch, "refs/heads/")}, nil
+	}
 
-		target := filepath.Join(destPath, name)
+	owner, repo, err := parseGitHubURL(repoURL)
+	if err != nil {
+		return RepoDetails{}, fmt.Errorf("parsing URL: %v", err)
+	}
+	repoInfo, err := getRepoInfo(owner, repo)
+	if err != nil {
+		return RepoDetails{}, err
+	}
 
-		switch header.Typeflag {
-		case tar.TypeDir:
-			err = os.MkdirAll(target, os.FileMode(header.Mode))
-			if err != nil {
-				return err
-			}
-		case tar.TypeReg:
-			err = os.MkdirAll(filepath.Dir(target), 0755)
-			if err != nil {
-				return err
-			}
+	details := RepoDetails{
+		Description:   repoInfo.Description,
+		DefaultBranch: repoInfo.DefaultBranch,
+		License:       repoInfo.licenseName(),
+		Archived:      repoInfo.Archived,
+	}
+	// A repo without releases isn't an error worth failing on
+	details.LatestRelease, _ = getLatestReleaseTag(owner, repo)
 
-			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, os.FileMode(header.Mode))
-			if err != nil {
-				return err
-			}
+	return details, nil
+}
 
-			_, err = io.Copy(f, tr)
-			f.Close()
-			if err != nil {
-				return err
-			}
+// validateRepoURL checks that repoURL is a supported repository URL
+func validateRepoURL(repoURL string) error {
+	if _, name := splitEntryName(repoURL); strings.Contains(repoURL, "#") {
+		if err := validateAlias(name); err != nil {
+			return fmt.Errorf("entry name: %v", err)
 		}
 	}
-
-	return nil
+	if isURLSource(repoURL) {
+		return validateURLSourceKey(repoURL)
+	}
+	if isAzureURL(repoURL) {
+		_, _, _, err := parseAzureURL(repoURL)
+		return err
+	}
+	_, _, err := parseGitHubURL(repoURL)
+	return err
 }
 
+// Keywords that resolve to a tag, which is then pinned
+const (
+	refLatest        = "latest"         // tag with the highest semver version
+	refLatestRelease = "latest-release" // tag of the latest published GitHub release
+)
+
+// isRefKeyword reports whether ref is a keyword that resolves to a tag, rather
+// than a ref that should be recorded as-is
+func isRefKeyword(ref string) bool {
+	return ref == refLatest || ref == refLatestRelease
+}
+
+// resolveDependencyRef resolves ref for the repository at repoURL, using the
+// API of the host it lives on
+func resolveDependencyRef(repoURL, transport, ref string) (sha, resolvedRef string, err error) {
+	if isURLSource(repoURL) {
+		return "", "", errNoRefs
+	}
+	if transport == transportHTTPS && refResolver == resolverGit {
+		return resolveRefGit(repoURL, ref)
+	}
+	if transport == transportSSH {
+		return resolveRefSSH(repoURL, ref)
+	}
+
+	if isAzureURL(repoURL) {
+		org, project, repo, err := parseAzureURL(repoURL)
+		if err != nil {
+			return "", "", fmt.Errorf("parsing URL: %v", err)
+		}
+		return resolveAzureRef(org, project, repo, ref)
+	}
+
+	owner, repo, err := parseGitHubURL(repoURL)
+	if err != nil {
+		return "", "", fmt.Errorf("parsing URL: %v", err)
+	}
+	return resolveRef(owner, repo, ref)
+}
+
+// listDependencyTags lists the tags of the repository at repoURL
+func listDependencyTags(repoURL, transport string) ([]tagInfo, error) {
+	if isURLSource(repoURL) {
+		return nil, errNoRefs
+	}
+	if transport == transportHTTPS && refResolver == resolverGit {
+		refs, err := lsRemoteHTTP(repoURL)
+		if err != nil {
+			return nil, err
+		}
+		return tagsFromRefs(refs), nil
+	}
+	if transport == transportSSH {
+		return listTagsSSH(repoURL)
+	}
+
+	if isAzureURL(repoURL) {
+		org, project, repo, err := parseAzureURL(repoURL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing URL: %v", err)
+		}
+		return listAzureTags(org, project, repo)
+	}
+
+	owner, repo, err := parseGitHubURL(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing URL: %v", err)
+	}
+	return listTags(owner, repo)
+}
+
+// listDependencyBranches returns the branches of the repository at repoURL
+func listDependencyBranches(repoURL, transport string) ([]tagInfo, error) {
+	if isURLSource(repoURL) {
+		return nil, errNoRefs
+	}
+	if transport == transportHTTPS && refResolver == resolverGit {
+		refs, err := lsRemoteHTTP(repoURL)
+		if err != nil {
+			return nil, err
+		}
+		return namedRefs(refs, "refs/heads/"), nil
+	}
+	if transport == transportSSH {
+		return listBranchesSSH(repoURL)
+	}
+
+	if isAzureURL(repoURL) {
+		org, project, repo, err := parseAzureURL(repoURL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing URL: %v", err)
+		}
+		return listAzureBranches(org, project, repo)
+	}
+
+	owner, repo, err := parseGitHubURL(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing URL: %v", err)
+	}
+	return listBranches(owner, repo)
+}
+
+// resolveConstraint returns the commit and name of the highest tag matching
+// a semver constraint for the dependency, honouring its pre-release and tag
+// prefix settings
+func resolveConstraint(repoURL string, dep Dependency, constraint string) (sha, tag string, err error) {
+	parsed, err := parseConstraint(constraint)
+	if err != nil {
+		return "", "", err
+	}
+
+	tags, err := listDependencyTags(repoURL, dep.Transport)
+	if err != nil {
+		return "", "", fmt.Errorf("listing tags: %w", err)
+	}
+
+	best, ok := selectTag(tags, parsed, dep.Pre, dep.TagPrefix)
+	if !ok {
+		if dep.TagPrefix != "" {
+			return "", "", fmt.Errorf("no tag with prefix %s matches %s", dep.TagPrefix, constraint)
+		}
+		return "", "", fmt.Errorf("no tag matches %s", constraint)
+	}
+	return best.SHA, best.Name, nil
+}
+
+// resolveMetadata looks up the metadata recorded with a dependency resolved
+// to resolvedRef at dep.SHA. dep still holds what was asked for, e.g. an
+// empty ref for the default branch.
+func resolveMetadata(repoURL string, dep Dependency, resolvedRef string) *DependencyMetadata {
+	meta := &DependencyMetadata{
+		RefKind:    lockRefKind(repoURL, dep, resolvedRef),
+		ResolvedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	meta.TarballURL, _ = archiveURL(repoURL, dep, dep.SHA)
+
+	if owner, repo, err := parseGitHubURL(repoURL); err == nil && dep.Transport != transportSSH {
+		if info, err := getRepoInfo(owner, repo); err == nil {
+			meta.License = info.licenseName()
+			meta.Description = info.Description
+		}
+	}
+	return meta
+}
+
+// lockRefKind classifies dep's ref as "branch", "tag" or "sha", or returns
+// "" if that can't be determined
+func lockRefKind(repoURL string, dep Dependency, resolvedRef string) string {
+	switch {
+	case dep.Constraint != "" || isRefKeyword(dep.Ref):
+		return "tag"
+	case dep.Ref == "":
+		return "branch"
+	case isFullSHA(resolvedRef):
+		return "sha"
+	}
+	isBranch, err := branchExists(repoURL, dep.Transport, dep.Ref)
+	if err != nil {
+		return ""
+	}
+	if isBranch {
+		return "branch"
+	}
+	return "tag"
+}
+
+// refKind describes what dep's ref resolved through, e.g. "branch" or "tag"
+func refKind(repoURL string, dep Dependency, resolvedRef string) (string, error) {
+	switch {
+	case dep.Constraint != "":
+		return "tag matching " + dep.Constraint, nil
+	case dep.Ref == refLatest:
+		return "highest semver tag", nil
+	case dep.Ref == refLatestRelease:
+		return "latest release tag", nil
+	case dep.Ref == "":
+		return "default branch", nil
+	case isFullSHA(resolvedRef):
+		return "commit", nil
+	}
+
+	// Branches take precedence over tags of the same name when resolving
+	isBranch, err := branchExists(repoURL, dep.Transport, dep.Ref)
+	if err != nil {
+		return "", err
+	}
+	if isBranch {
+		return "branch", nil
+	}
+	return "tag", nil
+}
+
+// branchExists reports whether the repository at repoURL has the branch
+func branchExists(repoURL, transport, branch string) (bool, error) {
+	if isURLSource(repoURL) {
+		return false, errNoRefs
+	}
+	if transport == transportHTTPS && refResolver == resolverGit {
+		refs, err := lsRemoteHTTP(repoURL)
+		if err != nil {
+			return false, err
+		}
+		return refs["refs/heads/"+branch] != "", nil
+	}
+	if transport == transportSSH {
+		remote, err := sshRemoteURL(repoURL)
+		if err != nil {
+			return false, err
+		}
+		out, err := runGit("", "ls-remote", "--", remote, "refs/heads/"+branch)
+		if err != nil {
+			return false, err
+		}
+		return parseLsRemote(out)["refs/heads/"+branch] != "", nil
+	}
+
+	if isAzureURL(repoURL) {
+		org, project, repo, err := parseAzureURL(repoURL)
+		if err != nil {
+			return false, fmt.Errorf("parsing URL: %v", err)
+		}
+		_, err = getAzureRefSHA(org, project, repo, "heads/"+branch)
+		return err == nil, nil
+	}
+
+	owner, repo, err := parseGitHubURL(repoURL)
+	if err != nil {
+		return false, fmt.Errorf("parsing URL: %v", err)
+	}
+	_, _, err = getBranchCommitSHA(owner, repo, branch)
+	return err == nil, nil
+}
+
+// resolveUpdate resolves dep for an update at level. Dependencies pinned to a
+// semver tag resolve to the newest tag the level allows; anything else
+// (branches, SHAs, constraints) resolves as usual. Dependencies that declare
+// a policy ignore the level.
+func resolveUpdate(repoURL string, dep Dependency, level string) (sha, resolvedRef string, err error) {
+	// A declared policy takes precedence over the level
+	switch dep.Policy {
+	case policySemverRange:
+		if dep.Constraint == "" {
+			return "", "", fmt.Errorf("%s policy without a constraint", policySemverRange)
+		}
+		return resolveConstraint(repoURL, dep, dep.Constraint)
+	case policyFollowBranch:
+		isBranch, err := branchExists(repoURL, dep.Transport, dep.Ref)
+		if err != nil {
+			return "", "", err
+		}
+		if !isBranch {
+			return "", "", fmt.Errorf("%s policy but %s is not a branch", policyFollowBranch, dep.Ref)
+		}
+		return resolveDependencyRef(repoURL, dep.Transport, dep.Ref)
+	case "":
+	default:
+		return "", "", fmt.Errorf("unknown policy %q", dep.Policy)
+	}
+
+	if level == "" || dep.Constraint != "" || !strings.HasPrefix(dep.Ref, dep.TagPrefix) {
+		return resolveDependency(repoURL, dep)
+	}
+	current, ok := parseSemver(strings.TrimPrefix(dep.Ref, dep.TagPrefix))
+	if !ok {
+		return resolveDependency(repoURL, dep)
+	}
+
+	constraint, err := levelConstraint(current, level)
+	if err != nil {
+		return "", "", err
+	}
+	// Pre-release tags are only candidates if opted in or already in use
+	dep.Pre = dep.Pre || current.Pre != ""
+	return resolveConstraint(repoURL, dep, constraint)
+}
+
+// resolveLatestRelease returns the commit and tag of the latest published
+// GitHub release
+func resolveLatestRelease(repoURL string) (sha, tag string, err error) {
+	if isAzureURL(repoURL) {
+		return "", "", fmt.Errorf("%s is only supported for GitHub repositories", refLatestRelease)
+	}
+
+	owner, repo, err := parseGitHubURL(repoURL)
+	if err != nil {
+		return "", "", fmt.Errorf("parsing URL: %v", err)
+	}
+
+	tag, err = getLatestReleaseTag(owner, repo)
+	if err != nil {
+		return "", "", err
+	}
+
+	sha, err = getTagCommitSHA(owner, repo, tag)
+	if err != nil {
+		return "", "", fmt.Errorf("resolving release tag %s: %w", tag, err)
+	}
+
+	return sha, tag, nil
+}
+
+// resolveDependency resolves the commit a lock entry should be at: the
+// highest tag matching its constraint or keyword, or else the current state
+// of its ref
+func resolveDependency(repoURL string, dep Dependency) (sha, resolvedRef string, err error) {
+	switch {
+	case dep.Constraint != "":
+		return resolveConstraint(repoURL, dep, dep.Constraint)
+	case dep.Ref == refLatest:
+		return resolveConstraint(repoURL, dep, "*")
+	case dep.Ref == refLatestRelease:
+		return resolveLatestRelease(repoURL)
+	}
+	return resolveDependencyRef(repoURL, dep.Transport, dep.Ref)
+}
+
+// fetchDependency downloads and extracts dep at dep.SHA into its install
+// directory, expanding submodules and LFS files if requested, and returns the
+// tarball hash. A failed or interrupted download leaves what was installed
+// before; a failure after that leaves no partial directory.
+func fetchDependency(repoURL string, dep Dependency) (string, error) {
+	hash, err := fetchDependencyFilesCached(repoURL, dep)
+	if err != nil {
+		return "", err
+	}
+	if hasTransforms(dep) {
+		err = transformTree(getDepPath(repoURL), dep.Strip, dep.Rename)
+	}
+	if err == nil && (len(dep.Only) > 0 || len(dep.Exclude) > 0) {
+		err = filterTree(getDepPath(repoURL), dep.Only, dep.Exclude)
+	}
+	if err != nil {
+		os.RemoveAll(getDepPath(repoURL))
+		if runContext.Err() != nil {
+			return "", fmt.Errorf("%v (removed partial %s)", runContext.Err(), getDepPath(repoURL))
+		}
+		return "", err
+	}
+	return hash, nil
+}
+
+// installDependency fetches dep and checks the archive and extracted files
+// against the hashes recorded in dep, putting the previous install back if
+// either doesn't match or anything else fails. It records the checksum of
+// every file in .deps.sums and returns dep with both hashes filled in from
+// what was installed.
+func installDependency(repoURL string, dep Dependency) (Dependency, error) {
+	ensureGitignored()
+	recordLockFile()
+	// git archive's output changes between git versions, so an SSH
+	// dependency is checked by its tree hash alone
+	if dep.Transport == transportSSH {
+		dep.Hash = ""
+	}
+	if files, ok := installFromStore(repoURL, dep); ok {
+		if err := checkLicensePolicy(repoURL, dep); err != nil {
+			os.Remove(getDepPath(repoURL))
+			return dep, err
+		}
+		if err := recordSums(repoURL, dep.SHA, files); err != nil {
+			return dep, fmt.Errorf("updating %s: %v", sumsFilePath(), err)
+		}
+		return dep, nil
+	}
+
+	// Until dep is installed and checked, the previous install is kept aside
+	// to be put back if anything fails
+	install, err := beginInstall(getDepPath(repoURL))
+	if err != nil {
+		return dep, err
+	}
+	dep, err = installFetchedDependency(repoURL, dep)
+	if err != nil {
+		install.rollback()
+		return dep, err
+	}
+	install.commit()
+	return dep, nil
+}
+
+// installFetchedDependency is installDependency for dependencies fetched
+// rather than linked from the store
+func installFetchedDependency(repoURL string, dep Dependency) (Dependency, error) {
+	hash, err := fetchDependency(repoURL, dep)
+	if err != nil {
+		return dep, err
+	}
+	files, err := hashTreeFiles(getDepPath(repoURL))
+	if err != nil {
+		os.RemoveAll(getDepPath(repoURL))
+		return dep, fmt.Errorf("hashing installed files: %v", err)
+	}
+	treeHash := treeHashOf(files)
+
+	// An empty hash is a zipball's, which only the tree hash can check
+	if dep.Hash != "" && hash != "" && hash != dep.Hash {
+		os.RemoveAll(getDepPath(repoURL))
+		return dep, &checksumError{What: "hash", Expected: dep.Hash, Got: hash}
+	}
+	if dep.Hash != "" && hash == "" && dep.TreeHash == "" {
+		os.RemoveAll(getDepPath(repoURL))
+		return dep, fmt.Errorf("only the zipball could be downloaded, and without a tree_hash in the lock file it can't be checked")
+	}
+	if dep.TreeHash != "" && treeHash != dep.TreeHash {
+		os.RemoveAll(getDepPath(repoURL))
+		evictCachedTree(repoURL, dep)
+		return dep, &checksumError{What: "tree hash", Expected: dep.TreeHash, Got: treeHash}
+	}
+	if err := checkSizeBudget(repoURL, dep); err != nil {
+		os.RemoveAll(getDepPath(repoURL))
+		return dep, err
+	}
+	if err := checkLicensePolicy(repoURL, dep); err != nil {
+		os.RemoveAll(getDepPath(repoURL))
+		return dep, err
+	}
+	if useStore(dep) {
+		if err := addToStore(repoURL, dep, treeHash, files); err != nil {
+			warnf("Warning: couldn't add %s to the store: %v\n", repoURL, err)
+		}
+	}
+
+	// The tree hash covers the download; the per-file checksums also cover
+	// what the hook generated, so verify only flags later edits
+	ran, err := runPostInstall(repoURL, dep)
+	if err != nil {
+		return dep, err
+	}
+	if ran {
+		files, err = hashTreeFiles(getDepPath(repoURL))
+		if err != nil {
+			return dep, fmt.Errorf("hashing installed files: %v", err)
+		}
+	}
+
+	err = recordSums(repoURL, dep.SHA, files)
+	if err != nil {
+		return dep, fmt.Errorf("updating %s: %v", sumsFilePath(), err)
+	}
+	dedupDependency(repoURL, files)
+
+	if hash != "" {
+		dep.Hash = hash
+	}
+	dep.TreeHash = treeHash
+	return dep, nil
+}
+
+func fetchDependencyFiles(repoURL string, dep Dependency) (string, error) {
+	if isURLSource(repoURL) {
+		return downloadURLSource(repoURL)
+	}
+	if isAzureURL(repoURL) {
+		if dep.Submodules || dep.LFS {
+			warnf("%s Only archives are supported for Azure DevOps, ignoring other options for %s\n", colorize(colorYellow, "!"), repoURL)
+		}
+		if dep.Transport == transportSSH {
+			return downloadRepoSSH(repoURL, dep.SHA)
+		}
+		org, project, repo, err := parseAzureURL(repoURL)
+		if err != nil {
+			return "", fmt.Errorf("parsing URL: %v", err)
+		}
+		return downloadAzureRepo(org, project, repo, dep.SHA, repoURL)
+	}
+
+	owner, repo, err := parseGitHubURL(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("parsing URL: %v", err)
+	}
+
+	// Part of a repository may be fetched without its tarball, which leaves
+	// no archive hash
+	var hash string
+	if !fetchesSubtree(repoURL, dep) || !downloadRepoSubtree(owner, repo, dep.SHA, repoURL) {
+		if dep.Transport == transportSSH {
+			hash, err = downloadRepoSSH(repoURL, dep.SHA)
+		} else {
+			hash, err = downloadRepo(owner, repo, dep.SHA, repoURL)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// The archive is in place by now, so anything failing after this leaves
+	// an incomplete tree that has to go
+	if dep.Submodules {
+		if dep.Transport == transportSSH {
+			warnf("%s Submodule expansion is not supported over SSH, skipping for %s\n", colorize(colorYellow, "!"), repoURL)
+		} else {
+			err = expandSubmodules(owner, repo, dep.SHA, repoURL)
+			if err != nil {
+				os.RemoveAll(getDepPath(repoURL))
+				return "", fmt.Errorf("expanding submodules: %w", err)
+			}
+		}
+	}
+
+	if dep.LFS {
+		err = resolveLFSPointers(owner, repo, repoURL)
+		if err != nil {
+			os.RemoveAll(getDepPath(repoURL))
+			return "", fmt.Errorf("resolving LFS files: %w", err)
+		}
+	}
+
+	return hash, nil
+}
+
+// archiveURL returns where the archive of dep at sha is fetched from
+func archiveURL(repoURL string, dep Dependency, sha string) (string, error) {
+	if isURLSource(repoURL) {
+		rawURL, _ := splitEntryName(repoURL)
+		return rawURL, nil
+	}
+	if dep.Transport == transportSSH {
+		return sshRemoteURL(repoURL)
+	}
+	if isAzureURL(repoURL) {
+		org, project, repo, err := parseAzureURL(repoURL)
+		if err != nil {
+			return "", fmt.Errorf("parsing URL: %v", err)
+		}
+		return azureArchiveURL(org, project, repo, sha), nil
+	}
+
+	owner, repo, err := parseGitHubURL(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("parsing URL: %v", err)
+	}
+	return githubTarballURL(owner, repo, sha), nil
+}
+
+func downloadRepo(owner, repo, sha, repoURL string) (string, error) {
+	// Create .deps directory if it doesn't exist
+	err := os.MkdirAll(depsDir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	depPath := getDepPath(repoURL)
+	_, subdir := splitSubdir(repoURL)
+	hash, err := downloadTarball(owner, repo, sha, depPath, subdir)
+	if err != nil {
+		return "", err
+	}
+
+	infof("Downloaded to %s\n", depPath)
+	return hash, nil
+}
+
+// downloadTarball downloads the GitHub tarball for owner/repo at sha, extracts
+// subdir of it into destPath, and returns the SHA-256 of the tarball. A
+// download cut off mid-stream is retried from the start. If the tarball
+// still can't be had, the zipball of the same commit is tried, and the hash
+// returned is empty: a zipball's can't be compared with a tarball's.
+func downloadTarball(owner, repo, sha, destPath, subdir string) (string, error) {
+	hash, err := downloadTarballOnly(owner, repo, sha, destPath, subdir)
+	if err == nil || !zipballFallback(err) {
+		return hash, err
+	}
+	warnf("%s Couldn't download the tarball of %s/%s (%v), trying the zipball\n", colorize(colorYellow, "!"), owner, repo, err)
+	if zipErr := downloadZipball(owner, repo, sha, destPath, subdir); zipErr != nil {
+		return "", fmt.Errorf("%v, and the zipball: %w", err, zipErr)
+	}
+	return "", nil
+}
+
+// zipballFallback reports whether a tarball download that failed with err is
+// worth trying again as a zipball: the gzip stream arrived mangled, as some
+// proxies do to it, or the endpoint kept failing
+func zipballFallback(err error) bool {
+	var status *statusError
+	var corrupt flate.CorruptInputError
+	if errors.As(err, &status) {
+		return status.StatusCode >= 500
+	}
+	return errors.Is(err, errUnknownArchive) || errors.Is(err, gzip.ErrHeader) || errors.Is(err, gzip.ErrChecksum) || errors.Is(err, tar.ErrHeader) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &corrupt)
+}
+
+// downloadZipball downloads the GitHub zipball for owner/repo at sha and
+// extracts subdir of it into destPath
+func downloadZipball(owner, repo, sha, destPath, subdir string) error {
+	// Zip extraction needs random access, so spool the archive to disk
+	tmpFile, err := createTemp("", "deps-zipball-*.zip")
+	if err != nil {
+		return err
+	}
+	defer removeTemp(tmpFile.Name())
+	defer tmpFile.Close()
+	p := startProgress(owner+"/"+repo, -1)
+	defer p.finish()
+	if err := downloadResumable(githubZipballURL(owner, repo, sha), owner+"/"+repo, tmpFile, p, githubAPIError); err != nil {
+		return err
+	}
+	return extractZip(tmpFile.Name(), destPath, subdir, true)
+}
+
+// downloadTarballOnly is downloadTarball without the zipball fallback. The
+// tarball is spooled to disk, so a download cut off can resume where it
+// stopped, then hashed and extracted.
+func downloadTarballOnly(owner, repo, sha, destPath, subdir string) (string, error) {
+	tmpFile, err := createTemp("", "deps-tarball-*")
+	if err != nil {
+		return "", err
+	}
+	defer removeTemp(tmpFile.Name())
+	defer tmpFile.Close()
+	p := startProgress(owner+"/"+repo, -1)
+	defer p.finish()
+	if err := downloadResumable(githubTarballURL(owner, repo, sha), owner+"/"+repo, tmpFile, p, githubAPIError); err != nil {
+		return "", err
+	}
+
+	hash, err := hashFile(tmpFile.Name())
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmpFile.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if err := extractArchive(tmpFile, destPath, subdir); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+func extractTarball(r io.Reader, destPath string) error {
+	return extractTarballSubdir(r, destPath, "")
+}
+
+// makeExtractDir creates an empty directory beside destPath to extract into.
+// Being on the same filesystem, it can be renamed over destPath once the
+// extraction is complete.
+func makeExtractDir(destPath string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return "", err
+	}
+	dir, err := mkdirTemp(filepath.Dir(destPath), "."+filepath.Base(destPath)+".tmp-")
+	if err != nil {
+		return "", err
+	}
+	// MkdirTemp makes directories only their owner can read
+	if err := os.Chmod(dir, 0755); err != nil {
+		removeTemp(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// archiveEntryPath returns where the archive entry name is extracted to under
+// dir. Entries that would land outside dir, through "..", an absolute path or
+// a drive letter, are an error rather than skipped, since only a broken or
+// malicious archive has them.
+func archiveEntryPath(dir, name string) (string, error) {
+	clean := name
+	if runtime.GOOS == "windows" {
+		clean = strings.ReplaceAll(clean, "\\", "/")
+	}
+	clean = path.Clean(clean)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || hasDriveLetter(clean) {
+		return "", fmt.Errorf("archive entry %q is outside the destination directory", name)
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean)), nil
+}
+
+// hasDriveLetter reports whether p starts with a Windows drive, like "C:"
+func hasDriveLetter(p string) bool {
+	return len(p) >= 2 && p[1] == ':' && ('a' <= p[0]|0x20 && p[0]|0x20 <= 'z')
+}
+
+// replaceDir moves the directory tmp to destPath, replacing whatever is
+// there. The old directory is moved aside rather than deleted first, and put
+// back if tmp can't take its place.
+func replaceDir(tmp, destPath string) error {
+	old := tmp + ".old"
+	// Both renames happen before exitAfterCleanup can run
+	partialMu.Lock()
+	if err := os.Rename(destPath, old); err != nil && !os.IsNotExist(err) {
+		partialMu.Unlock()
+		return err
+	}
+	if err := os.Rename(tmp, destPath); err != nil {
+		os.Rename(old, destPath)
+		partialMu.Unlock()
+		return err
+	}
+	tempPaths[old] = true
+	partialMu.Unlock()
+	removeTemp(old)
+	return nil
+}
+
+// extractTarballSubdir extracts only the entries under subdir (relative to the
+// archive root) into destPath. An empty subdir extracts everything.
+func extractTarballSubdir(r io.Reader, destPath, subdir string) error {
+	return extractTar(r, destPath, subdir, true)
+}
+
+// extractTar extracts the entries under subdir of the tarball read from r
+// into destPath. With stripRoot, the root directory GitHub-style tarballs
+// wrap their contents in is removed, and entries outside it are skipped.
+func extractTar(r io.Reader, destPath, subdir string, stripRoot bool) error {
+	// Extract beside destPath and only replace it once the whole archive has
+	// been read, so a failed download leaves what was installed before
+	tmp, err := makeExtractDir(destPath)
+	if err != nil {
+		return err
+	}
+	defer removeTemp(tmp)
+
+	// Open the tar stream, however it is compressed
+	stream, err := openTarStream(r)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	// Open tar reader
+	tr := tar.NewReader(stream)
+
+	// Track the root directory name (GitHub adds a prefix like "repo-sha/")
+	var rootDir string
+	foundSubdir := false
+	files, size := 0, int64(0)
+	var links []archiveLink
+	var skipped []string
+	var dirs []extractedDir
+
+	for {
+		// The archive may come from a file, which Ctrl-C doesn't interrupt
+		if err := runContext.Err(); err != nil {
+			return err
+		}
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		// Skip pax headers and other non-standard entries
+		if header.Typeflag == tar.TypeXGlobalHeader || header.Name == "pax_global_header" {
+			continue
+		}
+
+		name := strings.TrimPrefix(header.Name, "./")
+		if stripRoot {
+			// Detect the root directory from the first real directory entry
+			if rootDir == "" && strings.Contains(header.Name, "/") {
+				parts := strings.Split(header.Name, "/")
+				if len(parts) > 0 && strings.Contains(parts[0], "-") {
+					rootDir = parts[0] + "/"
+				}
+			}
+
+			// Skip the root directory entry itself
+			if header.Typeflag == tar.TypeDir && rootDir != "" && header.Name == rootDir[:len(rootDir)-1] {
+				continue
+			}
+
+			// Skip entries that don't start with our detected root directory
+			if rootDir == "" || !strings.HasPrefix(header.Name, rootDir) {
+				continue
+			}
+
+			// Remove the root directory prefix to flatten the structure
+			name = strings.TrimPrefix(header.Name, rootDir)
+		}
+
+		// Only keep entries inside the requested subdirectory
+		if subdir != "" {
+			if strings.TrimSuffix(name, "/") == subdir {
+				foundSubdir = true
+				continue
+			}
+			if !strings.HasPrefix(name, subdir+"/") {
+				continue
+			}
+			foundSubdir = true
+			name = strings.TrimPrefix(name, subdir+"/")
+		}
+
+		if name == "" {
+			continue
+		}
+
+		target, err := archiveEntryPath(tmp, name)
+		if err != nil {
+			return err
+		}
+		if runtime.GOOS == "windows" && !windowsSafeName(name) {
+			skipped = append(skipped, fmt.Sprintf("%s (not a valid file name on Windows)", name))
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+			if err != nil {
+				return err
+			}
+			dirs = append(dirs, extractedDir{Path: target, Mode: entryMode(header.Mode), ModTime: header.ModTime})
+		case tar.TypeReg:
+			err = os.MkdirAll(filepath.Dir(target), 0755)
+			if err != nil {
+				return err
+			}
+
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, entryMode(header.Mode))
+			if err != nil {
+				return err
+			}
+
+			// The mode given to OpenFile is masked by the umask
+			n, err := io.Copy(f, tr)
+			if err == nil {
+				err = f.Chmod(entryMode(header.Mode))
+			}
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err == nil {
+				err = setModTime(target, header.ModTime)
+			}
+			if err != nil {
+				return err
+			}
+			files++
+			noteExtracted()
+			size += n
+			debugf("  extracted %s (%s)\n", name, formatSize(n))
+		case tar.TypeSymlink:
+			links = append(links, archiveLink{Name: path.Clean(name), Target: header.Linkname})
+		case tar.TypeLink:
+			// A hardlink names an earlier entry of the archive, which is copied
+			source, ok := strings.CutPrefix(header.Linkname, rootDir)
+			if ok && subdir != "" {
+				source, ok = strings.CutPrefix(source, subdir+"/")
+			}
+			if !ok {
+				skipped = append(skipped, fmt.Sprintf("%s (hardlink to %s, outside the dependency)", name, header.Linkname))
+				continue
+			}
+			if link, isLink := findArchiveLink(links, path.Clean(source)); isLink {
+				links = append(links, archiveLink{Name: path.Clean(name), Target: link.Target})
+				continue
+			}
+			n, err := copyArchiveEntry(tmp, source, target, entryMode(header.Mode))
+			if err != nil {
+				skipped = append(skipped, fmt.Sprintf("%s (hardlink to %s, which isn't a file)", name, strings.TrimPrefix(header.Linkname, rootDir)))
+				continue
+			}
+			if err := setModTime(target, header.ModTime); err != nil {
+				return err
+			}
+			files++
+			noteExtracted()
+			size += n
+			debugf("  extracted %s (%s, a copy of %s)\n", name, formatSize(n), source)
+		default:
+			skipped = append(skipped, fmt.Sprintf("%s (%s)", name, tarTypeName(header.Typeflag)))
+		}
+	}
+
+	if subdir != "" && !foundSubdir {
+		return fmt.Errorf("subdirectory %s not found in archive", subdir)
+	}
+	if err := stream.Close(); err != nil {
+		return err
+	}
+	if err := createArchiveLinks(tmp, destPath, links); err != nil {
+		return err
+	}
+	if err := finishDirs(dirs); err != nil {
+		return err
+	}
+	if err := replaceDir(tmp, destPath); err != nil {
+		return err
+	}
+	warnSkippedEntries(destPath, skipped)
+
+	debugf("Extracted %d files (%s) from %s into %s\n", files, formatSize(size), strings.TrimSuffix(rootDir, "/"), destPath)
+	return nil
+}
+
+// entryMode returns the permission bits of an archive entry. Setuid, setgid
+// and sticky bits are dropped, as nothing downloaded should run as someone
+// else.
+func entryMode(mode int64) os.FileMode {
+	return os.FileMode(mode).Perm()
+}
+
+// extractedDir is a directory whose mode and modification time are set once
+// everything in it has been written
+type extractedDir struct {
+	Path    string
+	Mode    os.FileMode
+	ModTime time.Time
+}
+
+// finishDirs applies the modes, and with preserveMtime the modification
+// times, of the directories extracted, deepest first so that setting one
+// isn't undone by its contents. Directories stay writable by their owner, or
+// deps couldn't replace them.
+func finishDirs(dirs []extractedDir) error {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dir := dirs[i]
+		if err := os.Chmod(dir.Path, dir.Mode|0700); err != nil {
+			return err
+		}
+		if preserveMtime && !dir.ModTime.IsZero() {
+			os.Chtimes(dir.Path, dir.ModTime, dir.ModTime)
+		}
+	}
+	return nil
+}
+
+// setModTime gives the file at path the archive's modification time, if
+// preserveMtime is set
+func setModTime(path string, modTime time.Time) error {
+	if !preserveMtime || modTime.IsZero() {
+		return nil
+	}
+	return os.Chtimes(path, modTime, modTime)
+}
+
+// findArchiveLink returns the symlink entry called name
+func findArchiveLink(links []archiveLink, name string) (archiveLink, bool) {
+	for _, link := range links {
+		if link.Name == name {
+			return link, true
+		}
+	}
+	return archiveLink{}, false
+}
+
+// copyArchiveEntry copies the regular file already extracted as source to
+// target, returning its size
+func copyArchiveEntry(root, source, target string, mode os.FileMode) (int64, error) {
+	sourcePath, err := archiveEntryPath(root, source)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Lstat(sourcePath)
+	if err != nil {
+		return 0, err
+	}
+	if !info.Mode().IsRegular() {
+		return 0, fmt.Errorf("%s is not a regular file", source)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, err
+	}
+	os.Remove(target)
+	return info.Size(), copyFile(sourcePath, target, mode)
+}
+
+// tarTypeName describes a tar entry type that isn't extracted
+func tarTypeName(typeflag byte) string {
+	switch typeflag {
+	case tar.TypeChar:
+		return "character device"
+	case tar.TypeBlock:
+		return "block device"
+	case tar.TypeFifo:
+		return "FIFO"
+	}
+	return fmt.Sprintf("tar entry type %q", typeflag)
+}
+
+// zipTypeName describes a zip entry that isn't a regular file
+func zipTypeName(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	case mode&os.ModeCharDevice != 0:
+		return "character device"
+	case mode&os.ModeDevice != 0:
+		return "block device"
+	case mode&os.ModeNamedPipe != 0:
+		return "FIFO"
+	}
+	return "not a regular file"
+}
+
+// warnSkippedEntries reports the entries of an archive that weren't extracted
+// into destPath, since the dependency may not work without them
+func warnSkippedEntries(destPath string, skipped []string) {
+	if len(skipped) == 0 {
+		return
+	}
+	noun := "entries"
+	if len(skipped) == 1 {
+		noun = "entry"
+	}
+	warnf("%s Skipped %d archive %s that can't be installed in %s:\n", colorize(colorYellow, "!"), len(skipped), noun, destPath)
+	for i, entry := range skipped {
+		if i == 10 {
+			warnf("    ... and %d more\n", len(skipped)-i)
+			break
+		}
+		warnf("    %s\n", entry)
+	}
+}
+
+// extractZip extracts the zip archive at zipPath into destPath, keeping only
+// entries under subdir. With stripRoot, the single top-level directory that
+// GitHub-style archives wrap their contents in is removed.
+func extractZip(zipPath, destPath, subdir string, stripRoot bool) error {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	// As with tarballs, destPath is only replaced once everything is written
+	tmp, err := makeExtractDir(destPath)
+	if err != nil {
+		return err
+	}
+	defer removeTemp(tmp)
+
+	foundSubdir := false
+	files, size := 0, int64(0)
+	var skipped []string
+	var links []archiveLink
+
+	for _, f := range zr.File {
+		if err := runContext.Err(); err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(f.Name, "/")
+		if stripRoot {
+			_, name, _ = strings.Cut(name, "/")
+		}
+
+		if subdir != "" {
+			if strings.TrimSuffix(name, "/") == subdir {
+				foundSubdir = true
+				continue
+			}
+			if !strings.HasPrefix(name, subdir+"/") {
+				continue
+			}
+			foundSubdir = true
+			name = strings.TrimPrefix(name, subdir+"/")
+		}
+
+		if name == "" {
+			continue
+		}
+
+		target, err := archiveEntryPath(tmp, name)
+		if err != nil {
+			return err
+		}
+		if runtime.GOOS == "windows" && !windowsSafeName(name) {
+			skipped = append(skipped, fmt.Sprintf("%s (not a valid file name on Windows)", name))
+			continue
+		}
+
+		if f.FileInfo().IsDir() {
+			err = os.MkdirAll(target, 0755)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if f.Mode()&os.ModeSymlink != 0 {
+			// A symlink's target is its content
+			target, err := readZipLink(f)
+			if err != nil {
+				return err
+			}
+			links = append(links, archiveLink{Name: path.Clean(name), Target: target})
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			skipped = append(skipped, fmt.Sprintf("%s (%s)", name, zipTypeName(f.Mode())))
+			continue
+		}
+
+		err = os.MkdirAll(filepath.Dir(target), 0755)
+		if err != nil {
+			return err
+		}
+
+		err = extractZipFile(f, target)
+		if err != nil {
+			return err
+		}
+		files++
+		noteExtracted()
+		size += int64(f.UncompressedSize64)
+		debugf("  extracted %s (%s)\n", name, formatSize(int64(f.UncompressedSize64)))
+	}
+
+	if subdir != "" && !foundSubdir {
+		return fmt.Errorf("subdirectory %s not found in archive", subdir)
+	}
+	if err := createArchiveLinks(tmp, destPath, links); err != nil {
+		return err
+	}
+	if err := replaceDir(tmp, destPath); err != nil {
+		return err
+	}
+	warnSkippedEntries(destPath, skipped)
+
+	debugf("Extracted %d files (%s) from %s into %s\n", files, formatSize(size), zipPath, destPath)
+	return nil
+}
+
+// readZipLink returns the target of a symlink entry
+func readZipLink(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	// No platform allows a target anywhere near this long
+	data, err := io.ReadAll(io.LimitReader(rc, 4096))
+	return string(data), err
+}
+
+func extractZipFile(f *zip.File, target string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	mode := f.Mode().Perm()
+	if mode == 0 {
+		mode = 0644
+	}
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, rc)
+	if err == nil {
+		err = out.Chmod(mode)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = setModTime(target, f.Modified)
+	}
+	return err
+}
+
+// sortedKeys returns the dependency URLs in a stable order
+func sortedKeys(deps map[string]Dependency) []string {
+	keys := make([]string, 0, len(deps))
+	for key := range deps {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// depsDir is the directory dependencies are installed in, .deps unless the
+// dir setting (or DEPS_DIR) names another
+var depsDir = ".deps"
+
+// preserveMtime gives extracted files the modification times recorded in the
+// archive (for GitHub, the commit's) instead of the time they were installed
+var preserveMtime bool
+
+// configurePreserveMtime reads the preserve-mtime setting
+func configurePreserveMtime() {
+	preserveMtime = configBool("preserve-mtime")
+}
+
+// configureDepsDir installs dependencies in the directory of the dir setting,
+// if there is one. The project directory itself, or a parent of it, would
+// have prune remove the project, so they are refused.
+func configureDepsDir() error {
+	depsDir = ".deps"
+	value, origin := configLookup("dir")
+	if value == "" {
+		return nil
+	}
+	if err := validateDepsDir(value); err != nil {
+		return fmt.Errorf("%v in %s", err, origin)
+	}
+	depsDir = filepath.Clean(value)
+	return nil
+}
+
+func validateDepsDir(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(abs, wd); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("invalid dir %q: it holds the project itself", dir)
+	}
+	return nil
+}
+
+// validateProjectDepsDir checks a dir set in .deps.yml, which has to be
+// inside the project, symlinks followed: prune, sync and install remove and
+// replace what is in it, and a cloned repository mustn't point them at
+// ~/.ssh or /etc
+func validateProjectDepsDir(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	abs, wd = resolveExistingPath(abs), resolveExistingPath(wd)
+	if rel, err := filepath.Rel(wd, abs); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("invalid dir %q: %s can only set a directory inside the project", dir, projectConfigFile)
+	}
+	return nil
+}
+
+// resolveExistingPath follows the symlinks of the part of the absolute path
+// that exists, keeping the rest as it is
+func resolveExistingPath(path string) string {
+	rest := ""
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		if dir == filepath.Dir(dir) {
+			return path
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+	}
+}
+
+// getDepPath returns the install directory for a dependency. Subdirectory
+// dependencies ("github.com/org/repo//pkg") install beside their repository,
+// at .deps/github.com/org/repo%2F%2Fpkg.
 func getDepPath(repoURL string) string {
-	return filepath.Join(".deps", repoURL)
+	return depPathFor(repoURL, depAliases[repoURL])
+}
+
+// depPathFor returns where the dependency at repoURL is installed with alias,
+// as layoutPath lays it out
+func depPathFor(repoURL, alias string) string {
+	if alias != "" {
+		return filepath.Join(installRoot(depsDir), layoutPath(alias))
+	}
+	return filepath.Join(installRoot(depsDir), layoutPath(repoURL))
 }
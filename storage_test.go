@@ -7,13 +7,17 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 // --- getDepPath tests ---
@@ -25,6 +29,7 @@ func TestGetDepPath(t *testing.T) {
 	}{
 		{"github.com/user/repo", filepath.Join(".deps", "github.com/user/repo")},
 		{"github.com/org/project", filepath.Join(".deps", "github.com/org/project")},
+		{"github.com/org/monorepo//packages/foo", filepath.Join(".deps", "github.com/org/monorepo%2F%2Fpackages%2Ffoo")},
 	}
 
 	for _, tt := range tests {
@@ -37,6 +42,25 @@ func TestGetDepPath(t *testing.T) {
 	}
 }
 
+func TestConfigureDepsDir(t *testing.T) {
+	t.Cleanup(func() { configureDepsDir() })
+
+	t.Setenv("DEPS_DIR", "third_party/")
+	if err := configureDepsDir(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := getDepPath("github.com/user/repo"), filepath.Join("third_party", "github.com/user/repo"); got != want {
+		t.Errorf("getDepPath = %q, want %q", got, want)
+	}
+
+	for _, dir := range []string{".", "..", "/", "./"} {
+		t.Setenv("DEPS_DIR", dir)
+		if err := configureDepsDir(); err == nil {
+			t.Errorf("expected an error for DEPS_DIR=%s", dir)
+		}
+	}
+}
+
 // --- colorize tests ---
 
 func TestColorize_NoColor(t *testing.T) {
@@ -56,6 +80,40 @@ func TestColorize_DumbTerminal(t *testing.T) {
 	}
 }
 
+func TestColorize_NotATerminal(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	t.Setenv("TERM", "xterm")
+	var got string
+	captureOutput(t, func() { got = colorize(colorRed, "error") })
+	if got != "error" {
+		t.Errorf("colorize into a pipe = %q, want %q", got, "error")
+	}
+}
+
+func TestColorize_Mode(t *testing.T) {
+	defer func() { colorMode = colorAuto }()
+	t.Setenv("NO_COLOR", "1")
+
+	if err := configureColor(colorAlways); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := colorize(colorGreen, "ok"); got != colorGreen+"ok"+colorReset {
+		t.Errorf("colorize with --color=always = %q, want it colored despite NO_COLOR", got)
+	}
+
+	t.Setenv("NO_COLOR", "")
+	if err := configureColor(colorNever); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := colorize(colorGreen, "ok"); got != "ok" {
+		t.Errorf("colorize with --color=never = %q, want %q", got, "ok")
+	}
+
+	if err := configureColor("sometimes"); err == nil {
+		t.Error("expected an error for --color=sometimes")
+	}
+}
+
 // --- Lock file round-trip tests ---
 
 // withTempDir creates a temporary directory, chdirs into it, and returns a
@@ -225,6 +283,115 @@ func TestLoadLockFile_InvalidJSON(t *testing.T) {
 	}
 }
 
+func TestMarshalLockFile_Canonical(t *testing.T) {
+	deps := map[string]Dependency{}
+	for _, name := range []string{"zeta", "alpha", "mid", "beta"} {
+		deps["github.com/user/"+name] = Dependency{Ref: "feature/a&b", SHA: "abc123def456abc123def456abc123def456abc1"}
+	}
+	lf := &LockFile{Version: lockFileVersion, Dependencies: deps}
+
+	first, err := marshalLockFile(lf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		again, _ := marshalLockFile(lf)
+		if !bytes.Equal(first, again) {
+			t.Fatal("marshalLockFile is not deterministic")
+		}
+	}
+
+	if !bytes.HasSuffix(first, []byte("}\n")) || bytes.HasSuffix(first, []byte("\n\n")) {
+		t.Errorf("expected a single trailing newline, got %q", first[len(first)-3:])
+	}
+	if !bytes.Contains(first, []byte(`"feature/a&b"`)) {
+		t.Error("expected refs to be written without HTML escaping")
+	}
+	order := []string{"alpha", "beta", "mid", "zeta"}
+	last := -1
+	for _, name := range order {
+		i := bytes.Index(first, []byte(`"github.com/user/`+name+`"`))
+		if i < last {
+			t.Errorf("dependencies not sorted: %s out of order", name)
+		}
+		last = i
+	}
+}
+
+func TestReadLockFile_Errors(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	if _, err := readLockFile(); !os.IsNotExist(err) {
+		t.Errorf("expected not-exist error for missing lock file, got %v", err)
+	}
+
+	os.WriteFile(".deps.lock", []byte("not json at all"), 0644)
+	if _, err := readLockFile(); err == nil {
+		t.Error("expected error for invalid JSON, got nil")
+	}
+
+	os.WriteFile(".deps.lock", []byte(`{}`), 0644)
+	lf, err := readLockFile()
+	if err != nil || lf.Dependencies == nil {
+		t.Errorf("expected empty dependencies for {}, got %+v (%v)", lf, err)
+	}
+}
+
+func TestParseLockFile_Versions(t *testing.T) {
+	lf, from, err := parseLockFile([]byte(`{"dependencies":{"github.com/user/repo":{"ref":"main","sha":"abc"}}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if from != 0 || lf.Version != lockFileVersion {
+		t.Errorf("unversioned file: from %d, version %d; want 0 and %d", from, lf.Version, lockFileVersion)
+	}
+	if lf.Dependencies["github.com/user/repo"].Ref != "main" {
+		t.Error("dependencies should survive migration")
+	}
+
+	_, _, err = parseLockFile([]byte(fmt.Sprintf(`{"version":%d,"dependencies":{}}`, lockFileVersion+1)))
+	var versionErr *lockVersionError
+	if !errors.As(err, &versionErr) {
+		t.Errorf("expected lockVersionError for a newer file, got %v", err)
+	}
+}
+
+func TestSaveLockFile_WritesVersion(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	if err := saveLockFile(&LockFile{Dependencies: map[string]Dependency{}}); err != nil {
+		t.Fatalf("saveLockFile error: %v", err)
+	}
+	data, _ := os.ReadFile(".deps.lock")
+	if !bytes.Contains(data, []byte(fmt.Sprintf(`"version": %d`, lockFileVersion))) {
+		t.Errorf("expected version in saved lock file, got:\n%s", data)
+	}
+}
+
+func TestCheckFrozen(t *testing.T) {
+	lf := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/user/ok":             {Ref: "v1.0.0", SHA: "abc123def456abc123def456abc123def456abc1", Hash: "e3b0c442"},
+		"github.com/user/nohash":         {Ref: "main", SHA: "abc123def456abc123def456abc123def456abc1"},
+		"github.com/user/short":          {Ref: "main", SHA: "abc123", Hash: "e3b0c442"},
+		"github.com/user/unlocked":       {Constraint: "^1.4", Hash: "e3b0c442"},
+		"https://example.com/ok.zip":     {Hash: "e3b0c442"},
+		"https://example.com/nohash.zip": {TreeHash: "e3b0c442"},
+	}}
+
+	problems := checkFrozen(lf)
+	if len(problems) != 4 {
+		t.Fatalf("expected 4 problems, got %v", problems)
+	}
+	want := []string{"github.com/user/nohash", "github.com/user/short", "github.com/user/unlocked", "https://example.com/nohash.zip"}
+	for i, problem := range problems {
+		if !strings.HasPrefix(problem.Error(), want[i]+":") {
+			t.Errorf("problem %d = %q, want one about %s", i, problem, want[i])
+		}
+	}
+}
+
 func TestSaveLockFile_JSONFormat(t *testing.T) {
 	cleanup := withTempDir(t)
 	defer cleanup()
@@ -384,6 +551,33 @@ func TestExtractTarball_OverwritesExistingDir(t *testing.T) {
 	}
 }
 
+func TestExtractTarball_FailureKeepsExistingDir(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	destPath := filepath.Join("extracted", "repo")
+	os.MkdirAll(destPath, 0755)
+	os.WriteFile(filepath.Join(destPath, "old-file.txt"), []byte("old"), 0644)
+
+	// Cut the download off partway through a file
+	tarball := makeTarGz(t, "repo-sha123/", map[string]string{
+		"new-file.txt": strings.Repeat("new content ", 1000),
+	}).Bytes()
+	if err := extractTarball(bytes.NewReader(tarball[:len(tarball)/2]), destPath); err == nil {
+		t.Fatal("expected an error for a truncated tarball")
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(destPath, "old-file.txt")); string(data) != "old" {
+		t.Errorf("old-file.txt = %q, want it kept", data)
+	}
+	if _, err := os.Stat(filepath.Join(destPath, "new-file.txt")); !os.IsNotExist(err) {
+		t.Error("new-file.txt should not have been extracted")
+	}
+	if entries, _ := os.ReadDir("extracted"); len(entries) != 1 {
+		t.Errorf("extracted/ has %d entries, want the temporary directory removed", len(entries))
+	}
+}
+
 func TestExtractTarball_EmptyArchive(t *testing.T) {
 	cleanup := withTempDir(t)
 	defer cleanup()
@@ -410,6 +604,151 @@ func TestExtractTarball_EmptyArchive(t *testing.T) {
 	}
 }
 
+func TestExtractTarball_PathTraversal(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	for _, name := range []string{"../../evil.txt", "lib/../../evil.txt"} {
+		tarball := makeTarGz(t, "repo-abc1234/", map[string]string{name: "pwned"})
+		if err := extractTarball(tarball, filepath.Join("deps", "repo")); err == nil {
+			t.Errorf("expected an error for %q", name)
+		}
+	}
+	if _, err := os.Stat("evil.txt"); !os.IsNotExist(err) {
+		t.Error("evil.txt was written outside the destination")
+	}
+	if _, err := os.Stat(filepath.Join("deps", "repo")); !os.IsNotExist(err) {
+		t.Error("a rejected archive should not be installed")
+	}
+}
+
+func TestArchiveEntryPath(t *testing.T) {
+	for _, name := range []string{"a.txt", "lib/a.c", "lib/../a.txt", "./a.txt"} {
+		if _, err := archiveEntryPath("dest", name); err != nil {
+			t.Errorf("archiveEntryPath(%q): unexpected error: %v", name, err)
+		}
+	}
+	for _, name := range []string{"..", "../a.txt", "lib/../../a.txt", "/etc/passwd", "C:/Windows/a.dll", "c:a.txt"} {
+		if _, err := archiveEntryPath("dest", name); err == nil {
+			t.Errorf("archiveEntryPath(%q): expected an error", name)
+		}
+	}
+}
+
+func TestExtractTarball_OtherEntryTypes(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, header := range []*tar.Header{
+		{Name: "repo-abc1234/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "repo-abc1234/pkg/a.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 5},
+		{Name: "repo-abc1234/b.txt", Typeflag: tar.TypeLink, Linkname: "repo-abc1234/pkg/a.txt", Mode: 0644},
+		{Name: "repo-abc1234/pkg/ln", Typeflag: tar.TypeSymlink, Linkname: "a.txt"},
+		{Name: "repo-abc1234/pkg/ln2", Typeflag: tar.TypeLink, Linkname: "repo-abc1234/pkg/ln"},
+		{Name: "repo-abc1234/pipe", Typeflag: tar.TypeFifo, Mode: 0644},
+		{Name: "repo-abc1234/tty", Typeflag: tar.TypeChar, Mode: 0644, Devmajor: 4},
+		{Name: "repo-abc1234/gone", Typeflag: tar.TypeLink, Linkname: "repo-abc1234/missing"},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Size > 0 {
+			tw.Write([]byte("hello"))
+		}
+	}
+	tw.Close()
+	gw.Close()
+
+	destPath := "dest"
+	output, _ := captureOutput(t, func() {
+		if err := extractTarball(&buf, destPath); err != nil {
+			t.Fatalf("extractTarball error: %v", err)
+		}
+	})
+
+	info, err := os.Lstat(filepath.Join(destPath, "b.txt"))
+	if err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("b.txt = %v, %v, want a copy of pkg/a.txt", info, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(destPath, "b.txt")); string(data) != "hello" {
+		t.Errorf("b.txt = %q, want pkg/a.txt's contents", data)
+	}
+	if target, err := os.Readlink(filepath.Join(destPath, "pkg", "ln2")); err != nil || target != "a.txt" {
+		t.Errorf("pkg/ln2 -> %q (%v), want the same link as pkg/ln", target, err)
+	}
+	for _, name := range []string{"pipe", "tty", "gone"} {
+		if _, err := os.Lstat(filepath.Join(destPath, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should have been skipped", name)
+		}
+	}
+	for _, want := range []string{"Skipped 3 archive entries", "pipe (FIFO)", "tty (character device)", "gone (hardlink to missing"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestExtractTarball_ModesAndTimes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no permission bits")
+	}
+	cleanup := withTempDir(t)
+	defer cleanup()
+	t.Cleanup(func() { preserveMtime = false })
+
+	commitTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	makeArchive := func() *bytes.Buffer {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		for _, header := range []*tar.Header{
+			{Name: "repo-abc1234/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: commitTime},
+			{Name: "repo-abc1234/bin/", Typeflag: tar.TypeDir, Mode: 0750, ModTime: commitTime},
+			{Name: "repo-abc1234/bin/tool", Typeflag: tar.TypeReg, Mode: 0775, Size: 2, ModTime: commitTime},
+			{Name: "repo-abc1234/shared.txt", Typeflag: tar.TypeReg, Mode: 0664, Size: 2, ModTime: commitTime},
+			{Name: "repo-abc1234/setuid", Typeflag: tar.TypeReg, Mode: 04755, Size: 2, ModTime: commitTime},
+		} {
+			tw.WriteHeader(header)
+			if header.Size > 0 {
+				tw.Write([]byte("hi"))
+			}
+		}
+		tw.Close()
+		gw.Close()
+		return &buf
+	}
+
+	if err := extractTarball(makeArchive(), "dest"); err != nil {
+		t.Fatalf("extractTarball error: %v", err)
+	}
+	// The umask doesn't take group write away
+	for name, want := range map[string]os.FileMode{"dest": 0755, "dest/bin": 0750, "dest/bin/tool": 0775, "dest/shared.txt": 0664, "dest/setuid": 0755} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode() & (os.ModePerm | os.ModeSetuid); got != want {
+			t.Errorf("%s mode = %v, want %v", name, got, want)
+		}
+	}
+	if info, _ := os.Stat("dest/shared.txt"); info.ModTime().Equal(commitTime) {
+		t.Error("files should get the install time unless preserve-mtime is set")
+	}
+
+	preserveMtime = true
+	if err := extractTarball(makeArchive(), "dest"); err != nil {
+		t.Fatalf("extractTarball error: %v", err)
+	}
+	for _, name := range []string{"dest/bin", "dest/bin/tool", "dest/shared.txt"} {
+		if info, _ := os.Stat(name); !info.ModTime().Equal(commitTime) {
+			t.Errorf("%s mtime = %v, want %v", name, info.ModTime(), commitTime)
+		}
+	}
+}
+
 func TestExtractTarball_NestedDirectories(t *testing.T) {
 	cleanup := withTempDir(t)
 	defer cleanup()
@@ -435,6 +774,55 @@ func TestExtractTarball_NestedDirectories(t *testing.T) {
 	}
 }
 
+func TestExtractTarballSubdir(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	tarball := makeTarGz(t, "monorepo-abc1234/", map[string]string{
+		"README.md":                "# Monorepo",
+		"packages/foo/foo.go":      "package foo",
+		"packages/foo/lib/util.go": "package lib",
+		"packages/foobar/bar.go":   "package foobar",
+	})
+
+	destPath := "subdir-dest"
+	err := extractTarballSubdir(tarball, destPath, "packages/foo")
+	if err != nil {
+		t.Fatalf("extractTarballSubdir error: %v", err)
+	}
+
+	for name, want := range map[string]string{"foo.go": "package foo", "lib/util.go": "package lib"} {
+		data, err := os.ReadFile(filepath.Join(destPath, name))
+		if err != nil {
+			t.Errorf("file %q not found: %v", name, err)
+			continue
+		}
+		if string(data) != want {
+			t.Errorf("file %q content = %q, want %q", name, string(data), want)
+		}
+	}
+
+	for _, name := range []string{"README.md", "bar.go", "packages"} {
+		if _, err := os.Stat(filepath.Join(destPath, name)); !os.IsNotExist(err) {
+			t.Errorf("%q should not have been extracted", name)
+		}
+	}
+}
+
+func TestExtractTarballSubdir_NotFound(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	tarball := makeTarGz(t, "monorepo-abc1234/", map[string]string{
+		"packages/foo/foo.go": "package foo",
+	})
+
+	err := extractTarballSubdir(tarball, "subdir-dest", "packages/missing")
+	if err == nil {
+		t.Error("expected error for missing subdirectory, got nil")
+	}
+}
+
 // --- downloadRepo hash computation tests ---
 
 func TestDownloadRepo_ComputesHash(t *testing.T) {
@@ -516,6 +904,46 @@ func TestDownloadRepo_HTTPError(t *testing.T) {
 	}
 }
 
+func TestDownloadRepo_ZipballFallback(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	sha := "abc1234def456abc1234def456abc1234def4567"
+	zipball := makeZip(t, map[string]string{"testowner-testrepo-abc1234/file.txt": "from the zipball"})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/tarball/"+sha, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("mangled by a proxy"))
+	})
+	mux.HandleFunc("/repos/testowner/testrepo/zipball/"+sha, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(zipball)
+	})
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	repoURL := "github.com/testowner/testrepo"
+	dep, err := installDependency(repoURL, Dependency{Ref: "main", SHA: sha})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(getDepPath(repoURL), "file.txt")); string(data) != "from the zipball" {
+		t.Errorf("file.txt = %q", data)
+	}
+	if dep.Hash != "" || dep.TreeHash == "" {
+		t.Errorf("dep = %+v, want only a tree hash", dep)
+	}
+
+	// The tarball hash of a lock entry can't be checked, so it is kept, and
+	// the tree hash does the checking
+	dep.Hash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	if installed, err := installDependency(repoURL, dep); err != nil || installed.Hash != dep.Hash {
+		t.Errorf("install = %+v, %v, want the locked hash kept", installed, err)
+	}
+	dep.TreeHash = ""
+	if _, err := installDependency(repoURL, dep); err == nil || !strings.Contains(err.Error(), "zipball") {
+		t.Errorf("err = %v, want an error about the unchecked zipball", err)
+	}
+}
+
 func TestDownloadRepo_ConsistentHash(t *testing.T) {
 	cleanup := withTempDir(t)
 	defer cleanup()
@@ -710,3 +1138,716 @@ func TestHashVerification_TarballIntegrity(t *testing.T) {
 		t.Errorf("hash = %q, want %q", gotHash, expectedHash)
 	}
 }
+
+// --- Rename tests ---
+
+func TestRenameDependency(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	oldURL := "github.com/oldowner/repo"
+	newURL := "github.com/newowner/repo"
+	os.MkdirAll(getDepPath(oldURL), 0755)
+	os.WriteFile(filepath.Join(getDepPath(oldURL), "file.txt"), []byte("content"), 0644)
+
+	lf := &LockFile{Dependencies: map[string]Dependency{
+		oldURL: {Ref: "main", SHA: "abc123def456abc123def456abc123def456abc1"},
+	}}
+
+	err := renameDependency(lf, oldURL, newURL)
+	if err != nil {
+		t.Fatalf("renameDependency error: %v", err)
+	}
+
+	if _, ok := lf.Dependencies[oldURL]; ok {
+		t.Error("old entry should have been removed")
+	}
+	if lf.Dependencies[newURL].Ref != "main" {
+		t.Errorf("new entry = %+v, want ref main", lf.Dependencies[newURL])
+	}
+	if _, err := os.Stat(getDepPath(oldURL)); !os.IsNotExist(err) {
+		t.Error("old directory should have been moved")
+	}
+	data, err := os.ReadFile(filepath.Join(getDepPath(newURL), "file.txt"))
+	if err != nil || string(data) != "content" {
+		t.Errorf("moved file not found: %v", err)
+	}
+}
+
+func TestRenameDependency_Conflict(t *testing.T) {
+	lf := &LockFile{Dependencies: map[string]Dependency{
+		"github.com/a/repo": {Ref: "main"},
+		"github.com/b/repo": {Ref: "main"},
+	}}
+
+	if err := renameDependency(lf, "github.com/a/repo", "github.com/b/repo"); err == nil {
+		t.Error("expected error when new URL is already tracked, got nil")
+	}
+}
+
+func TestCheckDependency_Renamed(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	repoURL := "github.com/testowner/testrepo"
+	os.MkdirAll(getDepPath(repoURL), 0755)
+
+	sha := "abc123def456abc123def456abc123def456abc1"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"default_branch":"main","full_name":"neworg/testrepo"}`)
+	})
+	mux.HandleFunc("/repos/testowner/testrepo/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"commit":{"sha":"%s"}}`, sha)
+	})
+
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	result, err := checkDependency(repoURL, Dependency{Ref: "main", SHA: sha})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Status != "ok" {
+		t.Errorf("status = %q, want %q", result.Status, "ok")
+	}
+	if result.RenamedTo != "github.com/neworg/testrepo" {
+		t.Errorf("renamedTo = %q, want %q", result.RenamedTo, "github.com/neworg/testrepo")
+	}
+}
+
+// --- extractZip tests ---
+
+func TestExtractZip_PathTraversal(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	os.WriteFile("archive.zip", makeZip(t, map[string]string{"repo-abc1234/../../evil.txt": "pwned"}), 0644)
+	if err := extractZip("archive.zip", filepath.Join("deps", "repo"), "", true); err == nil {
+		t.Fatal("expected an error for an entry outside the destination")
+	}
+	if _, err := os.Stat("evil.txt"); !os.IsNotExist(err) {
+		t.Error("evil.txt was written outside the destination")
+	}
+}
+
+func TestExtractZip_StripRootAndSubdir(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	archive := makeZip(t, map[string]string{
+		"repo-abc1234/README.md":      "# Readme",
+		"repo-abc1234/pkg/foo/foo.go": "package foo",
+		"repo-abc1234/pkg/other/x.go": "package other",
+	})
+	os.WriteFile("archive.zip", archive, 0644)
+
+	err := extractZip("archive.zip", "dest", "pkg/foo", true)
+	if err != nil {
+		t.Fatalf("extractZip error: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join("dest", "foo.go"))
+	if err != nil || string(data) != "package foo" {
+		t.Errorf("foo.go not extracted correctly: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join("dest", "README.md")); !os.IsNotExist(err) {
+		t.Error("README.md should not have been extracted")
+	}
+}
+
+// --- Constraint resolution tests ---
+
+func TestResolveDependency_Constraint(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/tags", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"name":"v2.0.0","commit":{"sha":"2000000000000000000000000000000000000000"}},
+			{"name":"v1.5.1","commit":{"sha":"1510000000000000000000000000000000000000"}},
+			{"name":"v1.4.0","commit":{"sha":"1400000000000000000000000000000000000000"}}
+		]`)
+	})
+
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	sha, ref, err := resolveDependency("github.com/testowner/testrepo", Dependency{Ref: "v1.4.0", Constraint: "^1.4"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ref != "v1.5.1" || sha != "1510000000000000000000000000000000000000" {
+		t.Errorf("got (%q, %q), want v1.5.1", sha, ref)
+	}
+}
+
+func TestResolveUpdate_Levels(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/tags", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"name":"v2.1.0","commit":{"sha":"2100000000000000000000000000000000000000"}},
+			{"name":"v1.5.0","commit":{"sha":"1500000000000000000000000000000000000000"}},
+			{"name":"v1.4.3","commit":{"sha":"1430000000000000000000000000000000000000"}},
+			{"name":"v1.4.2","commit":{"sha":"1420000000000000000000000000000000000000"}}
+		]`)
+	})
+
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	dep := Dependency{Ref: "v1.4.2", SHA: "1420000000000000000000000000000000000000"}
+	for level, want := range map[string]string{updatePatch: "v1.4.3", updateMinor: "v1.5.0", updateMajor: "v2.1.0"} {
+		_, ref, err := resolveUpdate("github.com/testowner/testrepo", dep, level)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", level, err)
+		}
+		if ref != want {
+			t.Errorf("%s update = %q, want %q", level, ref, want)
+		}
+	}
+}
+
+func TestResolveUpdate_BranchIgnoresLevel(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"commit":{"sha":"abc123def456abc123def456abc123def456abc1"}}`)
+	})
+
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	_, ref, err := resolveUpdate("github.com/testowner/testrepo", Dependency{Ref: "main"}, updateMinor)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ref != "main" {
+		t.Errorf("ref = %q, want main", ref)
+	}
+}
+
+func TestResolveMetadata(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"default_branch":"main","description":"A test repo","license":{"spdx_id":"MIT","name":"MIT License"}}`)
+	})
+	mux.HandleFunc("/repos/testowner/testrepo/branches/v1.0.0", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	sha := "abc123def456abc123def456abc123def456abc1"
+	meta := resolveMetadata("github.com/testowner/testrepo", Dependency{Ref: "v1.0.0", SHA: sha}, "v1.0.0")
+	if meta.RefKind != "tag" || meta.License != "MIT" || meta.Description != "A test repo" {
+		t.Errorf("metadata = %+v", meta)
+	}
+	if meta.TarballURL != githubTarballURL("testowner", "testrepo", sha) {
+		t.Errorf("tarball_url = %q", meta.TarballURL)
+	}
+	if _, err := time.Parse(time.RFC3339, meta.ResolvedAt); err != nil {
+		t.Errorf("resolved_at = %q: %v", meta.ResolvedAt, err)
+	}
+}
+
+func TestLockRefKind(t *testing.T) {
+	sha := "abc123def456abc123def456abc123def456abc1"
+	tests := []struct {
+		dep         Dependency
+		resolvedRef string
+		want        string
+	}{
+		{Dependency{Constraint: "^1.4"}, "v1.4.2", "tag"},
+		{Dependency{Ref: refLatest}, "v2.0.0", "tag"},
+		{Dependency{}, "main", "branch"},
+		{Dependency{Ref: "abc123d"}, sha, "sha"},
+	}
+	for _, tt := range tests {
+		if got := lockRefKind("github.com/testowner/testrepo", tt.dep, tt.resolvedRef); got != tt.want {
+			t.Errorf("lockRefKind(%+v) = %q, want %q", tt.dep, got, tt.want)
+		}
+	}
+}
+
+func TestWithPolicy(t *testing.T) {
+	tests := []struct {
+		name           string
+		dep            Dependency
+		policy         string
+		wantConstraint string
+		wantErr        bool
+	}{
+		{"frozen", Dependency{Ref: "main"}, policyFrozen, "", false},
+		{"semver range from tag", Dependency{Ref: "v1.4.2"}, policySemverRange, "^1.4.2", false},
+		{"semver range from prefixed tag", Dependency{Ref: "pkg/v2.0.0", TagPrefix: "pkg/"}, policySemverRange, "^2.0.0", false},
+		{"semver range keeps constraint", Dependency{Ref: "v1.4.2", Constraint: "~1.4"}, policySemverRange, "~1.4", false},
+		{"semver range on branch", Dependency{Ref: "main"}, policySemverRange, "", true},
+		{"follow branch drops constraint", Dependency{Ref: "v1.4.2", Constraint: "^1.4"}, policyFollowBranch, "", false},
+		{"follow branch on SHA", Dependency{Ref: "abc123def456abc123def456abc123def456abc1"}, policyFollowBranch, "", true},
+		{"unknown", Dependency{Ref: "main"}, "sometimes", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dep, err := withPolicy(tt.dep, tt.policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if dep.Policy != tt.policy || dep.Constraint != tt.wantConstraint {
+				t.Errorf("got policy %q constraint %q, want %q %q", dep.Policy, dep.Constraint, tt.policy, tt.wantConstraint)
+			}
+		})
+	}
+
+	dep, err := withPolicy(Dependency{Ref: "main", Policy: policyFrozen}, policyAuto)
+	if err != nil || dep.Policy != "" {
+		t.Errorf("auto should clear the policy, got %q (%v)", dep.Policy, err)
+	}
+}
+
+func TestResolveUpdate_Policy(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/tags", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"name":"v2.1.0","commit":{"sha":"2100000000000000000000000000000000000000"}},
+			{"name":"v1.5.0","commit":{"sha":"1500000000000000000000000000000000000000"}}
+		]`)
+	})
+	mux.HandleFunc("/repos/testowner/testrepo/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"commit":{"sha":"abc123def456abc123def456abc123def456abc1"}}`)
+	})
+
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	// A semver-range policy stays within its range even when --major is given
+	dep := Dependency{Ref: "v1.4.2", Constraint: "^1.4.2", Policy: policySemverRange}
+	_, ref, err := resolveUpdate("github.com/testowner/testrepo", dep, updateMajor)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ref != "v1.5.0" {
+		t.Errorf("semver-range update = %q, want v1.5.0", ref)
+	}
+
+	dep = Dependency{Ref: "main", Policy: policyFollowBranch}
+	sha, ref, err := resolveUpdate("github.com/testowner/testrepo", dep, updateMajor)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ref != "main" || sha != "abc123def456abc123def456abc123def456abc1" {
+		t.Errorf("follow-branch update = (%q, %q), want main", sha, ref)
+	}
+
+	dep = Dependency{Ref: "v2.1.0", Policy: policyFollowBranch}
+	if _, _, err := resolveUpdate("github.com/testowner/testrepo", dep, ""); err == nil {
+		t.Error("expected error for follow-branch policy on a tag, got nil")
+	}
+}
+
+func TestUpdateDependency_FrozenPolicy(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request for frozen dependency: %s", r.URL.Path)
+	})
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+
+	repoURL := "github.com/testowner/testrepo"
+	dep := Dependency{Ref: "main", SHA: "abc123def456abc123def456abc123def456abc1", Policy: policyFrozen}
+	lf := &LockFile{Dependencies: map[string]Dependency{repoURL: dep}}
+
+	if updateDependency(repoURL, dep, lf, updateMajor, false) {
+		t.Error("frozen dependency should not be updated")
+	}
+}
+
+func TestResolveDependency_Latest(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/tags", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"name":"nightly","commit":{"sha":"9990000000000000000000000000000000000000"}},
+			{"name":"v1.10.0","commit":{"sha":"1100000000000000000000000000000000000000"}},
+			{"name":"v1.9.0","commit":{"sha":"1900000000000000000000000000000000000000"}}
+		]`)
+	})
+
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	sha, ref, err := resolveDependency("github.com/testowner/testrepo", Dependency{Ref: "latest"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ref != "v1.10.0" || sha != "1100000000000000000000000000000000000000" {
+		t.Errorf("got (%q, %q), want v1.10.0", sha, ref)
+	}
+}
+
+func TestResolveDependency_PreRelease(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/tags", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"name":"v2.0.0-rc.1","commit":{"sha":"2000000000000000000000000000000000000000"}},
+			{"name":"v1.9.0","commit":{"sha":"1900000000000000000000000000000000000000"}}
+		]`)
+	})
+
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	repoURL := "github.com/testowner/testrepo"
+
+	_, ref, err := resolveDependency(repoURL, Dependency{Ref: "latest"})
+	if err != nil || ref != "v1.9.0" {
+		t.Errorf("without pre: ref = %q, err = %v, want v1.9.0", ref, err)
+	}
+
+	_, ref, err = resolveDependency(repoURL, Dependency{Ref: "latest", Pre: true})
+	if err != nil || ref != "v2.0.0-rc.1" {
+		t.Errorf("with pre: ref = %q, err = %v, want v2.0.0-rc.1", ref, err)
+	}
+
+	_, ref, err = resolveDependency(repoURL, Dependency{Constraint: ">=1.5", Pre: true})
+	if err != nil || ref != "v2.0.0-rc.1" {
+		t.Errorf("constraint with pre: ref = %q, err = %v, want v2.0.0-rc.1", ref, err)
+	}
+}
+
+func TestResolveDependency_TagPrefix(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/tags", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"name":"cli/v3.0.0","commit":{"sha":"3000000000000000000000000000000000000000"}},
+			{"name":"sdk/v1.2.0","commit":{"sha":"1200000000000000000000000000000000000000"}},
+			{"name":"sdk/v1.1.0","commit":{"sha":"1100000000000000000000000000000000000000"}}
+		]`)
+	})
+
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	sha, ref, err := resolveDependency("github.com/testowner/testrepo", Dependency{Constraint: "^1", TagPrefix: "sdk/"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ref != "sdk/v1.2.0" || sha != "1200000000000000000000000000000000000000" {
+		t.Errorf("got (%q, %q), want sdk/v1.2.0", sha, ref)
+	}
+}
+
+// --- pin tests ---
+
+func TestSetPinned(t *testing.T) {
+	repoURL := "github.com/testowner/testrepo"
+	lf := &LockFile{Dependencies: map[string]Dependency{
+		repoURL: {Ref: "main", SHA: "abc123def456abc123def456abc123def456abc1"},
+	}}
+
+	if err := setPinned(lf, repoURL, true); err != nil {
+		t.Fatalf("pin error: %v", err)
+	}
+	if dep := lf.Dependencies[repoURL]; !dep.Pinned || dep.Ref != "main" {
+		t.Errorf("after pin = %+v, want pinned with ref main", dep)
+	}
+	if err := setPinned(lf, repoURL, true); err == nil {
+		t.Error("expected error pinning an already pinned dependency, got nil")
+	}
+
+	if err := setPinned(lf, repoURL, false); err != nil {
+		t.Fatalf("unpin error: %v", err)
+	}
+	if lf.Dependencies[repoURL].Pinned {
+		t.Error("dependency should no longer be pinned")
+	}
+	if err := setPinned(lf, "github.com/other/repo", true); err == nil {
+		t.Error("expected error for unknown dependency, got nil")
+	}
+}
+
+func TestUpdateDependency_Pinned(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request for pinned dependency: %s", r.URL.Path)
+	})
+	cleanup := testGitHubServer(t, mux)
+	defer cleanup()
+
+	repoURL := "github.com/testowner/testrepo"
+	dep := Dependency{Ref: "main", SHA: "abc123def456abc123def456abc123def456abc1", Pinned: true}
+	lf := &LockFile{Dependencies: map[string]Dependency{repoURL: dep}}
+
+	if updateDependency(repoURL, dep, lf, "", false) {
+		t.Error("pinned dependency should not be updated")
+	}
+}
+
+func TestUpdateDependency_DryRun(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"commit":{"sha":"ffffffffffffffffffffffffffffffffffffffff"}}`)
+	})
+	mux.HandleFunc("/repos/testowner/testrepo/tarball/", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("dry run should not download anything")
+	})
+	serverCleanup := testGitHubServer(t, mux)
+	defer serverCleanup()
+
+	repoURL := "github.com/testowner/testrepo"
+	dep := Dependency{Ref: "main", SHA: "abc123def456abc123def456abc123def456abc1"}
+	lf := &LockFile{Dependencies: map[string]Dependency{repoURL: dep}}
+
+	if !updateDependency(repoURL, dep, lf, "", true) {
+		t.Error("dry run should report the available update")
+	}
+	if lf.Dependencies[repoURL].SHA != dep.SHA {
+		t.Error("dry run should not change the lock entry")
+	}
+	if _, err := os.Stat(getDepPath(repoURL)); !os.IsNotExist(err) {
+		t.Error("dry run should not create the dependency directory")
+	}
+}
+
+func TestCheckDependency_Pinned(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	repoURL := "github.com/testowner/testrepo"
+	os.MkdirAll(getDepPath(repoURL), 0755)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"commit":{"sha":"ffffffffffffffffffffffffffffffffffffffff"}}`)
+	})
+	serverCleanup := testGitHubServer(t, mux)
+	defer serverCleanup()
+
+	dep := Dependency{Ref: "main", SHA: "abc123def456abc123def456abc123def456abc1", Pinned: true}
+	result, err := checkDependency(repoURL, dep)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Status != "pinned" {
+		t.Errorf("status = %q, want %q", result.Status, "pinned")
+	}
+}
+
+// --- resolve tests ---
+
+func TestNewDependency(t *testing.T) {
+	if dep := newDependency("^1.4"); dep.Constraint != "^1.4" || dep.Ref != "" {
+		t.Errorf("newDependency(^1.4) = %+v, want constraint", dep)
+	}
+	if dep := newDependency("main"); dep.Ref != "main" || dep.Constraint != "" {
+		t.Errorf("newDependency(main) = %+v, want ref", dep)
+	}
+}
+
+func TestRefKind(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"commit":{"sha":"abc123def456abc123def456abc123def456abc1"}}`)
+	})
+	mux.HandleFunc("/repos/testowner/testrepo/branches/v1.0.0", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	})
+
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	repoURL := "github.com/testowner/testrepo"
+	sha := "abc123def456abc123def456abc123def456abc1"
+	tests := []struct {
+		dep         Dependency
+		resolvedRef string
+		want        string
+	}{
+		{Dependency{}, "main", "default branch"},
+		{Dependency{Ref: "main"}, "main", "branch"},
+		{Dependency{Ref: "v1.0.0"}, "v1.0.0", "tag"},
+		{Dependency{Ref: "abc123d"}, sha, "commit"},
+		{Dependency{Constraint: "^1"}, "v1.0.0", "tag matching ^1"},
+		{Dependency{Ref: refLatest}, "v1.0.0", "highest semver tag"},
+	}
+
+	for _, tt := range tests {
+		got, err := refKind(repoURL, tt.dep, tt.resolvedRef)
+		if err != nil {
+			t.Fatalf("refKind(%+v) error: %v", tt.dep, err)
+		}
+		if got != tt.want {
+			t.Errorf("refKind(%+v) = %q, want %q", tt.dep, got, tt.want)
+		}
+	}
+}
+
+func TestArchiveURL(t *testing.T) {
+	sha := "abc123def456abc123def456abc123def456abc1"
+
+	got, err := archiveURL("github.com/testowner/testrepo//sub", Dependency{}, sha)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := githubAPIBaseURL + "/repos/testowner/testrepo/tarball/" + sha; got != want {
+		t.Errorf("archiveURL = %q, want %q", got, want)
+	}
+
+	got, _ = archiveURL("github.com/testowner/testrepo", Dependency{Transport: transportSSH}, sha)
+	if got != "git@github.com:testowner/testrepo.git" {
+		t.Errorf("SSH archiveURL = %q", got)
+	}
+
+	got, _ = archiveURL("dev.azure.com/org/project/_git/repo", Dependency{Transport: transportSSH}, sha)
+	if got != "git@ssh.dev.azure.com:v3/org/project/repo" {
+		t.Errorf("Azure SSH archiveURL = %q", got)
+	}
+
+	got, _ = archiveURL("dev.azure.com/org/project/_git/repo", Dependency{}, sha)
+	if !strings.Contains(got, "versionDescriptor.version="+sha) || !strings.Contains(got, "$format=zip") {
+		t.Errorf("Azure archiveURL = %q", got)
+	}
+}
+
+// --- getRepoDetails tests ---
+
+func TestGetRepoDetails(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"default_branch":"main","description":"A test repo","archived":true,"license":{"spdx_id":"MIT","name":"MIT License"}}`)
+	})
+	mux.HandleFunc("/repos/testowner/testrepo/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tag_name":"v1.2.0"}`)
+	})
+
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	details, err := getRepoDetails("github.com/testowner/testrepo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := RepoDetails{Description: "A test repo", DefaultBranch: "main", LatestRelease: "v1.2.0", License: "MIT", Archived: true}
+	if details != want {
+		t.Errorf("details = %+v, want %+v", details, want)
+	}
+}
+
+func TestGetRepoDetails_NoReleaseOrLicense(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/testrepo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"default_branch":"main","license":{"spdx_id":"NOASSERTION","name":"Other"}}`)
+	})
+	mux.HandleFunc("/repos/testowner/testrepo/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	})
+
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	details, err := getRepoDetails("github.com/testowner/testrepo")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if details.LatestRelease != "" || details.License != "Other" {
+		t.Errorf("details = %+v", details)
+	}
+}
+
+func TestConfigureLockFile(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	defer func() { lockFileOverride = "" }()
+	t.Setenv("DEPS_LOCKFILE", "")
+
+	os.MkdirAll("tools", 0755)
+	configureLockFile("tools/deps.lock")
+	if got := lockFilePath(); got != "tools/deps.lock" {
+		t.Errorf("lockFilePath() = %q", got)
+	}
+	if got := sumsFilePath(); got != "tools/deps.sums" {
+		t.Errorf("sumsFilePath() = %q", got)
+	}
+
+	lockFile := loadLockFile()
+	lockFile.Dependencies["github.com/user/tool"] = Dependency{Ref: "main", SHA: "75ccf94d605a05fe24817fc2f166f6f2959d5cea"}
+	if err := saveLockFile(lockFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(".deps.lock"); !os.IsNotExist(err) {
+		t.Error("saving with --lockfile wrote .deps.lock")
+	}
+	saved, err := readLockFile()
+	if err != nil || len(saved.Dependencies) != 1 {
+		t.Errorf("readLockFile() = %+v, %v", saved, err)
+	}
+
+	t.Setenv("DEPS_LOCKFILE", "other.toml")
+	configureLockFile("")
+	if got := lockFilePath(); got != "other.toml" {
+		t.Errorf("with DEPS_LOCKFILE, lockFilePath() = %q", got)
+	}
+	if got := sumsFilePath(); got != "other.sums" {
+		t.Errorf("with DEPS_LOCKFILE, sumsFilePath() = %q", got)
+	}
+}
+
+func TestConvertedLockFilePath(t *testing.T) {
+	tests := []struct {
+		path   string
+		toTOML bool
+		want   string
+	}{
+		{".deps.lock", true, ".deps.toml"},
+		{".deps.toml", false, ".deps.lock"},
+		{"tools/deps.lock", true, "tools/deps.toml"},
+	}
+	for _, tt := range tests {
+		if got := convertedLockFilePath(tt.path, tt.toTOML); got != tt.want {
+			t.Errorf("convertedLockFilePath(%q, %v) = %q, want %q", tt.path, tt.toTOML, got, tt.want)
+		}
+	}
+}
+
+func TestRemoveDependency(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	repoURL := "github.com/user/repo"
+	depPath := getDepPath(repoURL)
+	os.MkdirAll(depPath, 0755)
+	os.WriteFile(filepath.Join(depPath, "lib.h"), []byte("x"), 0644)
+	recordSums(repoURL, "75ccf94d605a05fe24817fc2f166f6f2959d5cea", []fileSum{{Path: "lib.h", Mode: "-", Hash: "abc"}})
+	recordSums("github.com/user/other", "75ccf94d605a05fe24817fc2f166f6f2959d5cea", []fileSum{{Path: "a.h", Mode: "-", Hash: "def"}})
+
+	lockFile := &LockFile{Dependencies: map[string]Dependency{
+		repoURL:                 {Ref: "main", SHA: "75ccf94d605a05fe24817fc2f166f6f2959d5cea"},
+		"github.com/user/other": {Ref: "main", SHA: "75ccf94d605a05fe24817fc2f166f6f2959d5cea"},
+	}}
+	if err := removeDependency(lockFile, repoURL); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, exists := lockFile.Dependencies[repoURL]; exists {
+		t.Error("lock entry not removed")
+	}
+	if _, err := os.Stat(depPath); !os.IsNotExist(err) {
+		t.Errorf("%s not removed", depPath)
+	}
+	sums, err := loadSums()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := sums[repoURL]; exists || len(sums) != 1 {
+		t.Errorf("sums = %+v", sums)
+	}
+
+	if err := removeDependency(lockFile, repoURL); err == nil {
+		t.Error("expected an error removing it twice")
+	}
+}
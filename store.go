@@ -0,0 +1,375 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// With the store setting, a dependency's files live in a content-addressed
+// store in the user's cache directory and its directory under depsDir is a
+// symlink to them. Every file is kept once, as an object named by the SHA-256
+// of its content and its permission bits, and each installed tree is a
+// directory of hardlinks to objects, described by a manifest, named by its
+// tree hash. Installing a tree that is already in the store only makes the
+// link, and trees of different refs share every file they have in common.
+
+// contentStore is the store setting, read by configureStore
+var contentStore bool
+
+// configureStore reads the store setting (or DEPS_STORE)
+func configureStore() {
+	contentStore = configBool("store")
+}
+
+// storeFile is one entry of a stored tree's manifest
+type storeFile struct {
+	Path string      `json:"path"`           // slash-separated, relative to the tree
+	Hash string      `json:"hash"`           // as in .deps.sums
+	Mode fs.FileMode `json:"mode,omitempty"` // permission bits of a file
+	Link string      `json:"link,omitempty"` // target of a symlink
+}
+
+// storeManifest describes a tree in the store, in the manifest.json beside
+// its files
+type storeManifest struct {
+	Repo     string      `json:"repo"`
+	SHA      string      `json:"sha"`
+	TreeHash string      `json:"tree_hash"`
+	Files    []storeFile `json:"files"`
+}
+
+// sums returns the checksums of the manifest's files, as hashTreeFiles would
+// compute them from the installed tree
+func (m storeManifest) sums() []fileSum {
+	sums := make([]fileSum, 0, len(m.Files))
+	for _, file := range m.Files {
+		mode := "-"
+		if file.Link != "" {
+			mode = "l"
+		}
+		sums = append(sums, fileSum{Path: file.Path, Mode: mode, Hash: file.Hash})
+	}
+	sort.Slice(sums, func(i, j int) bool { return sums[i].Path < sums[j].Path })
+	return sums
+}
+
+// storeDir returns the root of the store
+func storeDir() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "store"), nil
+}
+
+// storeTreeDir returns where the tree with treeHash is kept
+func storeTreeDir(treeHash string) (string, error) {
+	root, err := storeDir()
+	if err != nil {
+		return "", err
+	}
+	if len(treeHash) < 2 {
+		return "", fmt.Errorf("invalid tree hash %q", treeHash)
+	}
+	return filepath.Join(root, "trees", treeHash[:2], treeHash), nil
+}
+
+// storeObjectPath returns where a file with hash and mode is kept
+func storeObjectPath(root, hash string, mode fs.FileMode) string {
+	return filepath.Join(root, "objects", hash[:2], fmt.Sprintf("%s-%o", hash, mode.Perm()))
+}
+
+// useStore reports whether dep is installed through the store. A hook could
+// rewrite shared files in place, and objects have one modification time for
+// every tree using them, so dependencies with hooks, and every dependency
+// with preserve-mtime, are installed as plain directories. So is everything
+// in vendored mode, as a link out of the project can't be committed.
+func useStore(dep Dependency) bool {
+	return contentStore && dep.PostInstall == "" && !preserveMtime && projectMode() != modeVendored
+}
+
+// resolveInstallDir returns the directory an installed dependency's files
+// are in: what depPath links to, for one installed from the store, or
+// depPath itself
+func resolveInstallDir(depPath string) string {
+	if info, err := os.Lstat(depPath); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		if resolved, err := filepath.EvalSymlinks(depPath); err == nil {
+			return resolved
+		}
+	}
+	return depPath
+}
+
+// readStoreManifest reads the manifest of the stored tree at dir
+func readStoreManifest(dir string) (storeManifest, error) {
+	var manifest storeManifest
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("reading %s: %v", filepath.Join(dir, "manifest.json"), err)
+	}
+	return manifest, nil
+}
+
+// installFromStore links dep's directory to its tree in the store, when the
+// store has the tree hash dep is locked to, and returns the checksums of its
+// files
+func installFromStore(repoURL string, dep Dependency) ([]fileSum, bool) {
+	if !useStore(dep) || dep.TreeHash == "" {
+		return nil, false
+	}
+	dir, err := storeTreeDir(dep.TreeHash)
+	if err != nil {
+		return nil, false
+	}
+	manifest, err := readStoreManifest(dir)
+	if err != nil || manifest.TreeHash != dep.TreeHash {
+		return nil, false
+	}
+	depPath := getDepPath(repoURL)
+	if err := linkToStore(filepath.Join(dir, "files"), depPath); err != nil {
+		debugf("Couldn't install from the store: %v\n", err)
+		return nil, false
+	}
+	// The modification time of manifest.json is when the tree was last used
+	now := time.Now()
+	os.Chtimes(filepath.Join(dir, "manifest.json"), now, now)
+	infof("Linked %s from the store\n", depPath)
+	return manifest.sums(), true
+}
+
+// addToStore moves the files installed for dep into the store, as the tree
+// with treeHash whose files sums lists, and replaces its directory with a
+// link to them. The tree is built in a temporary directory first, so an
+// interrupted store leaves no partial tree behind.
+func addToStore(repoURL string, dep Dependency, treeHash string, sums []fileSum) error {
+	root, err := storeDir()
+	if err != nil {
+		return err
+	}
+	dir, err := storeTreeDir(treeHash)
+	if err != nil {
+		return err
+	}
+	depPath := getDepPath(repoURL)
+	if _, err := readStoreManifest(dir); err != nil {
+		if err := buildStoreTree(root, dir, depPath, storeManifest{Repo: repoURL, SHA: dep.SHA, TreeHash: treeHash}, sums); err != nil {
+			return err
+		}
+	}
+	return linkToStore(filepath.Join(dir, "files"), depPath)
+}
+
+// buildStoreTree makes the tree at dir from the files at src, adding the
+// objects the store doesn't have yet
+func buildStoreTree(root, dir, src string, manifest storeManifest, sums []fileSum) error {
+	hashes := make(map[string]string, len(sums))
+	for _, sum := range sums {
+		hashes[sum.Path] = sum.Hash
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+	tmp, err := mkdirTemp(filepath.Dir(dir), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer removeTemp(tmp)
+
+	files := filepath.Join(tmp, "files")
+	var dirs []extractedDir
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		target := filepath.Join(files, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			if d.Name() == ".git" && path != src {
+				return fmt.Errorf("%s is a git checkout", src)
+			}
+			dirs = append(dirs, extractedDir{Path: target, Mode: info.Mode().Perm()})
+			return os.MkdirAll(target, 0700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			manifest.Files = append(manifest.Files, storeFile{Path: name, Hash: hashes[name], Link: filepath.ToSlash(link)})
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			hash, ok := hashes[name]
+			if !ok {
+				return fmt.Errorf("%s has no checksum", name)
+			}
+			object := storeObjectPath(root, hash, info.Mode())
+			if err := addStoreObject(path, object, info.Mode().Perm()); err != nil {
+				return err
+			}
+			manifest.Files = append(manifest.Files, storeFile{Path: name, Hash: hash, Mode: info.Mode().Perm()})
+			return os.Link(object, target)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := finishDirs(dirs); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "manifest.json"), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	if err := renameIntoPlace(tmp, dir); err != nil {
+		// Another install may have stored the same tree meanwhile
+		if _, readErr := readStoreManifest(dir); readErr == nil {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// storeTemps numbers the temporary names of objects being added, which
+// parallel installs may add at once
+var storeTemps atomic.Int64
+
+// addStoreObject puts the file at src into the store as object, unless it is
+// there already. It is linked where src and the store share a filesystem,
+// and copied elsewhere.
+func addStoreObject(src, object string, mode fs.FileMode) error {
+	if _, err := os.Lstat(object); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(object), 0755); err != nil {
+		return err
+	}
+	tmp := fmt.Sprintf("%s.tmp-%d-%d", object, os.Getpid(), storeTemps.Add(1))
+	os.Remove(tmp)
+	trackTemp(tmp)
+	if err := os.Link(src, tmp); err != nil {
+		if err := copyFile(src, tmp, mode); err != nil {
+			removeTemp(tmp)
+			return err
+		}
+	}
+	if err := renameIntoPlace(tmp, object); err != nil {
+		removeTemp(tmp)
+		return err
+	}
+	// Linked, the object has the installed file's time, which may be old;
+	// cache gc goes by it to leave objects of trees being built alone
+	now := time.Now()
+	return os.Chtimes(object, now, now)
+}
+
+// linkToStore replaces depPath with a symlink to the stored files at target
+func linkToStore(target, depPath string) error {
+	tmp, err := makeExtractDir(depPath)
+	if err != nil {
+		return err
+	}
+	defer removeTemp(tmp)
+	link := filepath.Join(tmp, "link")
+	if err := os.Symlink(target, link); err != nil {
+		return err
+	}
+	return replaceDir(link, depPath)
+}
+
+// storedTree is one tree in the store
+type storedTree struct {
+	Path     string
+	Manifest storeManifest
+	LastUsed time.Time
+}
+
+// listStoreTrees returns the store's trees, least recently used first, and
+// directories of interrupted stores that are over an hour old
+func listStoreTrees() (trees []storedTree, stray []string, err error) {
+	root, err := storeDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	dirs, err := filepath.Glob(filepath.Join(root, "trees", "*", "*"))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, dir := range dirs {
+		manifest, err := readStoreManifest(dir)
+		var info fs.FileInfo
+		if err == nil {
+			info, err = os.Stat(filepath.Join(dir, "manifest.json"))
+		}
+		if err != nil {
+			if dirInfo, statErr := os.Stat(dir); statErr == nil && time.Since(dirInfo.ModTime()) > time.Hour {
+				stray = append(stray, dir)
+			}
+			continue
+		}
+		trees = append(trees, storedTree{Path: dir, Manifest: manifest, LastUsed: info.ModTime()})
+	}
+	sort.Slice(trees, func(i, j int) bool { return trees[i].LastUsed.Before(trees[j].LastUsed) })
+	return trees, stray, nil
+}
+
+// storeObject is one file in the store
+type storeObject struct {
+	Path string
+	Size int64
+}
+
+// listStoreObjects returns the store's objects, and whether each is used by
+// one of trees. Objects added in the last hour count as used, as the tree
+// being built with them may not have its manifest yet.
+func listStoreObjects(trees []storedTree) (objects []storeObject, used map[string]bool, err error) {
+	root, err := storeDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	used = make(map[string]bool)
+	for _, tree := range trees {
+		for _, file := range tree.Manifest.Files {
+			if file.Link == "" && len(file.Hash) >= 2 {
+				used[storeObjectPath(root, file.Hash, file.Mode)] = true
+			}
+		}
+	}
+	paths, err := filepath.Glob(filepath.Join(root, "objects", "*", "*"))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) < time.Hour {
+			used[path] = true
+		}
+		objects = append(objects, storeObject{Path: path, Size: info.Size()})
+	}
+	return objects, used, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// withStore turns the store on in a temporary cache directory, with the
+// download cache off so installs only come from the store
+func withStore(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() { contentStore = false })
+	t.Setenv("DEPS_CACHE_DIR", t.TempDir())
+	t.Setenv("DEPS_STORE", "1")
+	configureStore()
+}
+
+func TestStore(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	withStore(t)
+
+	sha := "abc123def456abc123def456abc123def456abc1"
+	downloads, restore := cachedTarballServer(t, sha)
+	defer restore()
+
+	repoURL := "github.com/testowner/repo"
+	dep, err := installDependency(repoURL, Dependency{Ref: "main", SHA: sha})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	depPath := getDepPath(repoURL)
+	if info, err := os.Lstat(depPath); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("%s = %v, %v, want a link into the store", depPath, info, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(depPath, "src", "a.c")); string(data) != "int a;" {
+		t.Errorf("src/a.c = %q", data)
+	}
+	if treeHash, err := hashTree(depPath); err != nil || treeHash != dep.TreeHash {
+		t.Errorf("tree hash through the link = %s, %v, want %s", treeHash, err, dep.TreeHash)
+	}
+
+	// Another project links the same tree without downloading
+	os.RemoveAll(depsDir)
+	if _, err := installDependency(repoURL, dep); err != nil {
+		t.Fatalf("reinstall error: %v", err)
+	}
+	if *downloads != 1 {
+		t.Errorf("downloads = %d, want 1", *downloads)
+	}
+	sums, err := loadSums()
+	if err != nil || len(sums[repoURL].Files) != 2 {
+		t.Errorf("sums = %+v, %v, want both files recorded", sums[repoURL], err)
+	}
+
+	// A hook could change shared files, so it gets a directory of its own
+	os.RemoveAll(depsDir)
+	hooked := dep
+	hooked.PostInstall = "true"
+	if _, err := installDependency(repoURL, hooked); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(depPath); err != nil || !info.IsDir() {
+		t.Errorf("%s = %v, %v, want a directory", depPath, info, err)
+	}
+}
+
+func TestStore_SharesFiles(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	withStore(t)
+
+	store := func(repoURL string, files map[string]string) string {
+		writeTree(t, getDepPath(repoURL), files)
+		sums, err := hashTreeFiles(getDepPath(repoURL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		treeHash := treeHashOf(sums)
+		if err := addToStore(repoURL, Dependency{SHA: "abc123def456abc123def456abc123def456abc1"}, treeHash, sums); err != nil {
+			t.Fatal(err)
+		}
+		dir, _ := storeTreeDir(treeHash)
+		return dir
+	}
+	v1 := store("github.com/owner/repo#v1", map[string]string{"lib.h": "// lib", "a.c": "int a;"})
+	v2 := store("github.com/owner/repo#v2", map[string]string{"lib.h": "// lib", "a.c": "int a = 2;"})
+
+	trees, _, err := listStoreTrees()
+	if err != nil || len(trees) != 2 {
+		t.Fatalf("trees = %+v, %v, want 2", trees, err)
+	}
+	objects, _, err := listStoreObjects(trees)
+	if err != nil || len(objects) != 3 {
+		t.Fatalf("objects = %+v, %v, want lib.h stored once", objects, err)
+	}
+
+	// Once v1 goes, only the file v2 doesn't share is garbage
+	lastMonth := time.Now().Add(-30 * 24 * time.Hour)
+	for _, object := range objects {
+		os.Chtimes(object.Path, lastMonth, lastMonth)
+	}
+	garbage, kept := selectStoreGarbage(trees, map[string]bool{v2: true}, cacheGCPolicy{}, time.Now())
+	if len(garbage) != 1 || garbage[0].Path != v1 {
+		t.Fatalf("garbage = %+v, want only %s", garbage, v1)
+	}
+	_, used, _ := listStoreObjects(kept)
+	unused := 0
+	for _, object := range objects {
+		if !used[object.Path] {
+			unused++
+		}
+	}
+	if unused != 1 {
+		t.Errorf("%d objects unused once v1 is removed, want 1", unused)
+	}
+	if _, kept := selectStoreGarbage(trees, nil, cacheGCPolicy{MaxSize: 1}, time.Now()); len(kept) != 2 {
+		t.Error("--max-size alone should leave the store's trees alone")
+	}
+}
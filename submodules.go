@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxSubmoduleDepth bounds recursion through nested submodules
+const maxSubmoduleDepth = 10
+
+type submodule struct {
+	Name string
+	Path string
+	URL  string
+}
+
+// GitHubContent is the subset of the contents API response we use. For
+// submodules, SHA is the commit the parent repo pins.
+type GitHubContent struct {
+	Type string `json:"type"`
+	SHA  string `json:"sha"`
+}
+
+// parseGitmodules parses the submodule entries of a .gitmodules file
+func parseGitmodules(data string) []submodule {
+	var submodules []submodule
+	var current *submodule
+
+	sectionRe := regexp.MustCompile(`^\[submodule\s+"(.*)"\]$`)
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			current = nil
+			if matches := sectionRe.FindStringSubmatch(line); matches != nil {
+				submodules = append(submodules, submodule{Name: matches[1]})
+				current = &submodules[len(submodules)-1]
+			}
+			continue
+		}
+
+		if current == nil {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "path":
+			current.Path = strings.TrimSpace(value)
+		case "url":
+			current.URL = strings.TrimSpace(value)
+		}
+	}
+
+	return submodules
+}
+
+// submoduleGitHubRepo returns the GitHub owner and repo a submodule URL points
+// to. Relative URLs are resolved against the parent repo.
+func submoduleGitHubRepo(parentOwner, parentRepo, url string) (owner, repo string, err error) {
+	url = strings.TrimSuffix(strings.TrimSuffix(url, "/"), ".git")
+
+	if strings.HasPrefix(url, "./") || strings.HasPrefix(url, "../") {
+		resolved := path.Join(parentOwner, parentRepo, url)
+		url = "github.com/" + resolved
+	}
+
+	for _, prefix := range []string{"https://", "http://", "ssh://git@", "git://", "git@"} {
+		url = strings.TrimPrefix(url, prefix)
+	}
+	url = strings.Replace(url, "github.com:", "github.com/", 1)
+
+	owner, repo, err = parseGitHubURL(url)
+	if err != nil {
+		return "", "", fmt.Errorf("unsupported submodule URL %q", url)
+	}
+	return owner, repo, nil
+}
+
+// getSubmoduleSHA returns the commit a repo pins the submodule at path to
+func getSubmoduleSHA(owner, repo, ref, subPath string) (string, error) {
+	contentsURL := fmt.Sprintf("%s/repos/%s/%s/contents/%s?ref=%s", githubAPIBaseURL, owner, repo, subPath, ref)
+	resp, err := httpClient.Get(contentsURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", githubAPIError(resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var content GitHubContent
+	err = json.Unmarshal(body, &content)
+	if err != nil {
+		return "", err
+	}
+
+	if content.Type != "submodule" {
+		return "", fmt.Errorf("%s is not a submodule", subPath)
+	}
+
+	return content.SHA, nil
+}
+
+// getFileContents fetches the raw contents of a file at ref
+func getFileContents(owner, repo, ref, filePath string) ([]byte, error) {
+	contentsURL := fmt.Sprintf("%s/repos/%s/%s/contents/%s?ref=%s", githubAPIBaseURL, owner, repo, filePath, ref)
+	req, err := http.NewRequest("GET", contentsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.raw")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return nil, os.ErrNotExist
+	}
+	if resp.StatusCode != 200 {
+		return nil, githubAPIError(resp)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// expandSubmodules downloads the submodules of an installed dependency into
+// the empty directories GitHub tarballs leave for them
+func expandSubmodules(owner, repo, sha, repoURL string) error {
+	_, subdir := splitSubdir(repoURL)
+	return expandSubmodulesAt(owner, repo, sha, getDepPath(repoURL), subdir, 0)
+}
+
+func expandSubmodulesAt(owner, repo, sha, destPath, subdir string, depth int) error {
+	if depth >= maxSubmoduleDepth {
+		return fmt.Errorf("submodules nested more than %d levels deep", maxSubmoduleDepth)
+	}
+
+	// Subdirectory installs don't include the root .gitmodules
+	var data []byte
+	var err error
+	if subdir == "" {
+		data, err = os.ReadFile(filepath.Join(destPath, ".gitmodules"))
+	} else {
+		data, err = getFileContents(owner, repo, sha, ".gitmodules")
+	}
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range parseGitmodules(string(data)) {
+		if sub.Path == "" || sub.URL == "" {
+			continue
+		}
+		if err := validateSubdir(sub.Path); err != nil {
+			return fmt.Errorf("submodule %s: %w", sub.Name, err)
+		}
+
+		relPath := sub.Path
+		if subdir != "" {
+			if !strings.HasPrefix(sub.Path, subdir+"/") {
+				continue
+			}
+			relPath = strings.TrimPrefix(sub.Path, subdir+"/")
+		}
+
+		subOwner, subRepo, err := submoduleGitHubRepo(owner, repo, sub.URL)
+		if err != nil {
+			warnf("%s Skipping submodule %s: %v\n", colorize(colorYellow, "!"), sub.Path, err)
+			continue
+		}
+
+		subSHA, err := getSubmoduleSHA(owner, repo, sha, sub.Path)
+		if err != nil {
+			return fmt.Errorf("submodule %s: %w", sub.Path, err)
+		}
+
+		pinned := ""
+		if planned, ok := submodulePlan["github.com/"+subOwner+"/"+subRepo]; ok && planned != subSHA {
+			pinned, subSHA = subSHA, planned
+		}
+
+		subDest := filepath.Join(destPath, relPath)
+		_, err = downloadTarball(subOwner, subRepo, subSHA, subDest, "")
+		if err != nil {
+			return fmt.Errorf("submodule %s: %w", sub.Path, err)
+		}
+
+		if pinned != "" {
+			infof("  Submodule %s -> github.com/%s/%s (%s, resolved from %s)\n", sub.Path, subOwner, subRepo, subSHA[:8], pinned[:8])
+		} else {
+			infof("  Submodule %s -> github.com/%s/%s (%s)\n", sub.Path, subOwner, subRepo, subSHA[:8])
+		}
+
+		err = expandSubmodulesAt(subOwner, subRepo, subSHA, subDest, "", depth+1)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
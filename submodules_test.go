@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// --- parseGitmodules tests ---
+
+func TestParseGitmodules(t *testing.T) {
+	data := `[submodule "vendor/lib"]
+	path = vendor/lib
+	url = https://github.com/other/lib.git
+; a comment
+[core]
+	path = ignored
+[submodule "tools"]
+	path = tools
+	url = ../tools.git
+`
+	got := parseGitmodules(data)
+	want := []submodule{
+		{Name: "vendor/lib", Path: "vendor/lib", URL: "https://github.com/other/lib.git"},
+		{Name: "tools", Path: "tools", URL: "../tools.git"},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d submodules, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("submodule %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// --- submoduleGitHubRepo tests ---
+
+func TestSubmoduleGitHubRepo(t *testing.T) {
+	tests := []struct {
+		url       string
+		wantOwner string
+		wantRepo  string
+	}{
+		{"https://github.com/other/lib.git", "other", "lib"},
+		{"https://github.com/other/lib", "other", "lib"},
+		{"git@github.com:other/lib.git", "other", "lib"},
+		{"ssh://git@github.com/other/lib.git", "other", "lib"},
+		{"../tools.git", "parent", "tools"},
+		{"../../elsewhere/tools", "elsewhere", "tools"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			owner, repo, err := submoduleGitHubRepo("parent", "repo", tt.url)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if owner != tt.wantOwner || repo != tt.wantRepo {
+				t.Errorf("got %s/%s, want %s/%s", owner, repo, tt.wantOwner, tt.wantRepo)
+			}
+		})
+	}
+}
+
+func TestSubmoduleGitHubRepo_Unsupported(t *testing.T) {
+	_, _, err := submoduleGitHubRepo("parent", "repo", "https://gitlab.com/other/lib.git")
+	if err == nil {
+		t.Error("expected error for non-GitHub submodule, got nil")
+	}
+}
+
+// --- expandSubmodules tests ---
+
+func TestFetchDependency_ExpandsSubmodules(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	parentSHA := "abc123def456abc123def456abc123def456abc1"
+	subSHA := "deadbeef12345678deadbeef12345678deadbeef"
+
+	parentTarball := makeTarGz(t, "repo-abc123d/", map[string]string{
+		".gitmodules": "[submodule \"vendor/lib\"]\n\tpath = vendor/lib\n\turl = https://github.com/other/lib.git\n",
+		"main.c":      "int main() {}",
+	}).Bytes()
+	subTarball := makeTarGz(t, "lib-deadbee/", map[string]string{
+		"lib.h": "#pragma once",
+	}).Bytes()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/repo/tarball/"+parentSHA, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(parentTarball)
+	})
+	mux.HandleFunc("/repos/testowner/repo/contents/vendor/lib", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ref") != parentSHA {
+			w.WriteHeader(404)
+			return
+		}
+		fmt.Fprintf(w, `{"type":"submodule","sha":"%s"}`, subSHA)
+	})
+	mux.HandleFunc("/repos/other/lib/tarball/"+subSHA, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(subTarball)
+	})
+
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	repoURL := "github.com/testowner/repo"
+	_, err := fetchDependency(repoURL, Dependency{Ref: "main", SHA: parentSHA, Submodules: true})
+	if err != nil {
+		t.Fatalf("fetchDependency error: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(getDepPath(repoURL), "vendor", "lib", "lib.h"))
+	if err != nil {
+		t.Fatalf("submodule file not found: %v", err)
+	}
+	if string(data) != "#pragma once" {
+		t.Errorf("content = %q, want %q", string(data), "#pragma once")
+	}
+}
+
+func TestFetchDependency_SubmodulesDisabled(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	sha := "abc123def456abc123def456abc123def456abc1"
+	tarball := makeTarGz(t, "repo-abc123d/", map[string]string{
+		".gitmodules": "[submodule \"vendor/lib\"]\n\tpath = vendor/lib\n\turl = https://github.com/other/lib.git\n",
+	}).Bytes()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/testowner/repo/tarball/"+sha, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tarball)
+	})
+
+	restore := testGitHubServer(t, mux)
+	defer restore()
+
+	repoURL := "github.com/testowner/repo"
+	_, err := fetchDependency(repoURL, Dependency{Ref: "main", SHA: sha})
+	if err != nil {
+		t.Fatalf("fetchDependency error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(getDepPath(repoURL), "vendor", "lib")); !os.IsNotExist(err) {
+		t.Error("submodule should not have been downloaded")
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// A subdirectory dependency of a large repository would download the whole
+// tarball to keep a small part of it. When the subdirectory is small enough,
+// its files are fetched through the git trees and blobs API instead: one
+// request per directory on the way to list it, and one per file. Whatever
+// the API can't reproduce exactly as the tarball has it falls back to the
+// tarball, so the files, and their tree hash, are the same either way.
+
+// maxSubtreeFiles is the most files a subdirectory may have to be fetched
+// file by file; more would spend more requests than the tarball saves
+const maxSubtreeFiles = 100
+
+// errSubtreeUnavailable is a subdirectory that has to come from the tarball
+var errSubtreeUnavailable = errors.New("the subdirectory can't be fetched by itself")
+
+// gitTree is the subset of the git trees API response we use
+type gitTree struct {
+	Tree      []gitTreeEntry `json:"tree"`
+	Truncated bool           `json:"truncated"`
+}
+
+// gitTreeEntry is one entry of a git tree. Type is "blob", "tree" or
+// "commit", a submodule, and Mode the git mode, like "100755".
+type gitTreeEntry struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+	Type string `json:"type"`
+	SHA  string `json:"sha"`
+}
+
+// fetchesSubtree reports whether dep, a dependency on part of a repository,
+// is worth trying to fetch by itself. Blobs have no modification times, and
+// a lock entry with a tarball hash but no tree hash can only be checked
+// against the tarball.
+func fetchesSubtree(repoURL string, dep Dependency) bool {
+	_, subdir := splitSubdir(repoURL)
+	return subdir != "" && dep.Transport != transportSSH && !preserveMtime && (dep.Hash == "" || dep.TreeHash != "")
+}
+
+// downloadRepoSubtree installs the subdirectory of owner/repo at sha that
+// repoURL names directly from its files, reporting whether it did. When it
+// didn't, nothing was installed and the tarball should be downloaded instead.
+func downloadRepoSubtree(owner, repo, sha, repoURL string) bool {
+	_, subdir := splitSubdir(repoURL)
+	depPath := getDepPath(repoURL)
+	if err := downloadSubtree(owner, repo, sha, subdir, depPath); err != nil {
+		debugf("Downloading the tarball of %s/%s, as %s couldn't be fetched by itself: %v\n", owner, repo, subdir, err)
+		return false
+	}
+	infof("Downloaded to %s\n", depPath)
+	return true
+}
+
+// downloadSubtree fetches the files under subdir of owner/repo at sha into
+// destPath, failing with errSubtreeUnavailable when the tarball is needed.
+// A .gitattributes file on the way or inside that excludes or rewrites
+// files in the tarball, with export-ignore or export-subst, also needs the
+// tarball.
+func downloadSubtree(owner, repo, sha, subdir, destPath string) error {
+	treeSHA := sha
+	for _, part := range strings.Split(subdir, "/") {
+		tree, err := getGitTree(owner, repo, treeSHA, false)
+		if err != nil {
+			return err
+		}
+		next := ""
+		for _, entry := range tree.Tree {
+			if entry.Path == ".gitattributes" {
+				if err := checkExportAttributes(owner, repo, entry.SHA); err != nil {
+					return err
+				}
+			}
+			if entry.Path == part && entry.Type == "tree" {
+				next = entry.SHA
+			}
+		}
+		if next == "" {
+			return fmt.Errorf("subdirectory %s not found", subdir)
+		}
+		treeSHA = next
+	}
+
+	tree, err := getGitTree(owner, repo, treeSHA, true)
+	if err != nil {
+		return err
+	}
+	files := 0
+	for _, entry := range tree.Tree {
+		if entry.Type == "blob" {
+			files++
+		}
+		if path.Base(entry.Path) == ".gitattributes" {
+			if err := checkExportAttributes(owner, repo, entry.SHA); err != nil {
+				return err
+			}
+		}
+	}
+	if tree.Truncated || files > maxSubtreeFiles {
+		return errSubtreeUnavailable
+	}
+
+	// As with archives, destPath is only replaced once everything is written
+	tmp, err := makeExtractDir(destPath)
+	if err != nil {
+		return err
+	}
+	defer removeTemp(tmp)
+
+	var links []archiveLink
+	var skipped []string
+	var dirs []extractedDir
+	var size int64
+	for _, entry := range tree.Tree {
+		if err := runContext.Err(); err != nil {
+			return err
+		}
+		target, err := archiveEntryPath(tmp, entry.Path)
+		if err != nil {
+			return err
+		}
+		if runtime.GOOS == "windows" && !windowsSafeName(entry.Path) {
+			skipped = append(skipped, fmt.Sprintf("%s (not a valid file name on Windows)", entry.Path))
+			continue
+		}
+
+		switch {
+		case entry.Type == "tree":
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			dirs = append(dirs, extractedDir{Path: target, Mode: 0755})
+		case entry.Type == "commit":
+			// The tarball has an empty directory for a submodule
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case entry.Type == "blob" && entry.Mode == "120000":
+			var linkTarget strings.Builder
+			if _, err := downloadBlob(owner, repo, entry.SHA, &linkTarget); err != nil {
+				return fmt.Errorf("%s: %w", entry.Path, err)
+			}
+			links = append(links, archiveLink{Name: path.Clean(entry.Path), Target: linkTarget.String()})
+		case entry.Type == "blob":
+			n, err := downloadBlobFile(owner, repo, entry, target)
+			if err != nil {
+				return fmt.Errorf("%s: %w", entry.Path, err)
+			}
+			size += n
+			debugf("  fetched %s (%s)\n", entry.Path, formatSize(n))
+		}
+	}
+
+	if err := createArchiveLinks(tmp, destPath, links); err != nil {
+		return err
+	}
+	if err := finishDirs(dirs); err != nil {
+		return err
+	}
+	if err := replaceDir(tmp, destPath); err != nil {
+		return err
+	}
+	warnSkippedEntries(destPath, skipped)
+	debugf("Fetched %d files (%s) of %s/%s into %s\n", files, formatSize(size), owner, repo, destPath)
+	return nil
+}
+
+// downloadBlobFile writes the blob of entry to target, with the permissions
+// the tarball would give it, and returns its size
+func downloadBlobFile(owner, repo string, entry gitTreeEntry, target string) (int64, error) {
+	mode := os.FileMode(0644)
+	if entry.Mode == "100755" {
+		mode = 0755
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return 0, err
+	}
+	n, err := downloadBlob(owner, repo, entry.SHA, f)
+	if err == nil {
+		// The mode given to OpenFile is masked by the umask
+		err = f.Chmod(mode)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
+
+// checkExportAttributes fails with errSubtreeUnavailable if the
+// .gitattributes blob blobSHA sets attributes git archive acts on
+func checkExportAttributes(owner, repo, blobSHA string) error {
+	var attributes strings.Builder
+	if _, err := downloadBlob(owner, repo, blobSHA, &attributes); err != nil {
+		return err
+	}
+	if strings.Contains(attributes.String(), "export-ignore") || strings.Contains(attributes.String(), "export-subst") {
+		return errSubtreeUnavailable
+	}
+	return nil
+}
+
+// getGitTree lists the git tree (or commit) treeSHA of owner/repo, with
+// recursive everything under it rather than only its entries
+func getGitTree(owner, repo, treeSHA string, recursive bool) (gitTree, error) {
+	treeURL := fmt.Sprintf("%s/repos/%s/%s/git/trees/%s", githubAPIBaseURL, owner, repo, treeSHA)
+	if recursive {
+		treeURL += "?recursive=1"
+	}
+	resp, err := httpClient.Get(treeURL)
+	if err != nil {
+		return gitTree{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return gitTree{}, githubAPIError(resp)
+	}
+
+	var tree gitTree
+	if err := json.NewDecoder(resp.Body).Decode(&tree); err != nil {
+		return gitTree{}, err
+	}
+	return tree, nil
+}
+
+// downloadBlob copies the content of the blob blobSHA of owner/repo to w
+func downloadBlob(owner, repo, blobSHA string, w io.Writer) (int64, error) {
+	blobURL := fmt.Sprintf("%s/repos/%s/%s/git/blobs/%s", githubAPIBaseURL, owner, repo, blobSHA)
+	req, err := http.NewRequest("GET", blobURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.raw")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return 0, githubAPIError(resp)
+	}
+	return io.Copy(w, resp.Body)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// subtreeServer serves the git trees and blobs of a repository whose
+// packages/foo directory holds files, some blobs of which are listed in
+// blobs by SHA. attributes is the root .gitattributes, if any.
+func subtreeServer(t *testing.T, attributes string, tarballs *int) func() {
+	t.Helper()
+	blobs := map[string]string{
+		"b1": "hello",
+		"b2": "#!/bin/sh\n",
+		"b3": "main.go",
+		"ga": attributes,
+	}
+	root := `{"tree": [{"path": "packages", "mode": "040000", "type": "tree", "sha": "t1"}]}`
+	if attributes != "" {
+		root = `{"tree": [{"path": ".gitattributes", "mode": "100644", "type": "blob", "sha": "ga"}, {"path": "packages", "mode": "040000", "type": "tree", "sha": "t1"}]}`
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/o/r/git/trees/", func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, "/repos/o/r/git/trees/") {
+		case "abc123":
+			fmt.Fprint(w, root)
+		case "t1":
+			fmt.Fprint(w, `{"tree": [{"path": "foo", "mode": "040000", "type": "tree", "sha": "t2"}, {"path": "bar", "mode": "040000", "type": "tree", "sha": "t3"}]}`)
+		case "t2":
+			if r.URL.Query().Get("recursive") != "1" {
+				t.Errorf("%s isn't listed recursively", r.URL)
+			}
+			fmt.Fprint(w, `{"tree": [
+				{"path": "README", "mode": "100644", "type": "blob", "sha": "b1"},
+				{"path": "bin", "mode": "040000", "type": "tree", "sha": "t4"},
+				{"path": "bin/run", "mode": "100755", "type": "blob", "sha": "b2"},
+				{"path": "link", "mode": "120000", "type": "blob", "sha": "b3"},
+				{"path": "vendor", "mode": "160000", "type": "commit", "sha": "c1"}
+			], "truncated": false}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	mux.HandleFunc("/repos/o/r/git/blobs/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/vnd.github.raw" {
+			t.Errorf("Accept = %q", r.Header.Get("Accept"))
+		}
+		blob, ok := blobs[strings.TrimPrefix(r.URL.Path, "/repos/o/r/git/blobs/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, blob)
+	})
+	mux.HandleFunc("/repos/o/r/tarball/abc123", func(w http.ResponseWriter, r *http.Request) {
+		*tarballs++
+		w.Write(makeTarGz(t, "r-abc123/", map[string]string{"packages/foo/README": "hello"}).Bytes())
+	})
+	return testGitHubServer(t, mux)
+}
+
+func TestDownloadSubtree(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	tarballs := 0
+	defer subtreeServer(t, "*.png binary\n", &tarballs)()
+
+	dest := filepath.Join(".deps", "github.com", "o", "r", "packages", "foo")
+	if err := downloadSubtree("o", "r", "abc123", "packages/foo", dest); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"README": "hello", "bin/run": "#!/bin/sh\n"} {
+		data, err := os.ReadFile(filepath.Join(dest, name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", name, data, err, want)
+		}
+	}
+	if runtime.GOOS != "windows" {
+		if info, err := os.Stat(filepath.Join(dest, "bin", "run")); err != nil || info.Mode().Perm() != 0755 {
+			t.Errorf("bin/run mode = %v, %v; want 0755", info.Mode(), err)
+		}
+		if target, err := os.Readlink(filepath.Join(dest, "link")); err != nil || target != "main.go" {
+			t.Errorf("link -> %q, %v", target, err)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dest, "vendor")); err != nil || !info.IsDir() {
+		t.Errorf("the submodule should leave an empty directory: %v", err)
+	}
+	if tarballs != 0 {
+		t.Errorf("the tarball was downloaded %d times", tarballs)
+	}
+}
+
+func TestDownloadSubtree_NeedsTarball(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+	tarballs := 0
+	defer subtreeServer(t, "docs export-ignore\n", &tarballs)()
+
+	dest := filepath.Join(".deps", "github.com", "o", "r", "packages", "foo")
+	if err := downloadSubtree("o", "r", "abc123", "packages/foo", dest); !errors.Is(err, errSubtreeUnavailable) {
+		t.Fatalf("err = %v, want errSubtreeUnavailable", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("nothing should be installed: %v", err)
+	}
+
+	// Installing falls back to the tarball
+	repoURL := "github.com/o/r//packages/foo"
+	hash, err := fetchDependencyFiles(repoURL, Dependency{Ref: "main", SHA: "abc123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == "" || tarballs != 1 {
+		t.Errorf("hash = %q after %d tarball downloads, want the tarball's", hash, tarballs)
+	}
+}
+
+func TestFetchesSubtree(t *testing.T) {
+	tests := []struct {
+		repoURL string
+		dep     Dependency
+		want    bool
+	}{
+		{"github.com/o/r//packages/foo", Dependency{}, true},
+		{"github.com/o/r//packages/foo", Dependency{Hash: "h", TreeHash: "t"}, true},
+		{"github.com/o/r", Dependency{}, false},
+		{"github.com/o/r//packages/foo", Dependency{Transport: transportSSH}, false},
+		{"github.com/o/r//packages/foo", Dependency{Hash: "h"}, false},
+	}
+	for _, tt := range tests {
+		if got := fetchesSubtree(tt.repoURL, tt.dep); got != tt.want {
+			t.Errorf("fetchesSubtree(%q, %+v) = %v, want %v", tt.repoURL, tt.dep, got, tt.want)
+		}
+	}
+}
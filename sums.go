@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// errNotInstalled is returned for a dependency that isn't in .deps
+var errNotInstalled = errors.New("not installed - run 'deps install'")
+
+// sumsFilePath returns the per-file checksum database for the lock file in
+// use, kept next to it: .deps.sums for .deps.lock, tools.sums for tools.lock
+func sumsFilePath() string {
+	lockPath := lockFilePath()
+	return strings.TrimSuffix(lockPath, filepath.Ext(lockPath)) + ".sums"
+}
+
+// depSums are the checksums of every file of one installed dependency
+type depSums struct {
+	SHA   string
+	Files []fileSum
+}
+
+// loadSums reads .deps.sums, keyed by repository URL. A missing file is an
+// empty database. Each line is "<repo>@<sha> <hash> <mode> <path>".
+func loadSums() (map[string]depSums, error) {
+	sums := make(map[string]depSums)
+	sumsFile := sumsFilePath()
+	f, err := os.Open(sumsFile)
+	if os.IsNotExist(err) {
+		return sums, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text == "" {
+			continue
+		}
+		// The path is last so it may contain spaces
+		fields := strings.SplitN(text, " ", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("%s:%d: malformed line", sumsFile, line)
+		}
+		repoURL, sha, ok := strings.Cut(fields[0], "@")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: malformed line", sumsFile, line)
+		}
+
+		entry := sums[repoURL]
+		if entry.SHA != "" && entry.SHA != sha {
+			return nil, fmt.Errorf("%s:%d: %s listed at two commits", sumsFile, line, repoURL)
+		}
+		entry.SHA = sha
+		entry.Files = append(entry.Files, fileSum{Hash: fields[1], Mode: fields[2], Path: fields[3]})
+		sums[repoURL] = entry
+	}
+	return sums, scanner.Err()
+}
+
+// saveSums writes .deps.sums sorted by repository and path, so it diffs as
+// cleanly as the lock file
+func saveSums(sums map[string]depSums) error {
+	repoURLs := make([]string, 0, len(sums))
+	for repoURL := range sums {
+		repoURLs = append(repoURLs, repoURL)
+	}
+	sort.Strings(repoURLs)
+
+	var b strings.Builder
+	for _, repoURL := range repoURLs {
+		entry := sums[repoURL]
+		files := append([]fileSum(nil), entry.Files...)
+		sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+		for _, file := range files {
+			fmt.Fprintf(&b, "%s@%s %s\n", repoURL, entry.SHA, file)
+		}
+	}
+	return os.WriteFile(sumsFilePath(), []byte(b.String()), 0644)
+}
+
+// sumsMu serializes parallel installs reading and updating .deps.sums
+var sumsMu sync.Mutex
+
+// recordSums replaces the checksums of repoURL in .deps.sums with files.
+// Entries of other URLs installed in the same directory, like the fork a
+// profile replaced it with, no longer describe it and are dropped.
+func recordSums(repoURL, sha string, files []fileSum) error {
+	sumsMu.Lock()
+	defer sumsMu.Unlock()
+	sums, err := loadSums()
+	if err != nil {
+		return err
+	}
+	for other := range sums {
+		if other != repoURL && getDepPath(other) == getDepPath(repoURL) {
+			delete(sums, other)
+		}
+	}
+	sums[repoURL] = depSums{SHA: sha, Files: files}
+	return saveSums(sums)
+}
+
+// verifyResult lists the files of an installed dependency that differ from
+// its recorded checksums
+type verifyResult struct {
+	Checked  int
+	Modified []string
+	Missing  []string
+	Extra    []string
+}
+
+// ok reports whether the installed files match their checksums exactly
+func (r verifyResult) ok() bool {
+	return len(r.Modified) == 0 && len(r.Missing) == 0 && len(r.Extra) == 0
+}
+
+// compareSums compares recorded checksums with those of the installed files
+func compareSums(recorded, actual []fileSum) verifyResult {
+	installed := make(map[string]fileSum, len(actual))
+	for _, file := range actual {
+		installed[file.Path] = file
+	}
+
+	var result verifyResult
+	for _, want := range recorded {
+		got, exists := installed[want.Path]
+		delete(installed, want.Path)
+		switch {
+		case !exists:
+			result.Missing = append(result.Missing, want.Path)
+		case got.Hash != want.Hash || got.Mode != want.Mode:
+			result.Modified = append(result.Modified, want.Path)
+		default:
+			result.Checked++
+		}
+	}
+	for path := range installed {
+		result.Extra = append(result.Extra, path)
+	}
+	sort.Strings(result.Extra)
+	return result
+}
+
+// verifyDependency re-hashes the installed files of repoURL and compares them
+// with .deps.sums. Without per-file checksums it falls back to the tree hash
+// in the lock entry, which can only say whether anything changed.
+func verifyDependency(repoURL string, dep Dependency, sums map[string]depSums) (verifyResult, error) {
+	depPath := getDepPath(repoURL)
+	if _, err := os.Stat(depPath); err != nil {
+		return verifyResult{}, errNotInstalled
+	}
+
+	actual, err := hashTreeFiles(depPath)
+	if err != nil {
+		return verifyResult{}, err
+	}
+
+	recorded, exists := sums[repoURL]
+	if !exists {
+		if dep.TreeHash == "" {
+			return verifyResult{}, fmt.Errorf("no checksums recorded - reinstall it to record them")
+		}
+		if got := treeHashOf(actual); got != dep.TreeHash {
+			mismatch := &checksumError{What: "tree hash", Expected: dep.TreeHash, Got: got}
+			return verifyResult{}, fmt.Errorf("%w, and no per-file checksums in %s to say what changed", mismatch, sumsFilePath())
+		}
+		return verifyResult{Checked: len(actual)}, nil
+	}
+	if recorded.SHA != dep.SHA {
+		return verifyResult{}, fmt.Errorf("%s has checksums for %s, not the locked %s - reinstall it", sumsFilePath(), abbreviate(recorded.SHA), abbreviate(dep.SHA))
+	}
+	return compareSums(recorded.Files, actual), nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSaveAndLoadSums_RoundTrip(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	sums := map[string]depSums{
+		"github.com/user/repo": {SHA: "abc123", Files: []fileSum{
+			{Path: "src/main file.c", Mode: "-", Hash: "1111"},
+			{Path: "README.md", Mode: "-", Hash: "2222"},
+			{Path: "link", Mode: "l", Hash: "3333"},
+		}},
+		"github.com/other/lib": {SHA: "def456", Files: []fileSum{{Path: "lib.h", Mode: "-", Hash: "4444"}}},
+	}
+	if err := saveSums(sums); err != nil {
+		t.Fatalf("saveSums error: %v", err)
+	}
+
+	data, _ := os.ReadFile(sumsFilePath())
+	want := "github.com/other/lib@def456 4444 - lib.h\n" +
+		"github.com/user/repo@abc123 2222 - README.md\n" +
+		"github.com/user/repo@abc123 3333 l link\n" +
+		"github.com/user/repo@abc123 1111 - src/main file.c\n"
+	if string(data) != want {
+		t.Errorf("%s =\n%s\nwant\n%s", sumsFilePath(), data, want)
+	}
+
+	loaded, err := loadSums()
+	if err != nil {
+		t.Fatalf("loadSums error: %v", err)
+	}
+	if got := loaded["github.com/user/repo"]; got.SHA != "abc123" || len(got.Files) != 3 || got.Files[2].Path != "src/main file.c" {
+		t.Errorf("loaded = %+v", got)
+	}
+}
+
+func TestLoadSums_Errors(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	sums, err := loadSums()
+	if err != nil || len(sums) != 0 {
+		t.Errorf("missing file should be empty, got %v (%v)", sums, err)
+	}
+
+	for _, content := range []string{
+		"github.com/user/repo@abc 1111\n",
+		"github.com/user/repo 1111 - file\n",
+		"github.com/user/repo@abc 1111 - a\ngithub.com/user/repo@def 2222 - b\n",
+	} {
+		os.WriteFile(sumsFilePath(), []byte(content), 0644)
+		if _, err := loadSums(); err == nil || !strings.HasPrefix(err.Error(), sumsFilePath()+":") {
+			t.Errorf("%q: expected a line error, got %v", content, err)
+		}
+	}
+}
+
+func TestRecordSums_ReplacesEntry(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	recordSums("github.com/user/repo", "old", []fileSum{{Path: "a", Mode: "-", Hash: "1"}, {Path: "b", Mode: "-", Hash: "2"}})
+	recordSums("github.com/user/repo", "new", []fileSum{{Path: "a", Mode: "-", Hash: "3"}})
+
+	sums, err := loadSums()
+	if err != nil {
+		t.Fatalf("loadSums error: %v", err)
+	}
+	want := depSums{SHA: "new", Files: []fileSum{{Path: "a", Mode: "-", Hash: "3"}}}
+	if !reflect.DeepEqual(sums["github.com/user/repo"], want) {
+		t.Errorf("sums = %+v, want %+v", sums["github.com/user/repo"], want)
+	}
+}
+
+func TestCompareSums(t *testing.T) {
+	recorded := []fileSum{
+		{Path: "a.c", Mode: "-", Hash: "1"},
+		{Path: "b.c", Mode: "-", Hash: "2"},
+		{Path: "c.c", Mode: "-", Hash: "3"},
+		{Path: "link", Mode: "l", Hash: "4"},
+	}
+	actual := []fileSum{
+		{Path: "a.c", Mode: "-", Hash: "1"},
+		{Path: "b.c", Mode: "-", Hash: "changed"},
+		{Path: "link", Mode: "-", Hash: "4"},
+		{Path: "z.c", Mode: "-", Hash: "5"},
+		{Path: "new.c", Mode: "-", Hash: "6"},
+	}
+
+	result := compareSums(recorded, actual)
+	if result.ok() {
+		t.Fatal("expected differences")
+	}
+	if result.Checked != 1 {
+		t.Errorf("checked = %d, want 1", result.Checked)
+	}
+	if !reflect.DeepEqual(result.Modified, []string{"b.c", "link"}) {
+		t.Errorf("modified = %v", result.Modified)
+	}
+	if !reflect.DeepEqual(result.Missing, []string{"c.c"}) {
+		t.Errorf("missing = %v", result.Missing)
+	}
+	if !reflect.DeepEqual(result.Extra, []string{"new.c", "z.c"}) {
+		t.Errorf("extra = %v", result.Extra)
+	}
+
+	if !compareSums(recorded, recorded).ok() {
+		t.Error("identical sums should verify")
+	}
+}
+
+func TestVerifyDependency(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	repoURL := "github.com/user/repo"
+	dep := Dependency{Ref: "main", SHA: "abc123def456abc123def456abc123def456abc1"}
+	if _, err := verifyDependency(repoURL, dep, nil); err == nil {
+		t.Error("expected error for a dependency that isn't installed")
+	}
+
+	writeTree(t, getDepPath(repoURL), map[string]string{"lib.h": "// lib", "lib.c": "int x;"})
+	files, err := hashTreeFiles(getDepPath(repoURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := verifyDependency(repoURL, dep, map[string]depSums{}); err == nil {
+		t.Error("expected error without any recorded checksums")
+	}
+
+	// Falls back to the tree hash without per-file checksums
+	dep.TreeHash = treeHashOf(files)
+	if result, err := verifyDependency(repoURL, dep, map[string]depSums{}); err != nil || result.Checked != 2 {
+		t.Errorf("tree hash fallback = %+v (%v), want 2 files checked", result, err)
+	}
+
+	sums := map[string]depSums{repoURL: {SHA: dep.SHA, Files: files}}
+	writeTree(t, getDepPath(repoURL), map[string]string{"lib.c": "int y;"})
+	result, err := verifyDependency(repoURL, dep, sums)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(result.Modified, []string{"lib.c"}) {
+		t.Errorf("modified = %v, want lib.c", result.Modified)
+	}
+
+	sums[repoURL] = depSums{SHA: "0000000000000000000000000000000000000000", Files: files}
+	if _, err := verifyDependency(repoURL, dep, sums); err == nil {
+		t.Error("expected error for checksums of another commit")
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// archiveLink is a symlink entry of an archive. Links are created once every
+// file has been extracted, so none is followed while writing the others.
+type archiveLink struct {
+	Name   string // path in the dependency, with / separators
+	Target string // what the link points to, as the archive has it
+}
+
+// createArchiveLinks recreates links in the dependency extracted at root
+// (destPath names it in messages). A link is only made when its target stays
+// inside the dependency. One that can't be made, because the platform doesn't
+// allow it or a directory on its way is itself a link, is replaced by a copy
+// of its target; one leading out of the dependency is skipped, as copying it
+// would read files from outside the archive. Both get a warning.
+func createArchiveLinks(root, destPath string, links []archiveLink) error {
+	// A link before the links under it, so it isn't made a directory first
+	sort.Slice(links, func(i, j int) bool { return links[i].Name < links[j].Name })
+
+	var copies []archiveLink
+	for _, link := range links {
+		target, ok := linkTargetInside(link)
+		if !ok {
+			warnf("%s Skipped symlink %s -> %s in %s: it points outside the dependency\n", colorize(colorYellow, "!"), link.Name, link.Target, destPath)
+			continue
+		}
+		linkPath := filepath.Join(root, filepath.FromSlash(link.Name))
+		if err := os.MkdirAll(filepath.Dir(linkPath), 0755); err != nil {
+			return err
+		}
+		if !hasLinkedParent(root, link.Name) && os.Symlink(filepath.FromSlash(target), linkPath) == nil {
+			debugf("  linked %s -> %s\n", link.Name, target)
+			continue
+		}
+		copies = append(copies, link)
+	}
+
+	// Copies are made after every link that could be, so they can go through
+	// them to reach their targets
+	for _, link := range copies {
+		target, _ := linkTargetInside(link)
+		resolved := path.Join(path.Dir(link.Name), target)
+		if resolved == "." || strings.HasPrefix(link.Name, resolved+"/") {
+			warnf("%s Skipped symlink %s -> %s in %s: it points to a directory containing it\n", colorize(colorYellow, "!"), link.Name, link.Target, destPath)
+			continue
+		}
+		src, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(resolved)))
+		if err == nil && !pathInside(root, src) {
+			err = fs.ErrNotExist
+		}
+		if err == nil {
+			err = copyLinkTarget(src, filepath.Join(root, filepath.FromSlash(link.Name)))
+		}
+		if err != nil {
+			warnf("%s Skipped symlink %s -> %s in %s: %v\n", colorize(colorYellow, "!"), link.Name, link.Target, destPath, err)
+			continue
+		}
+		warnf("%s Copied %s to %s in %s, as the symlink couldn't be created\n", colorize(colorYellow, "!"), link.Target, link.Name, destPath)
+	}
+	return nil
+}
+
+// linkTargetInside returns link's target cleaned, and whether it stays inside
+// the dependency. The link is made to the cleaned target, which has ".." only
+// at its start: one after another component could climb out of a directory
+// that is itself a link.
+func linkTargetInside(link archiveLink) (string, bool) {
+	if strings.Contains(link.Target, "\\") || path.IsAbs(link.Target) || hasDriveLetter(link.Target) {
+		return "", false
+	}
+	target := path.Clean(link.Target)
+	resolved := path.Join(path.Dir(link.Name), target)
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "", false
+	}
+	return target, true
+}
+
+// hasLinkedParent reports whether a directory on the way to name under root
+// is a symlink, which would put a link somewhere other than where its target
+// was checked from
+func hasLinkedParent(root, name string) bool {
+	dir := root
+	for _, part := range strings.Split(path.Dir(name), "/") {
+		if part == "." {
+			continue
+		}
+		dir = filepath.Join(dir, part)
+		if info, err := os.Lstat(dir); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// pathInside reports whether path is root or inside it
+func pathInside(root, path string) bool {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(realRoot, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// copyLinkTarget copies the file or directory src to dst, in place of a link.
+// Links inside a copied directory are left out: moved to dst, their targets
+// would no longer be where they were checked.
+func copyLinkTarget(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case d.Type().IsRegular():
+			return copyFile(p, target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
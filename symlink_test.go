@@ -0,0 +1,157 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// makeTarGzWithLinks creates a GitHub-style tarball of files and symlinks
+// (name -> target) under the root directory "repo-abc1234/"
+func makeTarGzWithLinks(t *testing.T, files, links map[string]string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	headers := []*tar.Header{{Name: "repo-abc1234/", Typeflag: tar.TypeDir, Mode: 0755}}
+	for name, content := range files {
+		headers = append(headers, &tar.Header{Name: "repo-abc1234/" + name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))})
+	}
+	for name, target := range links {
+		headers = append(headers, &tar.Header{Name: "repo-abc1234/" + name, Typeflag: tar.TypeSymlink, Linkname: target, Mode: 0777})
+	}
+	for _, header := range headers {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			tw.Write([]byte(files[header.Name[len("repo-abc1234/"):]]))
+		}
+	}
+	tw.Close()
+	gw.Close()
+	return &buf
+}
+
+func TestExtractTarball_Symlinks(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	tarball := makeTarGzWithLinks(t,
+		map[string]string{"lib/a.h": "// a", "README.md": "# readme"},
+		map[string]string{
+			"include":      "lib",
+			"lib/readme":   "../README.md",
+			"escape":       "../../../etc/passwd",
+			"absolute":     "/etc/passwd",
+			"lib/untidy":   "./../lib/a.h",
+			"docs/missing": "nowhere.txt",
+		})
+	if err := extractTarball(tarball, "dest"); err != nil {
+		t.Fatalf("extractTarball error: %v", err)
+	}
+
+	for name, want := range map[string]string{"include": "lib", "lib/readme": "../README.md", "lib/untidy": "../lib/a.h", "docs/missing": "nowhere.txt"} {
+		if got, err := os.Readlink(filepath.Join("dest", name)); err != nil || filepath.ToSlash(got) != want {
+			t.Errorf("%s -> %q (%v), want a link to %q", name, got, err, want)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join("dest", "include", "a.h")); err != nil || string(data) != "// a" {
+		t.Errorf("include/a.h = %q, %v", data, err)
+	}
+	for _, name := range []string{"escape", "absolute"} {
+		if _, err := os.Lstat(filepath.Join("dest", name)); !os.IsNotExist(err) {
+			t.Errorf("%s points outside the dependency and should have been skipped", name)
+		}
+	}
+}
+
+func TestExtractTarball_SymlinkThroughLinkIsCopied(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	// Made where it is, via.h would be lib/via.h and no longer point at a.txt
+	tarball := makeTarGzWithLinks(t,
+		map[string]string{"lib/a.h": "// a", "a.txt": "text"},
+		map[string]string{"ln": "lib", "ln/via.h": "../a.txt"})
+	if err := extractTarball(tarball, "dest"); err != nil {
+		t.Fatalf("extractTarball error: %v", err)
+	}
+
+	info, err := os.Lstat(filepath.Join("dest", "lib", "via.h"))
+	if err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("lib/via.h = %v, %v, want a copy of a.txt", info, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join("dest", "lib", "via.h")); string(data) != "text" {
+		t.Errorf("lib/via.h = %q, want a.txt's contents", data)
+	}
+}
+
+func TestExtractTarball_SymlinkOutsideSubdir(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	tarball := makeTarGzWithLinks(t,
+		map[string]string{"pkg/foo/foo.go": "package foo", "shared/x.go": "package shared"},
+		map[string]string{"pkg/foo/shared": "../../shared", "pkg/foo/self": "foo.go"})
+	if err := extractTarballSubdir(tarball, "dest", "pkg/foo"); err != nil {
+		t.Fatalf("extractTarballSubdir error: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join("dest", "shared")); !os.IsNotExist(err) {
+		t.Error("shared leaves the subdirectory and should have been skipped")
+	}
+	if got, _ := os.Readlink(filepath.Join("dest", "self")); got != "foo.go" {
+		t.Errorf("self -> %q, want foo.go", got)
+	}
+}
+
+func TestTransformTree_SymlinkMovedOutside(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	writeTree(t, "dep", map[string]string{"a/b.txt": "b", "c.txt": "c"})
+	os.Symlink("../c.txt", filepath.Join("dep", "a", "c"))
+	os.Symlink("b.txt", filepath.Join("dep", "a", "b"))
+
+	if err := transformTree("dep", 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join("dep", "c")); !os.IsNotExist(err) {
+		t.Error("c would point outside the dependency once stripped, and should have been skipped")
+	}
+	if got, _ := os.Readlink(filepath.Join("dep", "b")); got != "b.txt" {
+		t.Errorf("b -> %q, want b.txt", got)
+	}
+}
+
+func TestExtractZip_Symlinks(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.Create("repo-abc1234/lib/a.h")
+	w.Write([]byte("// a"))
+	for name, target := range map[string]string{"include": "lib", "escape": "../../etc/passwd"} {
+		header := &zip.FileHeader{Name: "repo-abc1234/" + name}
+		header.SetMode(os.ModeSymlink | 0777)
+		w, _ := zw.CreateHeader(header)
+		w.Write([]byte(target))
+	}
+	zw.Close()
+	os.WriteFile("repo.zip", buf.Bytes(), 0644)
+
+	if err := extractZip("repo.zip", "dest", "", true); err != nil {
+		t.Fatalf("extractZip error: %v", err)
+	}
+	if got, err := os.Readlink(filepath.Join("dest", "include")); err != nil || got != "lib" {
+		t.Errorf("include -> %q (%v), want a link to lib", got, err)
+	}
+	if _, err := os.Lstat(filepath.Join("dest", "escape")); !os.IsNotExist(err) {
+		t.Error("escape points outside the dependency and should have been skipped")
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import "fmt"
+
+// syncReason returns why the installed directory of repoURL isn't the locked
+// commit, or "" if it is as far as can be told. .deps.sums records which
+// commit was installed; without it, only a recorded tree hash can tell.
+func syncReason(lockFile *LockFile, repoURL string, dep Dependency, sums map[string]depSums) string {
+	if recorded, exists := sums[repoURL]; exists {
+		if recorded.SHA != dep.SHA {
+			return fmt.Sprintf("%s is installed but %s is locked", abbreviate(recorded.SHA), abbreviate(dep.SHA))
+		}
+		return ""
+	}
+	if installedForOtherProfile(lockFile, repoURL, dep, sums) {
+		return "installed for another profile"
+	}
+	if dep.TreeHash != "" {
+		files, err := hashTreeFiles(getDepPath(repoURL))
+		if err == nil && treeHashOf(files) != dep.TreeHash {
+			return "the installed files don't match tree_hash"
+		}
+	}
+	return ""
+}
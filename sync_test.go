@@ -0,0 +1,41 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSyncReason(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	dir := filepath.Join(".deps", "github.com", "user", "repo")
+	writeTree(t, dir, map[string]string{"a.txt": "installed"})
+	files, err := hashTreeFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockFile := &LockFile{Dependencies: map[string]Dependency{}}
+	sha := "1111111111111111111111111111111111111111"
+	dep := Dependency{Ref: "main", SHA: sha}
+
+	tests := []struct {
+		name string
+		dep  Dependency
+		sums map[string]depSums
+		want string
+	}{
+		{"locked commit", dep, map[string]depSums{"github.com/user/repo": {SHA: sha, Files: files}}, ""},
+		{"other commit", dep, map[string]depSums{"github.com/user/repo": {SHA: "2222222222222222222222222222222222222222", Files: files}}, "222222222222 is installed but 111111111111 is locked"},
+		{"no checksums", dep, nil, ""},
+		{"matching tree hash", Dependency{Ref: "main", SHA: sha, TreeHash: treeHashOf(files)}, nil, ""},
+		{"other tree hash", Dependency{Ref: "main", SHA: sha, TreeHash: strings.Repeat("0", 64)}, nil, "don't match tree_hash"},
+	}
+	for _, tt := range tests {
+		got := syncReason(lockFile, "github.com/user/repo", tt.dep, tt.sums)
+		if (tt.want == "" && got != "") || !strings.Contains(got, tt.want) {
+			t.Errorf("%s: syncReason = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
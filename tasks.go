@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// taskNames returns the names of the tasks of lockFile in order
+func taskNames(lockFile *LockFile) []string {
+	names := make([]string, 0, len(lockFile.Tasks))
+	for name := range lockFile.Tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateTasks checks the names and commands of tasks
+func validateTasks(tasks map[string]string) []string {
+	var problems []string
+	names := make([]string, 0, len(tasks))
+	for name := range tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !aliasPattern.MatchString(name) {
+			problems = append(problems, fmt.Sprintf("%s: invalid task name (use letters, digits, - and _)", name))
+		}
+		if tasks[name] == "" {
+			problems = append(problems, fmt.Sprintf("%s: command is empty", name))
+		}
+	}
+	return problems
+}
+
+// runTask runs the named task of lockFile through the platform's shell,
+// from the current directory, with the environment deps exec gives
+// commands. The error of a task that exits non-zero is an *exec.ExitError.
+func runTask(lockFile *LockFile, name string) error {
+	command, exists := lockFile.Tasks[name]
+	if !exists {
+		return fmt.Errorf("no task %q in %s", name, lockFilePath())
+	}
+	env, err := dependencyEnv(lockFile)
+	if err != nil {
+		return err
+	}
+	dirs, err := dependencyBinDirs(lockFile)
+	if err != nil {
+		return err
+	}
+	if len(dirs) > 0 {
+		env = append(env, "PATH="+prependPath(dirs, os.Getenv("PATH")))
+	}
+
+	cmd := hookCommand(command)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), env...)
+	return cmd.Run()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestValidateTasks(t *testing.T) {
+	if problems := validateTasks(map[string]string{"build": "make", "test-all": "make test"}); len(problems) != 0 {
+		t.Errorf("valid tasks: %v", problems)
+	}
+	problems := validateTasks(map[string]string{"bad name": "make", "empty": ""})
+	if len(problems) != 2 {
+		t.Errorf("validateTasks = %v, want 2 problems", problems)
+	}
+}
+
+func TestRunTask(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("task commands use sh")
+	}
+	cleanup := withTempDir(t)
+	defer cleanup()
+	dir, _ := os.Getwd()
+
+	writeTree(t, ".deps/github.com/user/tool", map[string]string{"bin/greet": "#!/bin/sh\necho hello\n"})
+	os.Chmod(filepath.Join(".deps", "github.com", "user", "tool", "bin", "greet"), 0755)
+	lockFile := &LockFile{
+		Dependencies: map[string]Dependency{"github.com/user/tool": {Ref: "main"}},
+		Tasks: map[string]string{
+			"build": `echo "$DEPS_GITHUB_COM_USER_TOOL" > out.txt && greet >> out.txt`,
+			"fail":  "exit 3",
+		},
+	}
+
+	if err := runTask(lockFile, "build"); err != nil {
+		t.Fatalf("runTask error: %v", err)
+	}
+	data, _ := os.ReadFile("out.txt")
+	want := filepath.Join(dir, ".deps", "github.com", "user", "tool") + "\nhello\n"
+	if string(data) != want {
+		t.Errorf("task output = %q, want %q", data, want)
+	}
+
+	var exitErr *exec.ExitError
+	if err := runTask(lockFile, "fail"); !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("failing task: %v, want exit status 3", err)
+	}
+	if err := runTask(lockFile, "deploy"); err == nil || !strings.Contains(err.Error(), "no task") {
+		t.Errorf("unknown task: %v", err)
+	}
+}
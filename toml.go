@@ -0,0 +1,592 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// tomlComment holds the comments attached to a key or table of a TOML lock
+// file, so they survive deps rewriting it
+type tomlComment struct {
+	Above  []string // whole-line comments before it, including the "#"
+	Inline string   // a trailing comment on the same line
+}
+
+// tomlTrailer is the comments key for comments after the last entry
+const tomlTrailer = ""
+
+// tomlBareKey matches keys that don't need quoting
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tomlKeyPath renders a key path as TOML, e.g. dependencies."github.com/a/b".
+// It is also how comments are keyed.
+func tomlKeyPath(parts []string) string {
+	quoted := make([]string, len(parts))
+	for i, part := range parts {
+		if tomlBareKey.MatchString(part) {
+			quoted[i] = part
+		} else {
+			quoted[i] = tomlString(part)
+		}
+	}
+	return strings.Join(quoted, ".")
+}
+
+// tomlString renders s as a TOML basic string
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// parseTOML parses the subset of TOML a lock file needs: comments, tables,
+// dotted and quoted keys, strings, integers, booleans, arrays, which may span
+// lines, and inline tables. It returns a JSON-compatible tree and the
+// comments keyed by tomlKeyPath. Comments inside an array aren't kept.
+func parseTOML(data []byte) (map[string]interface{}, map[string]tomlComment, error) {
+	root := make(map[string]interface{})
+	comments := make(map[string]tomlComment)
+	defined := make(map[string]bool)
+	table := root
+	var tablePath []string
+	var above []string
+
+	p := &tomlParser{s: strings.ReplaceAll(string(data), "\r\n", "\n")}
+	for {
+		p.space()
+		if p.pos == len(p.s) {
+			break
+		}
+		if p.consume('\n') {
+			continue
+		}
+		if p.peek() == '#' {
+			above = append(above, p.comment())
+			continue
+		}
+
+		line := p.line()
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+		}
+		var path []string
+		if p.peek() == '[' {
+			if strings.HasPrefix(p.s[p.pos:], "[[") {
+				return nil, nil, fail("arrays of tables are not supported")
+			}
+			p.pos++
+			keys, err := p.keys()
+			if err != nil {
+				return nil, nil, fail("%v", err)
+			}
+			if !p.consume(']') {
+				return nil, nil, fail("expected ] after table name")
+			}
+			key := tomlKeyPath(keys)
+			if defined[key] {
+				return nil, nil, fail("table [%s] defined twice", key)
+			}
+			defined[key] = true
+			table, err = tomlTable(root, keys)
+			if err != nil {
+				return nil, nil, fail("%v", err)
+			}
+			tablePath, path = keys, keys
+		} else {
+			keys, err := p.keyValue(table)
+			if err != nil {
+				// The value may have run over several lines
+				line = p.line()
+				return nil, nil, fail("%v", err)
+			}
+			path = append(append([]string(nil), tablePath...), keys...)
+		}
+
+		p.space()
+		comment := tomlComment{Above: above}
+		if p.peek() == '#' {
+			comment.Inline = p.comment()
+		} else if p.pos < len(p.s) && !p.consume('\n') {
+			rest, _, _ := strings.Cut(p.s[p.pos:], "\n")
+			line = p.line()
+			return nil, nil, fail("unexpected %q", rest)
+		}
+		if len(comment.Above) > 0 || comment.Inline != "" {
+			comments[tomlKeyPath(path)] = comment
+		}
+		above = nil
+	}
+	if len(above) > 0 {
+		comments[tomlTrailer] = tomlComment{Above: above}
+	}
+	return root, comments, nil
+}
+
+// tomlTable returns the table at keys under t, creating it if needed
+func tomlTable(t map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for i, key := range keys {
+		switch next := t[key].(type) {
+		case nil:
+			created := make(map[string]interface{})
+			t[key] = created
+			t = created
+		case map[string]interface{}:
+			t = next
+		default:
+			return nil, fmt.Errorf("%s is a value, not a table", tomlKeyPath(keys[:i+1]))
+		}
+	}
+	return t, nil
+}
+
+// tomlParser reads keys and values from a TOML document
+type tomlParser struct {
+	s   string
+	pos int
+}
+
+func (p *tomlParser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *tomlParser) space() {
+	for p.peek() == ' ' || p.peek() == '\t' {
+		p.pos++
+	}
+}
+
+// line is the line number of the current position, from 1
+func (p *tomlParser) line() int {
+	return strings.Count(p.s[:p.pos], "\n") + 1
+}
+
+// comment reads a comment to the end of its line, and the newline
+func (p *tomlParser) comment() string {
+	text, _, _ := strings.Cut(p.s[p.pos:], "\n")
+	p.pos += len(text)
+	p.consume('\n')
+	return strings.TrimRight(text, " \t")
+}
+
+// blank skips whitespace, newlines and comments, as arrays allow between
+// their values
+func (p *tomlParser) blank() {
+	for {
+		p.space()
+		switch p.peek() {
+		case '\n':
+			p.pos++
+		case '#':
+			p.comment()
+		default:
+			return
+		}
+	}
+}
+
+// keyValue reads a key = value pair into t, returning the key
+func (p *tomlParser) keyValue(t map[string]interface{}) ([]string, error) {
+	keys, err := p.keys()
+	if err != nil {
+		return nil, err
+	}
+	if !p.consume('=') {
+		return nil, fmt.Errorf("expected = after key")
+	}
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	parent, err := tomlTable(t, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	if _, exists := parent[last]; exists {
+		return nil, fmt.Errorf("duplicate key %s", tomlKeyPath(keys))
+	}
+	parent[last] = value
+	return keys, nil
+}
+
+// consume skips whitespace and c, reporting whether c was there
+func (p *tomlParser) consume(c byte) bool {
+	p.space()
+	if p.peek() != c {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+// keys reads a dotted key such as a."b.c".d
+func (p *tomlParser) keys() ([]string, error) {
+	var keys []string
+	for {
+		p.space()
+		var key string
+		switch p.peek() {
+		case '"', '\'':
+			s, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		default:
+			start := p.pos
+			for p.pos < len(p.s) && tomlBareKey.MatchString(p.s[p.pos:p.pos+1]) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, fmt.Errorf("expected a key")
+			}
+			key = p.s[start:p.pos]
+		}
+		keys = append(keys, key)
+		if !p.consume('.') {
+			return keys, nil
+		}
+	}
+}
+
+// str reads a basic ("...") or literal ('...') string
+func (p *tomlParser) str() (string, error) {
+	quote := p.peek()
+	if strings.HasPrefix(p.s[p.pos:], strings.Repeat(string(quote), 3)) {
+		return "", fmt.Errorf("multi-line strings are not supported")
+	}
+	p.pos++
+	start := p.pos
+	if quote == '\'' {
+		end := strings.IndexByte(p.s[start:], '\'')
+		if end < 0 || strings.Contains(p.s[start:start+end], "\n") {
+			return "", fmt.Errorf("unterminated string")
+		}
+		p.pos = start + end + 1
+		return p.s[start : start+end], nil
+	}
+
+	var b strings.Builder
+	for p.pos < len(p.s) && p.s[p.pos] != '\n' {
+		c := p.s[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return b.String(), nil
+		case c == '\\' && p.pos+1 < len(p.s):
+			esc := p.s[p.pos+1]
+			p.pos += 2
+			switch esc {
+			case '"', '\\':
+				b.WriteByte(esc)
+			case 'b':
+				b.WriteByte('\b')
+			case 't':
+				b.WriteByte('\t')
+			case 'n':
+				b.WriteByte('\n')
+			case 'f':
+				b.WriteByte('\f')
+			case 'r':
+				b.WriteByte('\r')
+			case 'u', 'U':
+				size := 4
+				if esc == 'U' {
+					size = 8
+				}
+				if p.pos+size > len(p.s) {
+					return "", fmt.Errorf("short \\%c escape", esc)
+				}
+				r, err := strconv.ParseUint(p.s[p.pos:p.pos+size], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(r)) {
+					return "", fmt.Errorf("invalid \\%c escape", esc)
+				}
+				b.WriteRune(rune(r))
+				p.pos += size
+			default:
+				return "", fmt.Errorf("invalid escape \\%c", esc)
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", fmt.Errorf("unterminated string")
+}
+
+// value reads a string, integer, boolean, array or inline table
+func (p *tomlParser) value() (interface{}, error) {
+	p.space()
+	switch c := p.peek(); {
+	case c == '"' || c == '\'':
+		return p.str()
+	case c == '[':
+		p.pos++
+		values := []interface{}{}
+		for {
+			p.blank()
+			if p.consume(']') {
+				return values, nil
+			}
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			p.blank()
+			if !p.consume(',') {
+				if !p.consume(']') {
+					return nil, fmt.Errorf("expected , or ] in array")
+				}
+				return values, nil
+			}
+		}
+	case c == '{':
+		p.pos++
+		t := make(map[string]interface{})
+		if p.consume('}') {
+			return t, nil
+		}
+		for {
+			if p.space(); p.peek() == '\n' || p.pos == len(p.s) {
+				return nil, fmt.Errorf("unterminated inline table (inline tables must be on one line)")
+			}
+			if _, err := p.keyValue(t); err != nil {
+				return nil, err
+			}
+			if p.consume('}') {
+				return t, nil
+			}
+			if !p.consume(',') {
+				if p.peek() == '\n' || p.pos == len(p.s) {
+					return nil, fmt.Errorf("unterminated inline table (inline tables must be on one line)")
+				}
+				return nil, fmt.Errorf("expected , or } in inline table")
+			}
+		}
+	}
+
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(" \t\n,]}#", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	word := p.s[start:p.pos]
+	switch word {
+	case "":
+		return nil, fmt.Errorf("expected a value")
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	n, err := strconv.ParseInt(strings.ReplaceAll(word, "_", ""), 10, 64)
+	if err != nil {
+		return nil, unsupportedTOMLValue(word)
+	}
+	return n, nil
+}
+
+// tomlDateTime matches the start of a TOML date or time
+var tomlDateTime = regexp.MustCompile(`^([0-9]{4}-[0-9]{2}-[0-9]{2}|[0-9]{2}:[0-9]{2})`)
+
+// unsupportedTOMLValue names the TOML feature word uses, where it is one a
+// lock file has no need for
+func unsupportedTOMLValue(word string) error {
+	if tomlDateTime.MatchString(word) {
+		return fmt.Errorf("dates and times are not supported (%s)", word)
+	}
+	number := strings.TrimLeft(strings.ReplaceAll(word, "_", ""), "+-")
+	if _, err := strconv.ParseFloat(number, 64); err == nil {
+		return fmt.Errorf("floats are not supported (%s)", word)
+	}
+	if strings.HasPrefix(number, "0x") || strings.HasPrefix(number, "0o") || strings.HasPrefix(number, "0b") {
+		return fmt.Errorf("hexadecimal, octal and binary integers are not supported (%s)", word)
+	}
+	return fmt.Errorf("unsupported value %q", word)
+}
+
+// tomlField is one key of a JSON object, in document order
+type tomlField struct {
+	Key   string
+	Value interface{}
+}
+
+// decodeOrdered decodes the next JSON value from dec, keeping object fields
+// in order as []tomlField
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		var fields []tomlField
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, tomlField{Key: key.(string), Value: value})
+		}
+		_, err = dec.Token()
+		return fields, err
+	case json.Delim('['):
+		values := []interface{}{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		_, err = dec.Token()
+		return values, err
+	}
+	return tok, nil
+}
+
+// marshalTOMLLockFile renders lockFile as TOML with the same keys, order and
+// values as the JSON lock file, putting back the comments it was read with
+func marshalTOMLLockFile(lockFile *LockFile) ([]byte, error) {
+	data, err := marshalLockFile(lockFile)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	doc, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = writeTOMLTable(&buf, nil, doc.([]tomlField), lockFile.comments)
+	if err != nil {
+		return nil, err
+	}
+	if trailer := lockFile.comments[tomlTrailer]; len(trailer.Above) > 0 {
+		buf.WriteString("\n" + strings.Join(trailer.Above, "\n") + "\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// writeTOMLTable writes the values of a table and then its subtables.
+// Tables with no values of their own, like [dependencies], get no header.
+func writeTOMLTable(w io.Writer, path []string, fields []tomlField, comments map[string]tomlComment) error {
+	writeComment := func(key string, line string) {
+		comment := comments[key]
+		for _, above := range comment.Above {
+			fmt.Fprintln(w, above)
+		}
+		if comment.Inline != "" {
+			line += " " + comment.Inline
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	var values, tables []tomlField
+	for _, field := range fields {
+		if _, isTable := field.Value.([]tomlField); isTable {
+			tables = append(tables, field)
+		} else {
+			values = append(values, field)
+		}
+	}
+
+	if len(values) > 0 && len(path) > 0 {
+		fmt.Fprintln(w)
+		writeComment(tomlKeyPath(path), "["+tomlKeyPath(path)+"]")
+	}
+	for _, field := range values {
+		value, err := tomlValue(field.Value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", tomlKeyPath(append(path, field.Key)), err)
+		}
+		key := tomlKeyPath([]string{field.Key})
+		writeComment(tomlKeyPath(append(append([]string(nil), path...), field.Key)), key+" = "+value)
+	}
+
+	for _, table := range tables {
+		subPath := append(append([]string(nil), path...), table.Key)
+		if err := writeTOMLTable(w, subPath, table.Value.([]tomlField), comments); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tomlValue renders a JSON scalar or array as a TOML value
+func tomlValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return tomlString(v), nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := tomlValue(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	}
+	return "", fmt.Errorf("can't be written as TOML (%T)", v)
+}
+
+// parseTOMLLockFile parses a TOML lock file by way of its JSON form, so the
+// two formats share field names, migrations and validation
+func parseTOMLLockFile(data []byte) (*LockFile, int, error) {
+	tree, comments, err := parseTOML(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	jsonData, err := json.Marshal(tree)
+	if err != nil {
+		return nil, 0, err
+	}
+	lockFile, from, err := parseLockFile(jsonData)
+	if err != nil {
+		return nil, from, err
+	}
+	lockFile.comments = comments
+	return lockFile, from, nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testTOMLLock = `# Lock file for the build scripts
+version = 1
+
+# Our fork until upstream merges the Windows fix
+[dependencies."github.com/user/fork"]
+ref = "windows-fix" # see user/fork#12
+sha = "75ccf94d605a05fe24817fc2f166f6f2959d5cea"
+hash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+pinned = true
+
+[dependencies."github.com/user/repo"]
+ref = "v1.2.3"
+sha = "abc123def456abc123def456abc123def456abc1"
+constraint = "^1.2"
+
+[dependencies."github.com/user/repo".metadata]
+ref_kind = "tag"
+license = "MIT"
+
+# Trailing notes
+`
+
+func TestParseTOMLLockFile(t *testing.T) {
+	lockFile, from, err := parseTOMLLockFile([]byte(testTOMLLock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != 1 {
+		t.Errorf("version = %d, want 1", from)
+	}
+
+	fork := lockFile.Dependencies["github.com/user/fork"]
+	if fork.Ref != "windows-fix" || fork.SHA != "75ccf94d605a05fe24817fc2f166f6f2959d5cea" || !fork.Pinned {
+		t.Errorf("fork = %+v", fork)
+	}
+	repo := lockFile.Dependencies["github.com/user/repo"]
+	if repo.Constraint != "^1.2" || repo.Metadata == nil || repo.Metadata.License != "MIT" {
+		t.Errorf("repo = %+v", repo)
+	}
+
+	want := tomlComment{Above: []string{"# Our fork until upstream merges the Windows fix"}}
+	if got := lockFile.comments[`dependencies."github.com/user/fork"`]; !reflect.DeepEqual(got, want) {
+		t.Errorf("table comment = %+v, want %+v", got, want)
+	}
+	if got := lockFile.comments[`dependencies."github.com/user/fork".ref`].Inline; got != "# see user/fork#12" {
+		t.Errorf("inline comment = %q", got)
+	}
+}
+
+func TestMarshalTOMLLockFile_RoundTrip(t *testing.T) {
+	lockFile, _, err := parseTOMLLockFile([]byte(testTOMLLock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := marshalTOMLLockFile(lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != testTOMLLock {
+		t.Errorf("round trip changed the file:\n%s", data)
+	}
+}
+
+func TestMarshalTOMLLockFile_Changes(t *testing.T) {
+	lockFile, _, err := parseTOMLLockFile([]byte(testTOMLLock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(lockFile.Dependencies, "github.com/user/repo")
+	fork := lockFile.Dependencies["github.com/user/fork"]
+	fork.SHA = "1111111111111111111111111111111111111111"
+	lockFile.Dependencies["github.com/user/fork"] = fork
+	lockFile.Dependencies["github.com/user/new"] = Dependency{Ref: `quote"d`, SHA: "2222222222222222222222222222222222222222"}
+
+	data, err := marshalTOMLLockFile(lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	for _, want := range []string{
+		"# Our fork until upstream merges the Windows fix\n[dependencies.\"github.com/user/fork\"]\n",
+		`ref = "windows-fix" # see user/fork#12`,
+		`sha = "1111111111111111111111111111111111111111"`,
+		`ref = "quote\"d"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "github.com/user/repo") {
+		t.Errorf("removed dependency still written:\n%s", got)
+	}
+
+	reparsed, _, err := parseTOMLLockFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reparsed.Dependencies, lockFile.Dependencies) {
+		t.Errorf("reparsed = %+v, want %+v", reparsed.Dependencies, lockFile.Dependencies)
+	}
+}
+
+func TestParseTOML_Values(t *testing.T) {
+	tree, _, err := parseTOML([]byte(`a.b = 'C:\path'
+list = ["x", 'y', ] # trailing comma
+n = 1_000
+s = "tab\there \u00e9"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"a":    map[string]interface{}{"b": `C:\path`},
+		"list": []interface{}{"x", "y"},
+		"n":    int64(1000),
+		"s":    "tab\there é",
+	}
+	if !reflect.DeepEqual(tree, want) {
+		t.Errorf("tree = %#v, want %#v", tree, want)
+	}
+}
+
+// A lock file as someone might write it by hand, with arrays over several
+// lines and inline tables
+const handWrittenTOMLLock = `version = 1
+
+[dependencies."github.com/org/monorepo//packages/ui"]
+ref = "v2.0.0"
+sha = "abc123def456abc123def456abc123def456abc1"
+only = [
+  "src/**",   # the sources
+  "LICENSE",
+]
+exclude = [ "src/**/*_test.go",
+            "src/testdata/**" ]
+rename = { "src/index.ts" = "index.ts", "README.md" = "docs/README.md" }
+
+[dependencies]
+"github.com/user/repo" = { ref = "main", sha = "75ccf94d605a05fe24817fc2f166f6f2959d5cea", pinned = true }
+`
+
+func TestParseTOMLLockFile_HandWritten(t *testing.T) {
+	lockFile, _, err := parseTOMLLockFile([]byte(handWrittenTOMLLock))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ui := lockFile.Dependencies["github.com/org/monorepo//packages/ui"]
+	if want := []string{"src/**", "LICENSE"}; !reflect.DeepEqual(ui.Only, want) {
+		t.Errorf("only = %q, want %q", ui.Only, want)
+	}
+	if want := []string{"src/**/*_test.go", "src/testdata/**"}; !reflect.DeepEqual(ui.Exclude, want) {
+		t.Errorf("exclude = %q, want %q", ui.Exclude, want)
+	}
+	if want := map[string]string{"src/index.ts": "index.ts", "README.md": "docs/README.md"}; !reflect.DeepEqual(ui.Rename, want) {
+		t.Errorf("rename = %v, want %v", ui.Rename, want)
+	}
+	repo := lockFile.Dependencies["github.com/user/repo"]
+	if repo.Ref != "main" || repo.SHA != "75ccf94d605a05fe24817fc2f166f6f2959d5cea" || !repo.Pinned {
+		t.Errorf("repo = %+v", repo)
+	}
+
+	// Rewriting it gives the same dependencies, in deps' own layout
+	data, err := marshalTOMLLockFile(lockFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reparsed, _, err := parseTOMLLockFile(data)
+	if err != nil {
+		t.Fatalf("%v in:\n%s", err, data)
+	}
+	if !reflect.DeepEqual(reparsed.Dependencies, lockFile.Dependencies) {
+		t.Errorf("reparsed = %+v, want %+v", reparsed.Dependencies, lockFile.Dependencies)
+	}
+}
+
+func TestParseTOML_Errors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"a = 1\na = 2", "line 2: duplicate key a"},
+		{"[t]\n[t]", "line 2: table [t] defined twice"},
+		{"[[deps]]", "arrays of tables are not supported"},
+		{`a = """x"""`, "multi-line strings are not supported"},
+		{`a = "open`, "unterminated string"},
+		{"a = 1 2", "unexpected"},
+		{"a = 1\n[a]", "a is a value, not a table"},
+		{"a = nope", `unsupported value "nope"`},
+		{"a = ", "line 1: expected a value"},
+		{"a = [\n  1,\n  2 3\n]", "line 3: expected , or ] in array"},
+		{"a = [1,\n", "line 2: expected a value"},
+		{"a = { b = 1\n}", "line 1: unterminated inline table"},
+		{"a = { b = 1, b = 2 }", "duplicate key b"},
+		{`a = "x` + "\n" + `"`, "line 1: unterminated string"},
+		{"a = 1.5", "floats are not supported"},
+		{"a = 1979-05-27", "dates and times are not supported"},
+		{"a = 0xff", "hexadecimal, octal and binary integers are not supported"},
+	}
+	for _, tt := range tests {
+		_, _, err := parseTOML([]byte(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseTOML(%q) error = %v, want %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestLockFilePath(t *testing.T) {
+	cleanup := withTempDir(t)
+	defer cleanup()
+
+	if got := lockFilePath(); got != jsonLockFile {
+		t.Errorf("with no lock file, lockFilePath() = %q", got)
+	}
+
+	os.WriteFile(tomlLockFile, []byte(testTOMLLock), 0644)
+	if got := lockFilePath(); got != tomlLockFile {
+		t.Errorf("with only .deps.toml, lockFilePath() = %q", got)
+	}
+
+	lockFile := loadLockFile()
+	lockFile.Dependencies["github.com/user/new"] = Dependency{Ref: "main", SHA: "2222222222222222222222222222222222222222"}
+	if err := saveLockFile(lockFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(jsonLockFile); !os.IsNotExist(err) {
+		t.Errorf("saving a TOML lock file created %s", jsonLockFile)
+	}
+	data, _ := os.ReadFile(tomlLockFile)
+	if !strings.Contains(string(data), "# Our fork until upstream") || !strings.Contains(string(data), `[dependencies."github.com/user/new"]`) {
+		t.Errorf("unexpected %s:\n%s", tomlLockFile, data)
+	}
+
+	os.WriteFile(jsonLockFile, []byte(`{"dependencies": {}}`), 0644)
+	if got := lockFilePath(); got != jsonLockFile {
+		t.Errorf("with both, lockFilePath() = %q", got)
+	}
+}
+
+func TestValidateTOMLLockData(t *testing.T) {
+	if problems := validateTOMLLockData([]byte(testTOMLLock)); len(problems) != 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+
+	problems := validateTOMLLockData([]byte("[dependencies.\"github.com/user/repo\"]\nref = \"main\"\nsha = \"75ccf94\"\ncolour = \"red\"\n"))
+	want := []string{
+		`github.com/user/repo: unknown field "colour"`,
+		`github.com/user/repo: sha "75ccf94" is not a full 40-character commit SHA`,
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("problems = %v, want %v", problems, want)
+	}
+
+	if problems := validateTOMLLockData([]byte("a = ")); len(problems) != 1 || !strings.HasPrefix(problems[0], "invalid TOML") {
+		t.Errorf("problems = %v", problems)
+	}
+}
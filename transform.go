@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// hasTransforms reports whether dep changes the layout of what it downloads
+func hasTransforms(dep Dependency) bool {
+	return dep.Strip > 0 || len(dep.Rename) > 0
+}
+
+// validateTransformPath checks a rename source or target: a clean relative
+// path inside the dependency, or "." for its root
+func validateTransformPath(p string) error {
+	if p == "" || path.IsAbs(p) || path.Clean(p) != p || p == ".." || strings.HasPrefix(p, "../") || strings.Contains(p, "\\") {
+		return fmt.Errorf("invalid path %q (paths are relative to the dependency, with / separators)", p)
+	}
+	return nil
+}
+
+// validateTransforms returns the problems with the strip and rename settings
+// of dep
+func validateTransforms(dep Dependency) []string {
+	var problems []string
+	if dep.Strip < 0 {
+		problems = append(problems, fmt.Sprintf("strip %d is negative", dep.Strip))
+	}
+	for from, to := range dep.Rename {
+		if err := validateTransformPath(from); err != nil {
+			problems = append(problems, "rename: "+err.Error())
+		}
+		if err := validateTransformPath(to); err != nil {
+			problems = append(problems, "rename: "+err.Error())
+		}
+	}
+	return problems
+}
+
+// transformPath returns where the file at the slash-separated path name is
+// installed: strip leading directories are removed, and then the longest
+// rename source that is name or one of its directories is replaced by its
+// target. It reports false for files stripped away entirely.
+func transformPath(name string, strip int, rename map[string]string) (string, bool) {
+	segments := strings.Split(name, "/")
+	if len(segments) <= strip {
+		return "", false
+	}
+	name = strings.Join(segments[strip:], "/")
+
+	from, found := "", false
+	for source := range rename {
+		matches := source == "." || name == source || strings.HasPrefix(name, source+"/")
+		if matches && (!found || len(source) > len(from)) {
+			from, found = source, true
+		}
+	}
+	if !found {
+		return name, true
+	}
+	rest := name
+	if from != "." {
+		rest = strings.TrimPrefix(strings.TrimPrefix(name, from), "/")
+	}
+	return path.Join(rename[from], rest), true
+}
+
+// transformTree rearranges the files under dir as transformPath describes.
+// The files are moved into a sibling directory that then replaces dir, so a
+// rename can't overwrite a file that hasn't been moved yet. A .git directory
+// is kept where it is.
+func transformTree(dir string, strip int, rename map[string]string) error {
+	staging := dir + ".transform"
+	os.RemoveAll(staging)
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		return err
+	}
+
+	moved := make(map[string]string)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == ".git" {
+			if err := os.Rename(p, filepath.Join(staging, ".git")); err != nil {
+				return err
+			}
+			return filepath.SkipDir
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		target, keep := transformPath(rel, strip, rename)
+		if !keep {
+			return nil
+		}
+		if target == "." {
+			return fmt.Errorf("rename would install %s as the dependency's directory itself", rel)
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			// A relative link moved elsewhere may no longer stay inside
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			if _, inside := linkTargetInside(archiveLink{Name: target, Target: filepath.ToSlash(link)}); !inside {
+				warnf("%s Skipped symlink %s -> %s in %s: moved to %s, it would point outside the dependency\n", colorize(colorYellow, "!"), rel, link, dir, target)
+				return nil
+			}
+		}
+		if source, exists := moved[target]; exists {
+			return fmt.Errorf("%s and %s would both be installed as %s", source, rel, target)
+		}
+		moved[target] = rel
+
+		dest := filepath.Join(staging, filepath.FromSlash(target))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		return os.Rename(p, dest)
+	})
+	if err != nil {
+		os.RemoveAll(staging)
+		return fmt.Errorf("transforming %s: %v", dir, err)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		os.RemoveAll(staging)
+		return err
+	}
+	return os.Rename(staging, dir)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTransformPath(t *testing.T) {
+	rename := map[string]string{"dist": ".", "dist/types": "types", "README.md": "docs/README.md"}
+	tests := []struct {
+		name  string
+		strip int
+		want  string
+		keep  bool
+	}{
+		{"dist/lib.js", 0, "lib.js", true},
+		{"dist/types/index.d.ts", 0, "types/index.d.ts", true},
+		{"README.md", 0, "docs/README.md", true},
+		{"src/lib.ts", 0, "src/lib.ts", true},
+		{"distfiles/x", 0, "distfiles/x", true},
+		{"package/dist/lib.js", 1, "lib.js", true},
+		{"LICENSE", 1, "", false},
+	}
+	for _, tt := range tests {
+		got, keep := transformPath(tt.name, tt.strip, rename)
+		if got != tt.want || keep != tt.keep {
+			t.Errorf("transformPath(%q, %d) = %q, %v, want %q, %v", tt.name, tt.strip, got, keep, tt.want, tt.keep)
+		}
+	}
+
+	if got, _ := transformPath("a/b", 0, map[string]string{".": "vendor/lib"}); got != "vendor/lib/a/b" {
+		t.Errorf("renaming the root gave %q", got)
+	}
+}
+
+func TestValidateTransforms(t *testing.T) {
+	if problems := validateTransforms(Dependency{Strip: 1, Rename: map[string]string{"dist": ".", "a/b": "c"}}); len(problems) > 0 {
+		t.Errorf("unexpected problems: %v", problems)
+	}
+	problems := validateTransforms(Dependency{Strip: -1, Rename: map[string]string{"../x": "y", "z": "/abs", "w/": "v"}})
+	if len(problems) != 4 {
+		t.Errorf("expected 4 problems, got %v", problems)
+	}
+}
+
+func TestTransformTree(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dep")
+	writeTree(t, dir, map[string]string{
+		"pkg/dist/lib.js":   "lib",
+		"pkg/dist/lib.d.ts": "types",
+		"pkg/LICENSE":       "MIT",
+		"pkg/src/lib.ts":    "src",
+		"top.txt":           "stripped",
+	})
+
+	if err := transformTree(dir, 1, map[string]string{"dist": "."}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"lib.js", "lib.d.ts", "LICENSE", "src/lib.ts"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s missing: %v", name, err)
+		}
+	}
+	for _, name := range []string{"top.txt", "pkg", "dist"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should be gone", name)
+		}
+	}
+	if _, err := os.Stat(dir + ".transform"); !os.IsNotExist(err) {
+		t.Error("staging directory left behind")
+	}
+}
+
+func TestTransformTree_Collision(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dep")
+	writeTree(t, dir, map[string]string{
+		"dist/LICENSE": "dist",
+		"LICENSE":      "root",
+	})
+
+	err := transformTree(dir, 0, map[string]string{"dist": "."})
+	if err == nil || !strings.Contains(err.Error(), "would both be installed as LICENSE") {
+		t.Errorf("expected a collision error, got %v", err)
+	}
+	if _, err := os.Stat(dir + ".transform"); !os.IsNotExist(err) {
+		t.Error("staging directory left behind")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// A URL source is an archive downloaded from a plain URL, like a release
+// tarball on a project's own site or a GitHub release asset, rather than a
+// repository at a commit. Its lock key is the URL itself, and its entry has
+// no ref or sha: there is nothing to resolve, so check and update leave it
+// as it is. The SHA-256 of the download, recorded as its hash when it is
+// first installed, is what pins it, and a download that no longer matches
+// fails the install. The archive is extracted as it is, in any format
+// extractArchive recognizes; strip removes a top-level directory.
+
+// errNoRefs is the error for resolving or listing the refs of a URL source
+var errNoRefs = errors.New("a URL source has no refs or tags")
+
+// isURLSource reports whether the lock key is a URL source
+func isURLSource(key string) bool {
+	return strings.HasPrefix(key, "https://") || strings.HasPrefix(key, "http://")
+}
+
+// urlSourceKey returns the lock key of the URL source at rawURL: the URL
+// with its host lowercased, its path cleaned and any fragment dropped
+func urlSourceKey(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q: %v", rawURL, err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil {
+		return "", fmt.Errorf("invalid URL %q (expected an http or https URL, without credentials)", rawURL)
+	}
+	cleaned := path.Clean("/" + u.Path)
+	if cleaned == "/" {
+		return "", fmt.Errorf("invalid URL %q (expected the URL of an archive)", rawURL)
+	}
+	key := u.Scheme + "://" + strings.ToLower(u.Host) + cleaned
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+	return key, nil
+}
+
+// validateURLSourceKey checks that a URL source's lock key, before any
+// "#name", is a URL as urlSourceKey writes it
+func validateURLSourceKey(key string) error {
+	rawURL, _ := splitEntryName(key)
+	canonical, err := urlSourceKey(rawURL)
+	if err != nil {
+		return err
+	}
+	if canonical != rawURL {
+		return fmt.Errorf("expected %s", canonical)
+	}
+	return nil
+}
+
+// validateURLSource checks the fields of a URL source's lock entry, which
+// can't have any of those that only make sense for a repository
+func validateURLSource(dep Dependency) []string {
+	var problems []string
+	for _, field := range []struct {
+		name string
+		set  bool
+	}{
+		{"ref", dep.Ref != ""},
+		{"sha", dep.SHA != ""},
+		{"transport", dep.Transport != ""},
+		{"submodules", dep.Submodules},
+		{"lfs", dep.LFS},
+		{"constraint", dep.Constraint != ""},
+		{"pre", dep.Pre},
+		{"tag_prefix", dep.TagPrefix != ""},
+		{"pinned", dep.Pinned},
+		{"policy", dep.Policy != ""},
+	} {
+		if field.set {
+			problems = append(problems, fmt.Sprintf("%s can't be set for a URL source", field.name))
+		}
+	}
+	return problems
+}
+
+// describeDep names the dependency at repoURL in messages: with the ref and
+// commit it is locked at, or for a URL source the start of its hash
+func describeDep(repoURL string, dep Dependency) string {
+	if !isURLSource(repoURL) {
+		return fmt.Sprintf("%s@%s (%s)", repoURL, dep.Ref, dep.SHA[:8])
+	}
+	if len(dep.Hash) >= 8 {
+		return fmt.Sprintf("%s (sha256 %s)", repoURL, dep.Hash[:8])
+	}
+	return repoURL
+}
+
+// downloadURLSource downloads the archive of the URL source repoURL and
+// extracts all of it into its install directory, returning the SHA-256 of
+// the download
+func downloadURLSource(repoURL string) (string, error) {
+	rawURL, _ := splitEntryName(repoURL)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	tmpFile, err := createTemp("", "deps-download-*")
+	if err != nil {
+		return "", err
+	}
+	defer removeTemp(tmpFile.Name())
+	defer tmpFile.Close()
+	label := u.Host + u.Path
+	p := startProgress(label, -1)
+	defer p.finish()
+	urlError := func(resp *http.Response) error {
+		return &statusError{Service: u.Host, StatusCode: resp.StatusCode}
+	}
+	if err := downloadResumable(rawURL, label, tmpFile, p, urlError); err != nil {
+		return "", err
+	}
+
+	hash, err := hashFile(tmpFile.Name())
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmpFile.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	depPath := getDepPath(repoURL)
+	if err := extractWholeArchive(tmpFile, depPath); err != nil {
+		return "", err
+	}
+
+	infof("Downloaded to %s\n", depPath)
+	return hash, nil
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// jsonFieldNames returns the JSON names of the fields of struct type t
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// findDuplicateKeys lists the keys that appear more than once in the same
+// JSON object, as "path.key". encoding/json silently keeps the last one,
+// which hides botched merge resolutions.
+func findDuplicateKeys(data []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var duplicates []string
+
+	var walk func(path string) error
+	walk = func(path string) error {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'):
+			seen := make(map[string]bool)
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				key := keyTok.(string)
+				if seen[key] {
+					duplicates = append(duplicates, strings.TrimPrefix(path+"."+key, "."))
+				}
+				seen[key] = true
+				if err := walk(path + "." + key); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+			return err
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				if err := walk(fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+			_, err = dec.Token()
+			return err
+		}
+		return nil
+	}
+
+	if err := walk(""); err != nil {
+		return nil, err
+	}
+	return duplicates, nil
+}
+
+// isHexDigest reports whether s is a lowercase hex string of n bytes
+func isHexDigest(s string, n int) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == n && strings.ToLower(s) == s
+}
+
+// validateLockData checks lock file data against the lock file schema
+// (schema/deps.lock.schema.json) and the rules deps applies when reading
+// entries, returning every problem found rather than just the first
+func validateLockData(data []byte) []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	duplicates, err := findDuplicateKeys(data)
+	if err != nil {
+		return []string{fmt.Sprintf("invalid JSON: %v", err)}
+	}
+	for _, key := range duplicates {
+		add("%s: duplicate key", key)
+	}
+
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(data, &top); err != nil {
+		return append(problems, fmt.Sprintf("lock file must be a JSON object: %v", err))
+	}
+	known := jsonFieldNames(reflect.TypeOf(LockFile{}))
+	for _, key := range sortedRawKeys(top) {
+		if !known[key] {
+			add("%s: unknown field", key)
+		}
+	}
+
+	if raw, exists := top["version"]; exists {
+		var version int
+		if err := json.Unmarshal(raw, &version); err != nil || version < 0 {
+			add("version: must be a non-negative integer")
+		} else if version > lockFileVersion {
+			add("version: %d is newer than this deps understands (%d)", version, lockFileVersion)
+		}
+	}
+
+	raw, exists := top["dependencies"]
+	if !exists {
+		return append(problems, "dependencies: missing")
+	}
+	var deps map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &deps); err != nil {
+		return append(problems, "dependencies: must be an object")
+	}
+
+	knownDep := jsonFieldNames(reflect.TypeOf(Dependency{}))
+	aliases := make(map[string]string)
+	installPaths := make(map[string]string)
+	for _, repoURL := range sortedRawKeys(deps) {
+		if err := validateRepoURL(repoURL); err != nil {
+			add("%s: invalid repository URL: %v", repoURL, err)
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(deps[repoURL], &fields); err != nil {
+			add("%s: entry must be an object", repoURL)
+			continue
+		}
+		for _, key := range sortedRawKeys(fields) {
+			if !knownDep[key] {
+				add("%s: unknown field %q", repoURL, key)
+			}
+		}
+		var metadata map[string]json.RawMessage
+		if json.Unmarshal(fields["metadata"], &metadata) == nil {
+			knownMeta := jsonFieldNames(reflect.TypeOf(DependencyMetadata{}))
+			for _, key := range sortedRawKeys(metadata) {
+				if !knownMeta[key] {
+					add("%s: unknown metadata field %q", repoURL, key)
+				}
+			}
+		}
+
+		var dep Dependency
+		if err := json.Unmarshal(deps[repoURL], &dep); err != nil {
+			add("%s: %v", repoURL, err)
+			continue
+		}
+		for _, problem := range validateDependency(repoURL, dep) {
+			add("%s: %s", repoURL, problem)
+		}
+		if _, name := splitEntryName(repoURL); name != "" && dep.Alias != name {
+			add("%s: alias must be %q, the entry name after #", repoURL, name)
+		}
+		aliasTaken := false
+		if dep.Alias != "" {
+			if otherURL, taken := aliases[dep.Alias]; taken {
+				add("%s: alias %s is already used by %s", repoURL, dep.Alias, otherURL)
+				aliasTaken = true
+			}
+			aliases[dep.Alias] = repoURL
+		}
+		// Besides a shared alias, the flat layout can give two keys one name
+		if path := depPathFor(repoURL, dep.Alias); !aliasTaken {
+			if otherURL, taken := installPaths[path]; taken {
+				add("%s: would be installed in %s, like %s", repoURL, path, otherURL)
+			}
+			installPaths[path] = repoURL
+		}
+	}
+
+	if raw, exists := top["profiles"]; exists {
+		var profiles map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &profiles); err != nil {
+			return append(problems, "profiles: must be an object")
+		}
+		for _, name := range sortedRawKeys(profiles) {
+			if !aliasPattern.MatchString(name) {
+				add("profiles.%s: invalid profile name (use letters, digits, - and _)", name)
+			}
+			var overrides map[string]json.RawMessage
+			if err := json.Unmarshal(profiles[name], &overrides); err != nil {
+				add("profiles.%s: must be an object", name)
+				continue
+			}
+			for _, repoURL := range sortedRawKeys(overrides) {
+				where := fmt.Sprintf("profiles.%s.%s", name, repoURL)
+				if _, exists := deps[repoURL]; !exists {
+					add("%s: overrides a dependency that isn't in the lock file", where)
+				}
+				var fields map[string]json.RawMessage
+				if err := json.Unmarshal(overrides[repoURL], &fields); err != nil {
+					add("%s: override must be an object", where)
+					continue
+				}
+				for _, key := range sortedRawKeys(fields) {
+					if !knownDep[key] && key != "repo" {
+						add("%s: unknown field %q", where, key)
+					}
+				}
+
+				var override ProfileOverride
+				if err := json.Unmarshal(overrides[repoURL], &override); err != nil {
+					add("%s: %v", where, err)
+					continue
+				}
+				// An override's repo replaces the URL it is installed from
+				source := repoURL
+				if override.Repo != "" {
+					source = override.Repo
+				}
+				for _, problem := range validateDependency(source, override.Dependency) {
+					add("%s: %s", where, problem)
+				}
+				if override.Repo != "" {
+					if err := validateRepoURL(override.Repo); err != nil {
+						add("%s: invalid repo: %v", where, err)
+					}
+				}
+				if override.Alias != "" {
+					add("%s: alias is taken from the dependency it overrides", where)
+				}
+			}
+		}
+	}
+
+	if raw, exists := top["tasks"]; exists {
+		var tasks map[string]string
+		if err := json.Unmarshal(raw, &tasks); err != nil {
+			return append(problems, "tasks: must be an object of commands")
+		}
+		for _, problem := range validateTasks(tasks) {
+			add("tasks.%s", problem)
+		}
+	}
+
+	if raw, exists := top["resolution"]; exists {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return append(problems, "resolution: must be an object")
+		}
+		knownResolution := jsonFieldNames(reflect.TypeOf(Resolution{}))
+		for _, key := range sortedRawKeys(fields) {
+			if !knownResolution[key] {
+				add("resolution: unknown field %q", key)
+			}
+		}
+		var resolution Resolution
+		if err := json.Unmarshal(raw, &resolution); err != nil {
+			return append(problems, fmt.Sprintf("resolution: %v", err))
+		}
+		for _, problem := range validateResolution(resolution) {
+			add("resolution.%s", problem)
+		}
+	}
+
+	return problems
+}
+
+// validateTOMLLockData checks a TOML lock file the same way, by way of its
+// JSON form. The TOML parser already rejects duplicate keys.
+func validateTOMLLockData(data []byte) []string {
+	tree, _, err := parseTOML(data)
+	if err != nil {
+		return []string{fmt.Sprintf("invalid TOML: %v", err)}
+	}
+	jsonData, err := json.Marshal(tree)
+	if err != nil {
+		return []string{fmt.Sprintf("invalid TOML: %v", err)}
+	}
+	return validateLockData(jsonData)
+}
+
+// validateDependency checks the values of the lock entry for repoURL
+func validateDependency(repoURL string, dep Dependency) []string {
+	var problems []string
+	if isURLSource(repoURL) {
+		problems = validateURLSource(dep)
+	} else {
+		problems = validateRepoFields(dep)
+	}
+	if dep.Hash != "" && !isHexDigest(dep.Hash, 32) {
+		problems = append(problems, fmt.Sprintf("hash %q is not a SHA-256 hex digest", dep.Hash))
+	}
+	if dep.TreeHash != "" && !isHexDigest(dep.TreeHash, 32) {
+		problems = append(problems, fmt.Sprintf("tree_hash %q is not a SHA-256 hex digest", dep.TreeHash))
+	}
+	if meta := dep.Metadata; meta != nil {
+		switch meta.RefKind {
+		case "", "branch", "tag", "sha":
+		default:
+			problems = append(problems, fmt.Sprintf("metadata ref_kind %q is not branch, tag or sha", meta.RefKind))
+		}
+		if _, err := time.Parse(time.RFC3339, meta.ResolvedAt); meta.ResolvedAt != "" && err != nil {
+			problems = append(problems, fmt.Sprintf("metadata resolved_at %q is not an RFC 3339 time", meta.ResolvedAt))
+		}
+	}
+	problems = append(problems, validateTransforms(dep)...)
+	for _, pattern := range append(append([]string(nil), dep.Only...), dep.Exclude...) {
+		if err := validateGlob(pattern); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if _, err := sizeBudget(dep); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if dep.Alias != "" {
+		if err := validateAlias(dep.Alias); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if dep.Policy != "" {
+		if _, err := withPolicy(dep, dep.Policy); err != nil || dep.Policy == policyAuto {
+			problems = append(problems, fmt.Sprintf("policy %q is not valid here", dep.Policy))
+		}
+	}
+	return problems
+}
+
+// validateRepoFields checks the values only the entry of a repository has
+func validateRepoFields(dep Dependency) []string {
+	var problems []string
+	if dep.Ref == "" {
+		problems = append(problems, "ref is empty")
+	}
+	if !isHexDigest(dep.SHA, 20) {
+		problems = append(problems, fmt.Sprintf("sha %q is not a full 40-character commit SHA", dep.SHA))
+	}
+	if dep.Transport != transportHTTPS && dep.Transport != transportSSH {
+		problems = append(problems, fmt.Sprintf("transport %q is not %q", dep.Transport, transportSSH))
+	}
+	if dep.Constraint != "" {
+		if _, err := parseConstraint(dep.Constraint); err != nil {
+			problems = append(problems, fmt.Sprintf("constraint %q: %v", dep.Constraint, err))
+		}
+	}
+	return problems
+}
+
+// sortedRawKeys returns the keys of a decoded JSON object in order
+func sortedRawKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
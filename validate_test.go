@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateLockData_Valid(t *testing.T) {
+	data := `{
+  "version": 1,
+  "dependencies": {
+    "github.com/user/repo": {
+      "ref": "v1.2.3",
+      "sha": "75ccf94d605a05fe24817fc2f166f6f2959d5cea",
+      "hash": "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+      "constraint": "^1.2",
+      "policy": "semver-range"
+    },
+    "dev.azure.com/org/project/_git/repo": {"ref": "main", "sha": "75ccf94d605a05fe24817fc2f166f6f2959d5cea"},
+    "github.com/user/repo#repo-v2": {"ref": "v2.0.0", "sha": "75ccf94d605a05fe24817fc2f166f6f2959d5cea", "alias": "repo-v2"},
+    "https://example.com/dl/lib-1.0.tar.gz": {"hash": "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", "strip": 1}
+  }
+}`
+	if problems := validateLockData([]byte(data)); len(problems) != 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+}
+
+func TestValidateLockData_Problems(t *testing.T) {
+	data := `{
+  "version": 9,
+  "extra": true,
+  "dependencies": {
+    "github.com/user/repo": {"ref": "main", "sha": "75ccf94d605a05fe24817fc2f166f6f2959d5cea"},
+    "github.com/user/repo": {"ref": "", "sha": "75ccf94", "hash": "xyz", "colour": "red"},
+    "gitlab.com/user/repo": {"ref": "main", "sha": "75ccf94d605a05fe24817fc2f166f6f2959d5cea", "constraint": "^^1", "transport": "ftp"},
+    "github.com/user/other": {"ref": "main", "sha": "75ccf94d605a05fe24817fc2f166f6f2959d5cea", "pinned": "yes"},
+    "github.com/user/meta": {"ref": "main", "sha": "75ccf94d605a05fe24817fc2f166f6f2959d5cea", "metadata": {"ref_kind": "fork", "resolved_at": "yesterday", "stars": 3}},
+    "github.com/user/named": {"ref": "main", "sha": "75ccf94d605a05fe24817fc2f166f6f2959d5cea", "alias": "meta"},
+    "github.com/user/renamed": {"ref": "main", "sha": "75ccf94d605a05fe24817fc2f166f6f2959d5cea", "alias": "meta"},
+    "github.com/user/slashed": {"ref": "main", "sha": "75ccf94d605a05fe24817fc2f166f6f2959d5cea", "alias": "a/b"},
+    "github.com/user/named#v1": {"ref": "v1.0.0", "sha": "75ccf94d605a05fe24817fc2f166f6f2959d5cea", "alias": "named-v1"},
+    "github.com/user/named#bad.name": {"ref": "v1.0.0", "sha": "75ccf94d605a05fe24817fc2f166f6f2959d5cea", "alias": "bad.name"},
+    "https://example.com/lib.zip": {"ref": "main", "pinned": true},
+    "https://Example.com/lib.zip": {}
+  }
+}`
+	problems := validateLockData([]byte(data))
+	joined := strings.Join(problems, "\n")
+	for _, want := range []string{
+		"dependencies.github.com/user/repo: duplicate key",
+		"extra: unknown field",
+		"version: 9 is newer",
+		`github.com/user/repo: unknown field "colour"`,
+		"github.com/user/repo: ref is empty",
+		`github.com/user/repo: sha "75ccf94" is not a full`,
+		`github.com/user/repo: hash "xyz"`,
+		"gitlab.com/user/repo: invalid repository URL",
+		`gitlab.com/user/repo: constraint "^^1"`,
+		`gitlab.com/user/repo: transport "ftp"`,
+		"github.com/user/other: json: cannot unmarshal",
+		`github.com/user/meta: unknown metadata field "stars"`,
+		`github.com/user/meta: metadata ref_kind "fork"`,
+		`github.com/user/meta: metadata resolved_at "yesterday"`,
+		"github.com/user/renamed: alias meta is already used by github.com/user/named",
+		`github.com/user/slashed: invalid alias "a/b"`,
+		`github.com/user/named#v1: alias must be "v1", the entry name after #`,
+		"github.com/user/named#bad.name: invalid repository URL: entry name: invalid alias",
+		"https://example.com/lib.zip: ref can't be set for a URL source",
+		"https://example.com/lib.zip: pinned can't be set for a URL source",
+		"https://Example.com/lib.zip: invalid repository URL: expected https://example.com/lib.zip",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("expected a problem containing %q, got:\n%s", want, joined)
+		}
+	}
+}
+
+func TestValidateLockData_Profiles(t *testing.T) {
+	data := `{
+  "dependencies": {
+    "github.com/user/repo": {"ref": "main", "sha": "75ccf94d605a05fe24817fc2f166f6f2959d5cea"}
+  },
+  "profiles": {
+    "staging": {
+      "github.com/user/repo": {"repo": "github.com/me/repo", "ref": "staging", "sha": "75ccf94d605a05fe24817fc2f166f6f2959d5cea"}
+    },
+    "bad.name": {
+      "github.com/user/missing": {"ref": "main", "sha": "75ccf94d605a05fe24817fc2f166f6f2959d5cea"},
+      "github.com/user/repo": {"repo": "gitlab.com/me/repo", "ref": "", "sha": "75ccf94d605a05fe24817fc2f166f6f2959d5cea", "alias": "x", "colour": "red"}
+    }
+  }
+}`
+	problems := validateLockData([]byte(data))
+	joined := strings.Join(problems, "\n")
+	for _, want := range []string{
+		"profiles.bad.name: invalid profile name",
+		"profiles.bad.name.github.com/user/missing: overrides a dependency that isn't in the lock file",
+		`profiles.bad.name.github.com/user/repo: unknown field "colour"`,
+		"profiles.bad.name.github.com/user/repo: ref is empty",
+		"profiles.bad.name.github.com/user/repo: invalid repo",
+		"profiles.bad.name.github.com/user/repo: alias is taken from the dependency it overrides",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("missing problem %q in:\n%s", want, joined)
+		}
+	}
+	if strings.Contains(joined, "profiles.staging") {
+		t.Errorf("valid profile reported:\n%s", joined)
+	}
+}
+
+func TestValidateLockData_InvalidJSON(t *testing.T) {
+	problems := validateLockData([]byte(`{"dependencies": {`))
+	if len(problems) != 1 || !strings.HasPrefix(problems[0], "invalid JSON") {
+		t.Errorf("problems = %v", problems)
+	}
+}
+
+// The published schema must list exactly the fields deps reads and writes
+func TestLockSchema_MatchesTypes(t *testing.T) {
+	data, err := os.ReadFile("schema/deps.lock.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Properties map[string]struct {
+			Maximum int `json:"maximum"`
+		} `json:"properties"`
+		Defs struct {
+			Dependency struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"dependency"`
+			Metadata struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"metadata"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+
+	keys := func(m map[string]json.RawMessage) map[string]bool {
+		set := make(map[string]bool)
+		for k := range m {
+			set[k] = true
+		}
+		return set
+	}
+	if got, want := keys(schema.Defs.Dependency.Properties), jsonFieldNames(reflect.TypeOf(Dependency{})); !reflect.DeepEqual(got, want) {
+		t.Errorf("schema dependency properties = %v, want %v", got, want)
+	}
+	if got, want := keys(schema.Defs.Metadata.Properties), jsonFieldNames(reflect.TypeOf(DependencyMetadata{})); !reflect.DeepEqual(got, want) {
+		t.Errorf("schema metadata properties = %v, want %v", got, want)
+	}
+	if schema.Properties["version"].Maximum != lockFileVersion {
+		t.Errorf("schema version maximum = %d, want %d", schema.Properties["version"].Maximum, lockFileVersion)
+	}
+}